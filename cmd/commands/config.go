@@ -0,0 +1,390 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/ardanlabs/conf/v2"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/email"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/outbound"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/policy"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/gisquick/gisquick-server/web"
+	"github.com/go-redis/redis/v8"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+const configProfileEnv = "CONFIG_PROFILE"
+
+// Returns path of the configuration profile from command line arguments or environment variable
+func configProfilePath(args []string) string {
+	for i, arg := range args {
+		if arg == "--config-profile" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(arg, "--config-profile=") {
+			return strings.TrimPrefix(arg, "--config-profile=")
+		}
+	}
+	return os.Getenv(configProfileEnv)
+}
+
+// Loads variables from the env file (KEY=value lines) into environment, already defined
+// environment variables are not overridden
+func loadConfigProfile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("reading config profile: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return fmt.Errorf("invalid line %d in config profile %s", n, path)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) > 1 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if _, defined := os.LookupEnv(key); !defined {
+			os.Setenv(key, value)
+		}
+	}
+	return scanner.Err()
+}
+
+// Parses configuration of the server from the config profile, environment variables and command
+// line flags. Returns usage info with conf.ErrHelpWanted error.
+func parseServeConfig(cfg *serveConfig) (string, error) {
+	if path := configProfilePath(os.Args[1:]); path != "" {
+		if err := loadConfigProfile(path); err != nil {
+			return "", err
+		}
+	}
+	help, err := conf.Parse("", cfg)
+	if err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			return help, err
+		}
+		return "", fmt.Errorf("parsing config: %w", err)
+	}
+	return "", nil
+}
+
+// Config validates or prints configuration of the server (gisquick config validate|print [--redact])
+func Config() error {
+	if len(os.Args) < 2 {
+		return errors.New("missing subcommand (validate, print)")
+	}
+	subcommand := os.Args[1]
+	os.Args = os.Args[1:]
+	redact := false
+	if subcommand == "print" {
+		args := os.Args[:1]
+		for _, arg := range os.Args[1:] {
+			if arg == "--redact" {
+				redact = true
+			} else {
+				args = append(args, arg)
+			}
+		}
+		os.Args = args
+	}
+	var cfg serveConfig
+	if help, err := parseServeConfig(&cfg); err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			fmt.Println(help)
+			return nil
+		}
+		return err
+	}
+	switch subcommand {
+	case "validate":
+		return validateConfig(cfg)
+	case "print":
+		return printConfig(os.Stdout, &cfg, redact)
+	}
+	return fmt.Errorf("unknown subcommand: %s", subcommand)
+}
+
+type configCheck struct {
+	Name  string
+	Check func() error
+}
+
+func checkURL(value string, required bool) error {
+	if value == "" {
+		if required {
+			return errors.New("missing value")
+		}
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid URL (expected absolute http or https URL): %s", value)
+	}
+	return nil
+}
+
+func checkWritableDir(dir string, required bool) error {
+	if dir == "" {
+		if required {
+			return errors.New("missing value")
+		}
+		return nil
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", dir)
+	}
+	f, err := os.CreateTemp(dir, ".gisquick-check-*")
+	if err != nil {
+		return fmt.Errorf("directory is not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func checkReadableFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Runs checks of the configuration and prints their results
+func validateConfig(cfg serveConfig) error {
+	urlCheck := func(name, value string, required bool) configCheck {
+		return configCheck{name, func() error { return checkURL(value, required) }}
+	}
+	dirCheck := func(name, value string, required bool) configCheck {
+		return configCheck{name, func() error { return checkWritableDir(value, required) }}
+	}
+	fileCheck := func(name, value string) configCheck {
+		return configCheck{name, func() error { return checkReadableFile(value) }}
+	}
+	checks := []configCheck{
+		urlCheck("web site URL", cfg.Web.SiteURL, true),
+		urlCheck("map server URL", cfg.Gisquick.MapserverURL, true),
+		urlCheck("plugins URL", cfg.Gisquick.PluginsURL, false),
+		urlCheck("datasets service URL", cfg.Datasets.ServiceURL, false),
+		urlCheck("catalog CSW URL", cfg.Catalog.CswURL, false),
+		urlCheck("OIDC issuer", cfg.Auth.OIDC.Issuer, false),
+		urlCheck("OIDC redirect URL", cfg.Auth.OIDC.RedirectURL, false),
+		urlCheck("outbound HTTP proxy", cfg.Outbound.HTTPProxy, false),
+		urlCheck("outbound HTTPS proxy", cfg.Outbound.HTTPSProxy, false),
+		dirCheck("projects directory", cfg.Gisquick.ProjectsRoot, true),
+		dirCheck("map cache directory", cfg.Gisquick.MapCacheRoot, false),
+		dirCheck("offline packages directory", cfg.Gisquick.OfflineRoot, false),
+		dirCheck("reports directory", cfg.Gisquick.ReportsRoot, false),
+		dirCheck("pg_service directory", cfg.Gisquick.PgServiceRoot, false),
+		fileCheck("access policy file", cfg.Gisquick.AccessPolicyFile),
+		fileCheck("hooks file", cfg.Gisquick.HooksFile),
+		fileCheck("breached passwords list", cfg.Passwords.BreachedList),
+		fileCheck("CA bundle", cfg.Outbound.CABundle),
+		{"trusted proxies", func() error {
+			_, err := server.ParseTrustedProxies(cfg.Web.TrustedProxies)
+			return err
+		}},
+		{"web client", func() error {
+			if !cfg.WebClient.Serve {
+				return nil
+			}
+			if cfg.WebClient.Dir != "" {
+				return checkReadableFile(filepath.Join(cfg.WebClient.Dir, "index.html"))
+			}
+			if _, ok := web.Files(); !ok {
+				return errors.New("web client is not embedded in this build")
+			}
+			return nil
+		}},
+		{"postgres", func() error {
+			db, err := server.OpenDB(server.DBConfig{
+				User:               cfg.Postgres.User,
+				Password:           cfg.Postgres.Password,
+				Host:               cfg.Postgres.Host,
+				Name:               cfg.Postgres.Name,
+				Port:               cfg.Postgres.Port,
+				MaxIdleConns:       1,
+				MaxOpenConns:       1,
+				SSLMode:            cfg.Postgres.SSLMode,
+				StatementCacheMode: cfg.Postgres.StatementCacheMode,
+			})
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", cfg.Postgres.Host, cfg.Postgres.Port, err)
+			}
+			return db.Close()
+		}},
+		{"redis", func() error {
+			rdb := redis.NewClient(&redis.Options{
+				Addr:     cfg.Redis.Addr,
+				Network:  cfg.Redis.Network,
+				Password: cfg.Redis.Password,
+				DB:       cfg.Redis.DB,
+			})
+			defer rdb.Close()
+			if err := rdb.Ping(context.Background()).Err(); err != nil {
+				return fmt.Errorf("%s: %w", cfg.Redis.Addr, err)
+			}
+			return nil
+		}},
+		{"SMTP server", func() error {
+			if cfg.Email.Host == "" {
+				return nil
+			}
+			encryptionMap := map[string]mail.Encryption{
+				"None":     mail.EncryptionNone,
+				"SSL":      mail.EncryptionSSL,
+				"TLS":      mail.EncryptionTLS,
+				"SSLTLS":   mail.EncryptionSSLTLS,
+				"STARTTLS": mail.EncryptionSTARTTLS,
+			}
+			encryption, ok := encryptionMap[cfg.Email.Encryption]
+			if !ok {
+				return fmt.Errorf("invalid encryption: %s", cfg.Email.Encryption)
+			}
+			outboundCfg := outbound.Config{CABundle: cfg.Outbound.CABundle}
+			rootCAs, err := outboundCfg.RootCAs()
+			if err != nil {
+				return err
+			}
+			es := &email.SmtpEmailService{
+				Host:       cfg.Email.Host,
+				Port:       cfg.Email.Port,
+				Encryption: encryption,
+				Username:   cfg.Email.Username,
+				Password:   cfg.Email.Password,
+				RootCAs:    rootCAs,
+			}
+			if err := es.CheckConnection(); err != nil {
+				return fmt.Errorf("%s:%d: %w", cfg.Email.Host, cfg.Email.Port, err)
+			}
+			return nil
+		}},
+	}
+	if cfg.Gisquick.AccessPolicyFile != "" {
+		checks = append(checks, configCheck{"access policy rules", func() error {
+			_, err := policy.LoadPolicy(cfg.Gisquick.AccessPolicyFile)
+			return err
+		}})
+	}
+
+	failed := 0
+	for _, c := range checks {
+		if err := c.Check(); err != nil {
+			fmt.Printf("FAIL  %s: %s\n", c.Name, err)
+			failed++
+		} else {
+			fmt.Printf("OK    %s\n", c.Name)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("configuration is not valid (%d failed checks)", failed)
+	}
+	fmt.Println("Configuration is valid")
+	return nil
+}
+
+// Splits camel case name into words in the same way as the conf package
+func splitConfigName(name string) []string {
+	class := func(r rune) int {
+		switch {
+		case unicode.IsLower(r):
+			return 1
+		case unicode.IsUpper(r):
+			return 2
+		case unicode.IsDigit(r):
+			return 3
+		}
+		return 4
+	}
+	runes := []rune(name)
+	if len(runes) < 2 {
+		return []string{name}
+	}
+	var words []string
+	lastClass := class(runes[0])
+	lastIdx := 0
+	for i, r := range runes {
+		c := class(r)
+		if c != lastClass {
+			if lastClass == 2 && c != 3 {
+				if i-lastIdx > 1 {
+					words = append(words, string(runes[lastIdx:i-1]))
+					lastIdx = i - 1
+				}
+			} else {
+				words = append(words, string(runes[lastIdx:i]))
+				lastIdx = i
+			}
+		}
+		if i == len(runes)-1 {
+			words = append(words, string(runes[lastIdx:]))
+		}
+		lastClass = c
+	}
+	return words
+}
+
+// Prints configuration values in the format of command line flags, values of the masked fields
+// (passwords, secret keys) are hidden with redact option
+func printConfig(w io.Writer, cfg interface{}, redact bool) error {
+	var walk func(prefix []string, v reflect.Value)
+	walk = func(prefix []string, v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("conf")
+			if tag == "-" || !field.IsExported() || field.Type == reflect.TypeOf(conf.Args{}) {
+				continue
+			}
+			key := append(append([]string{}, prefix...), splitConfigName(field.Name)...)
+			value := v.Field(i)
+			if value.Kind() == reflect.Struct && !reflect.PtrTo(value.Type()).Implements(reflect.TypeOf((*interface{ Set(string) error })(nil)).Elem()) {
+				walk(key, value)
+				continue
+			}
+			opts := strings.Split(tag, ",")
+			mask := false
+			for _, opt := range opts {
+				if opt == "mask" {
+					mask = true
+				} else if strings.HasPrefix(opt, "flag:") {
+					key = strings.Split(strings.TrimPrefix(opt, "flag:"), "-")
+				}
+			}
+			text := fmt.Sprintf("%v", value.Interface())
+			if mask && redact && text != "" {
+				text = "xxxxxx"
+			}
+			fmt.Fprintf(w, "--%s=%s\n", strings.ToLower(strings.Join(key, "-")), text)
+		}
+	}
+	walk(nil, reflect.ValueOf(cfg).Elem())
+	return nil
+}
@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type startupProbe struct {
+	// name and address of the dependency for diagnostics
+	Name    string
+	Address string
+	Check   func(ctx context.Context) error
+}
+
+type startupConfig struct {
+	Wait             bool
+	Timeout          time.Duration
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+}
+
+// waitForDependency runs the probe until it succeeds. Without waiting enabled only a single attempt
+// is made, otherwise attempts are repeated with exponential backoff until the timeout.
+func waitForDependency(log *zap.SugaredLogger, cfg startupConfig, probe startupProbe) error {
+	start := time.Now()
+	interval := cfg.RetryInterval
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := probe.Check(ctx)
+		cancel()
+		if err == nil {
+			if attempt > 1 {
+				log.Infow("startup", "dependency", probe.Name, "address", probe.Address, "status", "available", "attempts", attempt)
+			}
+			return nil
+		}
+		elapsed := time.Since(start)
+		if !cfg.Wait || elapsed+interval > cfg.Timeout {
+			if cfg.Wait {
+				return fmt.Errorf("%s at %s is not available after %d attempts (%s): %w", probe.Name, probe.Address, attempt, elapsed.Round(time.Second), err)
+			}
+			return fmt.Errorf("%s at %s is not available (use --wait-for-deps to wait for it): %w", probe.Name, probe.Address, err)
+		}
+		log.Warnw("startup", "dependency", probe.Name, "address", probe.Address, "status", "unavailable", "attempt", attempt, "retry_in", interval, zap.Error(err))
+		time.Sleep(interval)
+		interval *= 2
+		if interval > cfg.MaxRetryInterval {
+			interval = cfg.MaxRetryInterval
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ardanlabs/conf/v2"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"go.uber.org/zap"
+)
+
+// NormalizeFiles fixes paths of project files uploaded before paths normalization
+// (unicode NFC form, forward slashes). It should be run while the server is stopped.
+func NormalizeFiles() error {
+	cfg := struct {
+		Gisquick struct {
+			ProjectsRoot string `conf:"default:/publish"`
+		}
+	}{}
+
+	help, err := conf.Parse("", &cfg)
+	if err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			fmt.Println(help)
+			return nil
+		}
+		return fmt.Errorf("parsing config: %w", err)
+	}
+	log, err := createLogger(zap.WarnLevel)
+	if err != nil {
+		return fmt.Errorf("creating logger: %w", err)
+	}
+	storage := project.NewDiskStorage(log, cfg.Gisquick.ProjectsRoot)
+	defer storage.Close()
+
+	projects, err := storage.AllProjects(true)
+	if err != nil {
+		return err
+	}
+	total := 0
+	for _, name := range projects {
+		count, err := storage.NormalizeFilesPaths(name)
+		if err != nil {
+			return fmt.Errorf("normalizing files of project %s: %w", name, err)
+		}
+		if count > 0 {
+			fmt.Printf("%s: %d\n", name, count)
+		}
+		total += count
+	}
+	fmt.Printf("Fixed files entries: %d\n", total)
+	return nil
+}
@@ -0,0 +1,346 @@
+package commands
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/conf/v2"
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/email"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/postgres"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/security"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/jmoiron/sqlx"
+	mail "github.com/xhit/go-simple-mail/v2"
+	"go.uber.org/zap"
+)
+
+// Record of the imported/exported user account. In CSV format, the first row contains column
+// names (username, email, first_name, last_name, password, role, active).
+type UserRecord struct {
+	Username  string     `json:"username"`
+	Email     string     `json:"email"`
+	FirstName string     `json:"first_name"`
+	LastName  string     `json:"last_name"`
+	Password  string     `json:"password,omitempty"`
+	Role      string     `json:"role"` // user or superuser
+	Active    *bool      `json:"active,omitempty"`
+	Created   *time.Time `json:"created_at,omitempty"`
+	LastLogin *time.Time `json:"last_login_at,omitempty"`
+}
+
+var userRecordColumns = []string{"username", "email", "first_name", "last_name", "password", "role", "active"}
+
+func isCSVFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".csv")
+}
+
+func readUserRecords(path string) ([]UserRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []UserRecord
+	if !isCSVFile(path) {
+		if err := json.NewDecoder(f).Decode(&records); err != nil {
+			return nil, fmt.Errorf("parsing input file: %w", err)
+		}
+		return records, nil
+	}
+	reader := csv.NewReader(f)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["username"]; !ok {
+		return nil, errors.New("missing username column")
+	}
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading CSV file: %w", err)
+		}
+		value := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		r := UserRecord{
+			Username:  value("username"),
+			Email:     value("email"),
+			FirstName: value("first_name"),
+			LastName:  value("last_name"),
+			Password:  value("password"),
+			Role:      value("role"),
+		}
+		if v := value("active"); v != "" {
+			active, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid active value on line %d: %s", line, v)
+			}
+			r.Active = &active
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// Validates the record (with the same username and password policies as the web registration)
+// and creates account (not saved)
+func importAccount(r UserRecord, invite bool, names server.NamesConfig, passwords server.PasswordPolicy) (domain.Account, error) {
+	var account domain.Account
+	if r.Role != "" && r.Role != "user" && r.Role != "superuser" {
+		return account, fmt.Errorf("invalid role: %s", r.Role)
+	}
+	username, err := names.NormalizeUsername(r.Username)
+	if err != nil {
+		return account, err
+	}
+	if r.Password == "" {
+		if !invite {
+			return account, errors.New("missing password")
+		}
+		if r.Email == "" {
+			return account, errors.New("missing email for invitation")
+		}
+	} else if err := passwords.Validate(r.Password); err != nil {
+		return account, err
+	}
+	account, err = domain.NewAccount(username, r.Email, r.FirstName, r.LastName, r.Password)
+	if err != nil {
+		return account, err
+	}
+	account.Superuser = r.Role == "superuser"
+	// invited users activate account by setting the password
+	account.Active = r.Password != ""
+	if r.Active != nil && r.Password != "" {
+		account.Active = *r.Active
+	}
+	return account, nil
+}
+
+func ImportUsers() error {
+	cfg := struct {
+		DryRun   bool `conf:"help:Only validate the input file"`
+		Invite   bool `conf:"help:Send invitation emails to users without password"`
+		Postgres struct {
+			User               string `conf:"default:postgres"`
+			Password           string `conf:"default:postgres,mask"`
+			Host               string `conf:"default:postgres"`
+			Name               string `conf:"default:postgres,env:POSTGRES_DB"`
+			Port               int    `conf:"default:5432"`
+			SSLMode            string `conf:"default:prefer"`
+			StatementCacheMode string `conf:"default:prepare"`
+		}
+		Auth struct {
+			EmailTokenExpiration time.Duration `conf:"default:72h"`
+			SecretKey            string        `conf:"default:secret-key,mask"`
+		}
+		Web struct {
+			SiteURL string `conf:"default:http://localhost"`
+		}
+		Names     namesConfig
+		Passwords passwordsConfig
+
+		Email struct {
+			Host              string
+			Port              int    `conf:"default:465"`
+			Encryption        string `conf:"default:SSL,help: Options [None|SSL|TLS|SSLTLS|STARTTLS]"`
+			Username          string
+			Password          string `conf:"mask"`
+			Sender            string
+			ActivationSubject string `conf:"default:Gisquick Registration"`
+		}
+		Args conf.Args
+	}{}
+	help, err := conf.Parse("", &cfg)
+	if err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			fmt.Println(help)
+			return nil
+		}
+		return fmt.Errorf("parsing config: %w", err)
+	}
+	path := cfg.Args.Num(0)
+	if path == "" {
+		return fmt.Errorf("missing file argument")
+	}
+	records, err := readUserRecords(path)
+	if err != nil {
+		return err
+	}
+	names, err := cfg.Names.build()
+	if err != nil {
+		return err
+	}
+	passwords, err := cfg.Passwords.build()
+	if err != nil {
+		return err
+	}
+	if cfg.Invite && cfg.Email.Host == "" && !cfg.DryRun {
+		return fmt.Errorf("email service is not configured (EMAIL_HOST)")
+	}
+
+	dbConn, err := server.OpenDB(server.DBConfig{
+		User:               cfg.Postgres.User,
+		Password:           cfg.Postgres.Password,
+		Host:               cfg.Postgres.Host,
+		Port:               cfg.Postgres.Port,
+		Name:               cfg.Postgres.Name,
+		MaxIdleConns:       1,
+		MaxOpenConns:       1,
+		SSLMode:            cfg.Postgres.SSLMode,
+		StatementCacheMode: cfg.Postgres.StatementCacheMode,
+	})
+	if err != nil {
+		return fmt.Errorf("connecting to db: %w", err)
+	}
+	defer dbConn.Close()
+	accountsRepo := postgres.NewAccountsRepository(dbConn)
+
+	var accountsService *application.AccountsService
+	if cfg.Invite {
+		encryptionMap := map[string]mail.Encryption{
+			"None":     mail.EncryptionNone,
+			"SSL":      mail.EncryptionSSL,
+			"TLS":      mail.EncryptionTLS,
+			"SSLTLS":   mail.EncryptionSSLTLS,
+			"STARTTLS": mail.EncryptionSTARTTLS,
+		}
+		es := &email.SmtpEmailService{
+			Host:       cfg.Email.Host,
+			Port:       cfg.Email.Port,
+			Encryption: encryptionMap[cfg.Email.Encryption],
+			Username:   cfg.Email.Username,
+			Password:   cfg.Email.Password,
+		}
+		tokenGenerator := security.NewTokenGenerator(cfg.Auth.SecretKey, "signup", cfg.Auth.EmailTokenExpiration)
+		emailSender := email.NewAccountsEmailSender(es, cfg.Email.Sender, cfg.Web.SiteURL, cfg.Email.ActivationSubject, "")
+		accountsService = application.NewAccountsService(emailSender, accountsRepo, tokenGenerator, application.NewEventBus(zap.NewNop().Sugar()))
+	}
+
+	// validation of all records before any account is created
+	accounts := make([]domain.Account, 0, len(records))
+	usernames := make(map[string]bool, len(records))
+	emails := make(map[string]bool, len(records))
+	invalid := 0
+	for i, r := range records {
+		account, err := importAccount(r, cfg.Invite, names, passwords)
+		if err == nil && usernames[account.Username] {
+			err = errors.New("duplicate username")
+		}
+		if err == nil && account.Email != "" && emails[account.Email] {
+			err = errors.New("duplicate email")
+		}
+		if err == nil {
+			var exists bool
+			if exists, err = accountsRepo.UsernameExists(account.Username); err == nil && exists {
+				err = errors.New("username already exists")
+			}
+		}
+		if err == nil && account.Email != "" {
+			var exists bool
+			if exists, err = accountsRepo.EmailExists(account.Email); err == nil && exists {
+				err = errors.New("email already exists")
+			}
+		}
+		if err != nil {
+			fmt.Printf("record %d (%s): %s\n", i+1, r.Username, err)
+			invalid++
+			continue
+		}
+		usernames[account.Username] = true
+		emails[account.Email] = true
+		accounts = append(accounts, account)
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d records are invalid, no account was created", invalid, len(records))
+	}
+	if cfg.DryRun {
+		fmt.Printf("%d records are valid\n", len(accounts))
+		return nil
+	}
+	created := 0
+	for _, account := range accounts {
+		if err := accountsRepo.Create(account); err != nil {
+			fmt.Printf("failed to create account: %s (%s)\n", account.Username, err)
+			continue
+		}
+		created++
+		if !account.Active && accountsService != nil {
+			if err := accountsService.SendActivationEmail(account, nil); err != nil {
+				fmt.Printf("failed to send invitation email: %s (%s)\n", account.Username, err)
+			}
+		}
+	}
+	fmt.Printf("created %d of %d accounts\n", created, len(accounts))
+	return nil
+}
+
+// ExportUsers writes user accounts (without passwords) in CSV or JSON format (by extension of the output file)
+func ExportUsers() error {
+	return runUserCommand(func(dbConn *sqlx.DB, args conf.Args) error {
+		var out io.Writer = os.Stdout
+		path := args.Num(0)
+		if path != "" {
+			f, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		accounts, err := postgres.NewAccountsRepository(dbConn).GetAllAccounts()
+		if err != nil {
+			return fmt.Errorf("querying users: %w", err)
+		}
+		records := make([]UserRecord, len(accounts))
+		for i, a := range accounts {
+			active := a.Active
+			records[i] = UserRecord{
+				Username:  a.Username,
+				Email:     a.Email,
+				FirstName: a.FirstName,
+				LastName:  a.LastName,
+				Role:      "user",
+				Active:    &active,
+				Created:   utcTime(a.Created),
+				LastLogin: utcTime(a.LastLogin),
+			}
+			if a.Superuser {
+				records[i].Role = "superuser"
+			}
+		}
+		if !isCSVFile(path) {
+			encoder := json.NewEncoder(out)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(records)
+		}
+		w := csv.NewWriter(out)
+		w.Write(userRecordColumns)
+		for _, r := range records {
+			w.Write([]string{r.Username, r.Email, r.FirstName, r.LastName, "", r.Role, strconv.FormatBool(*r.Active)})
+		}
+		w.Flush()
+		return w.Error()
+	})
+}
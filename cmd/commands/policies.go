@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/server"
+)
+
+// Configuration of the usernames and project names policy (shared by the commands creating accounts)
+type namesConfig struct {
+	Reserved             string `conf:"help:Reserved usernames and project names separated by comma (default list when empty)"`
+	UsernameMinLength    int    `conf:"default:3"`
+	UsernameMaxLength    int    `conf:"default:40"`
+	UsernamePattern      string `conf:"help:Regular expression for allowed usernames (default pattern when empty)"`
+	LowercaseUsernames   bool   `conf:"default:false,help:Convert new usernames to lower case"`
+	ProjectNameMaxLength int    `conf:"default:100"`
+	ProjectNamePattern   string `conf:"help:Regular expression for allowed project names (default pattern when empty)"`
+}
+
+func (c namesConfig) build() (server.NamesConfig, error) {
+	reservedNames := server.DefaultReservedNames
+	if c.Reserved != "" {
+		reservedNames = nil
+		for _, name := range strings.Split(c.Reserved, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				reservedNames = append(reservedNames, name)
+			}
+		}
+	}
+	usernamePattern := c.UsernamePattern
+	if usernamePattern == "" {
+		usernamePattern = server.DefaultUsernamePattern
+	}
+	usernameRegex, err := regexp.Compile(usernamePattern)
+	if err != nil {
+		return server.NamesConfig{}, fmt.Errorf("invalid username pattern: %w", err)
+	}
+	projectNamePattern := c.ProjectNamePattern
+	if projectNamePattern == "" {
+		projectNamePattern = server.DefaultProjectNamePattern
+	}
+	projectNameRegex, err := regexp.Compile(projectNamePattern)
+	if err != nil {
+		return server.NamesConfig{}, fmt.Errorf("invalid project name pattern: %w", err)
+	}
+	return server.NamesConfig{
+		Reserved:             reservedNames,
+		UsernameMinLength:    c.UsernameMinLength,
+		UsernameMaxLength:    c.UsernameMaxLength,
+		UsernamePattern:      usernameRegex,
+		LowercaseUsernames:   c.LowercaseUsernames,
+		ProjectNameMaxLength: c.ProjectNameMaxLength,
+		ProjectNamePattern:   projectNameRegex,
+	}, nil
+}
+
+// Configuration of the password policy (shared by the commands creating accounts)
+type passwordsConfig struct {
+	MinLength     int    `conf:"default:8"`
+	RequireLower  bool   `conf:"default:false"`
+	RequireUpper  bool   `conf:"default:false"`
+	RequireDigit  bool   `conf:"default:false"`
+	RequireSymbol bool   `conf:"default:false"`
+	BreachedList  string `conf:"help:File with breached or common passwords rejected as new passwords (one per line)"`
+}
+
+func (c passwordsConfig) build() (server.PasswordPolicy, error) {
+	policy := server.PasswordPolicy{
+		MinLength:     c.MinLength,
+		RequireLower:  c.RequireLower,
+		RequireUpper:  c.RequireUpper,
+		RequireDigit:  c.RequireDigit,
+		RequireSymbol: c.RequireSymbol,
+	}
+	if c.BreachedList != "" {
+		breached, err := server.LoadBreachedPasswords(c.BreachedList)
+		if err != nil {
+			return policy, fmt.Errorf("loading breached passwords: %w", err)
+		}
+		policy.Breached = breached
+		policy.CheckBreached = true
+	}
+	return policy, nil
+}
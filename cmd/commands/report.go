@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ardanlabs/conf/v2"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/postgres"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// Report writes aggregated usage of the instance (per-user storage, requests counts, active projects)
+// in the given month in CSV or JSON format (by extension of the output file or format option)
+func Report() error {
+	cfg := struct {
+		Month    string `conf:"help:Reported month in YYYY-MM format (current month when empty)"`
+		Format   string `conf:"help:Output format [csv|json] (by extension of the output file when empty)"`
+		Postgres struct {
+			User               string `conf:"default:postgres"`
+			Password           string `conf:"default:postgres,mask"`
+			Host               string `conf:"default:postgres"`
+			Name               string `conf:"default:postgres,env:POSTGRES_DB"`
+			Port               int    `conf:"default:5432"`
+			SSLMode            string `conf:"default:prefer"`
+			StatementCacheMode string `conf:"default:prepare"`
+		}
+		Redis struct {
+			Addr     string `conf:"default:redis:6379"`
+			Network  string
+			Password string `conf:"mask"`
+			DB       int    `conf:"default:0"`
+		}
+		Gisquick struct {
+			ProjectsRoot string `conf:"default:/publish"`
+		}
+		Args conf.Args
+	}{}
+	help, err := conf.Parse("", &cfg)
+	if err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			fmt.Println(help)
+			return nil
+		}
+		return fmt.Errorf("parsing config: %w", err)
+	}
+	month, err := server.ParseReportMonth(cfg.Month)
+	if err != nil {
+		return err
+	}
+	path := cfg.Args.Num(0)
+	format := cfg.Format
+	if format == "" {
+		format = "json"
+		if isCSVFile(path) {
+			format = "csv"
+		}
+	}
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("invalid format: %s", format)
+	}
+	log, err := createLogger(zap.WarnLevel)
+	if err != nil {
+		return fmt.Errorf("creating logger: %w", err)
+	}
+
+	dbConn, err := server.OpenDB(server.DBConfig{
+		User:               cfg.Postgres.User,
+		Password:           cfg.Postgres.Password,
+		Host:               cfg.Postgres.Host,
+		Port:               cfg.Postgres.Port,
+		Name:               cfg.Postgres.Name,
+		MaxIdleConns:       1,
+		MaxOpenConns:       1,
+		SSLMode:            cfg.Postgres.SSLMode,
+		StatementCacheMode: cfg.Postgres.StatementCacheMode,
+	})
+	if err != nil {
+		return fmt.Errorf("connecting to db: %w", err)
+	}
+	defer dbConn.Close()
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Network:  cfg.Redis.Network,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	defer rdb.Close()
+
+	storage := project.NewDiskStorage(log, cfg.Gisquick.ProjectsRoot)
+	defer storage.Close()
+	userProjects := func(username string) ([]domain.ProjectInfo, error) {
+		names, err := storage.UserProjects(username)
+		if err != nil {
+			return nil, err
+		}
+		projects := make([]domain.ProjectInfo, 0, len(names))
+		for _, name := range names {
+			info, err := storage.GetProjectInfo(name)
+			if err != nil {
+				log.Warnw("reading project info", "project", name, zap.Error(err))
+				continue
+			}
+			projects = append(projects, info)
+		}
+		return projects, nil
+	}
+
+	accounts, err := postgres.NewAccountsRepository(dbConn).GetAllAccounts()
+	if err != nil {
+		return fmt.Errorf("querying users: %w", err)
+	}
+	stats := project.NewRedisRequestsStats(log, rdb)
+	report, err := server.BuildUsageReport(context.Background(), month, accounts, userProjects, stats)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if format == "csv" {
+		return report.WriteCSV(out)
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
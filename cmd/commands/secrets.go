@@ -0,0 +1,82 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ardanlabs/conf/v2"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/postgres"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/security"
+	"github.com/gisquick/gisquick-server/internal/server"
+)
+
+// Default value of AUTH_SECRET_KEY, publicly known, so it can't protect stored secrets
+const defaultSecretKey = "secret-key"
+
+// Returns provider of master keys for secrets encryption. When no keys are configured,
+// the key derived from the application secret key is used.
+func secretsKeyProvider(keys, secretKey string) (*security.StaticKeyProvider, error) {
+	if keys == "" {
+		if secretKey == "" || secretKey == defaultSecretKey {
+			return nil, errors.New("secrets encryption key is not configured (set AUTH_SECRETS_KEYS or AUTH_SECRET_KEY)")
+		}
+		return security.NewStaticKeyProvider("default", map[string]string{"default": secretKey})
+	}
+	return security.ParseKeys(keys)
+}
+
+// RotateKeys re-encrypts all stored secrets with the current master key (the first one
+// from AUTH_SECRETS_KEYS list)
+func RotateKeys() error {
+	cfg := struct {
+		Auth struct {
+			SecretKey   string `conf:"default:secret-key,mask"`
+			SecretsKeys string `conf:"mask"`
+		}
+		Postgres struct {
+			User               string `conf:"default:postgres"`
+			Password           string `conf:"default:postgres,mask"`
+			Host               string `conf:"default:postgres"`
+			Name               string `conf:"default:postgres,env:POSTGRES_DB"`
+			Port               int    `conf:"default:5432"`
+			SSLMode            string `conf:"default:prefer"`
+			StatementCacheMode string `conf:"default:prepare"`
+		}
+	}{}
+
+	help, err := conf.Parse("", &cfg)
+	if err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			fmt.Println(help)
+			return nil
+		}
+		return fmt.Errorf("parsing config: %w", err)
+	}
+	keys, err := secretsKeyProvider(cfg.Auth.SecretsKeys, cfg.Auth.SecretKey)
+	if err != nil {
+		return fmt.Errorf("loading secrets keys: %w", err)
+	}
+	dbConn, err := server.OpenDB(server.DBConfig{
+		User:               cfg.Postgres.User,
+		Password:           cfg.Postgres.Password,
+		Host:               cfg.Postgres.Host,
+		Port:               cfg.Postgres.Port,
+		Name:               cfg.Postgres.Name,
+		MaxIdleConns:       1,
+		MaxOpenConns:       1,
+		SSLMode:            cfg.Postgres.SSLMode,
+		StatementCacheMode: cfg.Postgres.StatementCacheMode,
+	})
+	if err != nil {
+		return fmt.Errorf("connecting to db: %w", err)
+	}
+	defer dbConn.Close()
+
+	secretsRepo := postgres.NewProjectSecretsRepository(dbConn, security.NewCipher(keys))
+	count, err := secretsRepo.RotateKeys()
+	fmt.Printf("Re-encrypted project secrets: %d\n", count)
+	if err != nil {
+		return fmt.Errorf("rotating project secrets keys: %w", err)
+	}
+	return nil
+}
@@ -5,8 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
@@ -15,14 +18,19 @@ import (
 	"github.com/ardanlabs/conf/v2"
 	"github.com/gisquick/gisquick-server/internal/application"
 	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/csw"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/email"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/outbound"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/policy"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/postgres"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/security"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/ws"
 	"github.com/gisquick/gisquick-server/internal/server"
 	"github.com/gisquick/gisquick-server/internal/server/auth"
+	"github.com/gisquick/gisquick-server/web"
 	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
 	mail "github.com/xhit/go-simple-mail/v2"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -31,12 +39,14 @@ import (
 func parseByteSize(value string) (int64, error) {
 	value = strings.TrimSpace(value)
 	factor := 1
-	if strings.HasSuffix(value, "M") {
+	if strings.HasSuffix(value, "K") {
+		factor = 1024
+	} else if strings.HasSuffix(value, "M") {
 		factor = 1024 * 1024
 	} else if strings.HasSuffix(value, "G") {
 		factor = 1024 * 1024 * 1024
 	}
-	num, err := strconv.Atoi(strings.TrimRight(value, "MGB"))
+	num, err := strconv.Atoi(strings.TrimRight(value, "KMGB"))
 	if err != nil {
 		return -1, fmt.Errorf("Invalid byte size: %s", value)
 	}
@@ -60,75 +70,217 @@ func (b *ByteSize) UnmarshalText(text []byte) error {
 	return b.Set(string(text))
 }
 
-func Serve() error {
-	cfg := struct {
-		Gisquick struct {
-			Debug                bool   `conf:"default:false"`
-			Language             string `conf:"default:en-us"`
-			ProjectsRoot         string `conf:"default:/publish"`
-			MapCacheRoot         string
-			MapserverURL         string
-			PluginsURL           string
-			SignupAPI            bool
-			ProjectSizeLimit     ByteSize `conf:"default:-1"`
-			AccountStorageLimit  ByteSize `conf:"default:-1"`
-			AccountProjectsLimit int      `conf:"default:-1"`
-			AccountLimiterConfig string
-			LandingProject       string
-			ProjectCustomization bool
-			Extensions           string
-		}
-		Auth struct {
-			SessionExpiration    time.Duration `conf:"default:24h"`
-			EmailTokenExpiration time.Duration `conf:"default:72h"`
-			SecretKey            string        `conf:"default:secret-key,mask"`
-		}
-		Web struct {
-			ReadTimeout     time.Duration `conf:"default:5s"`
-			WriteTimeout    time.Duration `conf:"default:10s"`
-			IdleTimeout     time.Duration `conf:"default:120s"`
-			ShutdownTimeout time.Duration `conf:"default:20s"`
-			SiteURL         string        `conf:"default:http://localhost"`
-			APIHost         string        `conf:"default:0.0.0.0:3000"`
-		}
-		Postgres struct {
-			User               string `conf:"default:postgres"`
-			Password           string `conf:"default:postgres,mask"`
-			Host               string `conf:"default:postgres"`
-			Name               string `conf:"default:postgres,env:POSTGRES_DB"`
-			Port               int    `conf:"default:5432"`
-			MaxIdleConns       int    `conf:"default:3"`
-			MaxOpenConns       int    `conf:"default:3"`
-			SSLMode            string `conf:"default:disable"`
-			StatementCacheMode string `conf:"default:prepare"`
-		}
-		Redis struct {
-			Addr     string `conf:"default:redis:6379"` // "/var/run/redis/redis.sock"
-			Network  string // "unix"
-			Password string `conf:"mask"`
-			DB       int    `conf:"default:0"`
+// Configuration of the server (from command line flags and environment variables)
+type serveConfig struct {
+	// env file with configuration profile (loaded before parsing, see parseServeConfig)
+	ConfigProfile string `conf:"help:Env file with configuration profile (e.g. /etc/gisquick/production.env), environment variables take precedence"`
+
+	WaitForDeps bool `conf:"default:false,help:Wait for Postgres and Redis to become available at startup"`
+	Startup     struct {
+		Timeout          time.Duration `conf:"default:60s,help:Maximal time of waiting for dependencies (with --wait-for-deps)"`
+		RetryInterval    time.Duration `conf:"default:1s"`
+		MaxRetryInterval time.Duration `conf:"default:10s"`
+	}
+	Gisquick struct {
+		Debug                  bool   `conf:"default:false"`
+		Language               string `conf:"default:en-us"`
+		ProjectsRoot           string `conf:"default:/publish"`
+		MapCacheRoot           string
+		MapserverURL           string
+		MapserverSocket        string `conf:"help:Unix socket of the map server (HTTP requests are still built from MapserverURL)"`
+		MapserverSigningKey    string `conf:"mask,help:Shared key for signing of the map server requests (verified by the map server plugin)"`
+		MapserverProjectsRoot  string `conf:"default:/publish"`
+		PgServiceRoot          string `conf:"help:Directory for generated pg_service.conf files of projects (requires the map server plugin which applies X-Pg-Service-File header as PGSERVICEFILE)"`
+		MapserverPgServiceRoot string `conf:"help:Directory of pg_service.conf files inside the map server (container)"`
+		PluginsURL             string
+		SignupAPI              bool
+		UserDirectory          bool     `conf:"default:true,help:Allow users to list other users (usernames and full names)"`
+		ProjectSizeLimit       ByteSize `conf:"default:-1"`
+		AccountStorageLimit    ByteSize `conf:"default:-1"`
+		AccountLibraryLimit    ByteSize `conf:"default:-1"`
+		AccountProjectsLimit   int      `conf:"default:-1"`
+		AccountLimiterConfig   string
+		LandingProject         string
+		ProjectCustomization   bool
+		Extensions             string        `conf:"help:Comma separated list of enabled server extensions (registered in custom builds)"`
+		ProjectLogsSize        int           `conf:"default:500"`
+		WarmUpProjects         int           `conf:"default:0,help:Number of the most used projects to pre-load into map server on startup"`
+		FormsQueueInterval     time.Duration `conf:"default:30s"`
+		AccessGrantsInterval   time.Duration `conf:"default:1m,help:Interval of checking expired temporary access grants"`
+		OfflineRoot            string
+		OfflineJobTimeout      time.Duration `conf:"default:1h"`
+		DataChangesChannels    string        `conf:"help:LISTEN channels for external data changes in format channel=user/project|user/project2 separated by comma"`
+		DataChangesDSN         string        `conf:"mask,help:Connection string of the database with data (defaults to Postgres settings)"`
+		AccessPolicyFile       string        `conf:"help:JSON file with access policy rules"`
+		HooksFile              string        `conf:"help:Starlark script with request hooks (pre_ows and post_auth functions)"`
+		HooksMaxSteps          uint64        `conf:"default:100000,help:Max number of execution steps of a single request hook"`
+		HooksTimeout           time.Duration `conf:"default:100ms,help:Max execution time of a single request hook"`
+		ReportsRoot            string
+		ProjectLockTimeout     time.Duration `conf:"default:10s,help:Max time to wait for the lock of the project modified by another request"`
+	}
+	Cog struct {
+		Converter string   `conf:"help:COG converter command with {input} and {output} placeholders (e.g. gdal_translate -of COG -co OVERVIEWS=AUTO {input} {output})"`
+		MinSize   ByteSize `conf:"default:50M,help:Minimal size of GeoTIFF files offered for conversion"`
+	}
+	Datasets struct {
+		Extractor  string `conf:"default:gdal,help:Metadata extractor of uploaded datasets (gdal, service, native or none)"`
+		ServiceURL string `conf:"help:URL of the metadata extraction service (used with service extractor)"`
+	}
+	Digest struct {
+		Enabled bool   `conf:"default:true,help:Weekly digest emails for users who enabled them"`
+		Weekday string `conf:"default:monday"`
+		Hour    int    `conf:"default:7"`
+	}
+	Catalog struct {
+		CswURL   string `conf:"help:CSW-T endpoint for publishing of projects metadata (e.g. GeoNetwork or pycsw)"`
+		Username string
+		Password string `conf:"mask"`
+	}
+	MapCache struct {
+		MaxSize        ByteSize      `conf:"default:0,help:Size limit of the map tiles cache (0 means unlimited)"`
+		ProjectMaxSize ByteSize      `conf:"default:0,help:Size limit of the map tiles cache per project (0 means unlimited)"`
+		SweepInterval  time.Duration `conf:"default:10m"`
+	}
+	AssetsCache struct {
+		Size        ByteSize `conf:"default:0,help:Size of in-memory cache of small files (thumbnails and app components)"`
+		MaxItemSize ByteSize `conf:"default:512K"`
+	}
+	Limits struct {
+		JSONBodySize   ByteSize      `conf:"default:1M,help:Maximal size of request body of API endpoints (0 means unlimited)"`
+		JSONTimeout    time.Duration `conf:"default:0s,help:Timeout of API requests (0 means no timeout)"`
+		UploadBodySize ByteSize      `conf:"default:0,help:Maximal size of uploads (project size limits are applied as well)"`
+		UploadTimeout  time.Duration `conf:"default:0s"`
+		OWSBodySize    ByteSize      `conf:"default:20M,help:Maximal size of OWS request body (e.g. WFS-T transactions)"`
+		OWSTimeout     time.Duration `conf:"default:0s"`
+		MediaBodySize  ByteSize      `conf:"default:50M,help:Maximal size of uploaded media files and form submissions"`
+		MediaTimeout   time.Duration `conf:"default:0s"`
+	}
+	Proxy struct {
+		FlushInterval        time.Duration `conf:"default:100ms,help:Flush interval of streamed map server responses (-1ns flushes immediately)"`
+		AnonymousMaxResponse ByteSize      `conf:"default:0,help:Maximal size of map server responses for anonymous users (0 means unlimited)"`
+		AllowedHeaders       string        `conf:"help:Client headers forwarded by the proxies separated by comma, prefixes end with * (default list when empty)"`
+	}
+	Names     namesConfig
+	Passwords passwordsConfig
+
+	Zip struct {
+		CompressionLevel int    `conf:"default:-1,help:Deflate compression level (-1 default; 0 store only; 1-9)"`
+		StoreExtensions  string `conf:"help:Extensions of already compressed files stored without compression (default list when empty)"`
+	}
+	Bandwidth struct {
+		ConnectionUpload   ByteSize `conf:"default:0,help:Upload limit per connection (bytes per second)"`
+		ConnectionDownload ByteSize `conf:"default:0,help:Download limit per connection (bytes per second)"`
+		UserUpload         ByteSize `conf:"default:0,help:Upload limit per user (bytes per second)"`
+		UserDownload       ByteSize `conf:"default:0,help:Download limit per user (bytes per second)"`
+	}
+	Robots struct {
+		BotUserAgents      string        `conf:"help:Regular expression of bot user agents blocked on OWS endpoints (default pattern when empty)"`
+		MapTokenExpiration time.Duration `conf:"default:12h,help:Validity of map tokens issued to the map viewer"`
+	}
+	Scim struct {
+		Token             string `conf:"mask,help:Bearer token of the SCIM provisioning endpoint /scim/v2 (empty value disables it)"`
+		UnpublishProjects bool   `conf:"default:false,help:Unpublish projects of users deactivated by SCIM"`
+	}
+	Anonymous struct {
+		GlobalRate  float64 `conf:"default:0,help:Map requests limit of all anonymous users (requests per second)"`
+		GlobalBurst int     `conf:"default:100"`
+		IPRate      float64 `conf:"default:0,help:Map requests limit of anonymous users per IP address (requests per second)"`
+		IPBurst     int     `conf:"default:20"`
+	}
+	Auth struct {
+		SessionExpiration    time.Duration `conf:"default:24h"`
+		SessionIdleTimeout   time.Duration `conf:"default:0,help:Sessions not used for this time are invalidated (0 disables the idle timeout)"`
+		EmailTokenExpiration time.Duration `conf:"default:72h"`
+		DeletionGracePeriod  time.Duration `conf:"default:168h,help:Delay of the account deletion requested by the user (0 deletes the account immediately)"`
+		SecretKey            string        `conf:"default:secret-key,mask"`
+		SecretsKeys          string        `conf:"mask"`
+		LoginRateLimit       struct {
+			IPAttempts       int           `conf:"default:20,help:Failed login attempts from single IP address before the login is locked (0 disables the limit)"`
+			UsernameAttempts int           `conf:"default:10,help:Failed login attempts for single account from any IP address before the login is locked (0 disables the limit)"`
+			Window           time.Duration `conf:"default:15m,help:Period in which failed login attempts are counted"`
+			Lockout          time.Duration `conf:"default:15m,help:Duration of the login lock"`
 		}
-		Email struct {
-			Host                 string
-			Port                 int    `conf:"default:465"`
-			Encryption           string `conf:"default:SSL,help: Options [None|SSL|TLS|SSLTLS|STARTTLS]"`
-			Username             string
-			Password             string `conf:"mask"`
-			Sender               string
-			ActivationSubject    string `conf:"default:Gisquick Registration"`
-			PasswordResetSubject string `conf:"default:Gisquick Password Reset"`
+		OIDC struct {
+			Issuer        string `conf:"help:OpenID Connect issuer URL (e.g. https://keycloak.example.com/realms/gisquick), empty value disables OIDC login"`
+			ClientID      string
+			ClientSecret  string `conf:"mask"`
+			RedirectURL   string `conf:"help:Callback URL registered in the identity provider (default: SITE_URL/api/auth/oidc/callback)"`
+			Scopes        string `conf:"default:openid profile email,help:Space separated list of requested scopes"`
+			UsernameClaim string `conf:"default:preferred_username"`
+			AutoProvision bool   `conf:"default:true,help:Create accounts of users signing in for the first time"`
+			EmailDomains  string `conf:"help:Comma separated list of email domains accepted from the identity provider (only verified emails)"`
 		}
-	}{}
+	}
+	Web struct {
+		ReadTimeout        time.Duration `conf:"default:5s"`
+		WriteTimeout       time.Duration `conf:"default:10s"`
+		IdleTimeout        time.Duration `conf:"default:120s"`
+		ShutdownTimeout    time.Duration `conf:"default:20s"`
+		SiteURL            string        `conf:"default:http://localhost"`
+		APIHost            string        `conf:"default:0.0.0.0:3000"`
+		PublicOWS          bool          `conf:"default:true,help:Read-only OGC endpoint /ows/:user/:name"`
+		PublicOWSBasicAuth bool          `conf:"default:true,help:Request Basic authentication on the public OGC endpoint"`
+		MapPages           bool          `conf:"default:false,help:Server rendered pages of public maps (/maps) for link previews and search engines"`
+		TrustedProxies     string        `conf:"default:private,help:Comma separated IP addresses or networks (CIDR) of reverse proxies allowed to set X-Forwarded-For header ('private' for loopback and private networks; 'none' uses address of the connection)"`
+		Listen             string        `conf:"help:Additional listeners separated by comma (e.g. [::]:3000,unix:/run/gisquick.sock;mode=660,0.0.0.0:3443;cert=/certs/api.crt;key=/certs/api.key)"`
+	}
+	WebClient struct {
+		Serve  bool   `conf:"default:false,help:Serve web client by the server (without separate web server for static files)"`
+		Dir    string `conf:"help:Directory with built web client (files embedded in the binary are used when empty)"`
+		MaxAge int    `conf:"default:3600,help:Cache max-age (seconds) of the web client files without content hash in the name"`
+	}
+	Security struct {
+		ContentSecurityPolicy string `conf:"default:frame-ancestors 'self'"`
+		ReferrerPolicy        string `conf:"default:strict-origin-when-cross-origin"`
+		FrameOptions          string `conf:"default:SAMEORIGIN"`
+		HSTSMaxAge            int    `conf:"default:0"`
+		EmbedFrameAncestors   string `conf:"default:*"`
+	}
+	Postgres struct {
+		User               string `conf:"default:postgres"`
+		Password           string `conf:"default:postgres,mask"`
+		Host               string `conf:"default:postgres"`
+		Name               string `conf:"default:postgres,env:POSTGRES_DB"`
+		Port               int    `conf:"default:5432"`
+		MaxIdleConns       int    `conf:"default:3"`
+		MaxOpenConns       int    `conf:"default:3"`
+		SSLMode            string `conf:"default:disable"`
+		StatementCacheMode string `conf:"default:prepare"`
+	}
+	Redis struct {
+		Addr     string `conf:"default:redis:6379"` // "/var/run/redis/redis.sock"
+		Network  string // "unix"
+		Password string `conf:"mask"`
+		DB       int    `conf:"default:0"`
+		// logged users can continue to work when redis is temporarily unavailable
+		SessionFallback time.Duration `conf:"default:10m,help:How long recently used sessions are accepted from memory when redis is unavailable (0 disables the fallback)"`
+	}
+	Outbound struct {
+		HTTPProxy  string `conf:"help:Proxy for outgoing HTTP requests (HTTP_PROXY environment variable is used when empty)"`
+		HTTPSProxy string `conf:"help:Proxy for outgoing HTTPS requests (HTTPS_PROXY environment variable is used when empty)"`
+		NoProxy    string `conf:"help:Hosts excluded from proxying separated by comma"`
+		CABundle   string `conf:"help:PEM file with additional trusted CA certificates"`
+	}
+	Email struct {
+		Host                 string
+		Port                 int    `conf:"default:465"`
+		Encryption           string `conf:"default:SSL,help: Options [None|SSL|TLS|SSLTLS|STARTTLS]"`
+		Username             string
+		Password             string `conf:"mask"`
+		Sender               string
+		ActivationSubject    string `conf:"default:Gisquick Registration"`
+		PasswordResetSubject string `conf:"default:Gisquick Password Reset"`
+	}
+}
 
-	// const prefix = "GISQUICK"
-	const prefix = ""
-	help, err := conf.Parse(prefix, &cfg)
-	if err != nil {
+func Serve() error {
+	var cfg serveConfig
+	if help, err := parseServeConfig(&cfg); err != nil {
 		if errors.Is(err, conf.ErrHelpWanted) {
 			fmt.Println(help)
 			return nil
 		}
-		return fmt.Errorf("parsing config: %w", err)
+		return err
 	}
 	logLevel := zap.InfoLevel
 	if cfg.Gisquick.Debug {
@@ -146,17 +298,33 @@ func Serve() error {
 	// fmt.Println(out)
 	log.Infow("startup", "config", out)
 
+	startupCfg := startupConfig{
+		Wait:             cfg.WaitForDeps,
+		Timeout:          cfg.Startup.Timeout,
+		RetryInterval:    cfg.Startup.RetryInterval,
+		MaxRetryInterval: cfg.Startup.MaxRetryInterval,
+	}
+
 	// Database
-	dbConn, err := server.OpenDB(server.DBConfig{
-		User:               cfg.Postgres.User,
-		Password:           cfg.Postgres.Password,
-		Host:               cfg.Postgres.Host,
-		Name:               cfg.Postgres.Name,
-		Port:               cfg.Postgres.Port,
-		MaxIdleConns:       cfg.Postgres.MaxIdleConns,
-		MaxOpenConns:       cfg.Postgres.MaxOpenConns,
-		SSLMode:            cfg.Postgres.SSLMode,
-		StatementCacheMode: cfg.Postgres.StatementCacheMode,
+	var dbConn *sqlx.DB
+	err = waitForDependency(log, startupCfg, startupProbe{
+		Name:    "postgres",
+		Address: fmt.Sprintf("%s:%d/%s", cfg.Postgres.Host, cfg.Postgres.Port, cfg.Postgres.Name),
+		Check: func(ctx context.Context) error {
+			var err error
+			dbConn, err = server.OpenDB(server.DBConfig{
+				User:               cfg.Postgres.User,
+				Password:           cfg.Postgres.Password,
+				Host:               cfg.Postgres.Host,
+				Name:               cfg.Postgres.Name,
+				Port:               cfg.Postgres.Port,
+				MaxIdleConns:       cfg.Postgres.MaxIdleConns,
+				MaxOpenConns:       cfg.Postgres.MaxOpenConns,
+				SSLMode:            cfg.Postgres.SSLMode,
+				StatementCacheMode: cfg.Postgres.StatementCacheMode,
+			})
+			return err
+		},
 	})
 	if err != nil {
 		return fmt.Errorf("connecting to db: %w", err)
@@ -174,6 +342,31 @@ func Serve() error {
 		DB:       cfg.Redis.DB,
 	})
 	defer rdb.Close()
+	err = waitForDependency(log, startupCfg, startupProbe{
+		Name:    "redis",
+		Address: cfg.Redis.Addr,
+		Check: func(ctx context.Context) error {
+			return rdb.Ping(ctx).Err()
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("connecting to redis: %w", err)
+	}
+
+	outboundCfg := outbound.Config{
+		HTTPProxy:  cfg.Outbound.HTTPProxy,
+		HTTPSProxy: cfg.Outbound.HTTPSProxy,
+		NoProxy:    cfg.Outbound.NoProxy,
+		CABundle:   cfg.Outbound.CABundle,
+	}
+	outboundTransport, err := outboundCfg.Transport()
+	if err != nil {
+		return fmt.Errorf("configuring outbound connections: %w", err)
+	}
+	rootCAs, err := outboundCfg.RootCAs()
+	if err != nil {
+		return fmt.Errorf("configuring outbound connections: %w", err)
+	}
 
 	var es email.EmailService
 	encryptionMap := map[string]mail.Encryption{
@@ -194,27 +387,235 @@ func Serve() error {
 			Encryption: encryption,
 			Username:   cfg.Email.Username,
 			Password:   cfg.Email.Password,
+			RootCAs:    rootCAs,
 		}
 	}
 
 	notifications := project.NewRedisNotificationStore(log, rdb)
+	projectLogs := project.NewRedisProjectLogs(log, rdb, cfg.Gisquick.ProjectLogsSize)
+	usage := project.NewRedisProjectsUsage(log, rdb)
+	formsQueue := project.NewRedisFormsQueue(log, rdb)
+	requestsStats := project.NewRedisRequestsStats(log, rdb)
+	catalogStatus := project.NewRedisCatalogStatus(log, rdb)
+
+	dataChannels, err := server.ParseDataChangesChannels(cfg.Gisquick.DataChangesChannels)
+	if err != nil {
+		return fmt.Errorf("parsing data changes channels: %w", err)
+	}
+
+	zipStoreExtensions := server.DefaultZipStoreExtensions
+	if cfg.Zip.StoreExtensions != "" {
+		zipStoreExtensions = nil
+		for _, ext := range strings.Split(cfg.Zip.StoreExtensions, ",") {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if ext != "" && !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			zipStoreExtensions = append(zipStoreExtensions, ext)
+		}
+	}
+	if cfg.Zip.CompressionLevel < -1 || cfg.Zip.CompressionLevel > 9 {
+		return fmt.Errorf("invalid zip compression level: %d", cfg.Zip.CompressionLevel)
+	}
+
+	datasetsExtractor := cfg.Datasets.Extractor
+	switch datasetsExtractor {
+	case "none":
+		datasetsExtractor = ""
+	case "gdal", "native":
+	case "service":
+		if cfg.Datasets.ServiceURL == "" {
+			return fmt.Errorf("missing URL of the datasets metadata service")
+		}
+	default:
+		return fmt.Errorf("invalid datasets extractor: %s", datasetsExtractor)
+	}
+
+	listeners, err := server.ParseListeners(cfg.Web.APIHost + "," + cfg.Web.Listen)
+	if err != nil {
+		return fmt.Errorf("parsing listeners: %w", err)
+	}
 
+	trustedProxies, err := server.ParseTrustedProxies(cfg.Web.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("parsing trusted proxies: %w", err)
+	}
+
+	namesConf, err := cfg.Names.build()
+	if err != nil {
+		return err
+	}
+	passwordPolicy, err := cfg.Passwords.build()
+	if err != nil {
+		return err
+	}
+	proxyHeaders := server.DefaultProxyAllowedHeaders
+	if cfg.Proxy.AllowedHeaders != "" {
+		proxyHeaders = nil
+		for _, name := range strings.Split(cfg.Proxy.AllowedHeaders, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				proxyHeaders = append(proxyHeaders, name)
+			}
+		}
+	}
+	var accessPolicy *policy.Policy
+	if cfg.Gisquick.AccessPolicyFile != "" {
+		accessPolicy, err = policy.LoadPolicy(cfg.Gisquick.AccessPolicyFile)
+		if err != nil {
+			return fmt.Errorf("loading access policy: %w", err)
+		}
+	}
+	botUserAgentsPattern := cfg.Robots.BotUserAgents
+	if botUserAgentsPattern == "" {
+		botUserAgentsPattern = server.DefaultBotUserAgents
+	}
+	botUserAgents, err := regexp.Compile(botUserAgentsPattern)
+	if err != nil {
+		return fmt.Errorf("invalid bot user agents pattern: %w", err)
+	}
+
+	var hooks *policy.Hooks
+	if cfg.Gisquick.HooksFile != "" {
+		hooks, err = policy.LoadHooks(cfg.Gisquick.HooksFile)
+		if err != nil {
+			return fmt.Errorf("loading request hooks: %w", err)
+		}
+		hooks.MaxSteps = cfg.Gisquick.HooksMaxSteps
+		hooks.Timeout = cfg.Gisquick.HooksTimeout
+		hooks.Print = func(msg string) {
+			log.Infow("request hook", "message", msg)
+		}
+	}
+
+	var catalog *csw.Client
+	if cfg.Catalog.CswURL != "" {
+		catalog = csw.NewClient(cfg.Catalog.CswURL, cfg.Catalog.Username, cfg.Catalog.Password, outboundTransport)
+	}
+
+	digestWeekday := time.Weekday(-1)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), cfg.Digest.Weekday) {
+			digestWeekday = d
+		}
+	}
+	if digestWeekday < 0 || cfg.Digest.Hour < 0 || cfg.Digest.Hour > 23 {
+		return fmt.Errorf("invalid schedule of the weekly digest: %s %d", cfg.Digest.Weekday, cfg.Digest.Hour)
+	}
 	conf := server.Config{
-		Language:             cfg.Gisquick.Language,
-		LandingProject:       cfg.Gisquick.LandingProject,
-		MapserverURL:         cfg.Gisquick.MapserverURL,
-		MapCacheRoot:         cfg.Gisquick.MapCacheRoot,
-		ProjectsRoot:         cfg.Gisquick.ProjectsRoot,
-		PluginsURL:           cfg.Gisquick.PluginsURL,
-		SignupAPI:            cfg.Gisquick.SignupAPI,
-		SiteURL:              cfg.Web.SiteURL,
-		MaxProjectSize:       int64(cfg.Gisquick.ProjectSizeLimit),
-		ProjectCustomization: cfg.Gisquick.ProjectCustomization,
+		Language:               cfg.Gisquick.Language,
+		LandingProject:         cfg.Gisquick.LandingProject,
+		MapserverURL:           cfg.Gisquick.MapserverURL,
+		MapserverSocket:        cfg.Gisquick.MapserverSocket,
+		MapserverSigningKey:    cfg.Gisquick.MapserverSigningKey,
+		MapserverProjectsRoot:  cfg.Gisquick.MapserverProjectsRoot,
+		PgServiceRoot:          cfg.Gisquick.PgServiceRoot,
+		MapserverPgServiceRoot: cfg.Gisquick.MapserverPgServiceRoot,
+		OfflineRoot:            cfg.Gisquick.OfflineRoot,
+		OfflineJobTimeout:      cfg.Gisquick.OfflineJobTimeout,
+		ReportsRoot:            cfg.Gisquick.ReportsRoot,
+		SecretKey:              cfg.Auth.SecretKey,
+		AccountDeletionGrace:   cfg.Auth.DeletionGracePeriod,
+		MapCacheRoot:           cfg.Gisquick.MapCacheRoot,
+		ProjectsRoot:           cfg.Gisquick.ProjectsRoot,
+		PluginsURL:             cfg.Gisquick.PluginsURL,
+		SignupAPI:              cfg.Gisquick.SignupAPI,
+		UserDirectory:          cfg.Gisquick.UserDirectory,
+		SiteURL:                cfg.Web.SiteURL,
+		MaxProjectSize:         int64(cfg.Gisquick.ProjectSizeLimit),
+		ProjectCustomization:   cfg.Gisquick.ProjectCustomization,
+		Security: server.SecurityConfig{
+			ContentSecurityPolicy: cfg.Security.ContentSecurityPolicy,
+			ReferrerPolicy:        cfg.Security.ReferrerPolicy,
+			FrameOptions:          cfg.Security.FrameOptions,
+			HSTSMaxAge:            cfg.Security.HSTSMaxAge,
+			EmbedFrameAncestors:   cfg.Security.EmbedFrameAncestors,
+		},
+		DataChangesChannels: dataChannels,
+		AccessPolicy:        accessPolicy,
+		Hooks:               hooks,
+		Catalog:             catalog,
+		Cog: server.CogConfig{
+			Converter: cfg.Cog.Converter,
+			MinSize:   int64(cfg.Cog.MinSize),
+		},
+		Datasets: server.DatasetsConfig{
+			Extractor:  datasetsExtractor,
+			ServiceURL: cfg.Datasets.ServiceURL,
+		},
+		Bandwidth: server.BandwidthConfig{
+			ConnectionUpload:   int64(cfg.Bandwidth.ConnectionUpload),
+			ConnectionDownload: int64(cfg.Bandwidth.ConnectionDownload),
+			UserUpload:         int64(cfg.Bandwidth.UserUpload),
+			UserDownload:       int64(cfg.Bandwidth.UserDownload),
+		},
+		Digest: server.DigestConfig{
+			Enabled: cfg.Digest.Enabled,
+			Weekday: digestWeekday,
+			Hour:    cfg.Digest.Hour,
+		},
+		PublicOWS:          cfg.Web.PublicOWS,
+		PublicOWSBasicAuth: cfg.Web.PublicOWSBasicAuth,
+		MapPages:           cfg.Web.MapPages,
+		TrustedProxies:     trustedProxies,
+		Robots: server.RobotsConfig{
+			BotUserAgents:      botUserAgents,
+			MapTokenExpiration: cfg.Robots.MapTokenExpiration,
+		},
+		Scim: server.ScimConfig{
+			Token:             cfg.Scim.Token,
+			UnpublishProjects: cfg.Scim.UnpublishProjects,
+		},
+		Anonymous: server.AnonymousLimitsConfig{
+			GlobalRate:  cfg.Anonymous.GlobalRate,
+			GlobalBurst: cfg.Anonymous.GlobalBurst,
+			IPRate:      cfg.Anonymous.IPRate,
+			IPBurst:     cfg.Anonymous.IPBurst,
+		},
+		Zip: server.ZipConfig{
+			CompressionLevel: cfg.Zip.CompressionLevel,
+			StoreExtensions:  zipStoreExtensions,
+		},
+		MapCache: server.MapCacheConfig{
+			MaxSize:        int64(cfg.MapCache.MaxSize),
+			ProjectMaxSize: int64(cfg.MapCache.ProjectMaxSize),
+		},
+		AssetsCache: server.AssetsCacheConfig{
+			Size:        int64(cfg.AssetsCache.Size),
+			MaxItemSize: int64(cfg.AssetsCache.MaxItemSize),
+		},
+		Limits: server.RequestLimitsConfig{
+			JSON:   server.RequestLimit{BodySize: int64(cfg.Limits.JSONBodySize), Timeout: cfg.Limits.JSONTimeout},
+			Upload: server.RequestLimit{BodySize: int64(cfg.Limits.UploadBodySize), Timeout: cfg.Limits.UploadTimeout},
+			OWS:    server.RequestLimit{BodySize: int64(cfg.Limits.OWSBodySize), Timeout: cfg.Limits.OWSTimeout},
+			Media:  server.RequestLimit{BodySize: int64(cfg.Limits.MediaBodySize), Timeout: cfg.Limits.MediaTimeout},
+		},
+		Proxy: server.ProxyConfig{
+			FlushInterval:        cfg.Proxy.FlushInterval,
+			AnonymousMaxResponse: int64(cfg.Proxy.AnonymousMaxResponse),
+			AllowedHeaders:       proxyHeaders,
+		},
+		Outbound:  outboundTransport,
+		Names:     namesConf,
+		Passwords: passwordPolicy,
+	}
+	if cfg.WebClient.Serve {
+		conf.WebApp.MaxAge = cfg.WebClient.MaxAge
+		if cfg.WebClient.Dir != "" {
+			if _, err := os.Stat(filepath.Join(cfg.WebClient.Dir, "index.html")); err != nil {
+				return fmt.Errorf("invalid web client directory: %w", err)
+			}
+			conf.WebApp.Files = os.DirFS(cfg.WebClient.Dir)
+		} else if files, ok := web.Files(); ok {
+			conf.WebApp.Files = files
+		} else {
+			return errors.New("web client is not embedded in this build, set directory with the web client (--web-client-dir)")
+		}
 	}
 
 	// Services
 	accountsRepo := postgres.NewAccountsRepository(dbConn)
 	tokenGenerator := security.NewTokenGenerator(cfg.Auth.SecretKey, "signup", cfg.Auth.EmailTokenExpiration)
+	events := application.NewEventBus(log)
 	emailSender := email.NewAccountsEmailSender(
 		es,
 		cfg.Email.Sender,
@@ -222,16 +623,55 @@ func Serve() error {
 		cfg.Email.ActivationSubject,
 		cfg.Email.PasswordResetSubject,
 	)
-	accountsService := application.NewAccountsService(emailSender, accountsRepo, tokenGenerator)
+	accountsService := application.NewAccountsService(emailSender, accountsRepo, tokenGenerator, events)
+	accountsService.Invites = postgres.NewInvitationsRepository(dbConn)
+	accountsService.Groups = postgres.NewGroupsRepository(dbConn)
+	accountsService.Deletions = postgres.NewAccountDeletionsRepository(dbConn)
 
-	sessionStore := auth.NewRedisStore(rdb)
+	sessionStore := auth.NewFallbackSessionStore(log, auth.NewRedisStore(rdb), cfg.Redis.SessionFallback)
 	authServ := auth.NewAuthService(log, cfg.Auth.SessionExpiration, accountsRepo, sessionStore)
+	authServ.SetIdleTimeout(cfg.Auth.SessionIdleTimeout)
+	authServ.SetAPITokens(postgres.NewAPITokensRepository(dbConn))
+	authServ.SetGroups(accountsService.Groups)
+	loginLimiter := auth.NewLoginRateLimiter(rdb, auth.LoginRateLimitConfig{
+		IPAttempts:       cfg.Auth.LoginRateLimit.IPAttempts,
+		UsernameAttempts: cfg.Auth.LoginRateLimit.UsernameAttempts,
+		Window:           cfg.Auth.LoginRateLimit.Window,
+		Lockout:          cfg.Auth.LoginRateLimit.Lockout,
+	})
+	if loginLimiter.Enabled() {
+		authServ.SetLoginLimiter(loginLimiter)
+	}
+	if cfg.Auth.OIDC.Issuer != "" {
+		redirectURL := cfg.Auth.OIDC.RedirectURL
+		if redirectURL == "" {
+			redirectURL = strings.TrimSuffix(cfg.Web.SiteURL, "/") + "/api/auth/oidc/callback"
+		}
+		var emailDomains []string
+		for _, d := range strings.Split(cfg.Auth.OIDC.EmailDomains, ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				emailDomains = append(emailDomains, d)
+			}
+		}
+		conf.OIDC = auth.NewOIDCProvider(auth.OIDCConfig{
+			Issuer:            cfg.Auth.OIDC.Issuer,
+			ClientID:          cfg.Auth.OIDC.ClientID,
+			ClientSecret:      cfg.Auth.OIDC.ClientSecret,
+			RedirectURL:       redirectURL,
+			Scopes:            strings.Fields(cfg.Auth.OIDC.Scopes),
+			UsernameClaim:     cfg.Auth.OIDC.UsernameClaim,
+			AutoProvision:     cfg.Auth.OIDC.AutoProvision,
+			EmailDomains:      emailDomains,
+			NormalizeUsername: conf.Names.NormalizeUsername,
+		}, accountsRepo, postgres.NewIdentitiesRepository(dbConn), outboundTransport)
+	}
 
 	projectsRepo := project.NewDiskStorage(log, cfg.Gisquick.ProjectsRoot)
 	defaultAccountConfig := domain.AccountConfig{
 		ProjectsCountLimit: cfg.Gisquick.AccountProjectsLimit,
 		ProjectSizeLimit:   domain.ByteSize(cfg.Gisquick.ProjectSizeLimit),
 		StorageLimit:       domain.ByteSize(cfg.Gisquick.AccountStorageLimit),
+		LibraryLimit:       domain.ByteSize(cfg.Gisquick.AccountLibraryLimit),
 	}
 	var limiter application.AccountsLimiter
 	if cfg.Gisquick.AccountLimiterConfig != "" {
@@ -239,26 +679,105 @@ func Serve() error {
 	} else {
 		limiter = project.NewSimpleProjectsLimiter(defaultAccountConfig)
 	}
-	projectsServ := application.NewProjectsService(log, projectsRepo, limiter)
+	projectLocks := project.NewRedisProjectLocks(log, rdb, cfg.Gisquick.ProjectLockTimeout)
+	projectsServ := application.NewProjectsService(log, projectsRepo, limiter, projectLocks, events)
+
+	secretsKeys, err := secretsKeyProvider(cfg.Auth.SecretsKeys, cfg.Auth.SecretKey)
+	if err != nil {
+		return fmt.Errorf("loading secrets keys: %w", err)
+	}
+	secretsRepo := postgres.NewProjectSecretsRepository(dbConn, security.NewCipher(secretsKeys))
+	changesRepo := postgres.NewLayerChangesRepository(dbConn)
 
 	sws := ws.NewSettingsWS(log)
-	s := server.NewServer(log, conf, authServ, accountsService, projectsServ, sws, limiter, notifications)
+	mapws := ws.NewMapWS(log)
+	s := server.NewServer(log, conf, authServ, accountsService, projectsServ, sws, limiter, notifications, projectLogs, usage, secretsRepo, formsQueue, changesRepo, mapws, requestsStats, catalogStatus, events)
+	if err := s.PrepareSetup(); err != nil {
+		log.Errorw("preparing first-run setup", zap.Error(err))
+	}
 
 	if cfg.Gisquick.Extensions != "" {
 		extensionsList := strings.Split(cfg.Gisquick.Extensions, ",")
 		for _, e := range extensionsList {
-			if err := s.AddExtension(e); err != nil {
+			if err := s.AddExtension(strings.TrimSpace(e)); err != nil {
 				log.Errorw("adding server extension", "name", e, zap.Error(err))
 			}
 		}
 	}
 
+	s.FailInterruptedJobs()
+
 	// Start server
 	go func() {
-		if err := s.ListenAndServe(cfg.Web.APIHost); err != nil && err != http.ErrServerClosed {
+		if err := s.Serve(listeners); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("shutting down the server: %v", err)
 		}
 	}()
+	if err := s.StartExtensions(context.Background()); err != nil {
+		log.Errorw("starting server extensions", zap.Error(err))
+	}
+	queueCtx, stopQueue := context.WithCancel(context.Background())
+	s.OnShutdown(stopQueue)
+	go s.ProcessFormsQueue(queueCtx, cfg.Gisquick.FormsQueueInterval)
+
+	grantsCtx, stopGrants := context.WithCancel(context.Background())
+	s.OnShutdown(stopGrants)
+	go s.ExpireAccessGrants(grantsCtx, cfg.Gisquick.AccessGrantsInterval)
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	s.OnShutdown(stopJobs)
+	go s.CleanupJobs(jobsCtx, time.Hour)
+
+	deletionsCtx, stopDeletions := context.WithCancel(context.Background())
+	s.OnShutdown(stopDeletions)
+	go s.DeleteScheduledAccounts(deletionsCtx, 10*time.Minute)
+
+	digestCtx, stopDigest := context.WithCancel(context.Background())
+	s.OnShutdown(stopDigest)
+	go s.SendWeeklyDigests(digestCtx)
+
+	statsCtx, stopStats := context.WithCancel(context.Background())
+	s.OnShutdown(stopStats)
+	go requestsStats.Run(statsCtx, time.Minute)
+
+	sessionsCtx, stopSessions := context.WithCancel(context.Background())
+	s.OnShutdown(stopSessions)
+	go sessionStore.Monitor(sessionsCtx, 5*time.Second)
+
+	if cfg.Gisquick.MapCacheRoot != "" && (cfg.MapCache.MaxSize > 0 || cfg.MapCache.ProjectMaxSize > 0) {
+		sweepCtx, stopSweeper := context.WithCancel(context.Background())
+		s.OnShutdown(stopSweeper)
+		go s.SweepMapCache(sweepCtx, cfg.MapCache.SweepInterval)
+	}
+
+	if len(dataChannels) > 0 {
+		dsn := cfg.Gisquick.DataChangesDSN
+		if dsn == "" {
+			u := url.URL{
+				Scheme:   "postgres",
+				User:     url.UserPassword(cfg.Postgres.User, cfg.Postgres.Password),
+				Host:     fmt.Sprintf("%s:%d", cfg.Postgres.Host, cfg.Postgres.Port),
+				Path:     cfg.Postgres.Name,
+				RawQuery: url.Values{"sslmode": {cfg.Postgres.SSLMode}}.Encode(),
+			}
+			dsn = u.String()
+		}
+		listenCtx, stopListener := context.WithCancel(context.Background())
+		s.OnShutdown(stopListener)
+		go func() {
+			if err := s.ListenDataChanges(listenCtx, dsn); err != nil {
+				log.Errorw("listening data changes", zap.Error(err))
+			}
+		}()
+	}
+
+	if cfg.Gisquick.WarmUpProjects > 0 {
+		go func() {
+			if _, err := s.WarmUpMostUsed(context.Background(), cfg.Gisquick.WarmUpProjects); err != nil {
+				log.Errorw("projects warm-up", zap.Error(err))
+			}
+		}()
+	}
 	// Wait for interrupt signal to gracefully shutdown the server with a timeout of 10 seconds.
 	// Use a buffered channel to avoid missing signals as recommended for signal.Notify
 	quit := make(chan os.Signal, 1)
@@ -15,8 +15,14 @@ func printCommandsList() {
 	fmt.Println("  addsuperuser")
 	fmt.Println("  dumpusers")
 	fmt.Println("  loadusers")
+	fmt.Println("  import-users")
+	fmt.Println("  export-users")
 	fmt.Println("  deleteuser")
 	fmt.Println("  migrate")
+	fmt.Println("  rotatekeys")
+	fmt.Println("  normalizefiles")
+	fmt.Println("  report")
+	fmt.Println("  config validate|print [--redact]")
 }
 
 func main() {
@@ -31,6 +37,10 @@ func main() {
 	switch cmd {
 	case "adduser":
 		runCommand(commands.AddUser)
+	case "import-users":
+		runCommand(commands.ImportUsers)
+	case "export-users":
+		runCommand(commands.ExportUsers)
 	case "deleteuser":
 		runCommand(commands.DeleteUser)
 	case "addsuperuser":
@@ -43,6 +53,14 @@ func main() {
 		runCommand(commands.Serve)
 	case "migrate":
 		runCommand(commands.Migrate)
+	case "rotatekeys":
+		runCommand(commands.RotateKeys)
+	case "normalizefiles":
+		runCommand(commands.NormalizeFiles)
+	case "report":
+		runCommand(commands.Report)
+	case "config":
+		runCommand(commands.Config)
 	default:
 		fmt.Fprintf(os.Stderr, "unknown command: %s\n", cmd)
 		printCommandsList()
@@ -0,0 +1,43 @@
+package application
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+var ErrAccountDeletionNotSupported = errors.New("Account deletion is not supported")
+
+// ScheduleDeletion schedules deletion of the account after the grace period
+func (s *AccountsService) ScheduleDeletion(username string, gracePeriod time.Duration) (domain.AccountDeletion, error) {
+	if s.Deletions == nil {
+		return domain.AccountDeletion{}, ErrAccountDeletionNotSupported
+	}
+	now := time.Now().UTC()
+	deletion := domain.AccountDeletion{
+		Username:  username,
+		Requested: now,
+		Scheduled: now.Add(gracePeriod),
+	}
+	if err := s.Deletions.Schedule(deletion); err != nil {
+		return deletion, err
+	}
+	return deletion, nil
+}
+
+// GetDeletion returns scheduled deletion of the account
+func (s *AccountsService) GetDeletion(username string) (domain.AccountDeletion, error) {
+	if s.Deletions == nil {
+		return domain.AccountDeletion{}, domain.ErrAccountDeletionNotFound
+	}
+	return s.Deletions.Get(username)
+}
+
+// CancelDeletion cancels scheduled deletion of the account
+func (s *AccountsService) CancelDeletion(username string) error {
+	if s.Deletions == nil {
+		return domain.ErrAccountDeletionNotFound
+	}
+	return s.Deletions.Cancel(username)
+}
@@ -31,13 +31,18 @@ type EmailService interface {
 type AccountsService struct {
 	Repository domain.AccountsRepository
 	Email      EmailService
+	Events     *EventBus
+	Invites    domain.InvitationsRepository
+	Groups     domain.GroupsRepository
+	Deletions  domain.AccountDeletionsRepository
 	tokenGen   TokenGenerator
 }
 
-func NewAccountsService(email EmailService, accountsRepo domain.AccountsRepository, tokenGen TokenGenerator) *AccountsService {
+func NewAccountsService(email EmailService, accountsRepo domain.AccountsRepository, tokenGen TokenGenerator, events *EventBus) *AccountsService {
 	return &AccountsService{
 		Repository: accountsRepo,
 		Email:      email,
+		Events:     events,
 		tokenGen:   tokenGen,
 	}
 }
@@ -63,6 +68,7 @@ func (s *AccountsService) NewAccount(username, email, firstName, lastName, passw
 	if err := s.Repository.Create(account); err != nil {
 		return account, err
 	}
+	s.Events.Publish(Event{Type: EventUserRegistered, User: account.Username})
 	if account.Email != "" && !account.Active {
 		uid := base64.URLEncoding.EncodeToString([]byte(account.Username))
 		token, err := s.tokenGen.GenerateToken(accountClaims(account))
@@ -93,6 +99,22 @@ func (s *AccountsService) SendActivationEmail(account domain.Account, data map[s
 	return nil
 }
 
+// ResendActivationEmail sends new activation email to the user with unverified email address
+func (s *AccountsService) ResendActivationEmail(email string) error {
+	account, err := s.Repository.GetByEmail(email)
+	if err != nil {
+		return err
+	}
+	if account.Confirmed != nil {
+		// accounts deactivated by administrator can't be activated again by email
+		if account.Active {
+			return domain.ErrAccountActive
+		}
+		return ErrNotActiveAccount
+	}
+	return s.SendActivationEmail(account, nil)
+}
+
 func (s *AccountsService) Activate(uid, token string) error {
 	username, err := base64.URLEncoding.DecodeString(uid)
 	if err != nil {
@@ -0,0 +1,104 @@
+package application
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+// Types of domain events
+const (
+	EventProjectPublished = "project.published"
+	EventFilesChanged     = "project.files_changed"
+	EventUserRegistered   = "user.registered"
+	EventWfsCommitted     = "wfs.committed"
+	// project metadata (layers) were updated
+	EventProjectUpdated = "project.updated"
+	// effective settings of the project were changed (settings or access grants)
+	EventSettingsChanged = "project.settings_changed"
+	// assigned permissions of the project users were changed
+	EventPermissionsChanged = "project.permissions_changed"
+	// subscription to all events
+	EventAll = "*"
+)
+
+type Event struct {
+	Type    string
+	Project string
+	User    string
+	Time    time.Time
+	// event specific data (e.g. FilesChangedData)
+	Data interface{}
+}
+
+type FilesChangedData struct {
+	Updated []domain.ProjectFile
+	Removed []string
+}
+
+// Users with changed permissions, groups are listed by name with domain.GroupRestrictionPrefix
+type PermissionsChangedData struct {
+	Users []string
+}
+
+type WfsCommittedData struct {
+	Changes []domain.LayerChange
+}
+
+type EventHandler func(Event)
+
+// EventBus delivers domain events to the subscribed handlers. Handlers are called asynchronously
+// (in order of subscription), so the publishing operation is not blocked by slow subscribers.
+type EventBus struct {
+	log      *zap.SugaredLogger
+	mu       sync.RWMutex
+	handlers map[string][]EventHandler
+}
+
+func NewEventBus(log *zap.SugaredLogger) *EventBus {
+	return &EventBus{
+		log:      log,
+		handlers: make(map[string][]EventHandler),
+	}
+}
+
+// Subscribe registers handler of the events of given type (or EventAll)
+func (b *EventBus) Subscribe(eventType string, handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+// Publish sends event to the subscribers, it's safe to call on nil bus (events are discarded)
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	handlers := make([]EventHandler, 0, len(b.handlers[e.Type])+len(b.handlers[EventAll]))
+	handlers = append(handlers, b.handlers[e.Type]...)
+	handlers = append(handlers, b.handlers[EventAll]...)
+	b.mu.RUnlock()
+	if len(handlers) == 0 {
+		return
+	}
+	go func() {
+		for _, h := range handlers {
+			b.call(h, e)
+		}
+	}()
+}
+
+func (b *EventBus) call(h EventHandler, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.log.Errorw("event handler panic", "event", e.Type, "project", e.Project, "error", r)
+		}
+	}()
+	h(e)
+}
@@ -0,0 +1,91 @@
+package application
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+var (
+	ErrGroupsNotSupported = errors.New("Groups are not supported")
+	ErrInvalidGroupName   = errors.New("Invalid group name")
+)
+
+var groupNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,49}$`)
+
+// Removes duplicate and empty usernames
+func normalizeMembers(usernames []string) []string {
+	members := make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		username = strings.TrimSpace(username)
+		if username != "" && !domain.StringArray(members).Has(username) {
+			members = append(members, username)
+		}
+	}
+	return members
+}
+
+// CreateGroup creates new group of users
+func (s *AccountsService) CreateGroup(name, description string, members []string) (domain.Group, error) {
+	if s.Groups == nil {
+		return domain.Group{}, ErrGroupsNotSupported
+	}
+	if !groupNameRegex.MatchString(name) {
+		return domain.Group{}, ErrInvalidGroupName
+	}
+	group := domain.Group{
+		Name:        name,
+		Description: strings.TrimSpace(description),
+		Created:     time.Now().UTC(),
+		Members:     normalizeMembers(members),
+	}
+	if err := s.Groups.Create(group); err != nil {
+		return domain.Group{}, err
+	}
+	return group, nil
+}
+
+// UpdateGroup updates description and members of the group. Returns usernames of the previous
+// and the current members.
+func (s *AccountsService) UpdateGroup(name, description string, members []string) (domain.Group, []string, error) {
+	if s.Groups == nil {
+		return domain.Group{}, nil, ErrGroupsNotSupported
+	}
+	group, err := s.Groups.Get(name)
+	if err != nil {
+		return group, nil, err
+	}
+	affected := append([]string{}, group.Members...)
+	group.Description = strings.TrimSpace(description)
+	group.Members = normalizeMembers(members)
+	if err := s.Groups.Update(name, group.Description); err != nil {
+		return group, nil, err
+	}
+	if err := s.Groups.SetMembers(name, group.Members); err != nil {
+		return group, nil, err
+	}
+	for _, username := range group.Members {
+		if !domain.StringArray(affected).Has(username) {
+			affected = append(affected, username)
+		}
+	}
+	return group, affected, nil
+}
+
+// DeleteGroup deletes the group, returns usernames of its members
+func (s *AccountsService) DeleteGroup(name string) ([]string, error) {
+	if s.Groups == nil {
+		return nil, ErrGroupsNotSupported
+	}
+	group, err := s.Groups.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Groups.Delete(name); err != nil {
+		return nil, err
+	}
+	return group.Members, nil
+}
@@ -0,0 +1,111 @@
+package application
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gofrs/uuid"
+)
+
+var ErrInvitationsNotSupported = errors.New("Invitations are not supported")
+
+func hashInvitationToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// CreateInvitation creates invitation of a new user with the given email. Returns secret token
+// of the invitation, which is not stored and can't be retrieved later.
+func (s *AccountsService) CreateInvitation(email, role, invitedBy string, expiration time.Duration) (domain.Invitation, string, error) {
+	if s.Invites == nil {
+		return domain.Invitation{}, "", ErrInvitationsNotSupported
+	}
+	email = strings.TrimSpace(email)
+	exists, err := s.Repository.EmailExists(email)
+	if err != nil {
+		return domain.Invitation{}, "", err
+	}
+	if exists {
+		return domain.Invitation{}, "", domain.ErrAccountExists
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return domain.Invitation{}, "", err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return domain.Invitation{}, "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now().UTC()
+	invitation := domain.Invitation{
+		ID:        id.String(),
+		Email:     email,
+		Role:      role,
+		InvitedBy: invitedBy,
+		Created:   now,
+		Expires:   now.Add(expiration),
+	}
+	if err := s.Invites.Create(invitation, hashInvitationToken(token)); err != nil {
+		return domain.Invitation{}, "", fmt.Errorf("saving invitation: %w", err)
+	}
+	return invitation, token, nil
+}
+
+// GetInvitation returns pending invitation by its token
+func (s *AccountsService) GetInvitation(token string) (domain.Invitation, error) {
+	if s.Invites == nil {
+		return domain.Invitation{}, ErrInvitationsNotSupported
+	}
+	invitation, err := s.Invites.GetByHash(hashInvitationToken(token))
+	if err != nil {
+		if errors.Is(err, domain.ErrInvitationNotFound) {
+			return invitation, ErrInvalidToken
+		}
+		return invitation, err
+	}
+	if !invitation.Pending(time.Now()) {
+		return invitation, ErrInvalidToken
+	}
+	return invitation, nil
+}
+
+// AcceptInvitation creates active account of the invited user. Email address and role
+// of the account are given by the invitation.
+func (s *AccountsService) AcceptInvitation(token, username, firstName, lastName, password string) (domain.Account, error) {
+	invitation, err := s.GetInvitation(token)
+	if err != nil {
+		return domain.Account{}, err
+	}
+	account, err := domain.NewAccount(username, invitation.Email, firstName, lastName, password)
+	if err != nil {
+		return account, err
+	}
+	// email address is verified by the invitation link
+	if err := account.Activate(); err != nil {
+		return account, err
+	}
+	account.Superuser = invitation.Role == domain.InvitationRoleSuperuser
+	if err := s.Repository.Create(account); err != nil {
+		return account, err
+	}
+	if err := s.Invites.SetAccepted(invitation.ID, account.Username, time.Now().UTC()); err != nil {
+		// invitation was accepted concurrently
+		if errors.Is(err, domain.ErrInvitationNotFound) {
+			if err := s.Repository.Delete(account.Username); err != nil {
+				return account, err
+			}
+			return account, ErrInvalidToken
+		}
+		return account, err
+	}
+	s.Events.Publish(Event{Type: EventUserRegistered, User: account.Username})
+	return account, nil
+}
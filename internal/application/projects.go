@@ -1,12 +1,15 @@
 package application
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/gisquick/gisquick-server/internal/domain"
 	"go.uber.org/zap"
@@ -23,7 +26,7 @@ type ProjectService interface {
 	Delete(projectName string) error
 	GetProjectInfo(projectName string) (domain.ProjectInfo, error)
 	GetUserProjects(username string) ([]domain.ProjectInfo, error)
-	AccessibleProjects(username string, skipErrors bool) ([]domain.ProjectInfo, error)
+	AccessibleProjects(user domain.User, skipErrors bool) ([]domain.ProjectInfo, error)
 	// SaveFile(projectName, filename string, r io.Reader) (string, error)
 	SaveFile(projectName, dir, pattern string, r io.Reader, size int64) (domain.ProjectFile, error)
 	DeleteFile(projectName, path string) error
@@ -33,7 +36,26 @@ type ProjectService interface {
 	UpdateMeta(projectName string, meta json.RawMessage) error
 
 	GetSettings(projectName string) (domain.ProjectSettings, error)
+	GetStoredSettings(projectName string) (domain.ProjectSettings, error)
 	UpdateSettings(projectName string, data json.RawMessage) error
+	UpdateAuthentication(projectName, authType string) error
+	InitSettings(projectName string, data json.RawMessage) error
+	UpdateState(projectName, state string) error
+	GetDescription(projectName string) (string, error)
+	SaveDescription(projectName string, text string) error
+	GetLayerStyles(projectName string) (map[string][]string, error)
+	GetLayerStyle(projectName, layerID, name string) ([]byte, error)
+	SaveLayerStyle(projectName, layerID, name string, data []byte) error
+	DeleteLayerStyle(projectName, layerID, name string) error
+
+	ListSharedFiles(username string) ([]domain.SharedFile, error)
+	SaveSharedFile(username, path string, r io.Reader) (domain.SharedFile, error)
+	DeleteSharedFile(username, path string) error
+	LinkSharedFile(projectName, sharedPath, path string) (domain.ProjectFile, error)
+
+	GetAccessGrants(projectName string) ([]domain.AccessGrant, error)
+	SaveAccessGrants(projectName string, grants []domain.AccessGrant) error
+	UpdateAccessGrants(projectName string, update func(grants []domain.AccessGrant) ([]domain.AccessGrant, bool)) (bool, error)
 
 	GetThumbnailPath(projectName string) string
 	SaveThumbnail(projectName string, r io.Reader) error
@@ -48,6 +70,8 @@ type ProjectService interface {
 	RemoveScripts(projectName string, modules ...string) (domain.Scripts, error)
 
 	GetProjectCustomizations(projectName string) (json.RawMessage, error)
+	ConfigVersion(projectName string) (string, error)
+	CacheStats() map[string]domain.CacheStats
 	Close()
 }
 
@@ -59,17 +83,30 @@ type projectService struct {
 	log     *zap.SugaredLogger
 	repo    domain.ProjectsRepository
 	limiter AccountsLimiter
+	// optional distributed locks of the project mutations
+	locker domain.ProjectLocker
+	events *EventBus
 	// cache *ttlcache.Cache
 }
 
-func NewProjectsService(log *zap.SugaredLogger, repo domain.ProjectsRepository, limiter AccountsLimiter) *projectService {
+func NewProjectsService(log *zap.SugaredLogger, repo domain.ProjectsRepository, limiter AccountsLimiter, locker domain.ProjectLocker, events *EventBus) *projectService {
 	return &projectService{
 		log:     log,
 		repo:    repo,
 		limiter: limiter,
+		locker:  locker,
+		events:  events,
 	}
 }
 
+// Acquires exclusive lock of the project (when locking is enabled)
+func (s *projectService) lock(projectName, operation string) (func(), error) {
+	if s.locker == nil {
+		return func() {}, nil
+	}
+	return s.locker.Lock(context.Background(), projectName, operation)
+}
+
 func (s *projectService) Create(name string, meta json.RawMessage) (*domain.ProjectInfo, error) {
 	username := strings.Split(name, "/")[0]
 	projects, err := s.repo.UserProjects(username)
@@ -92,6 +129,11 @@ func (s *projectService) GetProjectInfo(name string) (domain.ProjectInfo, error)
 }
 
 func (s *projectService) Delete(name string) error {
+	unlock, err := s.lock(name, "delete")
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	return s.repo.Delete(name)
 }
 
@@ -161,6 +203,7 @@ func (s *projectService) SaveFile(projectName, directory, pattern string, r io.R
 	if err != nil {
 		return finfo, fmt.Errorf("saving project file: %w", err)
 	}
+	s.events.Publish(Event{Type: EventFilesChanged, Project: projectName, Data: FilesChangedData{Updated: []domain.ProjectFile{finfo}}})
 	return finfo, nil
 }
 
@@ -178,15 +221,138 @@ func (s *projectService) GetQgisMetadata(projectName string, data interface{}) e
 }
 
 func (s *projectService) UpdateMeta(projectName string, meta json.RawMessage) error {
-	return s.repo.UpdateMeta(projectName, meta)
+	if err := s.repo.UpdateMeta(projectName, meta); err != nil {
+		return err
+	}
+	s.events.Publish(Event{Type: EventProjectUpdated, Project: projectName})
+	return nil
 }
 
+// GetSettings returns effective settings of the project (with applied active access grants)
 func (s *projectService) GetSettings(projectName string) (domain.ProjectSettings, error) {
+	settings, err := s.repo.GetSettings(projectName)
+	if err != nil {
+		return settings, err
+	}
+	grants, err := s.repo.GetAccessGrants(projectName)
+	if err != nil {
+		s.log.Errorw("reading access grants", "project", projectName, zap.Error(err))
+		return settings, nil
+	}
+	return domain.ApplyAccessGrants(settings, grants, time.Now()), nil
+}
+
+// GetStoredSettings returns settings of the project as they were published (for editing)
+func (s *projectService) GetStoredSettings(projectName string) (domain.ProjectSettings, error) {
 	return s.repo.GetSettings(projectName)
 }
 
+func (s *projectService) GetAccessGrants(projectName string) ([]domain.AccessGrant, error) {
+	return s.repo.GetAccessGrants(projectName)
+}
+
+func (s *projectService) SaveAccessGrants(projectName string, grants []domain.AccessGrant) error {
+	if err := s.repo.SaveAccessGrants(projectName, grants); err != nil {
+		return err
+	}
+	s.events.Publish(Event{Type: EventSettingsChanged, Project: projectName})
+	return nil
+}
+
+// UpdateAccessGrants atomically modifies access grants of the project
+func (s *projectService) UpdateAccessGrants(projectName string, update func(grants []domain.AccessGrant) ([]domain.AccessGrant, bool)) (bool, error) {
+	changed, err := s.repo.UpdateAccessGrants(projectName, update)
+	if err != nil {
+		return changed, err
+	}
+	if changed {
+		s.events.Publish(Event{Type: EventSettingsChanged, Project: projectName})
+	}
+	return changed, nil
+}
+
 func (s *projectService) UpdateSettings(projectName string, data json.RawMessage) error {
-	return s.repo.UpdateSettings(projectName, data)
+	unlock, err := s.lock(projectName, "settings")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// settings doesn't exist before the first publishing
+	oldSettings, _ := s.repo.GetSettings(projectName)
+	if err := s.repo.UpdateSettings(projectName, data); err != nil {
+		return err
+	}
+	s.events.Publish(Event{Type: EventSettingsChanged, Project: projectName})
+	s.events.Publish(Event{Type: EventProjectPublished, Project: projectName})
+	if newSettings, err := s.repo.GetSettings(projectName); err == nil {
+		if users := domain.PermissionsChangedUsers(oldSettings.Auth, newSettings.Auth); len(users) > 0 {
+			s.events.Publish(Event{Type: EventPermissionsChanged, Project: projectName, Data: PermissionsChangedData{Users: users}})
+		}
+	}
+	return nil
+}
+
+func (s *projectService) UpdateAuthentication(projectName, authType string) error {
+	return s.repo.UpdateAuthentication(projectName, authType)
+}
+
+func (s *projectService) InitSettings(projectName string, data json.RawMessage) error {
+	return s.repo.InitSettings(projectName, data)
+}
+
+func (s *projectService) UpdateState(projectName, state string) error {
+	return s.repo.UpdateState(projectName, state)
+}
+
+func (s *projectService) GetDescription(projectName string) (string, error) {
+	return s.repo.GetDescription(projectName)
+}
+
+func (s *projectService) SaveDescription(projectName string, text string) error {
+	return s.repo.SaveDescription(projectName, text)
+}
+
+func (s *projectService) GetLayerStyles(projectName string) (map[string][]string, error) {
+	return s.repo.GetLayerStyles(projectName)
+}
+
+func (s *projectService) GetLayerStyle(projectName, layerID, name string) ([]byte, error) {
+	return s.repo.GetLayerStyle(projectName, layerID, name)
+}
+
+func (s *projectService) SaveLayerStyle(projectName, layerID, name string, data []byte) error {
+	return s.repo.SaveLayerStyle(projectName, layerID, name, data)
+}
+
+func (s *projectService) DeleteLayerStyle(projectName, layerID, name string) error {
+	return s.repo.DeleteLayerStyle(projectName, layerID, name)
+}
+
+func (s *projectService) ListSharedFiles(username string) ([]domain.SharedFile, error) {
+	return s.repo.ListSharedFiles(username)
+}
+
+func (s *projectService) SaveSharedFile(username, path string, r io.Reader) (domain.SharedFile, error) {
+	return s.repo.SaveSharedFile(username, path, r)
+}
+
+func (s *projectService) DeleteSharedFile(username, path string) error {
+	return s.repo.DeleteSharedFile(username, path)
+}
+
+// Links shared file of the project owner into the project (without copying of the data)
+func (s *projectService) LinkSharedFile(projectName, sharedPath, path string) (domain.ProjectFile, error) {
+	unlock, err := s.lock(projectName, "upload")
+	if err != nil {
+		return domain.ProjectFile{}, err
+	}
+	defer unlock()
+	finfo, err := s.repo.LinkSharedFile(projectName, sharedPath, path)
+	if err != nil {
+		return finfo, err
+	}
+	s.events.Publish(Event{Type: EventFilesChanged, Project: projectName, Data: FilesChangedData{Updated: []domain.ProjectFile{finfo}}})
+	return finfo, nil
 }
 
 func (s *projectService) SaveThumbnail(projectName string, r io.Reader) error {
@@ -214,6 +380,11 @@ func (s *projectService) getProjectsSize(username string) (map[string]int64, err
 }
 
 func (s *projectService) UpdateFiles(projectName string, info domain.FilesChanges, next func() (string, io.ReadCloser, error)) ([]domain.ProjectFile, error) {
+	unlock, err := s.lock(projectName, "upload")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 	username := strings.Split(projectName, "/")[0]
 	accountConfig, err := s.limiter.GetAccountLimits(username)
 	if err != nil {
@@ -288,7 +459,12 @@ func (s *projectService) UpdateFiles(projectName string, info domain.FilesChange
 			}
 		}
 	}
-	return s.repo.UpdateFiles(projectName, info, next)
+	files, err := s.repo.UpdateFiles(projectName, info, next)
+	if err != nil {
+		return files, err
+	}
+	s.events.Publish(Event{Type: EventFilesChanged, Project: projectName, Data: FilesChangedData{Updated: info.Updates, Removed: info.Removes}})
+	return files, nil
 }
 
 func (s *projectService) GetScripts(projectName string) (domain.Scripts, error) {
@@ -329,11 +505,32 @@ func contains(items []string, value string) bool {
 
 type LayersData struct {
 	LayerNameToID map[string]string
+	// IDs of all layers in the layer groups (by group name and WMS name)
+	GroupLayers map[string][]string
+}
+
+// Collects IDs of the layers in the subtree and registers layers of the nested groups
+func collectGroupLayers(nodes []domain.TreeNode, groups map[string][]string) []string {
+	var ids []string
+	for _, n := range nodes {
+		if !n.IsGroup() {
+			ids = append(ids, n.LayerID())
+			continue
+		}
+		layers := collectGroupLayers(n.Children(), groups)
+		groups[n.GroupName()] = layers
+		if g, ok := n.(domain.GroupTreeNode); ok && g.WmsName != "" {
+			groups[g.WmsName] = layers
+		}
+		ids = append(ids, layers...)
+	}
+	return ids
 }
 
 func (s *projectService) GetLayersData(projectName string) (LayersData, error) {
 	type LayersMetadata struct {
-		Layers map[string]domain.LayerMeta `json:"layers"`
+		Layers     map[string]domain.LayerMeta `json:"layers"`
+		LayersTree []interface{}               `json:"layers_tree"`
 	}
 	var meta LayersMetadata
 	if err := s.GetQgisMetadata(projectName, &meta); err != nil {
@@ -343,8 +540,15 @@ func (s *projectService) GetLayersData(projectName string) (LayersData, error) {
 	for id, layer := range meta.Layers {
 		nameToID[layer.Name] = id
 	}
+	tree, err := domain.CreateTree2(meta.LayersTree)
+	if err != nil {
+		return LayersData{}, fmt.Errorf("parsing layers tree: %w", err)
+	}
+	groups := make(map[string][]string)
+	collectGroupLayers(tree, groups)
 	data := LayersData{
 		LayerNameToID: nameToID,
+		GroupLayers:   groups,
 	}
 	return data, nil
 }
@@ -543,7 +747,7 @@ func (s *projectService) GetMapConfig(projectName string, user domain.User) (map
 	if err := s.repo.ParseQgisMetadata(projectName, &meta); err != nil {
 		return nil, fmt.Errorf("parsing qgis meta: %w", err)
 	}
-	settings, err := s.repo.GetSettings(projectName)
+	settings, err := s.GetSettings(projectName)
 	if err != nil {
 		return nil, err
 	}
@@ -578,12 +782,15 @@ func (s *projectService) GetMapConfig(projectName string, user domain.User) (map
 	}
 
 	rolesPerms := domain.NewUserRolesPermissions(user, settings.Auth)
+	userRoles := domain.FilterUserRoles(user, settings.Auth.Roles)
+	isLayerVisible := func(id string) bool {
+		lset := settings.Layers[id]
+		return !lset.Flags.Has("excluded") && lset.Roles.Allows(user, userRoles) && (rolesPerms == nil || rolesPerms.LayerFlags(id).Has("view"))
+	}
 
 	baseLayersData, err := TransformLayersTree(
 		baseLayers,
-		func(id string) bool {
-			return !settings.Layers[id].Flags.Has("excluded") && (rolesPerms == nil || rolesPerms.LayerFlags(id).Has("view"))
-		},
+		isLayerVisible,
 		func(id string) interface{} {
 			lmeta := meta.Layers[id]
 			lset := settings.Layers[id]
@@ -623,7 +830,7 @@ func (s *projectService) GetMapConfig(projectName string, user domain.User) (map
 			// drawingOrder := indexOf(meta.LayersOrder, id)
 			// return !settings.Layers[id].Flags.Has("excluded") && rolesPerms.LayerFlags(id).Has("view")
 			// return drawingOrder != -1 && !settings.Layers[id].Flags.Has("excluded") && (rolesPerms == nil || rolesPerms.LayerFlags(id).Has("view"))
-			return !settings.Layers[id].Flags.Has("excluded") && (rolesPerms == nil || rolesPerms.LayerFlags(id).Has("view"))
+			return isLayerVisible(id)
 		},
 		func(id string) interface{} {
 			lmeta := meta.Layers[id]
@@ -793,6 +1000,18 @@ func (s *projectService) GetMapConfig(projectName string, user domain.User) (map
 	if len(settings.Formatters) > 0 {
 		data["formatters"] = settings.Formatters
 	}
+	if settings.Attribution != "" {
+		data["attribution"] = settings.Attribution
+	}
+	if settings.AttributionURL != "" {
+		data["attribution_url"] = settings.AttributionURL
+	}
+	if settings.License != "" {
+		data["license"] = settings.License
+	}
+	if settings.LicenseURL != "" {
+		data["license_url"] = settings.LicenseURL
+	}
 
 	scripts, err := s.GetScripts(projectName)
 	if err != nil {
@@ -822,14 +1041,12 @@ func (s *projectService) GetMapConfig(projectName string, user domain.User) (map
 		if visibleTopics != nil && !contains(visibleTopics, topic.ID) {
 			continue
 		}
+		if !topic.Roles.Allows(user, userRoles) {
+			continue
+		}
 		layers := make([]string, 0)
 		for _, lid := range topic.Layers {
-			lset := settings.Layers[lid]
-
-			visible := !lset.Flags.Has("excluded") && !lset.Flags.Has("hidden")
-			if visible && rolesPerms != nil {
-				visible = rolesPerms.LayerFlags(lid).Has("view")
-			}
+			visible := isLayerVisible(lid) && !settings.Layers[lid].Flags.Has("hidden")
 			if visible {
 				layers = append(layers, meta.Layers[lid].Name)
 			}
@@ -839,6 +1056,56 @@ func (s *projectService) GetMapConfig(projectName string, user domain.User) (map
 		}
 	}
 	data["topics"] = topics
+
+	disabledTools := make([]string, 0)
+	for name, tool := range settings.Tools {
+		if tool.Disabled || !tool.Roles.Allows(user, userRoles) {
+			disabledTools = append(disabledTools, name)
+		}
+	}
+	if len(disabledTools) > 0 {
+		sort.Strings(disabledTools)
+		data["disabled_tools"] = disabledTools
+	}
+	if len(settings.Reports) > 0 {
+		type ReportInfo struct {
+			Name  string `json:"name"`
+			Title string `json:"title"`
+			Layer string `json:"layer"`
+		}
+		reports := make([]ReportInfo, 0, len(settings.Reports))
+		for name, r := range settings.Reports {
+			if r.Roles.Allows(user, userRoles) && isLayerVisible(r.Layer) {
+				reports = append(reports, ReportInfo{Name: name, Title: r.Title, Layer: meta.Layers[r.Layer].Name})
+			}
+		}
+		sort.Slice(reports, func(i, j int) bool { return reports[i].Title < reports[j].Title })
+		data["reports"] = reports
+	}
+	symbology, err := s.repo.GetSymbology(projectName)
+	if err != nil {
+		s.log.Errorw("reading layers symbology", "project", projectName, zap.Error(err))
+	} else if len(symbology) > 0 {
+		layersSymbology := make(map[string]domain.LayerSymbology, len(symbology))
+		for id, ls := range symbology {
+			if lmeta, ok := meta.Layers[id]; ok && isLayerVisible(id) {
+				layersSymbology[lmeta.Name] = ls
+			}
+		}
+		data["symbology"] = layersSymbology
+	}
+	styles, err := s.repo.GetLayerStyles(projectName)
+	if err != nil {
+		s.log.Errorw("reading layers styles", "project", projectName, zap.Error(err))
+	} else if len(styles) > 0 {
+		layersStyles := make(map[string][]string, len(styles))
+		for id, names := range styles {
+			if lmeta, ok := meta.Layers[id]; ok && isLayerVisible(id) {
+				layersStyles[lmeta.Name] = names
+			}
+		}
+		data["styles"] = layersStyles
+	}
 	if settings.Geocoding != nil || settings.SearchByLocation {
 		search := SearchConfig{SearchByLocation: settings.SearchByLocation}
 		if settings.Geocoding != nil {
@@ -849,7 +1116,7 @@ func (s *projectService) GetMapConfig(projectName string, user domain.User) (map
 	return data, nil
 }
 
-func (s *projectService) AccessibleProjects(username string, skipErrors bool) ([]domain.ProjectInfo, error) {
+func (s *projectService) AccessibleProjects(user domain.User, skipErrors bool) ([]domain.ProjectInfo, error) {
 	projects := make([]domain.ProjectInfo, 0)
 	list, err := s.repo.AllProjects(skipErrors)
 	if err != nil {
@@ -866,14 +1133,14 @@ func (s *projectService) AccessibleProjects(username string, skipErrors bool) ([
 			if pi.Authentication == "public" || pi.Authentication == "authenticated" {
 				projects = append(projects, pi)
 			} else if pi.Authentication == "users" {
-				settings, err := s.repo.GetSettings(projectName)
+				settings, err := s.GetSettings(projectName)
 				if err != nil {
 					s.log.Errorw("getting project settings", "project", projectName, zap.Error(err))
 					if !skipErrors {
 						return nil, err
 					}
 				}
-				if domain.StringArray(settings.Auth.Users).Has(username) {
+				if settings.Auth.HasUser(user) {
 					projects = append(projects, pi)
 				}
 			}
@@ -882,6 +1149,36 @@ func (s *projectService) AccessibleProjects(username string, skipErrors bool) ([
 	return projects, nil
 }
 
+// ConfigVersion returns version of the project configuration. Access grants expire without
+// modification of the stored grants (until they are removed), so the number of expired grants
+// is included to change the version at the moment of expiration.
+func (s *projectService) ConfigVersion(projectName string) (string, error) {
+	version, err := s.repo.ConfigVersion(projectName)
+	if err != nil {
+		return "", err
+	}
+	grants, err := s.repo.GetAccessGrants(projectName)
+	if err != nil {
+		s.log.Errorw("reading access grants", "project", projectName, zap.Error(err))
+		return version, nil
+	}
+	now := time.Now()
+	expired := 0
+	for _, g := range grants {
+		if !g.Active(now) {
+			expired++
+		}
+	}
+	if expired > 0 {
+		version = fmt.Sprintf("%s-%d", version, expired)
+	}
+	return version, nil
+}
+
+func (s *projectService) CacheStats() map[string]domain.CacheStats {
+	return s.repo.CacheStats()
+}
+
 func (s *projectService) Close() {
 	s.repo.Close()
 }
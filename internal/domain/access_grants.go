@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrAccessGrantNotExists = errors.New("access grant does not exists")
+
+// Temporary access of the user to the project, optionally with membership in the project role
+// (e.g. role with edit permissions). Expired grants are ignored by the authorization.
+type AccessGrant struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role,omitempty"`
+	Expires   time.Time `json:"expires"`
+	Created   time.Time `json:"created"`
+	GrantedBy string    `json:"granted_by"`
+	// creator of the grant was notified about upcoming expiration
+	ExpirationNotified bool `json:"expiration_notified,omitempty"`
+}
+
+func (g AccessGrant) Active(now time.Time) bool {
+	return now.Before(g.Expires)
+}
+
+type AccessGrantsRepository interface {
+	GetAccessGrants(projectName string) ([]AccessGrant, error)
+	SaveAccessGrants(projectName string, grants []AccessGrant) error
+	// atomically modifies the grants, update function returns new grants and whether they changed
+	UpdateAccessGrants(projectName string, update func(grants []AccessGrant) ([]AccessGrant, bool)) (bool, error)
+}
+
+// ApplyAccessGrants returns copy of the settings with users of active grants added into
+// the list of allowed users and into the granted roles
+func ApplyAccessGrants(settings ProjectSettings, grants []AccessGrant, now time.Time) ProjectSettings {
+	var active []AccessGrant
+	for _, g := range grants {
+		if g.Active(now) {
+			active = append(active, g)
+		}
+	}
+	if len(active) == 0 {
+		return settings
+	}
+	// settings values can be shared (cached), so modified slices must be copied
+	users := append(StringArray{}, settings.Auth.Users...)
+	roles := append([]ProjectRole{}, settings.Auth.Roles...)
+	for _, g := range active {
+		if !users.Has(g.Username) {
+			users = append(users, g.Username)
+		}
+		if g.Role == "" {
+			continue
+		}
+		for i := range roles {
+			if roles[i].Name == g.Role && !StringArray(roles[i].Users).Has(g.Username) {
+				roles[i].Users = append(append([]string{}, roles[i].Users...), g.Username)
+			}
+		}
+	}
+	settings.Auth.Users = users
+	settings.Auth.Roles = roles
+	return settings
+}
@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrAccountDeletionNotFound = errors.New("Account deletion is not scheduled")
+
+// Deletion of the account requested by the user, account is deleted after the grace period
+// (deletion can be cancelled until then)
+type AccountDeletion struct {
+	Username  string    `json:"username"`
+	Requested time.Time `json:"requested_at"`
+	Scheduled time.Time `json:"scheduled_at"`
+}
+
+type AccountDeletionsRepository interface {
+	Schedule(deletion AccountDeletion) error
+	Get(username string) (AccountDeletion, error)
+	Cancel(username string) error
+	// Due returns deletions scheduled before the given time
+	Due(t time.Time) ([]AccountDeletion, error)
+}
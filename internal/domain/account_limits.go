@@ -12,6 +12,8 @@ type AccountConfig struct {
 	ProjectsCountLimit int      `json:"projects_limit"`
 	ProjectSizeLimit   ByteSize `json:"project_size_limit"`
 	StorageLimit       ByteSize `json:"storage_limit"`
+	// size limit of the user's data library (not included in the storage limit)
+	LibraryLimit ByteSize `json:"library_limit"`
 }
 
 func parseByteSize(value string) (int64, error) {
@@ -68,6 +70,14 @@ func (c *AccountConfig) HasProjectSizeLimit() bool {
 func (c *AccountConfig) CheckStorageLimit(size int64) bool {
 	return c.StorageLimit == -1 || size <= int64(c.StorageLimit)
 }
+
+func (c *AccountConfig) HasLibraryLimit() bool {
+	return c.LibraryLimit > -1
+}
+
+func (c *AccountConfig) CheckLibraryLimit(size int64) bool {
+	return c.LibraryLimit == -1 || size <= int64(c.LibraryLimit)
+}
 func (c *AccountConfig) CheckProjectSizeLimit(size int64) bool {
 	return c.ProjectSizeLimit == -1 || size <= int64(c.ProjectSizeLimit)
 }
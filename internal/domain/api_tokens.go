@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrAPITokenNotFound = errors.New("API token not found")
+
+// Personal API token of the user (secret value of the token is stored only as a hash)
+type APIToken struct {
+	ID       string     `json:"id"`
+	Username string     `json:"-"`
+	Name     string     `json:"name"`
+	Created  time.Time  `json:"created_at"`
+	Expires  *time.Time `json:"expires_at,omitempty"`
+	LastUsed *time.Time `json:"last_used_at,omitempty"`
+}
+
+func (t APIToken) Expired(now time.Time) bool {
+	return t.Expires != nil && !now.Before(*t.Expires)
+}
+
+type APITokensRepository interface {
+	Create(token APIToken, hash string) error
+	List(username string) ([]APIToken, error)
+	GetByHash(hash string) (APIToken, error)
+	Delete(username, id string) error
+	UpdateLastUsed(id string, t time.Time) error
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrGroupNotFound = errors.New("Group not found")
+	ErrGroupExists   = errors.New("Group already exists")
+)
+
+// Prefix of the group names in the roles restrictions of the project settings
+const GroupRestrictionPrefix = "group:"
+
+// Group of users, which can be referenced in project permissions instead of listing
+// all its members
+type Group struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Created     time.Time `json:"created_at"`
+	Members     []string  `json:"members"`
+}
+
+type GroupsRepository interface {
+	List() ([]Group, error)
+	Get(name string) (Group, error)
+	Create(group Group) error
+	Update(name string, description string) error
+	Delete(name string) error
+	SetMembers(name string, usernames []string) error
+	UserGroups(username string) ([]string, error)
+}
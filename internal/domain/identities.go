@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrIdentityNotFound = errors.New("Identity not found")
+	ErrIdentityExists   = errors.New("Identity is already linked to an account")
+)
+
+// Identity of the user in the external identity provider (OpenID Connect), accounts are matched
+// only by the issuer and subject, never by the claims controlled by the identity provider
+// (username, email)
+type Identity struct {
+	Issuer   string    `json:"issuer"`
+	Subject  string    `json:"subject"`
+	Username string    `json:"username"`
+	Created  time.Time `json:"created_at"`
+}
+
+type IdentitiesRepository interface {
+	Get(issuer, subject string) (Identity, error)
+	Create(identity Identity) error
+	Delete(issuer, subject string) error
+	UserIdentities(username string) ([]Identity, error)
+}
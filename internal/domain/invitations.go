@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvitationNotFound = errors.New("Invitation not found")
+
+const (
+	InvitationRoleUser      = "user"
+	InvitationRoleSuperuser = "superuser"
+)
+
+// Invitation of a new user created by administrator (secret token of the invitation is stored
+// only as a hash)
+type Invitation struct {
+	ID        string     `json:"id"`
+	Email     string     `json:"email"`
+	Role      string     `json:"role"`
+	InvitedBy string     `json:"invited_by"`
+	Created   time.Time  `json:"created_at"`
+	Expires   time.Time  `json:"expires_at"`
+	Accepted  *time.Time `json:"accepted_at,omitempty"`
+	Username  string     `json:"username,omitempty"`
+}
+
+// Pending reports whether the invitation can be still accepted
+func (i Invitation) Pending(now time.Time) bool {
+	return i.Accepted == nil && now.Before(i.Expires)
+}
+
+type InvitationsRepository interface {
+	Create(invitation Invitation, hash string) error
+	List() ([]Invitation, error)
+	GetByHash(hash string) (Invitation, error)
+	SetAccepted(id, username string, t time.Time) error
+	Delete(id string) error
+}
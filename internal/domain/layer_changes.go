@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// Feature change made through WFS-T transaction. Empty FeatureID means that
+// the change affected unknown set of features (transaction with attribute filter).
+type LayerChange struct {
+	Seq        int64     `json:"seq"`
+	Project    string    `json:"-"`
+	Layer      string    `json:"layer"`
+	Action     string    `json:"action"` // insert, update, delete
+	FeatureID  string    `json:"feature_id"`
+	User       string    `json:"user"`
+	Attributes []string  `json:"attributes,omitempty"` // changed attributes
+	Time       time.Time `json:"time"`
+}
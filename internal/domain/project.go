@@ -3,6 +3,7 @@ package domain
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 )
 
@@ -10,6 +11,7 @@ var (
 	ErrProjectNotExists     = errors.New("project does not exists")
 	ErrFileNotExists        = errors.New("project file does not exists")
 	ErrProjectAlreadyExists = errors.New("project already exists")
+	ErrStyleNotExists       = errors.New("layer style does not exists")
 )
 
 // Old code, currently used in mapcache package
@@ -143,6 +145,8 @@ type FileInfo struct {
 	Hash  string `json:"hash,omitempty"`
 	Size  int64  `json:"size"`
 	Mtime int64  `json:"mtime"`
+	// file is linked from the user's data library (not included in the project size)
+	Shared bool `json:"shared,omitempty"`
 }
 
 type ProjectFile struct {
@@ -168,6 +172,7 @@ func checkUserRole(u User, role ProjectRole) bool {
 				return true
 			}
 		}
+		return u.InGroups(role.Groups)
 	}
 	return false
 }
@@ -194,6 +199,22 @@ type FilesChanges struct {
 	Updates []ProjectFile
 }
 
+// Link of the library (shared) file into the project
+type LibraryLink struct {
+	Source string `json:"source"`
+	Path   string `json:"path"`
+}
+
+// FilePathError is returned for file paths which can't be used on all platforms
+type FilePathError struct {
+	Path   string
+	Reason string
+}
+
+func (e *FilePathError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+}
+
 type ScriptModule struct {
 	Path       string   `json:"path"`
 	Components []string `json:"components"`
@@ -223,6 +244,18 @@ type ProjectsRepository interface {
 
 	GetSettings(projectName string) (ProjectSettings, error)
 	UpdateSettings(projectName string, data json.RawMessage) error
+	UpdateAuthentication(projectName, authType string) error
+	InitSettings(projectName string, data json.RawMessage) error
+	UpdateState(projectName, state string) error
+	GetDescription(projectName string) (string, error)
+	SaveDescription(projectName string, text string) error
+	GetSymbology(projectName string) (map[string]LayerSymbology, error)
+	GetLayerStyles(projectName string) (map[string][]string, error)
+	GetLayerStyle(projectName, layerID, name string) ([]byte, error)
+	SaveLayerStyle(projectName, layerID, name string, data []byte) error
+	DeleteLayerStyle(projectName, layerID, name string) error
+	SharedFilesRepository
+	AccessGrantsRepository
 
 	GetThumbnailPath(projectName string) string
 	SaveThumbnail(projectName string, r io.Reader) error
@@ -231,5 +264,7 @@ type ProjectsRepository interface {
 	GetScripts(projectName string) (Scripts, error)
 	UpdateScripts(projectName string, scripts Scripts) error
 	GetProjectCustomizations(projectName string) (json.RawMessage, error)
+	ConfigVersion(projectName string) (string, error)
+	CacheStats() map[string]CacheStats
 	Close()
 }
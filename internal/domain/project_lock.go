@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrProjectLocked = errors.New("project is locked")
+
+// Info about the holder of the project lock
+type ProjectLock struct {
+	Operation string    `json:"operation"`
+	Owner     string    `json:"owner"`
+	Since     time.Time `json:"since"`
+}
+
+type ProjectLockedError struct {
+	Project string
+	Lock    ProjectLock
+}
+
+func (e *ProjectLockedError) Error() string {
+	return fmt.Sprintf("project %s is locked by operation '%s' (since %s)", e.Project, e.Lock.Operation, e.Lock.Since.Format(time.RFC3339))
+}
+
+func (e *ProjectLockedError) Unwrap() error {
+	return ErrProjectLocked
+}
+
+// ProjectLocker provides exclusive access to the project for mutating operations,
+// shared by all server instances
+type ProjectLocker interface {
+	// Acquires the project lock, returned function releases it
+	Lock(ctx context.Context, projectName, operation string) (func(), error)
+}
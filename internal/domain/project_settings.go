@@ -2,6 +2,8 @@ package domain
 
 import (
 	"encoding/json"
+	"sort"
+	"strings"
 )
 
 type AttributeSettings struct {
@@ -31,6 +33,7 @@ type LayerSettings struct {
 	QgisRelations    map[string]map[string]any `json:"qgis_relations,omitempty"`
 	Relations        []map[string]any          `json:"relations,omitempty"`
 	CustomProperties json.RawMessage           `json:"custom,omitempty"`
+	Roles            RolesRestriction          `json:"roles,omitempty"`
 }
 
 type GroupSettings struct {
@@ -39,16 +42,142 @@ type GroupSettings struct {
 }
 
 type Topic struct {
-	ID       string   `json:"id"`
-	Title    string   `json:"title"`
-	Abstract string   `json:"abstract"`
-	Layers   []string `json:"visible_overlays"`
+	ID       string           `json:"id"`
+	Title    string           `json:"title"`
+	Abstract string           `json:"abstract"`
+	Layers   []string         `json:"visible_overlays"`
+	Roles    RolesRestriction `json:"roles,omitempty"`
+}
+
+// Map client tool settings
+type ToolSettings struct {
+	Disabled bool             `json:"disabled,omitempty"`
+	Roles    RolesRestriction `json:"roles,omitempty"`
+}
+
+// Restricts visibility of map features (tools, topics, layers) to the listed roles.
+// Besides names of project roles, it can contain "anonymous" and "authenticated" values
+// and names of users groups with "group:" prefix. Empty list means no restriction.
+type RolesRestriction []string
+
+func (r RolesRestriction) Allows(u User, userRoles []ProjectRole) bool {
+	if len(r) == 0 {
+		return true
+	}
+	for _, name := range r {
+		switch name {
+		case "anonymous":
+			if !u.IsAuthenticated {
+				return true
+			}
+		case "authenticated":
+			if u.IsAuthenticated {
+				return true
+			}
+		default:
+			if strings.HasPrefix(name, GroupRestrictionPrefix) {
+				if StringArray(u.Groups).Has(strings.TrimPrefix(name, GroupRestrictionPrefix)) {
+					return true
+				}
+				continue
+			}
+			for _, role := range userRoles {
+				if role.Name == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+type ReportField struct {
+	Name string `json:"name"`
+	// localized column headers (language code -> header)
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type ReportOrder struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+// Template of attribute report (table of layer features exported into CSV or XLSX file)
+type ReportTemplate struct {
+	Title   string           `json:"title"`
+	Layer   string           `json:"layer"`
+	Fields  []ReportField    `json:"fields"`
+	OrderBy []ReportOrder    `json:"order_by,omitempty"`
+	Roles   RolesRestriction `json:"roles,omitempty"`
+}
+
+// Limits of WFS GetFeature requests (0 means unlimited)
+type WfsLimit struct {
+	MaxFeatures     int   `json:"max_features,omitempty"`
+	MaxResponseSize int64 `json:"max_response_size,omitempty"`
+}
+
+// Default WFS limit with overrides for roles (role names or "anonymous" and "authenticated")
+type WfsLimits struct {
+	WfsLimit
+	Roles map[string]WfsLimit `json:"roles,omitempty"`
+}
+
+// Protection of the public map against crawlers and scraping
+type RobotsSettings struct {
+	// X-Robots-Tag header and robots.txt entries excluding the map from search engines
+	NoIndex bool `json:"noindex"`
+	// rejects known bot user agents on OWS endpoints
+	BlockBots bool `json:"block_bots"`
+	// map tiles (GetMap/GetTile) of anonymous users require token issued to the map viewer
+	RequireToken bool `json:"require_token"`
+}
+
+func mergeLimit(a, b int64) int64 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// UserLimit returns the most permissive limit of matching roles or the default limit
+func (l WfsLimits) UserLimit(u User, userRoles []ProjectRole) WfsLimit {
+	var keys []string
+	if u.IsAuthenticated {
+		keys = append(keys, "authenticated")
+	} else {
+		keys = append(keys, "anonymous")
+	}
+	for _, r := range userRoles {
+		keys = append(keys, r.Name)
+	}
+	var limit *WfsLimit
+	for _, key := range keys {
+		rl, ok := l.Roles[key]
+		if !ok {
+			continue
+		}
+		if limit == nil {
+			limit = &rl
+			continue
+		}
+		limit.MaxFeatures = int(mergeLimit(int64(limit.MaxFeatures), int64(rl.MaxFeatures)))
+		limit.MaxResponseSize = mergeLimit(limit.MaxResponseSize, rl.MaxResponseSize)
+	}
+	if limit == nil {
+		return l.WfsLimit
+	}
+	return *limit
 }
 
 type ProjectRole struct {
 	Auth        string          `json:"type"`
 	Name        string          `json:"name"`
 	Users       []string        `json:"users"`
+	Groups      []string        `json:"groups,omitempty"`
 	Permissions RolePermissions `json:"permissions"`
 }
 
@@ -59,9 +188,89 @@ type RolePermissions struct {
 }
 
 type Authentication struct {
-	Type  string        `json:"type"`
-	Users []string      `json:"users,omitempty"`
-	Roles []ProjectRole `json:"roles,omitempty"`
+	Type   string        `json:"type"`
+	Users  []string      `json:"users,omitempty"`
+	Groups []string      `json:"groups,omitempty"`
+	Roles  []ProjectRole `json:"roles,omitempty"`
+	// access level ("public" or "authenticated") of users without project access to the service
+	// description (GetCapabilities and map config metadata), e.g. for catalogs harvesting
+	Capabilities string `json:"capabilities,omitempty"`
+}
+
+// HasUser reports whether the user is listed in the project users directly or by a group
+// (access with "users" authentication type)
+func (a Authentication) HasUser(u User) bool {
+	return StringArray(a.Users).Has(u.Username) || u.InGroups(a.Groups)
+}
+
+// CapabilitiesAllowed reports whether user can retrieve description of the services
+func (a Authentication) CapabilitiesAllowed(u User) bool {
+	switch a.Capabilities {
+	case "public":
+		return true
+	case "authenticated":
+		return u.IsAuthenticated
+	}
+	return false
+}
+
+// userPermissions returns description of the explicitly assigned permissions of the users
+// and groups (membership in the users list and in the roles). Groups are indexed by their
+// name with GroupRestrictionPrefix.
+func (a Authentication) userPermissions() map[string]string {
+	roles := make(map[string][]string)
+	for _, u := range a.Users {
+		roles[u] = append(roles[u], "")
+	}
+	for _, g := range a.Groups {
+		roles[GroupRestrictionPrefix+g] = append(roles[GroupRestrictionPrefix+g], "")
+	}
+	for _, r := range a.Roles {
+		for _, u := range r.Users {
+			roles[u] = append(roles[u], r.Name)
+		}
+		for _, g := range r.Groups {
+			roles[GroupRestrictionPrefix+g] = append(roles[GroupRestrictionPrefix+g], r.Name)
+		}
+	}
+	perms := make(map[string]string, len(roles))
+	for u, names := range roles {
+		sort.Strings(names)
+		perms[u] = strings.Join(names, "|")
+	}
+	return perms
+}
+
+// ProjectUsers returns users and groups (with GroupRestrictionPrefix) with explicitly
+// assigned permissions to the project
+func (a Authentication) ProjectUsers() []string {
+	perms := a.userPermissions()
+	users := make([]string, 0, len(perms))
+	for u := range perms {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// PermissionsChangedUsers returns users and groups (with GroupRestrictionPrefix) whose assigned
+// permissions differ between the two settings
+func PermissionsChangedUsers(old, new Authentication) []string {
+	oldPerms := old.userPermissions()
+	newPerms := new.userPermissions()
+	var users []string
+	for u, p := range newPerms {
+		if oldPerms[u] != p {
+			users = append(users, u)
+		}
+	}
+	for u := range oldPerms {
+		if _, ok := newPerms[u]; !ok {
+			users = append(users, u)
+		}
+	}
+	sort.Strings(users)
+	return users
 }
 
 type SettingsAuthentication struct {
@@ -80,22 +289,51 @@ type Geocoding struct {
 	QueryParams []SearchQueryParam `json:"query_params,omitempty"`
 }
 
+type MetadataContact struct {
+	Organization string `json:"organization,omitempty"`
+	Person       string `json:"person,omitempty"`
+	Email        string `json:"email,omitempty"`
+	Phone        string `json:"phone,omitempty"`
+}
+
+// Project metadata used in exported metadata records (ISO 19139, Dublin Core)
+type ProjectMetadata struct {
+	Abstract string           `json:"abstract,omitempty"`
+	Keywords []string         `json:"keywords,omitempty"`
+	Language string           `json:"language,omitempty"` // ISO 639-2 code
+	License  string           `json:"license,omitempty"`
+	Contact  *MetadataContact `json:"contact,omitempty"`
+	// publish metadata record into the configured CSW catalog
+	CatalogPublish bool `json:"catalog_publish,omitempty"`
+}
+
 type ProjectSettings struct {
-	Auth             Authentication           `json:"auth"`
-	SettingsAuth     SettingsAuthentication   `json:"settings_auth"`
-	BaseLayers       []string                 `json:"base_layers"`
-	Layers           map[string]LayerSettings `json:"layers"`
-	Groups           map[string]GroupSettings `json:"groups"`
-	Title            string                   `json:"title"`
-	MapCache         bool                     `json:"use_mapcache"`
-	Topics           []Topic                  `json:"topics"`
-	Extent           []float64                `json:"extent"`
-	InitialExtent    []float64                `json:"initial_extent"`
-	Scales           json.RawMessage          `json:"scales"`
-	TileResolutions  []float64                `json:"tile_resolutions"`
-	MapTiling        bool                     `json:"map_tiling"`
-	Formatters       []json.RawMessage        `json:"formatters,omitempty"`
-	Proj4            map[string]string        `json:"proj4,omitempty"`
-	Geocoding        *Geocoding               `json:"geocoding"`
-	SearchByLocation bool                     `json:"search_by_coords"`
+	Auth             Authentication            `json:"auth"`
+	SettingsAuth     SettingsAuthentication    `json:"settings_auth"`
+	BaseLayers       []string                  `json:"base_layers"`
+	Layers           map[string]LayerSettings  `json:"layers"`
+	Groups           map[string]GroupSettings  `json:"groups"`
+	Title            string                    `json:"title"`
+	MapCache         bool                      `json:"use_mapcache"`
+	Topics           []Topic                   `json:"topics"`
+	Extent           []float64                 `json:"extent"`
+	InitialExtent    []float64                 `json:"initial_extent"`
+	Scales           json.RawMessage           `json:"scales"`
+	TileResolutions  []float64                 `json:"tile_resolutions"`
+	MapTiling        bool                      `json:"map_tiling"`
+	Formatters       []json.RawMessage         `json:"formatters,omitempty"`
+	Proj4            map[string]string         `json:"proj4,omitempty"`
+	Geocoding        *Geocoding                `json:"geocoding"`
+	SearchByLocation bool                      `json:"search_by_coords"`
+	Tools            map[string]ToolSettings   `json:"tools,omitempty"`
+	Reports          map[string]ReportTemplate `json:"reports,omitempty"`
+	Metadata         *ProjectMetadata          `json:"metadata,omitempty"`
+	RasterCatalog    bool                      `json:"raster_catalog,omitempty"`
+	WfsLimits        *WfsLimits                `json:"wfs_limits,omitempty"`
+	Services         []string                  `json:"services,omitempty"` // allowed OWS services (all when empty)
+	Attribution      string                    `json:"attribution,omitempty"`
+	AttributionURL   string                    `json:"attribution_url,omitempty"`
+	License          string                    `json:"license,omitempty"`
+	LicenseURL       string                    `json:"license_url,omitempty"`
+	Robots           *RobotsSettings           `json:"robots,omitempty"`
 }
@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPermissionsChangedUsers(t *testing.T) {
+	old := Authentication{
+		Users:  []string{"alice"},
+		Groups: []string{"surveyors"},
+		Roles: []ProjectRole{
+			{Name: "editors", Users: []string{"bob"}, Groups: []string{"gis"}},
+		},
+	}
+	new := Authentication{
+		Users:  []string{"alice"},
+		Groups: []string{"surveyors"},
+		Roles: []ProjectRole{
+			{Name: "editors", Users: []string{"bob"}, Groups: []string{"cadastre"}},
+		},
+	}
+	expected := []string{"group:cadastre", "group:gis"}
+	if users := PermissionsChangedUsers(old, new); !reflect.DeepEqual(users, expected) {
+		t.Errorf("expected %v, got %v", expected, users)
+	}
+	expected = []string{"alice", "bob", "group:gis", "group:surveyors"}
+	if users := old.ProjectUsers(); !reflect.DeepEqual(users, expected) {
+		t.Errorf("expected project users %v, got %v", expected, users)
+	}
+}
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrSecretNotFound = errors.New("project secret not found")
+)
+
+var isValidSecretName = regexp.MustCompile(`^[0-9A-Za-z_\-\.]+$`).MatchString
+
+// Database connection credentials of project's datasource, exposed to the map server
+// as a PostgreSQL connection service
+type ConnectionSecret struct {
+	Name     string `json:"name"`
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"`
+	Database string `json:"dbname"`
+	User     string `json:"user"`
+	Password string `json:"password,omitempty"`
+	SSLMode  string `json:"sslmode,omitempty"`
+}
+
+var sslModes = StringArray{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Characters which would allow to inject other sections or parameters into the service file
+const serviceFileSpecialChars = "\n\r[]="
+
+func (s ConnectionSecret) Validate() error {
+	if len(s.Name) > 100 || !isValidSecretName(s.Name) {
+		return errors.New("invalid secret name")
+	}
+	if s.Host == "" || s.Database == "" {
+		return errors.New("missing host or database name")
+	}
+	values := map[string]string{"host": s.Host, "dbname": s.Database, "user": s.User, "password": s.Password}
+	for name, value := range values {
+		if strings.ContainsAny(value, serviceFileSpecialChars) {
+			return fmt.Errorf("invalid characters in %s", name)
+		}
+	}
+	if s.SSLMode != "" && !sslModes.Has(s.SSLMode) {
+		return errors.New("invalid sslmode")
+	}
+	return nil
+}
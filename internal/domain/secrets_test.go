@@ -0,0 +1,27 @@
+package domain
+
+import "testing"
+
+func TestConnectionSecretValidate(t *testing.T) {
+	valid := ConnectionSecret{Name: "gis-db", Host: "db.example.com", Port: 5432, Database: "gis", User: "reader", Password: "p@ss;word", SSLMode: "require"}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid secret: %v", err)
+	}
+	tests := map[string]func(s *ConnectionSecret){
+		"name":             func(s *ConnectionSecret) { s.Name = "gis]\n[other" },
+		"missing host":     func(s *ConnectionSecret) { s.Host = "" },
+		"host newline":     func(s *ConnectionSecret) { s.Host = "db\nhost=evil.com" },
+		"dbname section":   func(s *ConnectionSecret) { s.Database = "gis[other]" },
+		"user carriage":    func(s *ConnectionSecret) { s.User = "reader\rpassword" },
+		"password newline": func(s *ConnectionSecret) { s.Password = "secret\n[admin]\nhost=evil.com" },
+		"password equals":  func(s *ConnectionSecret) { s.Password = "a=b" },
+		"sslmode":          func(s *ConnectionSecret) { s.SSLMode = "disable\nhost=evil.com" },
+	}
+	for name, modify := range tests {
+		s := valid
+		modify(&s)
+		if err := s.Validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	ErrSharedFileNotExists = errors.New("shared file does not exists")
+	ErrSharedFileInUse     = errors.New("shared file is used by projects")
+)
+
+// Project file linked to the shared file
+type SharedFileReference struct {
+	Project string `json:"project"`
+	Path    string `json:"path"`
+}
+
+// Data file in the user's shared area, which can be linked into multiple projects
+type SharedFile struct {
+	Path       string                `json:"path"`
+	Hash       string                `json:"hash"`
+	Size       int64                 `json:"size"`
+	Mtime      int64                 `json:"mtime"`
+	References []SharedFileReference `json:"references"`
+}
+
+type SharedFilesRepository interface {
+	ListSharedFiles(username string) ([]SharedFile, error)
+	SaveSharedFile(username, path string, r io.Reader) (SharedFile, error)
+	DeleteSharedFile(username, path string) error
+	LinkSharedFile(projectName, sharedPath, path string) (ProjectFile, error)
+}
@@ -0,0 +1,32 @@
+package domain
+
+type SymbolLayer struct {
+	Class      string            `json:"class"` // e.g. SimpleFill, SimpleLine, SimpleMarker
+	Properties map[string]string `json:"props"`
+}
+
+type Symbol struct {
+	Type   string        `json:"type"` // fill, line or marker
+	Alpha  float64       `json:"alpha"`
+	Layers []SymbolLayer `json:"layers"`
+}
+
+// Legend item of categorized, graduated or rule-based renderer (or raster color map)
+type SymbologyItem struct {
+	Label   string   `json:"label"`
+	Value   string   `json:"value,omitempty"`
+	Lower   *float64 `json:"lower,omitempty"`
+	Upper   *float64 `json:"upper,omitempty"`
+	Filter  string   `json:"filter,omitempty"`
+	Color   string   `json:"color,omitempty"` // raster color map
+	Symbol  *Symbol  `json:"symbol,omitempty"`
+	Visible bool     `json:"visible"`
+}
+
+// Layer symbology extracted from the QGIS project
+type LayerSymbology struct {
+	Renderer  string          `json:"renderer"`
+	Attribute string          `json:"attribute,omitempty"`
+	Symbol    *Symbol         `json:"symbol,omitempty"`
+	Items     []SymbologyItem `json:"items,omitempty"`
+}
@@ -9,4 +9,16 @@ type User struct {
 	IsAuthenticated bool           `json:"-"`
 	IsGuest         bool           `json:"is_guest"`
 	Profile         map[string]any `json:"profile,omitempty"`
+	// names of the groups of the user
+	Groups []string `json:"groups,omitempty"`
+}
+
+// InGroups reports whether the user is a member of any of the groups
+func (u User) InGroups(groups []string) bool {
+	for _, g := range groups {
+		if StringArray(u.Groups).Has(g) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+type CachedFile struct {
+	Data    []byte
+	ModTime time.Time
+	ETag    string
+}
+
+type lruEntry struct {
+	path string
+	file *CachedFile
+}
+
+// FilesLRU keeps content of small files in memory, least recently used files are evicted
+// when the total size exceeds the limit. Cached files are validated by modification time and size.
+type FilesLRU struct {
+	mu          sync.Mutex
+	maxSize     int64
+	maxItemSize int64
+	size        int64
+	ll          *list.List
+	items       map[string]*list.Element
+	hits        uint64
+	misses      uint64
+}
+
+func NewFilesLRU(maxSize, maxItemSize int64) *FilesLRU {
+	return &FilesLRU{
+		maxSize:     maxSize,
+		maxItemSize: maxItemSize,
+		ll:          list.New(),
+		items:       make(map[string]*list.Element),
+	}
+}
+
+func (c *FilesLRU) lookup(path string, finfo os.FileInfo) *CachedFile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[path]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*lruEntry)
+	if !entry.file.ModTime.Equal(finfo.ModTime()) || int64(len(entry.file.Data)) != finfo.Size() {
+		c.remove(el)
+		return nil
+	}
+	c.ll.MoveToFront(el)
+	return entry.file
+}
+
+func (c *FilesLRU) remove(el *list.Element) {
+	entry := c.ll.Remove(el).(*lruEntry)
+	delete(c.items, entry.path)
+	c.size -= int64(len(entry.file.Data))
+}
+
+func (c *FilesLRU) add(path string, file *CachedFile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[path]; ok {
+		c.remove(el)
+	}
+	c.items[path] = c.ll.PushFront(&lruEntry{path: path, file: file})
+	c.size += int64(len(file.Data))
+	for c.size > c.maxSize && c.ll.Len() > 0 {
+		c.remove(c.ll.Back())
+	}
+}
+
+// Get returns content of the file from the cache or reads it from the disk. Returns nil
+// (without error) for files which are too large to be cached.
+func (c *FilesLRU) Get(path string) (*CachedFile, error) {
+	finfo, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if finfo.IsDir() || finfo.Size() > c.maxItemSize {
+		return nil, nil
+	}
+	if file := c.lookup(path, finfo); file != nil {
+		atomic.AddUint64(&c.hits, 1)
+		return file, nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := &CachedFile{
+		Data:    data,
+		ModTime: finfo.ModTime(),
+		ETag:    fmt.Sprintf(`"%x"`, sha1.Sum(data)),
+	}
+	// file could be changed while reading
+	if int64(len(data)) == finfo.Size() {
+		c.add(path, file)
+	}
+	return file, nil
+}
+
+func (c *FilesLRU) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *FilesLRU) Stats() domain.CacheStats {
+	return domain.CacheStats{Hits: atomic.LoadUint64(&c.hits), Misses: atomic.LoadUint64(&c.misses)}
+}
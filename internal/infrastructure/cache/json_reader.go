@@ -135,6 +135,10 @@ func (r *JSONFileReader[V]) Extend(filename string, data V) (V, error) {
 	return rec.Val, nil
 }
 
+func (r *JSONFileReader[V]) Metrics() ttlcache.Metrics {
+	return r.cache.Metrics()
+}
+
 func (r *JSONFileReader[V]) Close() {
 	r.cache.Stop()
 	r.cache.DeleteAll()
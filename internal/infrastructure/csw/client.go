@@ -0,0 +1,111 @@
+// Package csw implements client of the CSW 2.0.2 transactional interface (CSW-T),
+// used to publish metadata records into catalogs like GeoNetwork or pycsw
+package csw
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const requestTimeout = 30 * time.Second
+
+var xmlDeclarationRegex = regexp.MustCompile(`^\s*<\?xml[^>]*\?>\s*`)
+
+type Client struct {
+	URL      string
+	Username string
+	Password string
+	client   *http.Client
+}
+
+// NewClient creates CSW-T client, transport can be nil (default transport)
+func NewClient(url, username, password string, transport http.RoundTripper) *Client {
+	return &Client{
+		URL:      url,
+		Username: username,
+		Password: password,
+		client:   &http.Client{Timeout: requestTimeout, Transport: transport},
+	}
+}
+
+// TransactionResponse or ExceptionReport document
+type transactionResponse struct {
+	XMLName     xml.Name
+	TotalInsert int      `xml:"TransactionSummary>totalInserted"`
+	TotalUpdate int      `xml:"TransactionSummary>totalUpdated"`
+	TotalDelete int      `xml:"TransactionSummary>totalDeleted"`
+	Exceptions  []string `xml:"Exception>ExceptionText"`
+}
+
+func (c *Client) transaction(ctx context.Context, operation string) (*transactionResponse, error) {
+	body := `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<csw:Transaction service="CSW" version="2.0.2" xmlns:csw="http://www.opengis.net/cat/csw/2.0.2"` +
+		` xmlns:ogc="http://www.opengis.net/ogc" xmlns:apiso="http://www.opengis.net/cat/csw/apiso/1.0">` +
+		operation + `</csw:Transaction>`
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("building request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=UTF-8")
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("catalog request: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("catalog response status: %d", resp.StatusCode)
+	}
+	var tr transactionResponse
+	if err := xml.Unmarshal(data, &tr); err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+	if tr.XMLName.Local == "ExceptionReport" {
+		if len(tr.Exceptions) > 0 {
+			return nil, errors.New(strings.Join(tr.Exceptions, "; "))
+		}
+		return nil, errors.New("catalog exception")
+	}
+	return &tr, nil
+}
+
+// Upsert inserts metadata record (ISO 19139 document) or replaces existing record with the same identifier
+func (c *Client) Upsert(ctx context.Context, record []byte) error {
+	content := xmlDeclarationRegex.ReplaceAllString(string(record), "")
+	tr, err := c.transaction(ctx, "<csw:Update>"+content+"</csw:Update>")
+	if err == nil && tr.TotalUpdate > 0 {
+		return nil
+	}
+	tr, err = c.transaction(ctx, "<csw:Insert>"+content+"</csw:Insert>")
+	if err != nil {
+		return err
+	}
+	if tr.TotalInsert == 0 {
+		return errors.New("record was not inserted")
+	}
+	return nil
+}
+
+// Delete removes metadata record with the given identifier
+func (c *Client) Delete(ctx context.Context, identifier string) error {
+	var id bytes.Buffer
+	xml.EscapeText(&id, []byte(identifier))
+	_, err := c.transaction(ctx, `<csw:Delete><csw:Constraint version="1.1.0"><ogc:Filter><ogc:PropertyIsEqualTo>`+
+		`<ogc:PropertyName>apiso:Identifier</ogc:PropertyName><ogc:Literal>`+id.String()+`</ogc:Literal>`+
+		`</ogc:PropertyIsEqualTo></ogc:Filter></csw:Constraint></csw:Delete>`)
+	return err
+}
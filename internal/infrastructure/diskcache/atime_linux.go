@@ -0,0 +1,17 @@
+//go:build linux
+
+package diskcache
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// Returns access time of the file (modification time when not available)
+func accessTime(info fs.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Atim.Sec, st.Atim.Nsec)
+	}
+	return info.ModTime()
+}
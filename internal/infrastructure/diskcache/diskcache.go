@@ -0,0 +1,67 @@
+package diskcache
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Cached file
+type Entry struct {
+	Path     string
+	Size     int64
+	Accessed time.Time
+}
+
+// Scan returns all files in the directory (recursively) with total size
+func Scan(dir string) ([]Entry, int64, error) {
+	var entries []Entry
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// files can be removed during the scan
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		entries = append(entries, Entry{Path: path, Size: info.Size(), Accessed: accessTime(info)})
+		total += info.Size()
+		return nil
+	})
+	return entries, total, err
+}
+
+// Evict removes least recently used entries until total size fits into the budget.
+// Returns remaining entries, their size and number of removed files.
+func Evict(entries []Entry, total, budget int64) ([]Entry, int64, int, error) {
+	if total <= budget {
+		return entries, total, 0, nil
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Accessed.Before(entries[j].Accessed) })
+	removed := 0
+	for i, e := range entries {
+		if total <= budget {
+			return entries[i:], total, removed, nil
+		}
+		if err := os.Remove(e.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return entries[i:], total, removed, err
+		}
+		total -= e.Size
+		removed++
+	}
+	return nil, total, removed, nil
+}
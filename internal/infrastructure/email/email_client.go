@@ -2,6 +2,7 @@ package email
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"time"
 
@@ -25,6 +26,8 @@ type SmtpEmailService struct {
 	Encryption mail.Encryption
 	Username   string
 	Password   string
+	// trusted CA certificates (system pool when nil)
+	RootCAs *x509.CertPool
 }
 
 func (s *SmtpEmailService) SendEmail(email *mail.Email) error {
@@ -37,6 +40,7 @@ func (s *SmtpEmailService) SendEmail(email *mail.Email) error {
 	if s.Encryption == mail.EncryptionTLS || s.Encryption == mail.EncryptionSSLTLS || s.Encryption == mail.EncryptionSTARTTLS {
 		smtp.TLSConfig = &tls.Config{
 			ServerName: s.Host,
+			RootCAs:    s.RootCAs,
 		}
 	} else {
 		smtp.TLSConfig = &tls.Config{
@@ -71,6 +75,7 @@ func (s *SmtpEmailService) SendMultiple(next func() (*mail.Email, error)) error
 	if s.Encryption == mail.EncryptionTLS || s.Encryption == mail.EncryptionSSLTLS || s.Encryption == mail.EncryptionSTARTTLS {
 		smtp.TLSConfig = &tls.Config{
 			ServerName: s.Host,
+			RootCAs:    s.RootCAs,
 		}
 	} else {
 		smtp.TLSConfig = &tls.Config{
@@ -109,3 +114,30 @@ func (s *SmtpEmailService) SendMultiple(next func() (*mail.Email, error)) error
 	}
 	return nil
 }
+
+// CheckConnection connects and authenticates to the SMTP server without sending any email
+func (s *SmtpEmailService) CheckConnection() error {
+	smtp := mail.NewSMTPClient()
+	smtp.Host = s.Host
+	smtp.Port = s.Port
+	smtp.Username = s.Username
+	smtp.Password = s.Password
+	smtp.Encryption = s.Encryption
+	if s.Encryption == mail.EncryptionTLS || s.Encryption == mail.EncryptionSSLTLS || s.Encryption == mail.EncryptionSTARTTLS {
+		smtp.TLSConfig = &tls.Config{
+			ServerName: s.Host,
+			RootCAs:    s.RootCAs,
+		}
+	} else {
+		smtp.TLSConfig = &tls.Config{
+			InsecureSkipVerify: true,
+		}
+	}
+	smtp.ConnectTimeout = 10 * time.Second
+
+	client, err := smtp.Connect()
+	if err != nil {
+		return fmt.Errorf("smtp connect: %w", err)
+	}
+	return client.Close()
+}
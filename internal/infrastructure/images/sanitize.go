@@ -0,0 +1,350 @@
+package images
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrInvalidImage  = errors.New("invalid image")
+	ErrImageTooLarge = errors.New("image is too large")
+)
+
+// Extensions of the image files which are sanitized
+var imageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".svg": true}
+
+// IsImageFile checks whether the file (by its extension) is an image which should be sanitized
+func IsImageFile(filename string) bool {
+	return imageExtensions[strings.ToLower(path.Ext(filename))]
+}
+
+// Checks dimensions of the image without decoding of the whole image
+func checkDimensions(data []byte, maxPixels int) (string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return "", ErrInvalidImage
+	}
+	if maxPixels > 0 && cfg.Width*cfg.Height > maxPixels {
+		return "", ErrImageTooLarge
+	}
+	return format, nil
+}
+
+// Counts frames of the GIF image without decoding of the image data
+func gifFrames(data []byte) (int, error) {
+	if len(data) < 13 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	pos := 13
+	// global color table
+	if data[10]&0x80 != 0 {
+		pos += 3 << ((data[10] & 0x07) + 1)
+	}
+	// skips data sub-blocks
+	skipBlocks := func() error {
+		for {
+			if pos >= len(data) {
+				return io.ErrUnexpectedEOF
+			}
+			size := int(data[pos])
+			pos += size + 1
+			if size == 0 {
+				return nil
+			}
+		}
+	}
+	frames := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // extension
+			pos += 2
+			if err := skipBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x2C: // image descriptor
+			if pos+10 > len(data) {
+				return 0, io.ErrUnexpectedEOF
+			}
+			packed := data[pos+9]
+			pos += 10
+			// local color table
+			if packed&0x80 != 0 {
+				pos += 3 << ((packed & 0x07) + 1)
+			}
+			// LZW minimum code size
+			pos++
+			if err := skipBlocks(); err != nil {
+				return 0, err
+			}
+			frames++
+		case 0x3B: // trailer
+			return frames, nil
+		default:
+			return 0, errors.New("unknown block")
+		}
+	}
+	return 0, io.ErrUnexpectedEOF
+}
+
+// Checks size of all frames of the animated GIF image (frames are decoded into the full image size)
+func checkGIFFrames(data []byte, maxPixels int) error {
+	cfg, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidImage, err)
+	}
+	frames, err := gifFrames(data)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidImage, err)
+	}
+	if maxPixels > 0 && frames*cfg.Width*cfg.Height > maxPixels {
+		return ErrImageTooLarge
+	}
+	return nil
+}
+
+// SanitizeThumbnail validates and re-encodes raster image into JPEG format (without metadata),
+// images larger than maxSize are downscaled
+func SanitizeThumbnail(data []byte, maxPixels, maxSize int) ([]byte, error) {
+	if _, err := checkDimensions(data, maxPixels); err != nil {
+		return nil, err
+	}
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidImage, err)
+	}
+	if b := img.Bounds(); b.Dx() > maxSize || b.Dy() > maxSize {
+		img = imaging.Fit(img, maxSize, maxSize, imaging.Lanczos)
+	}
+	// flatten transparent images on the white background
+	bg := imaging.New(img.Bounds().Dx(), img.Bounds().Dy(), color.White)
+	img = imaging.Overlay(bg, img, image.Pt(0, 0), 1.0)
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(85)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Sanitize validates and re-encodes the image file, which strips metadata (e.g. EXIF) and any
+// embedded content. Returns sanitized data and filename with the canonical extension - JPEG
+// and GIF images keep their format, other raster images are converted into PNG.
+func Sanitize(data []byte, filename string, maxPixels int) ([]byte, string, error) {
+	ext := strings.ToLower(path.Ext(filename))
+	if ext == ".svg" {
+		sanitized, err := SanitizeSVG(data)
+		return sanitized, filename, err
+	}
+	format, err := checkDimensions(data, maxPixels)
+	if err != nil {
+		return nil, "", err
+	}
+	var buf bytes.Buffer
+	switch format {
+	case "gif":
+		if err := checkGIFFrames(data, maxPixels); err != nil {
+			return nil, "", err
+		}
+		// keeps animation frames
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidImage, err)
+		}
+		if err := gif.EncodeAll(&buf, g); err != nil {
+			return nil, "", err
+		}
+		ext = ".gif"
+	default:
+		img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidImage, err)
+		}
+		encFormat := imaging.PNG
+		if format == "jpeg" {
+			encFormat = imaging.JPEG
+			if ext != ".jpg" && ext != ".jpeg" {
+				ext = ".jpg"
+			}
+		} else {
+			ext = ".png"
+		}
+		if err := imaging.Encode(&buf, img, encFormat, imaging.JPEGQuality(90)); err != nil {
+			return nil, "", err
+		}
+	}
+	name := strings.TrimSuffix(filename, path.Ext(filename)) + ext
+	return buf.Bytes(), name, nil
+}
+
+// Elements which are removed from SVG documents (including their content)
+var svgForbiddenElements = map[string]bool{
+	"script": true, "foreignobject": true, "iframe": true, "embed": true, "object": true, "handler": true,
+}
+
+// Checks that the link doesn't execute script (javascript: URLs or embedded SVG documents)
+func safeSVGLink(value string) bool {
+	v := strings.ToLower(strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, value))
+	if strings.HasPrefix(v, "data:") {
+		return strings.HasPrefix(v, "data:image/") && !strings.HasPrefix(v, "data:image/svg")
+	}
+	return !strings.HasPrefix(v, "javascript:") && !strings.HasPrefix(v, "vbscript:")
+}
+
+func safeSVGAttr(attr xml.Attr) bool {
+	name := strings.ToLower(attr.Name.Local)
+	if strings.HasPrefix(name, "on") {
+		return false
+	}
+	switch name {
+	case "href", "src", "action", "formaction":
+		return safeSVGLink(attr.Value)
+	case "to", "from", "by", "values":
+		// animation of the href attribute
+		for _, v := range strings.Split(attr.Value, ";") {
+			if !safeSVGLink(v) {
+				return false
+			}
+		}
+	case "style":
+		v := strings.ToLower(attr.Value)
+		return !strings.Contains(v, "javascript:") && !strings.Contains(v, "expression(")
+	}
+	return true
+}
+
+func qualifiedName(n xml.Name) string {
+	if n.Space != "" {
+		return n.Space + ":" + n.Local
+	}
+	return n.Local
+}
+
+type replacement struct {
+	start, end int64
+	text       string
+}
+
+// SanitizeSVG removes scripts, event handler attributes and javascript links from the SVG document.
+// Document is modified in place, so the rest of the content (namespaces, formatting) is preserved.
+func SanitizeSVG(data []byte) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var replacements []replacement
+	// start offset and depth of the removed element
+	var skipStart int64 = -1
+	skipDepth := 0
+	depth := 0
+	// names of the open elements (raw tokens are not checked by the decoder)
+	var open []xml.Name
+	hasRoot := false
+	for {
+		start := d.InputOffset()
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidImage, err)
+		}
+		end := d.InputOffset()
+		switch t := tok.(type) {
+		case xml.Directive:
+			// entity declarations can be used for expansion attacks
+			if bytes.Contains(bytes.ToUpper(t), []byte("ENTITY")) {
+				return nil, fmt.Errorf("%w: entity declarations are not allowed", ErrInvalidImage)
+			}
+			// e.g. DOCTYPE with external DTD
+			if skipStart == -1 {
+				replacements = append(replacements, replacement{start, end, ""})
+			}
+		case xml.ProcInst:
+			// only XML declaration is kept (xml-stylesheet can load external resources)
+			if skipStart == -1 && t.Target != "xml" {
+				replacements = append(replacements, replacement{start, end, ""})
+			}
+		case xml.StartElement:
+			open = append(open, t.Name)
+			depth++
+			if depth == 1 {
+				if strings.ToLower(t.Name.Local) != "svg" {
+					return nil, fmt.Errorf("%w: not an SVG document", ErrInvalidImage)
+				}
+				hasRoot = true
+			}
+			if skipStart != -1 {
+				continue
+			}
+			if svgForbiddenElements[strings.ToLower(t.Name.Local)] {
+				skipStart = start
+				skipDepth = depth
+				continue
+			}
+			attrs := make([]xml.Attr, 0, len(t.Attr))
+			for _, a := range t.Attr {
+				if safeSVGAttr(a) {
+					attrs = append(attrs, a)
+				}
+			}
+			if len(attrs) != len(t.Attr) {
+				var b strings.Builder
+				b.WriteString("<" + qualifiedName(t.Name))
+				for _, a := range attrs {
+					b.WriteString(" " + qualifiedName(a.Name) + `="`)
+					xml.EscapeText(&b, []byte(a.Value))
+					b.WriteString(`"`)
+				}
+				if bytes.HasSuffix(data[start:end], []byte("/>")) {
+					b.WriteString("/>")
+				} else {
+					b.WriteString(">")
+				}
+				replacements = append(replacements, replacement{start, end, b.String()})
+			}
+		case xml.EndElement:
+			if len(open) == 0 || open[len(open)-1] != t.Name {
+				return nil, fmt.Errorf("%w: unexpected end element %s", ErrInvalidImage, qualifiedName(t.Name))
+			}
+			open = open[:len(open)-1]
+			if skipStart != -1 && depth == skipDepth {
+				replacements = append(replacements, replacement{skipStart, end, ""})
+				skipStart = -1
+			}
+			depth--
+		}
+	}
+	if !hasRoot {
+		return nil, fmt.Errorf("%w: not an SVG document", ErrInvalidImage)
+	}
+	if len(open) > 0 {
+		return nil, fmt.Errorf("%w: unclosed element %s", ErrInvalidImage, qualifiedName(open[len(open)-1]))
+	}
+	if len(replacements) == 0 {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	var pos int64
+	for _, r := range replacements {
+		buf.Write(data[pos:r.start])
+		buf.WriteString(r.text)
+		pos = r.end
+	}
+	buf.Write(data[pos:])
+	return buf.Bytes(), nil
+}
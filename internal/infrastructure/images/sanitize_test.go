@@ -0,0 +1,192 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestSanitizeSVG(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{
+			`<svg xmlns="http://www.w3.org/2000/svg"><circle r="5"/></svg>`,
+			`<svg xmlns="http://www.w3.org/2000/svg"><circle r="5"/></svg>`,
+		},
+		{
+			`<?xml version="1.0" encoding="UTF-8"?><svg><script>alert(1)</script><rect/></svg>`,
+			`<?xml version="1.0" encoding="UTF-8"?><svg><rect/></svg>`,
+		},
+		{
+			`<svg><foreignObject><iframe src="https://example.com"/></foreignObject></svg>`,
+			`<svg></svg>`,
+		},
+		{
+			`<svg onload="alert(1)"><rect onclick="alert(1)" width="10"/></svg>`,
+			`<svg><rect width="10"/></svg>`,
+		},
+		{
+			`<svg xmlns:xlink="http://www.w3.org/1999/xlink"><a xlink:href=" java&#9;script:alert(1)">x</a></svg>`,
+			`<svg xmlns:xlink="http://www.w3.org/1999/xlink"><a>x</a></svg>`,
+		},
+		{
+			`<svg><image href="data:image/svg+xml;base64,PHN2Zz4="/><image href="data:image/png;base64,iVBO"/></svg>`,
+			`<svg><image/><image href="data:image/png;base64,iVBO"/></svg>`,
+		},
+		{
+			`<svg><set attributeName="href" to="javascript:alert(1)"/></svg>`,
+			`<svg><set attributeName="href"/></svg>`,
+		},
+		{
+			`<?xml-stylesheet href="https://example.com/style.css"?><svg><rect/></svg>`,
+			`<svg><rect/></svg>`,
+		},
+		{
+			`<!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN" "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd"><svg/>`,
+			`<svg/>`,
+		},
+	}
+	for _, tt := range tests {
+		res, err := SanitizeSVG([]byte(tt.src))
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if string(res) != tt.expected {
+			t.Errorf("%s:\n got %s\n expected %s", tt.src, res, tt.expected)
+		}
+	}
+}
+
+func TestSanitizeSVGInvalid(t *testing.T) {
+	tests := []string{
+		`<html><script>alert(1)</script></html>`,
+		`<!DOCTYPE svg [<!ENTITY a "aaaaaaaaaa">]><svg>&a;</svg>`,
+		`<svg><rect></svg>`,
+		`not an image`,
+	}
+	for _, src := range tests {
+		if _, err := SanitizeSVG([]byte(src)); !errors.Is(err, ErrInvalidImage) {
+			t.Errorf("%s: expected invalid image error, got %v", src, err)
+		}
+	}
+}
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, x%h, color.RGBA{255, 0, 0, 255})
+	}
+	return img
+}
+
+func testGIF(t *testing.T, frames, w, h int) []byte {
+	g := &gif.GIF{}
+	palette := color.Palette{color.White, color.Black}
+	for i := 0; i < frames; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, w, h), palette))
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGIFFrames(t *testing.T) {
+	for _, n := range []int{1, 3, 20} {
+		frames, err := gifFrames(testGIF(t, n, 16, 8))
+		if err != nil || frames != n {
+			t.Errorf("got %d frames (%v), expected %d", frames, err, n)
+		}
+	}
+	data := testGIF(t, 2, 16, 8)
+	if _, err := gifFrames(data[:len(data)-10]); err == nil {
+		t.Error("expected error of truncated image")
+	}
+}
+
+func TestSanitizeGIF(t *testing.T) {
+	data := testGIF(t, 10, 20, 20)
+	res, name, err := Sanitize(data, "anim.GIF", 4000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "anim.gif" {
+		t.Errorf("unexpected filename: %s", name)
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(res))
+	if err != nil || len(g.Image) != 10 {
+		t.Errorf("animation frames were not preserved: %v", err)
+	}
+	// single frame fits the limit, but all frames don't
+	if _, _, err := Sanitize(data, "anim.gif", 3999); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("expected too large image error, got %v", err)
+	}
+}
+
+func TestSanitizeRaster(t *testing.T) {
+	var pngData, jpegData bytes.Buffer
+	if err := png.Encode(&pngData, testImage(30, 20)); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&jpegData, testImage(30, 20), nil); err != nil {
+		t.Fatal(err)
+	}
+	// trailing data (e.g. appended archive) is removed by re-encoding
+	polyglot := append(append([]byte{}, pngData.Bytes()...), []byte("<script>alert(1)</script>")...)
+	tests := []struct {
+		data     []byte
+		filename string
+		expected string
+		format   string
+	}{
+		{pngData.Bytes(), "image.png", "image.png", "png"},
+		{polyglot, "image.png", "image.png", "png"},
+		{jpegData.Bytes(), "photo.JPEG", "photo.jpeg", "jpeg"},
+		{jpegData.Bytes(), "photo.webp", "photo.jpg", "jpeg"},
+		// content is detected from the data, not the extension
+		{pngData.Bytes(), "image.jpg", "image.png", "png"},
+	}
+	for _, tt := range tests {
+		res, name, err := Sanitize(tt.data, tt.filename, 1000)
+		if err != nil {
+			t.Errorf("%s: %v", tt.filename, err)
+			continue
+		}
+		if name != tt.expected {
+			t.Errorf("%s: got filename %s, expected %s", tt.filename, name, tt.expected)
+		}
+		if _, format, err := image.DecodeConfig(bytes.NewReader(res)); err != nil || format != tt.format {
+			t.Errorf("%s: got format %s (%v), expected %s", tt.filename, format, err, tt.format)
+		}
+		if bytes.Contains(res, []byte("<script>")) {
+			t.Errorf("%s: embedded content was not removed", tt.filename)
+		}
+	}
+	if _, _, err := Sanitize(pngData.Bytes(), "image.png", 599); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("expected too large image error, got %v", err)
+	}
+	if _, _, err := Sanitize([]byte("<script>alert(1)</script>"), "image.png", 1000); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("expected invalid image error, got %v", err)
+	}
+	if IsImageFile("doc.pdf") || !IsImageFile("logo.SVG") {
+		t.Error("unexpected result of image file detection")
+	}
+	thumb, err := SanitizeThumbnail(pngData.Bytes(), 1000, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(thumb))
+	if err != nil || format != "jpeg" || cfg.Width > 10 || cfg.Height > 10 {
+		t.Errorf("invalid thumbnail: %s %dx%d (%v)", format, cfg.Width, cfg.Height, err)
+	}
+}
@@ -0,0 +1,145 @@
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	htmlCommentRegex = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlTagRegex     = regexp.MustCompile(`</?[a-zA-Z!?][^<>]*>`)
+	// complete tag or start of a tag split into multiple lines
+	tagRegex      = regexp.MustCompile(`</?[a-zA-Z!?]([^<>]*>)?`)
+	autolinkRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.\-]*:[^\s<>]*$`)
+	emailRegex    = regexp.MustCompile(`^[a-zA-Z0-9.!#$%&'*+/=?^_{|}~\-]+@[a-zA-Z0-9\-]+(\.[a-zA-Z0-9\-]+)*$`)
+	// inline link or image destination (destination in angle brackets can contain spaces)
+	linkRegex = regexp.MustCompile(`\]\(\s*(<[^<>\n]*>?|[^\s)>]*)`)
+	// link reference definition
+	linkRefRegex = regexp.MustCompile(`^(\s{0,3}\[[^\]]+\]:\s*)(<[^<>\n]*>?|\S*)(.*)$`)
+	// backslash escape of ASCII punctuation character
+	escapeRegex = regexp.MustCompile("\\\\([!-/:-@\\[-`{-~])")
+
+	plainLinkRegex = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	blockMarkRegex = regexp.MustCompile(`(?m)^\s{0,3}(#{1,6}\s+|>\s?|[*+\-]\s+)`)
+)
+
+var allowedSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+// Checks that the link is relative or uses allowed scheme (e.g. rejects javascript: links)
+func safeURL(rawURL string) bool {
+	// backslash escapes and character references are decoded by the Markdown renderer
+	// (repeated decoding is applied to be safe also in contexts with double decoding)
+	cleaned := escapeRegex.ReplaceAllString(rawURL, "$1")
+	for i := 0; i < 3; i++ {
+		unescaped := html.UnescapeString(cleaned)
+		if unescaped == cleaned {
+			break
+		}
+		cleaned = unescaped
+	}
+	// browsers ignore control characters and whitespace in the scheme
+	cleaned = strings.Map(func(r rune) rune {
+		if r <= ' ' || unicode.IsControl(r) || unicode.IsSpace(r) || r == '\uFEFF' || r == '\u200B' {
+			return -1
+		}
+		return r
+	}, cleaned)
+	u, err := url.Parse(cleaned)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "" || allowedSchemes[strings.ToLower(u.Scheme)]
+}
+
+// Returns link destination without angle brackets
+func linkDestination(dest string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+}
+
+func sanitizeText(text string) string {
+	text = tagRegex.ReplaceAllStringFunc(text, func(tag string) string {
+		if !strings.HasSuffix(tag, ">") {
+			return "&lt;" + tag[1:]
+		}
+		inner := tag[1 : len(tag)-1]
+		if (autolinkRegex.MatchString(inner) && safeURL(inner)) || emailRegex.MatchString(inner) {
+			return tag
+		}
+		return ""
+	})
+	return linkRegex.ReplaceAllStringFunc(text, func(link string) string {
+		m := linkRegex.FindStringSubmatch(link)
+		if safeURL(linkDestination(m[1])) {
+			return link
+		}
+		return strings.Replace(link, m[1], "#", 1)
+	})
+}
+
+// Sanitizes inline content of the line, code spans are kept untouched
+func sanitizeLine(line string) string {
+	if m := linkRefRegex.FindStringSubmatch(line); m != nil && !safeURL(linkDestination(m[2])) {
+		line = m[1] + "#" + m[3]
+	}
+	var b strings.Builder
+	for {
+		start := strings.Index(line, "`")
+		if start == -1 {
+			break
+		}
+		ticks := len(line[start:]) - len(strings.TrimLeft(line[start:], "`"))
+		end := strings.Index(line[start+ticks:], line[start:start+ticks])
+		if end == -1 {
+			break
+		}
+		end += start + 2*ticks
+		b.WriteString(sanitizeText(line[:start]))
+		b.WriteString(line[start:end])
+		line = line[end:]
+	}
+	b.WriteString(sanitizeText(line))
+	return b.String()
+}
+
+// Sanitize removes raw HTML and links with unsafe URL schemes from the Markdown text,
+// content of fenced code blocks and code spans is preserved
+func Sanitize(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = htmlCommentRegex.ReplaceAllString(src, "")
+	lines := strings.Split(src, "\n")
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if fence != "" {
+			rest := strings.TrimLeft(trimmed, fence[:1])
+			if len(trimmed)-len(rest) >= len(fence) && strings.TrimSpace(rest) == "" {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, trimmed[:1]))]
+			continue
+		}
+		lines[i] = sanitizeLine(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// PlainText returns text content of the sanitized Markdown (e.g. for metadata records)
+func PlainText(src string) string {
+	text := htmlTagRegex.ReplaceAllStringFunc(src, func(tag string) string {
+		inner := tag[1 : len(tag)-1]
+		if autolinkRegex.MatchString(inner) || emailRegex.MatchString(inner) {
+			return inner
+		}
+		return ""
+	})
+	text = plainLinkRegex.ReplaceAllString(text, "$1")
+	text = blockMarkRegex.ReplaceAllString(text, "")
+	text = strings.NewReplacer("**", "", "__", "", "`", "", "&lt;", "<").Replace(text)
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,112 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected bool
+	}{
+		{"https://gisquick.org", true},
+		{"HTTP://gisquick.org/a?b=c&amp;d=e", true},
+		{"mailto:info@gisquick.org", true},
+		{"//gisquick.org/docs", true},
+		{"/docs/page.html", true},
+		{"docs/page.html#section", true},
+		{"#top", true},
+		{"javascript:alert(1)", false},
+		{"JavaScript:alert(1)", false},
+		{"data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==", false},
+		{"vbscript:msgbox(1)", false},
+		{"file:///etc/passwd", false},
+		{"&#106;avascript:alert(1)", false},
+		{"&#x6A;avascript:alert(1)", false},
+		{"&#106avascript:alert(1)", false},
+		{"&#0000106avascript:alert(1)", false},
+		{"java&#x09;script:alert(1)", false},
+		{"java&#10;script:alert(1)", false},
+		{"java&Tab;script:alert(1)", false},
+		{"javascript&colon;alert(1)", false},
+		{"javascript&#58;alert(1)", false},
+		{"&amp;#106;avascript:alert(1)", false},
+		{"java\tscript:alert(1)", false},
+		{"java\x00script:alert(1)", false},
+		{" \x01javascript:alert(1)", false},
+		{"java\u200bscript:alert(1)", false},
+		{"javascript\\:alert(1)", false},
+		{"%zz", false},
+	}
+	for _, tt := range tests {
+		if res := safeURL(tt.url); res != tt.expected {
+			t.Errorf("%q: got %v, expected %v", tt.url, res, tt.expected)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"# Title\n\nText **bold**", "# Title\n\nText **bold**"},
+		{"[link](https://gisquick.org)", "[link](https://gisquick.org)"},
+		{"[link](javascript:alert(1))", "[link](#))"},
+		{"[link](&#106;avascript:alert(1))", "[link](#))"},
+		{"[link](java&#x09;script:alert(1))", "[link](#))"},
+		{"[link](< javascript:alert(1)>)", "[link](#)"},
+		{"[link](<java\tscript:alert(1)>)", "[link]()"},
+		{"[link](<https://gisquick.org/a%20b>)", "[link](<https://gisquick.org/a%20b>)"},
+		{"![img](data:image/svg+xml;base64,PHN2Zz4=)", "![img](#)"},
+		{"[ref]: javascript:alert(1) \"title\"", "[ref]: # \"title\""},
+		{"[ref]: &#106;avascript:alert(1)", "[ref]: #"},
+		{"[ref]: < javascript:alert(1)> 'title'", "[ref]: # 'title'"},
+		{"[ref]: <https://gisquick.org> 'title'", "[ref]: <https://gisquick.org> 'title'"},
+		{"<https://gisquick.org>", "<https://gisquick.org>"},
+		{"<info@gisquick.org>", "<info@gisquick.org>"},
+		{"<javascript:alert(1)>", ""},
+		{"<script>alert(1)</script>", "alert(1)"},
+		{"<img src=x onerror=alert(1)>", ""},
+		{"<a href=\"javascript:alert(1)\">x</a>", "x"},
+		{"<svg/onload=alert(1)>", ""},
+		{"<img src=x\nonerror=alert(1)>", "&lt;img src=x\nonerror=alert(1)>"},
+		{"<!-- <script>alert(1)</script> -->text", "text"},
+		{"`<script>` and ``[x](javascript:y)``", "`<script>` and ``[x](javascript:y)``"},
+		{"```\n<script>alert(1)</script>\n```\n<b>x</b>", "```\n<script>alert(1)</script>\n```\nx"},
+	}
+	for _, tt := range tests {
+		if res := Sanitize(tt.src); res != tt.expected {
+			t.Errorf("%q:\n got %q\n expected %q", tt.src, res, tt.expected)
+		}
+	}
+}
+
+func TestSanitizeRemovesScripts(t *testing.T) {
+	// no known vector should keep javascript scheme in the link destination
+	vectors := []string{
+		"[a](javascript:alert(1))",
+		"[a](JAVASCRIPT:alert(1))",
+		"[a](  javascript:alert(1))",
+		"[a](< java\tscript:alert(1)>)",
+		"[a](&#x6a;&#x61;&#x76;&#x61;&#x73;&#x63;&#x72;&#x69;&#x70;&#x74;&#x3a;alert(1))",
+		"[a](javascript\\:alert(1))",
+		"[a]: javascript:alert(1)\n\n[a]",
+		"<javascript:alert(1)>",
+	}
+	for _, v := range vectors {
+		res := strings.ToLower(Sanitize(v))
+		if strings.Contains(res, "alert(1)") && (strings.Contains(res, "script") || strings.Contains(res, "&#")) {
+			t.Errorf("%q: unsafe link was kept: %q", v, res)
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	src := "# Title\n\nSee [docs](https://gisquick.org) or <info@gisquick.org>, **bold** `code` &lt;tag>"
+	expected := "Title\n\nSee docs or info@gisquick.org, bold code <tag>"
+	if res := PlainText(src); res != expected {
+		t.Errorf("got %q, expected %q", res, expected)
+	}
+}
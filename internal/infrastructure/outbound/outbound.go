@@ -0,0 +1,65 @@
+// Package outbound configures connections to the external services (HTTP proxy and custom CA certificates)
+package outbound
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+type Config struct {
+	// proxy URLs, environment variables (HTTP_PROXY, HTTPS_PROXY, NO_PROXY) are used when not set
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+	// PEM file with additional trusted CA certificates
+	CABundle string
+}
+
+// RootCAs returns system certificates pool extended by the certificates from CA bundle (nil when not configured)
+func (c Config) RootCAs() (*x509.CertPool, error) {
+	if c.CABundle == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(c.CABundle)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no certificates found in CA bundle")
+	}
+	return pool, nil
+}
+
+// Transport returns HTTP transport with configured proxy and trusted certificates
+func (c Config) Transport() (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if c.HTTPProxy != "" || c.HTTPSProxy != "" {
+		proxy := (&httpproxy.Config{
+			HTTPProxy:  c.HTTPProxy,
+			HTTPSProxy: c.HTTPSProxy,
+			NoProxy:    c.NoProxy,
+		}).ProxyFunc()
+		t.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxy(req.URL)
+		}
+	}
+	rootCAs, err := c.RootCAs()
+	if err != nil {
+		return nil, err
+	}
+	if rootCAs != nil {
+		t.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+	}
+	return t, nil
+}
@@ -0,0 +1,770 @@
+package policy
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Small expression language (subset of the expr/CEL syntax) used for access rules.
+//
+// Supported syntax:
+//   literals:    123, 1.5, 'text', "text", true, false, nil, [1, 'a']
+//   members:     user.username, request.params["SERVICE"]
+//   logical:     !, not, &&, and, ||, or
+//   comparison:  ==, !=, <, <=, >, >=
+//   operators:   in, not in, contains, startsWith, endsWith, matches (regexp), +, -
+//   functions:   len(x), lower(s), upper(s)
+//
+// Access to missing member returns nil instead of an error.
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokPunct
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	runes := []rune(src)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, string(runes[start:i]), start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, string(runes[start:i]), start})
+		case r == '\'' || r == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						sb.WriteRune('\n')
+					case 't':
+						sb.WriteRune('\t')
+					default:
+						sb.WriteRune(runes[i])
+					}
+					continue
+				}
+				sb.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			tokens = append(tokens, token{tokString, sb.String(), start})
+		default:
+			if i+1 < len(runes) {
+				op := string(runes[i : i+2])
+				switch op {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					tokens = append(tokens, token{tokPunct, op, i})
+					i += 2
+					continue
+				}
+			}
+			if strings.ContainsRune("()[].,!<>+-", r) {
+				tokens = append(tokens, token{tokPunct, string(r), i})
+				i++
+				continue
+			}
+			return nil, fmt.Errorf("unexpected character '%c' at position %d", r, i)
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(runes)}), nil
+}
+
+type node interface {
+	eval(env map[string]interface{}) (interface{}, error)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) is(values ...string) bool {
+	t := p.peek()
+	if t.kind != tokPunct && t.kind != tokIdent {
+		return false
+	}
+	for _, v := range values {
+		if t.value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(value string) error {
+	t := p.next()
+	if t.value != value || (t.kind != tokPunct && t.kind != tokIdent) {
+		return fmt.Errorf("expected '%s' at position %d", value, t.pos)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("||", "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("&&", "and") {
+		p.next()
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if p.is("==", "!=", "<", "<=", ">", ">=", "in", "contains", "startsWith", "endsWith", "matches") {
+		op := p.next().value
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		n := &binaryNode{op: op, left: left, right: right}
+		if op == "matches" {
+			if lit, ok := right.(*literalNode); ok {
+				pattern, ok := lit.value.(string)
+				if !ok {
+					return nil, fmt.Errorf("matches operator requires string pattern")
+				}
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("invalid regular expression: %w", err)
+				}
+				n.re = re
+			}
+		}
+		return n, nil
+	}
+	if p.is("not") && p.tokens[p.pos+1].value == "in" {
+		p.pos += 2
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: "!", operand: &binaryNode{op: "in", left: left, right: right}}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("+", "-") {
+		op := p.next().value
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.is("!", "-") || (p.is("not") && p.tokens[p.pos+1].value != "in") {
+		op := p.next().value
+		if op == "not" {
+			op = "!"
+		}
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.is("."):
+			p.next()
+			t := p.next()
+			if t.kind != tokIdent {
+				return nil, fmt.Errorf("expected member name at position %d", t.pos)
+			}
+			n = &memberNode{object: n, property: &literalNode{value: t.value}}
+		case p.is("["):
+			p.next()
+			prop, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = &memberNode{object: n, property: prop}
+		case p.is("("):
+			ident, ok := n.(*identNode)
+			if !ok {
+				return nil, fmt.Errorf("invalid function call at position %d", p.peek().pos)
+			}
+			fn, ok := builtins[ident.name]
+			if !ok {
+				return nil, fmt.Errorf("unknown function: %s", ident.name)
+			}
+			p.next()
+			args, err := p.parseList(")")
+			if err != nil {
+				return nil, err
+			}
+			n = &callNode{name: ident.name, fn: fn, args: args}
+		default:
+			return n, nil
+		}
+	}
+}
+
+func (p *parser) parseList(end string) ([]node, error) {
+	var items []node
+	if p.is(end) {
+		p.next()
+		return items, nil
+	}
+	for {
+		item, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if p.is(",") {
+			p.next()
+			continue
+		}
+		if err := p.expect(end); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' at position %d", t.value, t.pos)
+		}
+		return &literalNode{value: v}, nil
+	case tokString:
+		return &literalNode{value: t.value}, nil
+	case tokIdent:
+		switch t.value {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "nil", "null":
+			return &literalNode{value: nil}, nil
+		}
+		return &identNode{name: t.value}, nil
+	case tokPunct:
+		switch t.value {
+		case "(":
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		case "[":
+			items, err := p.parseList("]")
+			if err != nil {
+				return nil, err
+			}
+			return &arrayNode{items: items}, nil
+		}
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected token '%s' at position %d", t.value, t.pos)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(env map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type identNode struct {
+	name string
+}
+
+func (n *identNode) eval(env map[string]interface{}) (interface{}, error) {
+	return normalize(env[n.name]), nil
+}
+
+type arrayNode struct {
+	items []node
+}
+
+func (n *arrayNode) eval(env map[string]interface{}) (interface{}, error) {
+	values := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+type memberNode struct {
+	object   node
+	property node
+}
+
+func (n *memberNode) eval(env map[string]interface{}) (interface{}, error) {
+	obj, err := n.object.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	prop, err := n.property.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		key, ok := prop.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid map key: %v", prop)
+		}
+		return normalize(o[key]), nil
+	case []interface{}:
+		index, ok := prop.(float64)
+		if !ok {
+			return nil, fmt.Errorf("invalid array index: %v", prop)
+		}
+		if int(index) < 0 || int(index) >= len(o) {
+			return nil, nil
+		}
+		return o[int(index)], nil
+	case nil:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("cannot access member of %T", obj)
+}
+
+type callNode struct {
+	name string
+	fn   func(args []interface{}) (interface{}, error)
+	args []node
+}
+
+func (n *callNode) eval(env map[string]interface{}) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := n.fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %w", n.name, err)
+	}
+	return v, nil
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n *unaryNode) eval(env map[string]interface{}) (interface{}, error) {
+	v, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "-" {
+		num, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("invalid operand of unary minus: %v", v)
+		}
+		return -num, nil
+	}
+	return !truthy(v), nil
+}
+
+type logicalNode struct {
+	op          string
+	left, right node
+}
+
+func (n *logicalNode) eval(env map[string]interface{}) (interface{}, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "||" && truthy(l) {
+		return true, nil
+	}
+	if n.op == "&&" && !truthy(l) {
+		return false, nil
+	}
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(r), nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+	re          *regexp.Regexp
+}
+
+func (n *binaryNode) eval(env map[string]interface{}) (interface{}, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "<", "<=", ">", ">=":
+		return compare(n.op, l, r)
+	case "in":
+		return contains(r, l), nil
+	case "contains":
+		return contains(l, r), nil
+	case "startsWith", "endsWith":
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		if !lok || !rok {
+			return false, nil
+		}
+		if n.op == "startsWith" {
+			return strings.HasPrefix(ls, rs), nil
+		}
+		return strings.HasSuffix(ls, rs), nil
+	case "matches":
+		ls, ok := l.(string)
+		if !ok {
+			return false, nil
+		}
+		re := n.re
+		if re == nil {
+			pattern, ok := r.(string)
+			if !ok {
+				return nil, fmt.Errorf("matches operator requires string pattern")
+			}
+			if re, err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid regular expression: %w", err)
+			}
+		}
+		return re.MatchString(ls), nil
+	case "+":
+		if ls, ok := l.(string); ok {
+			return ls + toString(r), nil
+		}
+		ln, lok := l.(float64)
+		rn, rok := r.(float64)
+		if !lok || !rok {
+			return nil, fmt.Errorf("invalid operands of '+': %v, %v", l, r)
+		}
+		return ln + rn, nil
+	case "-":
+		ln, lok := l.(float64)
+		rn, rok := r.(float64)
+		if !lok || !rok {
+			return nil, fmt.Errorf("invalid operands of '-': %v, %v", l, r)
+		}
+		return ln - rn, nil
+	}
+	return nil, fmt.Errorf("unknown operator: %s", n.op)
+}
+
+var builtins = map[string]func(args []interface{}) (interface{}, error){
+	"len": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument")
+		}
+		switch v := args[0].(type) {
+		case string:
+			return float64(len([]rune(v))), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		case map[string]interface{}:
+			return float64(len(v)), nil
+		case nil:
+			return float64(0), nil
+		}
+		return nil, fmt.Errorf("invalid argument type: %T", args[0])
+	},
+	"lower": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument")
+		}
+		return strings.ToLower(toString(args[0])), nil
+	},
+	"upper": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument")
+		}
+		return strings.ToUpper(toString(args[0])), nil
+	},
+}
+
+// Converts values from environment into basic types used by the evaluator
+// (float64, string, bool, nil, []interface{}, map[string]interface{})
+func normalize(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil, bool, string, float64, []interface{}, map[string]interface{}:
+		return v
+	case []string:
+		items := make([]interface{}, len(val))
+		for i, s := range val {
+			items[i] = s
+		}
+		return items
+	case map[string]string:
+		m := make(map[string]interface{}, len(val))
+		for k, s := range val {
+			m[k] = s
+		}
+		return m
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Slice, reflect.Array:
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = normalize(rv.Index(i).Interface())
+		}
+		return items
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			m := make(map[string]interface{}, rv.Len())
+			iter := rv.MapRange()
+			for iter.Next() {
+				m[iter.Key().String()] = iter.Value().Interface()
+			}
+			return m
+		}
+	}
+	return v
+}
+
+func truthy(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return val
+	case string:
+		return val != ""
+	case float64:
+		return val != 0
+	}
+	return true
+}
+
+func toString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func compare(op string, a, b interface{}) (interface{}, error) {
+	var c int
+	switch av := a.(type) {
+	case float64:
+		bv, ok := b.(float64)
+		if !ok {
+			return false, nil
+		}
+		if av < bv {
+			c = -1
+		} else if av > bv {
+			c = 1
+		}
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			return false, nil
+		}
+		c = strings.Compare(av, bv)
+	default:
+		return false, nil
+	}
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+func contains(collection, item interface{}) bool {
+	switch c := collection.(type) {
+	case []interface{}:
+		for _, v := range c {
+			if equal(v, item) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		key, ok := item.(string)
+		if ok {
+			_, ok = c[key]
+		}
+		return ok
+	case string:
+		s, ok := item.(string)
+		return ok && strings.Contains(c, s)
+	}
+	return false
+}
+
+// Expression is compiled expression ready for evaluation
+type Expression struct {
+	source string
+	root   node
+}
+
+func Compile(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected token '%s' at position %d", t.value, t.pos)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+func (e *Expression) Eval(env map[string]interface{}) (interface{}, error) {
+	return e.root.eval(env)
+}
+
+// EvalBool evaluates expression and converts result into boolean value
+func (e *Expression) EvalBool(env map[string]interface{}) (bool, error) {
+	v, err := e.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+	return truthy(v), nil
+}
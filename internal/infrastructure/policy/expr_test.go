@@ -0,0 +1,240 @@
+package policy
+
+import (
+	"testing"
+)
+
+var testEnv = map[string]interface{}{
+	"user": map[string]interface{}{
+		"username":         "alice",
+		"is_authenticated": true,
+		"is_superuser":     false,
+		"roles":            []interface{}{"editor", "viewer"},
+		"profile":          map[string]string{"department": "GIS"},
+	},
+	"request": map[string]interface{}{
+		"method": "GET",
+		"ip":     "10.0.0.5",
+		"params": map[string]interface{}{"SERVICE": "WMS", "REQUEST": "GetMap"},
+	},
+	"project": map[string]interface{}{
+		"name": "alice/parks",
+		"size": 2048,
+	},
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"user.username ==",
+		"(true",
+		"[1, 2",
+		"'unterminated",
+		"user.",
+		"true false",
+		"unknown(1)",
+		"user.username(1)",
+		"a # b",
+		"user.username matches '['",
+		"user.username matches 1",
+	}
+	for _, src := range tests {
+		if _, err := Compile(src); err == nil {
+			t.Errorf("%q: expected compile error", src)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{"1 + 2 - 4", float64(-1)},
+		{"-2 + 1", float64(-1)},
+		{"'a' + 1", "a1"},
+		{`"double" == 'double'`, true},
+		{"'it\\'s'", "it's"},
+		{"[1, 'a'][1]", "a"},
+		{"[1, 'a'][5]", nil},
+		{"user.username", "alice"},
+		{"user['username']", "alice"},
+		{"user.missing", nil},
+		{"user.missing.deeper", nil},
+		{"missing", nil},
+		{"user.profile.department", "GIS"},
+		{"request.params.SERVICE == 'WMS'", true},
+		{"request.params['REQUEST'] != 'GetMap'", false},
+		{"project.size > 1024", true},
+		{"project.size >= 2048 && project.size <= 2048", true},
+		{"'abc' < 'abd'", true},
+		{"'1' < 2", false},
+		{"'editor' in user.roles", true},
+		{"'admin' in user.roles", false},
+		{"'admin' not in user.roles", true},
+		{"user.roles contains 'viewer'", true},
+		{"'SERVICE' in request.params", true},
+		{"project.name startsWith 'alice/'", true},
+		{"project.name endsWith '/parks'", true},
+		{"request.ip matches '^10\\\\.'", true},
+		{"request.ip contains '0.0'", true},
+		{"len(user.roles)", float64(2)},
+		{"len(user.missing)", float64(0)},
+		{"lower(request.params.SERVICE)", "wms"},
+		{"upper(user.username)", "ALICE"},
+		{"nil == null", true},
+		{"!user.is_superuser", true},
+		{"not user.is_authenticated", false},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		v, err := e.Eval(testEnv)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if !equal(v, tt.expected) {
+			t.Errorf("%q: got %#v, expected %#v", tt.expr, v, tt.expected)
+		}
+	}
+}
+
+func TestOperatorPrecedence(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		// && binds tighter than ||
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"false && false || true", true},
+		{"true or false and false", true},
+		// comparison binds tighter than logical operators
+		{"1 == 1 && 2 == 2", true},
+		{"1 == 2 || 2 == 2", true},
+		// arithmetic binds tighter than comparison
+		{"1 + 1 == 2", true},
+		{"2 == 1 + 1", true},
+		{"5 - 2 - 1 == 2", true},
+		// unary operators bind tighter than everything else
+		{"!false && false", false},
+		{"!(false && false)", true},
+		{"not false or false", true},
+		{"!user.is_superuser && 'editor' in user.roles", true},
+		{"-1 + 2 == 1", true},
+		// leading 'not' is unary operator applied to the first operand
+		{"not 'admin' in user.roles", false},
+		{"not ('admin' in user.roles)", true},
+		// 'not in' is parsed as single operator
+		{"'admin' not in user.roles && user.is_authenticated", true},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		v, err := e.EvalBool(testEnv)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if v != tt.expected {
+			t.Errorf("%q: got %v, expected %v", tt.expr, v, tt.expected)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []string{
+		"user.username - 1",
+		"-user.username",
+		"user.roles.first",
+		"user[1]",
+		"user.roles['a']",
+		"len(1)",
+		"len(1, 2)",
+		"user.username matches user.roles",
+	}
+	for _, src := range tests {
+		e, err := Compile(src)
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+			continue
+		}
+		if _, err := e.EvalBool(testEnv); err == nil {
+			t.Errorf("%q: expected evaluation error", src)
+		}
+	}
+}
+
+func newTestPolicy(t *testing.T, rules ...Rule) *Policy {
+	p := &Policy{Rules: rules}
+	if err := p.compile(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	p := newTestPolicy(t,
+		Rule{Name: "broken", Target: TargetOWS, Effect: "allow", Condition: "request.params.SERVICE == 'WFS' && user.username - 1"},
+		Rule{Name: "superuser", Target: TargetProject, Effect: "allow", Condition: "user.is_superuser"},
+		Rule{Name: "internal", Target: TargetProject, Effect: "deny", Condition: "!(request.ip startsWith '10.')"},
+		Rule{Name: "wms", Target: TargetOWS, Effect: "allow", Condition: "request.params.SERVICE == 'WMS'"},
+	)
+	decision, rule, err := p.Evaluate(TargetProject, testEnv)
+	if decision != NoDecision || rule != nil || err != nil {
+		t.Errorf("project: got %v (%v, %v), expected no decision", decision, rule, err)
+	}
+	decision, rule, err = p.Evaluate(TargetOWS, testEnv)
+	if decision != Allow || rule == nil || rule.Name != "wms" || err != nil {
+		t.Errorf("ows: got %v (%v, %v), expected allow by 'wms' rule", decision, rule, err)
+	}
+
+	env := map[string]interface{}{
+		"user":    testEnv["user"],
+		"project": testEnv["project"],
+		"request": map[string]interface{}{
+			"ip":     "192.0.2.1",
+			"params": map[string]interface{}{"SERVICE": "WFS"},
+		},
+	}
+	decision, rule, _ = p.Evaluate(TargetProject, env)
+	if decision != Deny || rule.Name != "internal" {
+		t.Errorf("project: got %v (%v), expected deny by 'internal' rule", decision, rule)
+	}
+	// rules which cannot be evaluated deny the request, even when they are 'allow' rules
+	decision, rule, err = p.Evaluate(TargetOWS, env)
+	if decision != Deny || rule.Name != "broken" || err == nil {
+		t.Errorf("ows: got %v (%v, %v), expected deny with error", decision, rule, err)
+	}
+}
+
+func TestPolicyCompileErrors(t *testing.T) {
+	tests := []Rule{
+		{Name: "target", Target: "map", Effect: "allow", Condition: "true"},
+		{Name: "effect", Target: TargetOWS, Effect: "grant", Condition: "true"},
+		{Name: "condition", Target: TargetOWS, Effect: "deny", Condition: "user.username =="},
+	}
+	for _, r := range tests {
+		p := &Policy{Rules: []Rule{r}}
+		if err := p.compile(); err == nil {
+			t.Errorf("rule '%s': expected error", r.Name)
+		}
+	}
+}
+
+func TestNilPolicy(t *testing.T) {
+	var p *Policy
+	if p.HasRules(TargetOWS) {
+		t.Error("nil policy has rules")
+	}
+	if decision, _, err := p.Evaluate(TargetOWS, testEnv); decision != NoDecision || err != nil {
+		t.Errorf("nil policy: got %v (%v)", decision, err)
+	}
+}
@@ -0,0 +1,314 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Request hooks are functions written in Starlark (Python-like configuration language), which can
+// inspect and modify requests at defined points of the request processing. Hooks script defines
+// functions named by the hooks, which are called with single argument (context of the request
+// with the same variables as access policy rules):
+//
+//	pre_ows(ctx)    before the OWS request is sent to the map server, function can deny the request
+//	                or modify its query parameters (ctx.request.params dictionary)
+//	post_auth(ctx)  after the project access was resolved (ctx.access.granted), function can
+//	                override the decision
+//
+// Functions return None (no decision), allow() or deny(message="", status=0). Result of allow()
+// in pre_ows hook doesn't bypass layers permissions. Execution of the hooks is limited by the
+// number of execution steps and time.
+//
+//	def pre_ows(ctx):
+//	    if ctx.request.params.get("REQUEST") == "GetPrint" and not ctx.user.is_authenticated:
+//	        return deny("Printing is available only for registered users", 401)
+//	    ctx.request.params["DPI"] = "150"
+const (
+	HookPreOWS   = "pre_ows"
+	HookPostAuth = "post_auth"
+
+	DefaultHooksMaxSteps = 100000
+	DefaultHooksTimeout  = 100 * time.Millisecond
+)
+
+var hookNames = []string{HookPreOWS, HookPostAuth}
+
+type Hooks struct {
+	// limits of a single hook execution
+	MaxSteps uint64
+	Timeout  time.Duration
+	// output of the print function (discarded when nil)
+	Print func(msg string)
+
+	functions map[string]*starlark.Function
+}
+
+// HookResult is result of the hook function
+type HookResult struct {
+	Decision Decision
+	// response of the denied request (default is 403 Forbidden, or 401 for anonymous users)
+	Status  int
+	Message string
+	// new values of the parameters (names in upper case)
+	SetParams    map[string]string
+	RemoveParams []string
+}
+
+// Modified reports whether hook changed the request parameters
+func (r HookResult) Modified() bool {
+	return len(r.SetParams) > 0 || len(r.RemoveParams) > 0
+}
+
+var decisionConstructor = starlark.String("decision")
+
+func decisionBuiltin(effect string) *starlark.Builtin {
+	return starlark.NewBuiltin(effect, func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var message string
+		var status int
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "message?", &message, "status?", &status); err != nil {
+			return nil, err
+		}
+		if status != 0 && (status < 400 || status > 599) {
+			return nil, fmt.Errorf("%s: invalid status: %d", b.Name(), status)
+		}
+		return starlarkstruct.FromStringDict(decisionConstructor, starlark.StringDict{
+			"effect":  starlark.String(effect),
+			"message": starlark.String(message),
+			"status":  starlark.MakeInt(status),
+		}), nil
+	})
+}
+
+var hooksPredeclared = starlark.StringDict{
+	"allow": decisionBuiltin("allow"),
+	"deny":  decisionBuiltin("deny"),
+}
+
+func (h *Hooks) newThread(name string) (*starlark.Thread, func()) {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(_ *starlark.Thread, msg string) {
+			if h.Print != nil {
+				h.Print(msg)
+			}
+		},
+	}
+	// zero limits mean no limit
+	thread.SetMaxExecutionSteps(h.MaxSteps)
+	if h.Timeout <= 0 {
+		return thread, func() {}
+	}
+	timer := time.AfterFunc(h.Timeout, func() {
+		thread.Cancel("execution time limit exceeded")
+	})
+	return thread, func() { timer.Stop() }
+}
+
+// LoadHooks reads request hooks script
+func LoadHooks(path string) (*Hooks, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewHooks(path, src)
+}
+
+// NewHooks compiles hooks script with the default limits
+func NewHooks(filename string, src []byte) (*Hooks, error) {
+	h := &Hooks{MaxSteps: DefaultHooksMaxSteps, Timeout: DefaultHooksTimeout}
+	thread, stop := h.newThread("load")
+	defer stop()
+	globals, err := starlark.ExecFile(thread, filename, src, hooksPredeclared)
+	if err != nil {
+		return nil, fmt.Errorf("loading hooks script: %w", err)
+	}
+	// hooks are executed concurrently
+	globals.Freeze()
+	h.functions = make(map[string]*starlark.Function)
+	for _, name := range hookNames {
+		v, ok := globals[name]
+		if !ok {
+			continue
+		}
+		fn, ok := v.(*starlark.Function)
+		if !ok || fn.NumParams() != 1 {
+			return nil, fmt.Errorf("hook '%s' must be a function with single parameter", name)
+		}
+		h.functions[name] = fn
+	}
+	return h, nil
+}
+
+// HasRules reports whether the hook function is defined
+func (h *Hooks) HasRules(hook string) bool {
+	if h == nil {
+		return false
+	}
+	_, ok := h.functions[hook]
+	return ok
+}
+
+// Converts value of the environment into Starlark value
+func toStarlark(v interface{}) starlark.Value {
+	switch val := v.(type) {
+	case nil:
+		return starlark.None
+	case string:
+		return starlark.String(val)
+	case bool:
+		return starlark.Bool(val)
+	case int:
+		return starlark.MakeInt(val)
+	case int64:
+		return starlark.MakeInt64(val)
+	case float64:
+		return starlark.Float(val)
+	case []string:
+		items := make([]starlark.Value, len(val))
+		for i, item := range val {
+			items[i] = starlark.String(item)
+		}
+		return starlark.NewList(items)
+	case []interface{}:
+		items := make([]starlark.Value, len(val))
+		for i, item := range val {
+			items[i] = toStarlark(item)
+		}
+		return starlark.NewList(items)
+	case map[string]interface{}:
+		d := starlark.NewDict(len(val))
+		for k, item := range val {
+			d.SetKey(starlark.String(k), toStarlark(item))
+		}
+		return d
+	default:
+		return starlark.String(fmt.Sprint(val))
+	}
+}
+
+// Context of the hook, top level variables of the environment are structs (e.g. ctx.user.username)
+func hookContext(env map[string]interface{}) *starlarkstruct.Struct {
+	ctx := make(starlark.StringDict, len(env))
+	for name, v := range env {
+		if m, ok := v.(map[string]interface{}); ok {
+			fields := make(starlark.StringDict, len(m))
+			for k, item := range m {
+				fields[k] = toStarlark(item)
+			}
+			ctx[name] = starlarkstruct.FromStringDict(starlarkstruct.Default, fields)
+		} else {
+			ctx[name] = toStarlark(v)
+		}
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, ctx)
+}
+
+func paramValue(v starlark.Value) string {
+	if s, ok := starlark.AsString(v); ok {
+		return s
+	}
+	return v.String()
+}
+
+// Compares request parameters modified by the hook with the original parameters
+func paramsChanges(original map[string]interface{}, params *starlark.Dict, result *HookResult) error {
+	current := make(map[string]string, params.Len())
+	for _, item := range params.Items() {
+		name, ok := starlark.AsString(item[0])
+		if !ok {
+			return fmt.Errorf("invalid parameter name: %s", item[0])
+		}
+		current[strings.ToUpper(name)] = paramValue(item[1])
+	}
+	for name, value := range current {
+		if orig, ok := original[name]; !ok || fmt.Sprint(orig) != value {
+			if result.SetParams == nil {
+				result.SetParams = make(map[string]string)
+			}
+			result.SetParams[name] = value
+		}
+	}
+	for name := range original {
+		if _, ok := current[name]; !ok {
+			result.RemoveParams = append(result.RemoveParams, name)
+		}
+	}
+	sort.Strings(result.RemoveParams)
+	return nil
+}
+
+// Run calls the hook function. Modified parameters are updated in the request.params map
+// of the environment. Hooks which fail (including exceeded limits) deny the request.
+func (h *Hooks) Run(hook string, env map[string]interface{}) (HookResult, error) {
+	var result HookResult
+	if !h.HasRules(hook) {
+		return result, nil
+	}
+	ctx := hookContext(env)
+	thread, stop := h.newThread(hook)
+	defer stop()
+	v, err := starlark.Call(thread, h.functions[hook], starlark.Tuple{ctx}, nil)
+	if err != nil {
+		var evalErr *starlark.EvalError
+		if errors.As(err, &evalErr) {
+			err = errors.New(evalErr.Backtrace())
+		}
+		return HookResult{Decision: Deny}, fmt.Errorf("running hook '%s': %w", hook, err)
+	}
+
+	var params map[string]interface{}
+	if req, ok := env["request"].(map[string]interface{}); ok {
+		params, _ = req["params"].(map[string]interface{})
+	}
+	if params != nil {
+		reqValue, _ := ctx.Attr("request")
+		if reqStruct, ok := reqValue.(*starlarkstruct.Struct); ok {
+			if p, _ := reqStruct.Attr("params"); p != nil {
+				if d, ok := p.(*starlark.Dict); ok {
+					if err := paramsChanges(params, d, &result); err != nil {
+						return HookResult{Decision: Deny}, fmt.Errorf("running hook '%s': %w", hook, err)
+					}
+				}
+			}
+		}
+		if hook != HookPreOWS && result.Modified() {
+			return HookResult{Decision: Deny}, fmt.Errorf("running hook '%s': parameters can be modified only in %s hook", hook, HookPreOWS)
+		}
+		for name, value := range result.SetParams {
+			params[name] = value
+		}
+		for _, name := range result.RemoveParams {
+			delete(params, name)
+		}
+	}
+
+	switch d := v.(type) {
+	case starlark.NoneType:
+	case *starlarkstruct.Struct:
+		if d.Constructor() != decisionConstructor {
+			return HookResult{Decision: Deny}, fmt.Errorf("hook '%s' returned invalid value: %s", hook, v)
+		}
+		effect, _ := d.Attr("effect")
+		message, _ := d.Attr("message")
+		status, _ := d.Attr("status")
+		if effect == starlark.String("deny") {
+			result.Decision = Deny
+		} else {
+			result.Decision = Allow
+		}
+		result.Message, _ = starlark.AsString(message)
+		if s, err := starlark.AsInt32(status); err == nil {
+			result.Status = s
+		}
+	default:
+		return HookResult{Decision: Deny}, fmt.Errorf("hook '%s' returned invalid value: %s", hook, v)
+	}
+	return result, nil
+}
@@ -0,0 +1,154 @@
+package policy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func hooksEnv() map[string]interface{} {
+	return map[string]interface{}{
+		"user": map[string]interface{}{
+			"username":         "alice",
+			"is_authenticated": true,
+			"roles":            []interface{}{"editor"},
+		},
+		"request": map[string]interface{}{
+			"method": "GET",
+			"params": map[string]interface{}{"SERVICE": "WMS", "REQUEST": "GetPrint", "DPI": "300"},
+		},
+		"project": map[string]interface{}{"name": "alice/parks"},
+	}
+}
+
+const testHooksScript = `
+def pre_ows(ctx):
+    params = ctx.request.params
+    if params.get("REQUEST") == "GetFeatureInfo" and "editor" not in ctx.user.roles:
+        return deny("Not allowed", 401)
+    if params.get("REQUEST") == "GetPrint":
+        params["DPI"] = "150"
+        params["format"] = "pdf"
+        params.pop("SERVICE")
+    if ctx.project.name == "alice/public":
+        return allow()
+
+def post_auth(ctx):
+    if not ctx.access.granted and ctx.user.username == "alice":
+        return allow()
+`
+
+func TestHooksRun(t *testing.T) {
+	hooks, err := NewHooks("hooks.star", []byte(testHooksScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := hooksEnv()
+	res, err := hooks.Run(HookPreOWS, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Decision != NoDecision {
+		t.Errorf("unexpected decision: %v", res.Decision)
+	}
+	expectedSet := map[string]string{"DPI": "150", "FORMAT": "pdf"}
+	if !reflect.DeepEqual(res.SetParams, expectedSet) || !reflect.DeepEqual(res.RemoveParams, []string{"SERVICE"}) {
+		t.Errorf("unexpected params changes: %v %v", res.SetParams, res.RemoveParams)
+	}
+	expectedParams := map[string]interface{}{"REQUEST": "GetPrint", "DPI": "150", "FORMAT": "pdf"}
+	if params := env["request"].(map[string]interface{})["params"]; !reflect.DeepEqual(params, expectedParams) {
+		t.Errorf("request params were not updated: %v", params)
+	}
+
+	env = hooksEnv()
+	env["request"].(map[string]interface{})["params"] = map[string]interface{}{"REQUEST": "GetFeatureInfo"}
+	env["user"].(map[string]interface{})["roles"] = []interface{}{}
+	res, err = hooks.Run(HookPreOWS, env)
+	if err != nil || res.Decision != Deny || res.Status != 401 || res.Message != "Not allowed" {
+		t.Errorf("expected denied request, got %+v (%v)", res, err)
+	}
+
+	env = hooksEnv()
+	env["project"] = map[string]interface{}{"name": "alice/public"}
+	if res, err = hooks.Run(HookPreOWS, env); err != nil || res.Decision != Allow {
+		t.Errorf("expected allowed request, got %+v (%v)", res, err)
+	}
+
+	env = hooksEnv()
+	env["access"] = map[string]interface{}{"granted": false}
+	if res, err = hooks.Run(HookPostAuth, env); err != nil || res.Decision != Allow || res.Modified() {
+		t.Errorf("expected allowed request, got %+v (%v)", res, err)
+	}
+}
+
+func TestHooksErrors(t *testing.T) {
+	invalid := []string{
+		"def pre_ows(): pass",
+		"pre_ows = 1",
+		"x = 1 +",
+		"x = undefined",
+	}
+	for _, src := range invalid {
+		if _, err := NewHooks("hooks.star", []byte(src)); err == nil {
+			t.Errorf("%q: expected error", src)
+		}
+	}
+
+	failing := []struct {
+		hook string
+		src  string
+	}{
+		{HookPreOWS, "def pre_ows(ctx):\n    return 1/0"},
+		{HookPreOWS, "def pre_ows(ctx):\n    return True"},
+		{HookPreOWS, "def pre_ows(ctx):\n    return deny(status=200)"},
+		{HookPreOWS, "def pre_ows(ctx):\n    for i in range(1000000):\n        pass"},
+		{HookPostAuth, "def post_auth(ctx):\n    ctx.request.params['DPI'] = '72'"},
+	}
+	for _, tt := range failing {
+		hooks, err := NewHooks("hooks.star", []byte(tt.src))
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		res, err := hooks.Run(tt.hook, hooksEnv())
+		if err == nil || res.Decision != Deny {
+			t.Errorf("%q: expected denied request with error, got %+v", tt.src, res)
+		}
+	}
+}
+
+func TestHooksTimeout(t *testing.T) {
+	hooks, err := NewHooks("hooks.star", []byte("def pre_ows(ctx):\n    for i in range(1000000000):\n        pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks.MaxSteps = 0
+	hooks.Timeout = 10 * time.Millisecond
+	start := time.Now()
+	res, err := hooks.Run(HookPreOWS, hooksEnv())
+	if err == nil || !strings.Contains(err.Error(), "time limit") || res.Decision != Deny {
+		t.Errorf("expected time limit error, got %+v (%v)", res, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("hook was not cancelled")
+	}
+}
+
+func TestHooksUndefined(t *testing.T) {
+	var hooks *Hooks
+	if hooks.HasRules(HookPreOWS) {
+		t.Error("nil hooks should have no rules")
+	}
+	hooks, err := NewHooks("hooks.star", []byte("def post_auth(ctx):\n    pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hooks.HasRules(HookPreOWS) || !hooks.HasRules(HookPostAuth) {
+		t.Error("unexpected defined hooks")
+	}
+	if res, err := hooks.Run(HookPreOWS, hooksEnv()); err != nil || res.Decision != NoDecision {
+		t.Errorf("unexpected result of undefined hook: %+v (%v)", res, err)
+	}
+}
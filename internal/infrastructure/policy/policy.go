@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type Decision int
+
+const (
+	// No rule matched, static access settings are used
+	NoDecision Decision = iota
+	// Rule exempts the request from the following deny rules, static access settings
+	// and permissions are still applied
+	Allow
+	Deny
+)
+
+const (
+	TargetProject = "project"
+	TargetOWS     = "ows"
+)
+
+type Rule struct {
+	Name      string `json:"name"`
+	Target    string `json:"target"` // "project" or "ows"
+	Effect    string `json:"effect"` // "allow" or "deny"
+	Condition string `json:"condition"`
+	expr      *Expression
+}
+
+// Policy is ordered list of access rules, the first rule with matching condition decides
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+func (p *Policy) compile() error {
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Target != TargetProject && r.Target != TargetOWS {
+			return fmt.Errorf("rule '%s': invalid target: %s", r.Name, r.Target)
+		}
+		if r.Effect != "allow" && r.Effect != "deny" {
+			return fmt.Errorf("rule '%s': invalid effect: %s", r.Name, r.Effect)
+		}
+		expr, err := Compile(r.Condition)
+		if err != nil {
+			return fmt.Errorf("rule '%s': %w", r.Name, err)
+		}
+		r.expr = expr
+	}
+	return nil
+}
+
+// LoadPolicy reads policy rules from JSON file
+func LoadPolicy(path string) (*Policy, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := json.Unmarshal(content, &p); err != nil {
+		return nil, fmt.Errorf("parsing policy file: %w", err)
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// HasRules reports whether policy contains any rule for the given target
+func (p *Policy) HasRules(target string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Rules {
+		if r.Target == target {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate returns decision of the first matching rule of the given target. Rules which
+// cannot be evaluated (e.g. type errors) are treated as matching deny rules.
+func (p *Policy) Evaluate(target string, env map[string]interface{}) (Decision, *Rule, error) {
+	if p == nil {
+		return NoDecision, nil, nil
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Target != target {
+			continue
+		}
+		match, err := r.expr.EvalBool(env)
+		if err != nil {
+			return Deny, r, fmt.Errorf("evaluating rule '%s': %w", r.Name, err)
+		}
+		if match {
+			if r.Effect == "allow" {
+				return Allow, r, nil
+			}
+			return Deny, r, nil
+		}
+	}
+	return NoDecision, nil, nil
+}
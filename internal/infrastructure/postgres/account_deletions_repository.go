@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type AccountDeletion struct {
+	Username  string    `db:"username"`
+	Requested time.Time `db:"requested_at"`
+	Scheduled time.Time `db:"scheduled_at"`
+}
+
+func (d AccountDeletion) toDomain() domain.AccountDeletion {
+	return domain.AccountDeletion{Username: d.Username, Requested: d.Requested, Scheduled: d.Scheduled}
+}
+
+type AccountDeletionsRepository struct {
+	db *sqlx.DB
+}
+
+func NewAccountDeletionsRepository(db *sqlx.DB) *AccountDeletionsRepository {
+	return &AccountDeletionsRepository{db: db}
+}
+
+// Schedule creates or replaces scheduled deletion of the account
+func (r *AccountDeletionsRepository) Schedule(deletion domain.AccountDeletion) error {
+	_, err := r.db.Exec(
+		`INSERT INTO account_deletions (username, requested_at, scheduled_at) VALUES ($1, $2, $3)
+		ON CONFLICT (username) DO UPDATE SET requested_at=EXCLUDED.requested_at, scheduled_at=EXCLUDED.scheduled_at`,
+		deletion.Username, deletion.Requested, deletion.Scheduled,
+	)
+	return err
+}
+
+func (r *AccountDeletionsRepository) Get(username string) (domain.AccountDeletion, error) {
+	var row AccountDeletion
+	if err := r.db.Get(&row, "SELECT * FROM account_deletions WHERE username=$1", username); err != nil {
+		if err == sql.ErrNoRows {
+			return domain.AccountDeletion{}, domain.ErrAccountDeletionNotFound
+		}
+		return domain.AccountDeletion{}, err
+	}
+	return row.toDomain(), nil
+}
+
+func (r *AccountDeletionsRepository) Cancel(username string) error {
+	res, err := r.db.Exec("DELETE FROM account_deletions WHERE username=$1", username)
+	if err != nil {
+		return err
+	}
+	if count, err := res.RowsAffected(); err == nil && count == 0 {
+		return domain.ErrAccountDeletionNotFound
+	}
+	return nil
+}
+
+func (r *AccountDeletionsRepository) Due(t time.Time) ([]domain.AccountDeletion, error) {
+	var rows []AccountDeletion
+	if err := r.db.Select(&rows, "SELECT * FROM account_deletions WHERE scheduled_at <= $1 ORDER BY scheduled_at", t); err != nil {
+		return nil, err
+	}
+	deletions := make([]domain.AccountDeletion, len(rows))
+	for i, row := range rows {
+		deletions[i] = row.toDomain()
+	}
+	return deletions, nil
+}
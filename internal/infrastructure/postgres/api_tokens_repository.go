@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type APIToken struct {
+	ID       string       `db:"id"`
+	Username string       `db:"username"`
+	Name     string       `db:"name"`
+	Hash     string       `db:"token_hash"`
+	Created  time.Time    `db:"created_at"`
+	Expires  sql.NullTime `db:"expires_at"`
+	LastUsed sql.NullTime `db:"last_used_at"`
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func (t APIToken) toDomain() domain.APIToken {
+	return domain.APIToken{
+		ID:       t.ID,
+		Username: t.Username,
+		Name:     t.Name,
+		Created:  t.Created,
+		Expires:  timePtr(t.Expires),
+		LastUsed: timePtr(t.LastUsed),
+	}
+}
+
+type APITokensRepository struct {
+	db *sqlx.DB
+}
+
+func NewAPITokensRepository(db *sqlx.DB) *APITokensRepository {
+	return &APITokensRepository{db: db}
+}
+
+func (r *APITokensRepository) Create(token domain.APIToken, hash string) error {
+	_, err := r.db.NamedExec(
+		`INSERT INTO api_tokens (id, username, name, token_hash, created_at, expires_at, last_used_at)
+		VALUES (:id, :username, :name, :token_hash, :created_at, :expires_at, :last_used_at)`,
+		&APIToken{
+			ID:       token.ID,
+			Username: token.Username,
+			Name:     token.Name,
+			Hash:     hash,
+			Created:  token.Created,
+			Expires:  nullTime(token.Expires),
+			LastUsed: nullTime(token.LastUsed),
+		},
+	)
+	return err
+}
+
+func (r *APITokensRepository) List(username string) ([]domain.APIToken, error) {
+	var rows []APIToken
+	if err := r.db.Select(&rows, "SELECT * FROM api_tokens WHERE username=$1 ORDER BY created_at", username); err != nil {
+		return nil, err
+	}
+	tokens := make([]domain.APIToken, len(rows))
+	for i, row := range rows {
+		tokens[i] = row.toDomain()
+	}
+	return tokens, nil
+}
+
+func (r *APITokensRepository) GetByHash(hash string) (domain.APIToken, error) {
+	var row APIToken
+	if err := r.db.Get(&row, "SELECT * FROM api_tokens WHERE token_hash=$1", hash); err != nil {
+		if err == sql.ErrNoRows {
+			return domain.APIToken{}, domain.ErrAPITokenNotFound
+		}
+		return domain.APIToken{}, err
+	}
+	return row.toDomain(), nil
+}
+
+func (r *APITokensRepository) Delete(username, id string) error {
+	res, err := r.db.Exec("DELETE FROM api_tokens WHERE username=$1 AND id=$2", username, id)
+	if err != nil {
+		return err
+	}
+	if count, err := res.RowsAffected(); err == nil && count == 0 {
+		return domain.ErrAPITokenNotFound
+	}
+	return nil
+}
+
+func (r *APITokensRepository) UpdateLastUsed(id string, t time.Time) error {
+	_, err := r.db.Exec("UPDATE api_tokens SET last_used_at=$1 WHERE id=$2", t, id)
+	return err
+}
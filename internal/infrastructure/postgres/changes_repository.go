@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type AttributesList []string
+
+func (a *AttributesList) Scan(val any) error {
+	if val == nil {
+		return nil
+	}
+	switch v := val.(type) {
+	case []byte:
+		return json.Unmarshal(v, a)
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	default:
+		return fmt.Errorf("unsupported type: %T", v)
+	}
+}
+
+func (a AttributesList) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	return json.Marshal(a)
+}
+
+type LayerChange struct {
+	Seq        int64          `db:"seq"`
+	Project    string         `db:"project"`
+	Layer      string         `db:"layer"`
+	Action     string         `db:"action"`
+	FeatureID  string         `db:"feature_id"`
+	Username   string         `db:"username"`
+	Attributes AttributesList `db:"attributes"`
+	Created    time.Time      `db:"created_at"`
+}
+
+type LayerChangesRepository struct {
+	db *sqlx.DB
+}
+
+func NewLayerChangesRepository(db *sqlx.DB) *LayerChangesRepository {
+	return &LayerChangesRepository{db}
+}
+
+func (r *LayerChangesRepository) Add(changes ...domain.LayerChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	rows := make([]LayerChange, len(changes))
+	for i, c := range changes {
+		rows[i] = LayerChange{
+			Project:    c.Project,
+			Layer:      c.Layer,
+			Action:     c.Action,
+			FeatureID:  c.FeatureID,
+			Username:   c.User,
+			Attributes: c.Attributes,
+			Created:    c.Time,
+		}
+	}
+	_, err := r.db.NamedExec(
+		`INSERT INTO layer_changes (project, layer, action, feature_id, username, attributes, created_at)
+		VALUES (:project, :layer, :action, :feature_id, :username, :attributes, :created_at)`,
+		rows,
+	)
+	return err
+}
+
+// List returns changes of the layer with sequence number greater than 'since' and created after 'sinceTime'
+func (r *LayerChangesRepository) List(project, layer string, since int64, sinceTime time.Time, limit int) ([]domain.LayerChange, error) {
+	var rows []LayerChange
+	err := r.db.Select(
+		&rows,
+		`SELECT * FROM layer_changes WHERE project=$1 AND layer=$2 AND seq>$3 AND created_at>$4 ORDER BY seq LIMIT $5`,
+		project, layer, since, sinceTime, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]domain.LayerChange, len(rows))
+	for i, row := range rows {
+		changes[i] = domain.LayerChange{
+			Seq:        row.Seq,
+			Project:    row.Project,
+			Layer:      row.Layer,
+			Action:     row.Action,
+			FeatureID:  row.FeatureID,
+			User:       row.Username,
+			Attributes: row.Attributes,
+			Time:       row.Created,
+		}
+	}
+	return changes, nil
+}
+
+func (r *LayerChangesRepository) DeleteProject(project string) error {
+	_, err := r.db.Exec("DELETE FROM layer_changes WHERE project=$1", project)
+	return err
+}
@@ -0,0 +1,165 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jackc/pgconn"
+	"github.com/jmoiron/sqlx"
+)
+
+type Group struct {
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	Created     time.Time `db:"created_at"`
+}
+
+type GroupsRepository struct {
+	db *sqlx.DB
+}
+
+func NewGroupsRepository(db *sqlx.DB) *GroupsRepository {
+	return &GroupsRepository{db: db}
+}
+
+func (r *GroupsRepository) members() (map[string][]string, error) {
+	var rows []struct {
+		Group    string `db:"group_name"`
+		Username string `db:"username"`
+	}
+	if err := r.db.Select(&rows, "SELECT group_name, username FROM group_members ORDER BY username"); err != nil {
+		return nil, err
+	}
+	members := make(map[string][]string)
+	for _, row := range rows {
+		members[row.Group] = append(members[row.Group], row.Username)
+	}
+	return members, nil
+}
+
+func (r *GroupsRepository) List() ([]domain.Group, error) {
+	var rows []Group
+	if err := r.db.Select(&rows, "SELECT * FROM user_groups ORDER BY name"); err != nil {
+		return nil, err
+	}
+	members, err := r.members()
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]domain.Group, len(rows))
+	for i, row := range rows {
+		groups[i] = domain.Group{
+			Name:        row.Name,
+			Description: row.Description,
+			Created:     row.Created,
+			Members:     members[row.Name],
+		}
+		if groups[i].Members == nil {
+			groups[i].Members = []string{}
+		}
+	}
+	return groups, nil
+}
+
+func (r *GroupsRepository) Get(name string) (domain.Group, error) {
+	var row Group
+	if err := r.db.Get(&row, "SELECT * FROM user_groups WHERE name=$1", name); err != nil {
+		if err == sql.ErrNoRows {
+			return domain.Group{}, domain.ErrGroupNotFound
+		}
+		return domain.Group{}, err
+	}
+	members := []string{}
+	if err := r.db.Select(&members, "SELECT username FROM group_members WHERE group_name=$1 ORDER BY username", name); err != nil {
+		return domain.Group{}, err
+	}
+	return domain.Group{Name: row.Name, Description: row.Description, Created: row.Created, Members: members}, nil
+}
+
+func (r *GroupsRepository) Create(group domain.Group) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("INSERT INTO user_groups (name, description, created_at) VALUES ($1, $2, $3)", group.Name, group.Description, group.Created)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // UniqueViolation
+			return domain.ErrGroupExists
+		}
+		return err
+	}
+	if err := insertGroupMembers(tx, group.Name, group.Members); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *GroupsRepository) Update(name string, description string) error {
+	res, err := r.db.Exec("UPDATE user_groups SET description=$1 WHERE name=$2", description, name)
+	if err != nil {
+		return err
+	}
+	if count, err := res.RowsAffected(); err == nil && count == 0 {
+		return domain.ErrGroupNotFound
+	}
+	return nil
+}
+
+func (r *GroupsRepository) Delete(name string) error {
+	res, err := r.db.Exec("DELETE FROM user_groups WHERE name=$1", name)
+	if err != nil {
+		return err
+	}
+	if count, err := res.RowsAffected(); err == nil && count == 0 {
+		return domain.ErrGroupNotFound
+	}
+	return nil
+}
+
+func insertGroupMembers(tx *sqlx.Tx, name string, usernames []string) error {
+	for _, username := range usernames {
+		if _, err := tx.Exec("INSERT INTO group_members (group_name, username) VALUES ($1, $2) ON CONFLICT DO NOTHING", name, username); err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23503" { // ForeignKeyViolation
+				return domain.ErrAccountNotFound
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMembers replaces members of the group
+func (r *GroupsRepository) SetMembers(name string, usernames []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var locked string
+	if err := tx.Get(&locked, "SELECT name FROM user_groups WHERE name=$1 FOR UPDATE", name); err != nil {
+		if err == sql.ErrNoRows {
+			return domain.ErrGroupNotFound
+		}
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM group_members WHERE group_name=$1", name); err != nil {
+		return err
+	}
+	if err := insertGroupMembers(tx, name, usernames); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *GroupsRepository) UserGroups(username string) ([]string, error) {
+	groups := []string{}
+	if err := r.db.Select(&groups, "SELECT group_name FROM group_members WHERE username=$1 ORDER BY group_name", username); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jackc/pgconn"
+	"github.com/jmoiron/sqlx"
+)
+
+type Identity struct {
+	Issuer   string    `db:"issuer"`
+	Subject  string    `db:"subject"`
+	Username string    `db:"username"`
+	Created  time.Time `db:"created_at"`
+}
+
+func (i Identity) toDomain() domain.Identity {
+	return domain.Identity{Issuer: i.Issuer, Subject: i.Subject, Username: i.Username, Created: i.Created}
+}
+
+type IdentitiesRepository struct {
+	db *sqlx.DB
+}
+
+func NewIdentitiesRepository(db *sqlx.DB) *IdentitiesRepository {
+	return &IdentitiesRepository{db: db}
+}
+
+func (r *IdentitiesRepository) Get(issuer, subject string) (domain.Identity, error) {
+	var row Identity
+	if err := r.db.Get(&row, "SELECT * FROM user_identities WHERE issuer=$1 AND subject=$2", issuer, subject); err != nil {
+		if err == sql.ErrNoRows {
+			return domain.Identity{}, domain.ErrIdentityNotFound
+		}
+		return domain.Identity{}, err
+	}
+	return row.toDomain(), nil
+}
+
+func (r *IdentitiesRepository) Create(identity domain.Identity) error {
+	_, err := r.db.Exec(
+		"INSERT INTO user_identities (issuer, subject, username, created_at) VALUES ($1, $2, $3, $4)",
+		identity.Issuer, identity.Subject, identity.Username, identity.Created,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case "23505": // UniqueViolation
+				return domain.ErrIdentityExists
+			case "23503": // ForeignKeyViolation
+				return domain.ErrAccountNotFound
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *IdentitiesRepository) Delete(issuer, subject string) error {
+	res, err := r.db.Exec("DELETE FROM user_identities WHERE issuer=$1 AND subject=$2", issuer, subject)
+	if err != nil {
+		return err
+	}
+	if count, err := res.RowsAffected(); err == nil && count == 0 {
+		return domain.ErrIdentityNotFound
+	}
+	return nil
+}
+
+func (r *IdentitiesRepository) UserIdentities(username string) ([]domain.Identity, error) {
+	var rows []Identity
+	if err := r.db.Select(&rows, "SELECT * FROM user_identities WHERE username=$1 ORDER BY created_at", username); err != nil {
+		return nil, err
+	}
+	identities := make([]domain.Identity, len(rows))
+	for i, row := range rows {
+		identities[i] = row.toDomain()
+	}
+	return identities, nil
+}
@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type Invitation struct {
+	ID        string         `db:"id"`
+	Email     string         `db:"email"`
+	Role      string         `db:"role"`
+	Hash      string         `db:"token_hash"`
+	InvitedBy string         `db:"invited_by"`
+	Created   time.Time      `db:"created_at"`
+	Expires   time.Time      `db:"expires_at"`
+	Accepted  sql.NullTime   `db:"accepted_at"`
+	Username  sql.NullString `db:"username"`
+}
+
+func (i Invitation) toDomain() domain.Invitation {
+	return domain.Invitation{
+		ID:        i.ID,
+		Email:     i.Email,
+		Role:      i.Role,
+		InvitedBy: i.InvitedBy,
+		Created:   i.Created,
+		Expires:   i.Expires,
+		Accepted:  timePtr(i.Accepted),
+		Username:  i.Username.String,
+	}
+}
+
+type InvitationsRepository struct {
+	db *sqlx.DB
+}
+
+func NewInvitationsRepository(db *sqlx.DB) *InvitationsRepository {
+	return &InvitationsRepository{db: db}
+}
+
+func (r *InvitationsRepository) Create(invitation domain.Invitation, hash string) error {
+	_, err := r.db.NamedExec(
+		`INSERT INTO invitations (id, email, role, token_hash, invited_by, created_at, expires_at)
+		VALUES (:id, :email, :role, :token_hash, :invited_by, :created_at, :expires_at)`,
+		&Invitation{
+			ID:        invitation.ID,
+			Email:     invitation.Email,
+			Role:      invitation.Role,
+			Hash:      hash,
+			InvitedBy: invitation.InvitedBy,
+			Created:   invitation.Created,
+			Expires:   invitation.Expires,
+		},
+	)
+	return err
+}
+
+func (r *InvitationsRepository) List() ([]domain.Invitation, error) {
+	var rows []Invitation
+	if err := r.db.Select(&rows, "SELECT * FROM invitations ORDER BY created_at DESC"); err != nil {
+		return nil, err
+	}
+	invitations := make([]domain.Invitation, len(rows))
+	for i, row := range rows {
+		invitations[i] = row.toDomain()
+	}
+	return invitations, nil
+}
+
+func (r *InvitationsRepository) GetByHash(hash string) (domain.Invitation, error) {
+	var row Invitation
+	if err := r.db.Get(&row, "SELECT * FROM invitations WHERE token_hash=$1", hash); err != nil {
+		if err == sql.ErrNoRows {
+			return domain.Invitation{}, domain.ErrInvitationNotFound
+		}
+		return domain.Invitation{}, err
+	}
+	return row.toDomain(), nil
+}
+
+// SetAccepted marks pending invitation as accepted, returns ErrInvitationNotFound when
+// the invitation was already accepted or deleted
+func (r *InvitationsRepository) SetAccepted(id, username string, t time.Time) error {
+	res, err := r.db.Exec("UPDATE invitations SET accepted_at=$1, username=$2 WHERE id=$3 AND accepted_at IS NULL", t, username, id)
+	if err != nil {
+		return err
+	}
+	if count, err := res.RowsAffected(); err == nil && count == 0 {
+		return domain.ErrInvitationNotFound
+	}
+	return nil
+}
+
+func (r *InvitationsRepository) Delete(id string) error {
+	res, err := r.db.Exec("DELETE FROM invitations WHERE id=$1", id)
+	if err != nil {
+		return err
+	}
+	if count, err := res.RowsAffected(); err == nil && count == 0 {
+		return domain.ErrInvitationNotFound
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+const listenerPingInterval = 90 * time.Second
+
+// NotificationHandler is called for every received notification. Empty channel
+// name means that connection was re-established and some notifications could be lost.
+type NotificationHandler func(channel, payload string)
+
+// Listener receives notifications (LISTEN/NOTIFY) from the configured channels
+type Listener struct {
+	log      *zap.SugaredLogger
+	dsn      string
+	channels []string
+}
+
+func NewListener(log *zap.SugaredLogger, dsn string, channels []string) *Listener {
+	return &Listener{log: log, dsn: dsn, channels: channels}
+}
+
+// Listen blocks until the context is cancelled. Connection is automatically re-established when lost.
+func (l *Listener) Listen(ctx context.Context, handler NotificationHandler) error {
+	listener := pq.NewListener(l.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventConnectionAttemptFailed:
+			l.log.Warnw("postgres listener connection attempt failed", zap.Error(err))
+		case pq.ListenerEventDisconnected:
+			l.log.Warnw("postgres listener disconnected", zap.Error(err))
+		case pq.ListenerEventReconnected:
+			l.log.Infow("postgres listener reconnected")
+		}
+	})
+	defer listener.Close()
+
+	for _, ch := range l.channels {
+		if err := listener.Listen(ch); err != nil {
+			return fmt.Errorf("listening on channel %s: %w", ch, err)
+		}
+	}
+	l.log.Infow("postgres listener started", "channels", l.channels)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			if n == nil {
+				handler("", "")
+				continue
+			}
+			handler(n.Channel, n.Extra)
+		case <-time.After(listenerPingInterval):
+			if err := listener.Ping(); err != nil {
+				l.log.Warnw("postgres listener ping", zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/security"
+	"github.com/jmoiron/sqlx"
+)
+
+type ProjectSecret struct {
+	Project string    `db:"project"`
+	Name    string    `db:"name"`
+	Data    []byte    `db:"data"`
+	Created time.Time `db:"created_at"`
+	Updated time.Time `db:"updated_at"`
+}
+
+// ProjectSecretsRepository stores project's connection secrets encrypted
+type ProjectSecretsRepository struct {
+	db     *sqlx.DB
+	cipher *security.Cipher
+}
+
+func NewProjectSecretsRepository(db *sqlx.DB, cipher *security.Cipher) *ProjectSecretsRepository {
+	return &ProjectSecretsRepository{db: db, cipher: cipher}
+}
+
+func (r *ProjectSecretsRepository) decode(s ProjectSecret) (domain.ConnectionSecret, error) {
+	var secret domain.ConnectionSecret
+	data, err := r.cipher.Decrypt(s.Data)
+	if err != nil {
+		return secret, fmt.Errorf("decrypting project secret %s: %w", s.Name, err)
+	}
+	if err := json.Unmarshal(data, &secret); err != nil {
+		return secret, fmt.Errorf("decoding project secret %s: %w", s.Name, err)
+	}
+	secret.Name = s.Name
+	return secret, nil
+}
+
+func (r *ProjectSecretsRepository) List(project string) ([]domain.ConnectionSecret, error) {
+	var rows []ProjectSecret
+	if err := r.db.Select(&rows, "SELECT * FROM project_secrets WHERE project=$1 ORDER BY name", project); err != nil {
+		return nil, err
+	}
+	secrets := make([]domain.ConnectionSecret, len(rows))
+	for i, row := range rows {
+		secret, err := r.decode(row)
+		if err != nil {
+			return nil, err
+		}
+		secrets[i] = secret
+	}
+	return secrets, nil
+}
+
+func (r *ProjectSecretsRepository) Get(project, name string) (domain.ConnectionSecret, error) {
+	var row ProjectSecret
+	if err := r.db.Get(&row, "SELECT * FROM project_secrets WHERE project=$1 AND name=$2", project, name); err != nil {
+		if err == sql.ErrNoRows {
+			return domain.ConnectionSecret{}, domain.ErrSecretNotFound
+		}
+		return domain.ConnectionSecret{}, err
+	}
+	return r.decode(row)
+}
+
+func (r *ProjectSecretsRepository) Save(project string, secret domain.ConnectionSecret) error {
+	data, err := json.Marshal(secret)
+	if err != nil {
+		return err
+	}
+	encrypted, err := r.cipher.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("encrypting project secret: %w", err)
+	}
+	now := time.Now().UTC()
+	_, err = r.db.NamedExec(
+		`INSERT INTO project_secrets (project, name, data, created_at, updated_at)
+		VALUES (:project, :name, :data, :created_at, :updated_at)
+		ON CONFLICT (project, name) DO UPDATE SET data=EXCLUDED.data, updated_at=EXCLUDED.updated_at`,
+		&ProjectSecret{Project: project, Name: secret.Name, Data: encrypted, Created: now, Updated: now},
+	)
+	return err
+}
+
+func (r *ProjectSecretsRepository) Delete(project, name string) error {
+	res, err := r.db.Exec("DELETE FROM project_secrets WHERE project=$1 AND name=$2", project, name)
+	if err != nil {
+		return err
+	}
+	if count, err := res.RowsAffected(); err == nil && count == 0 {
+		return domain.ErrSecretNotFound
+	}
+	return nil
+}
+
+func (r *ProjectSecretsRepository) DeleteAll(project string) error {
+	_, err := r.db.Exec("DELETE FROM project_secrets WHERE project=$1", project)
+	return err
+}
+
+// RotateKeys re-encrypts all stored secrets with the current master key.
+// Returns number of updated secrets.
+func (r *ProjectSecretsRepository) RotateKeys() (int, error) {
+	var rows []ProjectSecret
+	if err := r.db.Select(&rows, "SELECT * FROM project_secrets"); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, row := range rows {
+		data, changed, err := r.cipher.Rotate(row.Data)
+		if err != nil {
+			return count, fmt.Errorf("rotating key of project secret %s/%s: %w", row.Project, row.Name, err)
+		}
+		if !changed {
+			continue
+		}
+		_, err = r.db.Exec(
+			"UPDATE project_secrets SET data=$1, updated_at=$2 WHERE project=$3 AND name=$4",
+			data, time.Now().UTC(), row.Project, row.Name,
+		)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
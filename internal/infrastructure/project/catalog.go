@@ -0,0 +1,60 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const catalogStatusKey = "catalog_status"
+
+// Status of the project metadata record in the external catalog
+type CatalogStatus struct {
+	Identifier string    `json:"identifier"`
+	Published  bool      `json:"published"`
+	Updated    time.Time `json:"updated"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// RedisCatalogStatus keeps status of metadata records published into the external catalog
+type RedisCatalogStatus struct {
+	log *zap.SugaredLogger
+	rdb *redis.Client
+}
+
+func NewRedisCatalogStatus(log *zap.SugaredLogger, rdb *redis.Client) *RedisCatalogStatus {
+	return &RedisCatalogStatus{log: log, rdb: rdb}
+}
+
+// Get returns status of the project record (nil when the project was never published)
+func (s *RedisCatalogStatus) Get(ctx context.Context, project string) (*CatalogStatus, error) {
+	data, err := s.rdb.HGet(ctx, catalogStatusKey, project).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("redis get catalog status: %w", err)
+	}
+	status := new(CatalogStatus)
+	if err := json.Unmarshal(data, status); err != nil {
+		return nil, fmt.Errorf("parsing catalog status: %w", err)
+	}
+	return status, nil
+}
+
+func (s *RedisCatalogStatus) Set(ctx context.Context, project string, status CatalogStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return s.rdb.HSet(ctx, catalogStatusKey, project, data).Err()
+}
+
+func (s *RedisCatalogStatus) Remove(ctx context.Context, project string) error {
+	return s.rdb.HDel(ctx, catalogStatusKey, project).Err()
+}
@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -78,7 +79,10 @@ func (fi *FilesIndex) TotalSize() int64 {
 	defer fi.RUnlock()
 	size := int64(0)
 	for _, info := range fi.Index {
-		size += info.Size
+		// library files are accounted separately
+		if !info.Shared {
+			size += info.Size
+		}
 	}
 	return size
 }
@@ -90,6 +94,9 @@ type DiskStorage struct {
 	configCache       *cache.DataCache[string, json.RawMessage]
 	projectInfoReader JsonFilesReader[domain.ProjectInfo]
 	settingsReader    JsonFilesReader[domain.ProjectSettings]
+	grantsCache       *ttlcache.Cache[string, []domain.AccessGrant]
+	sharedMu          sync.Mutex
+	grantsMu          sync.Mutex
 }
 
 type Info struct {
@@ -146,6 +153,7 @@ func Checksum(path string) (string, error) {
 
 type JsonFilesReader[T any] interface {
 	Get(filename string) (T, error)
+	Metrics() ttlcache.Metrics
 	Close()
 }
 
@@ -223,6 +231,11 @@ func NewDiskStorage(log *zap.SugaredLogger, projectsRoot string) *DiskStorage {
 	go indexCache.Start()
 	ds.settingsReader = cache.NewJSONFileReader[domain.ProjectSettings](time.Hour)
 	ds.projectInfoReader = cache.NewJSONFileReader[domain.ProjectInfo](time.Hour)
+	ds.grantsCache = ttlcache.New(
+		ttlcache.WithTTL[string, []domain.AccessGrant](time.Hour),
+		ttlcache.WithDisableTouchOnHit[string, []domain.AccessGrant](),
+	)
+	go ds.grantsCache.Start()
 	return ds
 }
 
@@ -571,6 +584,7 @@ func (s *DiskStorage) Delete(name string) error {
 	if err := os.RemoveAll(dest); err != nil {
 		return err
 	}
+	s.grantsCache.Delete(name)
 	return nil
 }
 
@@ -597,12 +611,13 @@ func saveToFile(src io.Reader, filename string) (err error) {
 	return nil
 }
 
+// Saves content into temporary file which then atomically replaces the destination file
 func saveToFile2(src io.Reader, filename string) (h string, err error) {
 	err = os.MkdirAll(filepath.Dir(filename), 0775)
 	if err != nil {
 		return
 	}
-	file, err := os.Create(filename)
+	file, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
 	if err != nil {
 		return
 	}
@@ -617,12 +632,18 @@ func saveToFile2(src io.Reader, filename string) (h string, err error) {
 	sha := sha1.New()
 	dest := io.MultiWriter(file, sha)
 
-	if _, err := io.Copy(dest, src); err != nil {
+	if _, err = io.Copy(dest, src); err != nil {
 		return "", err
 	}
+	if err = file.Chmod(0664); err != nil {
+		return
+	}
 	if err = file.Close(); err != nil {
 		return
 	}
+	if err = os.Rename(file.Name(), filename); err != nil {
+		return
+	}
 	hash := fmt.Sprintf("%x", sha.Sum(nil))
 	return hash, nil
 }
@@ -633,6 +654,28 @@ func (s *DiskStorage) CreateFile(projectName, directory, pattern string, r io.Re
 		err = domain.ErrProjectNotExists
 		return
 	}
+	if directory != "" {
+		if directory, err = NormalizePath(directory); err != nil {
+			return
+		}
+	}
+	// file name can contain client's path (e.g. C:\fakepath\image.png)
+	if pattern, err = NormalizePath(pattern); err != nil {
+		return
+	}
+	pattern = path.Base(pattern)
+	placeholders := strings.NewReplacer("<timestamp>", "0", "<random>", "0", "<hash>", "0")
+	if pattern == placeholders.Replace(pattern) {
+		var index *FilesIndex
+		if index, err = s.filesIndex(projectName); err != nil {
+			return
+		}
+		if err = checkPathsCollisions(remainingFiles(index, nil), []string{path.Join(directory, pattern)}); err != nil {
+			return
+		}
+	} else if err = checkPortablePath(path.Join(directory, placeholders.Replace(pattern))); err != nil {
+		return
+	}
 	destDir := filepath.Join(s.ProjectsRoot, projectName, directory)
 	err = os.MkdirAll(destDir, 0775)
 	if err != nil {
@@ -711,6 +754,10 @@ func (s *DiskStorage) CreateFile(projectName, directory, pattern string, r io.Re
 }
 
 func (s *DiskStorage) SaveFile(project string, finfo domain.ProjectFile, path string) error {
+	path, err := NormalizePath(path)
+	if err != nil {
+		return err
+	}
 	absPath := filepath.Join(s.ProjectsRoot, project, path)
 	if err := os.MkdirAll(filepath.Dir(absPath), 0775); err != nil {
 		return err
@@ -763,6 +810,35 @@ func (s *DiskStorage) SaveThumbnail(projectName string, r io.Reader) error {
 	return nil
 }
 
+func (s *DiskStorage) GetDescription(projectName string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "description.md"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Saves project description (Markdown), empty text removes the description
+func (s *DiskStorage) SaveDescription(projectName string, text string) error {
+	if !s.CheckProjectExists(projectName) {
+		return domain.ErrProjectNotExists
+	}
+	descPath := filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "description.md")
+	if text == "" {
+		if err := os.Remove(descPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("removing description file: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(descPath, []byte(text), 0644); err != nil {
+		return fmt.Errorf("saving description file: %w", err)
+	}
+	return nil
+}
+
 // func (s *DiskStorage) filesIndex1(projectName string) ([]domain.ProjectFile, error) {
 // 	var files []domain.ProjectFile
 // 	if !s.CheckProjectExists(projectName) {
@@ -848,7 +924,23 @@ func (s *DiskStorage) UpdateFiles(projectName string, info domain.FilesChanges,
 	if err != nil {
 		return nil, err
 	}
-	updateFiles := info.Updates
+	updateFiles, err := normalizeProjectFiles(info.Updates)
+	if err != nil {
+		return nil, err
+	}
+	removes := make([]string, len(info.Removes))
+	for i, path := range info.Removes {
+		if removes[i], err = NormalizePath(path); err != nil {
+			return nil, fmt.Errorf("removing file/directory %s: %w", path, err)
+		}
+	}
+	paths := make([]string, len(updateFiles))
+	for i, f := range updateFiles {
+		paths[i] = f.Path
+	}
+	if err := checkPathsCollisions(remainingFiles(index, removes), paths); err != nil {
+		return nil, err
+	}
 
 	// i := 0
 	// for {
@@ -873,7 +965,7 @@ func (s *DiskStorage) UpdateFiles(projectName string, info domain.FilesChanges,
 			return nil, fmt.Errorf("reading upload files stream: %w", err)
 		}
 		declaredInfo := updateFiles[i]
-		if declaredInfo.Path != path {
+		if path, err = NormalizePath(path); err != nil || declaredInfo.Path != path {
 			return nil, err // TODO: more graceful error handling
 		}
 		absPath := filepath.Join(s.ProjectsRoot, projectName, path)
@@ -909,7 +1001,7 @@ func (s *DiskStorage) UpdateFiles(projectName string, info domain.FilesChanges,
 		// s.log.Infow("saving file", "path", absPath, "hash", calcHash, "hashMatch", declaredInfo.Hash == calcHash, "cmtime", declaredInfo.Mtime.Local(), "smtime", fStat.ModTime())
 		index.Set(path, finfo)
 	}
-	for _, path := range info.Removes {
+	for _, path := range removes {
 		absPath := filepath.Join(s.ProjectsRoot, projectName, path)
 		info, err := os.Lstat(absPath)
 		if err != nil {
@@ -972,9 +1064,114 @@ func (s *DiskStorage) UpdateSettings(projectName string, data json.RawMessage) e
 	if err := s.saveConfigFile(projectName, "project.json", project); err != nil {
 		return fmt.Errorf("updating project file: %w", err)
 	}
+	s.updateSymbology(projectName, project.QgisFile)
+	return nil
+}
+
+// Saves initial settings of a new project (before the first publishing), existing settings are kept
+func (s *DiskStorage) InitSettings(projectName string, data json.RawMessage) error {
+	project, err := s.GetProjectInfo(projectName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(s.GetSettingsPath(projectName)); err == nil {
+		return nil
+	}
+	var sInfo SettingsInfo
+	if err := json.Unmarshal(data, &sInfo); err != nil {
+		return fmt.Errorf("extracting authentication settings: %w", err)
+	}
+	if err := s.saveConfigFile(projectName, "settings.json", data); err != nil {
+		return fmt.Errorf("saving settings file: %w", err)
+	}
+	if sInfo.Auth.Type != "" {
+		project.Authentication = sInfo.Auth.Type
+		if err := s.saveConfigFile(projectName, "project.json", project); err != nil {
+			return fmt.Errorf("updating project file: %w", err)
+		}
+	}
 	return nil
 }
 
+// Changes access level of the project, other settings (including users and roles) are preserved
+func (s *DiskStorage) UpdateAuthentication(projectName, authType string) error {
+	project, err := s.GetProjectInfo(projectName)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(s.GetSettingsPath(projectName))
+	if err != nil {
+		return fmt.Errorf("reading settings file: %w", err)
+	}
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return fmt.Errorf("parsing settings file: %w", err)
+	}
+	auth := make(map[string]json.RawMessage)
+	if data, ok := settings["auth"]; ok {
+		if err := json.Unmarshal(data, &auth); err != nil {
+			return fmt.Errorf("parsing authentication settings: %w", err)
+		}
+	}
+	if auth["type"], err = json.Marshal(authType); err != nil {
+		return err
+	}
+	if settings["auth"], err = json.Marshal(auth); err != nil {
+		return err
+	}
+	if err := s.saveConfigFile(projectName, "settings.json", settings); err != nil {
+		return fmt.Errorf("saving settings file: %w", err)
+	}
+	project.Authentication = authType
+	if err := s.saveConfigFile(projectName, "project.json", project); err != nil {
+		return fmt.Errorf("updating project file: %w", err)
+	}
+	return nil
+}
+
+func (s *DiskStorage) UpdateState(projectName, state string) error {
+	project, err := s.GetProjectInfo(projectName)
+	if err != nil {
+		return err
+	}
+	project.State = state
+	project.LastUpdate = time.Now().UTC()
+	if err := s.saveConfigFile(projectName, "project.json", project); err != nil {
+		return fmt.Errorf("updating project file: %w", err)
+	}
+	return nil
+}
+
+// Extracts layers symbology from the QGIS project file (failure doesn't prevent publishing)
+func (s *DiskStorage) updateSymbology(projectName, qgisFile string) {
+	if qgisFile == "" {
+		return
+	}
+	symbology, err := parseSymbologyFile(filepath.Join(s.ProjectsRoot, projectName, qgisFile))
+	if err != nil {
+		s.log.Errorw("extracting layers symbology", "project", projectName, zap.Error(err))
+		return
+	}
+	if err := s.saveConfigFile(projectName, "symbology.json", symbology); err != nil {
+		s.log.Errorw("saving layers symbology", "project", projectName, zap.Error(err))
+	}
+}
+
+func (s *DiskStorage) GetSymbology(projectName string) (map[string]domain.LayerSymbology, error) {
+	symbology := make(map[string]domain.LayerSymbology)
+	data, err := os.ReadFile(filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "symbology.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return symbology, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &symbology); err != nil {
+		return nil, err
+	}
+	return symbology, nil
+}
+
 func (s *DiskStorage) GetSettings(projectName string) (domain.ProjectSettings, error) {
 	var settings domain.ProjectSettings
 	data, err := s.settingsReader.Get(s.GetSettingsPath(projectName))
@@ -1017,6 +1214,32 @@ func (s *DiskStorage) UpdateMeta(projectName string, meta json.RawMessage) error
 	return s.saveConfigFile(projectName, "project.json", pInfo)
 }
 
+// ConfigVersion returns hash derived from modification times of files used to build the map config
+func (s *DiskStorage) ConfigVersion(projectName string) (string, error) {
+	files := []string{
+		filepath.Join(".gisquick", "project.json"),
+		filepath.Join(".gisquick", "qgis.json"),
+		filepath.Join(".gisquick", "settings.json"),
+		filepath.Join(".gisquick", "symbology.json"),
+		filepath.Join(".gisquick", "styles.json"),
+		filepath.Join(".gisquick", "scripts.json"),
+		filepath.Join(".gisquick", "grants.json"),
+		filepath.Join("web", "app", "config.json"),
+	}
+	h := sha1.New()
+	for _, f := range files {
+		finfo, err := os.Stat(filepath.Join(s.ProjectsRoot, projectName, f))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return "", err
+		}
+		fmt.Fprintf(h, "%s:%d:%d;", f, finfo.ModTime().UnixNano(), finfo.Size())
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:16], nil
+}
+
 func (s *DiskStorage) GetScripts(projectName string) (domain.Scripts, error) {
 	file := filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "scripts.json")
 	content, err := os.ReadFile(file)
@@ -1035,11 +1258,25 @@ func (s *DiskStorage) UpdateScripts(projectName string, scripts domain.Scripts)
 	return s.saveConfigFile(projectName, "scripts.json", scripts)
 }
 
+func cacheStats(m ttlcache.Metrics) domain.CacheStats {
+	return domain.CacheStats{Hits: m.Hits, Misses: m.Misses}
+}
+
+func (s *DiskStorage) CacheStats() map[string]domain.CacheStats {
+	return map[string]domain.CacheStats{
+		"files_index":   cacheStats(s.indexCache.Metrics()),
+		"settings":      cacheStats(s.settingsReader.Metrics()),
+		"project_info":  cacheStats(s.projectInfoReader.Metrics()),
+		"access_grants": cacheStats(s.grantsCache.Metrics()),
+	}
+}
+
 func (s *DiskStorage) Close() {
 	s.settingsReader.Close()
 	s.projectInfoReader.Close()
 	s.indexCache.Stop()
 	s.indexCache.DeleteAll()
+	s.grantsCache.Stop()
 }
 
 func (s *DiskStorage) GetProjectCustomizations(projectName string) (json.RawMessage, error) {
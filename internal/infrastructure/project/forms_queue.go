@@ -0,0 +1,146 @@
+package project
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	formsQueueKey = "forms_queue"
+	// submissions claimed by the worker (server instance) are moved into its processing list
+	formsProcessingPrefix = "forms_queue:processing:"
+	// lease of the worker, submissions of the workers with expired lease are returned into the queue
+	formsWorkerPrefix = "forms_queue:worker:"
+	formsWorkerLease  = 5 * time.Minute
+)
+
+// Form submission waiting for the map server to become available
+type QueuedSubmission struct {
+	Project     string    `json:"project"`
+	Layer       string    `json:"layer"`
+	User        string    `json:"user,omitempty"`
+	Transaction []byte    `json:"transaction"` // WFS-T request body
+	Attachments []string  `json:"attachments,omitempty"`
+	Created     time.Time `json:"created"`
+	// raw value of the item in the processing list
+	raw string
+}
+
+// RedisFormsQueue is reliable queue shared by all server instances, submissions are claimed
+// by moving them into the processing list of the worker and removed after they are processed
+type RedisFormsQueue struct {
+	log    *zap.SugaredLogger
+	rdb    *redis.Client
+	worker string
+}
+
+func NewRedisFormsQueue(log *zap.SugaredLogger, rdb *redis.Client) *RedisFormsQueue {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &RedisFormsQueue{log: log, rdb: rdb, worker: hex.EncodeToString(id)}
+}
+
+func (q *RedisFormsQueue) processingKey() string {
+	return formsProcessingPrefix + q.worker
+}
+
+func (q *RedisFormsQueue) Push(ctx context.Context, item QueuedSubmission) error {
+	value, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err := q.rdb.RPush(ctx, formsQueueKey, value).Err(); err != nil {
+		return fmt.Errorf("redis push form submission: %w", err)
+	}
+	return nil
+}
+
+// Claim atomically moves the oldest queued submission into the processing list of the worker,
+// returns nil when the queue is empty. Claimed submission must be acknowledged (Ack) or returned
+// into the queue (Release).
+func (q *RedisFormsQueue) Claim(ctx context.Context) (*QueuedSubmission, error) {
+	if err := q.rdb.Set(ctx, formsWorkerPrefix+q.worker, time.Now().Unix(), formsWorkerLease).Err(); err != nil {
+		return nil, fmt.Errorf("redis set forms worker lease: %w", err)
+	}
+	value, err := q.rdb.LMove(ctx, formsQueueKey, q.processingKey(), "LEFT", "RIGHT").Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("redis claim form submission: %w", err)
+	}
+	var item QueuedSubmission
+	if err := json.Unmarshal([]byte(value), &item); err != nil {
+		q.log.Errorw("parsing queued form submission", zap.Error(err))
+		// drop invalid item
+		if err := q.rdb.LRem(ctx, q.processingKey(), 1, value).Err(); err != nil {
+			return nil, fmt.Errorf("redis remove form submission: %w", err)
+		}
+		return q.Claim(ctx)
+	}
+	item.raw = value
+	return &item, nil
+}
+
+// Ack removes processed submission from the processing list
+func (q *RedisFormsQueue) Ack(ctx context.Context, item *QueuedSubmission) error {
+	if err := q.rdb.LRem(ctx, q.processingKey(), 1, item.raw).Err(); err != nil {
+		return fmt.Errorf("redis remove form submission: %w", err)
+	}
+	return nil
+}
+
+// Release returns claimed submission to the head of the queue
+func (q *RedisFormsQueue) Release(ctx context.Context, item *QueuedSubmission) error {
+	_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, q.processingKey(), 1, item.raw)
+		pipe.LPush(ctx, formsQueueKey, item.raw)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("redis release form submission: %w", err)
+	}
+	return nil
+}
+
+// Recover returns submissions claimed by the workers with expired lease (e.g. stopped server
+// instances) and by this worker (not finished before restart) into the queue
+func (q *RedisFormsQueue) Recover(ctx context.Context) error {
+	iter := q.rdb.Scan(ctx, 0, formsProcessingPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		worker := key[len(formsProcessingPrefix):]
+		if worker != q.worker {
+			exists, err := q.rdb.Exists(ctx, formsWorkerPrefix+worker).Result()
+			if err != nil {
+				return fmt.Errorf("redis get forms worker lease: %w", err)
+			}
+			if exists > 0 {
+				continue
+			}
+		}
+		for {
+			// the newest item is returned first, so the original order is preserved
+			err := q.rdb.LMove(ctx, key, formsQueueKey, "RIGHT", "LEFT").Err()
+			if err == redis.Nil {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("redis recover form submissions: %w", err)
+			}
+			q.log.Warnw("form submission returned into the queue", "worker", worker)
+		}
+	}
+	return iter.Err()
+}
+
+func (q *RedisFormsQueue) Len(ctx context.Context) (int64, error) {
+	return q.rdb.LLen(ctx, formsQueueKey).Result()
+}
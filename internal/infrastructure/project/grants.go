@@ -0,0 +1,89 @@
+package project
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jellydator/ttlcache/v3"
+)
+
+// Access grants are stored in separate file (not in the settings), so they are not affected by
+// publishing of the project settings. Grants are cached in memory and the cache is updated
+// on every write (under grantsMu), so revoked grants apply immediately.
+
+func (s *DiskStorage) accessGrantsPath(projectName string) string {
+	return filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "grants.json")
+}
+
+func copyAccessGrants(grants []domain.AccessGrant) []domain.AccessGrant {
+	return append([]domain.AccessGrant{}, grants...)
+}
+
+// Reads access grants of the project, caller must hold grantsMu
+func (s *DiskStorage) loadAccessGrants(projectName string) ([]domain.AccessGrant, error) {
+	if item := s.grantsCache.Get(projectName); item != nil {
+		return copyAccessGrants(item.Value()), nil
+	}
+	grants := []domain.AccessGrant{}
+	content, err := os.ReadFile(s.accessGrantsPath(projectName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(content, &grants); err != nil {
+			return nil, fmt.Errorf("parsing access grants file: %w", err)
+		}
+	}
+	s.grantsCache.Set(projectName, copyAccessGrants(grants), ttlcache.DefaultTTL)
+	return grants, nil
+}
+
+// Writes access grants of the project, caller must hold grantsMu
+func (s *DiskStorage) storeAccessGrants(projectName string, grants []domain.AccessGrant) error {
+	// cached grants are not valid after failed write
+	s.grantsCache.Delete(projectName)
+	if len(grants) == 0 {
+		if err := os.Remove(s.accessGrantsPath(projectName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	} else if err := saveJsonFile(s.accessGrantsPath(projectName), grants); err != nil {
+		return err
+	}
+	s.grantsCache.Set(projectName, copyAccessGrants(grants), ttlcache.DefaultTTL)
+	return nil
+}
+
+func (s *DiskStorage) GetAccessGrants(projectName string) ([]domain.AccessGrant, error) {
+	if item := s.grantsCache.Get(projectName); item != nil {
+		return copyAccessGrants(item.Value()), nil
+	}
+	s.grantsMu.Lock()
+	defer s.grantsMu.Unlock()
+	return s.loadAccessGrants(projectName)
+}
+
+func (s *DiskStorage) SaveAccessGrants(projectName string, grants []domain.AccessGrant) error {
+	s.grantsMu.Lock()
+	defer s.grantsMu.Unlock()
+	return s.storeAccessGrants(projectName, grants)
+}
+
+// UpdateAccessGrants atomically modifies access grants of the project. Update function returns
+// new grants and whether they should be saved.
+func (s *DiskStorage) UpdateAccessGrants(projectName string, update func(grants []domain.AccessGrant) ([]domain.AccessGrant, bool)) (bool, error) {
+	s.grantsMu.Lock()
+	defer s.grantsMu.Unlock()
+	grants, err := s.loadAccessGrants(projectName)
+	if err != nil {
+		return false, err
+	}
+	grants, changed := update(grants)
+	if !changed {
+		return false, nil
+	}
+	return true, s.storeAccessGrants(projectName, grants)
+}
@@ -0,0 +1,131 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	projectLockTTL   = 30 * time.Second
+	projectLockRetry = 200 * time.Millisecond
+)
+
+// deletes the lock only when it's still owned by the caller
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1], KEYS[2])
+end
+return 0
+`)
+
+// extends expiration of the lock only when it's still owned by the caller
+var refreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[2], ARGV[2])
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// RedisProjectLocks implements distributed project locks, so multiple server replicas
+// don't modify the same project at once. Locks are held with a short TTL, which is
+// periodically extended until the lock is released (or the server dies).
+type RedisProjectLocks struct {
+	log   *zap.SugaredLogger
+	rdb   *redis.Client
+	owner string
+	// max time to wait for the lock
+	timeout time.Duration
+}
+
+func NewRedisProjectLocks(log *zap.SugaredLogger, rdb *redis.Client, timeout time.Duration) *RedisProjectLocks {
+	owner, _ := os.Hostname()
+	return &RedisProjectLocks{log: log, rdb: rdb, owner: owner, timeout: timeout}
+}
+
+func lockKey(projectName string) string {
+	return fmt.Sprintf("project:%s:lock", projectName)
+}
+
+func lockInfoKey(projectName string) string {
+	return fmt.Sprintf("project:%s:lock_info", projectName)
+}
+
+func (l *RedisProjectLocks) lockInfo(ctx context.Context, projectName string) domain.ProjectLock {
+	var info domain.ProjectLock
+	data, err := l.rdb.Get(ctx, lockInfoKey(projectName)).Bytes()
+	if err == nil {
+		if err := json.Unmarshal(data, &info); err != nil {
+			l.log.Warnw("parsing project lock info", "project", projectName, zap.Error(err))
+		}
+	}
+	return info
+}
+
+func (l *RedisProjectLocks) Lock(ctx context.Context, projectName, operation string) (func(), error) {
+	token := uuid.Must(uuid.NewV4()).String()
+	info, err := json.Marshal(domain.ProjectLock{Operation: operation, Owner: l.owner, Since: time.Now().UTC()})
+	if err != nil {
+		return nil, err
+	}
+	key := lockKey(projectName)
+	infoKey := lockInfoKey(projectName)
+	deadline := time.Now().Add(l.timeout)
+	for {
+		ok, err := l.rdb.SetNX(ctx, key, token, projectLockTTL).Result()
+		if err != nil {
+			return nil, fmt.Errorf("acquiring project lock: %w", err)
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, &domain.ProjectLockedError{Project: projectName, Lock: l.lockInfo(ctx, projectName)}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(projectLockRetry):
+		}
+	}
+	if err := l.rdb.Set(ctx, infoKey, info, projectLockTTL).Err(); err != nil {
+		l.log.Warnw("saving project lock info", "project", projectName, zap.Error(err))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(projectLockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				res, err := refreshScript.Run(context.Background(), l.rdb, []string{key, infoKey}, token, projectLockTTL.Milliseconds()).Int()
+				if err != nil {
+					l.log.Errorw("refreshing project lock", "project", projectName, zap.Error(err))
+				} else if res == 0 {
+					l.log.Errorw("project lock was lost", "project", projectName, "operation", operation)
+					return
+				}
+			}
+		}
+	}()
+	unlock := func() {
+		close(done)
+		err := unlockScript.Run(context.Background(), l.rdb, []string{key, infoKey}, token).Err()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			l.log.Errorw("releasing project lock", "project", projectName, zap.Error(err))
+		}
+	}
+	return unlock, nil
+}
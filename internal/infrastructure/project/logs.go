@@ -0,0 +1,149 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jellydator/ttlcache/v3"
+	"go.uber.org/zap"
+)
+
+const (
+	LogLevelOff   = ""
+	LogLevelDebug = "debug"
+)
+
+type LogEntry struct {
+	Time     time.Time      `json:"time"`
+	Category string         `json:"category"`
+	Message  string         `json:"msg"`
+	Data     map[string]any `json:"data,omitempty"`
+}
+
+type LogLevel struct {
+	Level      string    `json:"level"`
+	Expiration time.Time `json:"expiration,omitempty"`
+}
+
+type RedisProjectLogs struct {
+	log        *zap.SugaredLogger
+	rdb        *redis.Client
+	maxEntries int64
+	levels     *ttlcache.Cache[string, string]
+}
+
+func NewRedisProjectLogs(log *zap.SugaredLogger, rdb *redis.Client, maxEntries int) *RedisProjectLogs {
+	loader := ttlcache.LoaderFunc[string, string](
+		func(c *ttlcache.Cache[string, string], project string) *ttlcache.Item[string, string] {
+			level, err := rdb.Get(context.Background(), levelKey(project)).Result()
+			if err != nil && err != redis.Nil {
+				log.Errorw("reading project log level", "project", project, zap.Error(err))
+			}
+			return c.Set(project, level, ttlcache.DefaultTTL)
+		},
+	)
+	levels := ttlcache.New(
+		ttlcache.WithTTL[string, string](10*time.Second),
+		ttlcache.WithLoader[string, string](loader),
+		ttlcache.WithDisableTouchOnHit[string, string](),
+	)
+	go levels.Start()
+	return &RedisProjectLogs{log: log, rdb: rdb, maxEntries: int64(maxEntries), levels: levels}
+}
+
+func levelKey(project string) string {
+	return fmt.Sprintf("project_logs:level:%s", project)
+}
+
+func entriesKey(project string) string {
+	return fmt.Sprintf("project_logs:entries:%s", project)
+}
+
+// Enabled returns true when debug logging is enabled for the given project
+func (s *RedisProjectLogs) Enabled(project string) bool {
+	item := s.levels.Get(project)
+	return item != nil && item.Value() == LogLevelDebug
+}
+
+func (s *RedisProjectLogs) SetLevel(ctx context.Context, project, level string, duration time.Duration) error {
+	if level == LogLevelOff {
+		if err := s.rdb.Del(ctx, levelKey(project)).Err(); err != nil {
+			return fmt.Errorf("redis delete project log level: %v", err)
+		}
+	} else if err := s.rdb.Set(ctx, levelKey(project), level, duration).Err(); err != nil {
+		return fmt.Errorf("redis save project log level: %v", err)
+	}
+	s.levels.Set(project, level, ttlcache.DefaultTTL)
+	return nil
+}
+
+func (s *RedisProjectLogs) GetLevel(ctx context.Context, project string) (LogLevel, error) {
+	var info LogLevel
+	level, err := s.rdb.Get(ctx, levelKey(project)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return info, nil
+		}
+		return info, fmt.Errorf("redis get project log level: %v", err)
+	}
+	info.Level = level
+	ttl, err := s.rdb.TTL(ctx, levelKey(project)).Result()
+	if err == nil && ttl > 0 {
+		info.Expiration = time.Now().Add(ttl).UTC()
+	}
+	return info, nil
+}
+
+// Log stores log entry into the project's buffer of recent entries (only when logging is enabled)
+func (s *RedisProjectLogs) Log(project, category, msg string, data map[string]any) {
+	if !s.Enabled(project) {
+		return
+	}
+	entry := LogEntry{Time: time.Now().UTC(), Category: category, Message: msg, Data: data}
+	value, err := json.Marshal(entry)
+	if err != nil {
+		s.log.Errorw("encoding project log entry", "project", project, zap.Error(err))
+		return
+	}
+	ctx := context.Background()
+	key := entriesKey(project)
+	pipe := s.rdb.TxPipeline()
+	pipe.LPush(ctx, key, value)
+	pipe.LTrim(ctx, key, 0, s.maxEntries-1)
+	pipe.Expire(ctx, key, 24*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.log.Errorw("saving project log entry", "project", project, zap.Error(err))
+	}
+}
+
+func (s *RedisProjectLogs) GetEntries(ctx context.Context, project string, limit int) ([]LogEntry, error) {
+	if limit <= 0 || int64(limit) > s.maxEntries {
+		limit = int(s.maxEntries)
+	}
+	values, err := s.rdb.LRange(ctx, entriesKey(project), 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis get project logs: %v", err)
+	}
+	entries := make([]LogEntry, 0, len(values))
+	for _, v := range values {
+		var entry LogEntry
+		if err := json.Unmarshal([]byte(v), &entry); err != nil {
+			s.log.Warnw("parsing project log entry", "project", project, zap.Error(err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (s *RedisProjectLogs) Clear(ctx context.Context, project string) error {
+	return s.rdb.Del(ctx, entriesKey(project)).Err()
+}
+
+func (s *RedisProjectLogs) Close() {
+	s.levels.Stop()
+	s.levels.DeleteAll()
+}
@@ -0,0 +1,182 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"golang.org/x/text/unicode/norm"
+)
+
+var ErrInvalidPath = errors.New("invalid file path")
+
+// NormalizePath converts path of the project file into canonical form - NFC unicode normalization,
+// forward slashes as separators and without empty, relative or drive letter segments
+func NormalizePath(path string) (string, error) {
+	if strings.ContainsRune(path, 0) {
+		return "", ErrInvalidPath
+	}
+	path = norm.NFC.String(strings.ReplaceAll(path, "\\", "/"))
+	parts := strings.Split(path, "/")
+	segments := make([]string, 0, len(parts))
+	for i, p := range parts {
+		if p == "" || p == "." || p == ".." || (i == 0 && len(p) == 2 && p[1] == ':') {
+			continue
+		}
+		segments = append(segments, p)
+	}
+	if len(segments) == 0 {
+		return "", ErrInvalidPath
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Checks that the (normalized) path can be used also on Windows
+func checkPortablePath(path string) error {
+	for _, segment := range strings.Split(path, "/") {
+		name := strings.ToUpper(strings.SplitN(segment, ".", 2)[0])
+		if windowsReservedNames[strings.TrimRight(name, " ")] {
+			return &domain.FilePathError{Path: path, Reason: fmt.Sprintf("'%s' is reserved name on Windows", segment)}
+		}
+		if strings.HasSuffix(segment, ".") || strings.HasSuffix(segment, " ") {
+			return &domain.FilePathError{Path: path, Reason: "name can't end with dot or space"}
+		}
+		for _, r := range segment {
+			if r < 32 || strings.ContainsRune(`<>:"|?*`, r) {
+				return &domain.FilePathError{Path: path, Reason: fmt.Sprintf("invalid character %q", r)}
+			}
+		}
+	}
+	return nil
+}
+
+// Maps lower case paths (including parent directories) to their original form
+type caseInsensitivePaths map[string]string
+
+// Adds path and returns conflicting path which differs only in letter case
+func (c caseInsensitivePaths) add(path string) string {
+	segments := strings.Split(path, "/")
+	for i := range segments {
+		prefix := strings.Join(segments[:i+1], "/")
+		key := strings.ToLower(prefix)
+		if existing, ok := c[key]; ok && existing != prefix {
+			return existing
+		}
+		c[key] = prefix
+	}
+	return ""
+}
+
+// Checks that the new files are portable and don't collide with existing files (or each other)
+// on case-insensitive file systems
+func checkPathsCollisions(existing []string, paths []string) error {
+	index := make(caseInsensitivePaths, len(existing))
+	for _, p := range existing {
+		index.add(p)
+	}
+	for _, p := range paths {
+		if err := checkPortablePath(p); err != nil {
+			return err
+		}
+		if conflict := index.add(p); conflict != "" {
+			return &domain.FilePathError{Path: p, Reason: fmt.Sprintf("conflicts with '%s' on case-insensitive file systems", conflict)}
+		}
+	}
+	return nil
+}
+
+// Returns paths of indexed files which are not removed
+func remainingFiles(index *FilesIndex, removes []string) []string {
+	index.RLock()
+	defer index.RUnlock()
+	paths := make([]string, 0, len(index.Index))
+	for p := range index.Index {
+		removed := false
+		for _, r := range removes {
+			if p == r || strings.HasPrefix(p, r+"/") {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// NormalizeFilesPaths renames project files and entries of the files index which are not
+// in the normalized form. Returns number of fixed entries.
+func (s *DiskStorage) NormalizeFilesPaths(projectName string) (int, error) {
+	index, err := s.filesIndex(projectName)
+	if err != nil {
+		return 0, err
+	}
+	index.Lock()
+	defer index.Unlock()
+	paths := make([]string, 0, len(index.Index))
+	for path := range index.Index {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	fixed := 0
+	for _, path := range paths {
+		normPath, err := NormalizePath(path)
+		if err == nil && normPath == path {
+			continue
+		}
+		info := index.Index[path]
+		delete(index.Index, path)
+		fixed++
+		if err != nil {
+			s.log.Warnw("removing invalid files index entry", "project", projectName, "path", path)
+			continue
+		}
+		absPath := filepath.Join(s.ProjectsRoot, projectName, path)
+		normAbsPath := filepath.Join(s.ProjectsRoot, projectName, normPath)
+		if current, exists := index.Index[normPath]; exists && current.Mtime >= info.Mtime {
+			// duplicate entry of older file
+			if absPath != normAbsPath {
+				os.Remove(absPath)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(normAbsPath), 0775); err != nil {
+			return fixed, err
+		}
+		if err := os.Rename(absPath, normAbsPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fixed, err
+		}
+		index.Index[normPath] = info
+	}
+	if fixed > 0 {
+		if err := saveJsonFile(filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "filesmap.json"), index.Index); err != nil {
+			return fixed, err
+		}
+		s.log.Infow("normalized files paths", "project", projectName, "count", fixed)
+	}
+	return fixed, nil
+}
+
+func normalizeProjectFiles(files []domain.ProjectFile) ([]domain.ProjectFile, error) {
+	normalized := make([]domain.ProjectFile, len(files))
+	for i, f := range files {
+		path, err := NormalizePath(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, f.Path)
+		}
+		f.Path = path
+		normalized[i] = f
+	}
+	return normalized, nil
+}
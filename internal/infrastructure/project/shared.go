@@ -0,0 +1,254 @@
+package project
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+// Shared data files of the user are stored in <user>/.shared directory (not recognized as a project)
+// and linked into projects by hard links (or copied when hard links are not supported, symlinks would
+// change content of the projects when the shared file is replaced). References are tracked in the index
+// file and validated against the project files, so references of removed or replaced project files
+// don't block deletion of the shared file.
+
+type sharedFileEntry struct {
+	domain.FileInfo
+	References []domain.SharedFileReference `json:"references,omitempty"`
+}
+
+func (s *DiskStorage) sharedDir(username string) string {
+	return filepath.Join(s.ProjectsRoot, username, ".shared")
+}
+
+// Hidden files (e.g. the index file) are reserved for the internal data of the shared directory
+func checkSharedPath(path string) error {
+	for _, segment := range strings.Split(filepath.ToSlash(filepath.Clean(path)), "/") {
+		if strings.HasPrefix(segment, ".") {
+			return &domain.FilePathError{Path: path, Reason: "hidden files are not allowed"}
+		}
+	}
+	return nil
+}
+
+func (s *DiskStorage) loadSharedIndex(username string) (map[string]sharedFileEntry, error) {
+	index := make(map[string]sharedFileEntry)
+	data, err := os.ReadFile(filepath.Join(s.sharedDir(username), ".index.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return index, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("parsing shared files index: %w", err)
+	}
+	return index, nil
+}
+
+func (s *DiskStorage) saveSharedIndex(username string, index map[string]sharedFileEntry) error {
+	return saveJsonFile(filepath.Join(s.sharedDir(username), ".index.json"), index)
+}
+
+// Returns only references to the project files which are still linked to the shared file
+func (s *DiskStorage) validReferences(sharedPath string, refs []domain.SharedFileReference) []domain.SharedFileReference {
+	sharedInfo, err := os.Stat(sharedPath)
+	if err != nil {
+		return nil
+	}
+	valid := make([]domain.SharedFileReference, 0, len(refs))
+	for _, ref := range refs {
+		info, err := os.Stat(filepath.Join(s.ProjectsRoot, ref.Project, ref.Path))
+		if err == nil && os.SameFile(sharedInfo, info) {
+			valid = append(valid, ref)
+		}
+	}
+	return valid
+}
+
+func (s *DiskStorage) ListSharedFiles(username string) ([]domain.SharedFile, error) {
+	s.sharedMu.Lock()
+	defer s.sharedMu.Unlock()
+	index, err := s.loadSharedIndex(username)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]domain.SharedFile, 0, len(index))
+	for path, entry := range index {
+		refs := s.validReferences(filepath.Join(s.sharedDir(username), path), entry.References)
+		files = append(files, domain.SharedFile{
+			Path:       path,
+			Hash:       entry.Hash,
+			Size:       entry.Size,
+			Mtime:      entry.Mtime,
+			References: refs,
+		})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// Saves shared file, existing file is replaced (projects linked by hard links keep the previous content)
+func (s *DiskStorage) SaveSharedFile(username, path string, r io.Reader) (domain.SharedFile, error) {
+	path, err := NormalizePath(path)
+	if err != nil {
+		return domain.SharedFile{}, err
+	}
+	if err := checkPortablePath(path); err != nil {
+		return domain.SharedFile{}, err
+	}
+	if err := checkSharedPath(path); err != nil {
+		return domain.SharedFile{}, err
+	}
+	absPath := filepath.Join(s.sharedDir(username), path)
+	if _, err := saveToFile2(r, absPath); err != nil {
+		return domain.SharedFile{}, fmt.Errorf("saving shared file: %w", err)
+	}
+	// shared data must not be modified through the projects (e.g. by WFS-T)
+	if err := os.Chmod(absPath, 0444); err != nil {
+		s.log.Errorw("changing shared file permissions", zap.Error(err))
+	}
+	hash, err := Checksum(absPath)
+	if err != nil {
+		return domain.SharedFile{}, fmt.Errorf("computing shared file checksum: %w", err)
+	}
+	fStat, err := os.Stat(absPath)
+	if err != nil {
+		return domain.SharedFile{}, err
+	}
+	s.sharedMu.Lock()
+	defer s.sharedMu.Unlock()
+	index, err := s.loadSharedIndex(username)
+	if err != nil {
+		return domain.SharedFile{}, err
+	}
+	entry := index[path]
+	entry.FileInfo = domain.FileInfo{Hash: hash, Size: fStat.Size(), Mtime: fStat.ModTime().Unix()}
+	entry.References = s.validReferences(absPath, entry.References)
+	index[path] = entry
+	if err := s.saveSharedIndex(username, index); err != nil {
+		return domain.SharedFile{}, fmt.Errorf("saving shared files index: %w", err)
+	}
+	return domain.SharedFile{Path: path, Hash: hash, Size: entry.Size, Mtime: entry.Mtime, References: entry.References}, nil
+}
+
+func (s *DiskStorage) DeleteSharedFile(username, path string) error {
+	path, err := NormalizePath(path)
+	if err != nil {
+		return err
+	}
+	s.sharedMu.Lock()
+	defer s.sharedMu.Unlock()
+	index, err := s.loadSharedIndex(username)
+	if err != nil {
+		return err
+	}
+	entry, ok := index[path]
+	if !ok {
+		return domain.ErrSharedFileNotExists
+	}
+	absPath := filepath.Join(s.sharedDir(username), path)
+	if len(s.validReferences(absPath, entry.References)) > 0 {
+		return domain.ErrSharedFileInUse
+	}
+	if err := os.Remove(absPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing shared file: %w", err)
+	}
+	delete(index, path)
+	return s.saveSharedIndex(username, index)
+}
+
+// Links shared file of the project owner into the project and registers it in the project files index
+func (s *DiskStorage) LinkSharedFile(projectName, sharedPath, path string) (domain.ProjectFile, error) {
+	var finfo domain.ProjectFile
+	pInfo, err := s.GetProjectInfo(projectName)
+	if err != nil {
+		return finfo, err
+	}
+	if sharedPath, err = NormalizePath(sharedPath); err != nil {
+		return finfo, err
+	}
+	if path, err = NormalizePath(path); err != nil {
+		return finfo, err
+	}
+	index, err := s.filesIndex(projectName)
+	if err != nil {
+		return finfo, err
+	}
+	if err := checkPathsCollisions(remainingFiles(index, nil), []string{path}); err != nil {
+		return finfo, err
+	}
+	username := filepath.Dir(projectName)
+
+	s.sharedMu.Lock()
+	defer s.sharedMu.Unlock()
+	sharedIndex, err := s.loadSharedIndex(username)
+	if err != nil {
+		return finfo, err
+	}
+	entry, ok := sharedIndex[sharedPath]
+	if !ok {
+		return finfo, domain.ErrSharedFileNotExists
+	}
+	src := filepath.Join(s.sharedDir(username), sharedPath)
+	dest := filepath.Join(s.ProjectsRoot, projectName, path)
+	if err := os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+		return finfo, err
+	}
+	if err := os.Link(src, dest); err != nil {
+		// e.g. projects on different file system
+		s.log.Warnw("creating hard link of shared file, copying the file", "project", projectName, zap.Error(err))
+		return s.copySharedFile(projectName, src, path, index, pInfo)
+	}
+	entry.References = append(s.validReferences(src, entry.References), domain.SharedFileReference{Project: projectName, Path: path})
+	sharedIndex[sharedPath] = entry
+	if err := s.saveSharedIndex(username, sharedIndex); err != nil {
+		return finfo, fmt.Errorf("saving shared files index: %w", err)
+	}
+	return s.registerLinkedFile(projectName, path, domain.FileInfo{Hash: entry.Hash, Size: entry.Size, Mtime: entry.Mtime, Shared: true}, index, pInfo)
+}
+
+// Copies shared file into the project as a regular project file (not tracked as a reference)
+func (s *DiskStorage) copySharedFile(projectName, src, path string, index *FilesIndex, pInfo domain.ProjectInfo) (domain.ProjectFile, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return domain.ProjectFile{}, err
+	}
+	defer f.Close()
+	dest := filepath.Join(s.ProjectsRoot, projectName, path)
+	hash, err := saveToFile2(f, dest)
+	if err != nil {
+		return domain.ProjectFile{}, fmt.Errorf("copying shared file: %w", err)
+	}
+	fStat, err := os.Stat(dest)
+	if err != nil {
+		return domain.ProjectFile{}, err
+	}
+	return s.registerLinkedFile(projectName, path, domain.FileInfo{Hash: hash, Size: fStat.Size(), Mtime: fStat.ModTime().Unix()}, index, pInfo)
+}
+
+func (s *DiskStorage) registerLinkedFile(projectName, path string, info domain.FileInfo, index *FilesIndex, pInfo domain.ProjectInfo) (domain.ProjectFile, error) {
+	var finfo domain.ProjectFile
+	index.Set(path, info)
+	if err := saveJsonFile(filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "filesmap.json"), index); err != nil {
+		return finfo, fmt.Errorf("saving files index: %w", err)
+	}
+	pInfo.Size = index.TotalSize()
+	if pInfo.State == "empty" {
+		pInfo.State = "staged"
+	}
+	pInfo.LastUpdate = time.Now().UTC()
+	if err := s.saveConfigFile(projectName, "project.json", pInfo); err != nil {
+		return finfo, fmt.Errorf("updating project file: %w", err)
+	}
+	return domain.ProjectFile{Path: path, Hash: info.Hash, Size: info.Size, Mtime: info.Mtime}, nil
+}
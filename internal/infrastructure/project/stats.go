@@ -0,0 +1,186 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	statsKeyPrefix        = "stats:"
+	statsRetention        = 25 * time.Hour
+	projectStatsKeyPrefix = "project_stats:"
+	projectStatsRetention = 8 * 24 * time.Hour
+	// monthly buckets are kept for usage reports of the past months
+	projectMonthStatsKeyPrefix = "project_stats_month:"
+	projectMonthStatsRetention = 400 * 24 * time.Hour
+)
+
+func statsKey(t time.Time) string {
+	return statsKeyPrefix + t.UTC().Format("2006010215")
+}
+
+func projectStatsKey(t time.Time) string {
+	return projectStatsKeyPrefix + t.UTC().Format("20060102")
+}
+
+func projectMonthStatsKey(t time.Time) string {
+	return projectMonthStatsKeyPrefix + t.UTC().Format("200601")
+}
+
+// RedisRequestsStats counts events (requests, errors) in hourly buckets, events of the projects
+// are counted in daily and monthly buckets. Counters are accumulated in memory and periodically flushed into redis.
+type RedisRequestsStats struct {
+	log             *zap.SugaredLogger
+	rdb             *redis.Client
+	mu              sync.Mutex
+	counters        map[string]int64
+	projectCounters map[string]int64
+}
+
+func NewRedisRequestsStats(log *zap.SugaredLogger, rdb *redis.Client) *RedisRequestsStats {
+	return &RedisRequestsStats{log: log, rdb: rdb, counters: make(map[string]int64), projectCounters: make(map[string]int64)}
+}
+
+func (s *RedisRequestsStats) Incr(name string) {
+	s.mu.Lock()
+	s.counters[name]++
+	s.mu.Unlock()
+}
+
+// IncrProject increments counter of the project event
+func (s *RedisRequestsStats) IncrProject(project, name string) {
+	s.mu.Lock()
+	s.projectCounters[project+"|"+name]++
+	s.mu.Unlock()
+}
+
+// Flush saves accumulated counters into the current hourly bucket
+func (s *RedisRequestsStats) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	counters := s.counters
+	projectCounters := s.projectCounters
+	s.counters = make(map[string]int64)
+	s.projectCounters = make(map[string]int64)
+	s.mu.Unlock()
+	if len(counters) == 0 && len(projectCounters) == 0 {
+		return nil
+	}
+	now := time.Now()
+	pipe := s.rdb.TxPipeline()
+	if len(counters) > 0 {
+		key := statsKey(now)
+		for name, value := range counters {
+			pipe.HIncrBy(ctx, key, name, value)
+		}
+		pipe.Expire(ctx, key, statsRetention)
+	}
+	if len(projectCounters) > 0 {
+		key := projectStatsKey(now)
+		for name, value := range projectCounters {
+			pipe.HIncrBy(ctx, key, name, value)
+		}
+		pipe.Expire(ctx, key, projectStatsRetention)
+		monthKey := projectMonthStatsKey(now)
+		for name, value := range projectCounters {
+			pipe.HIncrBy(ctx, monthKey, name, value)
+		}
+		pipe.Expire(ctx, monthKey, projectMonthStatsRetention)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis save stats: %v", err)
+	}
+	return nil
+}
+
+// Run flushes counters in the given interval until the context is cancelled
+func (s *RedisRequestsStats) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.Flush(context.Background()); err != nil {
+				s.log.Errorw("saving requests stats", zap.Error(err))
+			}
+			return
+		case <-ticker.C:
+			if err := s.Flush(ctx); err != nil {
+				s.log.Errorw("saving requests stats", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Sum returns sums of counters from the last given number of hours (including the current one)
+func (s *RedisRequestsStats) Sum(ctx context.Context, hours int) (map[string]int64, error) {
+	now := time.Now()
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, hours)
+	for i := 0; i < hours; i++ {
+		cmds[i] = pipe.HGetAll(ctx, statsKey(now.Add(-time.Duration(i)*time.Hour)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("redis get stats: %v", err)
+	}
+	result := make(map[string]int64)
+	for _, cmd := range cmds {
+		for name, value := range cmd.Val() {
+			v, _ := strconv.ParseInt(value, 10, 64)
+			result[name] += v
+		}
+	}
+	return result, nil
+}
+
+// ProjectSums returns sums of the projects counters from the last given number of days (including
+// the current one), indexed by project name and counter name
+func (s *RedisRequestsStats) ProjectSums(ctx context.Context, days int) (map[string]map[string]int64, error) {
+	now := time.Now()
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, days)
+	for i := 0; i < days; i++ {
+		cmds[i] = pipe.HGetAll(ctx, projectStatsKey(now.AddDate(0, 0, -i)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("redis get projects stats: %v", err)
+	}
+	result := make(map[string]map[string]int64)
+	for _, cmd := range cmds {
+		addProjectCounters(result, cmd.Val())
+	}
+	return result, nil
+}
+
+// ProjectMonthSums returns the projects counters of the given month (UTC), indexed by project name
+// and counter name
+func (s *RedisRequestsStats) ProjectMonthSums(ctx context.Context, month time.Time) (map[string]map[string]int64, error) {
+	values, err := s.rdb.HGetAll(ctx, projectMonthStatsKey(month)).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("redis get projects stats: %v", err)
+	}
+	result := make(map[string]map[string]int64)
+	addProjectCounters(result, values)
+	return result, nil
+}
+
+func addProjectCounters(result map[string]map[string]int64, values map[string]string) {
+	for field, value := range values {
+		i := strings.LastIndex(field, "|")
+		if i == -1 {
+			continue
+		}
+		project, name := field[:i], field[i+1:]
+		if result[project] == nil {
+			result[project] = make(map[string]int64)
+		}
+		v, _ := strconv.ParseInt(value, 10, 64)
+		result[project][name] += v
+	}
+}
@@ -0,0 +1,108 @@
+package project
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+// Named SLD styles of the layers are stored in .gisquick/styles/<layer id>/<name>.sld,
+// list of the styles is indexed in .gisquick/styles.json (part of the config version)
+
+func (s *DiskStorage) layerStylePath(projectName, layerID, name string) (string, error) {
+	if layerID == "" || name == "" || strings.HasPrefix(layerID, ".") || strings.HasPrefix(name, ".") ||
+		strings.ContainsAny(layerID+name, `/\`) {
+		return "", fmt.Errorf("invalid style name: %s/%s", layerID, name)
+	}
+	return filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "styles", layerID, name+".sld"), nil
+}
+
+func (s *DiskStorage) GetLayerStyles(projectName string) (map[string][]string, error) {
+	styles := make(map[string][]string)
+	data, err := os.ReadFile(filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "styles.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return styles, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &styles); err != nil {
+		return nil, err
+	}
+	return styles, nil
+}
+
+func (s *DiskStorage) GetLayerStyle(projectName, layerID, name string) ([]byte, error) {
+	path, err := s.layerStylePath(projectName, layerID, name)
+	if err != nil {
+		return nil, domain.ErrStyleNotExists
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, domain.ErrStyleNotExists
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *DiskStorage) SaveLayerStyle(projectName, layerID, name string, data []byte) error {
+	if !s.CheckProjectExists(projectName) {
+		return domain.ErrProjectNotExists
+	}
+	path, err := s.layerStylePath(projectName, layerID, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("saving style file: %w", err)
+	}
+	return s.updateStylesIndex(projectName)
+}
+
+func (s *DiskStorage) DeleteLayerStyle(projectName, layerID, name string) error {
+	path, err := s.layerStylePath(projectName, layerID, name)
+	if err != nil {
+		return domain.ErrStyleNotExists
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return domain.ErrStyleNotExists
+		}
+		return fmt.Errorf("removing style file: %w", err)
+	}
+	// remove empty layer directory
+	os.Remove(filepath.Dir(path))
+	return s.updateStylesIndex(projectName)
+}
+
+// Rebuilds index of the styles from the content of styles directory
+func (s *DiskStorage) updateStylesIndex(projectName string) error {
+	stylesDir := filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "styles")
+	files, err := filepath.Glob(filepath.Join(stylesDir, "*", "*.sld"))
+	if err != nil {
+		return err
+	}
+	styles := make(map[string][]string)
+	for _, f := range files {
+		layerID := filepath.Base(filepath.Dir(f))
+		styles[layerID] = append(styles[layerID], strings.TrimSuffix(filepath.Base(f), ".sld"))
+	}
+	for _, names := range styles {
+		sort.Strings(names)
+	}
+	if err := s.saveConfigFile(projectName, "styles.json", styles); err != nil {
+		return fmt.Errorf("updating styles index: %w", err)
+	}
+	return nil
+}
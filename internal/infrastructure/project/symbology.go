@@ -0,0 +1,253 @@
+package project
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+type qgsOption struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type qgsProp struct {
+	Key   string `xml:"k,attr"`
+	Value string `xml:"v,attr"`
+}
+
+type qgsSymbolLayer struct {
+	Class   string      `xml:"class,attr"`
+	Enabled string      `xml:"enabled,attr"`
+	Props   []qgsProp   `xml:"prop"`
+	Options []qgsOption `xml:"Option>Option"`
+}
+
+type qgsSymbol struct {
+	Name   string           `xml:"name,attr"`
+	Type   string           `xml:"type,attr"`
+	Alpha  string           `xml:"alpha,attr"`
+	Layers []qgsSymbolLayer `xml:"layer"`
+}
+
+type qgsRule struct {
+	Filter string    `xml:"filter,attr"`
+	Label  string    `xml:"label,attr"`
+	Symbol string    `xml:"symbol,attr"`
+	Active string    `xml:"active,attr"`
+	Rules  []qgsRule `xml:"rule"`
+}
+
+type qgsRenderer struct {
+	Type       string `xml:"type,attr"`
+	Attr       string `xml:"attr,attr"`
+	Categories []struct {
+		Symbol string `xml:"symbol,attr"`
+		Value  string `xml:"value,attr"`
+		Label  string `xml:"label,attr"`
+		Render string `xml:"render,attr"`
+	} `xml:"categories>category"`
+	Ranges []struct {
+		Symbol string  `xml:"symbol,attr"`
+		Lower  float64 `xml:"lower,attr"`
+		Upper  float64 `xml:"upper,attr"`
+		Label  string  `xml:"label,attr"`
+		Render string  `xml:"render,attr"`
+	} `xml:"ranges>range"`
+	Rules   *qgsRule    `xml:"rules"`
+	Symbols []qgsSymbol `xml:"symbols>symbol"`
+}
+
+type qgsColorItem struct {
+	Value string `xml:"value,attr"`
+	Color string `xml:"color,attr"`
+	Label string `xml:"label,attr"`
+	Alpha string `xml:"alpha,attr"`
+}
+
+type qgsRasterRenderer struct {
+	Type      string         `xml:"type,attr"`
+	Palette   []qgsColorItem `xml:"colorPalette>paletteEntry"`
+	ColorRamp []qgsColorItem `xml:"rastershader>colorrampshader>item"`
+}
+
+type qgsMapLayer struct {
+	ID             string             `xml:"id"`
+	Renderer       *qgsRenderer       `xml:"renderer-v2"`
+	RasterRenderer *qgsRasterRenderer `xml:"pipe>rasterrenderer"`
+}
+
+type qgsProject struct {
+	Layers []qgsMapLayer `xml:"projectlayers>maplayer"`
+}
+
+// Converts QGIS color ("r,g,b,a" format) into hex notation
+func qgisColor(value string) string {
+	parts := strings.Split(value, ",")
+	if len(parts) < 4 {
+		return value
+	}
+	rgba := make([]int, 4)
+	for i := range rgba {
+		v, err := strconv.Atoi(strings.TrimSpace(parts[i]))
+		if err != nil {
+			return value
+		}
+		rgba[i] = v
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", rgba[0], rgba[1], rgba[2], rgba[3])
+}
+
+func isColorProperty(name string) bool {
+	return name == "color" || strings.HasSuffix(name, "_color") || strings.HasPrefix(name, "color")
+}
+
+func convertSymbol(s qgsSymbol) *domain.Symbol {
+	symbol := &domain.Symbol{Type: s.Type, Alpha: 1, Layers: make([]domain.SymbolLayer, 0, len(s.Layers))}
+	if alpha, err := strconv.ParseFloat(s.Alpha, 64); err == nil {
+		symbol.Alpha = alpha
+	}
+	for _, l := range s.Layers {
+		if l.Enabled == "0" {
+			continue
+		}
+		props := make(map[string]string)
+		// older project versions use <prop> elements, newer <Option> elements
+		for _, p := range l.Props {
+			props[p.Key] = p.Value
+		}
+		for _, o := range l.Options {
+			if o.Name != "" {
+				props[o.Name] = o.Value
+			}
+		}
+		for name, value := range props {
+			if isColorProperty(name) {
+				props[name] = qgisColor(value)
+			}
+		}
+		symbol.Layers = append(symbol.Layers, domain.SymbolLayer{Class: l.Class, Properties: props})
+	}
+	return symbol
+}
+
+func flattenRules(rule qgsRule, symbols map[string]*domain.Symbol, items []domain.SymbologyItem) []domain.SymbologyItem {
+	for _, r := range rule.Rules {
+		if r.Symbol != "" {
+			items = append(items, domain.SymbologyItem{
+				Label:   r.Label,
+				Filter:  r.Filter,
+				Symbol:  symbols[r.Symbol],
+				Visible: r.Active != "0",
+			})
+		}
+		items = flattenRules(r, symbols, items)
+	}
+	return items
+}
+
+func convertRenderer(r *qgsRenderer) domain.LayerSymbology {
+	symbols := make(map[string]*domain.Symbol, len(r.Symbols))
+	for _, s := range r.Symbols {
+		symbols[s.Name] = convertSymbol(s)
+	}
+	ls := domain.LayerSymbology{Renderer: r.Type, Attribute: r.Attr}
+	switch r.Type {
+	case "singleSymbol":
+		ls.Symbol = symbols["0"]
+	case "categorizedSymbol":
+		for _, c := range r.Categories {
+			ls.Items = append(ls.Items, domain.SymbologyItem{
+				Label:   c.Label,
+				Value:   c.Value,
+				Symbol:  symbols[c.Symbol],
+				Visible: c.Render != "false",
+			})
+		}
+	case "graduatedSymbol":
+		for _, rg := range r.Ranges {
+			lower, upper := rg.Lower, rg.Upper
+			ls.Items = append(ls.Items, domain.SymbologyItem{
+				Label:   rg.Label,
+				Lower:   &lower,
+				Upper:   &upper,
+				Symbol:  symbols[rg.Symbol],
+				Visible: rg.Render != "false",
+			})
+		}
+	case "RuleRenderer":
+		if r.Rules != nil {
+			ls.Items = flattenRules(*r.Rules, symbols, nil)
+		}
+	}
+	return ls
+}
+
+func convertRasterRenderer(r *qgsRasterRenderer) domain.LayerSymbology {
+	ls := domain.LayerSymbology{Renderer: r.Type}
+	entries := r.Palette
+	if len(entries) == 0 {
+		entries = r.ColorRamp
+	}
+	for _, e := range entries {
+		color := e.Color
+		// raster color entries are in #rrggbb format with separate alpha value
+		if alpha, err := strconv.Atoi(e.Alpha); err == nil && len(color) == 7 {
+			color = fmt.Sprintf("%s%02x", color, alpha)
+		}
+		ls.Items = append(ls.Items, domain.SymbologyItem{Label: e.Label, Value: e.Value, Color: color, Visible: true})
+	}
+	return ls
+}
+
+// ParseSymbology extracts symbology of vector and raster layers from QGIS project file (.qgs)
+func ParseSymbology(r io.Reader) (map[string]domain.LayerSymbology, error) {
+	var project qgsProject
+	if err := xml.NewDecoder(r).Decode(&project); err != nil {
+		return nil, err
+	}
+	symbology := make(map[string]domain.LayerSymbology)
+	for _, l := range project.Layers {
+		if l.Renderer != nil {
+			symbology[l.ID] = convertRenderer(l.Renderer)
+		} else if l.RasterRenderer != nil {
+			symbology[l.ID] = convertRasterRenderer(l.RasterRenderer)
+		}
+	}
+	return symbology, nil
+}
+
+// Reads symbology from .qgs file or .qgz archive
+func parseSymbologyFile(path string) (map[string]domain.LayerSymbology, error) {
+	if strings.EqualFold(filepath.Ext(path), ".qgz") {
+		archive, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		defer archive.Close()
+		for _, f := range archive.File {
+			if strings.EqualFold(filepath.Ext(f.Name), ".qgs") {
+				r, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer r.Close()
+				return ParseSymbology(r)
+			}
+		}
+		return nil, fmt.Errorf("qgs file not found in archive")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseSymbology(f)
+}
@@ -0,0 +1,43 @@
+package project
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const usageKey = "projects_usage"
+
+// RedisProjectsUsage keeps count of map project loads, used to find the most used projects
+type RedisProjectsUsage struct {
+	log *zap.SugaredLogger
+	rdb *redis.Client
+}
+
+func NewRedisProjectsUsage(log *zap.SugaredLogger, rdb *redis.Client) *RedisProjectsUsage {
+	return &RedisProjectsUsage{log: log, rdb: rdb}
+}
+
+func (s *RedisProjectsUsage) Track(project string) {
+	if err := s.rdb.ZIncrBy(context.Background(), usageKey, 1, project).Err(); err != nil {
+		s.log.Errorw("saving project usage", "project", project, zap.Error(err))
+	}
+}
+
+// Returns names of the most used projects, sorted by usage
+func (s *RedisProjectsUsage) Top(ctx context.Context, count int) ([]string, error) {
+	if count <= 0 {
+		return []string{}, nil
+	}
+	projects, err := s.rdb.ZRevRange(ctx, usageKey, 0, int64(count-1)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis get projects usage: %v", err)
+	}
+	return projects, nil
+}
+
+func (s *RedisProjectsUsage) Remove(ctx context.Context, project string) error {
+	return s.rdb.ZRem(ctx, usageKey, project).Err()
+}
@@ -0,0 +1,650 @@
+package qgisexpr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Parser of QGIS expressions used for static validation against layer's schema.
+//
+// Supported syntax:
+//   literals:    123, 1.5, 'text', NULL, TRUE, FALSE
+//   fields:      name, "field name"
+//   variables:   @variable, $geometry, $area
+//   logical:     NOT, AND, OR
+//   comparison:  =, ==, <>, !=, <, <=, >, >=, ~, LIKE, ILIKE, IS, IS NOT, IN (...), NOT IN (...), BETWEEN x AND y
+//   operators:   ||, +, -, *, /, //, %, ^
+//   conditional: CASE WHEN ... THEN ... ELSE ... END
+//   functions:   name(arg1, arg2, ...)
+//
+// Expressions are not evaluated, only types of fields and literals are checked.
+
+// Value types
+const (
+	TypeAny      = "any"
+	TypeNull     = "null"
+	TypeString   = "string"
+	TypeNumber   = "number"
+	TypeBoolean  = "boolean"
+	TypeDatetime = "datetime"
+)
+
+type Error struct {
+	Message  string `json:"message"`
+	Position int    `json:"position"`
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+}
+
+type Result struct {
+	Valid  bool     `json:"valid"`
+	Errors []Error  `json:"errors"`
+	Fields []string `json:"fields"` // referenced fields
+}
+
+// FieldType maps QGIS field type name into value type
+func FieldType(typeName string) string {
+	t := strings.ToLower(typeName)
+	switch {
+	case strings.Contains(t, "bool"):
+		return TypeBoolean
+	case strings.Contains(t, "date") || strings.Contains(t, "time"):
+		return TypeDatetime
+	case strings.Contains(t, "string") || strings.Contains(t, "text") || strings.Contains(t, "char"):
+		return TypeString
+	case strings.Contains(t, "int") || strings.Contains(t, "long") || strings.Contains(t, "double") ||
+		strings.Contains(t, "real") || strings.Contains(t, "float") || strings.Contains(t, "numeric") || strings.Contains(t, "decimal"):
+		return TypeNumber
+	}
+	return TypeAny
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokQuotedIdent
+	tokVariable
+	tokPunct
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	runes := []rune(src)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				i++
+				if i < len(runes) && (runes[i] == '+' || runes[i] == '-') {
+					i++
+				}
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, token{tokNumber, string(runes[start:i]), start})
+		case unicode.IsLetter(r) || r == '_' || r == '$' || r == '@':
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			kind := tokIdent
+			if r == '$' || r == '@' {
+				kind = tokVariable
+			}
+			tokens = append(tokens, token{kind, string(runes[start:i]), start})
+		case r == '\'' || r == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			for ; i < len(runes); i++ {
+				if runes[i] == r {
+					// doubled quote is escaped quote
+					if i+1 < len(runes) && runes[i+1] == r {
+						sb.WriteRune(r)
+						i++
+						continue
+					}
+					break
+				}
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						sb.WriteRune('\n')
+					case 't':
+						sb.WriteRune('\t')
+					default:
+						sb.WriteRune(runes[i])
+					}
+					continue
+				}
+				sb.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, Error{"Unterminated string", start}
+			}
+			i++
+			kind := tokString
+			if r == '"' {
+				kind = tokQuotedIdent
+			}
+			tokens = append(tokens, token{kind, sb.String(), start})
+		default:
+			if i+1 < len(runes) {
+				op := string(runes[i : i+2])
+				switch op {
+				case "==", "!=", "<>", "<=", ">=", "||", "//":
+					tokens = append(tokens, token{tokPunct, op, i})
+					i += 2
+					continue
+				}
+			}
+			if strings.ContainsRune("()[],=<>~+-*/%^", r) {
+				tokens = append(tokens, token{tokPunct, string(r), i})
+				i++
+				continue
+			}
+			return nil, Error{fmt.Sprintf("Unexpected character '%c'", r), i}
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(runes)}), nil
+}
+
+// expression node with resolved value type
+type node struct {
+	typ string
+	pos int
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	fields map[string]string
+	used   map[string]bool
+	errors []Error
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// Checks whether the current token is keyword (case insensitive) or punctuation
+func (p *parser) is(values ...string) bool {
+	t := p.peek()
+	if t.kind != tokPunct && t.kind != tokIdent {
+		return false
+	}
+	for _, v := range values {
+		if strings.EqualFold(t.value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) isAt(offset int, value string) bool {
+	if p.pos+offset >= len(p.tokens) {
+		return false
+	}
+	t := p.tokens[p.pos+offset]
+	return (t.kind == tokPunct || t.kind == tokIdent) && strings.EqualFold(t.value, value)
+}
+
+func (p *parser) expect(value string) error {
+	t := p.next()
+	if !strings.EqualFold(t.value, value) || (t.kind != tokPunct && t.kind != tokIdent) {
+		return Error{fmt.Sprintf("Expected '%s'", value), t.pos}
+	}
+	return nil
+}
+
+// Records type error (parsing continues)
+func (p *parser) typeError(pos int, format string, args ...interface{}) {
+	p.errors = append(p.errors, Error{fmt.Sprintf(format, args...), pos})
+}
+
+func compatible(a, b string) bool {
+	if a == b || a == TypeAny || b == TypeAny || a == TypeNull || b == TypeNull {
+		return true
+	}
+	// date values are commonly written as string literals
+	if (a == TypeDatetime && b == TypeString) || (a == TypeString && b == TypeDatetime) {
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return left, err
+	}
+	for p.is("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return right, err
+		}
+		left = node{typ: TypeBoolean, pos: left.pos}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return left, err
+	}
+	for p.is("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return right, err
+		}
+		left = node{typ: TypeBoolean, pos: left.pos}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.is("not") {
+		pos := p.next().pos
+		if _, err := p.parseNot(); err != nil {
+			return node{}, err
+		}
+		return node{typ: TypeBoolean, pos: pos}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseConcat()
+	if err != nil {
+		return left, err
+	}
+	for {
+		switch {
+		case p.is("=", "==", "<>", "!=", "<", "<=", ">", ">="):
+			op := p.next()
+			right, err := p.parseConcat()
+			if err != nil {
+				return right, err
+			}
+			if !compatible(left.typ, right.typ) {
+				p.typeError(op.pos, "Cannot compare %s with %s", left.typ, right.typ)
+			}
+			left = node{typ: TypeBoolean, pos: left.pos}
+		case p.is("~", "like", "ilike") || (p.is("not") && (p.isAt(1, "like") || p.isAt(1, "ilike"))):
+			if p.is("not") {
+				p.next()
+			}
+			op := p.next()
+			right, err := p.parseConcat()
+			if err != nil {
+				return right, err
+			}
+			if left.typ == TypeBoolean || left.typ == TypeNumber {
+				p.typeError(op.pos, "Operator %s requires string value, got %s", strings.ToUpper(op.value), left.typ)
+			}
+			if right.typ != TypeString && right.typ != TypeAny {
+				p.typeError(right.pos, "Pattern of %s operator must be string", strings.ToUpper(op.value))
+			}
+			left = node{typ: TypeBoolean, pos: left.pos}
+		case p.is("is"):
+			p.next()
+			if p.is("not") {
+				p.next()
+			}
+			if _, err := p.parseConcat(); err != nil {
+				return node{}, err
+			}
+			left = node{typ: TypeBoolean, pos: left.pos}
+		case p.is("in") || (p.is("not") && p.isAt(1, "in")):
+			if p.is("not") {
+				p.next()
+			}
+			p.next()
+			if err := p.expect("("); err != nil {
+				return node{}, err
+			}
+			items, err := p.parseList(")")
+			if err != nil {
+				return node{}, err
+			}
+			for _, item := range items {
+				if !compatible(left.typ, item.typ) {
+					p.typeError(item.pos, "Cannot compare %s with %s", left.typ, item.typ)
+				}
+			}
+			left = node{typ: TypeBoolean, pos: left.pos}
+		case p.is("between") || (p.is("not") && p.isAt(1, "between")):
+			if p.is("not") {
+				p.next()
+			}
+			p.next()
+			lower, err := p.parseConcat()
+			if err != nil {
+				return lower, err
+			}
+			if err := p.expect("and"); err != nil {
+				return node{}, err
+			}
+			upper, err := p.parseConcat()
+			if err != nil {
+				return upper, err
+			}
+			for _, n := range []node{lower, upper} {
+				if !compatible(left.typ, n.typ) {
+					p.typeError(n.pos, "Cannot compare %s with %s", left.typ, n.typ)
+				}
+			}
+			left = node{typ: TypeBoolean, pos: left.pos}
+		default:
+			return left, nil
+		}
+	}
+}
+
+func (p *parser) parseConcat() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return left, err
+	}
+	for p.is("||") {
+		p.next()
+		if _, err := p.parseAdditive(); err != nil {
+			return node{}, err
+		}
+		left = node{typ: TypeString, pos: left.pos}
+	}
+	return left, nil
+}
+
+// Returns result type of arithmetic operation
+func (p *parser) arithmetic(op token, left, right node) node {
+	for _, n := range []node{left, right} {
+		if n.typ == TypeBoolean || (n.typ == TypeString && op.value != "+") {
+			p.typeError(op.pos, "Operator %s cannot be applied to %s value", op.value, n.typ)
+		}
+	}
+	typ := TypeNumber
+	switch {
+	case left.typ == TypeNull || right.typ == TypeNull:
+		typ = TypeNull
+	case left.typ == TypeAny || right.typ == TypeAny:
+		typ = TypeAny
+	case op.value == "+" && left.typ == TypeString && right.typ == TypeString:
+		typ = TypeString
+	case left.typ == TypeDatetime || right.typ == TypeDatetime:
+		// date arithmetic with intervals
+		typ = TypeAny
+	}
+	return node{typ: typ, pos: left.pos}
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return left, err
+	}
+	for p.is("+", "-") {
+		op := p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return right, err
+		}
+		left = p.arithmetic(op, left, right)
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parsePower()
+	if err != nil {
+		return left, err
+	}
+	for p.is("*", "/", "//", "%") {
+		op := p.next()
+		right, err := p.parsePower()
+		if err != nil {
+			return right, err
+		}
+		left = p.arithmetic(op, left, right)
+	}
+	return left, nil
+}
+
+func (p *parser) parsePower() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return left, err
+	}
+	if p.is("^") {
+		op := p.next()
+		right, err := p.parsePower()
+		if err != nil {
+			return right, err
+		}
+		left = p.arithmetic(op, left, right)
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.is("-", "+") {
+		op := p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return operand, err
+		}
+		if operand.typ != TypeNumber && operand.typ != TypeAny && operand.typ != TypeNull {
+			p.typeError(op.pos, "Operator %s cannot be applied to %s value", op.value, operand.typ)
+		}
+		return node{typ: operand.typ, pos: op.pos}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parseList(end string) ([]node, error) {
+	var items []node
+	if p.is(end) {
+		p.next()
+		return items, nil
+	}
+	for {
+		item, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if p.is(",") {
+			p.next()
+			continue
+		}
+		if err := p.expect(end); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+}
+
+func (p *parser) parseCase(pos int) (node, error) {
+	typ := ""
+	branch := func(n node) {
+		if typ == "" || typ == TypeNull {
+			typ = n.typ
+		} else if n.typ != typ && n.typ != TypeNull {
+			typ = TypeAny
+		}
+	}
+	if !p.is("when") {
+		return node{}, Error{"Expected 'WHEN'", p.peek().pos}
+	}
+	for p.is("when") {
+		p.next()
+		if _, err := p.parseOr(); err != nil {
+			return node{}, err
+		}
+		if err := p.expect("then"); err != nil {
+			return node{}, err
+		}
+		n, err := p.parseOr()
+		if err != nil {
+			return node{}, err
+		}
+		branch(n)
+	}
+	if p.is("else") {
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return node{}, err
+		}
+		branch(n)
+	}
+	if err := p.expect("end"); err != nil {
+		return node{}, err
+	}
+	return node{typ: typ, pos: pos}, nil
+}
+
+func (p *parser) field(name string, pos int) node {
+	typ, ok := p.fields[name]
+	if !ok {
+		p.errors = append(p.errors, Error{fmt.Sprintf("Field '%s' not found", name), pos})
+		return node{typ: TypeAny, pos: pos}
+	}
+	p.used[name] = true
+	return node{typ: typ, pos: pos}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		if strings.Count(t.value, ".") > 1 {
+			return node{}, Error{fmt.Sprintf("Invalid number '%s'", t.value), t.pos}
+		}
+		return node{typ: TypeNumber, pos: t.pos}, nil
+	case tokString:
+		return node{typ: TypeString, pos: t.pos}, nil
+	case tokQuotedIdent:
+		return p.field(t.value, t.pos), nil
+	case tokVariable:
+		if p.is("(") {
+			// legacy $ functions
+			p.next()
+			if _, err := p.parseList(")"); err != nil {
+				return node{}, err
+			}
+		}
+		return node{typ: TypeAny, pos: t.pos}, nil
+	case tokIdent:
+		switch strings.ToLower(t.value) {
+		case "null":
+			return node{typ: TypeNull, pos: t.pos}, nil
+		case "true", "false":
+			return node{typ: TypeBoolean, pos: t.pos}, nil
+		case "case":
+			return p.parseCase(t.pos)
+		case "and", "or", "not", "in", "is", "like", "ilike", "when", "then", "else", "end", "between":
+			return node{}, Error{fmt.Sprintf("Unexpected keyword '%s'", t.value), t.pos}
+		}
+		if p.is("(") {
+			p.next()
+			if _, err := p.parseList(")"); err != nil {
+				return node{}, err
+			}
+			return node{typ: TypeAny, pos: t.pos}, nil
+		}
+		return p.field(t.value, t.pos), nil
+	case tokPunct:
+		if t.value == "(" {
+			n, err := p.parseOr()
+			if err != nil {
+				return n, err
+			}
+			if err := p.expect(")"); err != nil {
+				return node{}, err
+			}
+			return n, nil
+		}
+		if t.value == "[" {
+			// array literal
+			if _, err := p.parseList("]"); err != nil {
+				return node{}, err
+			}
+			return node{typ: TypeAny, pos: t.pos}, nil
+		}
+		return node{}, Error{fmt.Sprintf("Unexpected '%s'", t.value), t.pos}
+	}
+	return node{}, Error{"Unexpected end of expression", t.pos}
+}
+
+// Validate parses the expression and checks referenced fields (name -> value type) and types of operands
+func Validate(src string, fields map[string]string) Result {
+	res := Result{Errors: make([]Error, 0), Fields: make([]string, 0)}
+	tokens, err := tokenize(src)
+	if err != nil {
+		res.Errors = append(res.Errors, err.(Error))
+		return res
+	}
+	if len(tokens) == 1 {
+		res.Errors = append(res.Errors, Error{"Empty expression", 0})
+		return res
+	}
+	p := &parser{tokens: tokens, fields: fields, used: make(map[string]bool)}
+	if _, err := p.parseOr(); err != nil {
+		res.Errors = append(res.Errors, err.(Error))
+	} else if t := p.peek(); t.kind != tokEOF {
+		res.Errors = append(res.Errors, Error{fmt.Sprintf("Unexpected token '%s'", t.value), t.pos})
+	}
+	res.Errors = append(res.Errors, p.errors...)
+	res.Fields = append(res.Fields, fieldsOrder(p.tokens, p.used)...)
+	res.Valid = len(res.Errors) == 0
+	return res
+}
+
+// Returns used fields in order of their occurrence
+func fieldsOrder(tokens []token, used map[string]bool) []string {
+	var fields []string
+	seen := make(map[string]bool)
+	for _, t := range tokens {
+		if (t.kind == tokIdent || t.kind == tokQuotedIdent) && used[t.value] && !seen[t.value] {
+			seen[t.value] = true
+			fields = append(fields, t.value)
+		}
+	}
+	return fields
+}
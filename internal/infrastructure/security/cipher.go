@@ -0,0 +1,227 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const envelopeVersion byte = 1
+
+var (
+	ErrInvalidCiphertext = errors.New("Invalid ciphertext")
+	ErrUnknownKey        = errors.New("Unknown encryption key")
+)
+
+// KeyProvider provides master keys used to encrypt (wrap) data keys. Master keys
+// are identified by id, so data encrypted by older keys can be still decrypted
+// and re-encrypted by the current key. It can be implemented by KMS clients.
+type KeyProvider interface {
+	CurrentKey() (string, []byte, error)
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeyProvider provides master keys from configuration
+type StaticKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+func deriveKey(secret string) []byte {
+	k := sha256.Sum256([]byte(secret))
+	return k[:]
+}
+
+func NewStaticKeyProvider(currentID string, keys map[string]string) (*StaticKeyProvider, error) {
+	if _, ok := keys[currentID]; !ok {
+		return nil, fmt.Errorf("missing current key: %s", currentID)
+	}
+	p := &StaticKeyProvider{current: currentID, keys: make(map[string][]byte, len(keys))}
+	for id, secret := range keys {
+		if id == "" || len(id) > 255 || secret == "" {
+			return nil, fmt.Errorf("invalid key: %s", id)
+		}
+		p.keys[id] = deriveKey(secret)
+	}
+	return p, nil
+}
+
+// ParseKeys creates key provider from config value in format "id1:secret1,id2:secret2",
+// where the first key is the current one
+func ParseKeys(value string) (*StaticKeyProvider, error) {
+	keys := make(map[string]string)
+	var current string
+	for _, item := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid keys format")
+		}
+		if current == "" {
+			current = parts[0]
+		}
+		keys[parts[0]] = parts[1]
+	}
+	return NewStaticKeyProvider(current, keys)
+}
+
+func (p *StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	return p.current, p.keys[p.current], nil
+}
+
+func (p *StaticKeyProvider) Key(id string) ([]byte, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// Cipher provides envelope encryption of data stored at rest. Data is encrypted (AES-GCM)
+// by a random data key, which is encrypted by the master key and stored along with the data.
+type Cipher struct {
+	keys KeyProvider
+}
+
+func NewCipher(keys KeyProvider) *Cipher {
+	return &Cipher{keys: keys}
+}
+
+func seal(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func open(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	size := aead.NonceSize()
+	if len(data) < size {
+		return nil, ErrInvalidCiphertext
+	}
+	return aead.Open(nil, data[:size], data[size:], nil)
+}
+
+type envelope struct {
+	keyID      string
+	dataKey    []byte // encrypted data key
+	ciphertext []byte
+}
+
+// format: version (1B) | key id length (1B) | key id | data key length (2B) | data key | ciphertext
+func (e envelope) encode() []byte {
+	buf := make([]byte, 0, 4+len(e.keyID)+len(e.dataKey)+len(e.ciphertext))
+	buf = append(buf, envelopeVersion, byte(len(e.keyID)))
+	buf = append(buf, e.keyID...)
+	size := make([]byte, 2)
+	binary.BigEndian.PutUint16(size, uint16(len(e.dataKey)))
+	buf = append(buf, size...)
+	buf = append(buf, e.dataKey...)
+	return append(buf, e.ciphertext...)
+}
+
+func decodeEnvelope(data []byte) (envelope, error) {
+	var e envelope
+	if len(data) < 2 || data[0] != envelopeVersion {
+		return e, ErrInvalidCiphertext
+	}
+	idEnd := 2 + int(data[1])
+	if len(data) < idEnd+2 {
+		return e, ErrInvalidCiphertext
+	}
+	e.keyID = string(data[2:idEnd])
+	keyEnd := idEnd + 2 + int(binary.BigEndian.Uint16(data[idEnd:]))
+	if len(data) < keyEnd {
+		return e, ErrInvalidCiphertext
+	}
+	e.dataKey = data[idEnd+2 : keyEnd]
+	e.ciphertext = data[keyEnd:]
+	return e, nil
+}
+
+func (c *Cipher) Encrypt(data []byte) ([]byte, error) {
+	keyID, masterKey, err := c.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	ciphertext, err := seal(dataKey, data)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := seal(masterKey, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return envelope{keyID: keyID, dataKey: wrappedKey, ciphertext: ciphertext}.encode(), nil
+}
+
+func (c *Cipher) unwrapDataKey(e envelope) ([]byte, error) {
+	masterKey, err := c.keys.Key(e.keyID)
+	if err != nil {
+		return nil, err
+	}
+	return open(masterKey, e.dataKey)
+}
+
+func (c *Cipher) Decrypt(data []byte) ([]byte, error) {
+	e, err := decodeEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := c.unwrapDataKey(e)
+	if err != nil {
+		return nil, err
+	}
+	return open(dataKey, e.ciphertext)
+}
+
+// Rotate re-encrypts the data key by the current master key. Returns false when
+// data is already encrypted by the current key.
+func (c *Cipher) Rotate(data []byte) ([]byte, bool, error) {
+	e, err := decodeEnvelope(data)
+	if err != nil {
+		return nil, false, err
+	}
+	keyID, masterKey, err := c.keys.CurrentKey()
+	if err != nil {
+		return nil, false, err
+	}
+	if e.keyID == keyID {
+		return data, false, nil
+	}
+	dataKey, err := c.unwrapDataKey(e)
+	if err != nil {
+		return nil, false, err
+	}
+	wrappedKey, err := seal(masterKey, dataKey)
+	if err != nil {
+		return nil, false, err
+	}
+	return envelope{keyID: keyID, dataKey: wrappedKey, ciphertext: e.ciphertext}.encode(), true, nil
+}
@@ -76,7 +76,7 @@ func (t *TokenGenerator) CheckToken(token, claims string) error {
 		return err
 	}
 	currentTimestamp := time.Now().UTC().Unix() - refTime
-	if currentTimestamp-timestamp > int64(t.expiration) {
+	if currentTimestamp-timestamp > int64(t.expiration.Seconds()) {
 		return ErrTokenExpired
 	}
 	genToken, err := t.tokenWithTimestamp(claims, timestamp)
@@ -0,0 +1,187 @@
+package throttle
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	minBurst       = 32 * 1024
+	idleLimiterTTL = 10 * time.Minute
+)
+
+// NewLimiter creates token bucket limiter with rate in bytes per second (nil for unlimited rate)
+func NewLimiter(bytesPerSec int64) *rate.Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	burst := int(bytesPerSec)
+	if burst < minBurst {
+		burst = minBurst
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSec), burst)
+}
+
+func chunkSize(limiters []*rate.Limiter, size int) int {
+	for _, l := range limiters {
+		if l.Burst() < size {
+			size = l.Burst()
+		}
+	}
+	return size
+}
+
+func wait(ctx context.Context, limiters []*rate.Limiter, n int) error {
+	for _, l := range limiters {
+		if err := l.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func activeLimiters(limiters []*rate.Limiter) []*rate.Limiter {
+	active := make([]*rate.Limiter, 0, len(limiters))
+	for _, l := range limiters {
+		if l != nil {
+			active = append(active, l)
+		}
+	}
+	return active
+}
+
+type reader struct {
+	io.ReadCloser
+	ctx      context.Context
+	limiters []*rate.Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	p = p[:chunkSize(r.limiters, len(p))]
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := wait(r.ctx, r.limiters, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// Reader wraps reader with given limiters (nil limiters are ignored)
+func Reader(ctx context.Context, r io.ReadCloser, limiters ...*rate.Limiter) io.ReadCloser {
+	active := activeLimiters(limiters)
+	if len(active) == 0 {
+		return r
+	}
+	return &reader{ReadCloser: r, ctx: ctx, limiters: active}
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	limiters []*rate.Limiter
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		size := chunkSize(w.limiters, len(p))
+		if err := wait(w.ctx, w.limiters, size); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(p[:size])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[size:]
+	}
+	return written, nil
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ResponseWriter wraps response writer with given limiters (nil limiters are ignored)
+func ResponseWriter(ctx context.Context, w http.ResponseWriter, limiters ...*rate.Limiter) http.ResponseWriter {
+	active := activeLimiters(limiters)
+	if len(active) == 0 {
+		return w
+	}
+	return &responseWriter{ResponseWriter: w, ctx: ctx, limiters: active}
+}
+
+type entry struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// KeyedLimiters holds shared limiters (e.g. per user), unused limiters are released after a while
+type KeyedLimiters struct {
+	mu          sync.Mutex
+	newLimiter  func() *rate.Limiter
+	limiters    map[string]*entry
+	lastCleanup time.Time
+}
+
+// NewKeyedLimiters creates bandwidth limiters with rate in bytes per second
+func NewKeyedLimiters(bytesPerSec int64) *KeyedLimiters {
+	k := &KeyedLimiters{limiters: make(map[string]*entry)}
+	if bytesPerSec > 0 {
+		k.newLimiter = func() *rate.Limiter { return NewLimiter(bytesPerSec) }
+	}
+	return k
+}
+
+// NewKeyedRequestLimiters creates limiters of requests rate (requests per second with given burst)
+func NewKeyedRequestLimiters(perSec float64, burst int) *KeyedLimiters {
+	k := &KeyedLimiters{limiters: make(map[string]*entry)}
+	if perSec > 0 {
+		k.newLimiter = func() *rate.Limiter { return NewRequestLimiter(perSec, burst) }
+	}
+	return k
+}
+
+// NewRequestLimiter creates limiter of requests rate (nil for unlimited rate), burst is at least 1
+func NewRequestLimiter(perSec float64, burst int) *rate.Limiter {
+	if perSec <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(perSec), burst)
+}
+
+// Get returns limiter for the given key (nil for unlimited rate)
+func (k *KeyedLimiters) Get(key string) *rate.Limiter {
+	if k == nil || k.newLimiter == nil {
+		return nil
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := time.Now()
+	if now.Sub(k.lastCleanup) > time.Minute {
+		for key, e := range k.limiters {
+			if now.Sub(e.lastUsed) > idleLimiterTTL {
+				delete(k.limiters, key)
+			}
+		}
+		k.lastCleanup = now
+	}
+	e, ok := k.limiters[key]
+	if !ok {
+		e = &entry{limiter: k.newLimiter()}
+		k.limiters[key] = e
+	}
+	e.lastUsed = now
+	return e.limiter
+}
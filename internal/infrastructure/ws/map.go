@@ -0,0 +1,116 @@
+package ws
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const mapWriteTimeout = 10 * time.Second
+
+type mapConnection struct {
+	sync.Mutex
+	conn *websocket.Conn
+}
+
+func (c *mapConnection) WriteJSON(v interface{}) error {
+	c.Lock()
+	defer c.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(mapWriteTimeout))
+	return c.conn.WriteJSON(v)
+}
+
+/* Manages websocket connections of map clients grouped by project */
+type MapWS struct {
+	sync.RWMutex
+	log         *zap.SugaredLogger
+	upgrader    websocket.Upgrader
+	connections map[string]map[*mapConnection]struct{}
+}
+
+func NewMapWS(log *zap.SugaredLogger) *MapWS {
+	return &MapWS{
+		log: log,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin:     func(r *http.Request) bool { return true },
+		},
+		connections: make(map[string]map[*mapConnection]struct{}),
+	}
+}
+
+func (m *MapWS) add(project string, c *mapConnection) {
+	m.Lock()
+	defer m.Unlock()
+	if m.connections[project] == nil {
+		m.connections[project] = make(map[*mapConnection]struct{})
+	}
+	m.connections[project][c] = struct{}{}
+}
+
+func (m *MapWS) remove(project string, c *mapConnection) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.connections[project], c)
+	if len(m.connections[project]) == 0 {
+		delete(m.connections, project)
+	}
+}
+
+// Handler upgrades request to websocket connection and keeps it open until the client disconnects.
+// Map clients only receive messages, incoming messages (except Ping) are ignored.
+func (m *MapWS) Handler(project string, w http.ResponseWriter, r *http.Request) error {
+	conn, err := m.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+	c := &mapConnection{conn: conn}
+	m.add(project, c)
+	defer func() {
+		m.remove(project, c)
+		conn.Close()
+	}()
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return err
+			}
+			return nil
+		}
+		if bytes.Equal(msg, []byte("Ping")) {
+			if err := c.WriteJSON(message{Type: "Pong"}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Broadcast sends message to all map clients connected to the given project
+func (m *MapWS) Broadcast(project string, msgType string, data interface{}) {
+	m.RLock()
+	conns := make([]*mapConnection, 0, len(m.connections[project]))
+	for c := range m.connections[project] {
+		conns = append(conns, c)
+	}
+	m.RUnlock()
+
+	msg := message{Type: msgType, Data: data}
+	for _, c := range conns {
+		if err := c.WriteJSON(msg); err != nil {
+			m.log.Warnw("sending map websocket message", "project", project, zap.Error(err))
+		}
+	}
+}
+
+// Clients returns number of map clients connected to the given project
+func (m *MapWS) Clients(project string) int {
+	m.RLock()
+	defer m.RUnlock()
+	return len(m.connections[project])
+}
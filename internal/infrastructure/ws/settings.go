@@ -85,6 +85,10 @@ func (s *SettingsWS) AppChannel() *websocketsMap {
 	return s.webapp
 }
 
+func (s *SettingsWS) PluginChannel() *websocketsMap {
+	return s.plugin
+}
+
 // func (s *SettingsWS) SendToPlugin(id string, msgType string, data interface{}) error {
 // 	dest := s.plugin.Get(id)
 // 	if dest != nil {
@@ -94,12 +98,15 @@ func (s *SettingsWS) AppChannel() *websocketsMap {
 // 	return nil
 // }
 
-func (s *SettingsWS) bridgeHandler(id string, src *websocketsMap, dest *websocketsMap, w http.ResponseWriter, r *http.Request) (err error) {
-	conn, err := s.upgrader.Upgrade(w, r, nil)
+func (s *SettingsWS) bridgeHandler(id string, src *websocketsMap, dest *websocketsMap, w http.ResponseWriter, r *http.Request, header http.Header, onConnect func()) (err error) {
+	conn, err := s.upgrader.Upgrade(w, r, header)
 	if err != nil {
 		return
 	}
 	src.Set(id, conn)
+	if onConnect != nil {
+		onConnect()
+	}
 	s.log.Infow("websocket connection started", "user", id, "channel", src.name)
 	if destConn := dest.Get(id); destConn != nil {
 		info := map[string]string{"client": r.Header.Get("User-Agent")}
@@ -142,11 +149,13 @@ func (s *SettingsWS) bridgeHandler(id string, src *websocketsMap, dest *websocke
 }
 
 func (s *SettingsWS) WebAppHandler(id string, w http.ResponseWriter, r *http.Request) error {
-	return s.bridgeHandler(id, s.webapp, s.plugin, w, r)
+	return s.bridgeHandler(id, s.webapp, s.plugin, w, r, nil, nil)
 }
 
-func (s *SettingsWS) PluginHandler(id string, w http.ResponseWriter, r *http.Request) error {
-	return s.bridgeHandler(id, s.plugin, s.webapp, w, r)
+// PluginHandler handles connection of the plugin, header is included in the upgrade response
+// and onConnect callback is called when the connection is registered (e.g. to send initial messages)
+func (s *SettingsWS) PluginHandler(id string, w http.ResponseWriter, r *http.Request, header http.Header, onConnect func()) error {
+	return s.bridgeHandler(id, s.plugin, s.webapp, w, r, header, onConnect)
 }
 
 /*
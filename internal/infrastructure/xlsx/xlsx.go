@@ -0,0 +1,200 @@
+// Package xlsx implements minimal writer of Office Open XML spreadsheets
+// (single worksheet with bold header row, inline strings and numeric cells)
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	contentTypesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+
+	relsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+	workbookRelsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+	workbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+	// style 1 is used for the header row (bold font)
+	stylesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>
+</styleSheet>`
+
+	maxSheetNameLength = 31
+)
+
+// ColumnName returns spreadsheet column name (A, B, ..., Z, AA, ...) of zero based index
+func ColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+func sanitizeSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > maxSheetNameLength {
+		name = string(runes[:maxSheetNameLength])
+	}
+	if name == "" {
+		name = "Sheet1"
+	}
+	return name
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func writeCell(w io.Writer, ref string, value interface{}, style int) error {
+	attrs := fmt.Sprintf(`r="%s"`, ref)
+	if style > 0 {
+		attrs += fmt.Sprintf(` s="%d"`, style)
+	}
+	var err error
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case json.Number:
+		if _, perr := v.Float64(); perr != nil {
+			return writeCell(w, ref, v.String(), style)
+		}
+		_, err = fmt.Fprintf(w, `<c %s><v>%s</v></c>`, attrs, v.String())
+	case float64:
+		_, err = fmt.Fprintf(w, `<c %s><v>%s</v></c>`, attrs, strconv.FormatFloat(v, 'f', -1, 64))
+	case int:
+		_, err = fmt.Fprintf(w, `<c %s><v>%d</v></c>`, attrs, v)
+	case int64:
+		_, err = fmt.Fprintf(w, `<c %s><v>%d</v></c>`, attrs, v)
+	case bool:
+		b := 0
+		if v {
+			b = 1
+		}
+		_, err = fmt.Fprintf(w, `<c %s t="b"><v>%d</v></c>`, attrs, b)
+	case string:
+		_, err = fmt.Fprintf(w, `<c %s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, attrs, escape(v))
+	default:
+		data, jerr := json.Marshal(v)
+		if jerr != nil {
+			return jerr
+		}
+		return writeCell(w, ref, string(data), style)
+	}
+	return err
+}
+
+func writeRow(w io.Writer, index int, values []interface{}, style int) error {
+	if _, err := fmt.Fprintf(w, `<row r="%d">`, index); err != nil {
+		return err
+	}
+	for i, v := range values {
+		if err := writeCell(w, fmt.Sprintf("%s%d", ColumnName(i), index), v, style); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "</row>")
+	return err
+}
+
+// Write writes spreadsheet with a single sheet. Supported cell values are strings, numbers
+// (including json.Number) and booleans, other values are serialized into JSON strings.
+func Write(w io.Writer, sheetName string, header []string, rows [][]interface{}) error {
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypesXML},
+		{"_rels/.rels", relsXML},
+		{"xl/workbook.xml", fmt.Sprintf(workbookXML, escape(sanitizeSheetName(sheetName)))},
+		{"xl/_rels/workbook.xml.rels", workbookRelsXML},
+		{"xl/styles.xml", stylesXML},
+	}
+	for _, f := range files {
+		dest, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(dest, f.content); err != nil {
+			return err
+		}
+	}
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if err != nil {
+		return err
+	}
+	if len(header) > 0 {
+		// freeze header row
+		_, err = io.WriteString(sheet, `<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(sheet, "<sheetData>"); err != nil {
+		return err
+	}
+	rowIndex := 1
+	if len(header) > 0 {
+		values := make([]interface{}, len(header))
+		for i, h := range header {
+			values[i] = h
+		}
+		if err := writeRow(sheet, rowIndex, values, 1); err != nil {
+			return err
+		}
+		rowIndex++
+	}
+	for _, row := range rows {
+		if err := writeRow(sheet, rowIndex, row, 0); err != nil {
+			return err
+		}
+		rowIndex++
+	}
+	if _, err := io.WriteString(sheet, "</sheetData></worksheet>"); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -49,23 +49,31 @@ func cacheMetrics() *metrics {
 type Cache struct {
 	Root      string
 	ServerURL string
-	log       *zap.SugaredLogger
-	client    *http.Client
-	tileLock  singleflight.Group
-	metrics   *metrics
+	// projects directory as seen by the map server
+	ProjectsRoot string
+	log          *zap.SugaredLogger
+	client       *http.Client
+	tileLock     singleflight.Group
+	metrics      *metrics
 }
 
-func NewMapcache(log *zap.SugaredLogger, root string, mapserverURL string) *Cache {
+func NewMapcache(log *zap.SugaredLogger, root string, mapserverURL string, mapserverProjectsRoot string) *Cache {
 	return &Cache{
-		Root:      root,
-		ServerURL: mapserverURL,
-		log:       log,
-		client:    &http.Client{},
-		tileLock:  singleflight.Group{},
-		metrics:   cacheMetrics(),
+		Root:         root,
+		ServerURL:    mapserverURL,
+		ProjectsRoot: mapserverProjectsRoot,
+		log:          log,
+		client:       &http.Client{},
+		tileLock:     singleflight.Group{},
+		metrics:      cacheMetrics(),
 	}
 }
 
+// Returns path of the project file as seen by the map server (MAP parameter)
+func (c *Cache) mapPath(p *domain.Project) string {
+	return filepath.Join(c.ProjectsRoot, p.Info.Map)
+}
+
 func (c *Cache) Clear(project *domain.Project) error {
 	projectHash := fmt.Sprintf("%x", md5.Sum([]byte(project.Info.FullName)))
 	dir := filepath.Join(c.Root, projectHash)
@@ -78,7 +86,7 @@ func (c *Cache) GetLayer(p *domain.Project, layers string) Layer {
 	layersHash := fmt.Sprintf("%x", md5.Sum([]byte(layers)))
 
 	return Layer{
-		Map:         filepath.Join("/publish", p.Info.Map),
+		Map:         c.mapPath(p),
 		Project:     projectHash,
 		Publish:     "",
 		Name:        layersHash,
@@ -160,7 +168,7 @@ func (c *Cache) GetTileFile(p *domain.Project, tile Tile) (string, error) {
 		c.metrics.counter.Inc()
 		metatileUrl = layer.GetMetaTileURL(metatile)
 		q := metatileUrl.Query()
-		q.Set("MAP", filepath.Join("/publish", p.Info.Map))
+		q.Set("MAP", c.mapPath(p))
 		metatileUrl.RawQuery = q.Encode()
 		c.log.Infow("fetching metatile", "service", "mapcache", "url", metatileUrl.String())
 
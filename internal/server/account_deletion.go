@@ -0,0 +1,303 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Personal data of the user included in the data export
+type accountExport struct {
+	Username  string            `json:"username"`
+	Email     string            `json:"email"`
+	FirstName string            `json:"first_name"`
+	LastName  string            `json:"last_name"`
+	Superuser bool              `json:"is_superuser"`
+	Created   *time.Time        `json:"created_at"`
+	Confirmed *time.Time        `json:"confirmed_at"`
+	LastLogin *time.Time        `json:"last_login_at"`
+	Profile   map[string]any    `json:"profile,omitempty"`
+	Groups    []string          `json:"groups"`
+	Tokens    []domain.APIToken `json:"api_tokens"`
+}
+
+// Directory of the user with projects and user's settings files
+func (s *Server) userDirectory(username string) (string, error) {
+	if username == "" || username != filepath.Base(username) || strings.HasPrefix(username, ".") {
+		return "", fmt.Errorf("invalid username: %q", username)
+	}
+	return filepath.Join(s.Config.ProjectsRoot, username), nil
+}
+
+// Exports personal data of the user (account info, list of projects with their settings
+// and user's settings files) as a zip archive
+func (s *Server) handleExportAccountData(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	account, err := s.accountsService.Repository.GetByUsername(user.Username)
+	if err != nil {
+		return fmt.Errorf("getting account: %w", err)
+	}
+	tokens, err := s.auth.ListAPITokens(user.Username)
+	if err != nil {
+		return fmt.Errorf("listing API tokens: %w", err)
+	}
+	userDir, err := s.userDirectory(user.Username)
+	if err != nil {
+		return err
+	}
+	projects, err := s.projects.GetUserProjects(user.Username)
+	if err != nil {
+		return fmt.Errorf("listing user projects: %w", err)
+	}
+	data := accountExport{
+		Username:  account.Username,
+		Email:     account.Email,
+		FirstName: account.FirstName,
+		LastName:  account.LastName,
+		Superuser: account.Superuser,
+		Created:   account.Created,
+		Confirmed: account.Confirmed,
+		LastLogin: account.LastLogin,
+		Profile:   account.Profile,
+		Groups:    user.Groups,
+		Tokens:    tokens,
+	}
+	if data.Groups == nil {
+		data.Groups = []string{}
+	}
+
+	resp := c.Response()
+	filename := fmt.Sprintf("gisquick-%s-%s.zip", user.Username, time.Now().Format("20060102"))
+	resp.Header().Set(echo.HeaderContentType, "application/zip")
+	resp.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	resp.WriteHeader(http.StatusOK)
+
+	zw := s.newZipWriter(resp)
+	writeJSON := func(name string, v interface{}) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	if err := writeJSON("account.json", data); err != nil {
+		return fmt.Errorf("exporting account data: %w", err)
+	}
+	if err := writeJSON("projects.json", projects); err != nil {
+		return fmt.Errorf("exporting account data: %w", err)
+	}
+	for _, p := range projects {
+		path := filepath.Join(s.Config.ProjectsRoot, p.Name, ".gisquick", "settings.json")
+		info, err := os.Stat(path)
+		if err != nil {
+			// settings are not available before the first publishing
+			continue
+		}
+		if err := s.addZipFile(zw, path, filepath.Join("projects", p.Name, "settings.json"), info); err != nil {
+			return fmt.Errorf("exporting project settings: %w", err)
+		}
+	}
+	// user's settings files (dashboard, notifications, settings templates)
+	entries, err := os.ReadDir(userDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading user directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("exporting user settings: %w", err)
+		}
+		if err := s.addZipFile(zw, filepath.Join(userDir, entry.Name()), filepath.Join("settings", entry.Name()), info); err != nil {
+			return fmt.Errorf("exporting user settings: %w", err)
+		}
+	}
+	s.log.Infow("account data exported", "username", user.Username)
+	return zw.Close()
+}
+
+func (s *Server) handleGetAccountDeletion(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	deletion, err := s.accountsService.GetDeletion(user.Username)
+	if err != nil {
+		if errors.Is(err, domain.ErrAccountDeletionNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, deletion)
+}
+
+func (s *Server) sendAccountDeletionEmail(account domain.Account, deletion domain.AccountDeletion) error {
+	tmpl, err := texttemplate.ParseFiles("./templates/account_deletion_email.txt", "./templates/email_base.txt")
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"Scheduled": deletion.Scheduled.Format("2006-01-02 15:04 MST"),
+	}
+	return s.accountsService.Email.SendBulkEmail([]domain.Account{account}, "Deletion of your Gisquick account", nil, tmpl, data)
+}
+
+// Schedules deletion of the user's account (confirmed by the password), the account is deleted
+// after the grace period or immediately when the grace period is not configured
+func (s *Server) handleScheduleAccountDeletion() func(echo.Context) error {
+	type DeletionForm struct {
+		Password string `json:"password"`
+	}
+	return func(c echo.Context) error {
+		// deletion must be confirmed by the account owner, not by an (possibly leaked) API token
+		if c.Get("api_token") != nil {
+			return echo.NewHTTPError(http.StatusForbidden, "API token can't be used to delete account")
+		}
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		form := new(DeletionForm)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		account, err := s.accountsService.Repository.GetByUsername(user.Username)
+		if err != nil {
+			return fmt.Errorf("getting account: %w", err)
+		}
+		if account.Superuser {
+			return echo.NewHTTPError(http.StatusForbidden, "Superuser account can be deleted only by another superuser")
+		}
+		if len(account.Password) > 0 {
+			if !account.CheckPassword(form.Password) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Password doesn't match")
+			}
+		} else {
+			// accounts without password (e.g. created by OIDC login) are confirmed by the interactive session
+			si, err := s.auth.GetSessionInfo(c)
+			if err != nil {
+				return fmt.Errorf("getting session info: %w", err)
+			}
+			if si == nil {
+				return echo.NewHTTPError(http.StatusForbidden, "Account deletion must be confirmed in a login session")
+			}
+		}
+		if s.Config.AccountDeletionGrace <= 0 {
+			if err := s.deleteUserAccount(c.Request().Context(), user.Username); err != nil {
+				return err
+			}
+			s.auth.LogoutUser(c)
+			return c.NoContent(http.StatusNoContent)
+		}
+		deletion, err := s.accountsService.ScheduleDeletion(user.Username, s.Config.AccountDeletionGrace)
+		if err != nil {
+			if errors.Is(err, application.ErrAccountDeletionNotSupported) {
+				return echo.NewHTTPError(http.StatusNotImplemented, err.Error())
+			}
+			return fmt.Errorf("scheduling account deletion: %w", err)
+		}
+		s.log.Infow("account deletion scheduled", "username", user.Username, "scheduled", deletion.Scheduled)
+		if s.accountsService.SupportEmails() && account.Email != "" {
+			if err := s.sendAccountDeletionEmail(account, deletion); err != nil {
+				s.log.Errorw("sending account deletion email", "username", user.Username, zap.Error(err))
+			}
+		}
+		return c.JSON(http.StatusOK, deletion)
+	}
+}
+
+func (s *Server) handleCancelAccountDeletion(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	if err := s.accountsService.CancelDeletion(user.Username); err != nil {
+		if errors.Is(err, domain.ErrAccountDeletionNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return err
+	}
+	s.log.Infow("account deletion cancelled", "username", user.Username)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Deletes the account with all projects, user's files and sessions
+func (s *Server) deleteUserAccount(ctx context.Context, username string) error {
+	userDir, err := s.userDirectory(username)
+	if err != nil {
+		return err
+	}
+	// user is logged out first, so the projects can't be modified during the deletion
+	if err := s.auth.RevokeUser(ctx, username); err != nil {
+		s.log.Errorw("revoking user sessions", "username", username, zap.Error(err))
+	}
+	projects, err := s.projects.GetUserProjects(username)
+	if err != nil {
+		return fmt.Errorf("listing user projects: %w", err)
+	}
+	for _, p := range projects {
+		if err := s.deleteProject(ctx, p.Name); err != nil && !errors.Is(err, domain.ErrProjectNotExists) {
+			return fmt.Errorf("deleting project %s: %w", p.Name, err)
+		}
+	}
+	if err := os.RemoveAll(userDir); err != nil {
+		return fmt.Errorf("deleting user directory: %w", err)
+	}
+	if err := s.accountsService.Repository.Delete(username); err != nil {
+		return fmt.Errorf("deleting account: %w", err)
+	}
+	s.log.Infow("account deleted", "username", username, "projects", len(projects))
+	return nil
+}
+
+func (s *Server) deleteScheduledAccounts(ctx context.Context) error {
+	if s.accountsService.Deletions == nil {
+		return nil
+	}
+	deletions, err := s.accountsService.Deletions.Due(time.Now())
+	if err != nil {
+		return err
+	}
+	for _, d := range deletions {
+		if err := s.deleteUserAccount(ctx, d.Username); err != nil {
+			s.log.Errorw("deleting account", "username", d.Username, zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// DeleteScheduledAccounts periodically deletes accounts after their grace period until the context
+// is cancelled
+func (s *Server) DeleteScheduledAccounts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.deleteScheduledAccounts(ctx); err != nil {
+				s.log.Errorw("deleting scheduled accounts", zap.Error(err))
+			}
+		}
+	}
+}
@@ -35,7 +35,15 @@ func (s *Server) handleSignUp() func(echo.Context) error {
 		if form.Password != form.PasswordConfirm {
 			return echo.NewHTTPError(http.StatusBadRequest, "Password doesn't match")
 		}
-		_, err := s.accountsService.NewAccount(form.Username, form.Email, form.FirstName, form.LastName, form.Password)
+		if err := s.Config.Passwords.Validate(form.Password); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		username, err := s.Config.Names.NormalizeUsername(form.Username)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		form.Username = username
+		_, err = s.accountsService.NewAccount(form.Username, form.Email, form.FirstName, form.LastName, form.Password)
 		if err != nil {
 			if errors.Is(err, domain.ErrAccountExists) {
 				return echo.NewHTTPError(http.StatusBadRequest, "Account already exists")
@@ -65,7 +73,12 @@ func (s *Server) handleInvitation() func(echo.Context) error {
 		if err := validate.Struct(form); err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
-		_, err := s.accountsService.NewAccount(form.Username, form.Email, form.FirstName, form.LastName, "")
+		username, err := s.Config.Names.NormalizeUsername(form.Username)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		form.Username = username
+		_, err = s.accountsService.NewAccount(form.Username, form.Email, form.FirstName, form.LastName, "")
 		if err != nil {
 			if errors.Is(err, domain.ErrAccountExists) {
 				return echo.NewHTTPError(http.StatusBadRequest, "Account already exists")
@@ -116,7 +129,11 @@ func (s *Server) handleCheckAvailability() func(echo.Context) error {
 		var err error
 		switch field {
 		case "username":
-			exists, err = s.accountsService.Repository.UsernameExists(value)
+			username, verr := s.Config.Names.NormalizeUsername(value)
+			if verr != nil {
+				return c.JSON(http.StatusOK, Resp{Available: false})
+			}
+			exists, err = s.accountsService.Repository.UsernameExists(username)
 		case "email":
 			exists, err = s.accountsService.Repository.EmailExists(value) // strings.ToLower()?
 		default:
@@ -154,6 +171,33 @@ func (s *Server) handlePasswordReset() func(echo.Context) error {
 	}
 }
 
+func (s *Server) handleResendActivation() func(echo.Context) error {
+	type ResendActivationForm struct {
+		Email string `json:"email" form:"email" validate:"required,email"`
+	}
+	var validate = validator.New()
+	return func(c echo.Context) error {
+		form := new(ResendActivationForm)
+		if err := c.Bind(form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err := validate.Struct(form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err := s.accountsService.ResendActivationEmail(form.Email); err != nil {
+			if errors.Is(err, domain.ErrAccountNotFound) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Account with given email doesn't exist")
+			} else if errors.Is(err, domain.ErrAccountActive) {
+				return echo.NewHTTPError(http.StatusConflict, "Account already active")
+			} else if errors.Is(err, application.ErrNotActiveAccount) {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	}
+}
+
 func (s *Server) handleNewPassword() func(echo.Context) error {
 	type NewPasswordForm struct {
 		UID             string `query:"uid" validate:"required"`
@@ -176,6 +220,9 @@ func (s *Server) handleNewPassword() func(echo.Context) error {
 		if form.Password != form.PasswordConfirm {
 			return echo.NewHTTPError(http.StatusBadRequest, "Passwords doesn't match")
 		}
+		if err := s.Config.Passwords.Validate(form.Password); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
 		err := s.accountsService.SetNewPassword(form.UID, form.Token, form.Password)
 		if err != nil {
 			if errors.Is(err, application.ErrInvalidToken) {
@@ -204,6 +251,9 @@ func (s *Server) handleChangePassword() func(echo.Context) error {
 		if form.NewPassword != form.NewPasswordConfirm {
 			return echo.NewHTTPError(http.StatusBadRequest, "New passwords doesn't match")
 		}
+		if err := s.Config.Passwords.Validate(form.NewPassword); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
 		sessionInfo, err := s.auth.GetSessionInfo(c)
 		if err != nil {
 			return err
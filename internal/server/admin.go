@@ -11,6 +11,7 @@ import (
 	texttemplate "text/template"
 	"time"
 
+	"github.com/gisquick/gisquick-server/internal/application"
 	"github.com/gisquick/gisquick-server/internal/domain"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/email"
 	"github.com/labstack/echo/v4"
@@ -140,8 +141,12 @@ func (s *Server) handleCreateUser() func(echo.Context) error {
 		if form.SendEmail && !s.accountsService.SupportEmails() {
 			return echo.NewHTTPError(http.StatusPreconditionFailed, "Email service not supported")
 		}
+		username, err := s.Config.Names.NormalizeUsername(form.Username)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
 		account, err := domain.NewAccount(
-			form.Username,
+			username,
 			form.Email,
 			form.FirstName,
 			form.LastName,
@@ -156,6 +161,7 @@ func (s *Server) handleCreateUser() func(echo.Context) error {
 			s.log.Errorw("creating account", "username", form.Username, zap.Error(err))
 			return fmt.Errorf("failed to create user account")
 		}
+		s.events.Publish(application.Event{Type: application.EventUserRegistered, User: account.Username})
 		if len(form.Profile) > 0 {
 			account.Profile = form.Profile
 			if err := s.accountsService.Repository.UpdateProfile(account); err != nil {
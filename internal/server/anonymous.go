@@ -0,0 +1,107 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/infrastructure/throttle"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// Requests rate limits of anonymous map consumers (public projects), in requests per second
+// with burst allowance (0 rate means unlimited). Authenticated users are not limited.
+type AnonymousLimitsConfig struct {
+	GlobalRate  float64
+	GlobalBurst int
+	IPRate      float64
+	IPBurst     int
+}
+
+var anonymousRequestsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "anonymous_requests_total",
+		Help: "Counts map requests of anonymous users by result (accepted, limited_global, limited_ip).",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(anonymousRequestsCounter)
+}
+
+type anonymousLimiters struct {
+	config AnonymousLimitsConfig
+	global *rate.Limiter
+	ip     *throttle.KeyedLimiters
+}
+
+func newAnonymousLimiters(cfg AnonymousLimitsConfig) *anonymousLimiters {
+	return &anonymousLimiters{
+		config: cfg,
+		global: throttle.NewRequestLimiter(cfg.GlobalRate, cfg.GlobalBurst),
+		ip:     throttle.NewKeyedRequestLimiters(cfg.IPRate, cfg.IPBurst),
+	}
+}
+
+func (l *anonymousLimiters) enabled() bool {
+	return l.config.GlobalRate > 0 || l.config.IPRate > 0
+}
+
+// Reserves request in the limiter, returns zero delay when request is allowed (reservation
+// of rejected request is canceled, so it doesn't consume tokens)
+func reserve(l *rate.Limiter, now time.Time) time.Duration {
+	if l == nil {
+		return 0
+	}
+	r := l.ReserveN(now, 1)
+	if !r.OK() {
+		return time.Second
+	}
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay
+	}
+	return 0
+}
+
+func rateLimitedError(c echo.Context, delay time.Duration) error {
+	retry := int(math.Ceil(delay.Seconds()))
+	if retry < 1 {
+		retry = 1
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(retry))
+	return echo.NewHTTPError(http.StatusTooManyRequests, "Too many requests")
+}
+
+// AnonymousRateLimitMiddleware applies requests rate limits to unauthenticated users
+func AnonymousRateLimitMiddleware(a *auth.AuthService, l *anonymousLimiters) echo.MiddlewareFunc {
+	if !l.enabled() {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if user, err := a.GetUser(c); err == nil && user.IsAuthenticated {
+				return next(c)
+			}
+			now := time.Now()
+			// per IP limit is checked first, so a single client cannot exhaust the global limit
+			if delay := reserve(l.ip.Get(c.RealIP()), now); delay > 0 {
+				anonymousRequestsCounter.WithLabelValues("limited_ip").Inc()
+				return rateLimitedError(c, delay)
+			}
+			if delay := reserve(l.global, now); delay > 0 {
+				anonymousRequestsCounter.WithLabelValues("limited_global").Inc()
+				return rateLimitedError(c, delay)
+			}
+			anonymousRequestsCounter.WithLabelValues("accepted").Inc()
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	maxAPITokensPerUser = 20
+	maxAPITokenDuration = 5 * 365 * 24 * time.Hour
+)
+
+// Authenticates requests to the API with personal API token (Authorization: Bearer <token>),
+// so scripts and desktop clients can access protected endpoints without session cookie
+func (s *Server) apiTokenMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		header := c.Request().Header.Get("Authorization")
+		if !strings.HasPrefix(c.Request().URL.Path, "/api/") || len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+			return next(c)
+		}
+		user, tokenID, err := s.auth.AuthenticateAPIToken(strings.TrimSpace(header[7:]))
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidAPIToken) {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="gisquick"`)
+				return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+			}
+			return err
+		}
+		c.Set("user", user)
+		c.Set("api_token", tokenID)
+		return next(c)
+	}
+}
+
+func (s *Server) handleGetAPITokens(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	tokens, err := s.auth.ListAPITokens(user.Username)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
+
+func (s *Server) handleCreateAPIToken() func(echo.Context) error {
+	type TokenForm struct {
+		Name string `json:"name"`
+		// duration in days or exact expiration time (token without expiration when not set)
+		Days    int        `json:"days"`
+		Expires *time.Time `json:"expires"`
+	}
+	type TokenResponse struct {
+		domain.APIToken
+		Token string `json:"token"`
+	}
+	return func(c echo.Context) error {
+		// tokens can't be used to create new tokens
+		if c.Get("api_token") != nil {
+			return echo.NewHTTPError(http.StatusForbidden, "API token can't be used to create tokens")
+		}
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		form := new(TokenForm)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		form.Name = strings.TrimSpace(form.Name)
+		if form.Name == "" || len(form.Name) > 100 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid token name")
+		}
+		now := time.Now().UTC()
+		var expires *time.Time
+		if form.Expires != nil {
+			t := form.Expires.UTC()
+			expires = &t
+		} else if form.Days > 0 {
+			t := now.Add(time.Duration(form.Days) * 24 * time.Hour)
+			expires = &t
+		}
+		if expires != nil && (!expires.After(now) || expires.Sub(now) > maxAPITokenDuration) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid expiration of the token")
+		}
+		tokens, err := s.auth.ListAPITokens(user.Username)
+		if err != nil {
+			return err
+		}
+		if len(tokens) >= maxAPITokensPerUser {
+			return echo.NewHTTPError(http.StatusConflict, "Maximal number of API tokens reached")
+		}
+		token, secret, err := s.auth.CreateAPIToken(user.Username, form.Name, expires)
+		if err != nil {
+			return err
+		}
+		s.log.Infow("API token created", "user", user.Username, "token", token.ID)
+		return c.JSON(http.StatusOK, TokenResponse{APIToken: token, Token: secret})
+	}
+}
+
+func (s *Server) handleRevokeAPIToken(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	if err := s.auth.RevokeAPIToken(user.Username, c.Param("id")); err != nil {
+		if errors.Is(err, domain.ErrAPITokenNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return err
+	}
+	s.log.Infow("API token revoked", "user", user.Username, "token", c.Param("id"))
+	return c.NoContent(http.StatusNoContent)
+}
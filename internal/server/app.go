@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/gisquick/gisquick-server/internal/domain"
@@ -24,18 +25,32 @@ type AppConfig struct {
 	} `json:"languages,omitempty"`
 }
 
-type AppData struct {
-	AppConfig
-	PasswordResetUrl string `json:"reset_password_url,omitempty"`
+// Capabilities enabled on the server, so the web client can adapt its UI
+type AppFeatures struct {
+	Signup          bool `json:"signup"`
+	PasswordReset   bool `json:"password_reset"`
+	MapCache        bool `json:"map_cache"`
+	OfflinePackages bool `json:"offline_packages"`
+	Reports         bool `json:"reports"`
+	Catalog         bool `json:"catalog"`
+	CogConversion   bool `json:"cog_conversion"`
+	Customization   bool `json:"project_customization"`
+	OIDCLogin       bool `json:"oidc_login"`
+	UserDirectory   bool `json:"user_directory"`
+	// account limits of the current user (nil for anonymous user)
+	Quotas *domain.AccountConfig `json:"quotas,omitempty"`
 }
 
-type UserInfo struct {
-	Username  string         `json:"username"`
-	FirstName string         `json:"first_name"`
-	LastName  string         `json:"last_name"`
-	FullName  string         `json:"full_name"`
-	Active    bool           `json:"active"`
-	Profile   map[string]any `json:"profile,omitempty"`
+type AppData struct {
+	AppConfig
+	PasswordResetUrl string       `json:"reset_password_url,omitempty"`
+	Branding         *Branding    `json:"branding,omitempty"`
+	Help             *HelpContent `json:"help,omitempty"`
+	Features         AppFeatures  `json:"features"`
+	// requirements on the new passwords
+	PasswordPolicy PasswordPolicy `json:"password_policy"`
+	// maintenance mode info for publishers (nil when disabled)
+	Maintenance *MaintenanceMode `json:"maintenance,omitempty"`
 }
 
 type UserData struct {
@@ -64,6 +79,30 @@ func (s *Server) getUserProfile(user domain.User) (map[string]interface{}, error
 	return userProfile, nil
 }
 
+func (s *Server) appFeatures(user domain.User) AppFeatures {
+	features := AppFeatures{
+		Signup:          s.Config.SignupAPI,
+		PasswordReset:   s.accountsService.SupportEmails(),
+		MapCache:        s.Config.MapCacheRoot != "",
+		OfflinePackages: s.Config.OfflineRoot != "",
+		Reports:         s.Config.ReportsRoot != "",
+		Catalog:         s.Config.Catalog != nil,
+		CogConversion:   s.Config.Cog.Converter != "",
+		Customization:   s.Config.ProjectCustomization,
+		OIDCLogin:       s.Config.OIDC != nil,
+		UserDirectory:   s.Config.UserDirectory,
+	}
+	if user.IsAuthenticated {
+		limits, err := s.limiter.GetAccountLimits(user.Username)
+		if err != nil {
+			s.log.Errorw("getting user account limits", "user", user.Username, zap.Error(err))
+		} else {
+			features.Quotas = &limits
+		}
+	}
+	return features
+}
+
 func (s *Server) handleAppInit() func(echo.Context) error {
 	configReader := cache.NewJSONFileReader[AppConfig](time.Hour)
 	s.OnShutdown(configReader.Close)
@@ -87,11 +126,29 @@ func (s *Server) handleAppInit() func(echo.Context) error {
 			s.log.Errorw("reading app configuration file", zap.Error(err))
 		}
 		app := AppData{
-			AppConfig: config,
+			AppConfig:      config,
+			Features:       s.appFeatures(user),
+			PasswordPolicy: s.Config.Passwords,
 		}
 		if s.accountsService.SupportEmails() {
 			app.PasswordResetUrl = "/api/accounts/password_reset"
 		}
+		if user.IsAuthenticated {
+			if mode, err := s.maintenance.Get(); err != nil {
+				s.log.Errorw("reading maintenance mode", zap.Error(err))
+			} else if mode.Enabled {
+				app.Maintenance = &mode
+			}
+		}
+		branding, err := s.loadBranding()
+		if err != nil {
+			s.log.Errorw("loading branding", zap.Error(err))
+		} else {
+			app.Branding = &branding
+		}
+		if app.Help, err = s.appHelpContent(); err != nil {
+			s.log.Errorw("loading help content", zap.Error(err))
+		}
 		data := AppPayload{
 			App:  app,
 			User: UserData{User: user, Profile: userProfile},
@@ -100,8 +157,17 @@ func (s *Server) handleAppInit() func(echo.Context) error {
 	}
 }
 
+// Lifetime of the user's session
+type SessionLifetime struct {
+	Expires     *time.Time `json:"expires,omitempty"`
+	IdleExpires *time.Time `json:"idle_expires,omitempty"`
+	// remaining lifetime in seconds
+	Remaining int64 `json:"remaining"`
+}
+
 type SessionData struct {
-	User domain.User `json:"user"`
+	User    domain.User      `json:"user"`
+	Session *SessionLifetime `json:"session,omitempty"`
 }
 
 func (s *Server) handleGetSessionUser(c echo.Context) error {
@@ -109,24 +175,19 @@ func (s *Server) handleGetSessionUser(c echo.Context) error {
 	if err != nil {
 		return err
 	}
-	return c.JSON(http.StatusOK, SessionData{user})
-}
-
-func (s *Server) handleGetUsers(c echo.Context) error {
-	accounts, err := s.accountsService.GetAllAccounts()
-	if err != nil {
-		return err
-	}
-	res := []UserInfo{}
-	for _, u := range accounts {
-		res = append(res, UserInfo{
-			Username:  u.Username,
-			FirstName: u.FirstName,
-			LastName:  u.LastName,
-			FullName:  u.FullName(),
-			Active:    u.Active,
-			Profile:   u.Profile,
-		})
+	data := SessionData{User: user}
+	if si, err := s.auth.GetSessionInfo(c); err == nil && si != nil && user.IsAuthenticated {
+		lifetime := &SessionLifetime{Remaining: int64(si.Remaining().Seconds())}
+		if !si.Expires.IsZero() {
+			lifetime.Expires = &si.Expires
+		}
+		if !si.IdleExpires.IsZero() {
+			lifetime.IdleExpires = &si.IdleExpires
+		}
+		if lifetime.Remaining > 0 {
+			c.Response().Header().Set("X-Session-Remaining", strconv.FormatInt(lifetime.Remaining, 10))
+		}
+		data.Session = lifetime
 	}
-	return c.JSON(http.StatusOK, res)
+	return c.JSON(http.StatusOK, data)
 }
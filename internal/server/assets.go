@@ -0,0 +1,50 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// In-memory cache of small frequently requested files (0 size disables it)
+type AssetsCacheConfig struct {
+	Size        int64
+	MaxItemSize int64
+}
+
+// Checks If-None-Match request header (list of ETags)
+func etagMatches(c echo.Context, etag string) bool {
+	for _, v := range strings.Split(c.Request().Header.Get("If-None-Match"), ",") {
+		if v = strings.TrimSpace(v); v == etag || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Serves the file from the in-memory assets cache (when enabled and the file is small enough)
+func (s *Server) serveAsset(c echo.Context, path string) error {
+	if s.assets == nil {
+		return c.File(path)
+	}
+	file, err := s.assets.Get(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+	if file == nil {
+		return c.File(path)
+	}
+	resp := c.Response()
+	resp.Header().Set("ETag", file.ETag)
+	// handles conditional (If-None-Match, If-Modified-Since) and range requests
+	http.ServeContent(resp, c.Request(), filepath.Base(path), file.ModTime, bytes.NewReader(file.Data))
+	return nil
+}
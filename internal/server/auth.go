@@ -1,7 +1,11 @@
 package server
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gisquick/gisquick-server/internal/server/auth"
 	"github.com/go-playground/validator/v10"
@@ -23,14 +27,14 @@ func (s *Server) handleLogin() func(echo.Context) error {
 		if err := validate.Struct(form); err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
-		account, err := s.auth.Authenticate(form.Username, form.Password)
+		account, err := s.auth.AuthenticateLimited(c.Request().Context(), c.RealIP(), form.Username, form.Password)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusUnauthorized, "Please provide valid credentials")
+			return loginError(c, err)
 		}
 		if err := s.auth.LoginUser(c, account); err != nil {
 			return err
 		}
-		user := auth.AccountToUser(account)
+		user := s.auth.AccountUser(account)
 		if user.Profile == nil {
 			profile, err := s.getUserProfile(user)
 			if err != nil {
@@ -42,6 +46,40 @@ func (s *Server) handleLogin() func(echo.Context) error {
 	}
 }
 
+// Translates authentication error into response with error code, so the client can guide the user
+func loginError(c echo.Context, err error) error {
+	var lockedErr *auth.AccountLockedError
+	switch {
+	case errors.As(err, &lockedErr):
+		retryAfter := int(math.Ceil(time.Until(lockedErr.Until).Seconds()))
+		c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		return echo.NewHTTPError(http.StatusTooManyRequests, map[string]interface{}{
+			"code":         "account_locked",
+			"message":      "Too many failed login attempts",
+			"locked_until": lockedErr.Until.UTC(),
+		})
+	case errors.Is(err, auth.ErrEmailUnverified):
+		return echo.NewHTTPError(http.StatusForbidden, map[string]string{
+			"code":    "email_unverified",
+			"message": "Account is not activated, check your email or request a new activation email",
+		})
+	case errors.Is(err, auth.ErrAccountInactive):
+		return echo.NewHTTPError(http.StatusForbidden, map[string]string{
+			"code":    "account_inactive",
+			"message": "Account is deactivated",
+		})
+	case errors.Is(err, auth.ErrIdentityNotLinked):
+		return echo.NewHTTPError(http.StatusForbidden, map[string]string{
+			"code":    "identity_not_linked",
+			"message": "Identity is not linked to any account, sign in with your password and link it in the account settings",
+		})
+	}
+	return echo.NewHTTPError(http.StatusUnauthorized, map[string]string{
+		"code":    "invalid_credentials",
+		"message": "Please provide valid credentials",
+	})
+}
+
 func (s *Server) handleLogout(c echo.Context) error {
 	s.auth.LogoutUser(c)
 	return c.NoContent(http.StatusOK)
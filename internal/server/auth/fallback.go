@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jellydator/ttlcache/v3"
+	"go.uber.org/zap"
+)
+
+var ErrStoreUnavailable = errors.New("session store is unavailable")
+
+type pendingSession struct {
+	data    string
+	expires time.Time
+	deleted bool
+}
+
+// FallbackSessionStore keeps recently used sessions in memory, so already logged users can continue
+// to work when redis is temporarily unavailable. Sessions created, updated or deleted during
+// the outage are written into redis after it is available again.
+type FallbackSessionStore struct {
+	*RedisSessionStore
+	log         *zap.SugaredLogger
+	ttl         time.Duration
+	unavailable int32
+	sessions    *ttlcache.Cache[string, string]
+	mu          sync.Mutex
+	pending     map[string]pendingSession
+}
+
+// NewFallbackSessionStore creates session store with in-memory fallback, sessions are accepted from
+// the memory for the ttl duration since they were last read from redis (0 disables the fallback)
+func NewFallbackSessionStore(log *zap.SugaredLogger, store *RedisSessionStore, ttl time.Duration) *FallbackSessionStore {
+	return &FallbackSessionStore{
+		RedisSessionStore: store,
+		log:               log,
+		ttl:               ttl,
+		sessions:          ttlcache.New(ttlcache.WithDisableTouchOnHit[string, string]()),
+		pending:           make(map[string]pendingSession),
+	}
+}
+
+// Available reports whether redis is available
+func (s *FallbackSessionStore) Available() bool {
+	return atomic.LoadInt32(&s.unavailable) == 0
+}
+
+// Reports whether the redis error means that redis is not reachable. Errors of single commands
+// (e.g. cancelled request, missing key) must not switch the store into the fallback mode.
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, redis.Nil) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, redis.ErrClosed) ||
+		// pool.ErrPoolTimeout (internal package of the redis client)
+		strings.Contains(err.Error(), "connection pool timeout")
+}
+
+func (s *FallbackSessionStore) setUnavailable(err error) {
+	if atomic.CompareAndSwapInt32(&s.unavailable, 0, 1) {
+		s.log.Errorw("session store is unavailable, using in-memory fallback", zap.Error(err))
+	}
+}
+
+func (s *FallbackSessionStore) remember(sessionID, data string, expiration time.Duration) {
+	if s.ttl <= 0 {
+		return
+	}
+	if expiration <= 0 || expiration > s.ttl {
+		expiration = s.ttl
+	}
+	s.sessions.Set(sessionID, data, expiration)
+}
+
+func (s *FallbackSessionStore) Set(ctx context.Context, sessionID, data string, expiration time.Duration) error {
+	s.remember(sessionID, data, expiration)
+	if s.Available() {
+		err := s.RedisSessionStore.Set(ctx, sessionID, data, expiration)
+		if !isConnectionError(err) {
+			return err
+		}
+		s.setUnavailable(err)
+	}
+	if s.ttl <= 0 {
+		return ErrStoreUnavailable
+	}
+	s.mu.Lock()
+	s.pending[sessionID] = pendingSession{data: data, expires: time.Now().Add(expiration)}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *FallbackSessionStore) Get(ctx context.Context, sessionID string) (string, error) {
+	if s.Available() {
+		data, err := s.RedisSessionStore.Get(ctx, sessionID)
+		if err == nil {
+			s.remember(sessionID, data, s.ttl)
+			return data, nil
+		}
+		if errors.Is(err, ErrInvalidSession) {
+			s.sessions.Delete(sessionID)
+			return "", err
+		}
+		if !isConnectionError(err) {
+			return "", err
+		}
+		s.setUnavailable(err)
+	}
+	if item := s.sessions.Get(sessionID); item != nil {
+		return item.Value(), nil
+	}
+	// unknown session can't be rejected (user would be logged out) until redis is available
+	return "", ErrStoreUnavailable
+}
+
+func (s *FallbackSessionStore) Del(ctx context.Context, sessionID string) error {
+	s.sessions.Delete(sessionID)
+	if s.Available() {
+		err := s.RedisSessionStore.Del(ctx, sessionID)
+		if !isConnectionError(err) {
+			return err
+		}
+		s.setUnavailable(err)
+	}
+	s.mu.Lock()
+	s.pending[sessionID] = pendingSession{deleted: true}
+	s.mu.Unlock()
+	return nil
+}
+
+// DelUserSessions removes all sessions of the user
+func (s *FallbackSessionStore) DelUserSessions(ctx context.Context, username string) error {
+	for _, item := range s.sessions.Items() {
+		if parseSessionData(item.Value()).Username == username {
+			s.sessions.Delete(item.Key())
+		}
+	}
+	s.mu.Lock()
+	for id, p := range s.pending {
+		if !p.deleted && parseSessionData(p.data).Username == username {
+			delete(s.pending, id)
+		}
+	}
+	s.mu.Unlock()
+	return s.RedisSessionStore.DelUserSessions(ctx, username)
+}
+
+// Writes changes of the sessions made during the outage into redis
+func (s *FallbackSessionStore) flushPending(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, p := range s.pending {
+		var err error
+		if p.deleted {
+			err = s.RedisSessionStore.Del(ctx, id)
+		} else if ttl := p.expires.Sub(now); ttl > 0 {
+			err = s.RedisSessionStore.Set(ctx, id, p.data, ttl)
+		}
+		if err != nil {
+			return err
+		}
+		delete(s.pending, id)
+	}
+	return nil
+}
+
+// Monitor periodically checks availability of redis and recovers from the fallback mode
+// until the context is cancelled
+func (s *FallbackSessionStore) Monitor(ctx context.Context, interval time.Duration) {
+	go s.sessions.Start()
+	defer s.sessions.Stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.rdb.Ping(ctx).Err(); err != nil {
+				if isConnectionError(err) {
+					s.setUnavailable(err)
+				}
+				continue
+			}
+			if s.Available() {
+				continue
+			}
+			if err := s.flushPending(ctx); err != nil {
+				s.log.Errorw("restoring sessions in session store", zap.Error(err))
+				continue
+			}
+			atomic.StoreInt32(&s.unavailable, 0)
+			// changes made while the recovery was in progress
+			if err := s.flushPending(ctx); err != nil {
+				s.log.Errorw("restoring sessions in session store", zap.Error(err))
+			}
+			s.log.Infow("session store is available again")
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{redis.Nil, false},
+		{context.Canceled, false},
+		{fmt.Errorf("redis get session: %w", context.DeadlineExceeded), false},
+		{&net.OpError{Op: "dial", Err: context.Canceled}, false},
+		{errors.New("ERR wrong number of arguments"), false},
+		{io.EOF, true},
+		{fmt.Errorf("redis save session: %w", io.EOF), true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{errors.New("redis: connection pool timeout"), true},
+		{redis.ErrClosed, true},
+	}
+	for _, tt := range tests {
+		if res := isConnectionError(tt.err); res != tt.expected {
+			t.Errorf("%v: got %v, expected %v", tt.err, res, tt.expected)
+		}
+	}
+}
+
+// redis client of unreachable server
+func unreachableRedis() *redis.Client {
+	return redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 100 * time.Millisecond, MaxRetries: -1})
+}
+
+func TestFallbackStoreCancelledRequest(t *testing.T) {
+	store := NewFallbackSessionStore(zap.NewNop().Sugar(), NewRedisStore(unreachableRedis()), time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := store.Get(ctx, "session"); err == nil {
+		t.Fatal("expected error")
+	}
+	if !store.Available() {
+		t.Fatal("cancelled request switched store into fallback mode")
+	}
+	if _, err := store.Get(context.Background(), "session"); !errors.Is(err, ErrStoreUnavailable) {
+		t.Fatalf("expected ErrStoreUnavailable, got %v", err)
+	}
+	if store.Available() {
+		t.Fatal("unreachable redis didn't switch store into fallback mode")
+	}
+}
+
+func TestLoginRateLimiterFallback(t *testing.T) {
+	l := NewLoginRateLimiter(unreachableRedis(), LoginRateLimitConfig{
+		IPAttempts:       5,
+		UsernameAttempts: 3,
+		Window:           time.Minute,
+		Lockout:          time.Minute,
+	})
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := l.Check(ctx, fmt.Sprintf("192.0.2.%d", i), "admin"); err != nil {
+			t.Fatalf("attempt %d: unexpected lock: %v", i, err)
+		}
+		if err := l.Failed(ctx, fmt.Sprintf("192.0.2.%d", i), "admin"); err == nil {
+			t.Fatal("expected redis error")
+		}
+	}
+	var lockedErr *AccountLockedError
+	if err := l.Check(ctx, "198.51.100.1", "admin"); !errors.As(err, &lockedErr) {
+		t.Fatalf("expected locked account, got %v", err)
+	}
+	if err := l.Check(ctx, "198.51.100.1", "other"); err != nil {
+		t.Fatalf("unexpected lock of other account: %v", err)
+	}
+}
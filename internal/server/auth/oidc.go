@@ -0,0 +1,485 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+var (
+	ErrInvalidIDToken    = errors.New("Invalid ID token")
+	ErrIdentityNotLinked = errors.New("Identity is not linked to any account")
+)
+
+const (
+	oidcRequestTimeout = 15 * time.Second
+	// minimal interval of reloading signing keys (when token is signed by unknown key)
+	oidcKeysReloadInterval = time.Minute
+)
+
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// callback URL registered in the identity provider
+	RedirectURL string
+	Scopes      []string
+	// claim used as the username of provisioned accounts (preferred_username by default)
+	UsernameClaim string
+	// creates local accounts of users signing in for the first time
+	AutoProvision bool
+	// domains of the emails accepted from the identity provider (verified emails only), other emails
+	// are not stored in provisioned accounts
+	EmailDomains []string
+	// validates usernames of provisioned accounts and returns their normalized form (username
+	// policy of the server)
+	NormalizeUsername func(username string) (string, error)
+}
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// audience claim can be a single string or an array
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// IDTokenClaims are verified claims of the ID token
+type IDTokenClaims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	Expiry            int64    `json:"exp"`
+	Nonce             string   `json:"nonce"`
+	AuthorizedParty   string   `json:"azp"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+	GivenName         string   `json:"given_name"`
+	FamilyName        string   `json:"family_name"`
+	// all claims of the token
+	Raw map[string]interface{} `json:"-"`
+}
+
+// OIDCProvider implements login with OpenID Connect authorization code flow. Provider metadata
+// are loaded on the first use, so the server can start while identity provider is unavailable.
+type OIDCProvider struct {
+	config     OIDCConfig
+	accounts   domain.AccountsRepository
+	identities domain.IdentitiesRepository
+	client     *http.Client
+
+	mu          sync.Mutex
+	metadata    *oidcMetadata
+	keys        map[string]*rsa.PublicKey
+	keysUpdated time.Time
+}
+
+// NewOIDCProvider creates OpenID Connect login provider, transport can be nil (default transport)
+func NewOIDCProvider(config OIDCConfig, accounts domain.AccountsRepository, identities domain.IdentitiesRepository, transport http.RoundTripper) *OIDCProvider {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	if config.UsernameClaim == "" {
+		config.UsernameClaim = "preferred_username"
+	}
+	return &OIDCProvider{
+		config:     config,
+		accounts:   accounts,
+		identities: identities,
+		client:     &http.Client{Timeout: oidcRequestTimeout, Transport: transport},
+	}
+}
+
+func (p *OIDCProvider) Name() string {
+	return "oidc"
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status: %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (p *OIDCProvider) loadMetadata(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	var metadata oidcMetadata
+	if err := p.getJSON(ctx, p.config.Issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, fmt.Errorf("loading openid configuration: %w", err)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("issuer mismatch: %s", metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JwksURI == "" {
+		return nil, errors.New("incomplete openid configuration")
+	}
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	metadata, err := p.loadMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysUpdated) < oidcKeysReloadInterval {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, metadata.JwksURI, &jwks); err != nil {
+		return nil, fmt.Errorf("loading signing keys: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+	p.keysUpdated = time.Now()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key: %s", kid)
+}
+
+// AuthCodeURL returns URL of the identity provider login page
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce string) (string, error) {
+	metadata, err := p.loadMetadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	params := u.Query()
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
+
+// Exchange exchanges authorization code for tokens and returns verified claims of the ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, code, nonce string) (IDTokenClaims, error) {
+	var claims IDTokenClaims
+	metadata, err := p.loadMetadata(ctx)
+	if err != nil {
+		return claims, err
+	}
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {p.config.RedirectURL},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return claims, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return claims, fmt.Errorf("requesting token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return claims, fmt.Errorf("token request failed (%d): %s", resp.StatusCode, body)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return claims, fmt.Errorf("parsing token response: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return claims, errors.New("missing id_token in token response")
+	}
+	return p.verifyIDToken(ctx, tokens.IDToken, nonce)
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, token, nonce string) (IDTokenClaims, error) {
+	var claims IDTokenClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrInvalidIDToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims, ErrInvalidIDToken
+	}
+	var hash crypto.Hash
+	switch header.Alg {
+	case "RS256":
+		hash = crypto.SHA256
+	case "RS384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return claims, fmt.Errorf("unsupported signing algorithm: %s", header.Alg)
+	}
+	key, err := p.publicKey(ctx, header.Kid)
+	if err != nil {
+		return claims, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrInvalidIDToken
+	}
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), signature); err != nil {
+		return claims, fmt.Errorf("%w: invalid signature", ErrInvalidIDToken)
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, ErrInvalidIDToken
+	}
+	if err := decodeSegment(parts[1], &claims.Raw); err != nil {
+		return claims, ErrInvalidIDToken
+	}
+	if strings.TrimSuffix(claims.Issuer, "/") != p.config.Issuer {
+		return claims, fmt.Errorf("%w: issuer mismatch", ErrInvalidIDToken)
+	}
+	validAudience := false
+	for _, aud := range claims.Audience {
+		if aud == p.config.ClientID {
+			validAudience = true
+		}
+	}
+	if !validAudience || (len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID) {
+		return claims, fmt.Errorf("%w: audience mismatch", ErrInvalidIDToken)
+	}
+	if time.Now().After(time.Unix(claims.Expiry, 0)) {
+		return claims, fmt.Errorf("%w: token expired", ErrInvalidIDToken)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return claims, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Returns email of the user when it's verified by the identity provider and its domain is allowed
+func (p *OIDCProvider) trustedEmail(claims IDTokenClaims) string {
+	if claims.Email == "" || !claims.EmailVerified {
+		return ""
+	}
+	at := strings.LastIndex(claims.Email, "@")
+	if at < 0 {
+		return ""
+	}
+	emailDomain := strings.ToLower(claims.Email[at+1:])
+	for _, d := range p.config.EmailDomains {
+		if strings.ToLower(d) == emailDomain {
+			return strings.ToLower(claims.Email)
+		}
+	}
+	return ""
+}
+
+// Account returns local account linked with the identity (issuer and subject) of the authenticated user.
+// Existing accounts are never linked implicitly by the username or email claims, they must be linked
+// by the signed in user (LinkIdentity) or by the administrator. New accounts are created when auto
+// provisioning is enabled and the username is allowed and not taken.
+func (p *OIDCProvider) Account(claims IDTokenClaims) (domain.Account, error) {
+	identity, err := p.identities.Get(p.config.Issuer, claims.Subject)
+	if err == nil {
+		account, err := p.accounts.GetByUsername(identity.Username)
+		if err != nil {
+			return domain.Account{}, err
+		}
+		if !account.Active {
+			return domain.Account{}, ErrAccountInactive
+		}
+		return account, nil
+	}
+	if !errors.Is(err, domain.ErrIdentityNotFound) {
+		return domain.Account{}, err
+	}
+	if !p.config.AutoProvision {
+		return domain.Account{}, ErrIdentityNotLinked
+	}
+	username, _ := claims.Raw[p.config.UsernameClaim].(string)
+	if username == "" {
+		return domain.Account{}, fmt.Errorf("missing %s claim", p.config.UsernameClaim)
+	}
+	if p.config.NormalizeUsername != nil {
+		// identity must be linked with an existing account when the username is not allowed
+		if username, err = p.config.NormalizeUsername(username); err != nil {
+			return domain.Account{}, fmt.Errorf("%w: invalid username: %v", ErrIdentityNotLinked, err)
+		}
+	}
+	exists, err := p.accounts.UsernameExists(username)
+	if err != nil {
+		return domain.Account{}, err
+	}
+	if exists {
+		return domain.Account{}, ErrIdentityNotLinked
+	}
+	email := p.trustedEmail(claims)
+	if email != "" {
+		if exists, err := p.accounts.EmailExists(email); err != nil || exists {
+			email = ""
+		}
+	}
+	// account without password, users can sign in only through the identity provider (or after password reset)
+	account, err := domain.NewAccount(username, email, claims.GivenName, claims.FamilyName, "")
+	if err != nil {
+		return domain.Account{}, err
+	}
+	if err := account.Activate(); err != nil {
+		return domain.Account{}, err
+	}
+	if err := p.accounts.Create(account); err != nil {
+		return domain.Account{}, fmt.Errorf("creating account: %w", err)
+	}
+	if err := p.LinkIdentity(claims, username); err != nil {
+		if delErr := p.accounts.Delete(username); delErr != nil {
+			err = fmt.Errorf("%w (deleting account: %v)", err, delErr)
+		}
+		return domain.Account{}, fmt.Errorf("linking identity: %w", err)
+	}
+	return account, nil
+}
+
+// LinkIdentity links identity of the authenticated user with the local account. Returns
+// domain.ErrIdentityExists when the identity is linked with another account.
+func (p *OIDCProvider) LinkIdentity(claims IDTokenClaims, username string) error {
+	if claims.Subject == "" {
+		return fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	identity, err := p.identities.Get(p.config.Issuer, claims.Subject)
+	if err == nil {
+		if identity.Username != username {
+			return domain.ErrIdentityExists
+		}
+		return nil
+	}
+	if !errors.Is(err, domain.ErrIdentityNotFound) {
+		return err
+	}
+	return p.identities.Create(domain.Identity{
+		Issuer:   p.config.Issuer,
+		Subject:  claims.Subject,
+		Username: username,
+		Created:  time.Now().UTC(),
+	})
+}
+
+// LinkSubject links identity given by the subject in the identity provider with the local account
+// (administrator action)
+func (p *OIDCProvider) LinkSubject(subject, username string) error {
+	return p.LinkIdentity(IDTokenClaims{Subject: subject}, username)
+}
+
+// Identities returns identities of the identity provider linked with the account
+func (p *OIDCProvider) Identities(username string) ([]domain.Identity, error) {
+	identities, err := p.identities.UserIdentities(username)
+	if err != nil {
+		return nil, err
+	}
+	linked := make([]domain.Identity, 0, len(identities))
+	for _, i := range identities {
+		if i.Issuer == p.config.Issuer {
+			linked = append(linked, i)
+		}
+	}
+	return linked, nil
+}
+
+// UnlinkSubject removes link between the identity and the account
+func (p *OIDCProvider) UnlinkSubject(subject, username string) error {
+	identity, err := p.identities.Get(p.config.Issuer, subject)
+	if err != nil {
+		return err
+	}
+	if identity.Username != username {
+		return domain.ErrIdentityNotFound
+	}
+	return p.identities.Delete(p.config.Issuer, subject)
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+type memoryAccounts struct {
+	domain.AccountsRepository
+	accounts map[string]domain.Account
+}
+
+func (r *memoryAccounts) GetByUsername(username string) (domain.Account, error) {
+	if a, ok := r.accounts[username]; ok {
+		return a, nil
+	}
+	return domain.Account{}, domain.ErrAccountNotFound
+}
+
+func (r *memoryAccounts) UsernameExists(username string) (bool, error) {
+	_, ok := r.accounts[username]
+	return ok, nil
+}
+
+func (r *memoryAccounts) EmailExists(email string) (bool, error) {
+	for _, a := range r.accounts {
+		if a.Email == email {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryAccounts) Create(account domain.Account) error {
+	r.accounts[account.Username] = account
+	return nil
+}
+
+func (r *memoryAccounts) Delete(username string) error {
+	delete(r.accounts, username)
+	return nil
+}
+
+type memoryIdentities struct {
+	identities map[[2]string]domain.Identity
+}
+
+func (r *memoryIdentities) Get(issuer, subject string) (domain.Identity, error) {
+	if i, ok := r.identities[[2]string{issuer, subject}]; ok {
+		return i, nil
+	}
+	return domain.Identity{}, domain.ErrIdentityNotFound
+}
+
+func (r *memoryIdentities) Create(identity domain.Identity) error {
+	key := [2]string{identity.Issuer, identity.Subject}
+	if _, ok := r.identities[key]; ok {
+		return domain.ErrIdentityExists
+	}
+	r.identities[key] = identity
+	return nil
+}
+
+func (r *memoryIdentities) Delete(issuer, subject string) error {
+	delete(r.identities, [2]string{issuer, subject})
+	return nil
+}
+
+func (r *memoryIdentities) UserIdentities(username string) ([]domain.Identity, error) {
+	var list []domain.Identity
+	for _, i := range r.identities {
+		if i.Username == username {
+			list = append(list, i)
+		}
+	}
+	return list, nil
+}
+
+const testIssuer = "https://idp.example.com/realms/test"
+
+func newTestOIDCProvider(autoProvision bool) (*OIDCProvider, *memoryAccounts, *memoryIdentities) {
+	accounts := &memoryAccounts{accounts: map[string]domain.Account{
+		"admin": {Username: "admin", Email: "admin@example.com", Superuser: true, Active: true},
+	}}
+	identities := &memoryIdentities{identities: make(map[[2]string]domain.Identity)}
+	p := NewOIDCProvider(OIDCConfig{
+		Issuer:        testIssuer,
+		AutoProvision: autoProvision,
+		EmailDomains:  []string{"example.com"},
+	}, accounts, identities, nil)
+	return p, accounts, identities
+}
+
+func testClaims(subject, username, email string, verified bool) IDTokenClaims {
+	return IDTokenClaims{
+		Issuer:        testIssuer,
+		Subject:       subject,
+		Email:         email,
+		EmailVerified: verified,
+		Raw:           map[string]interface{}{"preferred_username": username},
+	}
+}
+
+func TestOIDCAccountNotLinkedByClaims(t *testing.T) {
+	p, _, _ := newTestOIDCProvider(true)
+	// username and email of the existing superuser controlled by the identity provider
+	_, err := p.Account(testClaims("attacker", "admin", "admin@example.com", true))
+	if !errors.Is(err, ErrIdentityNotLinked) {
+		t.Fatalf("expected ErrIdentityNotLinked, got %v", err)
+	}
+	_, err = p.Account(testClaims("attacker", "other", "admin@example.com", true))
+	if err != nil {
+		t.Fatalf("provisioning account: %v", err)
+	}
+	account, _ := p.Account(testClaims("attacker", "admin", "admin@example.com", true))
+	if account.Username != "other" || account.Superuser {
+		t.Fatalf("identity resolved to unexpected account: %+v", account)
+	}
+}
+
+func TestOIDCAccountLinkedIdentity(t *testing.T) {
+	p, _, _ := newTestOIDCProvider(false)
+	claims := testClaims("sub-1", "whatever", "", false)
+	if _, err := p.Account(claims); !errors.Is(err, ErrIdentityNotLinked) {
+		t.Fatalf("expected ErrIdentityNotLinked, got %v", err)
+	}
+	if err := p.LinkIdentity(claims, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	account, err := p.Account(claims)
+	if err != nil || account.Username != "admin" {
+		t.Fatalf("expected linked account, got %+v (%v)", account, err)
+	}
+	if err := p.LinkIdentity(claims, "other"); !errors.Is(err, domain.ErrIdentityExists) {
+		t.Fatalf("expected ErrIdentityExists, got %v", err)
+	}
+	if err := p.UnlinkSubject("sub-1", "other"); !errors.Is(err, domain.ErrIdentityNotFound) {
+		t.Fatalf("unlinked identity of another user: %v", err)
+	}
+}
+
+func TestOIDCProvisionedEmail(t *testing.T) {
+	tests := []struct {
+		email    string
+		verified bool
+		expected string
+	}{
+		{"user@example.com", true, "user@example.com"},
+		{"user@EXAMPLE.com", true, "user@example.com"},
+		{"user@example.com", false, ""},
+		{"user@evil.com", true, ""},
+		{"user@example.com.evil.com", true, ""},
+		// already used by another account
+		{"admin@example.com", true, ""},
+	}
+	for i, tt := range tests {
+		p, accounts, _ := newTestOIDCProvider(true)
+		username := "user"
+		if _, err := p.Account(testClaims("sub", username, tt.email, tt.verified)); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if email := accounts.accounts[username].Email; email != tt.expected {
+			t.Errorf("%d: email %q, expected %q", i, email, tt.expected)
+		}
+	}
+}
+
+func TestOIDCProvisionedUsernamePolicy(t *testing.T) {
+	p, accounts, _ := newTestOIDCProvider(true)
+	p.config.NormalizeUsername = func(username string) (string, error) {
+		if strings.EqualFold(username, "root") {
+			return "", errors.New("Username is reserved")
+		}
+		return strings.ToLower(username), nil
+	}
+	if _, err := p.Account(testClaims("sub1", "Root", "", false)); !errors.Is(err, ErrIdentityNotLinked) {
+		t.Fatalf("reserved username: expected ErrIdentityNotLinked, got %v", err)
+	}
+	account, err := p.Account(testClaims("sub2", "John.Doe", "", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := accounts.accounts["john.doe"]; !ok || account.Username != "john.doe" {
+		t.Errorf("username was not normalized: %s", account.Username)
+	}
+}
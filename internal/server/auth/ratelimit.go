@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type LoginRateLimitConfig struct {
+	// failed attempts from single IP address / for single username (0 disables the limit)
+	IPAttempts       int
+	UsernameAttempts int
+	// period in which failed attempts are counted
+	Window time.Duration
+	// duration of the lock after reaching the limit
+	Lockout time.Duration
+}
+
+// LoginRateLimiter limits failed login attempts by client's IP address and by username. State is
+// stored in redis, so the limits are shared by all server instances. When redis is not available,
+// attempts are counted in memory of the server instance, so the protection is not disabled.
+type LoginRateLimiter struct {
+	rdb     *redis.Client
+	cfg     LoginRateLimitConfig
+	localMu sync.Mutex
+	local   map[string]*localLoginLimit
+}
+
+// Counter of failed attempts used when redis is not available
+type localLoginLimit struct {
+	count       int
+	windowEnd   time.Time
+	lockedUntil time.Time
+}
+
+type loginLimit struct {
+	key      string
+	attempts int
+}
+
+func NewLoginRateLimiter(rdb *redis.Client, cfg LoginRateLimitConfig) *LoginRateLimiter {
+	return &LoginRateLimiter{rdb: rdb, cfg: cfg, local: make(map[string]*localLoginLimit)}
+}
+
+func (l *LoginRateLimiter) Enabled() bool {
+	return l.cfg.IPAttempts > 0 || l.cfg.UsernameAttempts > 0
+}
+
+func (l *LoginRateLimiter) limits(ip, username string) []loginLimit {
+	var limits []loginLimit
+	if l.cfg.IPAttempts > 0 && ip != "" {
+		limits = append(limits, loginLimit{"login_limit:ip:" + ip, l.cfg.IPAttempts})
+	}
+	if l.cfg.UsernameAttempts > 0 && username != "" {
+		limits = append(limits, loginLimit{"login_limit:user:" + strings.ToLower(username), l.cfg.UsernameAttempts})
+	}
+	return limits
+}
+
+// Returns end of the lock recorded in memory (zero time when not locked)
+func (l *LoginRateLimiter) localLock(key string, now time.Time) time.Time {
+	l.localMu.Lock()
+	defer l.localMu.Unlock()
+	if entry, ok := l.local[key]; ok && entry.lockedUntil.After(now) {
+		return entry.lockedUntil
+	}
+	return time.Time{}
+}
+
+// Records failed attempt in memory
+func (l *LoginRateLimiter) localFailed(limit loginLimit, now time.Time) {
+	l.localMu.Lock()
+	defer l.localMu.Unlock()
+	if len(l.local) > 10000 {
+		for key, entry := range l.local {
+			if entry.windowEnd.Before(now) && entry.lockedUntil.Before(now) {
+				delete(l.local, key)
+			}
+		}
+	}
+	entry, ok := l.local[limit.key]
+	if !ok {
+		entry = &localLoginLimit{}
+		l.local[limit.key] = entry
+	}
+	if entry.windowEnd.Before(now) {
+		entry.count = 0
+		entry.windowEnd = now.Add(l.cfg.Window)
+	}
+	entry.count++
+	if entry.count >= limit.attempts {
+		entry.count = 0
+		entry.lockedUntil = now.Add(l.cfg.Lockout)
+	}
+}
+
+// Check returns AccountLockedError when the login from the IP address or for the username is locked.
+// Locks recorded in memory during redis outage are checked as well.
+func (l *LoginRateLimiter) Check(ctx context.Context, ip, username string) error {
+	var until time.Time
+	now := time.Now()
+	for _, limit := range l.limits(ip, username) {
+		if t := l.localLock(limit.key, now); t.After(until) {
+			until = t
+		}
+		ttl, err := l.rdb.PTTL(ctx, limit.key+":lock").Result()
+		if err != nil {
+			// redis is not available, only locks in memory are used
+			continue
+		}
+		if t := now.Add(ttl); ttl > 0 && t.After(until) {
+			until = t
+		}
+	}
+	if !until.IsZero() {
+		return &AccountLockedError{Until: until}
+	}
+	return nil
+}
+
+// Failed records failed login attempt and locks the login when the limit is reached. When redis
+// is not available, the attempt is recorded in memory and the redis error is returned.
+func (l *LoginRateLimiter) Failed(ctx context.Context, ip, username string) error {
+	now := time.Now()
+	for _, limit := range l.limits(ip, username) {
+		countKey := limit.key + ":count"
+		count, err := l.rdb.Incr(ctx, countKey).Result()
+		if err != nil {
+			for _, limit := range l.limits(ip, username) {
+				l.localFailed(limit, now)
+			}
+			return fmt.Errorf("redis save login attempt: %v", err)
+		}
+		if count == 1 {
+			if err := l.rdb.Expire(ctx, countKey, l.cfg.Window).Err(); err != nil {
+				return fmt.Errorf("redis save login attempt: %v", err)
+			}
+		}
+		if count >= int64(limit.attempts) {
+			pipe := l.rdb.TxPipeline()
+			pipe.Set(ctx, limit.key+":lock", "1", l.cfg.Lockout)
+			pipe.Del(ctx, countKey)
+			if _, err := pipe.Exec(ctx); err != nil {
+				return fmt.Errorf("redis save login lock: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Succeeded resets counter of failed attempts of the username (attempts from the IP address are
+// still counted)
+func (l *LoginRateLimiter) Succeeded(ctx context.Context, username string) error {
+	if l.cfg.UsernameAttempts <= 0 {
+		return nil
+	}
+	if err := l.rdb.Del(ctx, "login_limit:user:"+strings.ToLower(username)+":count").Err(); err != nil {
+		return fmt.Errorf("redis delete login attempts: %v", err)
+	}
+	return nil
+}
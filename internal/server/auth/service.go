@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,6 +22,8 @@ var (
 	ErrUserNotFound    = errors.New("User not found")
 	ErrInvalidPassword = errors.New("Password doesn't match")
 	ErrInvalidSession  = errors.New("Invalid session")
+	ErrAccountInactive = errors.New("Account is not active")
+	ErrEmailUnverified = errors.New("Email is not verified")
 	AnonymousUser      = domain.User{IsGuest: true}
 )
 
@@ -28,9 +31,59 @@ const (
 	basic = "basic"
 )
 
+// AccountLockedError is returned when the login is temporarily locked after repeated failed attempts
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string {
+	return fmt.Sprintf("login locked until %s", e.Until.Format(time.RFC3339))
+}
+
 type SessionInfo struct {
 	ID       string
 	Username string
+	// absolute expiration of the session (zero for sessions created by older versions)
+	Expires time.Time
+	// time when the session expires without activity (zero when idle timeout is disabled)
+	IdleExpires time.Time
+}
+
+// Remaining lifetime of the session (zero when unknown)
+func (si SessionInfo) Remaining() time.Duration {
+	expires := si.Expires
+	if !si.IdleExpires.IsZero() && (expires.IsZero() || si.IdleExpires.Before(expires)) {
+		expires = si.IdleExpires
+	}
+	if expires.IsZero() {
+		return 0
+	}
+	return time.Until(expires)
+}
+
+// Minimal interval between updates of the session activity in the session store
+const sessionActivityInterval = time.Minute
+
+// Session data in format "username|expires|activity" (unix timestamps), older sessions
+// contain only the username
+type sessionData struct {
+	Username string
+	Expires  int64
+	Activity int64
+}
+
+func (d sessionData) String() string {
+	return fmt.Sprintf("%s|%d|%d", d.Username, d.Expires, d.Activity)
+}
+
+func parseSessionData(data string) sessionData {
+	parts := strings.Split(data, "|")
+	sd := sessionData{Username: parts[0]}
+	if len(parts) == 3 {
+		sd.Expires, _ = strconv.ParseInt(parts[1], 10, 64)
+		sd.Activity, _ = strconv.ParseInt(parts[2], 10, 64)
+	}
+	return sd
 }
 
 type SessionStore interface {
@@ -49,7 +102,7 @@ func NewRedisStore(rdb *redis.Client) *RedisSessionStore {
 
 func (s *RedisSessionStore) Set(ctx context.Context, sessionID, data string, expiration time.Duration) error {
 	if err := s.rdb.Set(ctx, sessionID, data, expiration).Err(); err != nil {
-		return fmt.Errorf("redis save session: %v", err)
+		return fmt.Errorf("redis save session: %w", err)
 	}
 	return nil
 }
@@ -60,28 +113,88 @@ func (s *RedisSessionStore) Get(ctx context.Context, sessionID string) (string,
 		if err == redis.Nil {
 			return "", ErrInvalidSession
 		}
-		return "", fmt.Errorf("redis get session: %v", err)
+		return "", fmt.Errorf("redis get session: %w", err)
 	}
 	return val, nil
 }
 
+// Count returns number of stored sessions (keys in format of session ID)
+func (s *RedisSessionStore) Count(ctx context.Context) (int, error) {
+	const pattern = "????????-????-????-????-????????????"
+	count := 0
+	iter := s.rdb.Scan(ctx, 0, pattern, 1000).Iterator()
+	for iter.Next(ctx) {
+		count++
+	}
+	if err := iter.Err(); err != nil {
+		return 0, fmt.Errorf("redis count sessions: %v", err)
+	}
+	return count, nil
+}
+
 func (s *RedisSessionStore) Del(ctx context.Context, sessionID string) error {
 	if err := s.rdb.Del(ctx, sessionID).Err(); err != nil {
-		return fmt.Errorf("redis delete session: %v", err)
+		return fmt.Errorf("redis delete session: %w", err)
 	}
 	return nil
 }
 
+// DelUserSessions removes all sessions of the user
+func (s *RedisSessionStore) DelUserSessions(ctx context.Context, username string) error {
+	const pattern = "????????-????-????-????-????????????"
+	iter := s.rdb.Scan(ctx, 0, pattern, 1000).Iterator()
+	for iter.Next(ctx) {
+		val, err := s.rdb.Get(ctx, iter.Val()).Result()
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("redis get session: %v", err)
+		}
+		if parseSessionData(val).Username == username {
+			if err := s.rdb.Del(ctx, iter.Val()).Err(); err != nil {
+				return fmt.Errorf("redis delete session: %v", err)
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("redis scan sessions: %v", err)
+	}
+	return nil
+}
+
+// Backend is an additional authentication source (e.g. LDAP), used when the credentials doesn't
+// match any local account. Backend must return local account of the authenticated user (it can
+// create or update the account by the accounts repository).
+type Backend interface {
+	Name() string
+	Authenticate(login, password string) (domain.Account, error)
+}
+
 type AuthService struct {
 	logger         *zap.SugaredLogger
+	backends       []Backend
 	expiration     time.Duration
+	idleTimeout    time.Duration
 	accounts       domain.AccountsRepository
 	store          SessionStore
 	cache          *ttlcache.Cache[string, domain.User]
 	basicAuthCache *ttlcache.Cache[string, domain.User]
+	tokens         domain.APITokensRepository
+	tokensCache    *ttlcache.Cache[string, apiTokenUser]
+	groups         domain.GroupsRepository
+	loginLimiter   *LoginRateLimiter
 }
 
 func NewAuthService(logger *zap.SugaredLogger, expiration time.Duration, accounts domain.AccountsRepository, store SessionStore) *AuthService {
+	basicAuthCache := ttlcache.New(
+		ttlcache.WithTTL[string, domain.User](45*time.Second),
+		ttlcache.WithDisableTouchOnHit[string, domain.User](),
+	)
+	s := &AuthService{
+		logger:         logger,
+		expiration:     expiration,
+		accounts:       accounts,
+		store:          store,
+		basicAuthCache: basicAuthCache,
+	}
 	loader := ttlcache.LoaderFunc[string, domain.User](
 		func(c *ttlcache.Cache[string, domain.User], username string) *ttlcache.Item[string, domain.User] {
 			account, err := accounts.GetByUsername(username)
@@ -89,27 +202,57 @@ func NewAuthService(logger *zap.SugaredLogger, expiration time.Duration, account
 				logger.Errorw("getting account", "username", username, zap.Error(err))
 				return nil
 			}
-			item := c.Set(username, AccountToUser(account), ttlcache.DefaultTTL)
+			item := c.Set(username, s.AccountUser(account), ttlcache.DefaultTTL)
 			return item
 		},
 	)
-	cache := ttlcache.New(
+	s.cache = ttlcache.New(
 		ttlcache.WithTTL[string, domain.User](45*time.Second),
 		ttlcache.WithLoader[string, domain.User](loader),
 		ttlcache.WithDisableTouchOnHit[string, domain.User](),
 	)
+	return s
+}
 
-	basicAuthCache := ttlcache.New(
-		ttlcache.WithTTL[string, domain.User](45*time.Second),
-		ttlcache.WithDisableTouchOnHit[string, domain.User](),
-	)
-	return &AuthService{
-		logger:         logger,
-		expiration:     expiration,
-		accounts:       accounts,
-		store:          store,
-		cache:          cache,
-		basicAuthCache: basicAuthCache,
+// SetLoginLimiter enables limits of failed login attempts, which are applied to the login form
+// and to the HTTP Basic authentication
+func (s *AuthService) SetLoginLimiter(limiter *LoginRateLimiter) {
+	s.loginLimiter = limiter
+}
+
+// SetGroups enables users groups (groups are loaded together with the user)
+func (s *AuthService) SetGroups(repo domain.GroupsRepository) {
+	s.groups = repo
+}
+
+// AccountUser returns user of the account including its groups
+func (s *AuthService) AccountUser(account domain.Account) domain.User {
+	user := AccountToUser(account)
+	if s.groups != nil {
+		groups, err := s.groups.UserGroups(account.Username)
+		if err != nil {
+			s.logger.Errorw("getting user groups", "username", account.Username, zap.Error(err))
+		}
+		user.Groups = groups
+	}
+	return user
+}
+
+// RefreshUser removes cached data of the user, so changes of the account or groups are applied
+// to the next requests
+func (s *AuthService) RefreshUser(username string) {
+	s.cache.Delete(username)
+	for _, item := range s.basicAuthCache.Items() {
+		if item.Value().Username == username {
+			s.basicAuthCache.Delete(item.Key())
+		}
+	}
+	if s.tokensCache != nil {
+		for _, item := range s.tokensCache.Items() {
+			if item.Value().User.Username == username {
+				s.tokensCache.Delete(item.Key())
+			}
+		}
 	}
 }
 
@@ -136,11 +279,48 @@ func (s *AuthService) GetSessionInfo(c echo.Context) (*SessionInfo, error) {
 		}
 		return nil, err
 	}
-	si = SessionInfo{ID: sessionid, Username: data}
+	sd := parseSessionData(data)
+	si = SessionInfo{ID: sessionid, Username: sd.Username}
+	if sd.Expires > 0 {
+		si.Expires = time.Unix(sd.Expires, 0)
+		if s.idleTimeout > 0 {
+			now := time.Now()
+			activity := time.Unix(sd.Activity, 0)
+			if now.Sub(activity) > s.idleTimeout {
+				s.LogoutUser(c)
+				c.Set("session", nil)
+				return nil, nil
+			}
+			if now.Sub(activity) > sessionActivityInterval {
+				sd.Activity = now.Unix()
+				activity = now
+				if ttl := s.sessionTTL(si.Expires.Sub(now)); ttl > 0 {
+					if err := s.store.Set(c.Request().Context(), sessionid, sd.String(), ttl); err != nil {
+						s.logger.Errorw("updating session activity", zap.Error(err))
+					}
+				}
+			}
+			si.IdleExpires = activity.Add(s.idleTimeout)
+		}
+	}
 	c.Set("session", si)
 	return &si, nil
 }
 
+// Returns expiration of the session in the store, limited by the idle timeout
+func (s *AuthService) sessionTTL(remaining time.Duration) time.Duration {
+	if s.idleTimeout > 0 && s.idleTimeout < remaining {
+		return s.idleTimeout
+	}
+	return remaining
+}
+
+// SetIdleTimeout sets inactivity timeout of the sessions (0 disables it), sessions are still limited
+// by the absolute expiration
+func (s *AuthService) SetIdleTimeout(timeout time.Duration) {
+	s.idleTimeout = timeout
+}
+
 func (s *AuthService) GetUser(c echo.Context) (domain.User, error) {
 	user, saved := c.Get("user").(domain.User)
 	if saved {
@@ -159,11 +339,11 @@ func (s *AuthService) GetUser(c echo.Context) (domain.User, error) {
 				}
 				cred := strings.SplitN(string(b), ":", 2)
 				if len(cred) == 2 {
-					account, err := s.Authenticate(cred[0], cred[1])
+					account, err := s.AuthenticateLimited(c.Request().Context(), c.RealIP(), cred[0], cred[1])
 					if err != nil {
 						return AnonymousUser, err
 					}
-					user = AccountToUser(account)
+					user = s.AccountUser(account)
 					s.basicAuthCache.Set(auth, user, ttlcache.DefaultTTL)
 				}
 			}
@@ -186,7 +366,125 @@ func (s *AuthService) GetUser(c echo.Context) (domain.User, error) {
 	return user, nil
 }
 
+// ActiveSessions returns number of active sessions, if supported by the session store
+func (s *AuthService) ActiveSessions(ctx context.Context) (int, error) {
+	counter, ok := s.store.(interface {
+		Count(ctx context.Context) (int, error)
+	})
+	if !ok {
+		return 0, errors.New("counting sessions is not supported by session store")
+	}
+	return counter.Count(ctx)
+}
+
+// StoreAvailable reports whether the session store is available (stores without tracking
+// of availability are considered available)
+func (s *AuthService) StoreAvailable() bool {
+	store, ok := s.store.(interface {
+		Available() bool
+	})
+	return !ok || store.Available()
+}
+
+// RevokeUser removes all sessions (if supported by the session store) and cached data of the user,
+// e.g. after deactivation of the account
+func (s *AuthService) RevokeUser(ctx context.Context, username string) error {
+	s.RefreshUser(username)
+	store, ok := s.store.(interface {
+		DelUserSessions(ctx context.Context, username string) error
+	})
+	if !ok {
+		return errors.New("deleting user sessions is not supported by session store")
+	}
+	return store.DelUserSessions(ctx, username)
+}
+
+func (s *AuthService) CacheStats() map[string]domain.CacheStats {
+	users := s.cache.Metrics()
+	basicAuth := s.basicAuthCache.Metrics()
+	return map[string]domain.CacheStats{
+		"users":      {Hits: users.Hits, Misses: users.Misses},
+		"basic_auth": {Hits: basicAuth.Hits, Misses: basicAuth.Misses},
+	}
+}
+
+// AddBackend registers additional authentication backend (should be called during server setup)
+func (s *AuthService) AddBackend(backend Backend) {
+	s.backends = append(s.backends, backend)
+}
+
+// IsInvalidCredentials reports whether the authentication failed because of unknown user or wrong password
+func IsInvalidCredentials(err error) bool {
+	return errors.Is(err, ErrInvalidPassword) || errors.Is(err, ErrUserNotFound) || errors.Is(err, domain.ErrAccountNotFound)
+}
+
+// LoginKey returns identifier of the account used in the login (username or email) for counting
+// of failed login attempts, so both forms of the login share the same limit
+func (s *AuthService) LoginKey(login string) string {
+	key := strings.ToLower(strings.TrimSpace(login))
+	if strings.Contains(key, "@") {
+		if account, err := s.accounts.GetByEmail(key); err == nil {
+			return strings.ToLower(account.Username)
+		}
+	}
+	return key
+}
+
+// Authenticate checks credentials of the user. Returns ErrAccountInactive or ErrEmailUnverified
+// for valid credentials of inactive account.
 func (s *AuthService) Authenticate(login, password string) (domain.Account, error) {
+	account, err := s.authenticateLocal(login, password)
+	if err == nil || len(s.backends) == 0 {
+		return account, err
+	}
+	for _, backend := range s.backends {
+		bAccount, bErr := backend.Authenticate(login, password)
+		if bErr == nil {
+			if !bAccount.Active {
+				return domain.Account{}, ErrAccountInactive
+			}
+			return bAccount, nil
+		}
+		if !errors.Is(bErr, ErrUserNotFound) && !errors.Is(bErr, ErrInvalidPassword) && !errors.Is(bErr, domain.ErrAccountNotFound) {
+			s.logger.Errorw("authentication backend", "backend", backend.Name(), zap.Error(bErr))
+		}
+	}
+	return domain.Account{}, err
+}
+
+// AuthenticateLimited checks credentials of the user like Authenticate, failed attempts are limited
+// by the login rate limiter (per client IP address and per account). AccountLockedError is returned
+// when the login is locked.
+func (s *AuthService) AuthenticateLimited(ctx context.Context, ip, login, password string) (domain.Account, error) {
+	limiter := s.loginLimiter
+	if limiter == nil {
+		return s.Authenticate(login, password)
+	}
+	// attempts are counted per client IP address and per account (regardless of the IP address)
+	loginKey := s.LoginKey(login)
+	if err := limiter.Check(ctx, ip, loginKey); err != nil {
+		var lockedErr *AccountLockedError
+		if errors.As(err, &lockedErr) {
+			return domain.Account{}, err
+		}
+		s.logger.Errorw("checking login rate limit", zap.Error(err))
+	}
+	account, err := s.Authenticate(login, password)
+	if err != nil {
+		if IsInvalidCredentials(err) {
+			if err := limiter.Failed(ctx, ip, loginKey); err != nil {
+				s.logger.Errorw("recording failed login", zap.Error(err))
+			}
+		}
+		return account, err
+	}
+	if err := limiter.Succeeded(ctx, loginKey); err != nil {
+		s.logger.Errorw("resetting failed logins", zap.Error(err))
+	}
+	return account, nil
+}
+
+func (s *AuthService) authenticateLocal(login, password string) (domain.Account, error) {
 	var account domain.Account
 	var err error
 	if strings.Contains(login, "@") {
@@ -197,12 +495,16 @@ func (s *AuthService) Authenticate(login, password string) (domain.Account, erro
 	if err != nil {
 		return domain.Account{}, err
 	}
-	if !account.Active {
-		return domain.Account{}, ErrUserNotFound
-	}
 	if !account.CheckPassword(password) {
 		return domain.Account{}, ErrInvalidPassword
 	}
+	// state of the account is reported only with valid credentials
+	if !account.Active {
+		if account.Confirmed == nil {
+			return domain.Account{}, ErrEmailUnverified
+		}
+		return domain.Account{}, ErrAccountInactive
+	}
 	return account, nil
 }
 
@@ -213,7 +515,9 @@ func (s *AuthService) LoginUserWithExpiration(c echo.Context, userAccount domain
 	}
 	sessionid := token.String()
 	// sessionid := fmt.Sprintf("%s:%s", user.Username, token.String())
-	if err := s.store.Set(c.Request().Context(), sessionid, userAccount.Username, expiration); err != nil {
+	now := time.Now()
+	data := sessionData{Username: userAccount.Username, Expires: now.Add(expiration).Unix(), Activity: now.Unix()}
+	if err := s.store.Set(c.Request().Context(), sessionid, data.String(), s.sessionTTL(expiration)); err != nil {
 		return fmt.Errorf("save session: %v", err)
 	}
 	oldCookie, err := c.Request().Cookie("gq_session")
@@ -222,8 +526,8 @@ func (s *AuthService) LoginUserWithExpiration(c echo.Context, userAccount domain
 			s.logger.Errorw("deleting old session on login", zap.Error(err))
 		}
 	}
-	now := time.Now().UTC()
-	userAccount.LastLogin = &now
+	lastLogin := now.UTC()
+	userAccount.LastLogin = &lastLogin
 	if err := s.accounts.Update(userAccount); err != nil {
 		s.logger.Warnw("updating time of last login", zap.Error(err))
 	}
@@ -236,7 +540,7 @@ func (s *AuthService) LoginUserWithExpiration(c echo.Context, userAccount domain
 		Name:     "gq_session",
 		Value:    sessionid,
 		HttpOnly: true,
-		Expires:  time.Now().Add(expiration),
+		Expires:  now.Add(expiration),
 	})
 	return nil
 }
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+func TestBasicAuthLoginLimit(t *testing.T) {
+	account := domain.Account{Username: "admin", Active: true}
+	if err := account.SetPassword("correct-password"); err != nil {
+		t.Fatal(err)
+	}
+	accounts := &memoryAccounts{accounts: map[string]domain.Account{"admin": account}}
+	s := NewAuthService(zap.NewNop().Sugar(), time.Hour, accounts, nil)
+	s.SetLoginLimiter(NewLoginRateLimiter(unreachableRedis(), LoginRateLimitConfig{
+		UsernameAttempts: 3,
+		Window:           time.Minute,
+		Lockout:          time.Minute,
+	}))
+	e := echo.New()
+	basicAuth := func(password string) (domain.User, error) {
+		req := httptest.NewRequest(http.MethodGet, "/api/map/ows/admin/project", nil)
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("admin:"+password)))
+		return s.GetUser(e.NewContext(req, httptest.NewRecorder()))
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := basicAuth("guess"); !IsInvalidCredentials(err) {
+			t.Fatalf("attempt %d: expected invalid credentials, got %v", i, err)
+		}
+	}
+	var lockedErr *AccountLockedError
+	if _, err := basicAuth("correct-password"); !errors.As(err, &lockedErr) {
+		t.Fatalf("expected locked account, got %v", err)
+	}
+}
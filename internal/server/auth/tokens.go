@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gofrs/uuid"
+	"github.com/jellydator/ttlcache/v3"
+	"go.uber.org/zap"
+)
+
+var ErrInvalidAPIToken = errors.New("Invalid API token")
+
+const (
+	// prefix of the tokens, makes them recognizable (e.g. by secret scanners)
+	apiTokenPrefix = "gq_"
+	// minimal interval of updating the time of the last usage
+	apiTokenUsageInterval = time.Minute
+)
+
+type apiTokenUser struct {
+	User    domain.User
+	TokenID string
+}
+
+func hashAPIToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// SetAPITokens enables authentication with personal API tokens
+func (s *AuthService) SetAPITokens(repo domain.APITokensRepository) {
+	s.tokens = repo
+	s.tokensCache = ttlcache.New(
+		ttlcache.WithTTL[string, apiTokenUser](45*time.Second),
+		ttlcache.WithDisableTouchOnHit[string, apiTokenUser](),
+	)
+}
+
+// CreateAPIToken creates new token of the user. Returns secret value of the token, which is not stored
+// and can't be retrieved later.
+func (s *AuthService) CreateAPIToken(username, name string, expires *time.Time) (domain.APIToken, string, error) {
+	if s.tokens == nil {
+		return domain.APIToken{}, "", errors.New("API tokens are not supported")
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return domain.APIToken{}, "", err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return domain.APIToken{}, "", err
+	}
+	secret := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	token := domain.APIToken{
+		ID:       id.String(),
+		Username: username,
+		Name:     name,
+		Created:  time.Now().UTC(),
+		Expires:  expires,
+	}
+	if err := s.tokens.Create(token, hashAPIToken(secret)); err != nil {
+		return domain.APIToken{}, "", fmt.Errorf("saving API token: %w", err)
+	}
+	return token, secret, nil
+}
+
+func (s *AuthService) ListAPITokens(username string) ([]domain.APIToken, error) {
+	if s.tokens == nil {
+		return []domain.APIToken{}, nil
+	}
+	return s.tokens.List(username)
+}
+
+// RevokeAPIToken deletes the token of the user
+func (s *AuthService) RevokeAPIToken(username, id string) error {
+	if s.tokens == nil {
+		return domain.ErrAPITokenNotFound
+	}
+	if err := s.tokens.Delete(username, id); err != nil {
+		return err
+	}
+	for _, item := range s.tokensCache.Items() {
+		if item.Value().TokenID == id {
+			s.tokensCache.Delete(item.Key())
+		}
+	}
+	return nil
+}
+
+// AuthenticateAPIToken returns the owner of the token and ID of the token
+func (s *AuthService) AuthenticateAPIToken(token string) (domain.User, string, error) {
+	if s.tokens == nil || !strings.HasPrefix(token, apiTokenPrefix) {
+		return AnonymousUser, "", ErrInvalidAPIToken
+	}
+	hash := hashAPIToken(token)
+	if item := s.tokensCache.Get(hash); item != nil {
+		return item.Value().User, item.Value().TokenID, nil
+	}
+	t, err := s.tokens.GetByHash(hash)
+	if err != nil {
+		if errors.Is(err, domain.ErrAPITokenNotFound) {
+			return AnonymousUser, "", ErrInvalidAPIToken
+		}
+		return AnonymousUser, "", err
+	}
+	now := time.Now()
+	if t.Expired(now) {
+		return AnonymousUser, "", ErrInvalidAPIToken
+	}
+	account, err := s.accounts.GetByUsername(t.Username)
+	if err != nil {
+		if errors.Is(err, domain.ErrAccountNotFound) {
+			return AnonymousUser, "", ErrInvalidAPIToken
+		}
+		return AnonymousUser, "", err
+	}
+	if !account.Active {
+		return AnonymousUser, "", ErrInvalidAPIToken
+	}
+	if t.LastUsed == nil || now.Sub(*t.LastUsed) > apiTokenUsageInterval {
+		if err := s.tokens.UpdateLastUsed(t.ID, now.UTC()); err != nil {
+			s.logger.Warnw("updating API token usage", "user", t.Username, zap.Error(err))
+		}
+	}
+	ttl := ttlcache.DefaultTTL
+	if t.Expires != nil && t.Expires.Sub(now) < 45*time.Second {
+		ttl = t.Expires.Sub(now)
+	}
+	user := s.AccountUser(account)
+	s.tokensCache.Set(hash, apiTokenUser{User: user, TokenID: t.ID}, ttl)
+	return user, t.ID, nil
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"github.com/gisquick/gisquick-server/internal/infrastructure/throttle"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
+	"github.com/labstack/echo/v4"
+)
+
+// Bandwidth limits in bytes per second (0 means unlimited)
+type BandwidthConfig struct {
+	ConnectionUpload   int64
+	ConnectionDownload int64
+	UserUpload         int64
+	UserDownload       int64
+}
+
+type bandwidthLimiters struct {
+	config       BandwidthConfig
+	userUpload   *throttle.KeyedLimiters
+	userDownload *throttle.KeyedLimiters
+}
+
+func newBandwidthLimiters(cfg BandwidthConfig) *bandwidthLimiters {
+	return &bandwidthLimiters{
+		config:       cfg,
+		userUpload:   throttle.NewKeyedLimiters(cfg.UserUpload),
+		userDownload: throttle.NewKeyedLimiters(cfg.UserDownload),
+	}
+}
+
+// Limits are shared by all connections of the same user, anonymous users are identified by IP address
+func bandwidthKey(c echo.Context, a *auth.AuthService) string {
+	if user, err := a.GetUser(c); err == nil && user.IsAuthenticated {
+		return "user:" + user.Username
+	}
+	return "ip:" + c.RealIP()
+}
+
+// UploadBandwidthMiddleware throttles reading of the request body
+func UploadBandwidthMiddleware(a *auth.AuthService, b *bandwidthLimiters) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if b.config.ConnectionUpload > 0 || b.config.UserUpload > 0 {
+				req := c.Request()
+				req.Body = throttle.Reader(
+					req.Context(),
+					req.Body,
+					throttle.NewLimiter(b.config.ConnectionUpload),
+					b.userUpload.Get(bandwidthKey(c, a)),
+				)
+			}
+			return next(c)
+		}
+	}
+}
+
+// DownloadBandwidthMiddleware throttles writing of the response
+func DownloadBandwidthMiddleware(a *auth.AuthService, b *bandwidthLimiters) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if b.config.ConnectionDownload > 0 || b.config.UserDownload > 0 {
+				resp := c.Response()
+				resp.Writer = throttle.ResponseWriter(
+					c.Request().Context(),
+					resp.Writer,
+					throttle.NewLimiter(b.config.ConnectionDownload),
+					b.userDownload.Get(bandwidthKey(c, a)),
+				)
+			}
+			return next(c)
+		}
+	}
+}
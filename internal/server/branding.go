@@ -0,0 +1,205 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/images"
+	"github.com/labstack/echo/v4"
+)
+
+// Images which can be uploaded as part of the instance branding
+var brandingImages = domain.StringArray{"logo", "favicon"}
+
+var colorRegex = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+type FooterLink struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Instance branding managed by administrators, served to the web application by /api/app
+type Branding struct {
+	InstanceName string            `json:"instance_name,omitempty"`
+	Colors       map[string]string `json:"colors,omitempty"`
+	FooterLinks  []FooterLink      `json:"footer_links,omitempty"`
+	// custom HTML snippets displayed on the landing page (keyed by placement)
+	LandingHTML map[string]string `json:"landing_html,omitempty"`
+	// URLs of the uploaded images (read-only)
+	Images map[string]string `json:"images,omitempty"`
+}
+
+func (s *Server) brandingPath() string {
+	return filepath.Join(s.Config.ProjectsRoot, "branding.json")
+}
+
+func (s *Server) brandingImagesDir() string {
+	return filepath.Join(s.Config.ProjectsRoot, "branding")
+}
+
+// Returns path of the uploaded branding image (with any extension)
+func (s *Server) findBrandingImage(name string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(s.brandingImagesDir(), name+".*"))
+	if err != nil || len(matches) == 0 {
+		return "", err
+	}
+	return matches[0], nil
+}
+
+func (s *Server) loadBranding() (Branding, error) {
+	var branding Branding
+	data, err := os.ReadFile(s.brandingPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return branding, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &branding); err != nil {
+			return branding, err
+		}
+	}
+	branding.Images = make(map[string]string)
+	for _, name := range brandingImages {
+		path, err := s.findBrandingImage(name)
+		if err != nil {
+			return branding, err
+		}
+		if path == "" {
+			continue
+		}
+		// modification time is used to invalidate cached images
+		var version int64
+		if finfo, err := os.Stat(path); err == nil {
+			version = finfo.ModTime().Unix()
+		}
+		branding.Images[name] = fmt.Sprintf("/api/app/branding/%s?v=%d", name, version)
+	}
+	return branding, nil
+}
+
+// Checks that the link is relative or uses safe URL scheme
+func validLinkURL(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+func (s *Server) handleGetBranding(c echo.Context) error {
+	branding, err := s.loadBranding()
+	if err != nil {
+		return fmt.Errorf("loading branding: %w", err)
+	}
+	return c.JSON(http.StatusOK, branding)
+}
+
+func (s *Server) handleSaveBranding(c echo.Context) error {
+	branding := new(Branding)
+	if err := (&echo.DefaultBinder{}).BindBody(c, branding); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+	}
+	for key, color := range branding.Colors {
+		if !colorRegex.MatchString(color) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid color value: %s", key))
+		}
+	}
+	for _, link := range branding.FooterLinks {
+		if link.Title == "" || !validLinkURL(link.URL) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid footer link: %s", link.URL))
+		}
+	}
+	branding.Images = nil
+	data, err := json.Marshal(branding)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.brandingPath(), data, 0644); err != nil {
+		return fmt.Errorf("saving branding: %w", err)
+	}
+	s.log.Infow("branding updated", "instance_name", branding.InstanceName)
+	return s.handleGetBranding(c)
+}
+
+func (s *Server) handleUploadBrandingImage(c echo.Context) error {
+	name := c.Param("image")
+	if !brandingImages.Has(name) {
+		return echo.ErrNotFound
+	}
+	f, h, err := c.Request().FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing image file")
+	}
+	defer f.Close()
+	if !images.IsImageFile(h.Filename) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Unsupported image format")
+	}
+	data, err := io.ReadAll(io.LimitReader(f, 5*MB))
+	if err != nil {
+		return fmt.Errorf("reading branding image: %w", err)
+	}
+	data, filename, err := images.Sanitize(data, name+filepath.Ext(h.Filename), maxImagePixels)
+	if err != nil {
+		return imageUploadError(err)
+	}
+	if err := os.MkdirAll(s.brandingImagesDir(), 0777); err != nil {
+		return err
+	}
+	// remove previous image, which can have different format
+	if prev, err := s.findBrandingImage(name); err == nil && prev != "" {
+		os.Remove(prev)
+	}
+	if err := os.WriteFile(filepath.Join(s.brandingImagesDir(), strings.ToLower(filename)), data, 0644); err != nil {
+		return fmt.Errorf("saving branding image: %w", err)
+	}
+	return s.handleGetBranding(c)
+}
+
+func (s *Server) handleDeleteBrandingImage(c echo.Context) error {
+	name := c.Param("image")
+	if !brandingImages.Has(name) {
+		return echo.ErrNotFound
+	}
+	path, err := s.findBrandingImage(name)
+	if err != nil {
+		return err
+	}
+	if path != "" {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("deleting branding image: %w", err)
+		}
+	}
+	return s.handleGetBranding(c)
+}
+
+func (s *Server) handleBrandingImage(c echo.Context) error {
+	name := c.Param("image")
+	if !brandingImages.Has(name) {
+		return echo.ErrNotFound
+	}
+	path, err := s.findBrandingImage(name)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return echo.ErrNotFound
+	}
+	// URL contains version of the image
+	if c.QueryParam("v") != "" {
+		c.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(30*24*time.Hour/time.Second)))
+	}
+	return c.File(path)
+}
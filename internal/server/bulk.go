@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	maxBulkProjects      = 500
+	bulkOperationTimeout = time.Minute
+)
+
+const (
+	BulkActionDelete     = "delete"
+	BulkActionUnpublish  = "unpublish"
+	BulkActionReload     = "reload"
+	BulkActionClearCache = "clear_cache"
+	BulkActionSetAccess  = "set_access"
+)
+
+var bulkActions = domain.StringArray{BulkActionDelete, BulkActionUnpublish, BulkActionReload, BulkActionClearCache, BulkActionSetAccess}
+
+var accessLevels = domain.StringArray{"public", "authenticated", "users", "private"}
+
+type BulkJobResult struct {
+	Project string `json:"project"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BulkJob describes action executed on multiple projects in the background
+type BulkJob struct {
+	ID       string          `json:"id"`
+	Action   string          `json:"action"`
+	Access   string          `json:"access,omitempty"`
+	User     string          `json:"user"`
+	Status   string          `json:"status"`
+	Created  time.Time       `json:"created"`
+	Finished time.Time       `json:"finished,omitempty"`
+	Results  []BulkJobResult `json:"results"`
+}
+
+type bulkJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*BulkJob
+	// operations have own time limit
+	runner *jobRunner
+}
+
+func newBulkJobs() *bulkJobs {
+	return &bulkJobs{jobs: make(map[string]*BulkJob), runner: newJobRunner(1, 0)}
+}
+
+func (j *bulkJobs) add(job *BulkJob) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jobs[job.ID] = job
+}
+
+func (j *bulkJobs) removeExpired() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for id, job := range j.jobs {
+		if !job.Finished.IsZero() && time.Since(job.Finished) > jobsTTL {
+			delete(j.jobs, id)
+		}
+	}
+}
+
+// Returns copy of the job
+func (j *bulkJobs) get(id string) (BulkJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return BulkJob{}, false
+	}
+	data := *job
+	data.Results = append([]BulkJobResult(nil), job.Results...)
+	return data, true
+}
+
+func (j *bulkJobs) update(job *BulkJob, fn func(job *BulkJob)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(job)
+}
+
+func (s *Server) runBulkAction(ctx context.Context, job *BulkJob, projectName string) error {
+	if _, err := s.projects.GetProjectInfo(projectName); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, bulkOperationTimeout)
+	defer cancel()
+	switch job.Action {
+	case BulkActionDelete:
+		return s.deleteProject(ctx, projectName)
+	case BulkActionUnpublish:
+		// project files are kept, it can be published again from the plugin
+		if err := s.projects.UpdateState(projectName, "staged"); err != nil {
+			return err
+		}
+		if s.Config.Catalog != nil {
+			go s.updateCatalogRecord(projectName)
+		}
+	case BulkActionReload:
+		return s.reloadProject(ctx, projectName)
+	case BulkActionClearCache:
+		return s.clearMapCache(projectName)
+	case BulkActionSetAccess:
+		return s.projects.UpdateAuthentication(projectName, job.Access)
+	}
+	return nil
+}
+
+// Executes action on all projects of the job, the job fails only when all operations fail
+func (s *Server) runBulkJob(ctx context.Context, job *BulkJob) error {
+	failed := 0
+	for i, r := range job.Results {
+		err := s.runBulkAction(ctx, job, r.Project)
+		s.bulkJobs.update(job, func(job *BulkJob) {
+			if err != nil {
+				job.Results[i].Status = JobFailed
+				if errors.Is(err, domain.ErrProjectNotExists) {
+					job.Results[i].Error = "Project does not exists"
+				} else {
+					job.Results[i].Error = "Operation failed"
+				}
+			} else {
+				job.Results[i].Status = JobDone
+			}
+		})
+		if err != nil {
+			failed++
+			s.log.Errorw("bulk project operation", "action", job.Action, "project", r.Project, "id", job.ID, zap.Error(err))
+		}
+	}
+	s.log.Infow("bulk project operation finished", "action", job.Action, "user", job.User, "projects", len(job.Results), "failed", failed)
+	if failed == len(job.Results) {
+		return errors.New("all operations failed")
+	}
+	return nil
+}
+
+func (s *Server) processBulkJob(job *BulkJob) {
+	run := func(ctx context.Context) error {
+		return s.runBulkJob(ctx, job)
+	}
+	s.bulkJobs.runner.Run(run, func(status string, err error) {
+		s.bulkJobs.update(job, func(job *BulkJob) {
+			job.Status = status
+			if status != JobRunning {
+				job.Finished = time.Now().UTC()
+			}
+		})
+	})
+}
+
+func (s *Server) handleCreateBulkJob() func(echo.Context) error {
+	type Form struct {
+		Action   string   `json:"action"`
+		Projects []string `json:"projects"`
+		Access   string   `json:"access"`
+	}
+	return func(c echo.Context) error {
+		form := new(Form)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		if !bulkActions.Has(form.Action) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid action")
+		}
+		if form.Action == BulkActionSetAccess && !accessLevels.Has(form.Access) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid access level")
+		}
+		if len(form.Projects) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Missing projects")
+		}
+		if len(form.Projects) > maxBulkProjects {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Too many projects (max %d)", maxBulkProjects))
+		}
+		results := make([]BulkJobResult, 0, len(form.Projects))
+		seen := make(map[string]bool, len(form.Projects))
+		for _, name := range form.Projects {
+			name = strings.TrimSpace(name)
+			if !isValidProjectName(name) {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid project name: %s", name))
+			}
+			if !seen[name] {
+				seen[name] = true
+				results = append(results, BulkJobResult{Project: name, Status: JobPending})
+			}
+		}
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		job := &BulkJob{
+			ID:      id.String(),
+			Action:  form.Action,
+			User:    user.Username,
+			Status:  JobPending,
+			Created: time.Now().UTC(),
+			Results: results,
+		}
+		if form.Action == BulkActionSetAccess {
+			job.Access = form.Access
+		}
+		s.bulkJobs.add(job)
+		go s.processBulkJob(job)
+		data, _ := s.bulkJobs.get(job.ID)
+		return c.JSON(http.StatusAccepted, data)
+	}
+}
+
+func (s *Server) handleGetBulkJob(c echo.Context) error {
+	job, ok := s.bulkJobs.get(c.Param("id"))
+	if !ok {
+		return echo.ErrNotFound
+	}
+	return c.JSON(http.StatusOK, job)
+}
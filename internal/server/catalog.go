@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const catalogSyncTimeout = time.Minute
+
+// Publishes metadata record of the project into the CSW catalog when the project is published
+// and opted in, otherwise removes previously published record
+func (s *Server) syncCatalogRecord(ctx context.Context, projectName string) (*project.CatalogStatus, error) {
+	prev, err := s.catalogStatus.Get(ctx, projectName)
+	if err != nil {
+		return nil, err
+	}
+	pInfo, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		return nil, fmt.Errorf("getting project info: %w", err)
+	}
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return nil, fmt.Errorf("getting project settings: %w", err)
+	}
+	publish := pInfo.State == "published" && settings.Metadata != nil && settings.Metadata.CatalogPublish
+	if !publish && prev == nil {
+		return nil, nil
+	}
+
+	status := project.CatalogStatus{
+		Identifier: s.metadataIdentifier(projectName),
+		Updated:    time.Now().UTC(),
+	}
+	if publish {
+		record, err := s.projectMetadata(projectName, iso19139Template)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.Config.Catalog.Upsert(ctx, record); err != nil {
+			s.log.Errorw("publishing catalog record", "project", projectName, zap.Error(err))
+			status.Error = err.Error()
+			status.Published = prev != nil && prev.Published
+		} else {
+			status.Published = true
+		}
+	} else {
+		if err := s.Config.Catalog.Delete(ctx, prev.Identifier); err != nil {
+			s.log.Errorw("removing catalog record", "project", projectName, zap.Error(err))
+			status.Error = err.Error()
+			status.Published = prev.Published
+		}
+	}
+	if err := s.catalogStatus.Set(ctx, projectName, status); err != nil {
+		return nil, fmt.Errorf("saving catalog status: %w", err)
+	}
+	return &status, nil
+}
+
+func (s *Server) updateCatalogRecord(projectName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), catalogSyncTimeout)
+	defer cancel()
+	if _, err := s.syncCatalogRecord(ctx, projectName); err != nil {
+		s.log.Errorw("updating catalog record", "project", projectName, zap.Error(err))
+	}
+}
+
+// Removes catalog record of the deleted project
+func (s *Server) removeCatalogRecord(projectName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), catalogSyncTimeout)
+	defer cancel()
+	status, err := s.catalogStatus.Get(ctx, projectName)
+	if err != nil || status == nil {
+		return
+	}
+	if err := s.Config.Catalog.Delete(ctx, status.Identifier); err != nil {
+		s.log.Errorw("removing catalog record", "project", projectName, zap.Error(err))
+	}
+	if err := s.catalogStatus.Remove(ctx, projectName); err != nil {
+		s.log.Errorw("removing catalog status", "project", projectName, zap.Error(err))
+	}
+}
+
+func (s *Server) handleGetCatalogStatus(c echo.Context) error {
+	status, err := s.catalogStatus.Get(c.Request().Context(), getProjectName(c))
+	if err != nil {
+		return err
+	}
+	if status == nil {
+		status = &project.CatalogStatus{}
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+func (s *Server) handleSyncCatalogRecord(c echo.Context) error {
+	status, err := s.syncCatalogRecord(c.Request().Context(), getProjectName(c))
+	if err != nil {
+		return err
+	}
+	if status == nil {
+		status = &project.CatalogStatus{}
+	}
+	return c.JSON(http.StatusOK, status)
+}
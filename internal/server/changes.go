@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type wfsTransactionKey struct{}
+
+type wfsTransactionInfo struct {
+	Project     string
+	User        string
+	Transaction Transaction
+}
+
+// Converts WFS transaction into list of layer changes (insertedIds are taken from transaction response)
+func transactionChanges(info wfsTransactionInfo, insertedIds []string) []domain.LayerChange {
+	now := time.Now().UTC()
+	var changes []domain.LayerChange
+	index := 0
+	for _, op := range info.Transaction.Operations {
+		c := domain.LayerChange{Project: info.Project, User: info.User, Time: now, Action: op.Action, Layer: op.Layer, Attributes: op.Attributes}
+		if op.Action == wfsReplace {
+			c.Action = wfsUpdate
+		}
+		if op.Action == wfsInsert {
+			if index < len(insertedIds) {
+				c.FeatureID = insertedIds[index]
+			}
+			index++
+			changes = append(changes, c)
+			continue
+		}
+		// affected features are unknown when filter contains other conditions
+		if len(op.FeatureIDs) == 0 || op.Filtered {
+			changes = append(changes, c)
+			continue
+		}
+		for _, fid := range op.FeatureIDs {
+			c.FeatureID = fid
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// Stores parsed WFS transaction in the request context, so the changes can be recorded
+// after successful response
+func (s *Server) withWfsTransaction(c echo.Context, req *http.Request, projectName string, transaction Transaction) *http.Request {
+	info := wfsTransactionInfo{Project: projectName, Transaction: transaction}
+	if user, err := s.auth.GetUser(c); err == nil {
+		info.User = user.Username
+	}
+	return req.WithContext(context.WithValue(req.Context(), wfsTransactionKey{}, info))
+}
+
+func (s *Server) recordLayerChanges(changes ...domain.LayerChange) {
+	if err := s.changes.Add(changes...); err != nil {
+		s.log.Errorw("saving layer changes", zap.Error(err))
+	}
+	projectsChanges := make(map[string][]domain.LayerChange)
+	var projects []string
+	for _, c := range changes {
+		if _, ok := projectsChanges[c.Project]; !ok {
+			projects = append(projects, c.Project)
+		}
+		projectsChanges[c.Project] = append(projectsChanges[c.Project], c)
+	}
+	for _, p := range projects {
+		s.events.Publish(application.Event{
+			Type:    application.EventWfsCommitted,
+			Project: p,
+			User:    projectsChanges[p][0].User,
+			Data:    application.WfsCommittedData{Changes: projectsChanges[p]},
+		})
+	}
+}
+
+// Records changes of successful WFS transactions
+func (s *Server) wfsTransactionInterceptor(resp *http.Response) error {
+	info, ok := resp.Request.Context().Value(wfsTransactionKey{}).(wfsTransactionInfo)
+	if !ok || resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := resp.Body.Close(); err != nil {
+		return err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var result wfsTransactionResponse
+	if err := xml.Unmarshal(body, &result); err != nil || !result.succeeded() {
+		return nil
+	}
+	s.recordLayerChanges(transactionChanges(info, result.insertedIds())...)
+	return nil
+}
+
+func (s *Server) handleGetLayerChanges(c echo.Context) error {
+	type Payload struct {
+		Changes []domain.LayerChange `json:"changes"`
+		Last    int64                `json:"last"`
+	}
+	projectName := getProjectName(c)
+	layer := c.Param("layer")
+
+	var since int64
+	if v := c.QueryParam("since"); v != "" {
+		seq, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid since parameter")
+		}
+		since = seq
+	}
+	var sinceTime time.Time
+	if v := c.QueryParam("since_time"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid since_time parameter")
+		}
+		sinceTime = t
+	}
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return fmt.Errorf("getting project settings: %w", err)
+	}
+	layersData, err := s.projects.GetLayersData(projectName)
+	if err != nil {
+		return fmt.Errorf("getting layer data: %w", err)
+	}
+	layerName := layer
+	layerId, ok := layersData.LayerNameToID[layerName]
+	if !ok {
+		layerName = strings.ReplaceAll(layer, "_", " ")
+		layerId, ok = layersData.LayerNameToID[layerName]
+	}
+	if !ok || settings.Layers[layerId].Flags.Has("excluded") {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid layer")
+	}
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	userRoles := domain.FilterUserRoles(user, settings.Auth.Roles)
+	if !settings.Layers[layerId].Roles.Allows(user, userRoles) {
+		return echo.ErrForbidden
+	}
+	if len(settings.Auth.Roles) > 0 && !settings.UserLayerPermissionsFlags(user, layerId).Has("query") {
+		return echo.ErrForbidden
+	}
+
+	// changes are recorded under WFS type name of the layer
+	typeName := strings.ReplaceAll(layerName, " ", "_")
+	changes, err := s.changes.List(projectName, typeName, since, sinceTime, limit)
+	if err != nil {
+		return fmt.Errorf("listing layer changes: %w", err)
+	}
+	data := Payload{Changes: changes, Last: since}
+	if len(changes) > 0 {
+		data.Last = changes[len(changes)-1].Seq
+	}
+	return c.JSON(http.StatusOK, data)
+}
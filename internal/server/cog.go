@@ -0,0 +1,318 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const cogJobTimeout = 2 * time.Hour
+
+type CogConfig struct {
+	// converter command with {input} and {output} placeholders (empty value disables conversion)
+	Converter string
+	// minimal size of GeoTIFF files offered for conversion
+	MinSize int64
+}
+
+// CogJob describes validation and conversion of GeoTIFF file into Cloud Optimized GeoTIFF
+type CogJob struct {
+	ID        string    `json:"id"`
+	Project   string    `json:"project"`
+	File      string    `json:"file"`
+	User      string    `json:"user"`
+	Status    string    `json:"status"`
+	Progress  int       `json:"progress"`
+	Converted bool      `json:"converted"`
+	Created   time.Time `json:"created"`
+	Finished  time.Time `json:"finished,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type cogJobs struct {
+	mu     sync.Mutex
+	jobs   map[string]*CogJob
+	runner *jobRunner
+}
+
+func newCogJobs() *cogJobs {
+	return &cogJobs{jobs: make(map[string]*CogJob), runner: newJobRunner(1, cogJobTimeout)}
+}
+
+func (j *cogJobs) add(job *CogJob) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jobs[job.ID] = job
+}
+
+func (j *cogJobs) removeExpired() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for id, job := range j.jobs {
+		if !job.Finished.IsZero() && time.Since(job.Finished) > jobsTTL {
+			delete(j.jobs, id)
+		}
+	}
+}
+
+// Returns copy of the job
+func (j *cogJobs) get(id string) (CogJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return CogJob{}, false
+	}
+	return *job, true
+}
+
+func (j *cogJobs) update(job *CogJob, fn func(job *CogJob)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(job)
+}
+
+func (j *cogJobs) running(project, file string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, job := range j.jobs {
+		if job.Project == project && job.File == file && job.Finished.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// Splits output of GDAL progress reporter ("0...10...20...") into progress values
+func scanProgress(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for i, b := range data {
+		if b == '.' || b == ' ' || b == '\n' || b == '\r' {
+			if i == 0 {
+				return 1, nil, nil
+			}
+			return i + 1, data[:i], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func (s *Server) runCogConverter(ctx context.Context, input, output string, progress func(int)) error {
+	var args []string
+	for _, arg := range strings.Fields(s.Config.Cog.Converter) {
+		arg = strings.ReplaceAll(arg, "{input}", input)
+		arg = strings.ReplaceAll(arg, "{output}", output)
+		args = append(args, arg)
+	}
+	if len(args) == 0 {
+		return errors.New("converter is not configured")
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(scanProgress)
+	for scanner.Scan() {
+		if v, err := strconv.Atoi(scanner.Text()); err == nil && v >= 0 && v <= 100 {
+			progress(v)
+		}
+	}
+	io.Copy(io.Discard, stdout)
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (s *Server) runCogJob(ctx context.Context, job *CogJob) error {
+	input := filepath.Join(s.Config.ProjectsRoot, job.Project, job.File)
+	info, err := rasterInfo(ctx, input)
+	if err != nil {
+		return err
+	}
+	if info.COG {
+		// already valid COG
+		return nil
+	}
+	tmpDir, err := os.MkdirTemp("", "cog")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	output := filepath.Join(tmpDir, filepath.Base(job.File))
+
+	err = s.runCogConverter(ctx, input, output, func(p int) {
+		s.cogJobs.update(job, func(job *CogJob) { job.Progress = p })
+	})
+	if err != nil {
+		return err
+	}
+	outInfo, err := rasterInfo(ctx, output)
+	if err != nil {
+		return err
+	}
+	if !outInfo.COG {
+		return errors.New("converted file is not valid cloud optimized GeoTIFF")
+	}
+	stat, err := os.Stat(output)
+	if err != nil {
+		return err
+	}
+	file := domain.ProjectFile{Path: job.File, Size: stat.Size(), Mtime: time.Now().Unix()}
+	changes := domain.FilesChanges{Updates: []domain.ProjectFile{file}}
+	next := func() (string, io.ReadCloser, error) {
+		f, err := os.Open(output)
+		return job.File, f, err
+	}
+	// converted file replaces the original one atomically
+	if _, err := s.projects.UpdateFiles(job.Project, changes, next); err != nil {
+		return fmt.Errorf("replacing project file: %w", err)
+	}
+	s.cogJobs.update(job, func(job *CogJob) { job.Converted = true })
+	s.indexRasterFiles(job.Project, []domain.ProjectFile{file})
+	return nil
+}
+
+func (s *Server) processCogJob(job *CogJob) {
+	run := func(ctx context.Context) error {
+		return s.runCogJob(ctx, job)
+	}
+	err := s.cogJobs.runner.Run(run, func(status string, err error) {
+		s.cogJobs.update(job, func(job *CogJob) {
+			job.Status = status
+			switch status {
+			case JobDone:
+				job.Finished = time.Now().UTC()
+				job.Progress = 100
+			case JobFailed:
+				job.Finished = time.Now().UTC()
+				job.Error = "Conversion failed"
+			}
+		})
+	})
+	if err != nil {
+		s.log.Errorw("cog conversion", "project", job.Project, "file", job.File, "id", job.ID, zap.Error(err))
+	}
+}
+
+// Returns indexed GeoTIFF files which are not cloud optimized
+func (s *Server) cogCandidates(projectName string) ([]RasterInfo, error) {
+	rasters, err := s.projectRasters(projectName)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]RasterInfo, 0)
+	for _, r := range rasters {
+		if !r.COG && r.Size >= s.Config.Cog.MinSize {
+			candidates = append(candidates, r)
+		}
+	}
+	return candidates, nil
+}
+
+// Notifies user about uploaded GeoTIFF files which can be converted
+func (s *Server) offerCogConversion(username, projectName string, files []domain.ProjectFile) {
+	candidates, err := s.cogCandidates(projectName)
+	if err != nil {
+		s.log.Errorw("finding cog conversion candidates", "project", projectName, zap.Error(err))
+		return
+	}
+	uploaded := make(map[string]bool, len(files))
+	for _, f := range files {
+		uploaded[f.Path] = true
+	}
+	var paths []string
+	for _, c := range candidates {
+		if uploaded[c.Path] {
+			paths = append(paths, c.Path)
+		}
+	}
+	if len(paths) > 0 {
+		data := map[string]interface{}{"project": projectName, "files": paths}
+		s.sws.AppChannel().Send(username, "CogConversionAvailable", data)
+	}
+}
+
+func (s *Server) handleGetCogCandidates(c echo.Context) error {
+	candidates, err := s.cogCandidates(getProjectName(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, candidates)
+}
+
+func (s *Server) handleCreateCogJob() func(echo.Context) error {
+	type Form struct {
+		File string `json:"file"`
+	}
+	return func(c echo.Context) error {
+		projectName := getProjectName(c)
+		form := new(Form)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		path := filepath.Clean(form.File)
+		if !isRasterFile(path) || strings.HasPrefix(path, "..") || filepath.IsAbs(path) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid file")
+		}
+		if _, err := os.Stat(filepath.Join(s.Config.ProjectsRoot, projectName, path)); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid file")
+		}
+		if s.cogJobs.running(projectName, path) {
+			return echo.NewHTTPError(http.StatusConflict, "File is already being converted")
+		}
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		job := &CogJob{
+			ID:      id.String(),
+			Project: projectName,
+			File:    path,
+			User:    user.Username,
+			Status:  JobPending,
+			Created: time.Now().UTC(),
+		}
+		s.cogJobs.add(job)
+		go s.processCogJob(job)
+		data, _ := s.cogJobs.get(job.ID)
+		return c.JSON(http.StatusAccepted, data)
+	}
+}
+
+func (s *Server) handleGetCogJob(c echo.Context) error {
+	job, ok := s.cogJobs.get(c.Param("id"))
+	if !ok || job.Project != getProjectName(c) {
+		return echo.ErrNotFound
+	}
+	return c.JSON(http.StatusOK, job)
+}
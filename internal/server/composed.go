@@ -0,0 +1,474 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+const maxComposedSources = 10
+
+var composedNameRegex = regexp.MustCompile(`^[\w\-]{1,64}$`)
+
+// Layers of a single published project included in the composed map
+type ComposedSource struct {
+	Project string   `json:"project"`
+	Layers  []string `json:"layers"` // layer IDs
+}
+
+// Map composed from the layers of several projects of the same user
+type ComposedMap struct {
+	Name    string           `json:"name"`
+	Title   string           `json:"title"`
+	Sources []ComposedSource `json:"sources"`
+	Updated time.Time        `json:"updated"`
+}
+
+func (s *Server) composedMapsPath(username string) string {
+	return filepath.Join(s.Config.ProjectsRoot, username, "composed_maps.json")
+}
+
+func (s *Server) loadComposedMaps(username string) (map[string]ComposedMap, error) {
+	maps := make(map[string]ComposedMap)
+	data, err := os.ReadFile(s.composedMapsPath(username))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return maps, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &maps); err != nil {
+		return nil, err
+	}
+	return maps, nil
+}
+
+func (s *Server) saveComposedMaps(username string, maps map[string]ComposedMap) error {
+	data, err := json.Marshal(maps)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.composedMapsPath(username)), 0775); err != nil {
+		return err
+	}
+	return os.WriteFile(s.composedMapsPath(username), data, 0644)
+}
+
+// Returns mapping of the WMS layer names to the source projects
+func (s *Server) composedLayersSources(m ComposedMap) (map[string]string, error) {
+	sources := make(map[string]string)
+	for _, src := range m.Sources {
+		layersData, err := s.projects.GetLayersData(src.Project)
+		if err != nil {
+			return nil, fmt.Errorf("getting layer data of %s: %w", src.Project, err)
+		}
+		ids := domain.StringArray(src.Layers)
+		for name, id := range layersData.LayerNameToID {
+			if ids.Has(id) {
+				sources[name] = src.Project
+			}
+		}
+	}
+	return sources, nil
+}
+
+// Validates sources of the composed map (projects of the owner with existing and unique layers)
+func (s *Server) validateComposedMap(username string, m ComposedMap) error {
+	if len(m.Sources) == 0 || len(m.Sources) > maxComposedSources {
+		return fmt.Errorf("composed map must have 1-%d source projects", maxComposedSources)
+	}
+	names := make(map[string]string)
+	for _, src := range m.Sources {
+		if !strings.HasPrefix(src.Project, username+"/") || strings.Count(src.Project, "/") != 1 || strings.Contains(src.Project, "..") {
+			return fmt.Errorf("invalid source project: %s", src.Project)
+		}
+		var meta domain.QgisMeta
+		if err := s.projects.GetQgisMetadata(src.Project, &meta); err != nil {
+			return fmt.Errorf("invalid source project: %s", src.Project)
+		}
+		if len(src.Layers) == 0 {
+			return fmt.Errorf("no layers selected from project: %s", src.Project)
+		}
+		for _, id := range src.Layers {
+			lmeta, ok := meta.Layers[id]
+			if !ok {
+				return fmt.Errorf("unknown layer in project %s: %s", src.Project, id)
+			}
+			// layers are identified by the name in OWS requests
+			if p, exists := names[lmeta.Name]; exists && p != src.Project {
+				return fmt.Errorf("duplicate layer name: %s", lmeta.Name)
+			}
+			names[lmeta.Name] = src.Project
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleGetComposedMaps(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	maps, err := s.loadComposedMaps(user.Username)
+	if err != nil {
+		return fmt.Errorf("loading composed maps: %w", err)
+	}
+	list := make([]ComposedMap, 0, len(maps))
+	for _, m := range maps {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return c.JSON(http.StatusOK, list)
+}
+
+func (s *Server) handleSaveComposedMap(c echo.Context) error {
+	name := c.Param("map")
+	if !composedNameRegex.MatchString(name) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid map name")
+	}
+	m := new(ComposedMap)
+	if err := (&echo.DefaultBinder{}).BindBody(c, m); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+	}
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	if err := s.validateComposedMap(user.Username, *m); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	m.Name = name
+	m.Updated = time.Now().UTC()
+
+	s.composedMu.Lock()
+	defer s.composedMu.Unlock()
+	maps, err := s.loadComposedMaps(user.Username)
+	if err != nil {
+		return fmt.Errorf("loading composed maps: %w", err)
+	}
+	maps[name] = *m
+	if err := s.saveComposedMaps(user.Username, maps); err != nil {
+		return fmt.Errorf("saving composed maps: %w", err)
+	}
+	return c.JSON(http.StatusOK, m)
+}
+
+func (s *Server) handleDeleteComposedMap(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	s.composedMu.Lock()
+	defer s.composedMu.Unlock()
+	maps, err := s.loadComposedMaps(user.Username)
+	if err != nil {
+		return fmt.Errorf("loading composed maps: %w", err)
+	}
+	name := c.Param("map")
+	if _, ok := maps[name]; !ok {
+		return echo.ErrNotFound
+	}
+	delete(maps, name)
+	if err := s.saveComposedMaps(user.Username, maps); err != nil {
+		return fmt.Errorf("saving composed maps: %w", err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) getComposedMap(c echo.Context) (ComposedMap, error) {
+	if strings.HasPrefix(c.Param("user"), ".") {
+		return ComposedMap{}, echo.ErrNotFound
+	}
+	maps, err := s.loadComposedMaps(c.Param("user"))
+	if err != nil {
+		return ComposedMap{}, fmt.Errorf("loading composed maps: %w", err)
+	}
+	m, ok := maps[c.Param("name")]
+	if !ok {
+		return m, echo.NewHTTPError(http.StatusNotFound, "Map does not exists")
+	}
+	return m, nil
+}
+
+// Switches route parameters of the request context to the source project,
+// so the project handlers and middlewares can be used
+func setSourceProject(c echo.Context, projectName string) {
+	parts := strings.SplitN(projectName, "/", 2)
+	c.SetParamNames("user", "name")
+	c.SetParamValues(parts[0], parts[1])
+}
+
+// Keeps only layers with given names in the layers tree (in generic JSON form)
+func filterLayersTree(nodes []interface{}, names domain.StringArray) []interface{} {
+	list := make([]interface{}, 0)
+	for _, n := range nodes {
+		node, ok := n.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if children, isGroup := node["layers"].([]interface{}); isGroup {
+			if layers := filterLayersTree(children, names); len(layers) > 0 {
+				node["layers"] = layers
+				list = append(list, node)
+			}
+		} else if name, _ := node["name"].(string); names.Has(name) {
+			list = append(list, node)
+		}
+	}
+	return list
+}
+
+// Returns map config merged from the configs of the source projects. Access to each source project
+// is checked, general map properties (projection, scales, base layers) are taken from the first source.
+func (s *Server) handleGetComposedMap(access echo.MiddlewareFunc) echo.HandlerFunc {
+	allowed := access(func(echo.Context) error { return nil })
+	return func(c echo.Context) error {
+		m, err := s.getComposedMap(c)
+		if err != nil {
+			return err
+		}
+		mapName := filepath.Join(c.Param("user"), c.Param("name"))
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		layersSources, err := s.composedLayersSources(m)
+		if err != nil {
+			return err
+		}
+		data := make(map[string]interface{})
+		groups := make([]interface{}, 0, len(m.Sources))
+		symbology := make(map[string]json.RawMessage)
+		styles := make(map[string]json.RawMessage)
+		for i, src := range m.Sources {
+			setSourceProject(c, src.Project)
+			if err := allowed(c); err != nil {
+				return err
+			}
+			cfg, err := s.projects.GetMapConfig(src.Project, user)
+			if err != nil {
+				return fmt.Errorf("getting map config of %s: %w", src.Project, err)
+			}
+			// generic form of the config
+			content, err := json.Marshal(cfg)
+			if err != nil {
+				return err
+			}
+			var srcData struct {
+				Title     string                     `json:"title"`
+				Layers    []interface{}              `json:"layers"`
+				Symbology map[string]json.RawMessage `json:"symbology"`
+				Styles    map[string]json.RawMessage `json:"styles"`
+			}
+			if err := json.Unmarshal(content, &srcData); err != nil {
+				return err
+			}
+			if i == 0 {
+				for _, key := range []string{"projection", "projections", "units", "scales", "tile_resolutions", "base_layers", "zoom_extent", "project_extent"} {
+					data[key] = cfg[key]
+				}
+			}
+			var names domain.StringArray
+			for name, project := range layersSources {
+				if project == src.Project {
+					names = append(names, name)
+				}
+			}
+			if layers := filterLayersTree(srcData.Layers, names); len(layers) > 0 {
+				groups = append(groups, map[string]interface{}{"name": srcData.Title, "layers": layers})
+			}
+			for _, name := range names {
+				if v, ok := srcData.Symbology[name]; ok {
+					symbology[name] = v
+				}
+				if v, ok := srcData.Styles[name]; ok {
+					styles[name] = v
+				}
+			}
+		}
+		data["name"] = mapName
+		data["title"] = m.Title
+		data["root_title"] = m.Title
+		data["layers"] = groups
+		data["layers_sources"] = layersSources
+		data["ows_url"] = fmt.Sprintf("/api/map/composed/%s/ows", mapName)
+		data["ows_project"] = mapName
+		data["use_mapcache"] = false
+		data["map_tiling"] = false
+		if len(symbology) > 0 {
+			data["symbology"] = symbology
+		}
+		if len(styles) > 0 {
+			data["styles"] = styles
+		}
+		return c.JSON(http.StatusOK, data)
+	}
+}
+
+// Response writer buffering the response of the source project request
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+}
+
+func (r *bufferedResponse) Header() http.Header         { return r.header }
+func (r *bufferedResponse) Write(b []byte) (int, error) { return r.body.Write(b) }
+func (r *bufferedResponse) WriteHeader(status int)      { r.status = status }
+func (r *bufferedResponse) Flush()                      {}
+
+// Names of the layers referenced in OWS request
+func composedRequestLayers(query url.Values) []string {
+	var layers []string
+	for _, param := range []string{"LAYERS", "QUERY_LAYERS", "LAYER"} {
+		for _, name := range strings.Split(owsValue(query, param), ",") {
+			if name != "" {
+				layers = append(layers, name)
+			}
+		}
+	}
+	// conflicting parameters are rejected by the OWS handler of the source project
+	typeNames, _ := wfsTypeNames(query)
+	for _, typeName := range typeNames {
+		layers = append(layers, layerName(typeName))
+	}
+	return layers
+}
+
+func composedLayerSource(sources map[string]string, name string) string {
+	if project, ok := sources[name]; ok {
+		return project
+	}
+	// spaces in layer names are replaced by underscores in WFS type names
+	return sources[strings.ReplaceAll(name, "_", " ")]
+}
+
+// Splits comma separated list parameter (e.g. STYLES) by the indexes of layers
+func sliceListParam(query url.Values, name string, start, end int) {
+	value := owsValue(query, name)
+	if value == "" {
+		return
+	}
+	items := strings.Split(value, ",")
+	if end <= len(items) {
+		replaceQueryParam(query, name, strings.Join(items[start:end], ","))
+	}
+}
+
+// Fans out OWS requests of the composed map to the source projects, permissions are evaluated
+// by the OWS handler of the source project. GetMap requests with layers from multiple projects
+// are rendered separately and composed into single PNG image, other requests must reference
+// layers of a single project.
+func (s *Server) handleComposedOws(ows echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.Request().Method != http.MethodGet {
+			return echo.NewHTTPError(http.StatusMethodNotAllowed, "Only GET requests are supported by composed maps")
+		}
+		m, err := s.getComposedMap(c)
+		if err != nil {
+			return err
+		}
+		layersSources, err := s.composedLayersSources(m)
+		if err != nil {
+			return err
+		}
+		req := c.Request()
+		query := req.URL.Query()
+		layers := composedRequestLayers(query)
+		if len(layers) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Request doesn't reference any layer of the composed map")
+		}
+		// runs of the consecutive layers from the same project
+		type layersRun struct {
+			project    string
+			start, end int
+		}
+		var runs []layersRun
+		for i, name := range layers {
+			project := composedLayerSource(layersSources, name)
+			if project == "" {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Unknown layer: %s", name))
+			}
+			if len(runs) > 0 && runs[len(runs)-1].project == project {
+				runs[len(runs)-1].end = i + 1
+			} else {
+				runs = append(runs, layersRun{project: project, start: i, end: i + 1})
+			}
+		}
+		forward := func(project string, query url.Values) error {
+			r := req.Clone(req.Context())
+			r.URL.RawQuery = query.Encode()
+			c.SetRequest(r)
+			setSourceProject(c, project)
+			return ows(c)
+		}
+		if len(runs) == 1 {
+			return forward(runs[0].project, query)
+		}
+		if !strings.EqualFold(owsValue(query, "REQUEST"), "GetMap") {
+			return echo.NewHTTPError(http.StatusBadRequest, "Request references layers from multiple projects")
+		}
+		if !strings.HasPrefix(owsValue(query, "FORMAT"), "image/png") {
+			return echo.NewHTTPError(http.StatusBadRequest, "Only PNG format is supported for layers from multiple projects")
+		}
+		response := c.Response()
+		var result *image.RGBA
+		for _, run := range runs {
+			q := url.Values{}
+			for k, v := range query {
+				q[k] = v
+			}
+			replaceQueryParam(q, "LAYERS", strings.Join(layers[run.start:run.end], ","))
+			sliceListParam(q, "STYLES", run.start, run.end)
+			sliceListParam(q, "OPACITIES", run.start, run.end)
+			replaceQueryParam(q, "TRANSPARENT", "TRUE")
+
+			buf := newBufferedResponse()
+			c.SetResponse(echo.NewResponse(buf, c.Echo()))
+			err := forward(run.project, q)
+			c.SetResponse(response)
+			if err != nil {
+				return err
+			}
+			if buf.status != http.StatusOK || !strings.HasPrefix(buf.header.Get(echo.HeaderContentType), "image/png") {
+				// pass error response of the source project
+				for k, v := range buf.header {
+					response.Header()[k] = v
+				}
+				return c.Blob(buf.status, buf.header.Get(echo.HeaderContentType), buf.body.Bytes())
+			}
+			img, err := png.Decode(&buf.body)
+			if err != nil {
+				return fmt.Errorf("decoding map image of %s: %w", run.project, err)
+			}
+			if result == nil {
+				result = image.NewRGBA(img.Bounds())
+			}
+			draw.Draw(result, result.Bounds(), img, img.Bounds().Min, draw.Over)
+		}
+		var out bytes.Buffer
+		if err := png.Encode(&out, result); err != nil {
+			return fmt.Errorf("encoding map image: %w", err)
+		}
+		return c.Blob(http.StatusOK, "image/png", out.Bytes())
+	}
+}
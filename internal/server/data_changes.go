@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/infrastructure/postgres"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Event pushed to the map clients, empty list of layers means that any layer could be changed
+type LayersChangedEvent struct {
+	Source  string   `json:"source"` // "wfs" or "database"
+	Channel string   `json:"channel,omitempty"`
+	Layers  []string `json:"layers,omitempty"`
+	// timestamp (ms) which can be used by clients to bypass cached tiles
+	Time int64 `json:"time"`
+}
+
+// Payload of the notification sent by database triggers. Plain text payload is considered as a project name.
+type dataChangesPayload struct {
+	Project  string   `json:"project"`
+	Projects []string `json:"projects"`
+	Layer    string   `json:"layer"`
+	Layers   []string `json:"layers"`
+}
+
+func parseDataChangesPayload(payload string) dataChangesPayload {
+	var p dataChangesPayload
+	payload = strings.TrimSpace(payload)
+	if payload == "" {
+		return p
+	}
+	if strings.HasPrefix(payload, "{") {
+		if err := json.Unmarshal([]byte(payload), &p); err == nil {
+			if p.Project != "" {
+				p.Projects = append(p.Projects, p.Project)
+			}
+			if p.Layer != "" {
+				p.Layers = append(p.Layers, p.Layer)
+			}
+			return p
+		}
+	}
+	p.Projects = []string{payload}
+	return p
+}
+
+// ParseDataChangesChannels parses channels configuration in format "channel1=user/project1|user/project2,channel2".
+// Projects of the channel without explicit projects list are taken from the notification payload.
+func ParseDataChangesChannels(value string) (map[string][]string, error) {
+	channels := make(map[string][]string)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, projects, _ := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("invalid channel configuration: %s", item)
+		}
+		channels[name] = nil
+		for _, p := range strings.Split(projects, "|") {
+			if p = strings.TrimSpace(p); p != "" {
+				channels[name] = append(channels[name], p)
+			}
+		}
+	}
+	return channels, nil
+}
+
+// Notifies connected map clients about changed layers
+func (s *Server) layersChanged(projectName string, event LayersChangedEvent) {
+	if s.mapws.Clients(projectName) == 0 {
+		return
+	}
+	event.Time = time.Now().UnixMilli()
+	go s.mapws.Broadcast(projectName, "LayersChanged", event)
+}
+
+// Invalidates caches of the project and notifies connected map clients about changed data
+func (s *Server) dataChanged(projectName string, event LayersChangedEvent) {
+	if _, err := s.projects.GetProjectInfo(projectName); err != nil {
+		s.log.Warnw("data changes notification", "project", projectName, zap.Error(err))
+		return
+	}
+	if err := s.clearMapCache(projectName); err != nil {
+		s.log.Errorw("clearing project map cache", "project", projectName, zap.Error(err))
+	}
+	s.log.Infow("data changed", "project", projectName, "channel", event.Channel, "clients", s.mapws.Clients(projectName))
+	s.layersChanged(projectName, event)
+}
+
+func (s *Server) handleDataNotification(channel, payload string) {
+	if channel == "" {
+		// connection was re-established, notifications could be lost in the meantime
+		for ch, projects := range s.Config.DataChangesChannels {
+			for _, p := range projects {
+				s.dataChanged(p, LayersChangedEvent{Source: "database", Channel: ch})
+			}
+		}
+		return
+	}
+	projects, ok := s.Config.DataChangesChannels[channel]
+	if !ok {
+		return
+	}
+	data := parseDataChangesPayload(payload)
+	if len(projects) == 0 {
+		projects = data.Projects
+	}
+	for _, p := range projects {
+		s.dataChanged(p, LayersChangedEvent{Source: "database", Channel: channel, Layers: data.Layers})
+	}
+}
+
+// ListenDataChanges listens for notifications about external data changes until the context is cancelled
+func (s *Server) ListenDataChanges(ctx context.Context, dsn string) error {
+	if len(s.Config.DataChangesChannels) == 0 {
+		return nil
+	}
+	channels := make([]string, 0, len(s.Config.DataChangesChannels))
+	for ch := range s.Config.DataChangesChannels {
+		channels = append(channels, ch)
+	}
+	listener := postgres.NewListener(s.log, dsn, channels)
+	return listener.Listen(ctx, s.handleDataNotification)
+}
+
+func (s *Server) handleMapWS(c echo.Context) error {
+	projectName := getProjectName(c)
+	if err := s.mapws.Handler(projectName, c.Response(), c.Request()); err != nil {
+		s.log.Errorw("websocket handler", "channel", "map", "project", projectName, zap.Error(err))
+	}
+	return nil
+}
@@ -0,0 +1,450 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+const datasetInfoTimeout = 2 * time.Minute
+
+var (
+	vectorExtensions = []string{".gpkg", ".shp", ".geojson", ".kml", ".gml", ".fgb", ".sqlite"}
+	wktNameRegex     = regexp.MustCompile(`^\s*\w+\[\s*"([^"]*)"`)
+)
+
+type DatasetsConfig struct {
+	// metadata extractor: "gdal" (gdalinfo/ogrinfo commands), "service" or "native" (pure Go readers
+	// of GeoJSON and Shapefile formats), empty value disables extraction
+	Extractor string
+	// URL of the extraction service, called with project, path (relative to projects root) and type
+	// query parameters, responds with JSON output of gdalinfo/ogrinfo
+	ServiceURL string
+}
+
+type DatasetLayer struct {
+	Name         string    `json:"name"`
+	GeometryType string    `json:"geometry_type,omitempty"`
+	FeatureCount int64     `json:"feature_count"`
+	CRS          string    `json:"crs,omitempty"`
+	Extent       []float64 `json:"extent,omitempty"`
+}
+
+// Metadata of uploaded vector or raster dataset
+type DatasetInfo struct {
+	Path   string         `json:"path"`
+	Size   int64          `json:"size"`
+	Mtime  int64          `json:"mtime"`
+	Type   string         `json:"type"` // raster or vector
+	Driver string         `json:"driver,omitempty"`
+	CRS    string         `json:"crs,omitempty"`
+	Extent []float64      `json:"extent,omitempty"`
+	Width  int            `json:"width,omitempty"`
+	Height int            `json:"height,omitempty"`
+	Bands  []RasterBand   `json:"bands,omitempty"`
+	Layers []DatasetLayer `json:"layers,omitempty"`
+	// extraction error (e.g. corrupted or incomplete dataset)
+	Error string `json:"error,omitempty"`
+}
+
+func isVectorFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range vectorExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns CRS code (e.g. EPSG:4326) or name of the CRS defined in WKT format
+func wktCRS(wkt string) string {
+	if m := wktEpsgRegex.FindStringSubmatch(wkt); m != nil {
+		return "EPSG:" + m[1]
+	}
+	if m := wktNameRegex.FindStringSubmatch(wkt); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func rasterDatasetInfo(r RasterInfo) DatasetInfo {
+	return DatasetInfo{
+		Type:   "raster",
+		Driver: "GTiff",
+		CRS:    r.CRS,
+		Extent: r.BBox,
+		Width:  r.Width,
+		Height: r.Height,
+		Bands:  r.Bands,
+	}
+}
+
+func parseOgrInfo(data []byte) (DatasetInfo, error) {
+	var oi struct {
+		Driver string `json:"driverShortName"`
+		Layers []struct {
+			Name           string `json:"name"`
+			FeatureCount   int64  `json:"featureCount"`
+			GeometryFields []struct {
+				Type             string `json:"type"`
+				CoordinateSystem struct {
+					Wkt string `json:"wkt"`
+				} `json:"coordinateSystem"`
+				Extent []float64 `json:"extent"`
+			} `json:"geometryFields"`
+		} `json:"layers"`
+	}
+	info := DatasetInfo{Type: "vector"}
+	if err := json.Unmarshal(data, &oi); err != nil {
+		return info, err
+	}
+	info.Driver = oi.Driver
+	info.Layers = make([]DatasetLayer, len(oi.Layers))
+	for i, l := range oi.Layers {
+		info.Layers[i] = DatasetLayer{Name: l.Name, FeatureCount: l.FeatureCount}
+		if len(l.GeometryFields) > 0 {
+			g := l.GeometryFields[0]
+			info.Layers[i].GeometryType = g.Type
+			info.Layers[i].CRS = wktCRS(g.CoordinateSystem.Wkt)
+			if len(g.Extent) == 4 {
+				info.Layers[i].Extent = g.Extent
+			}
+		}
+	}
+	if len(info.Layers) == 1 {
+		info.CRS = info.Layers[0].CRS
+		info.Extent = info.Layers[0].Extent
+	}
+	return info, nil
+}
+
+func gdalDatasetInfo(ctx context.Context, path string) (DatasetInfo, error) {
+	if isRasterFile(path) {
+		r, err := rasterInfo(ctx, path)
+		if err != nil {
+			return DatasetInfo{}, err
+		}
+		return rasterDatasetInfo(r), nil
+	}
+	out, err := exec.CommandContext(ctx, "ogrinfo", "-json", "-so", path).Output()
+	if err != nil {
+		return DatasetInfo{}, fmt.Errorf("ogrinfo: %w", err)
+	}
+	return parseOgrInfo(out)
+}
+
+func (s *Server) serviceDatasetInfo(ctx context.Context, projectName, path string) (DatasetInfo, error) {
+	dtype := "vector"
+	if isRasterFile(path) {
+		dtype = "raster"
+	}
+	params := url.Values{}
+	params.Set("project", projectName)
+	params.Set("path", filepath.ToSlash(filepath.Join(projectName, path)))
+	params.Set("type", dtype)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Config.Datasets.ServiceURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return DatasetInfo{}, err
+	}
+	resp, err := s.outbound.Do(req)
+	if err != nil {
+		return DatasetInfo{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxJSONSize))
+	if err != nil {
+		return DatasetInfo{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return DatasetInfo{}, fmt.Errorf("extraction service error (%d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if dtype == "raster" {
+		r, err := parseGdalInfo(data)
+		if err != nil {
+			return DatasetInfo{}, err
+		}
+		return rasterDatasetInfo(r), nil
+	}
+	return parseOgrInfo(data)
+}
+
+// Extends bounding box by all positions of GeoJSON coordinates (nested arrays of numbers)
+func extendExtent(extent []float64, coords interface{}) []float64 {
+	arr, ok := coords.([]interface{})
+	if !ok || len(arr) == 0 {
+		return extent
+	}
+	if x, ok := arr[0].(float64); ok {
+		if len(arr) < 2 {
+			return extent
+		}
+		y, ok := arr[1].(float64)
+		if !ok {
+			return extent
+		}
+		if extent == nil {
+			return []float64{x, y, x, y}
+		}
+		extent[0], extent[1] = math.Min(extent[0], x), math.Min(extent[1], y)
+		extent[2], extent[3] = math.Max(extent[2], x), math.Max(extent[3], y)
+		return extent
+	}
+	for _, c := range arr {
+		extent = extendExtent(extent, c)
+	}
+	return extent
+}
+
+func geojsonInfo(path string) (DatasetInfo, error) {
+	type Geometry struct {
+		Type        string      `json:"type"`
+		Coordinates interface{} `json:"coordinates"`
+		Geometries  []Geometry  `json:"geometries"`
+	}
+	var doc struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+		CRS  struct {
+			Properties struct {
+				Name string `json:"name"`
+			} `json:"properties"`
+		} `json:"crs"`
+		Features []struct {
+			Geometry *Geometry `json:"geometry"`
+		} `json:"features"`
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return DatasetInfo{}, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&doc); err != nil {
+		return DatasetInfo{}, fmt.Errorf("parsing GeoJSON: %w", err)
+	}
+	if doc.Type != "FeatureCollection" {
+		return DatasetInfo{}, fmt.Errorf("unsupported GeoJSON type: %s", doc.Type)
+	}
+	layer := DatasetLayer{Name: doc.Name, FeatureCount: int64(len(doc.Features)), CRS: "EPSG:4326"}
+	if layer.Name == "" {
+		layer.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	// legacy crs member (e.g. urn:ogc:def:crs:EPSG::3857)
+	if name := doc.CRS.Properties.Name; name != "" {
+		if i := strings.Index(name, "EPSG::"); i != -1 {
+			layer.CRS = "EPSG:" + name[i+6:]
+		} else if !strings.HasSuffix(name, "CRS84") {
+			layer.CRS = name
+		}
+	}
+	addGeometry := func(g Geometry) {
+		if layer.GeometryType == "" {
+			layer.GeometryType = g.Type
+		} else if layer.GeometryType != g.Type {
+			layer.GeometryType = "Unknown"
+		}
+		layer.Extent = extendExtent(layer.Extent, g.Coordinates)
+		for _, child := range g.Geometries {
+			layer.Extent = extendExtent(layer.Extent, child.Coordinates)
+		}
+	}
+	for _, feature := range doc.Features {
+		if feature.Geometry != nil {
+			addGeometry(*feature.Geometry)
+		}
+	}
+	return DatasetInfo{
+		Type:   "vector",
+		Driver: "GeoJSON",
+		CRS:    layer.CRS,
+		Extent: layer.Extent,
+		Layers: []DatasetLayer{layer},
+	}, nil
+}
+
+var shapeTypes = map[uint32]string{
+	0: "None", 1: "Point", 3: "LineString", 5: "Polygon", 8: "MultiPoint",
+	11: "Point Z", 13: "LineString Z", 15: "Polygon Z", 18: "MultiPoint Z",
+	21: "Point M", 23: "LineString M", 25: "Polygon M", 28: "MultiPoint M", 31: "MultiPatch",
+}
+
+// Reads Shapefile's header (.shp), number of records (.dbf) and projection (.prj)
+func shapefileInfo(path string) (DatasetInfo, error) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	f, err := os.Open(path)
+	if err != nil {
+		return DatasetInfo{}, err
+	}
+	defer f.Close()
+	header := make([]byte, 100)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return DatasetInfo{}, fmt.Errorf("reading shapefile header: %w", err)
+	}
+	if binary.BigEndian.Uint32(header[0:4]) != 9994 {
+		return DatasetInfo{}, errors.New("invalid shapefile header")
+	}
+	layer := DatasetLayer{
+		Name:         filepath.Base(base),
+		GeometryType: shapeTypes[binary.LittleEndian.Uint32(header[32:36])],
+		FeatureCount: -1,
+	}
+	if layer.GeometryType == "" {
+		layer.GeometryType = "Unknown"
+	}
+	extent := make([]float64, 4)
+	for i := range extent {
+		extent[i] = math.Float64frombits(binary.LittleEndian.Uint64(header[36+i*8:]))
+	}
+	layer.Extent = extent
+
+	var missing []string
+	if dbf, err := os.Open(base + ".dbf"); err == nil {
+		dbfHeader := make([]byte, 8)
+		if _, err := io.ReadFull(dbf, dbfHeader); err == nil {
+			layer.FeatureCount = int64(binary.LittleEndian.Uint32(dbfHeader[4:8]))
+		}
+		dbf.Close()
+	} else {
+		missing = append(missing, ".dbf")
+	}
+	if _, err := os.Stat(base + ".shx"); err != nil {
+		missing = append(missing, ".shx")
+	}
+	if prj, err := os.ReadFile(base + ".prj"); err == nil {
+		layer.CRS = wktCRS(string(prj))
+	}
+	info := DatasetInfo{
+		Type:   "vector",
+		Driver: "ESRI Shapefile",
+		CRS:    layer.CRS,
+		Extent: layer.Extent,
+		Layers: []DatasetLayer{layer},
+	}
+	if len(missing) > 0 {
+		info.Error = fmt.Sprintf("missing files: %s", strings.Join(missing, ", "))
+	}
+	return info, nil
+}
+
+func nativeDatasetInfo(path string) (DatasetInfo, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".geojson":
+		return geojsonInfo(path)
+	case ".shp":
+		return shapefileInfo(path)
+	}
+	return DatasetInfo{}, errors.New("unsupported format")
+}
+
+func (s *Server) datasetInfo(ctx context.Context, projectName, path string) (DatasetInfo, error) {
+	absPath := filepath.Join(s.Config.ProjectsRoot, projectName, path)
+	switch s.Config.Datasets.Extractor {
+	case "gdal":
+		return gdalDatasetInfo(ctx, absPath)
+	case "service":
+		return s.serviceDatasetInfo(ctx, projectName, path)
+	case "native":
+		return nativeDatasetInfo(absPath)
+	}
+	return DatasetInfo{}, fmt.Errorf("unknown datasets extractor: %s", s.Config.Datasets.Extractor)
+}
+
+func (s *Server) datasetsIndexPath(projectName string) string {
+	return filepath.Join(s.Config.ProjectsRoot, projectName, ".gisquick", "datasets.json")
+}
+
+func (s *Server) loadDatasetsIndex(projectName string) (map[string]DatasetInfo, error) {
+	index := make(map[string]DatasetInfo)
+	data, err := os.ReadFile(s.datasetsIndexPath(projectName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return index, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// Extracts metadata of uploaded datasets and saves it into the project's datasets index.
+// Already extracted info of raster files is reused (when gdal extractor is used).
+func (s *Server) indexDatasets(projectName string, files []domain.ProjectFile, rasters []RasterInfo) {
+	if s.Config.Datasets.Extractor == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), datasetInfoTimeout)
+	defer cancel()
+	known := make(map[string]RasterInfo, len(rasters))
+	if s.Config.Datasets.Extractor != "service" {
+		for _, r := range rasters {
+			known[r.Path] = r
+		}
+	}
+	items := make([]DatasetInfo, 0, len(files))
+	for _, f := range files {
+		if !isRasterFile(f.Path) && !isVectorFile(f.Path) {
+			continue
+		}
+		var info DatasetInfo
+		if r, ok := known[f.Path]; ok {
+			info = rasterDatasetInfo(r)
+		} else if isRasterFile(f.Path) && s.Config.Datasets.Extractor == "native" {
+			continue
+		} else {
+			var err error
+			info, err = s.datasetInfo(ctx, projectName, f.Path)
+			if err != nil {
+				s.log.Warnw("extracting dataset info", "project", projectName, "file", f.Path, zap.Error(err))
+				info.Error = err.Error()
+			}
+		}
+		if info.Type == "" {
+			info.Type = "vector"
+			if isRasterFile(f.Path) {
+				info.Type = "raster"
+			}
+		}
+		info.Path = f.Path
+		info.Size = f.Size
+		info.Mtime = f.Mtime
+		items = append(items, info)
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	s.datasetsIndexMu.Lock()
+	defer s.datasetsIndexMu.Unlock()
+	index, err := s.loadDatasetsIndex(projectName)
+	if err != nil {
+		s.log.Errorw("loading datasets index", "project", projectName, zap.Error(err))
+		index = make(map[string]DatasetInfo)
+	}
+	for _, info := range items {
+		index[info.Path] = info
+	}
+	data, err := json.Marshal(index)
+	if err == nil {
+		err = os.WriteFile(s.datasetsIndexPath(projectName), data, 0644)
+	}
+	if err != nil {
+		s.log.Errorw("saving datasets index", "project", projectName, zap.Error(err))
+	}
+}
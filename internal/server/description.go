@@ -0,0 +1,51 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/markdown"
+	"github.com/labstack/echo/v4"
+)
+
+// Maximal size of the project description (in bytes)
+const maxDescriptionSize = 64 * 1024
+
+func (s *Server) handleGetProjectDescription(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	text, err := s.projects.GetDescription(projectName)
+	if err != nil {
+		return fmt.Errorf("loading project description: %w", err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"description": text})
+}
+
+func (s *Server) handleSaveProjectDescription() func(echo.Context) error {
+	type Form struct {
+		Description string `json:"description"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		form := new(Form)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		if len(form.Description) > maxDescriptionSize || !utf8.ValidString(form.Description) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid description")
+		}
+		text := markdown.Sanitize(form.Description)
+		if err := s.projects.SaveDescription(projectName, text); err != nil {
+			if errors.Is(err, domain.ErrProjectNotExists) {
+				return echo.NewHTTPError(http.StatusConflict, "Project does not exists")
+			}
+			return fmt.Errorf("saving project description: %w", err)
+		}
+		if s.Config.Catalog != nil {
+			go s.updateCatalogRecord(projectName)
+		}
+		return c.JSON(http.StatusOK, map[string]string{"description": text})
+	}
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+// Period summarized by the weekly digest
+const digestPeriod = 7 * 24 * time.Hour
+
+type DigestConfig struct {
+	Enabled bool
+	// day and hour (local time) of sending the digest
+	Weekday time.Weekday
+	Hour    int
+}
+
+type digestProject struct {
+	Name      string
+	Title     string
+	Loads     int64
+	OwsErrors int64
+}
+
+type digestGrant struct {
+	Project  string
+	Username string
+	Role     string
+	Expires  string
+}
+
+// Returns the most recent scheduled time of the digest before the given time
+func lastDigestSchedule(cfg DigestConfig, now time.Time) time.Time {
+	t := time.Date(now.Year(), now.Month(), now.Day(), cfg.Hour, 0, 0, 0, now.Location())
+	for t.Weekday() != cfg.Weekday || t.After(now) {
+		t = t.AddDate(0, 0, -1)
+	}
+	return t
+}
+
+// File with the time of the last sent digest (shared by all server instances)
+func (s *Server) digestStatePath() string {
+	return filepath.Join(s.Config.ProjectsRoot, "digest.json")
+}
+
+func (s *Server) lastDigestTime() (time.Time, error) {
+	var state struct {
+		Sent time.Time `json:"sent"`
+	}
+	data, err := os.ReadFile(s.digestStatePath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state.Sent, err
+}
+
+func (s *Server) saveLastDigestTime(t time.Time) error {
+	data, err := json.Marshal(map[string]time.Time{"sent": t})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.digestStatePath(), data, 0644)
+}
+
+func (s *Server) sendDigest(account domain.Account, stats map[string]map[string]int64, now time.Time) error {
+	projects, err := s.projects.GetUserProjects(account.Username)
+	if err != nil {
+		return fmt.Errorf("getting user projects: %w", err)
+	}
+	if len(projects) == 0 {
+		return nil
+	}
+	usage, err := s.storageUsage(account.Username, projects)
+	if err != nil {
+		return err
+	}
+	var projectsData []digestProject
+	var grants []digestGrant
+	for _, p := range projects {
+		projectsData = append(projectsData, digestProject{
+			Name:      p.Name,
+			Title:     p.Title,
+			Loads:     stats[p.Name][statsProjectLoads],
+			OwsErrors: stats[p.Name][statsProjectOwsErrors],
+		})
+		projectGrants, err := s.projects.GetAccessGrants(p.Name)
+		if err != nil {
+			s.log.Errorw("reading access grants", "project", p.Name, zap.Error(err))
+			continue
+		}
+		for _, g := range projectGrants {
+			if g.Active(now) && g.Expires.Sub(now) < digestPeriod {
+				grants = append(grants, digestGrant{
+					Project:  p.Name,
+					Username: g.Username,
+					Role:     g.Role,
+					Expires:  g.Expires.Format("2006-01-02 15:04 MST"),
+				})
+			}
+		}
+	}
+	sort.SliceStable(projectsData, func(i, j int) bool { return projectsData[i].Loads > projectsData[j].Loads })
+	tmpl, err := texttemplate.ParseFiles("./templates/weekly_digest_email.txt", "./templates/email_base.txt")
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"Projects": projectsData,
+		"Grants":   grants,
+		"Used":     formatByteSize(usage.Used),
+		"Limit":    "",
+	}
+	if usage.Limit > 0 {
+		data["Limit"] = formatByteSize(usage.Limit)
+	}
+	return s.accountsService.Email.SendBulkEmail([]domain.Account{account}, "Gisquick weekly digest", nil, tmpl, data)
+}
+
+// Sends weekly digest to all users who enabled it in their notification preferences
+func (s *Server) sendDigests(ctx context.Context) error {
+	accounts, err := s.accountsService.Repository.GetActiveAccounts()
+	if err != nil {
+		return fmt.Errorf("listing accounts: %w", err)
+	}
+	stats, err := s.stats.ProjectSums(ctx, 7)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	sent := 0
+	for _, account := range accounts {
+		prefs, err := s.loadNotificationPreferences(account.Username)
+		if err != nil {
+			s.log.Errorw("loading notification preferences", "user", account.Username, zap.Error(err))
+			continue
+		}
+		if !prefs.WeeklyDigest || account.Email == "" {
+			continue
+		}
+		if err := s.sendDigest(account, stats, now); err != nil {
+			s.log.Errorw("sending weekly digest", "user", account.Username, zap.Error(err))
+			continue
+		}
+		sent++
+	}
+	s.log.Infow("weekly digest sent", "count", sent)
+	return nil
+}
+
+// SendWeeklyDigests periodically checks the schedule and sends the weekly digest emails until
+// the context is cancelled
+func (s *Server) SendWeeklyDigests(ctx context.Context) {
+	if !s.Config.Digest.Enabled || !s.accountsService.SupportEmails() {
+		return
+	}
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			last, err := s.lastDigestTime()
+			if err != nil {
+				s.log.Errorw("reading digest state", zap.Error(err))
+				continue
+			}
+			schedule := lastDigestSchedule(s.Config.Digest, now)
+			// digest is not sent when the server was down for a longer time
+			if !last.Before(schedule) || now.Sub(schedule) > 24*time.Hour {
+				continue
+			}
+			if err := s.saveLastDigestTime(now); err != nil {
+				s.log.Errorw("saving digest state", zap.Error(err))
+				continue
+			}
+			if err := s.sendDigests(ctx); err != nil {
+				s.log.Errorw("sending weekly digest", zap.Error(err))
+			}
+		}
+	}
+}
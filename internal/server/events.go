@@ -0,0 +1,54 @@
+package server
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"go.uber.org/zap"
+)
+
+// Subscribes server features to the domain events
+func (s *Server) subscribeEvents() {
+	if s.events == nil {
+		return
+	}
+	s.events.Subscribe(application.EventProjectPublished, func(e application.Event) {
+		if s.Config.Catalog != nil {
+			s.updateCatalogRecord(e.Project)
+		}
+	})
+	s.events.Subscribe(application.EventProjectPublished, func(e application.Event) {
+		// rebuild only existing (outdated) index of the attributes
+		if _, err := os.Stat(s.attributesIndexPath(e.Project)); err == nil {
+			s.updateAttributesIndex(e.Project)
+		}
+	})
+	for _, eventType := range []string{application.EventProjectPublished, application.EventProjectUpdated, application.EventSettingsChanged} {
+		s.events.Subscribe(eventType, func(e application.Event) {
+			s.layersPerms.Invalidate(e.Project)
+		})
+	}
+	s.events.Subscribe(application.EventFilesChanged, func(e application.Event) {
+		s.checkStorageQuota(strings.Split(e.Project, "/")[0])
+	})
+	s.events.Subscribe(application.EventWfsCommitted, func(e application.Event) {
+		data := e.Data.(application.WfsCommittedData)
+		layersSet := make(map[string]bool)
+		layers := make([]string, 0, len(data.Changes))
+		for _, c := range data.Changes {
+			if !layersSet[c.Layer] {
+				layersSet[c.Layer] = true
+				layers = append(layers, c.Layer)
+			}
+		}
+		if err := s.clearMapCache(e.Project); err != nil {
+			s.log.Errorw("clearing project map cache", "project", e.Project, zap.Error(err))
+		}
+		s.layersChanged(e.Project, LayersChangedEvent{Source: "wfs", Layers: layers})
+	})
+	s.events.Subscribe(application.EventUserRegistered, func(e application.Event) {
+		s.log.Infow("user registered", "user", e.User)
+	})
+	s.subscribeProjectNotifications()
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/qgisexpr"
+	"github.com/labstack/echo/v4"
+)
+
+// Validates QGIS filter expression against the layer's attributes
+func (s *Server) handleValidateExpression() func(echo.Context) error {
+	type Form struct {
+		Layer      string `json:"layer"` // layer ID or name
+		Expression string `json:"expression"`
+	}
+	return func(c echo.Context) error {
+		projectName := getProjectName(c)
+		form := new(Form)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		var meta domain.QgisMeta
+		if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+			return fmt.Errorf("parsing qgis meta: %w", err)
+		}
+		lmeta, ok := meta.Layers[form.Layer]
+		if !ok {
+			for _, l := range meta.Layers {
+				if l.Name == form.Layer {
+					lmeta, ok = l, true
+					break
+				}
+			}
+		}
+		if !ok || lmeta.Type != "VectorLayer" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid layer")
+		}
+		fields := make(map[string]string, len(lmeta.Attributes))
+		for _, a := range lmeta.Attributes {
+			fields[a.Name] = qgisexpr.FieldType(a.Type)
+		}
+		return c.JSON(http.StatusOK, qgisexpr.Validate(form.Expression, fields))
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Extension adds custom features to the server. Extensions are registered by RegisterExtension
+// (usually from init function of a package compiled into the custom binary) and enabled by name
+// in the configuration (GISQUICK_EXTENSIONS).
+type Extension interface {
+	// Init is called during server setup to register routes, auth backends and event subscribers
+	Init(ctx *ExtensionContext) error
+}
+
+// Optional lifecycle hooks of the extension
+type ExtensionStarter interface {
+	// Start is called after the server starts listening
+	Start(ctx context.Context) error
+}
+
+type ExtensionStopper interface {
+	// Stop is called when the server is shut down (after active requests are finished)
+	Stop(ctx context.Context) error
+}
+
+// ExtensionFunc adapts function to the Extension interface (extension without lifecycle hooks)
+type ExtensionFunc func(ctx *ExtensionContext) error
+
+func (f ExtensionFunc) Init(ctx *ExtensionContext) error {
+	return f(ctx)
+}
+
+// ExtensionContext provides access to the server components and access middlewares
+type ExtensionContext struct {
+	Name     string
+	Config   Config
+	Log      *zap.SugaredLogger
+	Echo     *echo.Echo
+	Auth     *auth.AuthService
+	Accounts *application.AccountsService
+	Projects application.ProjectService
+	Events   *application.EventBus
+
+	LoginRequired      echo.MiddlewareFunc
+	SuperuserRequired  echo.MiddlewareFunc
+	ProjectAccess      echo.MiddlewareFunc
+	ProjectAdminAccess echo.MiddlewareFunc
+}
+
+var (
+	extensionsMu sync.Mutex
+	extensions   = make(map[string]Extension)
+)
+
+// RegisterExtension makes extension available by the name, it panics when the name is already registered
+func RegisterExtension(name string, ext Extension) {
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+	if ext == nil {
+		panic("server: RegisterExtension extension is nil")
+	}
+	if _, dup := extensions[name]; dup {
+		panic("server: RegisterExtension called twice for extension " + name)
+	}
+	extensions[name] = ext
+}
+
+// RegisteredExtensions returns sorted names of registered extensions
+func RegisteredExtensions() []string {
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+	names := make([]string, 0, len(extensions))
+	for name := range extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type enabledExtension struct {
+	name string
+	ext  Extension
+}
+
+func (s *Server) AddExtension(name string) error {
+	extensionsMu.Lock()
+	extension, registred := extensions[name]
+	extensionsMu.Unlock()
+	if !registred {
+		return fmt.Errorf("unknown server extension: %s", name)
+	}
+	ctx := &ExtensionContext{
+		Name:               name,
+		Config:             s.Config,
+		Log:                s.log.With("extension", name),
+		Echo:               s.echo,
+		Auth:               s.auth,
+		Accounts:           s.accountsService,
+		Projects:           s.projects,
+		Events:             s.events,
+		LoginRequired:      LoginRequiredMiddlewareWithConfig(s.auth),
+		SuperuserRequired:  SuperuserAccessMiddleware(s.auth),
+		ProjectAccess:      ProjectAccessMiddleware(s.auth, s.projects, s.Config.AccessPolicy, s.Config.Hooks, ""),
+		ProjectAdminAccess: ProjectAdminAccessMiddleware(s.auth, s.projects),
+	}
+	if err := extension.Init(ctx); err != nil {
+		return err
+	}
+	s.extensions = append(s.extensions, enabledExtension{name, extension})
+	return nil
+}
+
+// StartExtensions calls start hooks of the enabled extensions
+func (s *Server) StartExtensions(ctx context.Context) error {
+	for _, e := range s.extensions {
+		if starter, ok := e.ext.(ExtensionStarter); ok {
+			if err := starter.Start(ctx); err != nil {
+				return fmt.Errorf("starting extension %s: %w", e.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Calls stop hooks of the enabled extensions (in reverse order)
+func (s *Server) stopExtensions(ctx context.Context) {
+	for i := len(s.extensions) - 1; i >= 0; i-- {
+		e := s.extensions[i]
+		if stopper, ok := e.ext.(ExtensionStopper); ok {
+			if err := stopper.Stop(ctx); err != nil {
+				s.log.Errorw("stopping extension", "name", e.name, zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,496 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrMapserverUnavailable = errors.New("map server is unavailable")
+)
+
+type FormSubmission struct {
+	Attributes map[string]interface{} `json:"attributes"`
+	Geometry   *GeoJSONGeometry       `json:"geometry,omitempty"`
+	CRS        string                 `json:"crs,omitempty"`
+}
+
+type GeoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// WFS 1.0.0 and 1.1.0 transaction response
+type wfsTransactionResponse struct {
+	FeatureIDs   []FeatureId `xml:"InsertResult>FeatureId"`
+	FeatureIDs11 []FeatureId `xml:"InsertResults>Feature>FeatureId"`
+	Success      *struct{}   `xml:"TransactionResult>Status>SUCCESS"`
+	Summary      *struct{}   `xml:"TransactionSummary"`
+	Message      string      `xml:"TransactionResult>Message"`
+}
+
+func (r wfsTransactionResponse) succeeded() bool {
+	return r.Success != nil || r.Summary != nil
+}
+
+func (r wfsTransactionResponse) insertedIds() []string {
+	ids := make([]string, 0, len(r.FeatureIDs)+len(r.FeatureIDs11))
+	for _, f := range append(r.FeatureIDs, r.FeatureIDs11...) {
+		ids = append(ids, f.Fid)
+	}
+	return ids
+}
+
+func formatCoords(c []float64) string {
+	parts := make([]string, len(c))
+	for i, v := range c {
+		parts[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+func gmlCoordinates(coords [][]float64) string {
+	items := make([]string, len(coords))
+	for i, c := range coords {
+		items[i] = formatCoords(c)
+	}
+	return fmt.Sprintf(`<gml:coordinates cs="," ts=" ">%s</gml:coordinates>`, strings.Join(items, " "))
+}
+
+func gmlPolygon(rings [][][]float64) string {
+	var b strings.Builder
+	b.WriteString("<gml:Polygon>")
+	for i, ring := range rings {
+		tag := "innerBoundaryIs"
+		if i == 0 {
+			tag = "outerBoundaryIs"
+		}
+		fmt.Fprintf(&b, "<gml:%s><gml:LinearRing>%s</gml:LinearRing></gml:%s>", tag, gmlCoordinates(ring), tag)
+	}
+	b.WriteString("</gml:Polygon>")
+	return b.String()
+}
+
+// Converts GeoJSON geometry into GML 2 geometry
+func (g GeoJSONGeometry) GML(srsName string) (string, error) {
+	var gml string
+	switch g.Type {
+	case "Point":
+		var c []float64
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return "", err
+		}
+		gml = fmt.Sprintf("<gml:Point>%s</gml:Point>", gmlCoordinates([][]float64{c}))
+	case "LineString":
+		var c [][]float64
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return "", err
+		}
+		gml = fmt.Sprintf("<gml:LineString>%s</gml:LineString>", gmlCoordinates(c))
+	case "Polygon":
+		var c [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return "", err
+		}
+		gml = gmlPolygon(c)
+	case "MultiPoint":
+		var c [][]float64
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return "", err
+		}
+		members := make([]string, len(c))
+		for i, p := range c {
+			members[i] = fmt.Sprintf("<gml:pointMember><gml:Point>%s</gml:Point></gml:pointMember>", gmlCoordinates([][]float64{p}))
+		}
+		gml = fmt.Sprintf("<gml:MultiPoint>%s</gml:MultiPoint>", strings.Join(members, ""))
+	case "MultiLineString":
+		var c [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return "", err
+		}
+		members := make([]string, len(c))
+		for i, l := range c {
+			members[i] = fmt.Sprintf("<gml:lineStringMember><gml:LineString>%s</gml:LineString></gml:lineStringMember>", gmlCoordinates(l))
+		}
+		gml = fmt.Sprintf("<gml:MultiLineString>%s</gml:MultiLineString>", strings.Join(members, ""))
+	case "MultiPolygon":
+		var c [][][][]float64
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return "", err
+		}
+		members := make([]string, len(c))
+		for i, p := range c {
+			members[i] = fmt.Sprintf("<gml:polygonMember>%s</gml:polygonMember>", gmlPolygon(p))
+		}
+		gml = fmt.Sprintf("<gml:MultiPolygon>%s</gml:MultiPolygon>", strings.Join(members, ""))
+	default:
+		return "", fmt.Errorf("unsupported geometry type: %s", g.Type)
+	}
+	if srsName != "" {
+		// set srsName attribute of the root element
+		i := strings.Index(gml, ">")
+		gml = fmt.Sprintf(`%s srsName="%s"%s`, gml[:i], xmlEscape(srsName), gml[i:])
+	}
+	return gml, nil
+}
+
+func xmlEscape(v string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(v))
+	return b.String()
+}
+
+func formatAttributeValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		data, _ := json.Marshal(val)
+		return string(data)
+	}
+}
+
+func isNumericType(t string) bool {
+	switch strings.ToLower(t) {
+	case "int", "integer", "integer64", "int4", "int8", "long", "longlong", "double", "real", "float", "numeric", "decimal":
+		return true
+	}
+	return false
+}
+
+// Builds WFS-T Insert request
+func buildInsertTransaction(typeName string, attrs map[string]string, geometry string) []byte {
+	var b strings.Builder
+	b.WriteString(`<Transaction xmlns="http://www.opengis.net/wfs" xmlns:gml="http://www.opengis.net/gml" service="WFS" version="1.0.0">`)
+	fmt.Fprintf(&b, "<Insert><%s>", typeName)
+	for name, value := range attrs {
+		fmt.Fprintf(&b, "<%s>%s</%s>", name, xmlEscape(value), name)
+	}
+	if geometry != "" {
+		fmt.Fprintf(&b, "<geometry>%s</geometry>", geometry)
+	}
+	fmt.Fprintf(&b, "</%s></Insert></Transaction>", typeName)
+	return []byte(b.String())
+}
+
+// Sends WFS-T request to the map server. Returns ErrMapserverUnavailable when
+// request can be repeated later.
+func (s *Server) sendWfsTransaction(ctx context.Context, projectName string, body []byte) (string, error) {
+	pInfo, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Config.MapserverURL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("building request: %w", err)
+	}
+	params := url.Values{
+		"MAP":     {s.owsProjectPath(projectName, pInfo.QgisFile)},
+		"SERVICE": {"WFS"},
+	}
+	req.URL.RawQuery = params.Encode()
+	req.Header.Set("Content-Type", "text/xml")
+	s.setPgServiceHeader(req, projectName)
+
+	resp, err := s.mapserver.Do(req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: %s", ErrMapserverUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusGatewayTimeout {
+		return "", fmt.Errorf("%w: status %d", ErrMapserverUnavailable, resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("reading response: %w", err)
+	}
+	var result wfsTransactionResponse
+	if err := xml.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("invalid transaction response (status %d): %w", resp.StatusCode, err)
+	}
+	if !result.succeeded() {
+		return "", fmt.Errorf("transaction failed: %s", strings.TrimSpace(result.Message))
+	}
+	if ids := result.insertedIds(); len(ids) > 0 {
+		return ids[0], nil
+	}
+	return "", nil
+}
+
+func (s *Server) handleFormSubmission() func(echo.Context) error {
+	type Response struct {
+		Status    string `json:"status"`
+		FeatureID string `json:"feature_id,omitempty"`
+	}
+	return func(c echo.Context) error {
+		projectName := getProjectName(c)
+		layerName := c.Param("layer")
+
+		form, err := c.MultipartForm()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		var submission FormSubmission
+		if err := json.Unmarshal([]byte(c.FormValue("data")), &submission); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid form data")
+		}
+		if submission.Attributes == nil {
+			submission.Attributes = make(map[string]interface{})
+		}
+
+		settings, err := s.projects.GetSettings(projectName)
+		if err != nil {
+			return fmt.Errorf("getting project settings: %w", err)
+		}
+		var meta domain.QgisMeta
+		if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+			return fmt.Errorf("parsing qgis meta: %w", err)
+		}
+		var lmeta domain.LayerMeta
+		found := false
+		for _, l := range meta.Layers {
+			if l.Name == layerName {
+				lmeta = l
+				found = true
+				break
+			}
+		}
+		if !found || lmeta.Type != "VectorLayer" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid layer")
+		}
+		lset := settings.Layers[lmeta.Id]
+		if !lset.Flags.Has("form") || lset.Flags.Has("excluded") {
+			return echo.ErrForbidden
+		}
+		var wfsFlags domain.Flags
+		json.Unmarshal(lmeta.Options["wfs"], &wfsFlags)
+		if !wfsFlags.Has("insert") {
+			return echo.NewHTTPError(http.StatusBadRequest, "Layer does not support inserting features")
+		}
+
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		var attrsFlags map[string]domain.Flags
+		if len(settings.Auth.Roles) > 0 {
+			if !settings.UserLayerPermissionsFlags(user, lmeta.Id).Has("insert") {
+				return echo.ErrForbidden
+			}
+			attrsFlags = settings.UserLayerAttrinutesFlags(user, lmeta.Id)
+		}
+		if !lset.Roles.Allows(user, domain.FilterUserRoles(user, settings.Auth.Roles)) {
+			return echo.ErrForbidden
+		}
+
+		attributes := make(map[string]domain.LayerAttribute, len(lmeta.Attributes))
+		for _, a := range lmeta.Attributes {
+			attributes[a.Name] = a
+		}
+		canEdit := func(name string) bool {
+			attr, ok := attributes[name]
+			if !ok || attr.Constraints.Has("readonly") {
+				return false
+			}
+			return attrsFlags == nil || attrsFlags[name].Has("edit")
+		}
+
+		values := make(map[string]string, len(submission.Attributes))
+		for name, v := range submission.Attributes {
+			if !canEdit(name) {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid attribute: %s", name))
+			}
+			if v == nil {
+				continue
+			}
+			if _, isNumber := v.(float64); isNumericType(attributes[name].Type) && !isNumber {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid value of attribute: %s", name))
+			}
+			values[name] = formatAttributeValue(v)
+		}
+		for name := range form.File {
+			if !canEdit(name) {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid attribute: %s", name))
+			}
+		}
+		for _, a := range lmeta.Attributes {
+			if a.Constraints.Has("not_null") {
+				if _, ok := values[a.Name]; !ok && len(form.File[a.Name]) == 0 {
+					return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Missing required attribute: %s", a.Name))
+				}
+			}
+		}
+
+		var geometry string
+		if submission.Geometry != nil {
+			if attrsFlags != nil {
+				if geomFlags, ok := attrsFlags["geometry"]; ok && !geomFlags.Has("edit") {
+					return echo.ErrForbidden
+				}
+			}
+			crs := submission.CRS
+			if crs == "" {
+				crs = meta.Projection
+			}
+			geometry, err = submission.Geometry.GML(crs)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid geometry")
+			}
+		}
+
+		// attachments
+		var attachments []string
+		for name, files := range form.File {
+			paths := make([]string, 0, len(files))
+			for _, file := range files {
+				src, err := file.Open()
+				if err != nil {
+					s.deleteFormAttachments(projectName, attachments)
+					return fmt.Errorf("reading upload file: %w", err)
+				}
+				pattern := "<random>" + filepath.Ext(file.Filename)
+				finfo, err := s.projects.SaveFile(projectName, "web/forms", pattern, src, file.Size)
+				src.Close()
+				if err != nil {
+					s.deleteFormAttachments(projectName, attachments)
+					if errors.Is(err, application.ErrProjectSizeLimit) || errors.Is(err, application.ErrAccountStorageLimit) {
+						return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached project size limit.")
+					}
+					return fmt.Errorf("saving form attachment: %w", err)
+				}
+				paths = append(paths, finfo.Path)
+				attachments = append(attachments, finfo.Path)
+			}
+			values[name] = strings.Join(paths, ",")
+		}
+
+		// QGIS server replaces spaces in WFS type names
+		typeName := strings.ReplaceAll(lmeta.Name, " ", "_")
+		body := buildInsertTransaction(typeName, values, geometry)
+		fid, err := s.sendWfsTransaction(c.Request().Context(), projectName, body)
+		if err != nil {
+			if errors.Is(err, ErrMapserverUnavailable) {
+				item := project.QueuedSubmission{
+					Project:     projectName,
+					Layer:       layerName,
+					User:        user.Username,
+					Transaction: body,
+					Attachments: attachments,
+					Created:     time.Now().UTC(),
+				}
+				if err := s.formsQueue.Push(c.Request().Context(), item); err != nil {
+					s.deleteFormAttachments(projectName, attachments)
+					return fmt.Errorf("queuing form submission: %w", err)
+				}
+				s.log.Warnw("form submission queued", "project", projectName, "layer", layerName, zap.Error(err))
+				return c.JSON(http.StatusAccepted, Response{Status: "queued"})
+			}
+			s.log.Errorw("form submission", "project", projectName, "layer", layerName, zap.Error(err))
+			s.deleteFormAttachments(projectName, attachments)
+			return echo.NewHTTPError(http.StatusBadRequest, "Failed to save form data").SetInternal(err)
+		}
+		change := domain.LayerChange{
+			Project:   projectName,
+			Layer:     typeName,
+			Action:    "insert",
+			FeatureID: fid,
+			User:      user.Username,
+			Time:      time.Now().UTC(),
+		}
+		for name := range values {
+			change.Attributes = append(change.Attributes, name)
+		}
+		s.recordLayerChanges(change)
+		return c.JSON(http.StatusOK, Response{Status: "saved", FeatureID: fid})
+	}
+}
+
+// ProcessFormsQueue periodically re-sends queued form submissions until the context is cancelled
+func (s *Server) ProcessFormsQueue(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.flushFormsQueue(ctx)
+		}
+	}
+}
+
+// Deletes saved attachments of the rejected form submission
+func (s *Server) deleteFormAttachments(projectName string, paths []string) {
+	for _, path := range paths {
+		if err := s.projects.DeleteFile(projectName, path); err != nil {
+			s.log.Errorw("deleting form attachment", "project", projectName, "path", path, zap.Error(err))
+		}
+	}
+}
+
+func (s *Server) flushFormsQueue(ctx context.Context) {
+	if err := s.formsQueue.Recover(ctx); err != nil {
+		s.log.Errorw("recovering forms queue", zap.Error(err))
+		return
+	}
+	for {
+		item, err := s.formsQueue.Claim(ctx)
+		if err != nil {
+			s.log.Errorw("reading forms queue", zap.Error(err))
+			return
+		}
+		if item == nil {
+			return
+		}
+		fid, err := s.sendWfsTransaction(ctx, item.Project, item.Transaction)
+		if errors.Is(err, ErrMapserverUnavailable) || errors.Is(err, context.Canceled) {
+			// context of the shutdown can be already cancelled
+			if err := s.formsQueue.Release(context.Background(), item); err != nil {
+				s.log.Errorw("returning form submission into queue", zap.Error(err))
+			}
+			return
+		}
+		if err != nil {
+			s.log.Errorw("queued form submission rejected", "project", item.Project, "layer", item.Layer, "user", item.User, zap.Error(err))
+			s.deleteFormAttachments(item.Project, item.Attachments)
+		} else {
+			s.log.Infow("queued form submission saved", "project", item.Project, "layer", item.Layer, "user", item.User)
+			s.recordLayerChanges(domain.LayerChange{
+				Project:   item.Project,
+				Layer:     strings.ReplaceAll(item.Layer, " ", "_"),
+				Action:    "insert",
+				FeatureID: fid,
+				User:      item.User,
+				Time:      time.Now().UTC(),
+			})
+		}
+		if err := s.formsQueue.Ack(ctx, item); err != nil {
+			s.log.Errorw("removing form submission from queue", zap.Error(err))
+			return
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Maximal duration of the temporary access grant
+const maxAccessGrantDuration = 365 * 24 * time.Hour
+
+func (s *Server) handleGetAccessGrants(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	grants, err := s.projects.GetAccessGrants(projectName)
+	if err != nil {
+		return fmt.Errorf("reading access grants: %w", err)
+	}
+	sort.Slice(grants, func(i, j int) bool { return grants[i].Expires.Before(grants[j].Expires) })
+	return c.JSON(http.StatusOK, grants)
+}
+
+func (s *Server) handleCreateAccessGrant() func(c echo.Context) error {
+	type GrantForm struct {
+		Username string `json:"username" validate:"required"`
+		Role     string `json:"role"`
+		// duration in days or exact expiration time
+		Days    int        `json:"days"`
+		Expires *time.Time `json:"expires"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		form := new(GrantForm)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil || form.Username == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		now := time.Now().UTC()
+		var expires time.Time
+		if form.Expires != nil {
+			expires = form.Expires.UTC()
+		} else if form.Days > 0 {
+			expires = now.Add(time.Duration(form.Days) * 24 * time.Hour)
+		}
+		if !expires.After(now) || expires.Sub(now) > maxAccessGrantDuration {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid expiration of the grant")
+		}
+		if form.Username == filepath.Dir(projectName) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Project owner has full access")
+		}
+		account, err := s.accountsService.Repository.GetByUsername(form.Username)
+		if err != nil || !account.Active {
+			return echo.NewHTTPError(http.StatusBadRequest, "User not found")
+		}
+		if form.Role != "" {
+			settings, err := s.projects.GetStoredSettings(projectName)
+			if err != nil {
+				return fmt.Errorf("reading project settings: %w", err)
+			}
+			found := false
+			for _, r := range settings.Auth.Roles {
+				found = found || r.Name == form.Role
+			}
+			if !found {
+				return echo.NewHTTPError(http.StatusBadRequest, "Role not found")
+			}
+		}
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		grant := domain.AccessGrant{
+			ID:        id.String(),
+			Username:  form.Username,
+			Role:      form.Role,
+			Expires:   expires,
+			Created:   now,
+			GrantedBy: user.Username,
+		}
+		_, err = s.projects.UpdateAccessGrants(projectName, func(grants []domain.AccessGrant) ([]domain.AccessGrant, bool) {
+			return append(grants, grant), true
+		})
+		if err != nil {
+			return fmt.Errorf("saving access grants: %w", err)
+		}
+		return c.JSON(http.StatusOK, grant)
+	}
+}
+
+func (s *Server) handleRevokeAccessGrant(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	id := c.Param("id")
+	revoked, err := s.projects.UpdateAccessGrants(projectName, func(grants []domain.AccessGrant) ([]domain.AccessGrant, bool) {
+		remaining := make([]domain.AccessGrant, 0, len(grants))
+		for _, g := range grants {
+			if g.ID != id {
+				remaining = append(remaining, g)
+			}
+		}
+		return remaining, len(remaining) != len(grants)
+	})
+	if err != nil {
+		return fmt.Errorf("saving access grants: %w", err)
+	}
+	if !revoked {
+		return echo.NewHTTPError(http.StatusNotFound, domain.ErrAccessGrantNotExists.Error())
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) sendAccessGrantExpiredEmail(username, projectName string, grant domain.AccessGrant) error {
+	account, err := s.accountsService.Repository.GetByUsername(username)
+	if err != nil {
+		return err
+	}
+	tmpl, err := texttemplate.ParseFiles("./templates/access_grant_expired_email.txt", "./templates/email_base.txt")
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"Project":  projectName,
+		"Username": grant.Username,
+		"Role":     grant.Role,
+		"Grantee":  username == grant.Username,
+	}
+	subject := fmt.Sprintf("Temporary access to the project %s expired", projectName)
+	return s.accountsService.Email.SendBulkEmail([]domain.Account{account}, subject, nil, tmpl, data)
+}
+
+// Removes expired grants of the project and notifies the users and the project owner
+func (s *Server) expireAccessGrants(projectName string, now time.Time) error {
+	var expired, expiring []domain.AccessGrant
+	_, err := s.projects.UpdateAccessGrants(projectName, func(grants []domain.AccessGrant) ([]domain.AccessGrant, bool) {
+		var active []domain.AccessGrant
+		for _, g := range grants {
+			if g.Active(now) {
+				if !g.ExpirationNotified && g.Expires.Sub(now) < accessGrantExpirationNotice {
+					g.ExpirationNotified = true
+					expiring = append(expiring, g)
+				}
+				active = append(active, g)
+			} else {
+				expired = append(expired, g)
+			}
+		}
+		return active, len(expired) > 0 || len(expiring) > 0
+	})
+	if err != nil {
+		return err
+	}
+	for _, g := range expiring {
+		s.notifyAccessGrantExpiring(projectName, g)
+	}
+
+	owner := filepath.Dir(projectName)
+	for _, g := range expired {
+		s.log.Infow("access grant expired", "project", projectName, "user", g.Username, "role", g.Role)
+		data := map[string]interface{}{"project": projectName, "grant": g}
+		for _, username := range []string{g.Username, owner} {
+			s.sws.AppChannel().Send(username, "AccessGrantExpired", data)
+			if s.accountsService.Email == nil {
+				continue
+			}
+			if err := s.sendAccessGrantExpiredEmail(username, projectName, g); err != nil {
+				s.log.Errorw("sending access grant expiration email", "user", username, zap.Error(err))
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) expireAllAccessGrants() error {
+	accounts, err := s.accountsService.GetAllAccounts()
+	if err != nil {
+		return fmt.Errorf("listing accounts: %w", err)
+	}
+	now := time.Now()
+	for _, account := range accounts {
+		projects, err := s.projects.GetUserProjects(account.Username)
+		if err != nil {
+			s.log.Errorw("getting user projects", "user", account.Username, zap.Error(err))
+			continue
+		}
+		for _, p := range projects {
+			if err := s.expireAccessGrants(p.Name, now); err != nil {
+				s.log.Errorw("expiring access grants", "project", p.Name, zap.Error(err))
+			}
+		}
+	}
+	return nil
+}
+
+// ExpireAccessGrants periodically removes expired access grants until the context is cancelled
+func (s *Server) ExpireAccessGrants(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.expireAllAccessGrants(); err != nil {
+				s.log.Errorw("expiring access grants", zap.Error(err))
+			}
+		}
+	}
+}
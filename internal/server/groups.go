@@ -0,0 +1,111 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+type groupForm struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description" validate:"max=255"`
+	Members     []string `json:"members"`
+}
+
+// Translates errors of the groups management into HTTP errors
+func groupError(err error) error {
+	switch {
+	case errors.Is(err, application.ErrGroupsNotSupported), errors.Is(err, domain.ErrGroupNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, application.ErrInvalidGroupName):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, domain.ErrGroupExists):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, domain.ErrAccountNotFound):
+		return echo.NewHTTPError(http.StatusBadRequest, "Unknown group member")
+	}
+	return err
+}
+
+// Applies changed groups of the users to their next requests
+func (s *Server) refreshUsers(usernames []string) {
+	for _, username := range usernames {
+		s.auth.RefreshUser(username)
+	}
+}
+
+func (s *Server) handleGetGroups(c echo.Context) error {
+	if s.accountsService.Groups == nil {
+		return c.JSON(http.StatusOK, []domain.Group{})
+	}
+	groups, err := s.accountsService.Groups.List()
+	if err != nil {
+		return fmt.Errorf("listing groups: %w", err)
+	}
+	return c.JSON(http.StatusOK, groups)
+}
+
+func (s *Server) handleGetGroup(c echo.Context) error {
+	if s.accountsService.Groups == nil {
+		return echo.ErrNotFound
+	}
+	group, err := s.accountsService.Groups.Get(c.Param("name"))
+	if err != nil {
+		return groupError(err)
+	}
+	return c.JSON(http.StatusOK, group)
+}
+
+func (s *Server) handleCreateGroup() func(echo.Context) error {
+	var validate = validator.New()
+	return func(c echo.Context) error {
+		form := new(groupForm)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		if err := validate.Struct(form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		group, err := s.accountsService.CreateGroup(form.Name, form.Description, form.Members)
+		if err != nil {
+			return groupError(err)
+		}
+		s.refreshUsers(group.Members)
+		s.log.Infow("group created", "group", group.Name, "members", len(group.Members))
+		return c.JSON(http.StatusOK, group)
+	}
+}
+
+func (s *Server) handleUpdateGroup() func(echo.Context) error {
+	var validate = validator.New()
+	return func(c echo.Context) error {
+		form := new(groupForm)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		if err := validate.Struct(form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		group, affected, err := s.accountsService.UpdateGroup(c.Param("name"), form.Description, form.Members)
+		if err != nil {
+			return groupError(err)
+		}
+		s.refreshUsers(affected)
+		return c.JSON(http.StatusOK, group)
+	}
+}
+
+func (s *Server) handleDeleteGroup(c echo.Context) error {
+	members, err := s.accountsService.DeleteGroup(c.Param("name"))
+	if err != nil {
+		return groupError(err)
+	}
+	s.refreshUsers(members)
+	s.log.Infow("group deleted", "group", c.Param("name"))
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Health status of the server for load balancers and monitoring. In the degraded mode (redis is
+// unavailable) logged users can continue to work with their sessions cached in memory.
+func (s *Server) handleHealth(c echo.Context) error {
+	type HealthStatus struct {
+		Status string `json:"status"`
+		Redis  string `json:"redis"`
+	}
+	status := HealthStatus{Status: "ok", Redis: "ok"}
+	if !s.auth.StoreAvailable() {
+		status = HealthStatus{Status: "degraded", Redis: "unavailable"}
+	}
+	return c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+var announcementLevels = domain.StringArray{"info", "warning", "error"}
+
+// Announcement banner displayed in the web application
+type Announcement struct {
+	Message string      `json:"message"`
+	Level   string      `json:"level,omitempty"`
+	Link    *FooterLink `json:"link,omitempty"`
+	// banner is hidden after expiration (optional)
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// Help and contact links managed by administrators, served to the web application by /api/app
+type HelpContent struct {
+	HelpURL          string        `json:"help_url,omitempty"`
+	DocumentationURL string        `json:"documentation_url,omitempty"`
+	ContactURL       string        `json:"contact_url,omitempty"`
+	ContactEmail     string        `json:"contact_email,omitempty"`
+	Links            []FooterLink  `json:"links,omitempty"`
+	Announcement     *Announcement `json:"announcement,omitempty"`
+}
+
+func (s *Server) helpContentPath() string {
+	return filepath.Join(s.Config.ProjectsRoot, "help.json")
+}
+
+func (s *Server) loadHelpContent() (HelpContent, error) {
+	var help HelpContent
+	data, err := os.ReadFile(s.helpContentPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return help, nil
+		}
+		return help, err
+	}
+	err = json.Unmarshal(data, &help)
+	return help, err
+}
+
+// Returns help content for the web application (without expired announcement), nil when not configured
+func (s *Server) appHelpContent() (*HelpContent, error) {
+	help, err := s.loadHelpContent()
+	if err != nil {
+		return nil, err
+	}
+	if help.Announcement != nil && help.Announcement.Expires != nil && help.Announcement.Expires.Before(time.Now()) {
+		help.Announcement = nil
+	}
+	if help.HelpURL == "" && help.DocumentationURL == "" && help.ContactURL == "" && help.ContactEmail == "" &&
+		len(help.Links) == 0 && help.Announcement == nil {
+		return nil, nil
+	}
+	return &help, nil
+}
+
+func (s *Server) handleGetHelpContent(c echo.Context) error {
+	help, err := s.loadHelpContent()
+	if err != nil {
+		return fmt.Errorf("loading help content: %w", err)
+	}
+	return c.JSON(http.StatusOK, help)
+}
+
+func (s *Server) handleSaveHelpContent(c echo.Context) error {
+	help := new(HelpContent)
+	if err := (&echo.DefaultBinder{}).BindBody(c, help); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+	}
+	for _, link := range []string{help.HelpURL, help.DocumentationURL, help.ContactURL} {
+		if !validLinkURL(link) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid link: %s", link))
+		}
+	}
+	for _, link := range help.Links {
+		if link.Title == "" || !validLinkURL(link.URL) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid link: %s", link.URL))
+		}
+	}
+	if a := help.Announcement; a != nil {
+		if a.Message == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Missing announcement message")
+		}
+		if a.Level == "" {
+			a.Level = "info"
+		} else if !announcementLevels.Has(a.Level) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid announcement level: %s", a.Level))
+		}
+		if a.Link != nil && !validLinkURL(a.Link.URL) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid link: %s", a.Link.URL))
+		}
+	}
+	data, err := json.Marshal(help)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.helpContentPath(), data, 0644); err != nil {
+		return fmt.Errorf("saving help content: %w", err)
+	}
+	s.log.Infow("help content updated", "announcement", help.Announcement != nil)
+	return c.JSON(http.StatusOK, help)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/policy"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
+	"github.com/labstack/echo/v4"
+)
+
+// Runs request hook with the same environment as access policy rules (extended by vars)
+func runRequestHooks(c echo.Context, a *auth.AuthService, hooks *policy.Hooks, hook, projectName string, pInfo domain.ProjectInfo, settings domain.ProjectSettings, vars map[string]interface{}) (policy.HookResult, error) {
+	user, err := a.GetUser(c)
+	if err != nil {
+		return policy.HookResult{}, fmt.Errorf("getting user: %w", err)
+	}
+	env := policyEnv(c, user, projectName, pInfo, settings)
+	for k, v := range vars {
+		env[k] = v
+	}
+	return hooks.Run(hook, env)
+}
+
+// Returns error response of the request denied by hook
+func hookDeniedError(c echo.Context, a *auth.AuthService, result policy.HookResult) error {
+	if result.Status == 0 && result.Message == "" {
+		return policyDeniedError(c, a)
+	}
+	status := result.Status
+	if status == 0 {
+		status = http.StatusForbidden
+	}
+	if result.Message != "" {
+		return echo.NewHTTPError(status, result.Message)
+	}
+	return echo.NewHTTPError(status)
+}
+
+// Applies parameters changes of the hook to the OWS query (MAP parameter is protected)
+func applyHookParams(query url.Values, result policy.HookResult) {
+	for _, name := range result.RemoveParams {
+		if strings.EqualFold(name, "MAP") {
+			continue
+		}
+		for param := range query {
+			if strings.EqualFold(param, name) {
+				query.Del(param)
+			}
+		}
+	}
+	for name, value := range result.SetParams {
+		if strings.EqualFold(name, "MAP") {
+			continue
+		}
+		replaceQueryParam(query, name, value)
+	}
+}
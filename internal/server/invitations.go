@@ -0,0 +1,187 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	invitationDefaultDays = 7
+	invitationMaxDays     = 30
+)
+
+func (s *Server) invitationLink(token string) string {
+	u, _ := url.Parse(s.Config.SiteURL)
+	u.Path = "/accounts/invitation/"
+	u.RawQuery = url.Values{"token": {token}}.Encode()
+	return u.String()
+}
+
+func (s *Server) sendInvitationEmail(invitation domain.Invitation, link string) error {
+	// base template is parsed first, so the invitation can override its greeting
+	tmpl, err := texttemplate.New("admin_invitation_email.txt").ParseFiles("./templates/email_base.txt", "./templates/admin_invitation_email.txt")
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"InvitedBy":      invitation.InvitedBy,
+		"Role":           invitation.Role,
+		"InvitationLink": link,
+		"Expires":        invitation.Expires.Format("2006-01-02 15:04 MST"),
+	}
+	recipient := domain.Account{Email: invitation.Email}
+	return s.accountsService.Email.SendBulkEmail([]domain.Account{recipient}, "Invitation to Gisquick", nil, tmpl, data)
+}
+
+// Invitation of a new user by administrator, invited user chooses username and password
+// when accepting the invitation (works also when public signup is disabled)
+func (s *Server) handleCreateInvitation() func(echo.Context) error {
+	type InvitationForm struct {
+		Email string `json:"email" validate:"required,email"`
+		Role  string `json:"role"`
+		Days  int    `json:"days"`
+	}
+	type InvitationResponse struct {
+		domain.Invitation
+		Link      string `json:"link"`
+		EmailSent bool   `json:"email_sent"`
+	}
+	var validate = validator.New()
+	return func(c echo.Context) error {
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		form := new(InvitationForm)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		if err := validate.Struct(form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if form.Role == "" {
+			form.Role = domain.InvitationRoleUser
+		}
+		if form.Role != domain.InvitationRoleUser && form.Role != domain.InvitationRoleSuperuser {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid role")
+		}
+		if form.Days == 0 {
+			form.Days = invitationDefaultDays
+		}
+		if form.Days < 0 || form.Days > invitationMaxDays {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid expiration of the invitation")
+		}
+		invitation, token, err := s.accountsService.CreateInvitation(form.Email, form.Role, user.Username, time.Duration(form.Days)*24*time.Hour)
+		if err != nil {
+			if errors.Is(err, domain.ErrAccountExists) {
+				return echo.NewHTTPError(http.StatusConflict, "Account with this email already exists")
+			}
+			return err
+		}
+		resp := InvitationResponse{Invitation: invitation, Link: s.invitationLink(token)}
+		if s.accountsService.SupportEmails() {
+			if err := s.sendInvitationEmail(invitation, resp.Link); err != nil {
+				s.log.Errorw("sending invitation email", "email", invitation.Email, zap.Error(err))
+			} else {
+				resp.EmailSent = true
+			}
+		}
+		s.log.Infow("user invited", "email", invitation.Email, "role", invitation.Role, "by", user.Username)
+		return c.JSON(http.StatusOK, resp)
+	}
+}
+
+func (s *Server) handleGetInvitations(c echo.Context) error {
+	if s.accountsService.Invites == nil {
+		return c.JSON(http.StatusOK, []domain.Invitation{})
+	}
+	invitations, err := s.accountsService.Invites.List()
+	if err != nil {
+		return fmt.Errorf("listing invitations: %w", err)
+	}
+	return c.JSON(http.StatusOK, invitations)
+}
+
+func (s *Server) handleDeleteInvitation(c echo.Context) error {
+	if s.accountsService.Invites == nil {
+		return echo.ErrNotFound
+	}
+	if err := s.accountsService.Invites.Delete(c.Param("id")); err != nil {
+		if errors.Is(err, domain.ErrInvitationNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Details of the pending invitation for the account creation form
+func (s *Server) handleGetInvitation(c echo.Context) error {
+	type InvitationInfo struct {
+		Email   string    `json:"email"`
+		Expires time.Time `json:"expires_at"`
+	}
+	invitation, err := s.accountsService.GetInvitation(c.QueryParam("token"))
+	if err != nil {
+		if errors.Is(err, application.ErrInvalidToken) || errors.Is(err, application.ErrInvitationsNotSupported) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid invitation link")
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, InvitationInfo{Email: invitation.Email, Expires: invitation.Expires})
+}
+
+func (s *Server) handleAcceptInvitation() func(echo.Context) error {
+	type AcceptForm struct {
+		Token           string `json:"token" validate:"required"`
+		Username        string `json:"username" validate:"required"`
+		Password        string `json:"password1" validate:"required"`
+		PasswordConfirm string `json:"password2" validate:"required"`
+		FirstName       string `json:"first_name"`
+		LastName        string `json:"last_name"`
+	}
+	var validate = validator.New()
+	return func(c echo.Context) error {
+		form := new(AcceptForm)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		if err := validate.Struct(form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if form.Password != form.PasswordConfirm {
+			return echo.NewHTTPError(http.StatusBadRequest, "Password doesn't match")
+		}
+		if err := s.Config.Passwords.Validate(form.Password); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		username, err := s.Config.Names.NormalizeUsername(form.Username)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		account, err := s.accountsService.AcceptInvitation(form.Token, username, strings.TrimSpace(form.FirstName), strings.TrimSpace(form.LastName), form.Password)
+		if err != nil {
+			if errors.Is(err, application.ErrInvalidToken) || errors.Is(err, application.ErrInvitationsNotSupported) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid invitation link")
+			}
+			if errors.Is(err, domain.ErrAccountExists) {
+				return echo.NewHTTPError(http.StatusConflict, "Account already exists")
+			}
+			s.log.Errorw("accepting invitation", "username", username, zap.Error(err))
+			return err
+		}
+		s.log.Infow("invitation accepted", "username", account.Username, "email", account.Email)
+		return c.NoContent(http.StatusOK)
+	}
+}
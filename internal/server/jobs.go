@@ -0,0 +1,248 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Status of the background jobs
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+
+	// finished jobs (and their data) are removed after this time
+	jobsTTL = 24 * time.Hour
+
+	// unfinished jobs are kept alive by periodical update of the job file by the server
+	// instance processing them, jobs without update within the lease are considered interrupted
+	jobLeaseRenewal = time.Minute
+	jobLease        = 5 * jobLeaseRenewal
+)
+
+var isValidJobID = regexp.MustCompile(`^[0-9a-f\-]{36}$`).MatchString
+
+// jobRunner executes background jobs with limited concurrency and time limit
+type jobRunner struct {
+	queue   chan struct{}
+	timeout time.Duration
+}
+
+// Creates job runner, zero timeout means no time limit
+func newJobRunner(concurrency int, timeout time.Duration) *jobRunner {
+	return &jobRunner{queue: make(chan struct{}, concurrency), timeout: timeout}
+}
+
+// Run waits for a free slot and executes the job. Changes of the job status are reported
+// by setStatus callback (running, then done or failed with the error of the job).
+func (r *jobRunner) Run(job func(ctx context.Context) error, setStatus func(status string, err error)) error {
+	r.queue <- struct{}{}
+	defer func() { <-r.queue }()
+
+	setStatus(JobRunning, nil)
+	ctx := context.Background()
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	err := job(ctx)
+	if err != nil {
+		setStatus(JobFailed, err)
+	} else {
+		setStatus(JobDone, nil)
+	}
+	return err
+}
+
+// jobsDir stores jobs in subdirectories of the root directory, state of the job is saved
+// in job.json file together with the job data (results)
+type jobsDir string
+
+func (d jobsDir) path(id string) string {
+	return filepath.Join(string(d), id)
+}
+
+func (d jobsDir) create(id string) error {
+	return os.MkdirAll(d.path(id), 0755)
+}
+
+func (d jobsDir) save(id string, job interface{}) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(d.path(id), "job.json"), data, 0644)
+}
+
+func (d jobsDir) load(id string, job interface{}) error {
+	if !isValidJobID(id) {
+		return os.ErrNotExist
+	}
+	data, err := os.ReadFile(filepath.Join(d.path(id), "job.json"))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, job)
+}
+
+// Renews lease of the job (modification time of the job file)
+func (d jobsDir) touch(id string) error {
+	now := time.Now()
+	return os.Chtimes(filepath.Join(d.path(id), "job.json"), now, now)
+}
+
+// Keeps renewing lease of the job until returned stop function is called
+func (d jobsDir) keepAlive(id string) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jobLeaseRenewal)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				d.touch(id)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// Common fields of the stored jobs
+type jobState struct {
+	Status   string    `json:"status"`
+	Finished time.Time `json:"finished"`
+}
+
+// Returns IDs of the stored jobs
+func (d jobsDir) list() ([]string, error) {
+	entries, err := os.ReadDir(string(d))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if e.IsDir() && isValidJobID(e.Name()) {
+			ids = append(ids, e.Name())
+		}
+	}
+	return ids, nil
+}
+
+// Marks unfinished jobs with lease expired before given time as failed (jobs are executed
+// by the server process, so they can't be finished after restart of the server), other fields
+// of the jobs are preserved. Jobs processed by other running server instances are kept.
+func (d jobsDir) failUnfinished(expired time.Time) (int, error) {
+	ids, err := d.list()
+	if err != nil {
+		return 0, err
+	}
+	failed := 0
+	for _, id := range ids {
+		var job map[string]json.RawMessage
+		var state jobState
+		if err := d.load(id, &job); err != nil {
+			continue
+		}
+		if err := d.load(id, &state); err != nil || (state.Status != JobPending && state.Status != JobRunning) {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(d.path(id), "job.json")); err != nil || info.ModTime().After(expired) {
+			continue
+		}
+		job["status"], _ = json.Marshal(JobFailed)
+		job["error"], _ = json.Marshal("Interrupted by server restart")
+		job["finished"], _ = json.Marshal(time.Now().UTC())
+		if err := d.save(id, job); err != nil {
+			return failed, err
+		}
+		failed++
+	}
+	return failed, nil
+}
+
+// Removes directories of the jobs finished before given time, invalid jobs (without
+// readable state) are removed by modification time of the directory
+func (d jobsDir) removeExpired(before time.Time) (int, error) {
+	ids, err := d.list()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, id := range ids {
+		var state jobState
+		if err := d.load(id, &state); err != nil {
+			info, err := os.Stat(d.path(id))
+			if err != nil || info.ModTime().After(before) {
+				continue
+			}
+		} else if state.Finished.IsZero() || state.Finished.After(before) {
+			continue
+		}
+		if err := os.RemoveAll(d.path(id)); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (s *Server) storedJobs() map[string]jobsDir {
+	dirs := make(map[string]jobsDir)
+	if s.Config.OfflineRoot != "" {
+		dirs["offline"] = s.offlineJobsDir()
+	}
+	if s.Config.ReportsRoot != "" {
+		dirs["report"] = s.reportJobsDir()
+	}
+	return dirs
+}
+
+// FailInterruptedJobs marks stored jobs interrupted by restart of the server (with expired lease)
+// as failed
+func (s *Server) FailInterruptedJobs() {
+	for kind, dir := range s.storedJobs() {
+		n, err := dir.failUnfinished(time.Now().Add(-jobLease))
+		if err != nil {
+			s.log.Errorw("marking interrupted jobs", "jobs", kind, zap.Error(err))
+		}
+		if n > 0 {
+			s.log.Warnw("jobs interrupted by server restart", "jobs", kind, "count", n)
+		}
+	}
+}
+
+// CleanupJobs periodically removes expired jobs and fails jobs interrupted by restart of other
+// server instances
+func (s *Server) CleanupJobs(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.FailInterruptedJobs()
+			for kind, dir := range s.storedJobs() {
+				if _, err := dir.removeExpired(time.Now().Add(-jobsTTL)); err != nil {
+					s.log.Errorw("removing expired jobs", "jobs", kind, zap.Error(err))
+				}
+			}
+			s.cogJobs.removeExpired()
+			s.bulkJobs.removeExpired()
+		}
+	}
+}
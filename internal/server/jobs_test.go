@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJobRunner(t *testing.T) {
+	r := newJobRunner(1, time.Second)
+	var statuses []string
+	setStatus := func(status string, err error) { statuses = append(statuses, status) }
+	if err := r.Run(func(ctx context.Context) error { return nil }, setStatus); err != nil {
+		t.Fatal(err)
+	}
+	jobErr := errors.New("failed")
+	if err := r.Run(func(ctx context.Context) error { return jobErr }, setStatus); err != jobErr {
+		t.Errorf("unexpected error: %v", err)
+	}
+	expected := []string{JobRunning, JobDone, JobRunning, JobFailed}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("got %v, expected %v", statuses, expected)
+	}
+	err := r.Run(func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			return errors.New("missing deadline")
+		}
+		return nil
+	}, func(string, error) {})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestJobsDir(t *testing.T) {
+	dir := jobsDir(t.TempDir())
+	now := time.Now().UTC()
+	jobs := []*OfflineJob{
+		{ID: "00000000-0000-0000-0000-000000000001", Project: "user/project", Status: JobRunning, Created: now},
+		{ID: "00000000-0000-0000-0000-000000000002", Project: "user/project", Status: JobPending, Created: now},
+		{ID: "00000000-0000-0000-0000-000000000003", Project: "user/project", Status: JobDone, Created: now.Add(-48 * time.Hour), Finished: now.Add(-47 * time.Hour)},
+		{ID: "00000000-0000-0000-0000-000000000004", Project: "user/project", Status: JobDone, Created: now, Finished: now},
+	}
+	for _, job := range jobs {
+		if err := dir.create(job.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := dir.save(job.ID, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// jobs with valid lease (e.g. processed by another server instance) are kept
+	if n, err := dir.failUnfinished(time.Now().Add(-jobLease)); err != nil || n != 0 {
+		t.Fatalf("failUnfinished: %d, %v", n, err)
+	}
+	expired := time.Now().Add(-2 * jobLease)
+	if err := os.Chtimes(filepath.Join(dir.path(jobs[1].ID), "job.json"), expired, expired); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := dir.failUnfinished(time.Now().Add(-jobLease)); err != nil || n != 1 {
+		t.Fatalf("failUnfinished: %d, %v", n, err)
+	}
+	if n, err := dir.failUnfinished(time.Now().Add(time.Second)); err != nil || n != 1 {
+		t.Fatalf("failUnfinished: %d, %v", n, err)
+	}
+	job := new(OfflineJob)
+	if err := dir.load(jobs[0].ID, job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobFailed || job.Finished.IsZero() || job.Project != "user/project" {
+		t.Errorf("interrupted job was not marked as failed: %+v", job)
+	}
+	if n, err := dir.removeExpired(now.Add(-jobsTTL)); err != nil || n != 1 {
+		t.Fatalf("removeExpired: %d, %v", n, err)
+	}
+	if _, err := os.Stat(dir.path(jobs[2].ID)); !os.IsNotExist(err) {
+		t.Error("expired job was not removed")
+	}
+	ids, _ := dir.list()
+	if len(ids) != 3 {
+		t.Errorf("unexpected jobs: %v", ids)
+	}
+	if err := dir.load("../job", job); !os.IsNotExist(err) {
+		t.Errorf("invalid job id: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/labstack/echo/v4"
+)
+
+func libraryFileError(err error) error {
+	if errors.Is(err, domain.ErrSharedFileNotExists) {
+		return echo.NewHTTPError(http.StatusNotFound, "Library file does not exists")
+	}
+	if errors.Is(err, domain.ErrSharedFileInUse) {
+		return echo.NewHTTPError(http.StatusConflict, "Library file is used by projects")
+	}
+	return uploadFilesError(err)
+}
+
+func (s *Server) handleGetLibrary(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	files, err := s.projects.ListSharedFiles(user.Username)
+	if err != nil {
+		return fmt.Errorf("listing library files: %w", err)
+	}
+	return c.JSON(http.StatusOK, files)
+}
+
+func (s *Server) handleUploadLibraryFile(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	f, h, err := c.Request().FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing file")
+	}
+	defer f.Close()
+	// same normalization as in the storage, so the replaced file is found by the quota check
+	path, err := project.NormalizePath(c.Param("*"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid file path: %s", c.Param("*")))
+	}
+
+	// library has its own quota, independent of the projects storage
+	limits, err := s.limiter.GetAccountLimits(user.Username)
+	if err != nil {
+		return fmt.Errorf("getting user account limits: %w", err)
+	}
+	if limits.HasLibraryLimit() {
+		files, err := s.projects.ListSharedFiles(user.Username)
+		if err != nil {
+			return fmt.Errorf("listing library files: %w", err)
+		}
+		size := h.Size
+		for _, lf := range files {
+			// replaced file
+			if lf.Path != path {
+				size += lf.Size
+			}
+		}
+		if !limits.CheckLibraryLimit(size) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached library size limit")
+		}
+	}
+	lf, err := s.projects.SaveSharedFile(user.Username, path, f)
+	if err != nil {
+		return libraryFileError(err)
+	}
+	return c.JSON(http.StatusOK, lf)
+}
+
+func (s *Server) handleDeleteLibraryFile(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	if err := s.projects.DeleteSharedFile(user.Username, c.Param("*")); err != nil {
+		return libraryFileError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Links library files of the project owner into the project
+func (s *Server) linkLibraryFiles(projectName string, links []domain.LibraryLink) ([]domain.ProjectFile, error) {
+	files := make([]domain.ProjectFile, 0, len(links))
+	for _, l := range links {
+		if l.Source == "" {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Missing library file")
+		}
+		if l.Path == "" {
+			l.Path = l.Source
+		}
+		finfo, err := s.projects.LinkSharedFile(projectName, l.Source, l.Path)
+		if err != nil {
+			return nil, libraryFileError(err)
+		}
+		files = append(files, finfo)
+	}
+	return files, nil
+}
+
+func (s *Server) handleAttachLibraryFile(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	link := new(domain.LibraryLink)
+	if err := (&echo.DefaultBinder{}).BindBody(c, link); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+	}
+	files, err := s.linkLibraryFiles(projectName, []domain.LibraryLink{*link})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, files[0])
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+var (
+	accessConstraintsRegex = regexp.MustCompile(`(?s)<((?:ows:)?AccessConstraints)>.*?</(?:ows:)?AccessConstraints>`)
+	// elements following AccessConstraints in the WMS 1.3.0 Service section
+	serviceLimitsRegex = regexp.MustCompile(`<(LayerLimit|MaxWidth|MaxHeight)>`)
+)
+
+// Returns license and attribution text of the project data (empty when not configured)
+func licenseNotice(settings domain.ProjectSettings) string {
+	var lines []string
+	license := settings.License
+	if license == "" && settings.Metadata != nil {
+		license = settings.Metadata.License
+	}
+	if license != "" {
+		lines = append(lines, fmt.Sprintf("License: %s", license))
+	}
+	if settings.LicenseURL != "" {
+		lines = append(lines, settings.LicenseURL)
+	}
+	if settings.Attribution != "" {
+		lines = append(lines, fmt.Sprintf("Attribution: %s", settings.Attribution))
+	}
+	if settings.AttributionURL != "" {
+		lines = append(lines, settings.AttributionURL)
+	}
+	return strings.Join(lines, "\n")
+}
+
+type licenseNoticeKey struct{}
+
+// Returns request with license notice injected by rewriteGetCapabilities
+func withLicenseNotice(req *http.Request, notice string) *http.Request {
+	if notice == "" {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), licenseNoticeKey{}, notice))
+}
+
+// Sets AccessConstraints of the WMS/WFS capabilities document to the license notice
+func injectAccessConstraints(doc, notice string) string {
+	text := xmlEscape(notice)
+	if loc := accessConstraintsRegex.FindStringSubmatchIndex(doc); loc != nil {
+		tag := doc[loc[2]:loc[3]]
+		return doc[:loc[0]] + fmt.Sprintf("<%s>%s</%s>", tag, text, tag) + doc[loc[1]:]
+	}
+	// WFS 1.1.0
+	if i := strings.Index(doc, "</ows:ServiceIdentification>"); i != -1 {
+		return doc[:i] + fmt.Sprintf("<ows:AccessConstraints>%s</ows:AccessConstraints>", text) + doc[i:]
+	}
+	end := strings.Index(doc, "</Service>")
+	if end == -1 {
+		return doc
+	}
+	if loc := serviceLimitsRegex.FindStringIndex(doc[:end]); loc != nil {
+		end = loc[0]
+	}
+	return doc[:end] + fmt.Sprintf("<AccessConstraints>%s</AccessConstraints>", text) + doc[end:]
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Request body size limit in bytes and timeout of the request (0 means unlimited)
+type RequestLimit struct {
+	BodySize int64
+	Timeout  time.Duration
+}
+
+// Limits of the route groups, JSON limit is the default for all routes
+type RequestLimitsConfig struct {
+	JSON   RequestLimit
+	Upload RequestLimit
+	// OWS requests (POST requests with WFS-T transactions can be large)
+	OWS   RequestLimit
+	Media RequestLimit
+}
+
+var errRequestBodyTooLarge = errors.New("request body too large")
+
+// Request body reader with adjustable size limit, which remembers when the limit was exceeded,
+// so the error can be reported consistently even when handler wraps or replaces it
+type requestBody struct {
+	io.ReadCloser
+	limit    int64
+	n        int64
+	exceeded bool
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, errRequestBodyTooLarge
+	}
+	if b.limit > 0 && int64(len(p)) > b.limit-b.n+1 {
+		p = p[:b.limit-b.n+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if b.limit > 0 && b.n > b.limit {
+		b.exceeded = true
+		n -= int(b.n - b.limit)
+		b.n = b.limit
+		return n, errRequestBodyTooLarge
+	}
+	return n, err
+}
+
+// Returns true when request body limit was exceeded (e.g. while streaming the body by reverse proxy)
+func requestBodyExceeded(r *http.Request) bool {
+	b, ok := r.Body.(*requestBody)
+	return ok && b.exceeded
+}
+
+type requestLimiter struct {
+	body   *requestBody
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Applies limit to the current request (derived from the original request context, so the timeout can be extended)
+func (rl *requestLimiter) apply(c echo.Context, limit RequestLimit) {
+	rl.body.limit = limit.BodySize
+	if rl.cancel != nil {
+		rl.cancel()
+		rl.cancel = nil
+	}
+	ctx := rl.ctx
+	if limit.Timeout > 0 {
+		ctx, rl.cancel = context.WithTimeout(ctx, limit.Timeout)
+	}
+	c.SetRequest(c.Request().WithContext(ctx))
+}
+
+// RequestLimitsMiddleware applies the default limit to all requests and translates exceeded limits into error responses
+func RequestLimitsMiddleware(defaultLimit RequestLimit) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			rl := &requestLimiter{
+				body: &requestBody{ReadCloser: req.Body},
+				ctx:  req.Context(),
+			}
+			req.Body = rl.body
+			rl.apply(c, defaultLimit)
+			c.Set("requestLimiter", rl)
+			defer func() {
+				if rl.cancel != nil {
+					rl.cancel()
+				}
+			}()
+
+			err := next(c)
+			if err != nil && !c.Response().Committed {
+				if rl.body.exceeded {
+					return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Request body is too large")
+				}
+				if errors.Is(c.Request().Context().Err(), context.DeadlineExceeded) && rl.ctx.Err() == nil {
+					return echo.NewHTTPError(http.StatusServiceUnavailable, "Request timeout")
+				}
+			}
+			return err
+		}
+	}
+}
+
+// RequestLimitMiddleware overrides the default limit for the route group
+func RequestLimitMiddleware(limit RequestLimit) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if rl, ok := c.Get("requestLimiter").(*requestLimiter); ok {
+				rl.apply(c, limit)
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ListenerConfig describes single listener of the API server
+type ListenerConfig struct {
+	// TCP address (e.g. 0.0.0.0:3000, [::]:3000, tcp6:[::1]:3000) or unix socket path (unix:/run/gisquick.sock)
+	Address string
+	// TLS certificate and key files (TLS is disabled when empty)
+	TLSCert string
+	TLSKey  string
+	// file mode of the unix socket
+	SocketMode os.FileMode
+}
+
+func (l ListenerConfig) network() (string, string) {
+	for _, network := range []string{"unix", "tcp4", "tcp6", "tcp"} {
+		if strings.HasPrefix(l.Address, network+":") {
+			return network, strings.TrimPrefix(l.Address, network+":")
+		}
+	}
+	return "tcp", l.Address
+}
+
+// ParseListeners parses listeners configuration in format "address;option=value,address2".
+// Supported options are cert and key (TLS) and mode (permissions of unix socket in octal format),
+// e.g. "[::]:3000,unix:/run/gisquick.sock;mode=660,0.0.0.0:3443;cert=/certs/api.crt;key=/certs/api.key"
+func ParseListeners(value string) ([]ListenerConfig, error) {
+	var listeners []ListenerConfig
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ";")
+		l := ListenerConfig{Address: strings.TrimSpace(parts[0])}
+		for _, opt := range parts[1:] {
+			key, val, _ := strings.Cut(opt, "=")
+			val = strings.TrimSpace(val)
+			switch strings.TrimSpace(key) {
+			case "cert":
+				l.TLSCert = val
+			case "key":
+				l.TLSKey = val
+			case "mode":
+				mode, err := strconv.ParseUint(val, 8, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid socket mode of listener %s: %s", l.Address, val)
+				}
+				l.SocketMode = os.FileMode(mode)
+			default:
+				return nil, fmt.Errorf("unknown option of listener %s: %s", l.Address, key)
+			}
+		}
+		if _, addr := l.network(); addr == "" {
+			return nil, fmt.Errorf("invalid listener configuration: %s", item)
+		}
+		if (l.TLSCert == "") != (l.TLSKey == "") {
+			return nil, fmt.Errorf("both TLS certificate and key must be set for listener %s", l.Address)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+func listen(cfg ListenerConfig) (net.Listener, error) {
+	network, addr := cfg.network()
+	if network == "unix" {
+		// stale socket file after unclean shutdown
+		if err := os.Remove(addr); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("removing unix socket: %w", err)
+		}
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" && cfg.SocketMode != 0 {
+		if err := os.Chmod(addr, cfg.SocketMode); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("changing unix socket permissions: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// Serve starts serving the API on all listeners and returns when any of them fails or the server is shut down
+func (s *Server) Serve(listeners []ListenerConfig) error {
+	if len(listeners) == 0 {
+		return errors.New("no listeners configured")
+	}
+	netListeners := make([]net.Listener, 0, len(listeners))
+	for _, cfg := range listeners {
+		l, err := listen(cfg)
+		if err != nil {
+			for _, l := range netListeners {
+				l.Close()
+			}
+			return fmt.Errorf("listening on %s: %w", cfg.Address, err)
+		}
+		netListeners = append(netListeners, l)
+	}
+
+	errs := make(chan error, len(listeners))
+	s.serversMu.Lock()
+	for i, cfg := range listeners {
+		srv := &http.Server{Handler: s.echo, ErrorLog: s.echo.StdLogger}
+		s.servers = append(s.servers, srv)
+		go func(l net.Listener, cfg ListenerConfig) {
+			if cfg.TLSCert != "" {
+				errs <- srv.ServeTLS(l, cfg.TLSCert, cfg.TLSKey)
+			} else {
+				errs <- srv.Serve(l)
+			}
+		}(netListeners[i], cfg)
+		s.log.Infow("listening", "address", netListeners[i].Addr().String(), "tls", cfg.TLSCert != "")
+	}
+	s.serversMu.Unlock()
+	return <-errs
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Server) handleGetProjectLogs(c echo.Context) error {
+	type Payload struct {
+		Level   project.LogLevel   `json:"level"`
+		Entries []project.LogEntry `json:"entries"`
+	}
+	projectName := c.QueryParam("project")
+	if projectName == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing project parameter")
+	}
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	ctx := c.Request().Context()
+	level, err := s.projectLogs.GetLevel(ctx, projectName)
+	if err != nil {
+		return fmt.Errorf("getting project log level: %w", err)
+	}
+	entries, err := s.projectLogs.GetEntries(ctx, projectName, limit)
+	if err != nil {
+		return fmt.Errorf("getting project logs: %w", err)
+	}
+	return c.JSON(http.StatusOK, Payload{Level: level, Entries: entries})
+}
+
+func (s *Server) handleSetProjectLogLevel() func(echo.Context) error {
+	type Form struct {
+		Project  string `json:"project"`
+		Level    string `json:"level"`
+		Duration string `json:"duration"`
+	}
+	return func(c echo.Context) error {
+		form := new(Form)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		if form.Level != project.LogLevelOff && form.Level != project.LogLevelDebug {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid log level")
+		}
+		if _, err := s.projects.GetProjectInfo(form.Project); err != nil {
+			if errors.Is(err, domain.ErrProjectNotExists) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+			}
+			return err
+		}
+		duration := time.Hour
+		if form.Duration != "" {
+			d, err := time.ParseDuration(form.Duration)
+			if err != nil || d <= 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid duration")
+			}
+			duration = d
+		}
+		if err := s.projectLogs.SetLevel(c.Request().Context(), form.Project, form.Level, duration); err != nil {
+			return fmt.Errorf("setting project log level: %w", err)
+		}
+		s.log.Infow("project log level changed", "project", form.Project, "level", form.Level, "duration", duration)
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+func (s *Server) handleClearProjectLogs(c echo.Context) error {
+	projectName := c.QueryParam("project")
+	if projectName == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing project parameter")
+	}
+	if err := s.projectLogs.Clear(c.Request().Context(), projectName); err != nil {
+		return fmt.Errorf("clearing project logs: %w", err)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// Logs OWS requests of the projects with enabled logging, it must be registered
+// before the access checks to log also the denied requests
+func (s *Server) owsLogMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		projectName := getProjectName(c)
+		if !s.projectLogs.Enabled(projectName) {
+			return next(c)
+		}
+		start := time.Now()
+		err := next(c)
+		s.logOwsRequest(projectName, c, time.Since(start), err)
+		return err
+	}
+}
+
+func (s *Server) logOwsRequest(projectName string, c echo.Context, duration time.Duration, err error) {
+	status := c.Response().Status
+	if err != nil {
+		status = http.StatusInternalServerError
+		var he *echo.HTTPError
+		if errors.As(err, &he) {
+			status = he.Code
+		}
+	}
+	data := map[string]any{
+		"method":   c.Request().Method,
+		"status":   status,
+		"duration": duration.Milliseconds(),
+		"size":     c.Response().Size,
+	}
+	for name, values := range c.QueryParams() {
+		switch strings.ToUpper(name) {
+		case "SERVICE", "REQUEST", "LAYERS", "QUERY_LAYERS", "TYPENAME", "TYPENAMES", "FORMAT", "OUTPUTFORMAT":
+			data[strings.ToLower(name)] = strings.Join(values, ",")
+		}
+	}
+	if t, ok := c.Get("wfs_transaction").(*Transaction); ok {
+		data["operations"] = t.Operations
+	}
+	user, uerr := s.auth.GetUser(c)
+	if uerr == nil && user.IsAuthenticated {
+		data["user"] = user.Username
+	}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	if status == http.StatusForbidden || status == http.StatusUnauthorized {
+		s.projectLogs.Log(projectName, "access", "OWS request denied", data)
+	} else {
+		s.projectLogs.Log(projectName, "ows", "OWS request", data)
+	}
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Routes which are unavailable to regular users in the maintenance mode
+var maintenanceRoutes = []string{"/api/map/", "/ws/map/", "/api/offline/", "/api/report/"}
+
+type MaintenanceMode struct {
+	Enabled bool       `json:"enabled"`
+	Message string     `json:"message,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// Maintenance mode state, persisted in the projects root directory
+type maintenanceState struct {
+	mu     sync.RWMutex
+	path   string
+	loaded bool
+	mode   MaintenanceMode
+}
+
+func newMaintenanceState(projectsRoot string) *maintenanceState {
+	return &maintenanceState{path: filepath.Join(projectsRoot, "maintenance.json")}
+}
+
+func (m *maintenanceState) Get() (MaintenanceMode, error) {
+	m.mu.RLock()
+	if m.loaded {
+		defer m.mu.RUnlock()
+		return m.mode, nil
+	}
+	m.mu.RUnlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.loaded {
+		return m.mode, nil
+	}
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			m.loaded = true
+			return m.mode, nil
+		}
+		return m.mode, err
+	}
+	if err := json.Unmarshal(data, &m.mode); err != nil {
+		return m.mode, err
+	}
+	m.loaded = true
+	return m.mode, nil
+}
+
+func (m *maintenanceState) Set(mode MaintenanceMode) error {
+	data, err := json.Marshal(mode)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := os.WriteFile(m.path, data, 0644); err != nil {
+		return err
+	}
+	m.mode = mode
+	m.loaded = true
+	return nil
+}
+
+var maintenancePage = template.Must(template.New("maintenance").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; display: flex; flex-direction: column; align-items: center; justify-content: center; min-height: 90vh; color: #333; }
+{{if .Color}}h1 { color: {{.Color}}; }{{end}}
+</style>
+</head>
+<body>
+{{if .Logo}}<img src="{{.Logo}}" alt="" height="64">{{end}}
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+</body>
+</html>
+`))
+
+// Responds with 503 status, HTML page is rendered for browser requests
+func (s *Server) maintenanceResponse(c echo.Context, mode MaintenanceMode) error {
+	message := mode.Message
+	if message == "" {
+		message = "Service is temporarily unavailable due to maintenance."
+	}
+	c.Response().Header().Set("Retry-After", "600")
+	if !strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMETextHTML) {
+		return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+			"status":      http.StatusServiceUnavailable,
+			"maintenance": true,
+			"message":     message,
+		})
+	}
+	branding, err := s.loadBranding()
+	if err != nil {
+		s.log.Errorw("loading branding", zap.Error(err))
+	}
+	title := "Gisquick"
+	if branding.InstanceName != "" {
+		title = branding.InstanceName
+	}
+	data := map[string]interface{}{
+		"Title":   title,
+		"Message": message,
+		"Logo":    branding.Images["logo"],
+		"Color":   template.CSS(branding.Colors["primary"]),
+	}
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+	c.Response().WriteHeader(http.StatusServiceUnavailable)
+	return maintenancePage.Execute(c.Response(), data)
+}
+
+// Blocks map routes for all users except superusers when the maintenance mode is enabled
+func (s *Server) maintenanceMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		path := c.Request().URL.Path
+		blocked := false
+		for _, prefix := range maintenanceRoutes {
+			if strings.HasPrefix(path, prefix) {
+				blocked = true
+				break
+			}
+		}
+		if !blocked {
+			return next(c)
+		}
+		mode, err := s.maintenance.Get()
+		if err != nil {
+			s.log.Errorw("reading maintenance mode", zap.Error(err))
+			return next(c)
+		}
+		if !mode.Enabled {
+			return next(c)
+		}
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return fmt.Errorf("maintenanceMiddleware: %w", err)
+		}
+		if user.IsSuperuser {
+			return next(c)
+		}
+		return s.maintenanceResponse(c, mode)
+	}
+}
+
+func (s *Server) handleGetMaintenance(c echo.Context) error {
+	mode, err := s.maintenance.Get()
+	if err != nil {
+		return fmt.Errorf("reading maintenance mode: %w", err)
+	}
+	return c.JSON(http.StatusOK, mode)
+}
+
+func (s *Server) handleSetMaintenance(c echo.Context) error {
+	mode := new(MaintenanceMode)
+	if err := (&echo.DefaultBinder{}).BindBody(c, mode); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+	}
+	current, err := s.maintenance.Get()
+	if err != nil {
+		s.log.Warnw("reading maintenance mode", zap.Error(err))
+	}
+	mode.Since = nil
+	if mode.Enabled {
+		mode.Since = current.Since
+		if !current.Enabled || mode.Since == nil {
+			now := time.Now().UTC()
+			mode.Since = &now
+		}
+	}
+	if err := s.maintenance.Set(*mode); err != nil {
+		return fmt.Errorf("saving maintenance mode: %w", err)
+	}
+	s.log.Infow("maintenance mode", "enabled", mode.Enabled)
+	return c.JSON(http.StatusOK, mode)
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/infrastructure/diskcache"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Size budgets of the map tiles cache (0 means unlimited)
+type MapCacheConfig struct {
+	MaxSize        int64
+	ProjectMaxSize int64
+}
+
+var (
+	mapCacheSizeGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mapcache_size_bytes",
+		Help: "Total size of the map tiles cache.",
+	})
+	mapCacheEvictedCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mapcache_evicted_files_total",
+		Help: "Counts tiles removed from the map cache to fit into size limits.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(mapCacheSizeGauge, mapCacheEvictedCounter)
+}
+
+func (s *Server) projectMapCacheDir(projectName string) string {
+	projectHash := fmt.Sprintf("%x", md5.Sum([]byte(projectName)))
+	return filepath.Join(s.Config.MapCacheRoot, projectHash)
+}
+
+func (s *Server) clearMapCache(projectName string) error {
+	if s.Config.MapCacheRoot == "" {
+		return nil
+	}
+	return os.RemoveAll(s.projectMapCacheDir(projectName))
+}
+
+// Maps cache directories to project names
+func (s *Server) mapCacheProjects() (map[string]string, error) {
+	accounts, err := s.accountsService.GetAllAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("getting accounts: %w", err)
+	}
+	projects := make(map[string]string)
+	for _, a := range accounts {
+		list, err := s.projects.GetUserProjects(a.Username)
+		if err != nil {
+			s.log.Errorw("getting user projects", "user", a.Username, zap.Error(err))
+			continue
+		}
+		for _, p := range list {
+			projects[filepath.Base(s.projectMapCacheDir(p.Name))] = p.Name
+		}
+	}
+	return projects, nil
+}
+
+type mapCacheUsage struct {
+	Project string `json:"project,omitempty"`
+	Dir     string `json:"dir"`
+	Size    int64  `json:"size"`
+	Files   int    `json:"files"`
+	entries []diskcache.Entry
+}
+
+func (s *Server) scanMapCache() ([]*mapCacheUsage, error) {
+	dirs, err := os.ReadDir(s.Config.MapCacheRoot)
+	if err != nil {
+		return nil, err
+	}
+	usage := make([]*mapCacheUsage, 0, len(dirs))
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		entries, size, err := diskcache.Scan(filepath.Join(s.Config.MapCacheRoot, d.Name()))
+		if err != nil {
+			return nil, err
+		}
+		usage = append(usage, &mapCacheUsage{Dir: d.Name(), Size: size, Files: len(entries), entries: entries})
+	}
+	return usage, nil
+}
+
+// Removes least recently used tiles to fit the cache into the project and global size limits
+func (s *Server) sweepMapCache() error {
+	s.mapCacheMu.Lock()
+	defer s.mapCacheMu.Unlock()
+	usage, err := s.scanMapCache()
+	if err != nil {
+		return fmt.Errorf("scanning map cache: %w", err)
+	}
+	limits := s.Config.MapCache
+	var total int64
+	var all []diskcache.Entry
+	for _, u := range usage {
+		if limits.ProjectMaxSize > 0 {
+			entries, size, removed, err := diskcache.Evict(u.entries, u.Size, limits.ProjectMaxSize)
+			mapCacheEvictedCounter.Add(float64(removed))
+			if err != nil {
+				return fmt.Errorf("evicting map cache: %w", err)
+			}
+			u.entries, u.Size = entries, size
+		}
+		total += u.Size
+		all = append(all, u.entries...)
+	}
+	if limits.MaxSize > 0 {
+		var removed int
+		_, total, removed, err = diskcache.Evict(all, total, limits.MaxSize)
+		mapCacheEvictedCounter.Add(float64(removed))
+		if err != nil {
+			return fmt.Errorf("evicting map cache: %w", err)
+		}
+	}
+	mapCacheSizeGauge.Set(float64(total))
+	return nil
+}
+
+// SweepMapCache periodically enforces map cache size limits until the context is cancelled
+func (s *Server) SweepMapCache(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.sweepMapCache(); err != nil {
+				s.log.Errorw("map cache sweeper", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *Server) handleGetMapCacheUsage(c echo.Context) error {
+	usage, err := s.scanMapCache()
+	if err != nil {
+		return fmt.Errorf("scanning map cache: %w", err)
+	}
+	projects, err := s.mapCacheProjects()
+	if err != nil {
+		return err
+	}
+	type Response struct {
+		Size           int64            `json:"size"`
+		MaxSize        int64            `json:"max_size"`
+		ProjectMaxSize int64            `json:"project_max_size"`
+		Projects       []*mapCacheUsage `json:"projects"`
+	}
+	resp := Response{
+		MaxSize:        s.Config.MapCache.MaxSize,
+		ProjectMaxSize: s.Config.MapCache.ProjectMaxSize,
+		Projects:       usage,
+	}
+	for _, u := range usage {
+		u.Project = projects[u.Dir]
+		resp.Size += u.Size
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Size > usage[j].Size })
+	mapCacheSizeGauge.Set(float64(resp.Size))
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) handleClearMapCache(c echo.Context) error {
+	projectName := getProjectName(c)
+	if err := s.clearMapCache(projectName); err != nil {
+		return fmt.Errorf("clearing project map cache: %w", err)
+	}
+	s.log.Infow("map cache cleared", "project", projectName)
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,305 @@
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/markdown"
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const earthRadius = 6378137.0
+
+// ISO 639-2/B codes of the supported client languages (used in INSPIRE metadata)
+var iso639Languages = map[string]string{
+	"cs": "cze",
+	"de": "ger",
+	"en": "eng",
+	"es": "spa",
+	"fr": "fre",
+	"hu": "hun",
+	"it": "ita",
+	"nl": "dut",
+	"pl": "pol",
+	"pt": "por",
+	"sk": "slo",
+}
+
+type metadataRecord struct {
+	Identifier string
+	Title      string
+	Abstract   string
+	Keywords   []string
+	Language   string
+	License    string
+	Contact    *domain.MetadataContact
+	Created    time.Time
+	Updated    time.Time
+	EPSG       string
+	// plain text of the project description
+	Description string
+	// geographic bounding box (west, east, south, north)
+	BBox   []float64
+	MapURL string
+	OwsURL string
+}
+
+func xmlText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+var metadataTemplateFuncs = template.FuncMap{
+	"xml":     xmlText,
+	"isodate": func(t time.Time) string { return t.UTC().Format("2006-01-02T15:04:05") },
+	"date":    func(t time.Time) string { return t.UTC().Format("2006-01-02") },
+	"decimal": func(v float64) string { return strconv.FormatFloat(v, 'f', 6, 64) },
+}
+
+var iso19139Template = template.Must(template.New("iso19139").Funcs(metadataTemplateFuncs).Parse(
+	`{{define "string"}}<gco:CharacterString>{{xml .}}</gco:CharacterString>{{end}}` +
+		`{{define "language"}}<gmd:LanguageCode codeList="http://www.loc.gov/standards/iso639-2/" codeListValue="{{.}}">{{.}}</gmd:LanguageCode>{{end}}` +
+		`{{define "party"}}<gmd:CI_ResponsibleParty>
+      {{if .Person}}<gmd:individualName>{{template "string" .Person}}</gmd:individualName>{{end}}
+      {{if .Organization}}<gmd:organisationName>{{template "string" .Organization}}</gmd:organisationName>{{end}}
+      <gmd:contactInfo>
+        <gmd:CI_Contact>
+          {{if .Phone}}<gmd:phone><gmd:CI_Telephone><gmd:voice>{{template "string" .Phone}}</gmd:voice></gmd:CI_Telephone></gmd:phone>{{end}}
+          {{if .Email}}<gmd:address><gmd:CI_Address><gmd:electronicMailAddress>{{template "string" .Email}}</gmd:electronicMailAddress></gmd:CI_Address></gmd:address>{{end}}
+        </gmd:CI_Contact>
+      </gmd:contactInfo>
+      <gmd:role><gmd:CI_RoleCode codeList="http://standards.iso.org/iso/19139/resources/gmxCodelists.xml#CI_RoleCode" codeListValue="pointOfContact">pointOfContact</gmd:CI_RoleCode></gmd:role>
+    </gmd:CI_ResponsibleParty>{{end}}` +
+		`<?xml version="1.0" encoding="UTF-8"?>
+<gmd:MD_Metadata xmlns:gmd="http://www.isotc211.org/2005/gmd" xmlns:gco="http://www.isotc211.org/2005/gco" xmlns:gml="http://www.opengis.net/gml" xmlns:xlink="http://www.w3.org/1999/xlink">
+  <gmd:fileIdentifier>{{template "string" .Identifier}}</gmd:fileIdentifier>
+  <gmd:language>{{template "language" .Language}}</gmd:language>
+  <gmd:characterSet><gmd:MD_CharacterSetCode codeList="http://standards.iso.org/iso/19139/resources/gmxCodelists.xml#MD_CharacterSetCode" codeListValue="utf8">utf8</gmd:MD_CharacterSetCode></gmd:characterSet>
+  <gmd:hierarchyLevel><gmd:MD_ScopeCode codeList="http://standards.iso.org/iso/19139/resources/gmxCodelists.xml#MD_ScopeCode" codeListValue="dataset">dataset</gmd:MD_ScopeCode></gmd:hierarchyLevel>
+  {{with .Contact}}<gmd:contact>
+    {{template "party" .}}
+  </gmd:contact>{{end}}
+  <gmd:dateStamp><gco:DateTime>{{isodate .Updated}}</gco:DateTime></gmd:dateStamp>
+  <gmd:metadataStandardName>{{template "string" "ISO 19115:2003/19139"}}</gmd:metadataStandardName>
+  <gmd:metadataStandardVersion>{{template "string" "1.0"}}</gmd:metadataStandardVersion>
+  {{if .EPSG}}<gmd:referenceSystemInfo>
+    <gmd:MD_ReferenceSystem>
+      <gmd:referenceSystemIdentifier>
+        <gmd:RS_Identifier><gmd:code>{{template "string" (printf "http://www.opengis.net/def/crs/EPSG/0/%s" .EPSG)}}</gmd:code></gmd:RS_Identifier>
+      </gmd:referenceSystemIdentifier>
+    </gmd:MD_ReferenceSystem>
+  </gmd:referenceSystemInfo>{{end}}
+  <gmd:identificationInfo>
+    <gmd:MD_DataIdentification>
+      <gmd:citation>
+        <gmd:CI_Citation>
+          <gmd:title>{{template "string" .Title}}</gmd:title>
+          <gmd:date><gmd:CI_Date><gmd:date><gco:DateTime>{{isodate .Created}}</gco:DateTime></gmd:date><gmd:dateType><gmd:CI_DateTypeCode codeList="http://standards.iso.org/iso/19139/resources/gmxCodelists.xml#CI_DateTypeCode" codeListValue="creation">creation</gmd:CI_DateTypeCode></gmd:dateType></gmd:CI_Date></gmd:date>
+          <gmd:date><gmd:CI_Date><gmd:date><gco:DateTime>{{isodate .Updated}}</gco:DateTime></gmd:date><gmd:dateType><gmd:CI_DateTypeCode codeList="http://standards.iso.org/iso/19139/resources/gmxCodelists.xml#CI_DateTypeCode" codeListValue="revision">revision</gmd:CI_DateTypeCode></gmd:dateType></gmd:CI_Date></gmd:date>
+          <gmd:identifier><gmd:MD_Identifier><gmd:code>{{template "string" .Identifier}}</gmd:code></gmd:MD_Identifier></gmd:identifier>
+        </gmd:CI_Citation>
+      </gmd:citation>
+      <gmd:abstract>{{template "string" .Abstract}}</gmd:abstract>
+      {{with .Contact}}<gmd:pointOfContact>
+        {{template "party" .}}
+      </gmd:pointOfContact>{{end}}
+      {{if .Keywords}}<gmd:descriptiveKeywords>
+        <gmd:MD_Keywords>
+          {{range .Keywords}}<gmd:keyword>{{template "string" .}}</gmd:keyword>
+          {{end}}
+        </gmd:MD_Keywords>
+      </gmd:descriptiveKeywords>{{end}}
+      {{if .License}}<gmd:resourceConstraints>
+        <gmd:MD_LegalConstraints><gmd:useLimitation>{{template "string" .License}}</gmd:useLimitation></gmd:MD_LegalConstraints>
+      </gmd:resourceConstraints>{{end}}
+      <gmd:language>{{template "language" .Language}}</gmd:language>
+      {{with .BBox}}<gmd:extent>
+        <gmd:EX_Extent>
+          <gmd:geographicElement>
+            <gmd:EX_GeographicBoundingBox>
+              <gmd:westBoundLongitude><gco:Decimal>{{decimal (index . 0)}}</gco:Decimal></gmd:westBoundLongitude>
+              <gmd:eastBoundLongitude><gco:Decimal>{{decimal (index . 1)}}</gco:Decimal></gmd:eastBoundLongitude>
+              <gmd:southBoundLatitude><gco:Decimal>{{decimal (index . 2)}}</gco:Decimal></gmd:southBoundLatitude>
+              <gmd:northBoundLatitude><gco:Decimal>{{decimal (index . 3)}}</gco:Decimal></gmd:northBoundLatitude>
+            </gmd:EX_GeographicBoundingBox>
+          </gmd:geographicElement>
+        </gmd:EX_Extent>
+      </gmd:extent>{{end}}
+      {{if .Description}}<gmd:supplementalInformation>{{template "string" .Description}}</gmd:supplementalInformation>{{end}}
+    </gmd:MD_DataIdentification>
+  </gmd:identificationInfo>
+  <gmd:distributionInfo>
+    <gmd:MD_Distribution>
+      <gmd:transferOptions>
+        <gmd:MD_DigitalTransferOptions>
+          <gmd:onLine>
+            <gmd:CI_OnlineResource>
+              <gmd:linkage><gmd:URL>{{xml .MapURL}}</gmd:URL></gmd:linkage>
+              <gmd:protocol>{{template "string" "WWW:LINK"}}</gmd:protocol>
+              <gmd:name>{{template "string" .Title}}</gmd:name>
+            </gmd:CI_OnlineResource>
+          </gmd:onLine>
+          <gmd:onLine>
+            <gmd:CI_OnlineResource>
+              <gmd:linkage><gmd:URL>{{xml .OwsURL}}</gmd:URL></gmd:linkage>
+              <gmd:protocol>{{template "string" "OGC:WMS"}}</gmd:protocol>
+              <gmd:name>{{template "string" .Title}}</gmd:name>
+            </gmd:CI_OnlineResource>
+          </gmd:onLine>
+        </gmd:MD_DigitalTransferOptions>
+      </gmd:transferOptions>
+    </gmd:MD_Distribution>
+  </gmd:distributionInfo>
+</gmd:MD_Metadata>
+`))
+
+var dublinCoreTemplate = template.Must(template.New("dc").Funcs(metadataTemplateFuncs).Parse(
+	`<?xml version="1.0" encoding="UTF-8"?>
+<oai_dc:dc xmlns:oai_dc="http://www.openarchives.org/OAI/2.0/oai_dc/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <dc:identifier>{{xml .Identifier}}</dc:identifier>
+  <dc:title>{{xml .Title}}</dc:title>
+  {{if .Abstract}}<dc:description>{{xml .Abstract}}</dc:description>{{end}}
+  {{if .Description}}<dc:description>{{xml .Description}}</dc:description>{{end}}
+  {{range .Keywords}}<dc:subject>{{xml .}}</dc:subject>
+  {{end}}
+  {{with .Contact}}{{if .Person}}<dc:creator>{{xml .Person}}</dc:creator>{{end}}
+  {{if .Organization}}<dc:publisher>{{xml .Organization}}</dc:publisher>{{end}}{{end}}
+  <dc:date>{{date .Updated}}</dc:date>
+  <dc:type>Dataset</dc:type>
+  <dc:format>OGC:WMS</dc:format>
+  <dc:language>{{.Language}}</dc:language>
+  {{if .License}}<dc:rights>{{xml .License}}</dc:rights>{{end}}
+  {{with .BBox}}<dc:coverage>North {{decimal (index . 3)}}, South {{decimal (index . 2)}}, East {{decimal (index . 1)}}, West {{decimal (index . 0)}}</dc:coverage>{{end}}
+  <dc:source>{{xml .MapURL}}</dc:source>
+  <dc:relation>{{xml .OwsURL}}</dc:relation>
+</oai_dc:dc>
+`))
+
+// Transforms project extent into geographic bounding box (west, east, south, north),
+// only geographic and web mercator coordinate systems are supported
+func geographicBBox(extent []float64, projection string) []float64 {
+	if len(extent) != 4 {
+		return nil
+	}
+	switch projection {
+	case "EPSG:4326", "EPSG:4258", "CRS:84":
+		return []float64{extent[0], extent[2], extent[1], extent[3]}
+	case "EPSG:3857", "EPSG:900913":
+		lon := func(x float64) float64 { return x / earthRadius * 180 / math.Pi }
+		lat := func(y float64) float64 { return (2*math.Atan(math.Exp(y/earthRadius)) - math.Pi/2) * 180 / math.Pi }
+		return []float64{lon(extent[0]), lon(extent[2]), lat(extent[1]), lat(extent[3])}
+	}
+	return nil
+}
+
+func metadataLanguage(lang string) string {
+	if len(lang) == 3 {
+		return lang
+	}
+	base, _, _ := strings.Cut(strings.ToLower(lang), "-")
+	if code, ok := iso639Languages[base]; ok {
+		return code
+	}
+	return "eng"
+}
+
+// Identifier of the project metadata record (stable UUID derived from the map URL)
+func (s *Server) metadataIdentifier(projectName string) string {
+	return uuid.NewV5(uuid.NamespaceURL, s.projectMapURL(projectName)).String()
+}
+
+func (s *Server) projectMapURL(projectName string) string {
+	return fmt.Sprintf("%s/?PROJECT=%s", strings.TrimSuffix(s.Config.SiteURL, "/"), projectName)
+}
+
+func (s *Server) projectMetadata(projectName string, tmpl *template.Template) ([]byte, error) {
+	pInfo, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		return nil, fmt.Errorf("getting project info: %w", err)
+	}
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return nil, fmt.Errorf("getting project settings: %w", err)
+	}
+	var meta domain.QgisMeta
+	if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+		return nil, fmt.Errorf("parsing qgis meta: %w", err)
+	}
+
+	record := metadataRecord{
+		Identifier: s.metadataIdentifier(projectName),
+		Title:      pInfo.Title,
+		Language:   metadataLanguage(s.Config.Language),
+		Created:    pInfo.Created,
+		Updated:    pInfo.LastUpdate,
+		MapURL:     s.projectMapURL(projectName),
+		OwsURL:     s.projectOwsURL(projectName),
+	}
+	if settings.Title != "" {
+		record.Title = settings.Title
+	} else if record.Title == "" {
+		record.Title = meta.Title
+	}
+	if strings.HasPrefix(meta.Projection, "EPSG:") {
+		record.EPSG = strings.TrimPrefix(meta.Projection, "EPSG:")
+	}
+	extent := settings.Extent
+	if len(extent) != 4 {
+		extent = meta.Extent
+	}
+	record.BBox = geographicBBox(extent, meta.Projection)
+	description, err := s.projects.GetDescription(projectName)
+	if err != nil {
+		return nil, fmt.Errorf("getting project description: %w", err)
+	}
+	record.Description = markdown.PlainText(description)
+	record.License = settings.License
+	if m := settings.Metadata; m != nil {
+		record.Abstract = m.Abstract
+		record.Keywords = m.Keywords
+		if m.License != "" {
+			record.License = m.License
+		}
+		record.Contact = m.Contact
+		if m.Language != "" {
+			record.Language = metadataLanguage(m.Language)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, record); err != nil {
+		return nil, fmt.Errorf("generating metadata: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *Server) handleGetProjectMetadata(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "iso19139"
+	}
+	var tmpl *template.Template
+	switch format {
+	case "iso19139":
+		tmpl = iso19139Template
+	case "dc":
+		tmpl = dublinCoreTemplate
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "Unsupported metadata format")
+	}
+	data, err := s.projectMetadata(getProjectName(c), tmpl)
+	if err != nil {
+		return err
+	}
+	return c.Blob(http.StatusOK, "application/xml; charset=UTF-8", data)
+}
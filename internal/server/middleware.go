@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"strings"
 
 	"github.com/gisquick/gisquick-server/internal/application"
 	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/policy"
 	"github.com/gisquick/gisquick-server/internal/server/auth"
 	"github.com/go-redis/redis/v8"
 	"github.com/labstack/echo/v4"
@@ -17,6 +19,10 @@ import (
 func LoginRequiredMiddlewareWithConfig(a *auth.AuthService) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			// request authenticated with API token
+			if c.Get("api_token") != nil {
+				return next(c)
+			}
 			si, err := a.GetSessionInfo(c)
 			if err != nil {
 				return fmt.Errorf("login required middleware: %w", err)
@@ -76,14 +82,8 @@ func ProjectAdminAccessMiddleware(a *auth.AuthService, ps application.ProjectSer
 			if err != nil {
 				return fmt.Errorf("ProjectAdminAccessMiddleware: %w", err)
 			}
-			if username != user.Username && !user.IsSuperuser {
-				settings, err := ps.GetSettings(projectName)
-				if err != nil {
-					return fmt.Errorf("[ProjectAdminAccessMiddleware] reading project settings: %w", err)
-				}
-				if !domain.StringArray(settings.SettingsAuth.AdminUsers).Has(user.Username) {
-					return echo.ErrUnauthorized
-				}
+			if err := checkProjectAdminAccess(ps, user, username, projectName); err != nil {
+				return err
 			}
 			c.Set("project", projectName)
 			return next(c)
@@ -91,6 +91,20 @@ func ProjectAdminAccessMiddleware(a *auth.AuthService, ps application.ProjectSer
 	}
 }
 
+// Checks whether the user is owner or admin user of the project
+func checkProjectAdminAccess(ps application.ProjectService, user domain.User, owner, projectName string) error {
+	if owner != user.Username && !user.IsSuperuser {
+		settings, err := ps.GetSettings(projectName)
+		if err != nil {
+			return fmt.Errorf("[ProjectAdminAccessMiddleware] reading project settings: %w", err)
+		}
+		if !domain.StringArray(settings.SettingsAuth.AdminUsers).Has(user.Username) {
+			return echo.ErrUnauthorized
+		}
+	}
+	return nil
+}
+
 func MiddlewareErrorHandler(middleware echo.MiddlewareFunc, cb func(e error, c echo.Context) error) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -102,7 +116,7 @@ func MiddlewareErrorHandler(middleware echo.MiddlewareFunc, cb func(e error, c e
 	}
 }
 
-func ProjectAccessMiddleware(a *auth.AuthService, ps application.ProjectService, basicAuthRealm string) echo.MiddlewareFunc {
+func ProjectAccessMiddleware(a *auth.AuthService, ps application.ProjectService, p *policy.Policy, hooks *policy.Hooks, basicAuthRealm string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			username := c.Param("user")
@@ -134,12 +148,50 @@ func ProjectAccessMiddleware(a *auth.AuthService, ps application.ProjectService,
 							if err != nil {
 								return fmt.Errorf("[ProjectAccessMiddleware] reading project settings: %w", err)
 							}
-							access = domain.StringArray(settings.Auth.Users).Has(user.Username)
+							access = settings.Auth.HasUser(user)
 						}
 					}
 				}
 			}
 			c.Set("project", projectName)
+			decision, err := evaluateAccessPolicy(c, a, ps, p, policy.TargetProject, projectName, pInfo)
+			if err != nil {
+				return fmt.Errorf("[ProjectAccessMiddleware] evaluating access policy: %w", err)
+			}
+			// access policy can only restrict access granted by the project settings
+			if decision == policy.Deny {
+				return policyDeniedError(c, a)
+			}
+			if hooks.HasRules(policy.HookPostAuth) {
+				settings, err := ps.GetSettings(projectName)
+				if err != nil {
+					return fmt.Errorf("[ProjectAccessMiddleware] reading project settings: %w", err)
+				}
+				vars := map[string]interface{}{"access": map[string]interface{}{"granted": access}}
+				result, err := runRequestHooks(c, a, hooks, policy.HookPostAuth, projectName, pInfo, settings, vars)
+				if err != nil {
+					return fmt.Errorf("[ProjectAccessMiddleware] running request hooks: %w", err)
+				}
+				if result.Decision == policy.Allow {
+					access = true
+				} else if result.Decision == policy.Deny {
+					return hookDeniedError(c, a, result)
+				}
+			}
+			if !access && isCapabilitiesRequest(c) {
+				settings, err := ps.GetSettings(projectName)
+				if err != nil {
+					return fmt.Errorf("[ProjectAccessMiddleware] reading project settings: %w", err)
+				}
+				user, err := a.GetUser(c)
+				if err != nil {
+					return fmt.Errorf("[ProjectAccessMiddleware] getting user: %w", err)
+				}
+				if settings.Auth.CapabilitiesAllowed(user) {
+					access = true
+					c.Set("capabilities_only", true)
+				}
+			}
 			if !access {
 				if basicAuthRealm != "" {
 					c.Response().Header().Set(echo.HeaderWWWAuthenticate, basicAuthRealm)
@@ -151,6 +203,19 @@ func ProjectAccessMiddleware(a *auth.AuthService, ps application.ProjectService,
 	}
 }
 
+// Routes of the service description, which can be accessed with capabilities-only access level
+var capabilitiesRoutes = domain.StringArray{"/api/map/project/:user/:name", "/api/map/ows/:user/:name", "/ows/:user/:name"}
+
+func isCapabilitiesRequest(c echo.Context) bool {
+	if c.Request().Method != http.MethodGet || !capabilitiesRoutes.Has(c.Path()) {
+		return false
+	}
+	if c.Path() == "/api/map/project/:user/:name" {
+		return true
+	}
+	return strings.EqualFold(owsValue(c.Request().URL.Query(), "REQUEST"), "GetCapabilities")
+}
+
 type SessionStore interface {
 	Get(ctx context.Context, sessionid string) (string, error)
 }
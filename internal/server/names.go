@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Names colliding with routes or likely to be confusing in URLs
+var DefaultReservedNames = []string{
+	"api", "admin", "administrator", "root", "system", "ws", "map", "maps", "app", "apps", "user", "users",
+	"project", "projects", "accounts", "account", "auth", "login", "logout", "signup", "settings",
+	"plugins", "static", "media", "offline", "report", "reports", "download", "public", "anonymous",
+}
+
+const (
+	DefaultUsernamePattern    = `^[a-zA-Z0-9][a-zA-Z0-9_.\-]*$`
+	DefaultProjectNamePattern = `^[\p{L}\p{N}][\p{L}\p{N}_.\-]*$`
+)
+
+type NamesConfig struct {
+	// reserved usernames and project names (compared case-insensitively)
+	Reserved          []string
+	UsernameMinLength int
+	UsernameMaxLength int
+	UsernamePattern   *regexp.Regexp
+	// converts new usernames to lower case
+	LowercaseUsernames   bool
+	ProjectNameMaxLength int
+	ProjectNamePattern   *regexp.Regexp
+}
+
+func (c NamesConfig) isReserved(name string) bool {
+	for _, r := range c.Reserved {
+		if strings.EqualFold(r, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validates new username and returns its normalized form
+func (c NamesConfig) NormalizeUsername(username string) (string, error) {
+	username = strings.TrimSpace(username)
+	if c.LowercaseUsernames {
+		username = strings.ToLower(username)
+	}
+	length := utf8.RuneCountInString(username)
+	if length < c.UsernameMinLength {
+		return "", fmt.Errorf("Username must have at least %d characters", c.UsernameMinLength)
+	}
+	if c.UsernameMaxLength > 0 && length > c.UsernameMaxLength {
+		return "", fmt.Errorf("Username can have at most %d characters", c.UsernameMaxLength)
+	}
+	if c.UsernamePattern != nil && !c.UsernamePattern.MatchString(username) {
+		return "", errors.New("Username contains invalid characters")
+	}
+	if c.isReserved(username) {
+		return "", errors.New("Username is reserved")
+	}
+	return username, nil
+}
+
+// Validates name of a new project
+func (c NamesConfig) ValidateProjectName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return errors.New("Invalid project name")
+	}
+	if c.ProjectNameMaxLength > 0 && utf8.RuneCountInString(name) > c.ProjectNameMaxLength {
+		return fmt.Errorf("Project name can have at most %d characters", c.ProjectNameMaxLength)
+	}
+	if c.ProjectNamePattern != nil && !c.ProjectNamePattern.MatchString(name) {
+		return errors.New("Project name contains invalid characters")
+	}
+	if c.isReserved(name) {
+		return errors.New("Project name is reserved")
+	}
+	return nil
+}
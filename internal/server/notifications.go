@@ -15,7 +15,6 @@ import (
 
 func (s *Server) handleSaveNotification(c echo.Context) error {
 	req := c.Request()
-	req.Body = http.MaxBytesReader(c.Response(), req.Body, MaxJSONSize)
 	defer req.Body.Close()
 
 	var notification project.Notification
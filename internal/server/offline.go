@@ -0,0 +1,394 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/security"
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	offlineMaxRasterSize  = 20000 // max width/height of raster data in pixels
+	offlineLinkExpiration = 24 * time.Hour
+)
+
+// OfflineJob describes export of an offline map package (raster tiles in MBTiles
+// and vector layers in GeoPackage), the data are exported by GDAL tools
+type OfflineJob struct {
+	ID            string    `json:"id"`
+	Project       string    `json:"project"`
+	User          string    `json:"user"`
+	Status        string    `json:"status"`
+	Extent        []float64 `json:"extent"`
+	Resolution    float64   `json:"resolution"`
+	RasterLayers  []string  `json:"raster_layers"`
+	VectorLayers  []string  `json:"vector_layers"`
+	Created       time.Time `json:"created"`
+	Finished      time.Time `json:"finished,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	vectorsFields map[string][]string
+	limit         domain.WfsLimit
+}
+
+func (s *Server) offlineJobsDir() jobsDir {
+	return jobsDir(s.Config.OfflineRoot)
+}
+
+func (s *Server) loadOfflineJob(id string) (*OfflineJob, error) {
+	job := new(OfflineJob)
+	if err := s.offlineJobsDir().load(id, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *Server) offlineLinkTokens() *security.TokenGenerator {
+	return security.NewTokenGenerator(s.Config.SecretKey, "offline", offlineLinkExpiration)
+}
+
+func runGdalCommand(ctx context.Context, env []string, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func formatFloats(values ...float64) []string {
+	items := make([]string, len(values))
+	for i, v := range values {
+		items[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return items
+}
+
+func (s *Server) runOfflineJob(ctx context.Context, job *OfflineJob) error {
+	pInfo, err := s.projects.GetProjectInfo(job.Project)
+	if err != nil {
+		return err
+	}
+	var meta domain.QgisMeta
+	if err := s.projects.GetQgisMetadata(job.Project, &meta); err != nil {
+		return fmt.Errorf("parsing qgis meta: %w", err)
+	}
+	settings, err := s.projects.GetSettings(job.Project)
+	if err != nil {
+		return fmt.Errorf("getting project settings: %w", err)
+	}
+	dir := s.offlineJobsDir().path(job.ID)
+	owsURL, err := url.Parse(s.Config.MapserverURL)
+	if err != nil {
+		return err
+	}
+	mapParam := s.owsProjectPath(job.Project, pInfo.QgisFile)
+	// environment of the export tool with HTTP headers of the map server requests. Signature
+	// must be valid for all requests of the tool, so only the given parameters, which are
+	// passed unchanged in all requests, are signed.
+	toolEnv := func(params url.Values, signed []string) []string {
+		header := mapserverSignatureHeaders([]byte(s.Config.MapserverSigningKey), http.MethodGet, params, signed, time.Now().Add(s.Config.OfflineJobTimeout))
+		req := &http.Request{Header: header}
+		s.setPgServiceHeader(req, job.Project)
+		if len(req.Header) == 0 {
+			return nil
+		}
+		var headers []string
+		for k, v := range req.Header {
+			headers = append(headers, fmt.Sprintf("%s: %s", k, v[0]))
+		}
+		return []string{"GDAL_HTTP_HEADERS=" + strings.Join(headers, "\r\n")}
+	}
+	extent := job.Extent
+
+	if len(job.RasterLayers) > 0 {
+		params := url.Values{
+			"MAP":         {mapParam},
+			"SERVICE":     {"WMS"},
+			"VERSION":     {"1.1.1"},
+			"REQUEST":     {"GetMap"},
+			"LAYERS":      {strings.Join(job.RasterLayers, ",")},
+			"SRS":         {meta.Projection},
+			"BBOX":        {strings.Join(formatFloats(extent...), ",")},
+			"FORMAT":      {"image/png"},
+			"TRANSPARENT": {"true"},
+		}
+		owsURL.RawQuery = params.Encode()
+		// BBOX, WIDTH and HEIGHT are set by the WMS driver for each tile
+		env := toolEnv(params, []string{"MAP", "SERVICE", "VERSION", "REQUEST", "LAYERS", "SRS", "FORMAT", "TRANSPARENT"})
+		output := filepath.Join(dir, "map.mbtiles")
+		args := []string{"-of", "MBTILES", "-co", "TILE_FORMAT=PNG", "-tr"}
+		args = append(args, formatFloats(job.Resolution, job.Resolution)...)
+		args = append(args, "-projwin")
+		args = append(args, formatFloats(extent[0], extent[3], extent[2], extent[1])...)
+		args = append(args, "WMS:"+owsURL.String(), output)
+		if err := runGdalCommand(ctx, env, "gdal_translate", args...); err != nil {
+			return err
+		}
+		if err := runGdalCommand(ctx, env, "gdaladdo", "-r", "average", output); err != nil {
+			return err
+		}
+	}
+	if len(job.VectorLayers) > 0 {
+		params := url.Values{
+			"MAP":     {mapParam},
+			"SERVICE": {"WFS"},
+			"VERSION": {"1.1.0"},
+		}
+		owsURL.RawQuery = params.Encode()
+		// WFS driver makes GetCapabilities, DescribeFeatureType and GetFeature requests
+		env := toolEnv(params, []string{"MAP", "SERVICE", "VERSION"})
+		output := filepath.Join(dir, "data.gpkg")
+		for i, layer := range job.VectorLayers {
+			args := []string{"-f", "GPKG", "-spat"}
+			args = append(args, formatFloats(extent...)...)
+			args = append(args, "-spat_srs", meta.Projection)
+			if i > 0 {
+				args = append(args, "-update")
+			}
+			if job.limit.MaxFeatures > 0 {
+				args = append(args, "-limit", strconv.Itoa(job.limit.MaxFeatures))
+			}
+			if fields, ok := job.vectorsFields[layer]; ok {
+				args = append(args, "-select", strings.Join(fields, ","))
+			}
+			args = append(args, output, "WFS:"+owsURL.String(), layer)
+			if err := runGdalCommand(ctx, env, "ogr2ogr", args...); err != nil {
+				return err
+			}
+		}
+	}
+	return s.createOfflinePackage(dir, licenseNotice(settings))
+}
+
+// Creates zip package from exported data, license notice (if any) is included as LICENSE.txt
+func (s *Server) createOfflinePackage(dir, notice string) error {
+	f, err := os.Create(filepath.Join(dir, "package.zip"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := s.newZipWriter(f)
+	for _, name := range []string{"map.mbtiles", "data.gpkg"} {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if err := s.addZipFile(w, path, name, info); err != nil {
+			return err
+		}
+		os.Remove(path)
+	}
+	if notice != "" {
+		lw, err := w.Create("LICENSE.txt")
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(lw, notice+"\n"); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+func (s *Server) processOfflineJob(job *OfflineJob) {
+	run := func(ctx context.Context) error {
+		return s.runOfflineJob(ctx, job)
+	}
+	stop := s.offlineJobsDir().keepAlive(job.ID)
+	defer stop()
+	err := s.offlineJobs.Run(run, func(status string, err error) {
+		job.Status = status
+		if status != JobRunning {
+			job.Finished = time.Now().UTC()
+		}
+		if err != nil {
+			job.Error = "Export failed"
+		}
+		if err := s.offlineJobsDir().save(job.ID, job); err != nil {
+			s.log.Errorw("saving offline job", "id", job.ID, zap.Error(err))
+		}
+	})
+	if err != nil {
+		s.log.Errorw("offline package export", "project", job.Project, "id", job.ID, zap.Error(err))
+	}
+}
+
+// Attributes of the vector layer viewable by the user (exported to the offline package)
+func offlineLayerFields(settings domain.ProjectSettings, user domain.User, layerID string) []string {
+	var fields []string
+	for name, aflags := range settings.UserLayerAttrinutesFlags(user, layerID) {
+		if name != "geometry" && aflags.Has("view") {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func (s *Server) handleCreateOfflinePackage() func(echo.Context) error {
+	type Form struct {
+		Extent     []float64 `json:"extent"`
+		Resolution float64   `json:"resolution"`
+		Layers     []string  `json:"layers"`
+	}
+	return func(c echo.Context) error {
+		projectName := getProjectName(c)
+		form := new(Form)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		if len(form.Extent) != 4 || form.Extent[0] >= form.Extent[2] || form.Extent[1] >= form.Extent[3] {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid extent")
+		}
+		if form.Resolution <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid resolution")
+		}
+		width := (form.Extent[2] - form.Extent[0]) / form.Resolution
+		height := (form.Extent[3] - form.Extent[1]) / form.Resolution
+		if width > offlineMaxRasterSize || height > offlineMaxRasterSize {
+			return echo.NewHTTPError(http.StatusBadRequest, "Requested area is too large")
+		}
+
+		settings, err := s.projects.GetSettings(projectName)
+		if err != nil {
+			return fmt.Errorf("getting project settings: %w", err)
+		}
+		var meta domain.QgisMeta
+		if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+			return fmt.Errorf("parsing qgis meta: %w", err)
+		}
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		userRoles := domain.FilterUserRoles(user, settings.Auth.Roles)
+		hasRoles := len(settings.Auth.Roles) > 0
+
+		job := &OfflineJob{
+			Project:       projectName,
+			User:          user.Username,
+			Status:        JobPending,
+			Extent:        form.Extent,
+			Resolution:    form.Resolution,
+			Created:       time.Now().UTC(),
+			vectorsFields: make(map[string][]string),
+			limit:         userWfsLimit(settings, user),
+		}
+		for _, id := range meta.LayersOrder {
+			lmeta := meta.Layers[id]
+			lset := settings.Layers[id]
+			if lset.Flags.Has("excluded") || !lset.Roles.Allows(user, userRoles) {
+				continue
+			}
+			if len(form.Layers) > 0 && !domain.StringArray(form.Layers).Has(lmeta.Name) {
+				continue
+			}
+			flags := domain.Flags{"view", "query"}
+			if hasRoles {
+				flags = settings.UserLayerPermissionsFlags(user, id)
+			}
+			if !flags.Has("view") {
+				continue
+			}
+			job.RasterLayers = append(job.RasterLayers, lmeta.Name)
+			if lmeta.Type == "VectorLayer" && lmeta.Flags.Has("query") && !lset.Flags.Has("hidden") && flags.Has("query") {
+				typeName := strings.ReplaceAll(lmeta.Name, " ", "_")
+				if hasRoles {
+					fields := offlineLayerFields(settings, user, id)
+					if len(fields) == 0 {
+						// no viewable attributes, layer is exported only as a part of the map tiles
+						continue
+					}
+					job.vectorsFields[typeName] = fields
+				}
+				job.VectorLayers = append(job.VectorLayers, typeName)
+			}
+		}
+		if len(job.RasterLayers) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "No layers to export")
+		}
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		job.ID = id.String()
+		if err := s.offlineJobsDir().create(job.ID); err != nil {
+			return fmt.Errorf("creating offline job directory: %w", err)
+		}
+		if err := s.offlineJobsDir().save(job.ID, job); err != nil {
+			return fmt.Errorf("saving offline job: %w", err)
+		}
+		go s.processOfflineJob(job)
+		return c.JSON(http.StatusAccepted, job)
+	}
+}
+
+func (s *Server) handleGetOfflinePackage(c echo.Context) error {
+	type Payload struct {
+		*OfflineJob
+		DownloadURL string `json:"download_url,omitempty"`
+	}
+	projectName := getProjectName(c)
+	job, err := s.loadOfflineJob(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return echo.ErrNotFound
+		}
+		return fmt.Errorf("loading offline job: %w", err)
+	}
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	if job.Project != projectName || job.User != user.Username {
+		return echo.ErrNotFound
+	}
+	data := Payload{OfflineJob: job}
+	if job.Status == JobDone {
+		token, err := s.offlineLinkTokens().GenerateToken(job.ID)
+		if err != nil {
+			return fmt.Errorf("generating download token: %w", err)
+		}
+		data.DownloadURL = fmt.Sprintf("/api/offline/download/%s?token=%s", job.ID, token)
+	}
+	return c.JSON(http.StatusOK, data)
+}
+
+func (s *Server) handleDownloadOfflinePackage(c echo.Context) error {
+	id := c.Param("id")
+	if err := s.offlineLinkTokens().CheckToken(c.QueryParam("token"), id); err != nil {
+		return echo.ErrForbidden
+	}
+	job, err := s.loadOfflineJob(id)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return echo.ErrNotFound
+		}
+		return fmt.Errorf("loading offline job: %w", err)
+	}
+	if job.Status != JobDone {
+		return echo.ErrNotFound
+	}
+	name := fmt.Sprintf("%s.zip", strings.ReplaceAll(job.Project, "/", "_"))
+	return c.Attachment(filepath.Join(s.offlineJobsDir().path(id), "package.zip"), name)
+}
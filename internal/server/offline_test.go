@@ -0,0 +1,40 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+func TestOfflineLayerFields(t *testing.T) {
+	settings := domain.ProjectSettings{
+		Layers: map[string]domain.LayerSettings{
+			"parcels_1": {},
+			"owners_2":  {},
+		},
+		Auth: domain.Authentication{
+			Roles: []domain.ProjectRole{
+				{
+					Auth:  "users",
+					Name:  "officers",
+					Users: []string{"officer"},
+					Permissions: domain.RolePermissions{
+						Layers: map[string]domain.Flags{"parcels_1": {"view", "query"}, "owners_2": {"view", "query"}},
+						Attributes: map[string]map[string]domain.Flags{
+							"parcels_1": {"number": {"view"}, "area": {"view", "edit"}, "note": {}, "geometry": {"view"}},
+							"owners_2":  {"name": {}, "geometry": {"view"}},
+						},
+					},
+				},
+			},
+		},
+	}
+	user := domain.User{Username: "officer", IsAuthenticated: true}
+	if fields := offlineLayerFields(settings, user, "parcels_1"); !reflect.DeepEqual(fields, []string{"area", "number"}) {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+	if fields := offlineLayerFields(settings, user, "owners_2"); len(fields) != 0 {
+		t.Errorf("layer without viewable attributes: %v", fields)
+	}
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const oidcStateCookie = "gq_oidc"
+
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Accepts only local paths as redirect targets after login
+func localRedirectPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.Contains(next, `\`) {
+		return "/"
+	}
+	return next
+}
+
+const (
+	oidcModeLogin = "login"
+	oidcModeLink  = "link"
+)
+
+// Redirects to the identity provider login page. State, nonce, target path (next) and the mode
+// (login or linking of the identity with the signed in account) are stored in the cookie.
+func (s *Server) startOIDCLogin(c echo.Context, mode string) error {
+	state, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	nonce, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	loginURL, err := s.Config.OIDC.AuthCodeURL(c.Request().Context(), state, nonce)
+	if err != nil {
+		s.log.Errorw("openid connect login", zap.Error(err))
+		return echo.NewHTTPError(http.StatusBadGateway, "Identity provider is not available")
+	}
+	next := localRedirectPath(c.QueryParam("next"))
+	c.SetCookie(&http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    strings.Join([]string{state, nonce, url.QueryEscape(next), mode}, "|"),
+		Path:     "/api/auth/oidc/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return c.Redirect(http.StatusFound, loginURL)
+}
+
+func (s *Server) handleOIDCLogin(c echo.Context) error {
+	return s.startOIDCLogin(c, oidcModeLogin)
+}
+
+// Links identity in the identity provider with the account of the signed in user
+func (s *Server) handleOIDCLink(c echo.Context) error {
+	return s.startOIDCLogin(c, oidcModeLink)
+}
+
+func (s *Server) handleOIDCCallback(c echo.Context) error {
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing login state")
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/api/auth/oidc/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	parts := strings.SplitN(cookie.Value, "|", 4)
+	if len(parts) != 4 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(c.QueryParam("state"))) != 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid login state")
+	}
+	if errCode := c.QueryParam("error"); errCode != "" {
+		s.log.Warnw("openid connect login", "error", errCode, "description", c.QueryParam("error_description"))
+		return echo.NewHTTPError(http.StatusUnauthorized, "Login failed")
+	}
+	claims, err := s.Config.OIDC.Exchange(c.Request().Context(), c.QueryParam("code"), parts[1])
+	if err != nil {
+		s.log.Errorw("openid connect token exchange", zap.Error(err))
+		return echo.NewHTTPError(http.StatusUnauthorized, "Login failed")
+	}
+	next, err := url.QueryUnescape(parts[2])
+	if err != nil {
+		next = "/"
+	}
+	if parts[3] == oidcModeLink {
+		// identity is linked only with the account of the user signed in this browser
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		if !user.IsAuthenticated {
+			return echo.NewHTTPError(http.StatusUnauthorized, "Sign in to link the identity")
+		}
+		if err := s.Config.OIDC.LinkIdentity(claims, user.Username); err != nil {
+			if errors.Is(err, domain.ErrIdentityExists) {
+				return echo.NewHTTPError(http.StatusConflict, err.Error())
+			}
+			s.log.Errorw("openid connect link", "subject", claims.Subject, zap.Error(err))
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to link the identity")
+		}
+		s.log.Infow("openid connect identity linked", "username", user.Username, "subject", claims.Subject)
+		return c.Redirect(http.StatusFound, localRedirectPath(next))
+	}
+	account, err := s.Config.OIDC.Account(claims)
+	if err != nil {
+		if errors.Is(err, auth.ErrAccountInactive) || errors.Is(err, auth.ErrIdentityNotLinked) {
+			return loginError(c, err)
+		}
+		s.log.Errorw("openid connect account", "subject", claims.Subject, zap.Error(err))
+		return echo.NewHTTPError(http.StatusForbidden, "Failed to get user account")
+	}
+	if err := s.auth.LoginUser(c, account); err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, localRedirectPath(next))
+}
+
+func identityError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrIdentityNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, domain.ErrIdentityExists):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, domain.ErrAccountNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	return err
+}
+
+// Identities of the signed in user
+func (s *Server) handleGetIdentities(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	identities, err := s.Config.OIDC.Identities(user.Username)
+	if err != nil {
+		return fmt.Errorf("listing identities: %w", err)
+	}
+	return c.JSON(http.StatusOK, identities)
+}
+
+func (s *Server) handleUnlinkIdentity(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	account, err := s.accountsService.Repository.GetByUsername(user.Username)
+	if err != nil {
+		return fmt.Errorf("getting account: %w", err)
+	}
+	if len(account.Password) == 0 {
+		identities, err := s.Config.OIDC.Identities(user.Username)
+		if err != nil {
+			return fmt.Errorf("listing identities: %w", err)
+		}
+		if len(identities) < 2 {
+			return echo.NewHTTPError(http.StatusConflict, "Set a password before unlinking the last identity")
+		}
+	}
+	if err := s.Config.OIDC.UnlinkSubject(c.Param("subject"), user.Username); err != nil {
+		return identityError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) handleAdminGetIdentities(c echo.Context) error {
+	identities, err := s.Config.OIDC.Identities(c.Param("user"))
+	if err != nil {
+		return fmt.Errorf("listing identities: %w", err)
+	}
+	return c.JSON(http.StatusOK, identities)
+}
+
+func (s *Server) handleAdminLinkIdentity() func(echo.Context) error {
+	type LinkForm struct {
+		Subject string `json:"subject" validate:"required,max=255"`
+	}
+	var validate = validator.New()
+	return func(c echo.Context) error {
+		form := new(LinkForm)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		if err := validate.Struct(form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		username := c.Param("user")
+		if err := s.Config.OIDC.LinkSubject(form.Subject, username); err != nil {
+			return identityError(err)
+		}
+		s.log.Infow("openid connect identity linked by admin", "username", username, "subject", form.Subject)
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func (s *Server) handleAdminUnlinkIdentity(c echo.Context) error {
+	if err := s.Config.OIDC.UnlinkSubject(c.Param("subject"), c.Param("user")); err != nil {
+		return identityError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
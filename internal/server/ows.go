@@ -16,6 +16,7 @@ import (
 	"strings"
 
 	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/policy"
 	"github.com/labstack/echo/v4"
 )
 
@@ -26,7 +27,8 @@ type GetFeature struct {
 
 type Query struct {
 	XMLName    xml.Name       `xml:"Query"`
-	TypeName   string         `xml:"typeName,attr"`
+	TypeName   string         `xml:"typeName,attr,omitempty"`
+	TypeNames  string         `xml:"typeNames,attr,omitempty"` // WFS 2.0
 	Properties []PropertyName `xml:"ogc:PropertyName"`
 	Contents   []AnyTag       `xml:",any"`
 }
@@ -41,42 +43,8 @@ type AnyTag struct {
 	Content string `xml:",innerxml"`
 }
 
-type Transaction struct {
-	XMLName xml.Name `xml:"Transaction"`
-	Updates []Update `xml:"Update"`
-	Inserts []Insert `xml:"Insert"`
-	Deletes []Delete `xml:"Delete"`
-}
-
-type Update struct {
-	XMLName    xml.Name   `xml:"Update"`
-	TypeName   string     `xml:"typeName,attr"`
-	Properties []Property `xml:"Property"`
-}
-
-type InsertObject struct {
-	XMLName    xml.Name
-	Properties []InsertProperty `xml:",any"`
-}
-type InsertProperty struct {
-	XMLName xml.Name
-	// Content string `xml:",innerxml"`
-}
-
-type Insert struct {
-	XMLName xml.Name       `xml:"Insert"`
-	Objects []InsertObject `xml:",any"`
-}
-
-type Delete struct {
-	XMLName  xml.Name `xml:"Delete"`
-	TypeName string   `xml:"typeName,attr"`
-}
-
-type Property struct {
-	XMLName xml.Name `xml:"Property"`
-	Name    string   `xml:"Name"`
-	Value   string   `xml:"Value"`
+type FeatureId struct {
+	Fid string `xml:"fid,attr"`
 }
 
 type OwsRequestParams struct {
@@ -86,12 +54,6 @@ type OwsRequestParams struct {
 	Layers  string `query:"layers"`
 }
 
-type OwsGetFeatureRequestParams struct {
-	TypeName     string `query:"TYPENAME"`
-	PropertyName string `query:"PROPERTYNAME"`
-	FeatureID    string `query:"FEATUREID"`
-}
-
 func parseTypeName(typeName string) (string, error) {
 	parts := strings.Split(typeName, ":")
 	if len(parts) != 2 {
@@ -109,6 +71,32 @@ func replaceQueryParam(query url.Values, name, value string) {
 	query.Set(name, value)
 }
 
+// Returns path of the project file as seen by the map server (MAP parameter)
+func (s *Server) owsProjectPath(projectName, qgisFile string) string {
+	return filepath.Join(s.Config.MapserverProjectsRoot, projectName, qgisFile)
+}
+
+// Stable OWS URL of the project advertised to GIS clients and in metadata records
+func (s *Server) projectOwsURL(projectName string) string {
+	if s.Config.PublicOWS {
+		return fmt.Sprintf("%s/ows/%s", strings.TrimSuffix(s.Config.SiteURL, "/"), projectName)
+	}
+	return fmt.Sprintf("%s/api/map/ows/%s", strings.TrimSuffix(s.Config.SiteURL, "/"), projectName)
+}
+
+// Rejects OWS requests which would modify data or lock features (public read-only endpoint)
+func ReadOnlyOWSMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			request := owsValue(c.Request().URL.Query(), "REQUEST")
+			if strings.EqualFold(request, "Transaction") || strings.EqualFold(request, "LockFeature") || strings.EqualFold(request, "GetFeatureWithLock") {
+				return echo.NewHTTPError(http.StatusForbidden, "Service is read-only")
+			}
+			return next(c)
+		}
+	}
+}
+
 func (s *Server) handleMapOws() func(c echo.Context) error {
 	/*
 		director := func(req *http.Request) {
@@ -134,11 +122,11 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 		req.URL.Scheme = target.Scheme
 		req.URL.Host = target.Host
 
+		s.scrubProxyHeaders(req.Header, internalProxyHeaders...)
 		if _, ok := req.Header["User-Agent"]; !ok {
 			// explicitly disable User-Agent so it's not set to default value
 			req.Header.Set("User-Agent", "")
 		}
-		req.Header.Del("Cookie")
 	}
 	rewriteGetCapabilities := func(resp *http.Response) (err error) {
 		body, err := ioutil.ReadAll(resp.Body)
@@ -149,6 +137,11 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 		if err != nil {
 			return err
 		}
+		if perms, ok := resp.Request.Context().Value(layersPermissionsKey{}).(*layersPermissions); ok {
+			if body, err = filterCapabilitiesLayers(body, perms); err != nil {
+				return err
+			}
+		}
 		// original url is still in xsi:schemaLocation
 		// regexp.MustCompile(`xsi:schemaLocation="(.)+"`)
 
@@ -172,6 +165,9 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 				doc = strings.ReplaceAll(doc, match, replaced[match])
 			}
 		}
+		if notice, ok := resp.Request.Context().Value(licenseNoticeKey{}).(string); ok {
+			doc = injectAccessConstraints(doc, notice)
+		}
 		newBody := []byte(doc)
 		resp.Body = ioutil.NopCloser(bytes.NewReader(newBody))
 		resp.ContentLength = int64(len(newBody))
@@ -179,14 +175,42 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 		return nil
 	}
 	reverseProxy := &httputil.ReverseProxy{Director: director}
+	reverseProxy.ModifyResponse = func(resp *http.Response) error {
+		s.trackMapserverResponse(resp)
+		if err := s.owsExceptionsInterceptor(resp); err != nil {
+			return err
+		}
+		if err := s.wfsTransactionInterceptor(resp); err != nil {
+			return err
+		}
+		return limitResponseSize(resp)
+	}
+	reverseProxy.ErrorHandler = s.proxyErrorHandler("map_ows")
+	reverseProxy.Transport = s.mapserver.Transport
+	s.configureProxyStreaming(reverseProxy)
 	capabilitiesProxy := &httputil.ReverseProxy{Director: director}
-	capabilitiesProxy.ModifyResponse = rewriteGetCapabilities
+	capabilitiesProxy.ErrorHandler = s.proxyErrorHandler("map_ows")
+	capabilitiesProxy.Transport = s.mapserver.Transport
+	capabilitiesProxy.ModifyResponse = func(resp *http.Response) error {
+		s.trackMapserverResponse(resp)
+		if isExceptionResponse(resp) {
+			return s.owsExceptionsInterceptor(resp)
+		}
+		return rewriteGetCapabilities(resp)
+	}
 
 	return func(c echo.Context) error {
-		params := new(OwsRequestParams)
-		if err := (&echo.DefaultBinder{}).BindQueryParams(c, params); err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, "Invalid query parameters")
+		req := c.Request()
+		var xmlReq *owsXmlRequest
+		if req.Method == http.MethodPost {
+			query := req.URL.Query()
+			var err error
+			if xmlReq, err = readOwsPostRequest(req, query); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body").SetInternal(err)
+			}
+			req.URL.RawQuery = query.Encode()
 		}
+		params := parseOwsRequestParams(req.URL.Query())
 
 		projectName := getProjectName(c)
 		pInfo, err := s.projects.GetProjectInfo(projectName)
@@ -197,45 +221,91 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 			return fmt.Errorf("reading project info: %w", err)
 		}
 
-		req := c.Request()
+		decision, err := evaluateAccessPolicy(c, s.auth, s.projects, s.Config.AccessPolicy, policy.TargetOWS, projectName, pInfo)
+		if err != nil {
+			return fmt.Errorf("evaluating access policy: %w", err)
+		}
+		if decision == policy.Deny {
+			return policyDeniedError(c, s.auth)
+		}
+
 		// Set MAP parameter
-		owsProject := filepath.Join("/publish", projectName, pInfo.QgisFile)
+		owsProject := s.owsProjectPath(projectName, pInfo.QgisFile)
 		query := req.URL.Query()
 		query.Set("MAP", owsProject)
+		s.setPgServiceHeader(req, projectName)
+
+		settings, err := s.projects.GetSettings(projectName)
+		if err != nil {
+			return fmt.Errorf("getting project settings: %w", err)
+		}
+		if s.Config.Hooks.HasRules(policy.HookPreOWS) {
+			result, err := runRequestHooks(c, s.auth, s.Config.Hooks, policy.HookPreOWS, projectName, pInfo, settings, nil)
+			if err != nil {
+				return fmt.Errorf("running request hooks: %w", err)
+			}
+			if result.Decision == policy.Deny {
+				return hookDeniedError(c, s.auth, result)
+			}
+			if result.Modified() {
+				applyHookParams(query, result)
+				req.URL.RawQuery = query.Encode()
+				params = parseOwsRequestParams(query)
+			}
+		}
+		if capabilitiesOnly, _ := c.Get("capabilities_only").(bool); capabilitiesOnly && !strings.EqualFold(params.Request, "GetCapabilities") {
+			return echo.ErrForbidden
+		}
+		if !serviceAllowed(settings, params.Service) {
+			return echo.NewHTTPError(http.StatusForbidden, "Service is not allowed")
+		}
 
-		if params.Service == "WMS" && strings.EqualFold(params.Request, "GetCapabilities") {
+		if (params.Service == "WMS" || params.Service == "WFS") && strings.EqualFold(params.Request, "GetCapabilities") {
 			req.Header.Set("X-Ows-Url", req.URL.Path)
 			req.URL.RawQuery = query.Encode()
-			capabilitiesProxy.ServeHTTP(c.Response(), req)
+			var perms *layersPermissions
+			if hasLayersRoles(settings) {
+				user, err := s.auth.GetUser(c)
+				if err != nil {
+					return err
+				}
+				if perms, err = s.userLayersPermissions(projectName, user, settings); err != nil {
+					return err
+				}
+			}
+			req = withLayersPermissions(req, perms)
+			capabilitiesProxy.ServeHTTP(c.Response(), withLicenseNotice(req, licenseNotice(settings)))
+			s.trackProjectOwsResponse(c, projectName)
 			return nil
 		}
-
-		settings, err := s.projects.GetSettings(projectName)
-		if err != nil {
-			return fmt.Errorf("getting project settings: %w", err)
+		var transaction *Transaction
+		if params.Service == "WFS" && strings.EqualFold(params.Request, "Transaction") {
+			if xmlReq == nil || xmlReq.Transaction == nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "WFS transaction must be sent as XML document")
+			}
+			transaction = xmlReq.Transaction
+			// parsed operations are included in the project logs
+			c.Set("wfs_transaction", transaction)
 		}
-		if len(settings.Auth.Roles) > 0 {
+		var perms *layersPermissions
+		if len(settings.Auth.Roles) > 0 || hasLayersRoles(settings) {
 			user, err := s.auth.GetUser(c)
-			layersPermFlags := make(map[string]domain.Flags)
-			layersData, err := s.projects.GetLayersData(projectName)
 			if err != nil {
-				return fmt.Errorf("getting layer data: %w", err)
+				return err
 			}
-			getLayerId := func(typeName string) string {
-				parts := strings.Split(typeName, ":")
-				lname := parts[len(parts)-1]
-				id, _ := layersData.LayerNameToID[lname]
-				return id
+			perms, err = s.userLayersPermissions(projectName, user, settings)
+			if err != nil {
+				return err
 			}
-			getLayerPermissions := func(typeName string) domain.Flags {
-				id := getLayerId(typeName)
-				flags, ok := layersPermFlags[id]
-				if !ok {
-					flags = settings.UserLayerPermissionsFlags(user, id)
-					layersPermFlags[id] = flags
+			// layers restricted to other roles
+			for _, name := range owsRequestLayers(query, xmlReq) {
+				if !perms.Allowed(name) {
+					return echo.ErrForbidden
 				}
-				return flags
 			}
+		}
+		if len(settings.Auth.Roles) > 0 {
+			getLayerPermissions := perms.Layer
 			if params.Service == "WMS" && strings.EqualFold(params.Request, "GetMap") && params.Layers != "" {
 				for _, lname := range strings.Split(params.Layers, ",") {
 					if !getLayerPermissions(lname).Has("view") {
@@ -244,59 +314,11 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 				}
 			}
 			if params.Service == "WFS" {
-				layersAttrsFlags := make(map[string]map[string]domain.Flags)
-				getLayerAttributesFlags := func(typeName string) map[string]domain.Flags {
-					id := getLayerId(typeName)
-					attrsFlags, ok := layersAttrsFlags[id]
-					if !ok {
-						attrsFlags = settings.UserLayerAttrinutesFlags(user, id)
-						geomAttrs, ok := attrsFlags["geometry"]
-						if ok {
-							attrsFlags["geometry"] = geomAttrs.Union([]string{"view"})
-						} else {
-							// for backward compatibility
-							attrsFlags["geometry"] = []string{"view", "edit"}
-						}
-					}
-					return attrsFlags
-				}
+				getLayerAttributesFlags := perms.Attributes
 
-				if params.Request == "" && req.Method == "POST" { // GetFeature Insert/Update/Delete
-					var wfsTransaction Transaction
-					// read all bytes from content body and create new stream using it.
-					bodyBytes, _ := ioutil.ReadAll(req.Body)
-					req.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
-					if err := xml.Unmarshal(bodyBytes, &wfsTransaction); err != nil {
-						return err
-					}
-					for _, u := range wfsTransaction.Updates {
-						if !getLayerPermissions(u.TypeName).Has("update") {
-							return echo.ErrForbidden
-						}
-						attrsFlags := getLayerAttributesFlags(u.TypeName)
-						for _, p := range u.Properties {
-							if !attrsFlags[p.Name].Has("edit") {
-								return echo.ErrForbidden
-							}
-						}
-					}
-					for _, i := range wfsTransaction.Inserts {
-						for _, o := range i.Objects {
-							if !getLayerPermissions(o.XMLName.Local).Has("insert") {
-								return echo.ErrForbidden
-							}
-							attrsFlags := getLayerAttributesFlags(o.XMLName.Local)
-							for _, p := range o.Properties {
-								if !attrsFlags[p.XMLName.Local].Has("edit") {
-									return echo.ErrForbidden
-								}
-							}
-						}
-					}
-					for _, d := range wfsTransaction.Deletes {
-						if !getLayerPermissions(d.TypeName).Has("delete") {
-							return echo.ErrForbidden
-						}
+				if transaction != nil {
+					if !checkTransactionPermissions(transaction, perms) {
+						return echo.ErrForbidden
 					}
 				} else if strings.EqualFold(params.Request, "GetFeature") {
 					if req.Method == "POST" {
@@ -307,10 +329,14 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 						}
 						bodyModified := false
 						for i, q := range getFeature.Query {
-							if !getLayerPermissions(q.TypeName).Has("query") {
+							typeName := q.TypeName
+							if typeName == "" {
+								typeName = q.TypeNames
+							}
+							if !getLayerPermissions(typeName).Has("query") {
 								return echo.ErrForbidden
 							}
-							attrsFlags := getLayerAttributesFlags(q.TypeName)
+							attrsFlags := getLayerAttributesFlags(typeName)
 							// Note: at least one valid non-geometry field must be specified, otherwise qgis server will return all fields
 							if len(q.Properties) > 0 {
 								for _, p := range q.Properties {
@@ -349,51 +375,84 @@ func (s *Server) handleMapOws() func(c echo.Context) error {
 							req.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
 						}
 					} else {
-						getFeatureParams := new(OwsGetFeatureRequestParams)
-						if err := (&echo.DefaultBinder{}).BindQueryParams(c, getFeatureParams); err != nil {
-							return echo.NewHTTPError(http.StatusBadRequest, "Invalid GetFeature query parameters")
-						}
-						// note: no support for multiple layers
-						layername := getFeatureParams.TypeName
-						if layername == "" {
-							layername = strings.SplitN(getFeatureParams.FeatureID, ".", 2)[0]
+						typeNames, err := wfsGetFeatureLayers(query)
+						if err != nil {
+							return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 						}
-						if layername == "" {
+						if len(typeNames) == 0 {
 							return echo.ErrBadRequest
 						}
-						if !getLayerPermissions(layername).Has("query") {
-							return echo.ErrForbidden
+						attrsFlags := make([]map[string]domain.Flags, len(typeNames))
+						for i, typeName := range typeNames {
+							if !getLayerPermissions(typeName).Has("query") {
+								return echo.ErrForbidden
+							}
+							attrsFlags[i] = getLayerAttributesFlags(typeName)
+						}
+						propertyName, err := owsUniqueValue(query, "PROPERTYNAME")
+						if err != nil {
+							return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 						}
-						attrsFlags := getLayerAttributesFlags(layername)
-						if getFeatureParams.PropertyName != "" {
-							properties := strings.Split(getFeatureParams.PropertyName, ",")
-							for _, pName := range properties {
-								aFlags, exist := attrsFlags[pName]
-								if !exist || !aFlags.Has("view") {
+						if propertyName != "" {
+							groups, err := wfsPropertyNames(propertyName, len(typeNames))
+							if err != nil {
+								return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+							}
+							for i, properties := range groups {
+								if !propertiesAllowed(attrsFlags[i], properties) {
 									return echo.ErrForbidden
 								}
 							}
-							if len(properties) == 1 && properties[0] == "geometry" {
-								return echo.ErrForbidden
-							}
 						} else {
-							var properties []string
-							for name, flags := range attrsFlags {
-								if flags.Has("view") {
-									properties = append(properties, name)
+							groups := make([][]string, len(typeNames))
+							for i := range typeNames {
+								groups[i] = viewableProperties(attrsFlags[i])
+								if groups[i] == nil {
+									return echo.ErrForbidden
 								}
 							}
-							if len(properties) == 0 || (len(properties) == 1 && properties[0] == "geometry") {
-								return echo.ErrForbidden
-							}
-							replaceQueryParam(query, "PROPERTYNAME", strings.Join(properties, ","))
+							replaceQueryParam(query, "PROPERTYNAME", formatPropertyNames(groups))
 						}
 					}
 				}
 			}
 		}
+		if params.Service == "WMS" && strings.EqualFold(params.Request, "GetMap") && params.Layers != "" {
+			if err := s.injectLayerStyles(projectName, query); err != nil {
+				return err
+			}
+		}
+		if params.Service == "WFS" && strings.EqualFold(params.Request, "GetFeature") {
+			if err := negotiateWfsOutputFormat(req, query); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid GetFeature request").SetInternal(err)
+			}
+		}
+		if transaction != nil {
+			req = s.withWfsTransaction(c, req, projectName, *transaction)
+		}
+		// anonymous user is returned on authentication error
+		user, _ := s.auth.GetUser(c)
+		var responseLimit int64
+		if !user.IsAuthenticated {
+			responseLimit = s.Config.Proxy.AnonymousMaxResponse
+		}
+		if settings.WfsLimits != nil && params.Service == "WFS" && strings.EqualFold(params.Request, "GetFeature") {
+			limit := userWfsLimit(settings, user)
+			if limit.MaxFeatures > 0 {
+				if err := limitWfsFeatures(req, query, limit.MaxFeatures); err != nil {
+					return echo.NewHTTPError(http.StatusBadRequest, "Invalid GetFeature request").SetInternal(err)
+				}
+			}
+			if limit.MaxResponseSize > 0 && (responseLimit == 0 || limit.MaxResponseSize < responseLimit) {
+				responseLimit = limit.MaxResponseSize
+			}
+		}
+		if responseLimit > 0 {
+			req = withResponseLimit(req, responseLimit)
+		}
 		req.URL.RawQuery = query.Encode()
 		reverseProxy.ServeHTTP(c.Response(), req)
+		s.trackProjectOwsResponse(c, projectName)
 		return nil
 	}
 }
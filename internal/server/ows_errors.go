@@ -0,0 +1,165 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var owsExceptionsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ows_exceptions_total",
+		Help: "Counts OWS service exceptions returned by the map server.",
+	},
+	[]string{"service", "request", "code"},
+)
+
+func init() {
+	prometheus.MustRegister(owsExceptionsCounter)
+}
+
+// Values of the metrics labels are taken from the client's request, so they are restricted
+// to the known values to keep the number of time series bounded
+var (
+	owsMetricsServices = []string{"WMS", "WFS", "WCS", "WMTS"}
+	owsMetricsRequests = []string{
+		"GetCapabilities", "GetProjectSettings", "GetMap", "GetFeatureInfo", "GetLegendGraphic", "GetPrint",
+		"GetStyles", "DescribeLayer", "GetFeature", "DescribeFeatureType", "Transaction", "GetCoverage",
+		"DescribeCoverage", "GetTile",
+	}
+	owsMetricsCodes = []string{
+		"InvalidFormat", "InvalidCRS", "InvalidSRS", "LayerNotDefined", "StyleNotDefined", "LayerNotQueryable",
+		"InvalidPoint", "CurrentUpdateSequence", "InvalidUpdateSequence", "MissingDimensionValue",
+		"InvalidDimensionValue", "OperationNotSupported", "MissingParameterValue", "InvalidParameterValue",
+		"VersionNegotiationFailed", "NoApplicableCode", "OptionNotSupported", "TileOutOfRange",
+		"RequestNotWellFormed", "Security",
+	}
+)
+
+// Returns known label value (in canonical form) or "other"
+func metricsLabel(value string, known []string) string {
+	if value == "" {
+		return "none"
+	}
+	for _, v := range known {
+		if strings.EqualFold(v, value) {
+			return v
+		}
+	}
+	return "other"
+}
+
+// Exception reports (WMS ServiceExceptionReport and OWS ExceptionReport formats)
+type serviceExceptionReport struct {
+	Exceptions    []serviceException `xml:"ServiceException"`
+	OwsExceptions []owsException     `xml:"Exception"`
+}
+
+type serviceException struct {
+	Code    string `xml:"code,attr"`
+	Locator string `xml:"locator,attr"`
+	Message string `xml:",chardata"`
+}
+
+type owsException struct {
+	Code    string   `xml:"exceptionCode,attr"`
+	Locator string   `xml:"locator,attr"`
+	Texts   []string `xml:"ExceptionText"`
+}
+
+type OwsError struct {
+	Code    string `json:"code,omitempty"`
+	Locator string `json:"locator,omitempty"`
+	Message string `json:"message"`
+}
+
+type OwsErrorResponse struct {
+	Status int        `json:"status"`
+	Errors []OwsError `json:"errors"`
+}
+
+func isExceptionResponse(resp *http.Response) bool {
+	ctype := resp.Header.Get("Content-Type")
+	if strings.Contains(ctype, "se_xml") {
+		return true
+	}
+	return resp.StatusCode >= 400 && strings.Contains(ctype, "xml")
+}
+
+func parseExceptionReport(body []byte) ([]OwsError, bool) {
+	var report serviceExceptionReport
+	if err := xml.Unmarshal(body, &report); err != nil {
+		return nil, false
+	}
+	errs := make([]OwsError, 0, len(report.Exceptions)+len(report.OwsExceptions))
+	for _, e := range report.Exceptions {
+		errs = append(errs, OwsError{Code: e.Code, Locator: e.Locator, Message: strings.TrimSpace(e.Message)})
+	}
+	for _, e := range report.OwsExceptions {
+		errs = append(errs, OwsError{Code: e.Code, Locator: e.Locator, Message: strings.TrimSpace(strings.Join(e.Texts, "\n"))})
+	}
+	return errs, len(errs) > 0
+}
+
+func acceptsJSON(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "application/json") ||
+		strings.EqualFold(req.Header.Get("X-Requested-With"), "XMLHttpRequest")
+}
+
+// Detects OWS exceptions in the map server response, logs them and translates them
+// into JSON errors for clients which prefer JSON.
+func (s *Server) owsExceptionsInterceptor(resp *http.Response) error {
+	if !isExceptionResponse(resp) {
+		return nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := resp.Body.Close(); err != nil {
+		return err
+	}
+	req := resp.Request
+	query := req.URL.Query()
+	service := strings.ToUpper(owsValue(query, "SERVICE"))
+	request := owsValue(query, "REQUEST")
+	errs, ok := parseExceptionReport(body)
+	if !ok {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return nil
+	}
+	for _, e := range errs {
+		owsExceptionsCounter.WithLabelValues(
+			metricsLabel(service, owsMetricsServices),
+			metricsLabel(request, owsMetricsRequests),
+			metricsLabel(e.Code, owsMetricsCodes),
+		).Inc()
+	}
+	s.log.Warnw("OWS exception", "map", owsValue(query, "MAP"), "service", service, "request", request, "status", resp.StatusCode, "errors", errs)
+
+	if acceptsJSON(req) {
+		status := resp.StatusCode
+		if status < 400 {
+			status = http.StatusBadRequest
+		}
+		newBody, err := json.Marshal(OwsErrorResponse{Status: status, Errors: errs})
+		if err != nil {
+			return err
+		}
+		body = newBody
+		resp.StatusCode = status
+		resp.Status = fmt.Sprintf("%d %s", status, http.StatusText(status))
+		resp.Header.Set("Content-Type", "application/json")
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
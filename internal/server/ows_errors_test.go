@@ -0,0 +1,25 @@
+package server
+
+import "testing"
+
+func TestMetricsLabel(t *testing.T) {
+	tests := []struct {
+		value    string
+		known    []string
+		expected string
+	}{
+		{"WMS", owsMetricsServices, "WMS"},
+		{"wfs", owsMetricsServices, "WFS"},
+		{"", owsMetricsServices, "none"},
+		{"WMS<script>", owsMetricsServices, "other"},
+		{"getfeatureinfo", owsMetricsRequests, "GetFeatureInfo"},
+		{"GetMap-1234", owsMetricsRequests, "other"},
+		{"LayerNotDefined", owsMetricsCodes, "LayerNotDefined"},
+		{"parks_layer_1", owsMetricsCodes, "other"},
+	}
+	for _, tt := range tests {
+		if res := metricsLabel(tt.value, tt.known); res != tt.expected {
+			t.Errorf("%q: got %q, expected %q", tt.value, res, tt.expected)
+		}
+	}
+}
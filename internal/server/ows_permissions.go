@@ -0,0 +1,326 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jellydator/ttlcache/v3"
+)
+
+const layersPermissionsTTL = 10 * time.Minute
+
+// Layers permissions of the user compiled from the project settings (computed lazily)
+type layersPermissions struct {
+	mu        sync.Mutex
+	user      domain.User
+	userRoles []domain.ProjectRole
+	settings  domain.ProjectSettings
+	nameToID  map[string]string
+	groups    map[string][]string
+	layers    map[string]domain.Flags
+	attrs     map[string]map[string]domain.Flags
+}
+
+func newLayersPermissions(user domain.User, settings domain.ProjectSettings, layersData application.LayersData) *layersPermissions {
+	return &layersPermissions{
+		user:      user,
+		userRoles: domain.FilterUserRoles(user, settings.Auth.Roles),
+		settings:  settings,
+		nameToID:  layersData.LayerNameToID,
+		groups:    layersData.GroupLayers,
+		layers:    make(map[string]domain.Flags),
+		attrs:     make(map[string]map[string]domain.Flags),
+	}
+}
+
+func (p *layersPermissions) layerID(typeName string) string {
+	name := layerName(typeName)
+	id, ok := p.nameToID[name]
+	if !ok {
+		// spaces in layer names are replaced by underscores in WFS type names
+		id = p.nameToID[strings.ReplaceAll(name, "_", " ")]
+	}
+	return id
+}
+
+func (p *layersPermissions) layerAllowed(id string) bool {
+	lset, ok := p.settings.Layers[id]
+	return !ok || lset.Roles.Allows(p.user, p.userRoles)
+}
+
+// Checks roles restriction of the layer (by its name or WFS typeName). Layer groups are allowed
+// when all their layers are allowed, unknown names (e.g. root layer of the WMS service) only when
+// all layers of the project are allowed.
+func (p *layersPermissions) Allowed(typeName string) bool {
+	if id := p.layerID(typeName); id != "" {
+		return p.layerAllowed(id)
+	}
+	if ids, ok := p.groups[layerName(typeName)]; ok {
+		for _, id := range ids {
+			if !p.layerAllowed(id) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, id := range p.nameToID {
+		if !p.layerAllowed(id) {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks whether the layer (by its name or WFS typeName) is restricted to other roles.
+// Unlike Allowed, layer groups and unknown names are never reported as restricted.
+func (p *layersPermissions) Restricted(typeName string) bool {
+	id := p.layerID(typeName)
+	return id != "" && !p.layerAllowed(id)
+}
+
+// Returns permissions flags of the layer (by its name or WFS typeName), layers restricted
+// to other roles have no permissions
+func (p *layersPermissions) Layer(typeName string) domain.Flags {
+	id := p.layerID(typeName)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	flags, ok := p.layers[id]
+	if !ok {
+		if p.layerAllowed(id) {
+			flags = p.settings.UserLayerPermissionsFlags(p.user, id)
+		}
+		p.layers[id] = flags
+	}
+	return flags
+}
+
+// Returns permissions flags of the layer attributes, returned map must not be modified
+func (p *layersPermissions) Attributes(typeName string) map[string]domain.Flags {
+	id := p.layerID(typeName)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	attrsFlags, ok := p.attrs[id]
+	if !ok {
+		attrsFlags = p.settings.UserLayerAttrinutesFlags(p.user, id)
+		geomAttrs, ok := attrsFlags["geometry"]
+		if ok {
+			attrsFlags["geometry"] = geomAttrs.Union([]string{"view"})
+		} else {
+			// for backward compatibility
+			attrsFlags["geometry"] = []string{"view", "edit"}
+		}
+		p.attrs[id] = attrsFlags
+	}
+	return attrsFlags
+}
+
+// Cache of the users layers permissions, entries are bound to the project config version
+// and removed when the project is updated or its settings are changed
+type layersPermissionsCache struct {
+	cache *ttlcache.Cache[string, *layersPermissions]
+}
+
+func newLayersPermissionsCache() *layersPermissionsCache {
+	cache := ttlcache.New(
+		ttlcache.WithTTL[string, *layersPermissions](layersPermissionsTTL),
+		ttlcache.WithDisableTouchOnHit[string, *layersPermissions](),
+	)
+	go cache.Start()
+	return &layersPermissionsCache{cache: cache}
+}
+
+func (c *layersPermissionsCache) Close() {
+	c.cache.Stop()
+}
+
+// Invalidate removes cached permissions of all users of the project
+func (c *layersPermissionsCache) Invalidate(projectName string) {
+	prefix := projectName + "|"
+	for _, key := range c.cache.Keys() {
+		if strings.HasPrefix(key, prefix) {
+			c.cache.Delete(key)
+		}
+	}
+}
+
+// Returns hash of the user's groups, so cached permissions are not used after change of
+// the groups membership (roles and layers restrictions can be assigned to groups)
+func userGroupsHash(user domain.User) string {
+	groups := append([]string{}, user.Groups...)
+	sort.Strings(groups)
+	h := sha1.Sum([]byte(strings.Join(groups, "\n")))
+	return hex.EncodeToString(h[:8])
+}
+
+func (s *Server) userLayersPermissions(projectName string, user domain.User, settings domain.ProjectSettings) (*layersPermissions, error) {
+	version, err := s.projects.ConfigVersion(projectName)
+	if err != nil {
+		return nil, fmt.Errorf("getting project config version: %w", err)
+	}
+	key := fmt.Sprintf("%s|%s|%s|%s", projectName, user.Username, userGroupsHash(user), version)
+	if item := s.layersPerms.cache.Get(key); item != nil {
+		return item.Value(), nil
+	}
+	layersData, err := s.projects.GetLayersData(projectName)
+	if err != nil {
+		return nil, fmt.Errorf("getting layer data: %w", err)
+	}
+	perms := newLayersPermissions(user, settings, layersData)
+	s.layersPerms.cache.Set(key, perms, ttlcache.DefaultTTL)
+	return perms, nil
+}
+
+// Checks permissions of all operations in WFS transaction
+func checkTransactionPermissions(t *Transaction, perms *layersPermissions) bool {
+	for _, op := range t.Operations {
+		permission := op.Action
+		if op.Action == wfsReplace {
+			permission = wfsUpdate
+		}
+		if !perms.Layer(op.Layer).Has(permission) {
+			return false
+		}
+		if op.Action == wfsDelete {
+			continue
+		}
+		attrsFlags := perms.Attributes(op.Layer)
+		for _, attr := range op.Attributes {
+			if !attrsFlags[attr].Has("edit") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Reports whether some layer of the project is restricted to the specific roles
+type layersPermissionsKey struct{}
+
+// Returns request with layers permissions used to filter the capabilities document
+func withLayersPermissions(req *http.Request, perms *layersPermissions) *http.Request {
+	if perms == nil {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), layersPermissionsKey{}, perms))
+}
+
+// Removes Layer (WMS) and FeatureType (WFS) elements of the layers restricted to other
+// roles from the capabilities document
+func filterCapabilitiesLayers(doc []byte, perms *layersPermissions) ([]byte, error) {
+	type element struct {
+		start int64
+		name  string
+		layer bool
+	}
+	type span struct{ start, end int64 }
+	var (
+		stack   []element
+		removed []span
+		inName  bool
+	)
+	decoder := xml.NewDecoder(bytes.NewReader(doc))
+	decoder.Strict = false
+	for {
+		offset := decoder.InputOffset()
+		t, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing capabilities: %w", err)
+		}
+		switch el := t.(type) {
+		case xml.StartElement:
+			if el.Name.Local == "Name" && len(stack) > 0 && stack[len(stack)-1].layer {
+				inName = true
+			}
+			isLayer := el.Name.Local == "Layer" || el.Name.Local == "FeatureType"
+			stack = append(stack, element{start: offset, layer: isLayer})
+		case xml.CharData:
+			if inName {
+				stack[len(stack)-2].name += string(el)
+			}
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("parsing capabilities: unexpected end element %s", el.Name.Local)
+			}
+			inName = false
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if e.layer && perms.Restricted(strings.TrimSpace(e.name)) {
+				removed = append(removed, span{e.start, decoder.InputOffset()})
+			}
+		}
+	}
+	if len(removed) == 0 {
+		return doc, nil
+	}
+	// nested elements are found before their parents
+	sort.Slice(removed, func(i, j int) bool { return removed[i].start < removed[j].start })
+	var out bytes.Buffer
+	var pos int64
+	for _, r := range removed {
+		if r.start < pos {
+			continue
+		}
+		out.Write(doc[pos:r.start])
+		pos = r.end
+	}
+	out.Write(doc[pos:])
+	return out.Bytes(), nil
+}
+
+func hasLayersRoles(settings domain.ProjectSettings) bool {
+	for _, lset := range settings.Layers {
+		if len(lset.Roles) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns names of all layers referenced by the OWS request (WMS layers parameters,
+// including layers of print maps, WFS type names and feature IDs, XML body and WFS transaction)
+func owsRequestLayers(query url.Values, xmlReq *owsXmlRequest) []string {
+	var names []string
+	// all variants of the parameters are checked, regardless of which one is used by the map server
+	for param, values := range query {
+		name := strings.ToUpper(param)
+		for _, v := range values {
+			switch {
+			case name == "LAYERS" || name == "LAYER" || name == "QUERY_LAYERS" || strings.HasSuffix(name, ":LAYERS"):
+				for _, layer := range strings.Split(v, ",") {
+					if layer = strings.TrimSpace(layer); layer != "" {
+						names = append(names, layer)
+					}
+				}
+			case name == "TYPENAME" || name == "TYPENAMES":
+				names = append(names, splitTypeNames(v)...)
+			case name == "FEATUREID" || name == "RESOURCEID":
+				names = append(names, featureIdsLayers(v)...)
+			}
+		}
+	}
+	if xmlReq != nil {
+		names = append(names, xmlReq.TypeNames...)
+		if xmlReq.Transaction != nil {
+			for _, op := range xmlReq.Transaction.Operations {
+				names = append(names, op.Layer)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,283 @@
+package server
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jellydator/ttlcache/v3"
+)
+
+var testLayersData = application.LayersData{
+	LayerNameToID: map[string]string{
+		"parks":        "parks_1",
+		"trees":        "trees_2",
+		"land parcels": "parcels_3",
+	},
+	GroupLayers: map[string][]string{
+		"Nature":   {"parks_1", "trees_2"},
+		"Cadastre": {"parcels_3"},
+	},
+}
+
+func testProjectSettings() domain.ProjectSettings {
+	return domain.ProjectSettings{
+		Layers: map[string]domain.LayerSettings{
+			"parks_1":   {},
+			"trees_2":   {},
+			"parcels_3": {Roles: domain.RolesRestriction{"officers", "group:cadastre"}},
+		},
+		Auth: domain.Authentication{
+			Roles: []domain.ProjectRole{
+				{
+					Auth: "authenticated",
+					Name: "viewers",
+					Permissions: domain.RolePermissions{
+						Layers: map[string]domain.Flags{
+							"parks_1":   {"view", "query"},
+							"trees_2":   {"view", "query"},
+							"parcels_3": {"view", "query"},
+						},
+						Attributes: map[string]map[string]domain.Flags{
+							"parks_1": {"name": {"view"}},
+						},
+					},
+				},
+				{
+					Auth:  "users",
+					Name:  "officers",
+					Users: []string{"officer"},
+					Permissions: domain.RolePermissions{
+						Layers: map[string]domain.Flags{
+							"parks_1":   {"view", "query", "update"},
+							"parcels_3": {"view", "query", "insert", "update", "delete"},
+						},
+						Attributes: map[string]map[string]domain.Flags{
+							"parks_1":   {"name": {"view", "edit"}, "area": {"view"}},
+							"parcels_3": {"owner": {"view", "edit"}},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+var (
+	testViewer  = domain.User{Username: "viewer", IsAuthenticated: true}
+	testOfficer = domain.User{Username: "officer", IsAuthenticated: true}
+	testMember  = domain.User{Username: "member", IsAuthenticated: true, Groups: []string{"cadastre"}}
+)
+
+func TestLayersPermissionsAllowed(t *testing.T) {
+	tests := []struct {
+		user     domain.User
+		layer    string
+		expected bool
+	}{
+		{testViewer, "parks", true},
+		{testViewer, "qgs:parks", true},
+		{testViewer, "land parcels", false},
+		{testViewer, "land_parcels", false},
+		{testViewer, "feature:land_parcels", false},
+		{testViewer, "{http://www.qgis.org/gml}land_parcels", false},
+		{testViewer, "Nature", true},
+		{testViewer, "Cadastre", false},
+		// root layer of the project (all layers)
+		{testViewer, "project", false},
+		{testOfficer, "land_parcels", true},
+		{testOfficer, "Cadastre", true},
+		{testOfficer, "project", true},
+		{testMember, "land_parcels", true},
+		{domain.User{}, "land_parcels", false},
+	}
+	for _, tt := range tests {
+		perms := newLayersPermissions(tt.user, testProjectSettings(), testLayersData)
+		if res := perms.Allowed(tt.layer); res != tt.expected {
+			t.Errorf("%s %s: got %v, expected %v", tt.user.Username, tt.layer, res, tt.expected)
+		}
+	}
+}
+
+func TestLayersPermissionsRestrictedLayer(t *testing.T) {
+	// viewer role has permissions to the layer, but the layer is restricted to other roles
+	perms := newLayersPermissions(testViewer, testProjectSettings(), testLayersData)
+	if flags := perms.Layer("land_parcels"); flags != nil {
+		t.Errorf("restricted layer has permissions: %v", flags)
+	}
+	if flags := perms.Layer("parks"); !flags.Has("query") {
+		t.Errorf("missing permissions of the layer: %v", flags)
+	}
+	perms = newLayersPermissions(testOfficer, testProjectSettings(), testLayersData)
+	if flags := perms.Layer("land_parcels"); !flags.Has("delete") {
+		t.Errorf("missing permissions of the layer: %v", flags)
+	}
+}
+
+func TestOwsRequestLayers(t *testing.T) {
+	tests := []struct {
+		query       string
+		body        string
+		transaction bool
+		expected    []string
+	}{
+		{
+			query:    "SERVICE=WMS&REQUEST=GetMap&LAYERS=parks,trees",
+			expected: []string{"parks", "trees"},
+		},
+		{
+			query:    "service=WMS&request=GetFeatureInfo&layers=parks&query_layers=land_parcels",
+			expected: []string{"land_parcels", "parks"},
+		},
+		{
+			query:    "SERVICE=WMS&REQUEST=GetLegendGraphic&LAYER=land parcels",
+			expected: []string{"land parcels"},
+		},
+		{
+			query:    "SERVICE=WMS&REQUEST=GetPrint&TEMPLATE=A4&map0:LAYERS=parks,Cadastre",
+			expected: []string{"Cadastre", "parks"},
+		},
+		{
+			query:    "SERVICE=WFS&REQUEST=GetFeature&TYPENAME=parks&typenames=(trees)(land_parcels)",
+			expected: []string{"land_parcels", "parks", "trees"},
+		},
+		{
+			query:    "SERVICE=WFS&REQUEST=GetFeature&FEATUREID=parks.1,land_parcels.4",
+			expected: []string{"land_parcels", "parks"},
+		},
+		{
+			query:    "SERVICE=WFS&REQUEST=GetFeature",
+			body:     `<wfs:GetFeature xmlns:wfs="http://www.opengis.net/wfs" service="WFS"><wfs:Query typeName="feature:parks"/><wfs:Query typeName="feature:land_parcels"/></wfs:GetFeature>`,
+			expected: []string{"feature:land_parcels", "feature:parks"},
+		},
+		{
+			query:    "SERVICE=WFS&REQUEST=DescribeFeatureType",
+			body:     `<DescribeFeatureType xmlns="http://www.opengis.net/wfs" service="WFS" version="1.0.0"><TypeName>land_parcels</TypeName></DescribeFeatureType>`,
+			expected: []string{"land_parcels"},
+		},
+		{
+			query:       "SERVICE=WFS&REQUEST=Transaction",
+			body:        multiLayerTransaction,
+			transaction: true,
+			expected:    []string{"trees", "land_parcels", "trees"},
+		},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		var xmlReq *owsXmlRequest
+		if tt.body != "" {
+			var err error
+			if xmlReq, err = parseOwsXmlRequest([]byte(tt.body)); err != nil {
+				t.Fatal(err)
+			}
+			if tt.transaction != (xmlReq.Transaction != nil) {
+				t.Errorf("%s: unexpected transaction: %v", tt.query, xmlReq.Transaction)
+			}
+		}
+		layers := owsRequestLayers(query, xmlReq)
+		sort.Strings(layers)
+		expected := append([]string{}, tt.expected...)
+		sort.Strings(expected)
+		if strings.Join(layers, "|") != strings.Join(expected, "|") {
+			t.Errorf("%s: got %v, expected %v", tt.query, layers, expected)
+		}
+	}
+}
+
+func TestCheckTransactionPermissions(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     domain.User
+		body     string
+		expected bool
+	}{
+		{"viewer update", testViewer, qgisUpdateTransaction, false},
+		{"officer update", testOfficer, `<Transaction><Update typeName="parks"><Property><Name>name</Name></Property></Update></Transaction>`, true},
+		// area attribute is not editable
+		{"officer update attribute", testOfficer, qgisUpdateTransaction, false},
+		{"officer delete", testOfficer, qgisDeleteTransaction, false},
+		{"officer parcels", testOfficer, `<Transaction><Delete typeName="land_parcels"/><Update typeName="qgs:land_parcels"><Property><Name>owner</Name></Property></Update></Transaction>`, true},
+		// member of the group can access the layer, but without editing permissions
+		{"member parcels", testMember, `<Transaction><Delete typeName="land_parcels"/></Transaction>`, false},
+		{"multiple layers", testOfficer, multiLayerTransaction, false},
+	}
+	for _, tt := range tests {
+		transaction, err := scanWfsTransaction([]byte(tt.body))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		perms := newLayersPermissions(tt.user, testProjectSettings(), testLayersData)
+		if res := checkTransactionPermissions(transaction, perms); res != tt.expected {
+			t.Errorf("%s: got %v, expected %v", tt.name, res, tt.expected)
+		}
+	}
+}
+
+func TestUserGroupsHash(t *testing.T) {
+	a := userGroupsHash(domain.User{Username: "user", Groups: []string{"gis", "cadastre"}})
+	b := userGroupsHash(domain.User{Username: "user", Groups: []string{"cadastre", "gis"}})
+	c := userGroupsHash(domain.User{Username: "user", Groups: []string{"gis"}})
+	if a != b {
+		t.Error("hash depends on order of the groups")
+	}
+	if a == c {
+		t.Error("hash of different groups is equal")
+	}
+}
+
+func TestLayersPermissionsCacheInvalidate(t *testing.T) {
+	c := newLayersPermissionsCache()
+	defer c.Close()
+	perms := newLayersPermissions(testViewer, testProjectSettings(), testLayersData)
+	c.cache.Set("user/project|viewer||v1", perms, ttlcache.DefaultTTL)
+	c.cache.Set("user/project|officer||v1", perms, ttlcache.DefaultTTL)
+	c.cache.Set("user/project2|viewer||v1", perms, ttlcache.DefaultTTL)
+	c.Invalidate("user/project")
+	if keys := c.cache.Keys(); len(keys) != 1 || keys[0] != "user/project2|viewer||v1" {
+		t.Errorf("unexpected cached entries after invalidation: %v", keys)
+	}
+}
+
+func TestFilterCapabilitiesLayers(t *testing.T) {
+	wms := `<WMS_Capabilities><Capability><Layer><Name>project</Name>` +
+		`<Layer><Name>Nature</Name><Layer><Name>parks</Name></Layer><Layer><Name>trees</Name></Layer></Layer>` +
+		`<Layer><Name>Cadastre</Name><Layer queryable="1"><Name>land parcels</Name><Title>Parcels</Title></Layer></Layer>` +
+		`</Layer></Capability></WMS_Capabilities>`
+	wfs := `<WFS_Capabilities><FeatureTypeList>` +
+		`<FeatureType><Name>parks</Name></FeatureType><FeatureType><Name>land_parcels</Name></FeatureType>` +
+		`</FeatureTypeList></WFS_Capabilities>`
+
+	viewerPerms := newLayersPermissions(testViewer, testProjectSettings(), testLayersData)
+	data, err := filterCapabilitiesLayers([]byte(wms), viewerPerms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<WMS_Capabilities><Capability><Layer><Name>project</Name>` +
+		`<Layer><Name>Nature</Name><Layer><Name>parks</Name></Layer><Layer><Name>trees</Name></Layer></Layer>` +
+		`<Layer><Name>Cadastre</Name></Layer>` +
+		`</Layer></Capability></WMS_Capabilities>`
+	if string(data) != expected {
+		t.Errorf("unexpected WMS capabilities: %s", data)
+	}
+	data, err = filterCapabilitiesLayers([]byte(wfs), viewerPerms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `<WFS_Capabilities><FeatureTypeList><FeatureType><Name>parks</Name></FeatureType></FeatureTypeList></WFS_Capabilities>`
+	if string(data) != expected {
+		t.Errorf("unexpected WFS capabilities: %s", data)
+	}
+
+	officerPerms := newLayersPermissions(testOfficer, testProjectSettings(), testLayersData)
+	data, err = filterCapabilitiesLayers([]byte(wfs), officerPerms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != wfs {
+		t.Errorf("allowed layers were removed: %s", data)
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Returns OWS request parameters from the query, SERVICE is normalized to upper case
+func parseOwsRequestParams(query url.Values) *OwsRequestParams {
+	return &OwsRequestParams{
+		Map:     owsValue(query, "MAP"),
+		Service: strings.ToUpper(owsValue(query, "SERVICE")),
+		Request: owsValue(query, "REQUEST"),
+		Layers:  owsValue(query, "LAYERS"),
+	}
+}
+
+// XML body of the OWS POST request, parsed in a single pass and shared by the request checks
+type owsXmlRequest struct {
+	Body []byte
+	Root xml.StartElement
+	// type names from typeName(s) attributes and TypeName elements (GetFeature queries,
+	// DescribeFeatureType), layers of the transaction are in the transaction operations
+	TypeNames []string
+	// parsed WFS transaction (only when the root element is Transaction)
+	Transaction *Transaction
+}
+
+// Parses XML body of the OWS request, fails when the document is not well-formed
+func parseOwsXmlRequest(body []byte) (*owsXmlRequest, error) {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	var r *owsXmlRequest
+	depth := 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			if r == nil {
+				r = &owsXmlRequest{Body: body, Root: el.Copy()}
+				if el.Name.Local == "Transaction" {
+					r.Transaction = &Transaction{Version: xmlAttr(el, "version")}
+					// whole root element is consumed
+					if err := scanTransactionOperations(d, r.Transaction); err != nil {
+						return nil, err
+					}
+					continue
+				}
+			} else if depth == 0 {
+				// content after the root element
+				return nil, fmt.Errorf("unexpected element <%s>", el.Name.Local)
+			}
+			for _, a := range el.Attr {
+				if strings.EqualFold(a.Name.Local, "typeName") || strings.EqualFold(a.Name.Local, "typeNames") {
+					r.TypeNames = append(r.TypeNames, splitTypeNames(a.Value)...)
+				}
+			}
+			if el.Name.Local == "TypeName" {
+				var value string
+				if err := d.DecodeElement(&value, &el); err != nil {
+					return nil, err
+				}
+				r.TypeNames = append(r.TypeNames, splitTypeNames(value)...)
+				continue
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if r == nil {
+		return nil, errors.New("missing root element")
+	}
+	return r, nil
+}
+
+func setRequestBody(req *http.Request, body []byte) {
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	if len(body) > 0 {
+		req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	} else {
+		req.Header.Del("Content-Length")
+		req.Header.Del("Content-Type")
+	}
+}
+
+// Reads body of the POST OWS request in the same way as the QGIS server, so the same permission
+// checks as for GET requests can be applied. REQUEST (and SERVICE and VERSION) of XML requests are
+// taken from the root element and the query parameters are overridden. Other bodies are parameters
+// in form encoding, which are moved into the query and the request is changed into GET request.
+// Returns parsed XML body or nil for form requests.
+func readOwsPostRequest(req *http.Request, query url.Values) (*owsXmlRequest, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	if xmlReq, err := parseOwsXmlRequest(body); err == nil {
+		replaceQueryParam(query, "REQUEST", xmlReq.Root.Name.Local)
+		if service := xmlAttr(xmlReq.Root, "service"); service != "" {
+			replaceQueryParam(query, "SERVICE", service)
+		}
+		if version := xmlAttr(xmlReq.Root, "version"); version != "" {
+			replaceQueryParam(query, "VERSION", version)
+		}
+		setRequestBody(req, body)
+		return xmlReq, nil
+	}
+	values, err := url.ParseQuery(string(bytes.TrimSpace(body)))
+	if err != nil {
+		return nil, err
+	}
+	for name, v := range values {
+		replaceQueryParam(query, name, v[len(v)-1])
+	}
+	setRequestBody(req, nil)
+	req.Method = http.MethodGet
+	return nil, nil
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/markdown"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Maximal length of the description in the page meta tags
+const pageDescriptionLength = 300
+
+// Public map rendered in the server side pages
+type pageProject struct {
+	Name        string
+	Title       string
+	Description string
+	PageURL     string
+	MapURL      string
+	ImageURL    string
+	Updated     time.Time
+	NoIndex     bool
+}
+
+func truncateText(text string, length int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= length {
+		return text
+	}
+	runes := []rune(text)[:length-1]
+	return strings.TrimSpace(string(runes)) + "…"
+}
+
+// Returns public map for the pages, or domain.ErrProjectNotExists when the project isn't public
+func (s *Server) getPageProject(projectName string) (pageProject, error) {
+	pInfo, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		return pageProject{}, err
+	}
+	if pInfo.Authentication != "public" || pInfo.QgisFile == "" || pInfo.State == "hidden" {
+		return pageProject{}, domain.ErrProjectNotExists
+	}
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return pageProject{}, fmt.Errorf("reading project settings: %w", err)
+	}
+	description, err := s.projects.GetDescription(projectName)
+	if err != nil {
+		return pageProject{}, fmt.Errorf("reading project description: %w", err)
+	}
+	siteURL := strings.TrimSuffix(s.Config.SiteURL, "/")
+	p := pageProject{
+		Name:        projectName,
+		Title:       pInfo.Title,
+		Description: truncateText(markdown.PlainText(description), pageDescriptionLength),
+		PageURL:     fmt.Sprintf("%s/maps/%s", siteURL, projectName),
+		MapURL:      s.projectMapURL(projectName),
+		Updated:     pInfo.LastUpdate,
+		NoIndex:     settings.Robots != nil && settings.Robots.NoIndex,
+	}
+	if settings.Title != "" {
+		p.Title = settings.Title
+	}
+	if p.Title == "" {
+		p.Title = projectName
+	}
+	if pInfo.Thumbnail {
+		p.ImageURL = fmt.Sprintf("%s/api/project/thumbnail/%s", siteURL, projectName)
+	}
+	return p, nil
+}
+
+func (s *Server) renderPage(c echo.Context, templateFile string, data map[string]interface{}) error {
+	tmpl, err := htmltemplate.ParseFiles(filepath.Join("./templates", templateFile))
+	if err != nil {
+		return fmt.Errorf("parsing page template: %w", err)
+	}
+	branding, err := s.loadBranding()
+	if err != nil {
+		s.log.Errorw("loading branding", zap.Error(err))
+	}
+	data["SiteName"] = "Gisquick"
+	if branding.InstanceName != "" {
+		data["SiteName"] = branding.InstanceName
+	}
+	data["SiteURL"] = strings.TrimSuffix(s.Config.SiteURL, "/")
+	data["Language"] = strings.SplitN(s.Config.Language, "-", 2)[0]
+	data["Logo"] = branding.Images["logo"]
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("rendering page: %w", err)
+	}
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.HTMLBlob(http.StatusOK, buf.Bytes())
+}
+
+// Server rendered page of the public map with OpenGraph tags, which redirects browsers to the map viewer
+func (s *Server) handleMapPage(c echo.Context) error {
+	projectName := filepath.Join(c.Param("user"), c.Param("name"))
+	project, err := s.getPageProject(projectName)
+	if err != nil {
+		if errors.Is(err, domain.ErrProjectNotExists) {
+			return echo.ErrNotFound
+		}
+		return fmt.Errorf("map page: %w", err)
+	}
+	if project.NoIndex {
+		c.Response().Header().Set("X-Robots-Tag", "noindex, nofollow")
+	}
+	return s.renderPage(c, "map_page.html", map[string]interface{}{"Project": project})
+}
+
+// Server rendered catalog of the public maps (maps excluded from indexing are not listed)
+func (s *Server) handleMapsCatalogPage(c echo.Context) error {
+	projects, err := s.projects.AccessibleProjects(domain.User{}, true)
+	if err != nil {
+		return fmt.Errorf("maps catalog page: %w", err)
+	}
+	maps := make([]pageProject, 0)
+	for _, pInfo := range projects {
+		if pInfo.Authentication != "public" {
+			continue
+		}
+		project, err := s.getPageProject(pInfo.Name)
+		if err != nil {
+			if !errors.Is(err, domain.ErrProjectNotExists) {
+				s.log.Errorw("maps catalog page", "project", pInfo.Name, zap.Error(err))
+			}
+			continue
+		}
+		if !project.NoIndex {
+			maps = append(maps, project)
+		}
+	}
+	sort.Slice(maps, func(i, j int) bool {
+		return maps[i].Updated.After(maps[j].Updated)
+	})
+	return s.renderPage(c, "maps_catalog_page.html", map[string]interface{}{"Projects": maps})
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Requirements on the new passwords, exposed to the web client (without the list of breached passwords)
+type PasswordPolicy struct {
+	MinLength     int  `json:"min_length"`
+	RequireLower  bool `json:"require_lowercase"`
+	RequireUpper  bool `json:"require_uppercase"`
+	RequireDigit  bool `json:"require_digit"`
+	RequireSymbol bool `json:"require_symbol"`
+	CheckBreached bool `json:"check_breached"`
+	// known breached or common passwords (lower case)
+	Breached map[string]bool `json:"-"`
+}
+
+// LoadBreachedPasswords reads list of breached passwords (one password per line, lines starting
+// with # are ignored)
+func LoadBreachedPasswords(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	passwords := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			passwords[strings.ToLower(line)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading breached passwords list: %w", err)
+	}
+	return passwords, nil
+}
+
+// Validates new password against the policy
+func (p PasswordPolicy) Validate(password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("Password must have at least %d characters", p.MinLength)
+	}
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireLower && !lower {
+		return errors.New("Password must contain a lowercase letter")
+	}
+	if p.RequireUpper && !upper {
+		return errors.New("Password must contain an uppercase letter")
+	}
+	if p.RequireDigit && !digit {
+		return errors.New("Password must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		return errors.New("Password must contain a special character")
+	}
+	if p.CheckBreached && p.Breached[strings.ToLower(password)] {
+		return errors.New("Password is too common, it was found in a list of breached passwords")
+	}
+	return nil
+}
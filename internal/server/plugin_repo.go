@@ -9,6 +9,8 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gisquick/gisquick-server/internal/infrastructure/cache"
@@ -16,6 +18,9 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// Directory of the QGIS plugins repository
+const pluginsRepoRoot = "/qgis-plugins-repo"
+
 type Plugins struct {
 	XMLName xml.Name       `xml:"plugins"`
 	Plugins []PyQgisPlugin `xml:"plugins"`
@@ -65,7 +70,7 @@ func (c CDATA) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 func (s *Server) handleDownloadPlugin(rootDir string) func(echo.Context) error {
 	return func(c echo.Context) error {
 		filename := c.Param("*")
-		fpath := filepath.Join(rootDir, filename)
+		fpath := filepath.Join(rootDir, filepath.Clean("/"+filename))
 		return c.File(fpath)
 	}
 }
@@ -107,8 +112,8 @@ func (s *Server) platformPluginRepoHandler1(rootDir string) func(echo.Context) e
 	}
 }
 
-func (s *Server) platformPluginRepoHandler(rootDir string) func(echo.Context) error {
-	cache := cache.NewDataCache(func(filename string) (PyQgisPlugin, error) {
+func (s *Server) newPluginsMetadataCache() *cache.DataCache[string, PyQgisPlugin] {
+	return cache.NewDataCache(func(filename string) (PyQgisPlugin, error) {
 		var plugin PyQgisPlugin
 		s.log.Infow("loading qgis plugin metadata", "file", filename)
 		f, err := os.Open(filename)
@@ -116,51 +121,135 @@ func (s *Server) platformPluginRepoHandler(rootDir string) func(echo.Context) er
 			// s.log.Errorw("reading qgis plugin metadata", zap.Error(err))
 			return plugin, fmt.Errorf("reading qgis plugin metadata: %w", err)
 		}
+		defer f.Close()
 		if err := json.NewDecoder(f).Decode(&plugin); err != nil {
 			// s.log.Errorw("parsing qgis plugin metadata", zap.Error(err))
 			return plugin, fmt.Errorf("parsing qgis plugin metadata: %w", err)
 		}
 		return plugin, nil
 	})
+}
+
+// Lists metadata of the plugin packages of the platform (with generated download URLs)
+func (s *Server) listPlatformPlugins(cache *cache.DataCache[string, PyQgisPlugin], rootDir, platform string) ([]PyQgisPlugin, error) {
+	// siteURL, _ := url.Parse(s.Config.SiteURL)
+	files, err := filepath.Glob(filepath.Join(rootDir, platform, "*/*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("listing qgis plugins repo: %w", err)
+	}
+	plugins := make([]PyQgisPlugin, 0, len(files))
+	for _, filename := range files {
+		fStat, err := os.Stat(filename)
+		if err != nil {
+			return nil, fmt.Errorf("listing qgis plugins repo: %w", err)
+			// plugin.Updated = fStat.ModTime()
+		}
+		updated := fStat.ModTime()
+		timestamp := updated.Unix()
 
+		plugin, err := cache.Get(filename, timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("getting qgis plugin metadata: %w", err)
+		}
+		pluginName := filepath.Base(filepath.Dir(filename))
+		// plugin.Updated = updated
+		if plugin.Icon != "" {
+			// plugin.Icon = fmt.Sprintf("/api/plugins/download/%s/%s/%s", platform, pluginName, plugin.Icon)
+			// plugin.Icon = fmt.Sprintf("/plugins/download/%s/%s/%s", platform, pluginName, plugin.Icon)
+			plugin.Icon = path.Join("/download", platform, pluginName, plugin.Icon)
+		}
+
+		relURL := path.Join("download", platform, pluginName, plugin.FileName)
+		u, _ := url.Parse(s.Config.PluginsURL)
+		u.Path = path.Join(u.Path, relURL)
+		plugin.DownloadURL = u.String()
+
+		// s.log.Infow("plugin metadata", "meta", plugin)
+		plugins = append(plugins, plugin)
+	}
+	return plugins, nil
+}
+
+func (s *Server) platformPluginRepoHandler(rootDir string) func(echo.Context) error {
+	cache := s.newPluginsMetadataCache()
 	return func(c echo.Context) error {
 		platform := c.Param("platform")
-		// siteURL, _ := url.Parse(s.Config.SiteURL)
-
-		files, err := filepath.Glob(filepath.Join(rootDir, platform, "*/*.json"))
+		plugins, err := s.listPlatformPlugins(cache, rootDir, platform)
 		if err != nil {
-			return fmt.Errorf("listing qgis plugins repo: %w", err)
+			return err
 		}
-		plugins := make([]PyQgisPlugin, 0, len(files))
-		for _, filename := range files {
-			fStat, err := os.Stat(filename)
+		return c.XML(http.StatusOK, Plugins{Plugins: plugins})
+	}
+}
+
+// Checks whether the plugin supports QGIS version (in format major.minor[.patch])
+func qgisVersionSupported(plugin PyQgisPlugin, qgisVersion string) bool {
+	if qgisVersion == "" {
+		return true
+	}
+	if plugin.QgisMinVersion != "" && compareVersions(qgisVersion, plugin.QgisMinVersion) < 0 {
+		return false
+	}
+	if plugin.QgisMaxVersion != "" {
+		// maximal version is inclusive on the minor version level (e.g. 3.99 includes 3.99.1)
+		max := strings.SplitN(plugin.QgisMaxVersion, ".", 3)
+		qgis := strings.SplitN(qgisVersion, ".", 3)
+		if len(qgis) > len(max) {
+			qgis = qgis[:len(max)]
+		}
+		if compareVersions(strings.Join(qgis, "."), plugin.QgisMaxVersion) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// QGIS plugin repository (plugins.xml) with the newest packages compatible with this server release
+// and QGIS version (sent by QGIS in 'qgis' query parameter). Packages of all platforms are listed
+// unless the platform query parameter is set.
+func (s *Server) pluginsRepoXMLHandler(rootDir string) func(echo.Context) error {
+	cache := s.newPluginsMetadataCache()
+	return func(c echo.Context) error {
+		platforms := []string{c.QueryParam("platform")}
+		if platforms[0] == "" {
+			entries, err := os.ReadDir(rootDir)
 			if err != nil {
 				return fmt.Errorf("listing qgis plugins repo: %w", err)
-				// plugin.Updated = fStat.ModTime()
 			}
-			updated := fStat.ModTime()
-			timestamp := updated.Unix()
-
-			plugin, err := cache.Get(filename, timestamp)
+			platforms = platforms[:0]
+			for _, e := range entries {
+				if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+					platforms = append(platforms, e.Name())
+				}
+			}
+		} else if strings.ContainsAny(platforms[0], `/\`) || strings.HasPrefix(platforms[0], ".") {
+			return echo.ErrNotFound
+		}
+		compatibility, err := pluginCompatibilityRange(rootDir)
+		if err != nil {
+			return err
+		}
+		qgisVersion := c.QueryParam("qgis")
+		newest := make(map[string]PyQgisPlugin)
+		for _, platform := range platforms {
+			plugins, err := s.listPlatformPlugins(cache, rootDir, platform)
 			if err != nil {
-				return fmt.Errorf("getting qgis plugin metadata: %w", err)
+				return err
 			}
-			pluginName := filepath.Base(filepath.Dir(filename))
-			// plugin.Updated = updated
-			if plugin.Icon != "" {
-				// plugin.Icon = fmt.Sprintf("/api/plugins/download/%s/%s/%s", platform, pluginName, plugin.Icon)
-				// plugin.Icon = fmt.Sprintf("/plugins/download/%s/%s/%s", platform, pluginName, plugin.Icon)
-				plugin.Icon = path.Join("/download", platform, pluginName, plugin.Icon)
+			for _, plugin := range plugins {
+				if !compatibility.allows(plugin.Version) || !qgisVersionSupported(plugin, qgisVersion) {
+					continue
+				}
+				if current, ok := newest[plugin.Name]; !ok || compareVersions(plugin.Version, current.Version) > 0 {
+					newest[plugin.Name] = plugin
+				}
 			}
-
-			relURL := path.Join("download", platform, pluginName, plugin.FileName)
-			u, _ := url.Parse(s.Config.PluginsURL)
-			u.Path = path.Join(u.Path, relURL)
-			plugin.DownloadURL = u.String()
-
-			// s.log.Infow("plugin metadata", "meta", plugin)
+		}
+		plugins := make([]PyQgisPlugin, 0, len(newest))
+		for _, plugin := range newest {
 			plugins = append(plugins, plugin)
 		}
+		sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
 		return c.XML(http.StatusOK, Plugins{Plugins: plugins})
 	}
 }
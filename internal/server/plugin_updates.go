@@ -0,0 +1,208 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Version of the server (set at build time with -ldflags "-X github.com/gisquick/gisquick-server/internal/server.Version=...")
+var Version = "dev"
+
+// Compatibility registry (list of plugin versions supported by server releases) is stored in the plugins
+// repository, e.g. [{"server": "3.2.0", "plugin": "2.4.0", "max_plugin": "2.9"}]
+const pluginsCompatibilityFile = "compatibility.json"
+
+type pluginCompatibility struct {
+	Server string `json:"server"`
+	// minimal required version of the plugin
+	Plugin string `json:"plugin"`
+	// maximal supported version of the plugin (optional)
+	MaxPlugin string `json:"max_plugin,omitempty"`
+}
+
+// Checks whether the plugin version is supported (maximal version is inclusive on its precision level)
+func (p pluginCompatibility) allows(version string) bool {
+	if p.Plugin != "" && compareVersions(version, p.Plugin) < 0 {
+		return false
+	}
+	if p.MaxPlugin != "" {
+		parts := strings.Split(version, ".")
+		if n := len(strings.Split(p.MaxPlugin, ".")); len(parts) > n {
+			parts = parts[:n]
+		}
+		if compareVersions(strings.Join(parts, "."), p.MaxPlugin) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Data of the 'PluginUpdate' message sent to the plugin after connection
+type pluginUpdateInfo struct {
+	Version     string `json:"version"`
+	Latest      string `json:"latest,omitempty"`
+	MinVersion  string `json:"min_version,omitempty"`
+	Required    bool   `json:"required"`
+	Available   bool   `json:"available"`
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// Compares dot separated version strings (non-numeric suffixes like "-beta" are ignored)
+func compareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na = versionNumber(pa[i])
+		}
+		if i < len(pb) {
+			nb = versionNumber(pb[i])
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionNumber(part string) int {
+	end := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' })
+	if end != -1 {
+		part = part[:end]
+	}
+	n, _ := strconv.Atoi(part)
+	return n
+}
+
+// Returns plugin versions supported by this server release (empty range when not defined)
+func pluginCompatibilityRange(rootDir string) (pluginCompatibility, error) {
+	var match pluginCompatibility
+	data, err := os.ReadFile(filepath.Join(rootDir, pluginsCompatibilityFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return match, nil
+		}
+		return match, err
+	}
+	var registry []pluginCompatibility
+	if err := json.Unmarshal(data, &registry); err != nil {
+		return match, fmt.Errorf("parsing plugins compatibility registry: %w", err)
+	}
+	for _, entry := range registry {
+		// development builds use requirements of the newest release
+		if Version != "dev" && compareVersions(entry.Server, Version) > 0 {
+			continue
+		}
+		if match.Server == "" || compareVersions(entry.Server, match.Server) > 0 {
+			match = entry
+		}
+	}
+	return match, nil
+}
+
+// Returns metadata of the newest supported plugin package of the platform and directory of the package
+func latestPlugin(rootDir, platform string, compatibility pluginCompatibility) (PyQgisPlugin, string, error) {
+	var latest PyQgisPlugin
+	var latestDir string
+	files, err := filepath.Glob(filepath.Join(rootDir, platform, "*/*.json"))
+	if err != nil {
+		return latest, "", fmt.Errorf("listing qgis plugins repo: %w", err)
+	}
+	for _, filename := range files {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return latest, "", fmt.Errorf("reading qgis plugin metadata: %w", err)
+		}
+		var plugin PyQgisPlugin
+		if err := json.Unmarshal(data, &plugin); err != nil {
+			return latest, "", fmt.Errorf("parsing qgis plugin metadata: %w", err)
+		}
+		if !compatibility.allows(plugin.Version) {
+			continue
+		}
+		if latestDir == "" || compareVersions(plugin.Version, latest.Version) > 0 {
+			latest = plugin
+			latestDir = filepath.Dir(filename)
+		}
+	}
+	return latest, latestDir, nil
+}
+
+func (s *Server) pluginUpdateInfo(rootDir, platform, version string) (pluginUpdateInfo, error) {
+	info := pluginUpdateInfo{Version: version}
+	compatibility, err := pluginCompatibilityRange(rootDir)
+	if err != nil {
+		return info, err
+	}
+	info.MinVersion = compatibility.Plugin
+	if platform != "" {
+		latest, dir, err := latestPlugin(rootDir, platform, compatibility)
+		if err != nil {
+			return info, err
+		}
+		if dir != "" {
+			info.Latest = latest.Version
+			info.Available = compareVersions(latest.Version, version) > 0
+			u, _ := url.Parse(s.Config.PluginsURL)
+			u.Path = path.Join(u.Path, "latest", platform)
+			info.DownloadURL = u.String()
+		}
+	}
+	info.Required = compatibility.Plugin != "" && compareVersions(version, compatibility.Plugin) < 0
+	return info, nil
+}
+
+// Sends 'PluginUpdate' message when newer version of the plugin is available or required by the server
+func (s *Server) notifyPluginUpdate(c echo.Context, username string) {
+	version := c.QueryParam("plugin_version")
+	if s.Config.PluginsURL == "" || version == "" {
+		return
+	}
+	info, err := s.pluginUpdateInfo(pluginsRepoRoot, c.QueryParam("platform"), version)
+	if err != nil {
+		s.log.Errorw("checking plugin updates", "user", username, zap.Error(err))
+		return
+	}
+	if info.Required || info.Available {
+		if err := s.sws.PluginChannel().Send(username, "PluginUpdate", info); err != nil {
+			s.log.Errorw("sending plugin update message", "user", username, zap.Error(err))
+		}
+	}
+}
+
+// Serves the newest plugin package of the platform
+func (s *Server) handleDownloadLatestPlugin(rootDir string) func(echo.Context) error {
+	return func(c echo.Context) error {
+		platform := c.Param("platform")
+		if platform == "" || strings.ContainsAny(platform, `/\`) || strings.HasPrefix(platform, ".") {
+			return echo.ErrNotFound
+		}
+		compatibility, err := pluginCompatibilityRange(rootDir)
+		if err != nil {
+			return err
+		}
+		latest, dir, err := latestPlugin(rootDir, platform, compatibility)
+		if err != nil {
+			return err
+		}
+		if dir == "" || latest.FileName == "" {
+			return echo.ErrNotFound
+		}
+		filename := filepath.Base(latest.FileName)
+		return c.Attachment(filepath.Join(dir, filename), filename)
+	}
+}
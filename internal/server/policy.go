@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/policy"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
+	"github.com/labstack/echo/v4"
+)
+
+// Builds environment (variables) for evaluation of access policy rules
+func policyEnv(c echo.Context, user domain.User, projectName string, pInfo domain.ProjectInfo, settings domain.ProjectSettings) map[string]interface{} {
+	req := c.Request()
+	params := make(map[string]interface{})
+	for k, v := range req.URL.Query() {
+		if len(v) > 0 {
+			params[strings.ToUpper(k)] = v[0]
+		}
+	}
+	headers := make(map[string]interface{})
+	for k, v := range req.Header {
+		if len(v) > 0 && k != "Cookie" && k != "Authorization" {
+			headers[k] = v[0]
+		}
+	}
+	roles := make([]interface{}, 0)
+	for _, r := range domain.FilterUserRoles(user, settings.Auth.Roles) {
+		roles = append(roles, r.Name)
+	}
+	profile := make(map[string]interface{}, len(user.Profile))
+	for k, v := range user.Profile {
+		profile[k] = v
+	}
+	return map[string]interface{}{
+		"user": map[string]interface{}{
+			"username":         user.Username,
+			"email":            user.Email,
+			"first_name":       user.FirstName,
+			"last_name":        user.LastName,
+			"is_superuser":     user.IsSuperuser,
+			"is_authenticated": user.IsAuthenticated,
+			"is_guest":         user.IsGuest,
+			"profile":          profile,
+			"roles":            roles,
+		},
+		"request": map[string]interface{}{
+			"method":  req.Method,
+			"path":    req.URL.Path,
+			"ip":      c.RealIP(),
+			"params":  params,
+			"headers": headers,
+		},
+		"project": map[string]interface{}{
+			"name":           projectName,
+			"owner":          filepath.Dir(projectName),
+			"title":          pInfo.Title,
+			"authentication": pInfo.Authentication,
+			"state":          pInfo.State,
+			"projection":     pInfo.Projection,
+			"size":           float64(pInfo.Size),
+			"created":        pInfo.Created.Format(time.RFC3339),
+			"last_update":    pInfo.LastUpdate.Format(time.RFC3339),
+		},
+	}
+}
+
+func evaluateAccessPolicy(c echo.Context, a *auth.AuthService, ps application.ProjectService, p *policy.Policy, target, projectName string, pInfo domain.ProjectInfo) (policy.Decision, error) {
+	if !p.HasRules(target) {
+		return policy.NoDecision, nil
+	}
+	user, err := a.GetUser(c)
+	if err != nil {
+		return policy.NoDecision, fmt.Errorf("getting user: %w", err)
+	}
+	settings, err := ps.GetSettings(projectName)
+	if err != nil {
+		return policy.NoDecision, fmt.Errorf("reading project settings: %w", err)
+	}
+	decision, _, err := p.Evaluate(target, policyEnv(c, user, projectName, pInfo, settings))
+	return decision, err
+}
+
+// Returns proper error for denied access (unauthorized for anonymous users)
+func policyDeniedError(c echo.Context, a *auth.AuthService) error {
+	if user, err := a.GetUser(c); err == nil && !user.IsAuthenticated {
+		return echo.ErrUnauthorized
+	}
+	return echo.ErrForbidden
+}
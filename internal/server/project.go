@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/sha1"
 	"errors"
 	"fmt"
 	"net/http"
@@ -9,6 +10,8 @@ import (
 	"strings"
 
 	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 )
@@ -39,12 +42,34 @@ func (s *Server) handleGetProject() func(c echo.Context) error {
 		if info.State != "published" {
 			return echo.NewHTTPError(http.StatusBadRequest, "Project not valid")
 		}
+		s.usage.Track(projectName)
+		s.stats.IncrProject(projectName, statsProjectLoads)
+
+		if capabilitiesOnly, _ := c.Get("capabilities_only").(bool); capabilitiesOnly {
+			return s.handleGetProjectCapabilities(c, projectName)
+		}
 
 		// if !s.checkProjectAccess(info, c) {
 		// 	return echo.ErrForbidden
 		// }
 
 		user, err := s.auth.GetUser(c)
+		notifications, err := s.notifications.GetMapProjectNotifications(projectName, user)
+		if err != nil {
+			s.log.Errorw("getting app notifications", zap.Error(err))
+			notifications = nil
+		}
+		version, err := s.projects.ConfigVersion(projectName)
+		if err != nil {
+			return fmt.Errorf("getting map config version: %w", err)
+		}
+		etag := mapConfigETag(version, user, notifications)
+		c.Response().Header().Set("ETag", etag)
+		c.Response().Header().Set("Cache-Control", "private, no-cache")
+		if etagMatches(c, etag) {
+			return c.NoContent(http.StatusNotModified)
+		}
+
 		data, err := s.projects.GetMapConfig(projectName, user)
 		if err != nil {
 			return err
@@ -57,10 +82,7 @@ func (s *Server) handleGetProject() func(c echo.Context) error {
 				data["app"] = cfg
 			}
 		}
-		notifications, err := s.notifications.GetMapProjectNotifications(projectName, user)
-		if err != nil {
-			s.log.Errorw("getting app notifications", zap.Error(err))
-		} else if len(notifications) > 0 {
+		if len(notifications) > 0 {
 			messages := make([]Notification, len(notifications))
 			for i, n := range notifications {
 				messages[i] = Notification{
@@ -71,6 +93,7 @@ func (s *Server) handleGetProject() func(c echo.Context) error {
 				data["notifications"] = messages
 			}
 		}
+		data["config_version"] = version
 		data["status"] = 200
 		// delete(data, "layers")
 		// return c.JSON(http.StatusOK, data["layers"])
@@ -78,9 +101,42 @@ func (s *Server) handleGetProject() func(c echo.Context) error {
 	}
 }
 
+// Map config items available with capabilities-only access (service description without layers data)
+var capabilitiesConfigKeys = []string{
+	"name", "title", "root_title", "projection", "projections", "units", "project_extent", "zoom_extent",
+	"scales", "attribution", "attribution_url", "license", "license_url", "ows_url", "ows_project",
+}
+
+func (s *Server) handleGetProjectCapabilities(c echo.Context, projectName string) error {
+	config, err := s.projects.GetMapConfig(projectName, auth.AnonymousUser)
+	if err != nil {
+		return err
+	}
+	data := make(map[string]interface{}, len(capabilitiesConfigKeys)+2)
+	for _, key := range capabilitiesConfigKeys {
+		if value, ok := config[key]; ok {
+			data[key] = value
+		}
+	}
+	data["capabilities_only"] = true
+	data["status"] = 200
+	return c.JSON(http.StatusOK, data)
+}
+
+// Map config depends on the project files, user (permissions and groups) and displayed notifications
+func mapConfigETag(version string, user domain.User, notifications []project.Notification) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s:%s:%t:%s", version, user.Username, user.IsAuthenticated, userGroupsHash(user))
+	for _, n := range notifications {
+		fmt.Fprintf(h, ":%s:%s:%s", n.ID, n.Title, n.Message)
+	}
+	return fmt.Sprintf(`W/"%x"`, h.Sum(nil))
+}
+
 func (s *Server) handleGetLayerCapabilities() func(c echo.Context) error {
 	director := func(req *http.Request) {}
 	reverseProxy := &httputil.ReverseProxy{Director: director}
+	reverseProxy.ErrorHandler = s.proxyErrorHandler("layer_capabilities")
 
 	return func(c echo.Context) error {
 		projectName := c.Get("project").(string)
@@ -106,7 +162,7 @@ func (s *Server) handleGetLayerCapabilities() func(c echo.Context) error {
 			if layer.Name == layername {
 				lmeta = layer
 				sourceURL := lmeta.SourceParams.String("url")
-				req, err := http.NewRequest(http.MethodGet, sourceURL, nil)
+				req, err := http.NewRequestWithContext(c.Request().Context(), http.MethodGet, sourceURL, nil)
 				if err != nil {
 					return fmt.Errorf("handleGetLayerCapabilities error: %w", err)
 				}
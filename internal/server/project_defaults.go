@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+var owsServices = domain.StringArray{"WMS", "WFS", "WMTS", "WCS"}
+
+// Instance-wide defaults merged into settings of new projects
+type ProjectDefaults struct {
+	BaseLayers  []string `json:"base_layers,omitempty"`
+	Services    []string `json:"services,omitempty"`
+	Access      string   `json:"access,omitempty"`
+	Attribution string   `json:"attribution,omitempty"`
+}
+
+// Returns defaults in the form of project settings
+func (d ProjectDefaults) Settings() map[string]interface{} {
+	settings := make(map[string]interface{})
+	if len(d.BaseLayers) > 0 {
+		settings["base_layers"] = d.BaseLayers
+	}
+	if len(d.Services) > 0 {
+		settings["services"] = d.Services
+	}
+	if d.Access != "" {
+		settings["auth"] = map[string]string{"type": d.Access}
+	}
+	if d.Attribution != "" {
+		settings["attribution"] = d.Attribution
+	}
+	return settings
+}
+
+func (s *Server) projectDefaultsPath() string {
+	return filepath.Join(s.Config.ProjectsRoot, "project_defaults.json")
+}
+
+func (s *Server) loadProjectDefaults() (ProjectDefaults, error) {
+	var defaults ProjectDefaults
+	data, err := os.ReadFile(s.projectDefaultsPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return defaults, nil
+		}
+		return defaults, err
+	}
+	if err := json.Unmarshal(data, &defaults); err != nil {
+		return defaults, err
+	}
+	return defaults, nil
+}
+
+// Saves instance defaults as initial settings of the new project
+func (s *Server) initProjectSettings(projectName string) error {
+	defaults, err := s.loadProjectDefaults()
+	if err != nil {
+		return fmt.Errorf("loading project defaults: %w", err)
+	}
+	settings := defaults.Settings()
+	if len(settings) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return s.projects.InitSettings(projectName, data)
+}
+
+// Fills settings which are not defined by the project with instance defaults
+func (s *Server) applyProjectDefaults(settings map[string]json.RawMessage) error {
+	defaults, err := s.loadProjectDefaults()
+	if err != nil {
+		return fmt.Errorf("loading project defaults: %w", err)
+	}
+	for key, value := range defaults.Settings() {
+		if _, ok := settings[key]; !ok {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			settings[key] = data
+		}
+	}
+	return nil
+}
+
+// Checks whether the OWS service is allowed by the project settings
+func serviceAllowed(settings domain.ProjectSettings, service string) bool {
+	if len(settings.Services) == 0 || service == "" {
+		return true
+	}
+	for _, s := range settings.Services {
+		if strings.EqualFold(s, service) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleGetProjectDefaults(c echo.Context) error {
+	defaults, err := s.loadProjectDefaults()
+	if err != nil {
+		return fmt.Errorf("loading project defaults: %w", err)
+	}
+	return c.JSON(http.StatusOK, defaults)
+}
+
+func (s *Server) handleSaveProjectDefaults(c echo.Context) error {
+	defaults := new(ProjectDefaults)
+	if err := (&echo.DefaultBinder{}).BindBody(c, defaults); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+	}
+	if defaults.Access != "" && !accessLevels.Has(defaults.Access) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid access level")
+	}
+	for i, service := range defaults.Services {
+		defaults.Services[i] = strings.ToUpper(service)
+		if !owsServices.Has(defaults.Services[i]) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid service: %s", service))
+		}
+	}
+	data, err := json.Marshal(defaults)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.projectDefaultsPath(), data, 0644); err != nil {
+		return fmt.Errorf("saving project defaults: %w", err)
+	}
+	s.log.Infow("project defaults updated", "defaults", defaults)
+	return c.JSON(http.StatusOK, defaults)
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	// minimal interval between notifications about republishing of the same project
+	projectPublishedNotificationInterval = time.Hour
+	// creators of the access grants are notified before the grant expires
+	accessGrantExpirationNotice = 3 * 24 * time.Hour
+)
+
+// Email notifications about project events, all are disabled by default
+type NotificationPreferences struct {
+	// project with assigned permissions was republished
+	ProjectPublished bool `json:"project_published"`
+	// user's permissions in the project were changed
+	PermissionsChanged bool `json:"permissions_changed"`
+	// access grant created by the user is about to expire
+	GrantExpiring bool `json:"grant_expiring"`
+	// weekly summary of the user's projects
+	WeeklyDigest bool `json:"weekly_digest"`
+}
+
+// Time of the last notification about republishing of the projects
+type projectNotifications struct {
+	mu        sync.Mutex
+	published map[string]time.Time
+}
+
+func newProjectNotifications() *projectNotifications {
+	return &projectNotifications{published: make(map[string]time.Time)}
+}
+
+// Reports whether users should be notified about republishing of the project (and records the time)
+func (n *projectNotifications) publishedNotificationDue(projectName string, now time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for name, t := range n.published {
+		if now.Sub(t) >= projectPublishedNotificationInterval {
+			delete(n.published, name)
+		}
+	}
+	if _, ok := n.published[projectName]; ok {
+		return false
+	}
+	n.published[projectName] = now
+	return true
+}
+
+func (s *Server) notificationPreferencesPath(username string) string {
+	return filepath.Join(s.Config.ProjectsRoot, username, "notifications.json")
+}
+
+func (s *Server) loadNotificationPreferences(username string) (NotificationPreferences, error) {
+	var prefs NotificationPreferences
+	data, err := os.ReadFile(s.notificationPreferencesPath(username))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return prefs, nil
+		}
+		return prefs, err
+	}
+	err = json.Unmarshal(data, &prefs)
+	return prefs, err
+}
+
+func (s *Server) handleGetNotificationPreferences(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	prefs, err := s.loadNotificationPreferences(user.Username)
+	if err != nil {
+		return fmt.Errorf("loading notification preferences: %w", err)
+	}
+	return c.JSON(http.StatusOK, prefs)
+}
+
+func (s *Server) handleSaveNotificationPreferences(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	prefs := new(NotificationPreferences)
+	if err := (&echo.DefaultBinder{}).BindBody(c, prefs); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+	}
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return err
+	}
+	path := s.notificationPreferencesPath(user.Username)
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return fmt.Errorf("saving notification preferences: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("saving notification preferences: %w", err)
+	}
+	return c.JSON(http.StatusOK, prefs)
+}
+
+// Sends notification email to the users who enabled it in their preferences
+func (s *Server) sendProjectNotification(usernames []string, enabled func(NotificationPreferences) bool, subject string, data map[string]interface{}) {
+	if !s.accountsService.SupportEmails() {
+		return
+	}
+	var recipients []domain.Account
+	for _, username := range usernames {
+		prefs, err := s.loadNotificationPreferences(username)
+		if err != nil {
+			s.log.Errorw("loading notification preferences", "user", username, zap.Error(err))
+			continue
+		}
+		if !enabled(prefs) {
+			continue
+		}
+		account, err := s.accountsService.Repository.GetByUsername(username)
+		if err != nil || !account.Active {
+			continue
+		}
+		recipients = append(recipients, account)
+	}
+	if len(recipients) == 0 {
+		return
+	}
+	tmpl, err := texttemplate.ParseFiles("./templates/project_notification_email.txt", "./templates/email_base.txt")
+	if err == nil {
+		err = s.accountsService.Email.SendBulkEmail(recipients, subject, nil, tmpl, data)
+	}
+	if err != nil {
+		s.log.Errorw("sending project notification email", "event", data["Event"], "project", data["Project"], zap.Error(err))
+	}
+}
+
+// Replaces groups (names with GroupRestrictionPrefix) by their members
+func (s *Server) expandGroupMembers(entries []string) []string {
+	users := make(domain.StringArray, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry, domain.GroupRestrictionPrefix) {
+			if !users.Has(entry) {
+				users = append(users, entry)
+			}
+			continue
+		}
+		if s.accountsService.Groups == nil {
+			continue
+		}
+		group, err := s.accountsService.Groups.Get(strings.TrimPrefix(entry, domain.GroupRestrictionPrefix))
+		if err != nil {
+			if !errors.Is(err, domain.ErrGroupNotFound) {
+				s.log.Errorw("reading group members", "group", entry, zap.Error(err))
+			}
+			continue
+		}
+		for _, u := range group.Members {
+			if !users.Has(u) {
+				users = append(users, u)
+			}
+		}
+	}
+	return users
+}
+
+func (s *Server) notifyProjectPublished(projectName string) {
+	if !s.accountsService.SupportEmails() || !s.notices.publishedNotificationDue(projectName, time.Now()) {
+		return
+	}
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		s.log.Errorw("reading project settings", "project", projectName, zap.Error(err))
+		return
+	}
+	owner := filepath.Dir(projectName)
+	var users []string
+	for _, u := range s.expandGroupMembers(settings.Auth.ProjectUsers()) {
+		if u != owner {
+			users = append(users, u)
+		}
+	}
+	data := map[string]interface{}{"Event": "published", "Project": projectName}
+	subject := fmt.Sprintf("Project %s was updated", projectName)
+	s.sendProjectNotification(users, func(p NotificationPreferences) bool { return p.ProjectPublished }, subject, data)
+}
+
+func (s *Server) notifyPermissionsChanged(projectName string, users []string) {
+	users = s.expandGroupMembers(users)
+	data := map[string]interface{}{"Event": "permissions", "Project": projectName}
+	subject := fmt.Sprintf("Your permissions in the project %s were changed", projectName)
+	s.sendProjectNotification(users, func(p NotificationPreferences) bool { return p.PermissionsChanged }, subject, data)
+}
+
+func (s *Server) notifyAccessGrantExpiring(projectName string, grant domain.AccessGrant) {
+	data := map[string]interface{}{
+		"Event":    "grant_expiring",
+		"Project":  projectName,
+		"Username": grant.Username,
+		"Role":     grant.Role,
+		"Expires":  grant.Expires.Format("2006-01-02 15:04 MST"),
+	}
+	subject := fmt.Sprintf("Temporary access to the project %s expires soon", projectName)
+	s.sendProjectNotification([]string{grant.GrantedBy}, func(p NotificationPreferences) bool { return p.GrantExpiring }, subject, data)
+}
+
+func (s *Server) subscribeProjectNotifications() {
+	s.events.Subscribe(application.EventProjectPublished, func(e application.Event) {
+		s.notifyProjectPublished(e.Project)
+	})
+	s.events.Subscribe(application.EventPermissionsChanged, func(e application.Event) {
+		data := e.Data.(application.PermissionsChangedData)
+		s.notifyPermissionsChanged(e.Project, data.Users)
+	})
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// non-standard status code (nginx) used when client closed the connection
+const StatusClientClosedRequest = 499
+
+var cancelledRequestsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "mapserver_cancelled_requests_total",
+		Help: "Counts map server requests cancelled by clients.",
+	},
+	[]string{"handler"},
+)
+
+func init() {
+	prometheus.MustRegister(cancelledRequestsCounter)
+}
+
+// Streaming settings of reverse proxies to the map server
+type ProxyConfig struct {
+	// flush interval of streamed responses (negative value flushes after each write)
+	FlushInterval time.Duration
+	// maximal size of map server responses for anonymous users (0 means unlimited)
+	AnonymousMaxResponse int64
+	// client headers forwarded to the map server and external services (names or prefixes ending
+	// with '*'), other headers (e.g. session cookies or credentials) are removed
+	AllowedHeaders []string
+}
+
+// Default allowlist of forwarded client headers
+var DefaultProxyAllowedHeaders = []string{
+	"Accept", "Accept-Encoding", "Accept-Language", "Content-Type", "Content-Length", "Content-Encoding",
+	"If-None-Match", "If-Modified-Since", "Range", "User-Agent", "X-Qgis-*",
+}
+
+// Headers set by the server itself for the map server requests (preserved by scrubbing)
+var internalProxyHeaders = []string{pgServiceHeader, "X-Ows-Url"}
+
+func headerAllowed(name string, allowed []string) bool {
+	for _, a := range allowed {
+		if strings.HasSuffix(a, "*") {
+			if prefix := strings.TrimSuffix(a, "*"); len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				return true
+			}
+		} else if strings.EqualFold(name, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// Removes client headers which are not in the allowlist (keep contains additional allowed headers)
+func (s *Server) scrubProxyHeaders(h http.Header, keep ...string) {
+	allowed := s.Config.Proxy.AllowedHeaders
+	if allowed == nil {
+		allowed = DefaultProxyAllowedHeaders
+	}
+	for name := range h {
+		if !headerAllowed(name, allowed) && !headerAllowed(name, keep) {
+			h.Del(name)
+		}
+	}
+}
+
+const proxyBufferSize = 32 * 1024
+
+var errResponseTooLarge = errors.New("response size exceeds limit")
+
+// Pool of copy buffers shared by reverse proxies (httputil.BufferPool)
+type proxyBufferPool struct {
+	pool sync.Pool
+}
+
+func (p *proxyBufferPool) Get() []byte {
+	if b, ok := p.pool.Get().(*[]byte); ok {
+		return *b
+	}
+	return make([]byte, proxyBufferSize)
+}
+
+func (p *proxyBufferPool) Put(b []byte) {
+	p.pool.Put(&b)
+}
+
+var proxyBuffers = &proxyBufferPool{}
+
+func (s *Server) configureProxyStreaming(rp *httputil.ReverseProxy) {
+	rp.FlushInterval = s.Config.Proxy.FlushInterval
+	rp.BufferPool = proxyBuffers
+}
+
+// Returns transport for the map server requests, connected through unix socket when configured
+// (URL of the map server is still used for the request path and Host header)
+func newMapserverTransport(base *http.Transport, socket string) http.RoundTripper {
+	if socket == "" {
+		return base
+	}
+	t := base.Clone()
+	t.Proxy = nil
+	t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socket)
+	}
+	return t
+}
+
+type responseLimitKey struct{}
+
+// Returns request with response size limit applied by limitResponseSize
+func withResponseLimit(req *http.Request, limit int64) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), responseLimitKey{}, limit))
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, errResponseTooLarge
+	}
+	return n, err
+}
+
+// Rejects responses larger than the limit of the request. Responses of unknown length
+// (chunked) are aborted when the limit is exceeded during streaming.
+func limitResponseSize(resp *http.Response) error {
+	limit, _ := resp.Request.Context().Value(responseLimitKey{}).(int64)
+	if limit <= 0 {
+		return nil
+	}
+	if resp.ContentLength > limit {
+		resp.Body.Close()
+		return errResponseTooLarge
+	}
+	if resp.ContentLength < 0 {
+		resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: limit}
+	}
+	return nil
+}
+
+// Returns error handler for reverse proxies to the map server. Requests aborted
+// by clients (cancelled context) are only counted, other errors are logged.
+func (s *Server) proxyErrorHandler(name string) func(http.ResponseWriter, *http.Request, error) {
+	return func(rw http.ResponseWriter, r *http.Request, e error) {
+		if errors.Is(e, context.Canceled) || errors.Is(r.Context().Err(), context.Canceled) {
+			cancelledRequestsCounter.WithLabelValues(name).Inc()
+			s.log.Debugw("mapserver request cancelled", "handler", name, "query", r.URL.RawQuery)
+			rw.WriteHeader(StatusClientClosedRequest)
+			return
+		}
+		if errors.Is(e, errRequestBodyTooLarge) || requestBodyExceeded(r) {
+			rw.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		if errors.Is(e, errResponseTooLarge) {
+			s.log.Infow("mapserver response too large", "handler", name, "query", r.URL.RawQuery)
+			msg := "Response is too large, please sign in or reduce the requested area"
+			if acceptsJSON(r) {
+				rw.Header().Set("Content-Type", "application/json")
+				rw.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(rw).Encode(OwsErrorResponse{Status: http.StatusForbidden, Errors: []OwsError{{Message: msg}}})
+			} else {
+				http.Error(rw, msg, http.StatusForbidden)
+			}
+			return
+		}
+		s.log.Errorw("mapserver proxy error", "handler", name, zap.Error(e))
+		s.stats.Incr(statsMapserverRequests)
+		s.stats.Incr(statsMapserverErrors)
+		rw.WriteHeader(http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Header with the ID of the publishing session (sent by the plugin with the publishing requests)
+const publishSessionHeader = "X-Publish-Session"
+
+// Exclusive publishing session of the project, held by the plugin connected over /ws/plugin
+type publishSession struct {
+	ID      string    `json:"id"`
+	Project string    `json:"project"`
+	User    string    `json:"user"`
+	Client  string    `json:"client,omitempty"`
+	Started time.Time `json:"started"`
+}
+
+type publishSessions struct {
+	mu       sync.Mutex
+	sessions map[string]*publishSession
+}
+
+func newPublishSessions() *publishSessions {
+	return &publishSessions{sessions: make(map[string]*publishSession)}
+}
+
+// Starts new session of the project. When the project has already active session, it's returned
+// and the new session is started only with takeover flag.
+func (p *publishSessions) acquire(project, user, client string, takeover bool) (*publishSession, *publishSession) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	current := p.sessions[project]
+	if current != nil && !takeover {
+		return nil, current
+	}
+	session := &publishSession{
+		ID:      uuid.Must(uuid.NewV4()).String(),
+		Project: project,
+		User:    user,
+		Client:  client,
+		Started: time.Now().UTC(),
+	}
+	p.sessions[project] = session
+	return session, current
+}
+
+// Ends the session (no-op when the session was already taken over)
+func (p *publishSessions) release(project, id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s := p.sessions[project]; s != nil && s.ID == id {
+		delete(p.sessions, project)
+		return true
+	}
+	return false
+}
+
+func (p *publishSessions) get(project string) *publishSession {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sessions[project]
+}
+
+func (s *Server) handlePluginWS(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	projectName := c.QueryParam("project")
+	var session *publishSession
+	header := http.Header{}
+	if projectName != "" {
+		owner, _, _ := strings.Cut(projectName, "/")
+		if err := checkProjectAdminAccess(s.projects, user, owner, projectName); err != nil {
+			return err
+		}
+		takeover, _ := strconv.ParseBool(c.QueryParam("takeover"))
+		var current *publishSession
+		session, current = s.publishSessions.acquire(projectName, user.Username, c.Request().UserAgent(), takeover)
+		if session == nil {
+			return echo.NewHTTPError(http.StatusConflict, map[string]interface{}{
+				"message": "Project is being published by another session",
+				"session": current,
+			})
+		}
+		if current != nil {
+			// previous publisher must stop, its running uploads are canceled
+			s.log.Infow("publishing session taken over", "project", projectName, "user", user.Username, "previous_user", current.User)
+			s.uploads.cancel(projectName)
+			if err := s.sws.PluginChannel().Send(current.User, "PublishSessionTakenOver", session); err != nil {
+				s.log.Errorw("sending session takeover message", "project", projectName, zap.Error(err))
+			}
+		}
+		header.Set(publishSessionHeader, session.ID)
+	}
+	err = s.sws.PluginHandler(user.Username, c.Response(), c.Request(), header, func() {
+		s.notifyPluginUpdate(c, user.Username)
+	})
+	if err != nil {
+		s.log.Errorw("websocket handler", "channel", "plugin", "user", user.Username, zap.Error(err))
+	}
+	if session != nil {
+		s.publishSessions.release(projectName, session.ID)
+	}
+	return nil
+}
+
+func (s *Server) handleGetPublishSession(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	session := s.publishSessions.get(projectName)
+	if session == nil {
+		return c.NoContent(http.StatusNoContent)
+	}
+	return c.JSON(http.StatusOK, session)
+}
+
+// Releases active publishing session of the project (e.g. after crash of the plugin)
+func (s *Server) handleReleasePublishSession(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	session := s.publishSessions.get(projectName)
+	if session == nil || !s.publishSessions.release(projectName, session.ID) {
+		return echo.ErrNotFound
+	}
+	s.uploads.cancel(projectName)
+	if err := s.sws.PluginChannel().Send(session.User, "PublishSessionTakenOver", nil); err != nil {
+		s.log.Errorw("sending session release message", "project", projectName, zap.Error(err))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// PublishSessionMiddleware rejects publishing requests of other clients when the project
+// has an active publishing session. Requests without session header (older plugins) are accepted
+// only from the user of the session.
+func PublishSessionMiddleware(s *Server) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			projectName := c.Get("project").(string)
+			session := s.publishSessions.get(projectName)
+			if session == nil {
+				return next(c)
+			}
+			if id := c.Request().Header.Get(publishSessionHeader); id != "" {
+				if id == session.ID {
+					return next(c)
+				}
+			} else if user, err := s.auth.GetUser(c); err == nil && user.Username == session.User {
+				return next(c)
+			}
+			return echo.NewHTTPError(http.StatusConflict, map[string]interface{}{
+				"message": "Project is being published by another session",
+				"session": session,
+			})
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	datasourceRegex    = regexp.MustCompile(`(?s)<datasource>(.*?)</datasource>`)
+	absolutePathsRegex = regexp.MustCompile(`(?s)(<Paths>\s*<Absolute[^>]*>)true(</Absolute>)`)
+	windowsPathRegex   = regexp.MustCompile(`^[a-zA-Z]:/`)
+)
+
+// Finds project file matching the longest suffix of the absolute path
+func matchProjectPath(absPath string, files map[string]bool) (string, bool) {
+	parts := strings.Split(strings.Trim(absPath, "/"), "/")
+	for i := range parts {
+		candidate := strings.Join(parts[i:], "/")
+		if files[candidate] {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// Rewrites absolute path in the datasource (file path is before '|' or '?' separators)
+// to the path relative to the baseDir (directory of the QGIS project file)
+func rewriteDatasource(ds string, files map[string]bool, baseDir string) string {
+	path := ds
+	prefix := ""
+	if strings.HasPrefix(path, "file://") {
+		prefix = "file://"
+		path = strings.TrimPrefix(path, prefix)
+	}
+	for _, vsi := range []string{"/vsizip/", "/vsigzip/", "/vsitar/"} {
+		if strings.HasPrefix(path, vsi) {
+			prefix += vsi
+			path = strings.TrimPrefix(path, vsi)
+			break
+		}
+	}
+	if i := strings.IndexAny(path, "|?"); i != -1 {
+		path = path[:i]
+	}
+	normalized := strings.ReplaceAll(path, "\\", "/")
+	if !strings.HasPrefix(normalized, "/") && !windowsPathRegex.MatchString(normalized) {
+		return ds
+	}
+	// archives accessed by GDAL virtual file systems can contain inner path
+	candidate := normalized
+	for candidate != "" && candidate != "/" && candidate != "." {
+		if rel, ok := matchProjectPath(candidate, files); ok {
+			if r, err := filepath.Rel(baseDir, rel); err == nil {
+				rel = filepath.ToSlash(r)
+			}
+			if !strings.HasPrefix(rel, "../") {
+				rel = "./" + rel
+			}
+			relPath := rel + strings.TrimPrefix(normalized, candidate)
+			suffix := strings.TrimPrefix(ds, prefix+path)
+			// relative paths of delimited text layers are in 'file:./path' format
+			return strings.Replace(prefix, "file://", "file:", 1) + relPath + suffix
+		}
+		candidate = filepath.ToSlash(filepath.Dir(candidate))
+	}
+	return ds
+}
+
+// Rewrites absolute datasource paths of the QGIS project to the paths relative to the project directory
+func rewriteQgisProject(content []byte, files map[string]bool, baseDir string) []byte {
+	content = datasourceRegex.ReplaceAllFunc(content, func(match []byte) []byte {
+		inner := datasourceRegex.FindSubmatch(match)[1]
+		ds := html.UnescapeString(string(inner))
+		rewritten := rewriteDatasource(ds, files, baseDir)
+		if rewritten == ds {
+			return match
+		}
+		return []byte("<datasource>" + xmlEscape(rewritten) + "</datasource>")
+	})
+	return absolutePathsRegex.ReplaceAll(content, []byte("${1}false${2}"))
+}
+
+// Rewrites QGIS project stored in .qgz archive
+func rewriteQgzProject(content []byte, files map[string]bool, baseDir string) ([]byte, error) {
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range r.File {
+		src, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(src)
+		src.Close()
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(filepath.Ext(f.Name), ".qgs") {
+			data = rewriteQgisProject(data, files, baseDir)
+		}
+		dest, err := w.CreateHeader(&zip.FileHeader{Name: f.Name, Method: f.Method, Modified: f.Modified})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := dest.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Streams zip archive with project files which can be opened directly in QGIS Desktop
+func (s *Server) downloadQgisBundle(c echo.Context, projectName string) error {
+	pInfo, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		return fmt.Errorf("getting project info: %w", err)
+	}
+	if pInfo.QgisFile == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Project does not contain QGIS project file")
+	}
+	projectFiles, _, err := s.projects.ListProjectFiles(projectName, false)
+	if err != nil {
+		return fmt.Errorf("listing project files: %w", err)
+	}
+	files := make(map[string]bool, len(projectFiles))
+	for _, f := range projectFiles {
+		p := filepath.ToSlash(f.Path)
+		files[p] = true
+		// directories (e.g. shapefile folders or GDAL datasets)
+		for dir := filepath.Dir(f.Path); dir != "."; dir = filepath.Dir(dir) {
+			files[filepath.ToSlash(dir)] = true
+		}
+	}
+
+	projectDir := filepath.Join(s.Config.ProjectsRoot, projectName)
+	name := filepath.Base(projectName)
+	c.Response().Header().Set("Content-Type", "application/octet-stream")
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", name))
+	writer := s.newZipWriter(c.Response())
+	defer writer.Close()
+
+	for _, f := range projectFiles {
+		path := filepath.Join(projectDir, f.Path)
+		archivePath := filepath.Join(name, f.Path)
+		if f.Path != pInfo.QgisFile {
+			info, err := os.Stat(path)
+			if err != nil {
+				return fmt.Errorf("getting file info: %w", err)
+			}
+			if err := s.addZipFile(writer, path, archivePath, info); err != nil {
+				return fmt.Errorf("adding file to archive: %w", err)
+			}
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading qgis project: %w", err)
+		}
+		if strings.EqualFold(filepath.Ext(path), ".qgz") {
+			content, err = rewriteQgzProject(content, files, filepath.Dir(pInfo.QgisFile))
+			if err != nil {
+				return fmt.Errorf("rewriting qgis project: %w", err)
+			}
+		} else {
+			content = rewriteQgisProject(content, files, filepath.Dir(pInfo.QgisFile))
+		}
+		dest, err := writer.CreateHeader(&zip.FileHeader{Name: filepath.ToSlash(archivePath), Method: s.zipMethod(path), Modified: time.Unix(f.Mtime, 0)})
+		if err != nil {
+			return err
+		}
+		if _, err := dest.Write(content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	stacVersion       = "1.0.0"
+	rasterInfoTimeout = 2 * time.Minute
+)
+
+var (
+	rasterExtensions = []string{".tif", ".tiff"}
+	wktEpsgRegex     = regexp.MustCompile(`ID\["EPSG",\s*(\d+)\]\s*\]\s*$`)
+)
+
+type RasterBand struct {
+	Name     string   `json:"name,omitempty"`
+	DataType string   `json:"data_type"`
+	NoData   *float64 `json:"nodata,omitempty"`
+	Color    string   `json:"color,omitempty"`
+}
+
+// Raster file info extracted by gdalinfo at upload
+type RasterInfo struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Mtime int64  `json:"mtime"`
+	// CRS code (e.g. EPSG:3857)
+	CRS    string       `json:"crs,omitempty"`
+	Width  int          `json:"width"`
+	Height int          `json:"height"`
+	BBox   []float64    `json:"bbox,omitempty"` // in raster's CRS
+	Bands  []RasterBand `json:"bands"`
+	COG    bool         `json:"cog"`
+	// footprint in WGS84 (GeoJSON geometry)
+	Footprint json.RawMessage `json:"footprint,omitempty"`
+}
+
+func isRasterFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range rasterExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) rastersIndexPath(projectName string) string {
+	return filepath.Join(s.Config.ProjectsRoot, projectName, ".gisquick", "rasters.json")
+}
+
+func (s *Server) loadRastersIndex(projectName string) (map[string]RasterInfo, error) {
+	index := make(map[string]RasterInfo)
+	data, err := os.ReadFile(s.rastersIndexPath(projectName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return index, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func parseGdalInfo(data []byte) (RasterInfo, error) {
+	var gi struct {
+		Size             []int `json:"size"`
+		CoordinateSystem struct {
+			Wkt string `json:"wkt"`
+		} `json:"coordinateSystem"`
+		Stac struct {
+			Epsg *int `json:"proj:epsg"`
+		} `json:"stac"`
+		CornerCoordinates map[string][]float64         `json:"cornerCoordinates"`
+		Wgs84Extent       json.RawMessage              `json:"wgs84Extent"`
+		Metadata          map[string]map[string]string `json:"metadata"`
+		Bands             []struct {
+			Type                string      `json:"type"`
+			Description         string      `json:"description"`
+			ColorInterpretation string      `json:"colorInterpretation"`
+			NoDataValue         interface{} `json:"noDataValue"` // number or "nan" string
+		} `json:"bands"`
+	}
+	var info RasterInfo
+	if err := json.Unmarshal(data, &gi); err != nil {
+		return info, err
+	}
+	if len(gi.Size) == 2 {
+		info.Width, info.Height = gi.Size[0], gi.Size[1]
+	}
+	if gi.Stac.Epsg != nil {
+		info.CRS = fmt.Sprintf("EPSG:%d", *gi.Stac.Epsg)
+	} else if m := wktEpsgRegex.FindStringSubmatch(gi.CoordinateSystem.Wkt); m != nil {
+		info.CRS = "EPSG:" + m[1]
+	}
+	ll, ur := gi.CornerCoordinates["lowerLeft"], gi.CornerCoordinates["upperRight"]
+	if len(ll) == 2 && len(ur) == 2 {
+		info.BBox = []float64{ll[0], ll[1], ur[0], ur[1]}
+	}
+	if len(gi.Wgs84Extent) > 0 && string(gi.Wgs84Extent) != "null" {
+		info.Footprint = gi.Wgs84Extent
+	}
+	info.COG = gi.Metadata["IMAGE_STRUCTURE"]["LAYOUT"] == "COG"
+	info.Bands = make([]RasterBand, len(gi.Bands))
+	for i, b := range gi.Bands {
+		info.Bands[i] = RasterBand{
+			Name:     b.Description,
+			DataType: strings.ToLower(b.Type),
+			Color:    strings.ToLower(b.ColorInterpretation),
+		}
+		if v, ok := b.NoDataValue.(float64); ok {
+			info.Bands[i].NoData = &v
+		}
+	}
+	return info, nil
+}
+
+func rasterInfo(ctx context.Context, path string) (RasterInfo, error) {
+	out, err := exec.CommandContext(ctx, "gdalinfo", "-json", path).Output()
+	if err != nil {
+		return RasterInfo{}, fmt.Errorf("gdalinfo: %w", err)
+	}
+	return parseGdalInfo(out)
+}
+
+// Extracts info of uploaded raster files and saves it into the project's rasters index
+func (s *Server) indexRasterFiles(projectName string, files []domain.ProjectFile) []RasterInfo {
+	ctx, cancel := context.WithTimeout(context.Background(), rasterInfoTimeout)
+	defer cancel()
+	items := make([]RasterInfo, 0, len(files))
+	for _, f := range files {
+		info, err := rasterInfo(ctx, filepath.Join(s.Config.ProjectsRoot, projectName, f.Path))
+		if err != nil {
+			s.log.Errorw("extracting raster info", "project", projectName, "file", f.Path, zap.Error(err))
+			continue
+		}
+		info.Path = f.Path
+		info.Size = f.Size
+		info.Mtime = f.Mtime
+		items = append(items, info)
+	}
+
+	s.rastersIndexMu.Lock()
+	defer s.rastersIndexMu.Unlock()
+	index, err := s.loadRastersIndex(projectName)
+	if err != nil {
+		s.log.Errorw("loading rasters index", "project", projectName, zap.Error(err))
+		index = make(map[string]RasterInfo)
+	}
+	for _, info := range items {
+		index[info.Path] = info
+	}
+	data, err := json.Marshal(index)
+	if err == nil {
+		err = os.WriteFile(s.rastersIndexPath(projectName), data, 0644)
+	}
+	if err != nil {
+		s.log.Errorw("saving rasters index", "project", projectName, zap.Error(err))
+	}
+	return items
+}
+
+// Returns indexed rasters which are still present in the project (with unchanged size)
+func (s *Server) projectRasters(projectName string) ([]RasterInfo, error) {
+	files, _, err := s.projects.ListProjectFiles(projectName, false)
+	if err != nil {
+		return nil, fmt.Errorf("listing project files: %w", err)
+	}
+	index, err := s.loadRastersIndex(projectName)
+	if err != nil {
+		return nil, fmt.Errorf("loading rasters index: %w", err)
+	}
+	rasters := make([]RasterInfo, 0, len(index))
+	for _, f := range files {
+		if info, ok := index[f.Path]; ok && info.Size == f.Size {
+			rasters = append(rasters, info)
+		}
+	}
+	sort.Slice(rasters, func(i, j int) bool { return rasters[i].Path < rasters[j].Path })
+	return rasters, nil
+}
+
+// Returns project file used as data source of the raster layer
+func rasterLayerFile(lmeta domain.LayerMeta) string {
+	if lmeta.Type != "RasterLayer" || lmeta.Provider != "gdal" {
+		return ""
+	}
+	source := lmeta.SourceParams.String("path")
+	if source == "" {
+		return ""
+	}
+	// path from the project created on Windows
+	return path.Clean(strings.ReplaceAll(source, "\\", "/"))
+}
+
+// Returns function which checks if the user can access the raster file. Raster is accessible when
+// the user can view some layer with the raster as data source, files which are not used by any
+// layer are accessible only in projects without roles.
+func rasterAccessCheck(user domain.User, settings domain.ProjectSettings, meta domain.QgisMeta) func(path string) bool {
+	userRoles := domain.FilterUserRoles(user, settings.Auth.Roles)
+	hasRoles := len(settings.Auth.Roles) > 0
+	return func(path string) bool {
+		used := false
+		for id, lmeta := range meta.Layers {
+			file := rasterLayerFile(lmeta)
+			// data source path can be absolute (local path on the publisher's machine)
+			if file == "" || (file != path && !strings.HasSuffix(file, "/"+path)) {
+				continue
+			}
+			used = true
+			lset := settings.Layers[id]
+			if lset.Flags.Has("excluded") || !lset.Roles.Allows(user, userRoles) {
+				continue
+			}
+			if !hasRoles || settings.UserLayerPermissionsFlags(user, id).Has("view") {
+				return true
+			}
+		}
+		return !used && !hasRoles
+	}
+}
+
+// Returns access check of the rasters in the project catalog, fails with Not Found error
+// when the catalog is not enabled
+func (s *Server) rasterCatalogAccess(c echo.Context, projectName string) (func(path string) bool, error) {
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return nil, fmt.Errorf("getting project settings: %w", err)
+	}
+	if !settings.RasterCatalog {
+		return nil, echo.ErrNotFound
+	}
+	var meta domain.QgisMeta
+	if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+		return nil, fmt.Errorf("parsing qgis meta: %w", err)
+	}
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return nil, err
+	}
+	return rasterAccessCheck(user, settings, meta), nil
+}
+
+// Bounding box of the GeoJSON polygon
+func footprintBBox(footprint json.RawMessage) []float64 {
+	var geom struct {
+		Coordinates [][][]float64 `json:"coordinates"`
+	}
+	if err := json.Unmarshal(footprint, &geom); err != nil || len(geom.Coordinates) == 0 {
+		return nil
+	}
+	var bbox []float64
+	for _, c := range geom.Coordinates[0] {
+		if len(c) < 2 {
+			continue
+		}
+		if bbox == nil {
+			bbox = []float64{c[0], c[1], c[0], c[1]}
+			continue
+		}
+		if c[0] < bbox[0] {
+			bbox[0] = c[0]
+		}
+		if c[1] < bbox[1] {
+			bbox[1] = c[1]
+		}
+		if c[0] > bbox[2] {
+			bbox[2] = c[0]
+		}
+		if c[1] > bbox[3] {
+			bbox[3] = c[1]
+		}
+	}
+	return bbox
+}
+
+func (s *Server) stacItem(projectName string, r RasterInfo) map[string]interface{} {
+	mediaType := "image/tiff; application=geotiff"
+	if r.COG {
+		mediaType += "; profile=cloud-optimized"
+	}
+	bands := make([]map[string]interface{}, len(r.Bands))
+	eoBands := make([]map[string]interface{}, len(r.Bands))
+	for i, b := range r.Bands {
+		bands[i] = map[string]interface{}{"data_type": b.DataType}
+		if b.NoData != nil {
+			bands[i]["nodata"] = *b.NoData
+		}
+		name := b.Name
+		if name == "" {
+			name = "b" + strconv.Itoa(i+1)
+		}
+		eoBands[i] = map[string]interface{}{"name": name}
+		if b.Color != "" && b.Color != "undefined" {
+			eoBands[i]["common_name"] = b.Color
+		}
+	}
+	properties := map[string]interface{}{
+		"datetime":   time.Unix(r.Mtime, 0).UTC().Format(time.RFC3339),
+		"proj:shape": []int{r.Height, r.Width},
+	}
+	if strings.HasPrefix(r.CRS, "EPSG:") {
+		if code, err := strconv.Atoi(strings.TrimPrefix(r.CRS, "EPSG:")); err == nil {
+			properties["proj:epsg"] = code
+		}
+	}
+	if r.BBox != nil {
+		properties["proj:bbox"] = r.BBox
+	}
+	var geometry interface{}
+	if r.Footprint != nil {
+		geometry = r.Footprint
+	}
+	return map[string]interface{}{
+		"type":         "Feature",
+		"stac_version": stacVersion,
+		"stac_extensions": []string{
+			"https://stac-extensions.github.io/projection/v1.1.0/schema.json",
+			"https://stac-extensions.github.io/raster/v1.1.0/schema.json",
+			"https://stac-extensions.github.io/eo/v1.1.0/schema.json",
+		},
+		"id":         r.Path,
+		"geometry":   geometry,
+		"bbox":       footprintBBox(r.Footprint),
+		"properties": properties,
+		"assets": map[string]interface{}{
+			"data": map[string]interface{}{
+				"href":         fmt.Sprintf("%s/api/project/stac/%s/data/%s", strings.TrimSuffix(s.Config.SiteURL, "/"), projectName, r.Path),
+				"type":         mediaType,
+				"roles":        []string{"data"},
+				"raster:bands": bands,
+				"eo:bands":     eoBands,
+			},
+		},
+		"links": []interface{}{},
+	}
+}
+
+func (s *Server) handleGetRasterCatalog(c echo.Context) error {
+	projectName := getProjectName(c)
+	allowed, err := s.rasterCatalogAccess(c, projectName)
+	if err != nil {
+		return err
+	}
+	rasters, err := s.projectRasters(projectName)
+	if err != nil {
+		return err
+	}
+	features := make([]map[string]interface{}, 0, len(rasters))
+	for _, r := range rasters {
+		if allowed(r.Path) {
+			features = append(features, s.stacItem(projectName, r))
+		}
+	}
+	data := map[string]interface{}{
+		"type":         "FeatureCollection",
+		"stac_version": stacVersion,
+		"features":     features,
+		"links": []map[string]string{
+			{"rel": "self", "href": fmt.Sprintf("%s/api/project/stac/%s", strings.TrimSuffix(s.Config.SiteURL, "/"), projectName)},
+		},
+	}
+	return c.JSON(http.StatusOK, data)
+}
+
+// Serves raster file with support of HTTP range requests (used by COG clients)
+func (s *Server) handleGetRasterData(c echo.Context) error {
+	projectName := getProjectName(c)
+	allowed, err := s.rasterCatalogAccess(c, projectName)
+	if err != nil {
+		return err
+	}
+	path := filepath.Clean(c.Param("*"))
+	if !isRasterFile(path) || !allowed(path) {
+		return echo.ErrNotFound
+	}
+	rasters, err := s.projectRasters(projectName)
+	if err != nil {
+		return err
+	}
+	for _, r := range rasters {
+		if r.Path == path {
+			return c.File(filepath.Join(s.Config.ProjectsRoot, projectName, path))
+		}
+	}
+	return echo.ErrNotFound
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+func rasterLayerMeta(id, path string) domain.LayerMeta {
+	source, _ := json.Marshal(path)
+	return domain.LayerMeta{Id: id, Type: "RasterLayer", Provider: "gdal", SourceParams: domain.QueryParams{"path": source}}
+}
+
+func TestRasterAccessCheck(t *testing.T) {
+	meta := domain.QgisMeta{
+		Layers: map[string]domain.LayerMeta{
+			"dem_1":    rasterLayerMeta("dem_1", "data/dem.tif"),
+			"ortho_2":  rasterLayerMeta("ortho_2", `C:\Users\gis\project\data\ortho.tif`),
+			"hidden_3": rasterLayerMeta("hidden_3", "data/excluded.tif"),
+		},
+	}
+	settings := domain.ProjectSettings{
+		Layers: map[string]domain.LayerSettings{
+			"dem_1":    {},
+			"ortho_2":  {Roles: domain.RolesRestriction{"officers"}},
+			"hidden_3": {Flags: domain.Flags{"excluded"}},
+		},
+	}
+	withRoles := settings
+	withRoles.Auth.Roles = []domain.ProjectRole{
+		{
+			Auth:        "users",
+			Name:        "officers",
+			Users:       []string{"officer"},
+			Permissions: domain.RolePermissions{Layers: map[string]domain.Flags{"dem_1": {"view"}, "ortho_2": {"view"}}},
+		},
+	}
+	tests := []struct {
+		name     string
+		user     domain.User
+		settings domain.ProjectSettings
+		path     string
+		expected bool
+	}{
+		{"public layer", testViewer, settings, "data/dem.tif", true},
+		{"unused file", testViewer, settings, "data/other.tif", true},
+		{"excluded layer", testViewer, settings, "data/excluded.tif", false},
+		{"restricted layer", testViewer, settings, "data/ortho.tif", false},
+		{"roles without permission", testViewer, withRoles, "data/dem.tif", false},
+		{"roles with permission", testOfficer, withRoles, "data/dem.tif", true},
+		{"restricted layer of the role", testOfficer, withRoles, "data/ortho.tif", true},
+		{"unused file with roles", testOfficer, withRoles, "data/other.tif", false},
+	}
+	for _, tt := range tests {
+		allowed := rasterAccessCheck(tt.user, tt.settings, meta)
+		if res := allowed(tt.path); res != tt.expected {
+			t.Errorf("%s: got %v, expected %v", tt.name, res, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const usageReportMonthFormat = "2006-01"
+
+// Aggregated usage of the user's projects in the reported month
+type UsageReportRow struct {
+	Username       string `json:"username"`
+	Email          string `json:"email"`
+	Active         bool   `json:"active"`
+	Projects       int    `json:"projects"`
+	ActiveProjects int    `json:"active_projects"`
+	StorageUsed    int64  `json:"storage_used"`
+	MapLoads       int64  `json:"map_loads"`
+	OwsRequests    int64  `json:"ows_requests"`
+	OwsErrors      int64  `json:"ows_errors"`
+}
+
+// Instance usage report for charge-back or capacity planning. Storage is the current usage
+// at the time of generating the report, other values are related to the reported month.
+type UsageReport struct {
+	Month     string           `json:"month"`
+	Generated time.Time        `json:"generated"`
+	Users     []UsageReportRow `json:"users"`
+	Total     UsageReportRow   `json:"total"`
+}
+
+// ParseReportMonth parses month in YYYY-MM format, current month is used when empty
+func ParseReportMonth(value string) (time.Time, error) {
+	if value == "" {
+		now := time.Now().UTC()
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	month, err := time.Parse(usageReportMonthFormat, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid month (expected YYYY-MM): %s", value)
+	}
+	return month, nil
+}
+
+// BuildUsageReport aggregates storage and requests statistics of the projects by their owners.
+// Statistics of already deleted projects are included in the requests counts of the owner.
+func BuildUsageReport(ctx context.Context, month time.Time, accounts []domain.Account, userProjects func(username string) ([]domain.ProjectInfo, error), stats *project.RedisRequestsStats) (UsageReport, error) {
+	counters, err := stats.ProjectMonthSums(ctx, month)
+	if err != nil {
+		return UsageReport{}, fmt.Errorf("getting projects stats: %w", err)
+	}
+	report := UsageReport{
+		Month:     month.Format(usageReportMonthFormat),
+		Generated: time.Now().UTC(),
+		Users:     make([]UsageReportRow, 0, len(accounts)),
+		Total:     UsageReportRow{Username: "total", Active: true},
+	}
+	for _, a := range accounts {
+		row := UsageReportRow{Username: a.Username, Email: a.Email, Active: a.Active}
+		projects, err := userProjects(a.Username)
+		if err != nil {
+			return report, fmt.Errorf("getting projects of user %s: %w", a.Username, err)
+		}
+		row.Projects = len(projects)
+		for _, p := range projects {
+			row.StorageUsed += p.Size
+			pc := counters[p.Name]
+			if pc[statsProjectLoads] > 0 || pc[statsProjectOwsRequests] > 0 {
+				row.ActiveProjects++
+			}
+		}
+		for name, pc := range counters {
+			if path.Dir(name) == a.Username {
+				row.MapLoads += pc[statsProjectLoads]
+				row.OwsRequests += pc[statsProjectOwsRequests]
+				row.OwsErrors += pc[statsProjectOwsErrors]
+			}
+		}
+		report.Users = append(report.Users, row)
+
+		report.Total.Projects += row.Projects
+		report.Total.ActiveProjects += row.ActiveProjects
+		report.Total.StorageUsed += row.StorageUsed
+		report.Total.MapLoads += row.MapLoads
+		report.Total.OwsRequests += row.OwsRequests
+		report.Total.OwsErrors += row.OwsErrors
+	}
+	sort.Slice(report.Users, func(i, j int) bool {
+		return report.Users[i].Username < report.Users[j].Username
+	})
+	return report, nil
+}
+
+// WriteCSV writes rows of the report (with the total row at the end) in CSV format
+func (r UsageReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"month", "username", "email", "active", "projects", "active_projects", "storage_used", "map_loads", "ows_requests", "ows_errors"})
+	writeRow := func(row UsageReportRow) {
+		cw.Write([]string{
+			r.Month,
+			row.Username,
+			row.Email,
+			strconv.FormatBool(row.Active),
+			strconv.Itoa(row.Projects),
+			strconv.Itoa(row.ActiveProjects),
+			strconv.FormatInt(row.StorageUsed, 10),
+			strconv.FormatInt(row.MapLoads, 10),
+			strconv.FormatInt(row.OwsRequests, 10),
+			strconv.FormatInt(row.OwsErrors, 10),
+		})
+	}
+	for _, row := range r.Users {
+		writeRow(row)
+	}
+	writeRow(r.Total)
+	cw.Flush()
+	return cw.Error()
+}
+
+func (s *Server) handleGetUsageReport(c echo.Context) error {
+	month, err := ParseReportMonth(c.QueryParam("month"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	format := strings.ToLower(c.QueryParam("format"))
+	if format != "" && format != "json" && format != "csv" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid format")
+	}
+	ctx := c.Request().Context()
+	if err := s.stats.Flush(ctx); err != nil {
+		s.log.Errorw("saving requests stats", zap.Error(err))
+	}
+	accounts, err := s.accountsService.GetAllAccounts()
+	if err != nil {
+		return fmt.Errorf("getting accounts: %w", err)
+	}
+	report, err := BuildUsageReport(ctx, month, accounts, s.projects.GetUserProjects, s.stats)
+	if err != nil {
+		return err
+	}
+	if format == "csv" {
+		filename := fmt.Sprintf("gisquick-usage-%s.csv", report.Month)
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+		c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+		c.Response().WriteHeader(http.StatusOK)
+		return report.WriteCSV(c.Response())
+	}
+	return c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,479 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/security"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/xlsx"
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	reportJobTimeout     = 10 * time.Minute
+	reportLinkExpiration = 24 * time.Hour
+)
+
+// ReportJob describes generation of an attribute report defined by template in project settings
+type ReportJob struct {
+	ID       string    `json:"id"`
+	Project  string    `json:"project"`
+	Report   string    `json:"report"`
+	User     string    `json:"user"`
+	Format   string    `json:"format"`
+	Language string    `json:"lang"`
+	Notify   bool      `json:"notify"`
+	Status   string    `json:"status"`
+	Created  time.Time `json:"created"`
+	Finished time.Time `json:"finished,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	// report columns (template fields visible to the user)
+	Fields []string `json:"fields"`
+	// WFS limit of the user
+	limit domain.WfsLimit
+}
+
+func (s *Server) reportJobsDir() jobsDir {
+	return jobsDir(s.Config.ReportsRoot)
+}
+
+func (s *Server) loadReportJob(id string) (*ReportJob, error) {
+	job := new(ReportJob)
+	if err := s.reportJobsDir().load(id, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *Server) reportLinkTokens() *security.TokenGenerator {
+	return security.NewTokenGenerator(s.Config.SecretKey, "report", reportLinkExpiration)
+}
+
+func (job *ReportJob) fileName() string {
+	return "report." + job.Format
+}
+
+func (s *Server) reportDownloadURL(job *ReportJob) (string, error) {
+	token, err := s.reportLinkTokens().GenerateToken(job.ID)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("/api/report/download/%s?token=%s", job.ID, token), nil
+}
+
+// Returns localized column header with fallback to the default language, attribute alias and name
+func reportFieldHeader(field domain.ReportField, lmeta domain.LayerMeta, languages ...string) string {
+	for _, lang := range languages {
+		if h, ok := field.Headers[lang]; ok {
+			return h
+		}
+		if base, _, found := strings.Cut(lang, "-"); found {
+			if h, ok := field.Headers[base]; ok {
+				return h
+			}
+		}
+	}
+	for _, a := range lmeta.Attributes {
+		if a.Name == field.Name && a.Alias != "" {
+			return a.Alias
+		}
+	}
+	return field.Name
+}
+
+func compareReportValues(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return 1 // null values at the end
+		default:
+			return -1
+		}
+	}
+	if na, ok := a.(json.Number); ok {
+		if nb, ok := b.(json.Number); ok {
+			fa, erra := na.Float64()
+			fb, errb := nb.Float64()
+			if erra == nil && errb == nil {
+				switch {
+				case fa < fb:
+					return -1
+				case fa > fb:
+					return 1
+				}
+				return 0
+			}
+		}
+	}
+	return strings.Compare(formatReportValue(a), formatReportValue(b))
+}
+
+func formatReportValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case bool:
+		if val {
+			return "true"
+		}
+		return "false"
+	default:
+		data, _ := json.Marshal(val)
+		return string(data)
+	}
+}
+
+// Fetches attributes of all layer features from the map server
+func (s *Server) fetchReportFeatures(ctx context.Context, projectName, typeName string, fields []string, limit domain.WfsLimit) ([]map[string]interface{}, error) {
+	pInfo, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Config.MapserverURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("building request: %w", err)
+	}
+	params := url.Values{
+		"MAP":          {s.owsProjectPath(projectName, pInfo.QgisFile)},
+		"SERVICE":      {"WFS"},
+		"VERSION":      {"1.1.0"},
+		"REQUEST":      {"GetFeature"},
+		"TYPENAME":     {typeName},
+		"PROPERTYNAME": {strings.Join(fields, ",")},
+		"OUTPUTFORMAT": {"GeoJSON"},
+	}
+	if limit.MaxFeatures > 0 {
+		limitWfsQueryFeatures(params, limit.MaxFeatures)
+	}
+	req.URL.RawQuery = params.Encode()
+	s.setPgServiceHeader(req, projectName)
+	resp, err := s.mapserver.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("mapserver request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("mapserver response status: %d", resp.StatusCode)
+	}
+	var collection struct {
+		Features []struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	data, err := readLimitedResponse(resp, limit.MaxResponseSize)
+	if errors.Is(err, errResponseTooLarge) {
+		return nil, fmt.Errorf("report data exceeds size limit")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&collection); err != nil {
+		return nil, fmt.Errorf("parsing features: %w", err)
+	}
+	features := make([]map[string]interface{}, len(collection.Features))
+	for i, f := range collection.Features {
+		features[i] = f.Properties
+	}
+	return features, nil
+}
+
+func (s *Server) runReportJob(ctx context.Context, job *ReportJob) error {
+	settings, err := s.projects.GetSettings(job.Project)
+	if err != nil {
+		return fmt.Errorf("getting project settings: %w", err)
+	}
+	template, ok := settings.Reports[job.Report]
+	if !ok {
+		return fmt.Errorf("report template not found: %s", job.Report)
+	}
+	var meta domain.QgisMeta
+	if err := s.projects.GetQgisMetadata(job.Project, &meta); err != nil {
+		return fmt.Errorf("parsing qgis meta: %w", err)
+	}
+	lmeta, ok := meta.Layers[template.Layer]
+	if !ok {
+		return fmt.Errorf("report layer not found: %s", template.Layer)
+	}
+	typeName := strings.ReplaceAll(lmeta.Name, " ", "_")
+	features, err := s.fetchReportFeatures(ctx, job.Project, typeName, job.Fields, job.limit)
+	if err != nil {
+		return err
+	}
+	if len(template.OrderBy) > 0 {
+		sort.SliceStable(features, func(i, j int) bool {
+			for _, o := range template.OrderBy {
+				c := compareReportValues(features[i][o.Field], features[j][o.Field])
+				if c != 0 {
+					return (c < 0) != o.Desc
+				}
+			}
+			return false
+		})
+	}
+
+	visible := make(map[string]bool, len(job.Fields))
+	for _, name := range job.Fields {
+		visible[name] = true
+	}
+	var header []string
+	for _, f := range template.Fields {
+		if visible[f.Name] {
+			header = append(header, reportFieldHeader(f, lmeta, job.Language, s.Config.Language))
+		}
+	}
+
+	f, err := os.Create(filepath.Join(s.reportJobsDir().path(job.ID), job.fileName()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if job.Format == "xlsx" {
+		rows := make([][]interface{}, len(features))
+		for i, feature := range features {
+			row := make([]interface{}, len(job.Fields))
+			for j, name := range job.Fields {
+				row[j] = feature[name]
+			}
+			rows[i] = row
+		}
+		title := template.Title
+		if title == "" {
+			title = job.Report
+		}
+		return xlsx.Write(f, title, header, rows)
+	}
+	// UTF-8 BOM for correct encoding detection in spreadsheet applications
+	if _, err := f.WriteString("\uFEFF"); err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(job.Fields))
+	for _, feature := range features {
+		for j, name := range job.Fields {
+			record[j] = formatReportValue(feature[name])
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func (s *Server) sendReportEmail(job *ReportJob) error {
+	account, err := s.accountsService.Repository.GetByUsername(job.User)
+	if err != nil {
+		return err
+	}
+	link, err := s.reportDownloadURL(job)
+	if err != nil {
+		return err
+	}
+	tmpl, err := texttemplate.ParseFiles("./templates/report_email.txt", "./templates/email_base.txt")
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"Project":      job.Project,
+		"Report":       job.Report,
+		"DownloadLink": strings.TrimSuffix(s.Config.SiteURL, "/") + link,
+		"Expiration":   reportLinkExpiration,
+	}
+	subject := fmt.Sprintf("Gisquick report %s", job.Report)
+	return s.accountsService.Email.SendBulkEmail([]domain.Account{account}, subject, nil, tmpl, data)
+}
+
+func (s *Server) processReportJob(job *ReportJob) {
+	run := func(ctx context.Context) error {
+		return s.runReportJob(ctx, job)
+	}
+	stop := s.reportJobsDir().keepAlive(job.ID)
+	defer stop()
+	err := s.reportJobs.Run(run, func(status string, err error) {
+		job.Status = status
+		if status != JobRunning {
+			job.Finished = time.Now().UTC()
+		}
+		if err != nil {
+			job.Error = "Report generation failed"
+		}
+		if err := s.reportJobsDir().save(job.ID, job); err != nil {
+			s.log.Errorw("saving report job", "id", job.ID, zap.Error(err))
+		}
+	})
+	if err != nil {
+		s.log.Errorw("report generation", "project", job.Project, "report", job.Report, "id", job.ID, zap.Error(err))
+		return
+	}
+	if job.Notify {
+		if err := s.sendReportEmail(job); err != nil {
+			s.log.Errorw("sending report email", "user", job.User, "id", job.ID, zap.Error(err))
+		}
+	}
+}
+
+func (s *Server) handleCreateReport() func(echo.Context) error {
+	type Form struct {
+		Format   string `json:"format"`
+		Language string `json:"lang"`
+		Notify   bool   `json:"notify"`
+	}
+	return func(c echo.Context) error {
+		projectName := getProjectName(c)
+		form := new(Form)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		if form.Format == "" {
+			form.Format = "csv"
+		}
+		if form.Format != "csv" && form.Format != "xlsx" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid report format")
+		}
+		settings, err := s.projects.GetSettings(projectName)
+		if err != nil {
+			return fmt.Errorf("getting project settings: %w", err)
+		}
+		template, ok := settings.Reports[c.Param("report")]
+		if !ok {
+			return echo.ErrNotFound
+		}
+		var meta domain.QgisMeta
+		if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+			return fmt.Errorf("parsing qgis meta: %w", err)
+		}
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		if form.Notify && !user.IsAuthenticated {
+			return echo.NewHTTPError(http.StatusBadRequest, "Email notification is available only for registered users")
+		}
+		userRoles := domain.FilterUserRoles(user, settings.Auth.Roles)
+		lmeta, ok := meta.Layers[template.Layer]
+		lset := settings.Layers[template.Layer]
+		if !ok || lmeta.Type != "VectorLayer" || !lmeta.Flags.Has("query") || lset.Flags.Has("excluded") || lset.Flags.Has("hidden") {
+			return echo.ErrNotFound
+		}
+		if !template.Roles.Allows(user, userRoles) || !lset.Roles.Allows(user, userRoles) {
+			return echo.ErrForbidden
+		}
+		var attrsFlags map[string]domain.Flags
+		if len(settings.Auth.Roles) > 0 {
+			if !settings.UserLayerPermissionsFlags(user, template.Layer).Has("query") {
+				return echo.ErrForbidden
+			}
+			attrsFlags = settings.UserLayerAttrinutesFlags(user, template.Layer)
+		}
+		job := &ReportJob{
+			Project:  projectName,
+			Report:   c.Param("report"),
+			User:     user.Username,
+			Format:   form.Format,
+			Language: form.Language,
+			Notify:   form.Notify,
+			Status:   JobPending,
+			Created:  time.Now().UTC(),
+			limit:    userWfsLimit(settings, user),
+		}
+		if job.Language == "" {
+			job.Language = s.Config.Language
+		}
+		for _, f := range template.Fields {
+			if attrsFlags == nil || attrsFlags[f.Name].Has("view") {
+				job.Fields = append(job.Fields, f.Name)
+			}
+		}
+		if len(job.Fields) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "No fields to export")
+		}
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		job.ID = id.String()
+		if err := s.reportJobsDir().create(job.ID); err != nil {
+			return fmt.Errorf("creating report job directory: %w", err)
+		}
+		if err := s.reportJobsDir().save(job.ID, job); err != nil {
+			return fmt.Errorf("saving report job: %w", err)
+		}
+		go s.processReportJob(job)
+		return c.JSON(http.StatusAccepted, job)
+	}
+}
+
+func (s *Server) handleGetReport(c echo.Context) error {
+	type Payload struct {
+		*ReportJob
+		DownloadURL string `json:"download_url,omitempty"`
+	}
+	projectName := getProjectName(c)
+	job, err := s.loadReportJob(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return echo.ErrNotFound
+		}
+		return fmt.Errorf("loading report job: %w", err)
+	}
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	if job.Project != projectName || job.User != user.Username {
+		return echo.ErrNotFound
+	}
+	data := Payload{ReportJob: job}
+	if job.Status == JobDone {
+		data.DownloadURL, err = s.reportDownloadURL(job)
+		if err != nil {
+			return fmt.Errorf("generating download token: %w", err)
+		}
+	}
+	return c.JSON(http.StatusOK, data)
+}
+
+func (s *Server) handleDownloadReport(c echo.Context) error {
+	id := c.Param("id")
+	if err := s.reportLinkTokens().CheckToken(c.QueryParam("token"), id); err != nil {
+		return echo.ErrForbidden
+	}
+	job, err := s.loadReportJob(id)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return echo.ErrNotFound
+		}
+		return fmt.Errorf("loading report job: %w", err)
+	}
+	if job.Status != JobDone {
+		return echo.ErrNotFound
+	}
+	name := fmt.Sprintf("%s_%s.%s", strings.ReplaceAll(job.Project, "/", "_"), job.Report, job.Format)
+	return c.Attachment(filepath.Join(s.reportJobsDir().path(id), job.fileName()), name)
+}
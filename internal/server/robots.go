@@ -0,0 +1,226 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/security"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Default pattern of user agents blocked on OWS endpoints of projects with enabled bots blocking
+const DefaultBotUserAgents = `(?i)(bot\b|crawl|spider|slurp|scrapy|python-requests|wget|headlesschrome|phantomjs)`
+
+type RobotsConfig struct {
+	BotUserAgents *regexp.Regexp
+	// validity of the map tokens issued to the map viewer
+	MapTokenExpiration time.Duration
+}
+
+const robotsTxtTTL = 10 * time.Minute
+
+type robotsTxtCache struct {
+	mu      sync.Mutex
+	content string
+	updated time.Time
+}
+
+// Kinds of map routes protected by the project robots settings
+const (
+	mapRouteProject = iota
+	mapRouteOWS
+	mapRouteOther
+)
+
+func (s *Server) mapTokens() *security.TokenGenerator {
+	return security.NewTokenGenerator(s.Config.SecretKey, "map", s.Config.Robots.MapTokenExpiration)
+}
+
+// Map token is stored in cookie (per project), so it's sent also with tiles requested by image elements
+func mapTokenCookieName(projectName string) string {
+	return fmt.Sprintf("gq_map_%x", sha1.Sum([]byte(projectName)))[:19]
+}
+
+func (s *Server) issueMapToken(c echo.Context, projectName string) error {
+	token, err := s.mapTokens().GenerateToken(projectName)
+	if err != nil {
+		return fmt.Errorf("generating map token: %w", err)
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     mapTokenCookieName(projectName),
+		Value:    token,
+		Path:     "/api/map/",
+		MaxAge:   int(s.Config.Robots.MapTokenExpiration.Seconds()),
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	// for viewers embedded on other sites, where cookies are not available
+	c.Response().Header().Set("X-Map-Token", token)
+	return nil
+}
+
+// Returns map token sent in the cookie, header or MAP_TOKEN query parameter (which is removed from the request)
+func takeMapToken(c echo.Context, projectName string) string {
+	req := c.Request()
+	query := req.URL.Query()
+	for param, values := range query {
+		if strings.EqualFold(param, "MAP_TOKEN") {
+			query.Del(param)
+			req.URL.RawQuery = query.Encode()
+			if len(values) > 0 {
+				return values[0]
+			}
+		}
+	}
+	if token := req.Header.Get("X-Map-Token"); token != "" {
+		req.Header.Del("X-Map-Token")
+		return token
+	}
+	if cookie, err := req.Cookie(mapTokenCookieName(projectName)); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+func isTileRequest(query url.Values) bool {
+	request := owsValue(query, "REQUEST")
+	return strings.EqualFold(request, "GetMap") || strings.EqualFold(request, "GetTile")
+}
+
+// Returns parameters of the OWS request including parameters of the POST request body,
+// the body is left unconsumed for the OWS handler
+func owsRequestQuery(req *http.Request) (url.Values, error) {
+	query := req.URL.Query()
+	if req.Method != http.MethodPost {
+		return query, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	setRequestBody(req, body)
+	r := req.Clone(req.Context())
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if _, err := readOwsPostRequest(r, query); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// Applies robots settings of the project (indexing, blocking of bots and map tokens)
+func (s *Server) robotsMiddleware(route int) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			projectName := getProjectName(c)
+			settings, err := s.projects.GetSettings(projectName)
+			if err != nil || settings.Robots == nil {
+				// errors are handled by the route handler
+				return next(c)
+			}
+			robots := settings.Robots
+			if robots.NoIndex {
+				c.Response().Header().Set("X-Robots-Tag", "noindex, nofollow")
+			}
+			switch route {
+			case mapRouteProject:
+				if robots.RequireToken {
+					if err := s.issueMapToken(c, projectName); err != nil {
+						return err
+					}
+				}
+			case mapRouteOWS:
+				if robots.BlockBots && s.Config.Robots.BotUserAgents != nil && s.Config.Robots.BotUserAgents.MatchString(c.Request().UserAgent()) {
+					return echo.NewHTTPError(http.StatusForbidden, "Automated clients are not allowed")
+				}
+				token := takeMapToken(c, projectName)
+				if !robots.RequireToken {
+					break
+				}
+				query, err := owsRequestQuery(c.Request())
+				if errors.Is(err, errRequestBodyTooLarge) {
+					return echo.NewHTTPError(http.StatusRequestEntityTooLarge)
+				}
+				if err != nil {
+					return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body").SetInternal(err)
+				}
+				if token == "" {
+					token = owsValue(query, "MAP_TOKEN")
+				}
+				if isTileRequest(query) {
+					user, err := s.auth.GetUser(c)
+					if err != nil {
+						return err
+					}
+					if !user.IsAuthenticated && s.mapTokens().CheckToken(token, projectName) != nil {
+						return echo.NewHTTPError(http.StatusForbidden, "Invalid or expired map token")
+					}
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+func (s *Server) buildRobotsTxt() (string, error) {
+	projects, err := s.projects.AccessibleProjects(domain.User{}, true)
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, p := range projects {
+		if p.Authentication != "public" {
+			continue
+		}
+		settings, err := s.projects.GetSettings(p.Name)
+		if err != nil {
+			s.log.Errorw("reading project settings", "project", p.Name, zap.Error(err))
+			continue
+		}
+		if settings.Robots != nil && settings.Robots.NoIndex {
+			names = append(names, p.Name)
+		}
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	sb.WriteString("User-agent: *\n")
+	if len(names) == 0 {
+		sb.WriteString("Disallow:\n")
+	}
+	for _, name := range names {
+		fmt.Fprintf(&sb, "Disallow: /?PROJECT=%s\n", name)
+		fmt.Fprintf(&sb, "Disallow: /maps/%s\n", name)
+		fmt.Fprintf(&sb, "Disallow: /api/map/project/%s\n", name)
+		fmt.Fprintf(&sb, "Disallow: /api/map/ows/%s\n", name)
+		fmt.Fprintf(&sb, "Disallow: /ows/%s\n", name)
+		fmt.Fprintf(&sb, "Disallow: /api/project/thumbnail/%s\n", name)
+	}
+	return sb.String(), nil
+}
+
+func (s *Server) handleRobotsTxt(c echo.Context) error {
+	cache := s.robotsTxt
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.updated.IsZero() || time.Since(cache.updated) > robotsTxtTTL {
+		content, err := s.buildRobotsTxt()
+		if err != nil {
+			return fmt.Errorf("building robots.txt: %w", err)
+		}
+		cache.content = content
+		cache.updated = time.Now()
+	}
+	return c.String(http.StatusOK, cache.content)
+}
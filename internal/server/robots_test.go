@@ -0,0 +1,27 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOwsRequestQueryPostBody(t *testing.T) {
+	body := "SERVICE=WMS&REQUEST=GetMap&LAYERS=parks"
+	req := httptest.NewRequest(http.MethodPost, "/api/map/ows/user/project?SERVICE=WMS", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	query, err := owsRequestQuery(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isTileRequest(query) {
+		t.Errorf("GetMap request in the body not detected: %v", query)
+	}
+	// body is left for the OWS handler
+	data, _ := io.ReadAll(req.Body)
+	if string(data) != body || req.Method != http.MethodPost || req.Header.Get("Content-Type") == "" {
+		t.Errorf("request was modified: %s %s", req.Method, data)
+	}
+}
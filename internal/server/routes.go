@@ -16,12 +16,44 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 	SuperuserRequired := SuperuserAccessMiddleware(s.auth)
 	ProjectAdminAccess := ProjectAdminAccessMiddleware(s.auth, s.projects)
 	ProjectSuperuserAccess := ProjectSuperuserAccessMiddleware(s.auth, s.projects)
-	ProjectAccess := ProjectAccessMiddleware(s.auth, s.projects, "")
-	ProjectAccessOWS := ProjectAccessMiddleware(s.auth, s.projects, "basic realm=Restricted")
+	ProjectAccess := ProjectAccessMiddleware(s.auth, s.projects, s.Config.AccessPolicy, s.Config.Hooks, "")
+	ProjectAccessOWS := ProjectAccessMiddleware(s.auth, s.projects, s.Config.AccessPolicy, s.Config.Hooks, "basic realm=Restricted")
+	EmbedHeaders := EmbedHeadersMiddleware(s.Config.Security)
+	UntrustedContent := UntrustedContentMiddleware()
+	UploadBandwidth := UploadBandwidthMiddleware(s.auth, s.bandwidth)
+	DownloadBandwidth := DownloadBandwidthMiddleware(s.auth, s.bandwidth)
+	UploadLimit := RequestLimitMiddleware(s.Config.Limits.Upload)
+	OWSLimit := RequestLimitMiddleware(s.Config.Limits.OWS)
+	MediaLimit := RequestLimitMiddleware(s.Config.Limits.Media)
+	AnonymousLimit := AnonymousRateLimitMiddleware(s.auth, s.anonymous)
+	RobotsProject := s.robotsMiddleware(mapRouteProject)
+	RobotsOWS := s.robotsMiddleware(mapRouteOWS)
+	Robots := s.robotsMiddleware(mapRouteOther)
+	PublishSession := PublishSessionMiddleware(s)
+
+	e.GET("/robots.txt", s.handleRobotsTxt)
+	if s.Config.MapPages {
+		e.GET("/maps", s.handleMapsCatalogPage)
+		e.GET("/maps/:user/:name", s.handleMapPage)
+	}
+	e.GET("/api/health", s.handleHealth)
 
 	e.POST("/api/auth/login", s.handleLogin())
 	e.POST("/api/auth/logout", s.handleLogout)
 	e.GET("/api/auth/logout", s.handleLogout) // Just for compatibility!!!
+	if s.Config.OIDC != nil {
+		e.GET("/api/auth/oidc/login", s.handleOIDCLogin)
+		e.GET("/api/auth/oidc/callback", s.handleOIDCCallback)
+		e.GET("/api/auth/oidc/link", s.handleOIDCLink, LoginRequired)
+		e.GET("/api/account/identities", s.handleGetIdentities, LoginRequired)
+		e.DELETE("/api/account/identities/:subject", s.handleUnlinkIdentity, LoginRequired)
+		e.GET("/api/admin/users/:user/identities", s.handleAdminGetIdentities, SuperuserRequired)
+		e.POST("/api/admin/users/:user/identities", s.handleAdminLinkIdentity(), SuperuserRequired)
+		e.DELETE("/api/admin/users/:user/identities/:subject", s.handleAdminUnlinkIdentity, SuperuserRequired)
+	}
+
+	e.GET("/api/setup", s.handleGetSetup)
+	e.POST("/api/setup", s.handleSetup())
 
 	e.GET("/api/users", s.handleGetUsers, LoginRequired)
 
@@ -35,9 +67,39 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 	e.POST("/api/admin/email_preview", s.handleGetEmailPreview(), SuperuserRequired)
 	e.POST("/api/admin/email", s.handleSendEmail(), SuperuserRequired)
 	e.POST("/api/admin/send_activation_email", s.handleSendActivationEmail(), SuperuserRequired)
+	e.GET("/api/admin/invitations", s.handleGetInvitations, SuperuserRequired)
+	e.POST("/api/admin/invitations", s.handleCreateInvitation(), SuperuserRequired)
+	e.DELETE("/api/admin/invitations/:id", s.handleDeleteInvitation, SuperuserRequired)
+	e.GET("/api/admin/groups", s.handleGetGroups, SuperuserRequired)
+	e.POST("/api/admin/groups", s.handleCreateGroup(), SuperuserRequired)
+	e.GET("/api/admin/groups/:name", s.handleGetGroup, SuperuserRequired)
+	e.PUT("/api/admin/groups/:name", s.handleUpdateGroup(), SuperuserRequired)
+	e.DELETE("/api/admin/groups/:name", s.handleDeleteGroup, SuperuserRequired)
 	e.GET("/api/admin/notifications", s.handleGetNotifications, SuperuserRequired)
 	e.POST("/api/admin/notification", s.handleSaveNotification, SuperuserRequired)
 	e.DELETE("/api/admin/notification/:id", s.handleDeleteNotification, SuperuserRequired)
+	e.GET("/api/admin/logs", s.handleGetProjectLogs, SuperuserRequired)
+	e.POST("/api/admin/logs/level", s.handleSetProjectLogLevel(), SuperuserRequired)
+	e.DELETE("/api/admin/logs", s.handleClearProjectLogs, SuperuserRequired)
+	e.POST("/api/admin/warmup", s.handleWarmUp(), SuperuserRequired)
+	e.GET("/api/admin/stats", s.handleGetStats, SuperuserRequired)
+	e.GET("/api/admin/report", s.handleGetUsageReport, SuperuserRequired)
+	e.GET("/api/admin/project_defaults", s.handleGetProjectDefaults, SuperuserRequired)
+	e.PUT("/api/admin/project_defaults", s.handleSaveProjectDefaults, SuperuserRequired)
+	e.GET("/api/admin/branding", s.handleGetBranding, SuperuserRequired)
+	e.PUT("/api/admin/branding", s.handleSaveBranding, SuperuserRequired)
+	e.POST("/api/admin/branding/:image", s.handleUploadBrandingImage, SuperuserRequired, UploadLimit)
+	e.DELETE("/api/admin/branding/:image", s.handleDeleteBrandingImage, SuperuserRequired)
+	e.GET("/api/admin/help", s.handleGetHelpContent, SuperuserRequired)
+	e.PUT("/api/admin/help", s.handleSaveHelpContent, SuperuserRequired)
+	e.GET("/api/admin/maintenance", s.handleGetMaintenance, SuperuserRequired)
+	e.PUT("/api/admin/maintenance", s.handleSetMaintenance, SuperuserRequired)
+	e.POST("/api/admin/projects/bulk", s.handleCreateBulkJob(), SuperuserRequired)
+	e.GET("/api/admin/projects/bulk/:id", s.handleGetBulkJob, SuperuserRequired)
+	if s.Config.MapCacheRoot != "" {
+		e.GET("/api/admin/cache", s.handleGetMapCacheUsage, SuperuserRequired)
+		e.DELETE("/api/admin/cache/:user/:name", s.handleClearMapCache, SuperuserRequired)
+	}
 
 	if s.Config.SignupAPI {
 		e.POST("/api/accounts/signup", s.handleSignUp())
@@ -46,48 +108,111 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 	}
 	e.GET("/api/accounts/check", s.handleCheckAvailability())
 	e.POST("/api/accounts/password_reset", s.handlePasswordReset())
+	e.POST("/api/accounts/resend_activation", s.handleResendActivation())
 	e.POST("/api/accounts/new_password", s.handleNewPassword())
+	e.GET("/api/accounts/invitation", s.handleGetInvitation)
+	e.POST("/api/accounts/invitation", s.handleAcceptInvitation())
 	e.POST("/api/accounts/change_password", s.handleChangePassword(), LoginRequired)
 	e.GET("/api/account", s.handleGetAccountInfo(), LoginRequired)
+	e.GET("/api/account/notifications", s.handleGetNotificationPreferences, LoginRequired)
+	e.PUT("/api/account/notifications", s.handleSaveNotificationPreferences, LoginRequired)
+	e.GET("/api/account/export", s.handleExportAccountData, LoginRequired)
+	e.GET("/api/account/deletion", s.handleGetAccountDeletion, LoginRequired)
+	e.POST("/api/account/deletion", s.handleScheduleAccountDeletion(), LoginRequired)
+	e.DELETE("/api/account/deletion", s.handleCancelAccountDeletion, LoginRequired)
 	e.GET("/api/auth/user", s.handleGetSessionUser)
 	e.GET("/api/auth/is_authenticated", s.handleGetSessionUser, LoginRequired)
 	e.GET("/api/auth/is_superuser", s.handleGetSessionUser, SuperuserRequired)
+	e.GET("/api/auth/tokens", s.handleGetAPITokens, LoginRequired)
+	e.POST("/api/auth/tokens", s.handleCreateAPIToken(), LoginRequired)
+	e.DELETE("/api/auth/tokens/:id", s.handleRevokeAPIToken, LoginRequired)
 
 	e.GET("/api/app", s.handleAppInit())
+	e.GET("/api/app/branding/:image", s.handleBrandingImage, UntrustedContent)
 
 	// e.POST("/api/map/project/*", s.handleUpdateProject)
 
 	e.POST("/api/project/:user/:name", s.handleCreateProject(), LoginRequired)
 	e.DELETE("/api/project/:user/:name", s.handleDeleteProject, ProjectSuperuserAccess)
 	e.GET("/api/projects", s.handleGetProjects())
+	e.GET("/api/projects/full-info", s.handleGetProjectsFullInfo(), LoginRequired)
 	e.GET("/api/projects/:user", s.handleGetUserProjects, SuperuserRequired)
-	e.POST("/api/project/upload/:user/:name", s.handleUpload(), ProjectAdminAccess)
+	e.POST("/api/project/upload/:user/:name", s.handleUpload(), ProjectAdminAccess, PublishSession, UploadLimit, UploadBandwidth)
+	e.DELETE("/api/project/upload/:user/:name", s.handleCancelUpload, ProjectAdminAccess)
 
-	e.GET("/api/project/ows/:user/:name", s.handleProjectOws(), ProjectAdminAccess)
-	e.POST("/api/project/ows/:user/:name", s.handleProjectOws(), ProjectAdminAccess)
+	e.GET("/api/project/ows/:user/:name", s.handleProjectOws(), ProjectAdminAccess, OWSLimit)
+	e.POST("/api/project/ows/:user/:name", s.handleProjectOws(), ProjectAdminAccess, OWSLimit)
 	e.GET("/api/project/files/:user/:name", s.handleGetProjectFiles(), ProjectAdminAccess)
-	e.DELETE("/api/project/files/:user/:name", s.handleDeleteProjectFiles(), ProjectAdminAccess)
+	e.DELETE("/api/project/files/:user/:name", s.handleDeleteProjectFiles(), ProjectAdminAccess, PublishSession)
 	e.GET("/api/project/info/:user/:name", s.handleGetProjectInfo, ProjectAdminAccess)
+	e.GET("/api/project/users/:user/:name", s.handleSearchPermissionCandidates, ProjectAdminAccess)
+	e.GET("/api/project/grants/:user/:name", s.handleGetAccessGrants, ProjectAdminAccess)
+	e.POST("/api/project/grants/:user/:name", s.handleCreateAccessGrant(), ProjectAdminAccess)
+	e.DELETE("/api/project/grants/:user/:name/:id", s.handleRevokeAccessGrant, ProjectAdminAccess)
+	e.GET("/api/project/session/:user/:name", s.handleGetPublishSession, ProjectAdminAccess)
+	e.DELETE("/api/project/session/:user/:name", s.handleReleasePublishSession, ProjectAdminAccess)
 	e.GET("/api/project/full-info/:user/:name", s.handleGetProjectFullInfo(), ProjectAdminAccess)
 
-	e.GET("/api/project/media/:user/:name/*", s.mediaFileHandler("/tmp/thumbnails"), ProjectAccess)
-	e.GET("/api/project/media/:user/:name/web/app/*", s.appMediaFileHandler)
-	e.POST("/api/project/media/:user/:name/*", s.handleUploadMediaFile, ProjectAccess)
+	e.GET("/api/project/media/:user/:name/*", s.mediaFileHandler("/tmp/thumbnails"), UntrustedContent, ProjectAccess, MediaLimit)
+	e.GET("/api/project/media/:user/:name/web/app/*", s.appMediaFileHandler, UntrustedContent)
+	e.POST("/api/project/media/:user/:name/*", s.handleUploadMediaFile, ProjectAccess, MediaLimit, UploadBandwidth)
 	e.DELETE("/api/project/media/:user/:name/*", s.handleDeleteMediaFile, ProjectAccess)
-	e.POST("/api/project/script/:user/:name", s.handleScriptUpload(), ProjectAdminAccess)
+	e.POST("/api/project/script/:user/:name", s.handleScriptUpload(), ProjectAdminAccess, UploadBandwidth)
 	e.DELETE("/api/project/script/:user/:name", s.handleDeleteScript(), ProjectAdminAccess)
 
-	e.GET("/api/project/file/:user/:name/*", s.handleProjectFile, ProjectAdminAccess)
-	e.GET("/api/project/download/:user/:name", s.handleDownloadProjectFiles, ProjectAdminAccess)
-	e.GET("/api/project/download/:user/:name/*", s.handleDownloadProjectFiles, ProjectAdminAccess)
-	e.GET("/api/project/inline/:user/:name/*", s.handleInlineProjectFile, ProjectAdminAccess)
+	e.GET("/api/project/file/:user/:name/*", s.handleProjectFile, UntrustedContent, ProjectAdminAccess, DownloadBandwidth)
+	e.GET("/api/project/download/:user/:name", s.handleDownloadProjectFiles, ProjectAdminAccess, DownloadBandwidth)
+	e.GET("/api/project/download/:user/:name/*", s.handleDownloadProjectFiles, ProjectAdminAccess, DownloadBandwidth)
+	e.GET("/api/project/inline/:user/:name/*", s.handleInlineProjectFile, UntrustedContent, ProjectAdminAccess)
+	e.POST("/api/project/library/:user/:name", s.handleAttachLibraryFile, ProjectAdminAccess)
 
-	e.POST("/api/project/meta/:user/:name", s.handleUpdateProjectMeta(), ProjectAdminAccess)
+	e.POST("/api/project/meta/:user/:name", s.handleUpdateProjectMeta(), ProjectAdminAccess, PublishSession)
+	e.GET("/api/project/description/:user/:name", s.handleGetProjectDescription, ProjectAccess)
+	e.POST("/api/project/description/:user/:name", s.handleSaveProjectDescription(), ProjectAdminAccess)
+	e.GET("/api/project/styles/:user/:name", s.handleGetLayerStyles, ProjectAdminAccess)
+	e.GET("/api/project/styles/:user/:name/:layer/:style", s.handleGetLayerStyle, UntrustedContent, ProjectAdminAccess)
+	e.POST("/api/project/styles/:user/:name/:layer/:style", s.handleUploadLayerStyle, ProjectAdminAccess)
+	e.DELETE("/api/project/styles/:user/:name/:layer/:style", s.handleDeleteLayerStyle, ProjectAdminAccess)
+	e.GET("/api/project/secrets/:user/:name", s.handleGetProjectSecrets, ProjectAdminAccess)
+	e.POST("/api/project/secrets/:user/:name", s.handleSaveProjectSecret, ProjectAdminAccess)
+	e.DELETE("/api/project/secrets/:user/:name/:secret", s.handleDeleteProjectSecret, ProjectAdminAccess)
 
 	e.POST("/api/project/settings/:user/:name", s.handleSaveProjectSettings, ProjectAdminAccess)
-	e.POST("/api/project/thumbnail/:user/:name", s.handleUploadThumbnail, ProjectAdminAccess)
-	e.GET("/api/project/thumbnail/:user/:name", s.handleGetThumbnail)
-	e.GET("/api/map/project/:user/:name", s.handleGetProject(), MiddlewareErrorHandler(ProjectAccess, func(e error, c echo.Context) error {
+	e.GET("/api/project/settings/:user/:name/template/:template", s.handleApplySettingsTemplate, ProjectAdminAccess)
+	e.GET("/api/project/topics/:user/:name", s.handleGetTopics, ProjectAdminAccess)
+	e.PUT("/api/project/topics/:user/:name", s.handleSaveTopics, ProjectAdminAccess)
+	e.PUT("/api/project/topics/:user/:name/:topic", s.handleSaveTopic, ProjectAdminAccess)
+	e.DELETE("/api/project/topics/:user/:name/:topic", s.handleDeleteTopic, ProjectAdminAccess)
+	e.GET("/api/project/groups/:user/:name", s.handleGetGroupsSettings, ProjectAdminAccess)
+	e.PUT("/api/project/groups/:user/:name", s.handleSaveGroupsSettings, ProjectAdminAccess)
+	e.GET("/api/settings/templates", s.handleGetSettingsTemplates, LoginRequired)
+	e.PUT("/api/settings/templates/:template", s.handleSaveSettingsTemplate(), LoginRequired)
+	e.DELETE("/api/settings/templates/:template", s.handleDeleteSettingsTemplate, LoginRequired)
+	e.GET("/api/composed", s.handleGetComposedMaps, LoginRequired)
+	e.PUT("/api/composed/:map", s.handleSaveComposedMap, LoginRequired)
+	e.DELETE("/api/composed/:map", s.handleDeleteComposedMap, LoginRequired)
+	e.GET("/api/library", s.handleGetLibrary, LoginRequired)
+	e.POST("/api/library/*", s.handleUploadLibraryFile, LoginRequired, UploadLimit)
+	e.DELETE("/api/library/*", s.handleDeleteLibraryFile, LoginRequired)
+	e.POST("/api/project/thumbnail/:user/:name", s.handleUploadThumbnail, ProjectAdminAccess, UploadLimit)
+	e.POST("/api/project/thumbnail/from-map/:user/:name", s.handleThumbnailFromMap(), ProjectAdminAccess)
+	e.GET("/api/project/thumbnail/:user/:name", s.handleGetThumbnail, EmbedHeaders, Robots)
+	e.GET("/api/project/metadata/:user/:name", s.handleGetProjectMetadata, ProjectAccess)
+	e.GET("/api/project/schema/:user/:name/search", s.handleSchemaSearch, ProjectAccess)
+	e.POST("/api/project/schema/:user/:name/index", s.handleBuildAttributesIndex, ProjectAdminAccess)
+	e.POST("/api/project/expression/:user/:name", s.handleValidateExpression(), ProjectAdminAccess)
+	e.GET("/api/project/stac/:user/:name", s.handleGetRasterCatalog, ProjectAccess)
+	e.Match([]string{http.MethodGet, http.MethodHead}, "/api/project/stac/:user/:name/data/*", s.handleGetRasterData, AnonymousLimit, ProjectAccess, DownloadBandwidth)
+	if s.Config.Cog.Converter != "" {
+		e.GET("/api/project/cog/:user/:name", s.handleGetCogCandidates, ProjectAdminAccess)
+		e.POST("/api/project/cog/:user/:name", s.handleCreateCogJob(), ProjectAdminAccess)
+		e.GET("/api/project/cog/:user/:name/:id", s.handleGetCogJob, ProjectAdminAccess)
+	}
+	if s.Config.Catalog != nil {
+		e.GET("/api/project/catalog/:user/:name", s.handleGetCatalogStatus, ProjectAdminAccess)
+		e.POST("/api/project/catalog/:user/:name", s.handleSyncCatalogRecord, ProjectAdminAccess)
+	}
+	e.GET("/api/map/project/:user/:name", s.handleGetProject(), EmbedHeaders, AnonymousLimit, MiddlewareErrorHandler(ProjectAccess, func(e error, c echo.Context) error {
 		if he, ok := e.(*echo.HTTPError); ok {
 			if he.Code == 401 {
 				projectName := c.Get("project").(string)
@@ -121,23 +246,66 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 			}
 		}
 		return e
-	}))
+	}), RobotsProject)
 
 	owsHandler := s.handleMapOws()
-	e.GET("/api/map/ows/:user/:name", owsHandler, ProjectAccessOWS)
-	e.POST("/api/map/ows/:user/:name", owsHandler, ProjectAccessOWS)
-	e.GET("/api/map/capabilities/:user/:name", s.handleGetLayerCapabilities(), ProjectAccess)
-	e.GET("/api/map/search/:user/:name/*", s.handleSearch(), ProjectAccess)
+	OWSLog := s.owsLogMiddleware
+	e.GET("/api/map/ows/:user/:name", owsHandler, EmbedHeaders, OWSLog, AnonymousLimit, ProjectAccessOWS, OWSLimit, RobotsOWS)
+	e.POST("/api/map/ows/:user/:name", owsHandler, EmbedHeaders, OWSLog, AnonymousLimit, ProjectAccessOWS, OWSLimit, RobotsOWS)
+	if s.Config.PublicOWS {
+		// stable read-only service URL for GIS clients (capabilities are rewritten to this path)
+		PublicOWSAccess := ProjectAccess
+		if s.Config.PublicOWSBasicAuth {
+			PublicOWSAccess = ProjectAccessOWS
+		}
+		e.GET("/ows/:user/:name", owsHandler, OWSLog, AnonymousLimit, PublicOWSAccess, OWSLimit, RobotsOWS, ReadOnlyOWSMiddleware())
+	}
+	e.GET("/api/map/composed/:user/:name", s.handleGetComposedMap(ProjectAccess), EmbedHeaders, AnonymousLimit)
+	e.GET("/api/map/composed/:user/:name/ows", s.handleComposedOws(OWSLog(ProjectAccessOWS(owsHandler))), EmbedHeaders, AnonymousLimit, OWSLimit, RobotsOWS)
+	e.GET("/api/map/capabilities/:user/:name", s.handleGetLayerCapabilities(), AnonymousLimit, ProjectAccess)
+	e.GET("/api/map/search/:user/:name/*", s.handleSearch(), AnonymousLimit, ProjectAccess)
+	e.POST("/api/map/form/:user/:name/:layer", s.handleFormSubmission(), ProjectAccess, MediaLimit)
+	e.GET("/api/map/sync/:user/:name", s.handleGetSyncSnapshot, ProjectAccess)
+	e.GET("/api/map/changes/:user/:name/:layer", s.handleGetLayerChanges, ProjectAccess)
+	e.POST("/api/map/sync/:user/:name", s.handlePushSyncChanges(), ProjectAccess)
+	if s.Config.OfflineRoot != "" {
+		e.POST("/api/map/offline/:user/:name", s.handleCreateOfflinePackage(), ProjectAccess)
+		e.GET("/api/map/offline/:user/:name/:id", s.handleGetOfflinePackage, ProjectAccess)
+		e.GET("/api/offline/download/:id", s.handleDownloadOfflinePackage, DownloadBandwidth)
+	}
+	if s.Config.ReportsRoot != "" {
+		e.POST("/api/map/report/:user/:name/:report", s.handleCreateReport(), ProjectAccess)
+		e.GET("/api/map/report/:user/:name/job/:id", s.handleGetReport, ProjectAccess)
+		e.GET("/api/report/download/:id", s.handleDownloadReport, DownloadBandwidth)
+	}
 
 	e.POST("/api/project/reload/:user/:name", s.handleProjectReload, ProjectAdminAccess)
 
+	if s.Config.Scim.Token != "" {
+		scim := e.Group("/scim/v2", ScimAuthMiddleware(s.Config.Scim.Token))
+		scim.GET("/Users", s.handleScimListUsers)
+		scim.POST("/Users", s.handleScimCreateUser)
+		scim.GET("/Users/:id", s.handleScimGetUser)
+		scim.PUT("/Users/:id", s.handleScimReplaceUser)
+		scim.PATCH("/Users/:id", s.handleScimPatchUser)
+		scim.DELETE("/Users/:id", s.handleScimDeleteUser)
+	}
+
 	e.GET("/ws/app", s.handleWebAppWS, LoginRequired)
 	e.GET("/ws/plugin", s.handlePluginWS, LoginRequired)
+	e.GET("/ws/map/:user/:name", s.handleMapWS, ProjectAccess)
 
 	if s.Config.PluginsURL != "" {
 		// e.GET("/plugins/", s.pythonPluginRepoHandler("/qgis-plugins-repo"))
-		e.GET("/plugins/platform/:platform", s.platformPluginRepoHandler("/qgis-plugins-repo"))
-		e.GET("/plugins/download/*", s.handleDownloadPlugin("/qgis-plugins-repo"))
+		e.GET("/plugins/plugins.xml", s.pluginsRepoXMLHandler(pluginsRepoRoot))
+		e.GET("/plugins/platform/:platform", s.platformPluginRepoHandler(pluginsRepoRoot))
+		e.GET("/plugins/download/*", s.handleDownloadPlugin(pluginsRepoRoot))
+		e.GET("/plugins/latest/:platform", s.handleDownloadLatestPlugin(pluginsRepoRoot))
+	}
+
+	// web client with fallback routing (must be the last route)
+	if s.Config.WebApp.Files != nil {
+		e.GET("/*", s.handleWebApp(), webAppGzipMiddleware())
 	}
 
 	// owsHandler := s.owsHandler()
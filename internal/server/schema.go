@@ -0,0 +1,296 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	schemaSearchLimit      = 20
+	schemaSearchMaxLimit   = 100
+	indexedValuesLimit     = 500
+	attributesIndexTimeout = 10 * time.Minute
+)
+
+// Distinct values of text attributes (layer id -> attribute name -> values)
+type AttributesIndex map[string]map[string][]string
+
+type SchemaMatch struct {
+	Type       string `json:"type"` // layer, field or value
+	Layer      string `json:"layer"`
+	LayerTitle string `json:"layer_title,omitempty"`
+	Field      string `json:"field,omitempty"`
+	Alias      string `json:"alias,omitempty"`
+	Value      string `json:"value,omitempty"`
+	Label      string `json:"label,omitempty"`
+	rank       int
+}
+
+func (s *Server) attributesIndexPath(projectName string) string {
+	return filepath.Join(s.Config.ProjectsRoot, projectName, ".gisquick", "attributes_index.json")
+}
+
+func (s *Server) loadAttributesIndex(projectName string) (AttributesIndex, error) {
+	index := make(AttributesIndex)
+	data, err := os.ReadFile(s.attributesIndexPath(projectName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return index, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func isTextAttribute(attr domain.LayerAttribute) bool {
+	t := strings.ToLower(attr.Type)
+	return strings.Contains(t, "string") || strings.Contains(t, "text") || strings.Contains(t, "char")
+}
+
+// Builds index of distinct values of text attributes of queryable vector layers
+func (s *Server) buildAttributesIndex(ctx context.Context, projectName string) (AttributesIndex, error) {
+	var meta domain.QgisMeta
+	if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+		return nil, fmt.Errorf("parsing qgis meta: %w", err)
+	}
+	index := make(AttributesIndex)
+	for id, lmeta := range meta.Layers {
+		if lmeta.Type != "VectorLayer" || !lmeta.Flags.Has("query") {
+			continue
+		}
+		var fields []string
+		for _, a := range lmeta.Attributes {
+			if isTextAttribute(a) {
+				fields = append(fields, a.Name)
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		features, err := s.fetchReportFeatures(ctx, projectName, strings.ReplaceAll(lmeta.Name, " ", "_"), fields, domain.WfsLimit{})
+		if err != nil {
+			return nil, fmt.Errorf("fetching features of layer %s: %w", lmeta.Name, err)
+		}
+		layerIndex := make(map[string][]string)
+		for _, field := range fields {
+			seen := make(map[string]bool)
+			for _, f := range features {
+				v, ok := f[field].(string)
+				if !ok || v == "" || seen[v] {
+					continue
+				}
+				seen[v] = true
+				if len(seen) > indexedValuesLimit {
+					break
+				}
+			}
+			// fields with too many distinct values aren't useful for autocomplete
+			if len(seen) == 0 || len(seen) > indexedValuesLimit {
+				continue
+			}
+			values := make([]string, 0, len(seen))
+			for v := range seen {
+				values = append(values, v)
+			}
+			sort.Strings(values)
+			layerIndex[field] = values
+		}
+		if len(layerIndex) > 0 {
+			index[id] = layerIndex
+		}
+	}
+	return index, nil
+}
+
+func (s *Server) updateAttributesIndex(projectName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), attributesIndexTimeout)
+	defer cancel()
+	index, err := s.buildAttributesIndex(ctx, projectName)
+	if err == nil {
+		var data []byte
+		if data, err = json.Marshal(index); err == nil {
+			err = os.WriteFile(s.attributesIndexPath(projectName), data, 0644)
+		}
+	}
+	if err != nil {
+		s.log.Errorw("building attributes index", "project", projectName, zap.Error(err))
+	}
+}
+
+// Returns values (with labels) defined in the ValueMap widget configuration
+func valueMapValues(attr domain.LayerAttribute) map[string]string {
+	if attr.Widget != "ValueMap" {
+		return nil
+	}
+	values := make(map[string]string)
+	add := func(m map[string]interface{}) {
+		for label, v := range m {
+			if value := fmt.Sprint(v); !strings.HasPrefix(value, "{2839923C") { // QGIS null value placeholder
+				values[value] = label
+			}
+		}
+	}
+	switch m := attr.Config["map"].(type) {
+	case map[string]interface{}:
+		add(m)
+	case []interface{}:
+		for _, item := range m {
+			if im, ok := item.(map[string]interface{}); ok {
+				add(im)
+			}
+		}
+	}
+	return values
+}
+
+// Returns rank of the match (lower is better) or -1 when text doesn't match the query
+func matchRank(text, query string) int {
+	t := strings.ToLower(text)
+	switch {
+	case t == query:
+		return 0
+	case strings.HasPrefix(t, query):
+		return 1
+	case strings.Contains(t, query):
+		return 2
+	}
+	return -1
+}
+
+func (s *Server) handleSchemaSearch(c echo.Context) error {
+	projectName := getProjectName(c)
+	query := strings.ToLower(strings.TrimSpace(c.QueryParam("q")))
+	if query == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing query")
+	}
+	limit := schemaSearchLimit
+	if v := c.QueryParam("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+		}
+		if l < schemaSearchMaxLimit {
+			limit = l
+		} else {
+			limit = schemaSearchMaxLimit
+		}
+	}
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	var meta domain.QgisMeta
+	if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+		return fmt.Errorf("parsing qgis meta: %w", err)
+	}
+	// settings are not available before the first publishing
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("getting project settings: %w", err)
+	}
+	index, err := s.loadAttributesIndex(projectName)
+	if err != nil {
+		s.log.Errorw("loading attributes index", "project", projectName, zap.Error(err))
+	}
+	userRoles := domain.FilterUserRoles(user, settings.Auth.Roles)
+	hasRoles := len(settings.Auth.Roles) > 0
+
+	matches := make([]SchemaMatch, 0)
+	for id, lmeta := range meta.Layers {
+		lset := settings.Layers[id]
+		if lset.Flags.Has("excluded") || !lset.Roles.Allows(user, userRoles) {
+			continue
+		}
+		flags := domain.Flags{"view", "query"}
+		var attrsFlags map[string]domain.Flags
+		if hasRoles {
+			flags = settings.UserLayerPermissionsFlags(user, id)
+			attrsFlags = settings.UserLayerAttrinutesFlags(user, id)
+		}
+		if !flags.Has("view") {
+			continue
+		}
+		rank := matchRank(lmeta.Name, query)
+		if r := matchRank(lmeta.Title, query); r != -1 && (rank == -1 || r < rank) {
+			rank = r
+		}
+		if rank != -1 {
+			matches = append(matches, SchemaMatch{Type: "layer", Layer: lmeta.Name, LayerTitle: lmeta.Title, rank: rank})
+		}
+		if !flags.Has("query") {
+			continue
+		}
+		for _, a := range lmeta.Attributes {
+			if hasRoles && !attrsFlags[a.Name].Has("view") {
+				continue
+			}
+			rank := matchRank(a.Name, query)
+			if r := matchRank(a.Alias, query); r != -1 && (rank == -1 || r < rank) {
+				rank = r
+			}
+			if rank != -1 {
+				matches = append(matches, SchemaMatch{Type: "field", Layer: lmeta.Name, LayerTitle: lmeta.Title, Field: a.Name, Alias: a.Alias, rank: rank})
+			}
+			values := valueMapValues(a)
+			if values == nil {
+				values = make(map[string]string)
+			}
+			for _, v := range index[id][a.Name] {
+				if _, ok := values[v]; !ok {
+					values[v] = ""
+				}
+			}
+			for value, label := range values {
+				rank := matchRank(value, query)
+				if r := matchRank(label, query); r != -1 && (rank == -1 || r < rank) {
+					rank = r
+				}
+				if rank != -1 {
+					matches = append(matches, SchemaMatch{Type: "value", Layer: lmeta.Name, LayerTitle: lmeta.Title, Field: a.Name, Alias: a.Alias, Value: value, Label: label, rank: rank})
+				}
+			}
+		}
+	}
+	typeOrder := map[string]int{"layer": 0, "field": 1, "value": 2}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+		if a.Type != b.Type {
+			return typeOrder[a.Type] < typeOrder[b.Type]
+		}
+		if a.Layer != b.Layer {
+			return a.Layer < b.Layer
+		}
+		if a.Field != b.Field {
+			return a.Field < b.Field
+		}
+		return a.Value < b.Value
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return c.JSON(http.StatusOK, matches)
+}
+
+func (s *Server) handleBuildAttributesIndex(c echo.Context) error {
+	go s.updateAttributesIndex(getProjectName(c))
+	return c.NoContent(http.StatusAccepted)
+}
@@ -0,0 +1,403 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// SCIM 2.0 provisioning of the user accounts (RFC 7643, 7644), user's ID is the username
+type ScimConfig struct {
+	// bearer token of the identity provider (empty value disables the endpoint)
+	Token string
+	// unpublish projects of deactivated users
+	UnpublishProjects bool
+}
+
+const (
+	scimUserSchema     = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimListSchema     = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimPatchSchema    = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	scimErrorSchema    = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimContentType    = "application/scim+json"
+	scimMaxResultCount = 500
+)
+
+var scimFilterRegex = regexp.MustCompile(`^\s*(userName|emails(?:\.value)?)\s+eq\s+"([^"]*)"\s*$`)
+
+type scimName struct {
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimMeta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	Location     string     `json:"location,omitempty"`
+}
+
+type scimUser struct {
+	Schemas  []string    `json:"schemas"`
+	ID       string      `json:"id,omitempty"`
+	UserName string      `json:"userName"`
+	Name     scimName    `json:"name"`
+	Emails   []scimEmail `json:"emails,omitempty"`
+	Active   *bool       `json:"active,omitempty"`
+	Password string      `json:"password,omitempty"`
+	Meta     *scimMeta   `json:"meta,omitempty"`
+}
+
+func (u scimUser) email() string {
+	for _, e := range u.Emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+type scimListResponse struct {
+	Schemas      []string   `json:"schemas"`
+	TotalResults int        `json:"totalResults"`
+	StartIndex   int        `json:"startIndex"`
+	ItemsPerPage int        `json:"itemsPerPage"`
+	Resources    []scimUser `json:"Resources"`
+}
+
+type scimPatchRequest struct {
+	Schemas    []string `json:"schemas"`
+	Operations []struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	} `json:"Operations"`
+}
+
+func scimError(c echo.Context, status int, detail string) error {
+	return scimJSON(c, status, map[string]interface{}{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	})
+}
+
+func scimJSON(c echo.Context, status int, data interface{}) error {
+	c.Response().Header().Set(echo.HeaderContentType, scimContentType)
+	return c.JSON(status, data)
+}
+
+func (s *Server) toScimUser(a domain.Account) scimUser {
+	active := a.Active
+	u := scimUser{
+		Schemas:  []string{scimUserSchema},
+		ID:       a.Username,
+		UserName: a.Username,
+		Name:     scimName{GivenName: a.FirstName, FamilyName: a.LastName},
+		Active:   &active,
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Created:      a.Created,
+			Location:     strings.TrimRight(s.Config.SiteURL, "/") + "/scim/v2/Users/" + a.Username,
+		},
+	}
+	if a.Email != "" {
+		u.Emails = []scimEmail{{Value: a.Email, Primary: true}}
+	}
+	return u
+}
+
+// ScimAuthMiddleware checks bearer token of the identity provider
+func ScimAuthMiddleware(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			auth := c.Request().Header.Get(echo.HeaderAuthorization)
+			if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") ||
+				subtle.ConstantTimeCompare([]byte(auth[7:]), []byte(token)) != 1 {
+				return scimError(c, http.StatusUnauthorized, "Invalid token")
+			}
+			return next(c)
+		}
+	}
+}
+
+func (s *Server) bindScimBody(c echo.Context, v interface{}) error {
+	// identity providers use application/scim+json content type
+	if err := (&echo.DefaultBinder{}).BindBody(c, v); err != nil {
+		var he *echo.HTTPError
+		if !errors.As(err, &he) || he.Code != http.StatusUnsupportedMediaType {
+			return err
+		}
+		return c.Echo().JSONSerializer.Deserialize(c, v)
+	}
+	return nil
+}
+
+func (s *Server) handleScimListUsers(c echo.Context) error {
+	accounts, err := s.accountsService.Repository.GetAllAccounts()
+	if err != nil {
+		return fmt.Errorf("listing accounts: %w", err)
+	}
+	if filter := c.QueryParam("filter"); filter != "" {
+		m := scimFilterRegex.FindStringSubmatch(filter)
+		if m == nil {
+			return scimError(c, http.StatusBadRequest, "Unsupported filter")
+		}
+		filtered := accounts[:0]
+		for _, a := range accounts {
+			if (m[1] == "userName" && strings.EqualFold(a.Username, m[2])) ||
+				(m[1] != "userName" && strings.EqualFold(a.Email, m[2])) {
+				filtered = append(filtered, a)
+			}
+		}
+		accounts = filtered
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Username < accounts[j].Username })
+	startIndex, _ := strconv.Atoi(c.QueryParam("startIndex"))
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(c.QueryParam("count"))
+	if err != nil || count > scimMaxResultCount {
+		count = scimMaxResultCount
+	}
+	resp := scimListResponse{
+		Schemas:      []string{scimListSchema},
+		TotalResults: len(accounts),
+		StartIndex:   startIndex,
+		Resources:    []scimUser{},
+	}
+	for i := startIndex - 1; i < len(accounts) && len(resp.Resources) < count; i++ {
+		resp.Resources = append(resp.Resources, s.toScimUser(accounts[i]))
+	}
+	resp.ItemsPerPage = len(resp.Resources)
+	return scimJSON(c, http.StatusOK, resp)
+}
+
+func (s *Server) getScimAccount(c echo.Context) (domain.Account, error) {
+	account, err := s.accountsService.Repository.GetByUsername(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, domain.ErrAccountNotFound) {
+			return account, scimError(c, http.StatusNotFound, "User not found")
+		}
+		return account, err
+	}
+	return account, nil
+}
+
+func (s *Server) handleScimGetUser(c echo.Context) error {
+	account, err := s.getScimAccount(c)
+	if err != nil || c.Response().Committed {
+		return err
+	}
+	return scimJSON(c, http.StatusOK, s.toScimUser(account))
+}
+
+func (s *Server) handleScimCreateUser(c echo.Context) error {
+	var u scimUser
+	if err := s.bindScimBody(c, &u); err != nil {
+		return scimError(c, http.StatusBadRequest, "Invalid request data")
+	}
+	username, err := s.Config.Names.NormalizeUsername(u.UserName)
+	if err != nil {
+		return scimError(c, http.StatusBadRequest, err.Error())
+	}
+	if exists, err := s.accountsService.Repository.UsernameExists(username); err != nil {
+		return err
+	} else if exists {
+		return scimError(c, http.StatusConflict, "User already exists")
+	}
+	account, err := domain.NewAccount(username, u.email(), u.Name.GivenName, u.Name.FamilyName, u.Password)
+	if err != nil {
+		return scimError(c, http.StatusBadRequest, err.Error())
+	}
+	// users without password are authenticated by the identity provider (authentication backend)
+	account.Active = u.Active == nil || *u.Active
+	if account.Active {
+		account.Confirmed = account.Created
+	}
+	if err := s.accountsService.Repository.Create(account); err != nil {
+		s.log.Errorw("creating account", "username", username, zap.Error(err))
+		return fmt.Errorf("failed to create user account")
+	}
+	s.events.Publish(application.Event{Type: application.EventUserRegistered, User: account.Username})
+	s.log.Infow("scim: user provisioned", "username", username)
+	return scimJSON(c, http.StatusCreated, s.toScimUser(account))
+}
+
+// Saves updated account, deactivation revokes sessions of the user
+func (s *Server) saveScimAccount(c echo.Context, account domain.Account, wasActive bool) error {
+	if account.Active && account.Confirmed == nil {
+		now := time.Now()
+		account.Confirmed = &now
+	}
+	if err := s.accountsService.Repository.Update(account); err != nil {
+		return fmt.Errorf("updating account: %w", err)
+	}
+	if wasActive && !account.Active {
+		s.deprovisionUser(account.Username)
+	}
+	return scimJSON(c, http.StatusOK, s.toScimUser(account))
+}
+
+func (s *Server) handleScimReplaceUser(c echo.Context) error {
+	account, err := s.getScimAccount(c)
+	if err != nil || c.Response().Committed {
+		return err
+	}
+	var u scimUser
+	if err := s.bindScimBody(c, &u); err != nil {
+		return scimError(c, http.StatusBadRequest, "Invalid request data")
+	}
+	if u.UserName != "" && !strings.EqualFold(u.UserName, account.Username) {
+		return scimError(c, http.StatusBadRequest, "userName can't be changed")
+	}
+	wasActive := account.Active
+	account.Email = strings.ToLower(strings.TrimSpace(u.email()))
+	account.FirstName = u.Name.GivenName
+	account.LastName = u.Name.FamilyName
+	if u.Active != nil {
+		account.Active = *u.Active
+	}
+	if u.Password != "" {
+		if err := account.SetPassword(u.Password); err != nil {
+			return scimError(c, http.StatusBadRequest, err.Error())
+		}
+	}
+	return s.saveScimAccount(c, account, wasActive)
+}
+
+func applyScimValue(account *domain.Account, path string, value interface{}) error {
+	str, _ := value.(string)
+	switch strings.ToLower(path) {
+	case "active":
+		switch v := value.(type) {
+		case bool:
+			account.Active = v
+		case string:
+			// some identity providers send boolean values as strings
+			active, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid active value: %s", v)
+			}
+			account.Active = active
+		default:
+			return errors.New("invalid active value")
+		}
+	case "name.givenname":
+		account.FirstName = str
+	case "name.familyname":
+		account.LastName = str
+	case "emails", `emails[type eq "work"].value`, "emails.value":
+		if list, ok := value.([]interface{}); ok && len(list) > 0 {
+			if item, ok := list[0].(map[string]interface{}); ok {
+				str, _ = item["value"].(string)
+			}
+		}
+		account.Email = strings.ToLower(strings.TrimSpace(str))
+	case "name":
+		if name, ok := value.(map[string]interface{}); ok {
+			for key, v := range name {
+				if err := applyScimValue(account, "name."+key, v); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported attribute: %s", path)
+	}
+	return nil
+}
+
+func (s *Server) handleScimPatchUser(c echo.Context) error {
+	account, err := s.getScimAccount(c)
+	if err != nil || c.Response().Committed {
+		return err
+	}
+	var req scimPatchRequest
+	if err := s.bindScimBody(c, &req); err != nil {
+		return scimError(c, http.StatusBadRequest, "Invalid request data")
+	}
+	wasActive := account.Active
+	for _, op := range req.Operations {
+		if !strings.EqualFold(op.Op, "replace") && !strings.EqualFold(op.Op, "add") {
+			return scimError(c, http.StatusBadRequest, fmt.Sprintf("Unsupported operation: %s", op.Op))
+		}
+		if op.Path == "" {
+			// value is an object with attributes
+			values, ok := op.Value.(map[string]interface{})
+			if !ok {
+				return scimError(c, http.StatusBadRequest, "Invalid operation value")
+			}
+			for path, v := range values {
+				if err := applyScimValue(&account, path, v); err != nil {
+					return scimError(c, http.StatusBadRequest, err.Error())
+				}
+			}
+		} else if err := applyScimValue(&account, op.Path, op.Value); err != nil {
+			return scimError(c, http.StatusBadRequest, err.Error())
+		}
+	}
+	return s.saveScimAccount(c, account, wasActive)
+}
+
+func (s *Server) handleScimDeleteUser(c echo.Context) error {
+	account, err := s.getScimAccount(c)
+	if err != nil || c.Response().Committed {
+		return err
+	}
+	s.deprovisionUser(account.Username)
+	if err := s.accountsService.Repository.Delete(account.Username); err != nil {
+		return fmt.Errorf("deleting account: %w", err)
+	}
+	s.log.Infow("scim: user deleted", "username", account.Username)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Revokes sessions of the deactivated (or deleted) user and optionally unpublishes user's projects
+func (s *Server) deprovisionUser(username string) {
+	s.log.Infow("scim: user deactivated", "username", username)
+	if err := s.auth.RevokeUser(context.Background(), username); err != nil {
+		s.log.Errorw("revoking user sessions", "username", username, zap.Error(err))
+	}
+	if !s.Config.Scim.UnpublishProjects {
+		return
+	}
+	projects, err := s.projects.GetUserProjects(username)
+	if err != nil {
+		s.log.Errorw("listing user projects", "username", username, zap.Error(err))
+		return
+	}
+	for _, p := range projects {
+		if p.State != "published" {
+			continue
+		}
+		// project files are kept, it can be published again from the plugin
+		if err := s.projects.UpdateState(p.Name, "staged"); err != nil {
+			s.log.Errorw("unpublishing project", "project", p.Name, zap.Error(err))
+			continue
+		}
+		if s.Config.Catalog != nil {
+			go s.updateCatalogRecord(p.Name)
+		}
+	}
+}
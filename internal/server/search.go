@@ -12,13 +12,15 @@ import (
 
 func (s *Server) handleSearch() func(c echo.Context) error {
 	director := func(req *http.Request) {
+		s.scrubProxyHeaders(req.Header)
 		if _, ok := req.Header["User-Agent"]; !ok {
 			// explicitly disable User-Agent so it's not set to default value
 			req.Header.Set("User-Agent", "")
 		}
-		req.Header.Del("Cookie")
 	}
 	reverseProxy := &httputil.ReverseProxy{Director: director}
+	reverseProxy.ErrorHandler = s.proxyErrorHandler("search")
+	reverseProxy.Transport = s.outbound.Transport
 
 	return func(c echo.Context) error {
 		projectName := getProjectName(c)
@@ -38,7 +40,7 @@ func (s *Server) handleSearch() func(c echo.Context) error {
 			}
 		}
 		searchUrl.RawQuery = query.Encode()
-		req, err := http.NewRequest(http.MethodGet, searchUrl.String(), nil)
+		req, err := http.NewRequestWithContext(c.Request().Context(), http.MethodGet, searchUrl.String(), nil)
 		if err != nil {
 			return fmt.Errorf("search error: %w", err)
 		}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	pgServiceFilename = "pg_service.conf"
+	// header with path to the project's connection service file, used by the map server
+	pgServiceHeader = "X-Pg-Service-File"
+)
+
+func (s *Server) pgServiceFilePath(projectName string) string {
+	return filepath.Join(s.Config.PgServiceRoot, projectName, pgServiceFilename)
+}
+
+// Generates project's pg_service.conf file with all stored connection secrets
+func (s *Server) writePgServiceFile(projectName string) error {
+	if s.Config.PgServiceRoot == "" {
+		return nil
+	}
+	secrets, err := s.secrets.List(projectName)
+	if err != nil {
+		return fmt.Errorf("listing project secrets: %w", err)
+	}
+	path := s.pgServiceFilePath(projectName)
+	if len(secrets) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, secret := range secrets {
+		// secrets stored before validation of the special characters
+		if err := secret.Validate(); err != nil {
+			s.log.Errorw("skipping invalid project secret", "project", projectName, "name", secret.Name, zap.Error(err))
+			continue
+		}
+		fmt.Fprintf(&buf, "[%s]\n", secret.Name)
+		fmt.Fprintf(&buf, "host=%s\n", secret.Host)
+		if secret.Port > 0 {
+			fmt.Fprintf(&buf, "port=%d\n", secret.Port)
+		}
+		fmt.Fprintf(&buf, "dbname=%s\n", secret.Database)
+		if secret.User != "" {
+			fmt.Fprintf(&buf, "user=%s\n", secret.User)
+		}
+		if secret.Password != "" {
+			fmt.Fprintf(&buf, "password=%s\n", secret.Password)
+		}
+		if secret.SSLMode != "" {
+			fmt.Fprintf(&buf, "sslmode=%s\n", secret.SSLMode)
+		}
+		buf.WriteString("\n")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0640)
+}
+
+// Sets (or removes client supplied) header with path to the project's connection service file.
+// Stock QGIS server ignores the header, the map server plugin must apply it as PGSERVICEFILE
+// environment variable of the request (or the map server must be started with a shared PGSERVICEFILE).
+func (s *Server) setPgServiceHeader(req *http.Request, projectName string) {
+	req.Header.Del(pgServiceHeader)
+	if s.Config.PgServiceRoot == "" {
+		return
+	}
+	if _, err := os.Stat(s.pgServiceFilePath(projectName)); err == nil {
+		root := s.Config.MapserverPgServiceRoot
+		if root == "" {
+			root = s.Config.PgServiceRoot
+		}
+		req.Header.Set(pgServiceHeader, filepath.Join(root, projectName, pgServiceFilename))
+	}
+}
+
+func (s *Server) handleGetProjectSecrets(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	secrets, err := s.secrets.List(projectName)
+	if err != nil {
+		return fmt.Errorf("listing project secrets: %w", err)
+	}
+	for i := range secrets {
+		secrets[i].Password = ""
+	}
+	return c.JSON(http.StatusOK, secrets)
+}
+
+func (s *Server) handleSaveProjectSecret(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	secret := new(domain.ConnectionSecret)
+	if err := (&echo.DefaultBinder{}).BindBody(c, secret); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+	}
+	if err := secret.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if secret.Password == "" {
+		// keep current password
+		current, err := s.secrets.Get(projectName, secret.Name)
+		if err == nil {
+			secret.Password = current.Password
+		} else if !errors.Is(err, domain.ErrSecretNotFound) {
+			return fmt.Errorf("reading project secret: %w", err)
+		}
+	}
+	if err := s.secrets.Save(projectName, *secret); err != nil {
+		return fmt.Errorf("saving project secret: %w", err)
+	}
+	if err := s.writePgServiceFile(projectName); err != nil {
+		return fmt.Errorf("writing project pg_service file: %w", err)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (s *Server) handleDeleteProjectSecret(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	if err := s.secrets.Delete(projectName, c.Param("secret")); err != nil {
+		if errors.Is(err, domain.ErrSecretNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Secret not found")
+		}
+		return fmt.Errorf("deleting project secret: %w", err)
+	}
+	if err := s.writePgServiceFile(projectName); err != nil {
+		return fmt.Errorf("writing project pg_service file: %w", err)
+	}
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type SecurityConfig struct {
+	ContentSecurityPolicy string
+	ReferrerPolicy        string
+	FrameOptions          string
+	HSTSMaxAge            int
+	// value of CSP frame-ancestors directive for pages which can be embedded (maps)
+	EmbedFrameAncestors string
+}
+
+// Global security headers, applied to all responses
+func SecurityHeadersMiddleware(cfg SecurityConfig) echo.MiddlewareFunc {
+	return middleware.SecureWithConfig(middleware.SecureConfig{
+		XSSProtection:         "1; mode=block",
+		ContentTypeNosniff:    "nosniff",
+		XFrameOptions:         cfg.FrameOptions,
+		HSTSMaxAge:            cfg.HSTSMaxAge,
+		ContentSecurityPolicy: cfg.ContentSecurityPolicy,
+		ReferrerPolicy:        cfg.ReferrerPolicy,
+	})
+}
+
+// Relaxes framing restrictions for routes used by embedded maps
+func EmbedHeadersMiddleware(cfg SecurityConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Response().Header()
+			header.Del(echo.HeaderXFrameOptions)
+			if cfg.EmbedFrameAncestors != "" {
+				header.Set(echo.HeaderContentSecurityPolicy, fmt.Sprintf("frame-ancestors %s", cfg.EmbedFrameAncestors))
+			} else {
+				header.Del(echo.HeaderContentSecurityPolicy)
+			}
+			return next(c)
+		}
+	}
+}
+
+// Restrictive headers for user-uploaded content (scripts, media files) served from the same origin,
+// so it cannot be rendered as an active document.
+func UntrustedContentMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Response().Header()
+			header.Set(echo.HeaderContentSecurityPolicy, "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+			header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+			header.Set(echo.HeaderXFrameOptions, "DENY")
+			return next(c)
+		}
+	}
+}
+
+// Returns extractor of the client IP address (c.RealIP), X-Forwarded-For header is used only
+// when the request comes from the trusted reverse proxy, otherwise it could be spoofed by clients
+func clientIPExtractor(trustedProxies []*net.IPNet) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, n := range trustedProxies {
+		options = append(options, echo.TrustIPRange(n))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// Networks of the 'private' value of trusted proxies (loopback and private networks)
+var privateNetworks = []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+
+// ParseTrustedProxies parses comma separated list of IP addresses or networks (CIDR), 'private'
+// value stands for loopback and private networks and 'none' for empty list
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" || item == "none" {
+			continue
+		}
+		if item == "private" {
+			for _, cidr := range privateNetworks {
+				_, n, _ := net.ParseCIDR(cidr)
+				networks = append(networks, n)
+			}
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address: %s", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network: %s", item)
+		}
+		networks = append(networks, n)
+	}
+	return networks, nil
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPExtractor(t *testing.T) {
+	trusted, err := ParseTrustedProxies("private")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		proxies  string
+		remote   string
+		xff      string
+		expected string
+	}{
+		{"direct client", "private", "203.0.113.5:1234", "", "203.0.113.5"},
+		{"spoofed header from untrusted client", "private", "203.0.113.5:1234", "198.51.100.1", "203.0.113.5"},
+		{"trusted proxy", "private", "10.0.0.2:1234", "198.51.100.1", "198.51.100.1"},
+		{"client prepended header", "private", "10.0.0.2:1234", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"proxies disabled", "none", "10.0.0.2:1234", "198.51.100.1", "10.0.0.2"},
+		{"explicit proxy", "192.0.2.10", "192.0.2.10:1234", "198.51.100.1", "198.51.100.1"},
+		{"other private proxy", "192.0.2.10", "10.0.0.2:1234", "198.51.100.1", "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies := trusted
+			if tt.proxies != "private" {
+				proxies, err = ParseTrustedProxies(tt.proxies)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if ip := clientIPExtractor(proxies)(req); ip != tt.expected {
+				t.Errorf("got %s, expected %s", ip, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	for _, value := range []string{"10.0.0.0/33", "proxy.local", "10.0.0"} {
+		if _, err := ParseTrustedProxies(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
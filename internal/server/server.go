@@ -3,11 +3,19 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/cache"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/csw"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/policy"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/postgres"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/ws"
 	"github.com/gisquick/gisquick-server/internal/server/auth"
@@ -21,23 +29,76 @@ import (
 )
 
 type Config struct {
-	Debug                bool
-	Language             string
-	LandingProject       string
-	MapserverURL         string
+	Debug          bool
+	Language       string
+	LandingProject string
+	MapserverURL   string
+	// unix socket of the map server (e.g. FastCGI/uwsgi HTTP bridge), requests are still built from MapserverURL.
+	// Offline packages are exported by external tools and need MapserverURL reachable over TCP.
+	MapserverSocket string
+	// shared key of the map server requests signing (disabled when empty)
+	MapserverSigningKey string
+	// projects directory inside the map server (container)
+	MapserverProjectsRoot string
+	// directory for generated pg_service.conf files (empty value disables them), path of the file
+	// is sent in X-Pg-Service-File header, which must be applied by the map server plugin
+	PgServiceRoot          string
+	MapserverPgServiceRoot string
+	// directories for offline map packages and attribute reports (empty value disables them)
+	OfflineRoot          string
+	OfflineJobTimeout    time.Duration
+	ReportsRoot          string
 	MapCacheRoot         string
 	ProjectsRoot         string
 	SiteURL              string
 	SecretKey            string
 	SessionExpiration    time.Duration
+	AccountDeletionGrace time.Duration
 	SignupAPI            bool
+	UserDirectory        bool
 	PluginsURL           string
 	MaxProjectSize       int64
 	ProjectCustomization bool
+	Security             SecurityConfig
+	// LISTEN channels for external data changes mapped to projects
+	DataChangesChannels map[string][]string
+	// optional access rules complementing static project settings
+	AccessPolicy *policy.Policy
+	Hooks        *policy.Hooks
+	Bandwidth    BandwidthConfig
+	Digest       DigestConfig
+	Anonymous    AnonymousLimitsConfig
+	Robots       RobotsConfig
+	Scim         ScimConfig
+	// public OGC endpoint /ows/:user/:name (with Basic auth challenge for non-public projects)
+	PublicOWS          bool
+	PublicOWSBasicAuth bool
+	Zip                ZipConfig
+	// server rendered pages of the public maps (/maps) for link previews and search engines
+	MapPages bool
+	// networks of the reverse proxies trusted to set X-Forwarded-For header, client IP address
+	// is taken directly from the connection when empty
+	TrustedProxies []*net.IPNet
+	// CSW catalog for publishing of projects metadata (nil when disabled)
+	Catalog *csw.Client
+	// OpenID Connect login (nil when disabled)
+	OIDC *auth.OIDCProvider
+	Cog  CogConfig
+	// metadata extraction of uploaded datasets
+	Datasets DatasetsConfig
+	// request body size limits and timeouts of the route groups
+	Limits RequestLimitsConfig
+	Proxy  ProxyConfig
+	// size limits of the map tiles cache
+	MapCache    MapCacheConfig
+	AssetsCache AssetsCacheConfig
+	Names       NamesConfig
+	Passwords   PasswordPolicy
+	// transport for outgoing requests (proxy and trusted certificates), default transport when nil
+	Outbound *http.Transport
+	WebApp   WebAppConfig
 }
 
-var extensions = make(map[string]func(s *Server) error, 0)
-
 type Server struct {
 	Config Config
 	echo   *echo.Echo
@@ -47,9 +108,43 @@ type Server struct {
 	accountsService   *application.AccountsService
 	projects          application.ProjectService
 	notifications     *project.RedisNotificationStore
+	projectLogs       *project.RedisProjectLogs
+	usage             *project.RedisProjectsUsage
+	secrets           *postgres.ProjectSecretsRepository
+	formsQueue        *project.RedisFormsQueue
+	offlineJobs       *jobRunner
+	reportJobs        *jobRunner
+	changes           *postgres.LayerChangesRepository
+	stats             *project.RedisRequestsStats
+	catalogStatus     *project.RedisCatalogStatus
+	rastersIndexMu    sync.Mutex
+	datasetsIndexMu   sync.Mutex
+	mapCacheMu        sync.Mutex
+	templatesMu       sync.Mutex
+	composedMu        sync.Mutex
+	quotaMu           sync.Mutex
+	cogJobs           *cogJobs
+	bulkJobs          *bulkJobs
+	uploads           *activeUploads
+	publishSessions   *publishSessions
+	notices           *projectNotifications
+	setup             setupState
+	maintenance       *maintenanceState
+	assets            *cache.FilesLRU
+	bandwidth         *bandwidthLimiters
+	anonymous         *anonymousLimiters
+	robotsTxt         *robotsTxtCache
+	layersPerms       *layersPermissionsCache
 	sws               *ws.SettingsWS
+	mapws             *ws.MapWS
 	limiter           application.AccountsLimiter
+	events            *application.EventBus
+	mapserver         *http.Client
+	outbound          *http.Client
 	shutdownCallbacks []func()
+	servers           []*http.Server
+	extensions        []enabledExtension
+	serversMu         sync.Mutex
 }
 
 type JSONSerializer struct{}
@@ -81,15 +176,32 @@ func (d JSONSerializer) Deserialize(c echo.Context, i interface{}) error {
 
 func NewServer(log *zap.SugaredLogger, cfg Config,
 	as *auth.AuthService, signUpService *application.AccountsService, projects application.ProjectService,
-	sws *ws.SettingsWS, limiter application.AccountsLimiter, notifications *project.RedisNotificationStore) *Server {
+	sws *ws.SettingsWS, limiter application.AccountsLimiter, notifications *project.RedisNotificationStore,
+	projectLogs *project.RedisProjectLogs, usage *project.RedisProjectsUsage, secrets *postgres.ProjectSecretsRepository,
+	formsQueue *project.RedisFormsQueue, changes *postgres.LayerChangesRepository, mapws *ws.MapWS,
+	stats *project.RedisRequestsStats, catalogStatus *project.RedisCatalogStatus, events *application.EventBus) *Server {
 	e := echo.New()
 	e.HideBanner = true
+	e.IPExtractor = clientIPExtractor(cfg.TrustedProxies)
 
 	p := prometheus.NewPrometheus("api", nil)
 	p.Use(e)
 
 	// e.JSONSerializer = &JSONSerializer{}
 	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		// project is being modified by another request (possibly on other server instance)
+		var lockErr *domain.ProjectLockedError
+		if errors.As(err, &lockErr) {
+			err = echo.NewHTTPError(http.StatusLocked, map[string]interface{}{
+				"message": "Project is locked by another operation",
+				"lock":    lockErr.Lock,
+			}).SetInternal(err)
+		}
+		// login locked after failed attempts (e.g. HTTP Basic authentication of OWS requests)
+		var accountLockedErr *auth.AccountLockedError
+		if errors.As(err, &accountLockedErr) {
+			err = loginError(c, accountLockedErr)
+		}
 		e.DefaultHTTPErrorHandler(err, c)
 		code := http.StatusInternalServerError
 		if he, ok := err.(*echo.HTTPError); ok {
@@ -118,7 +230,12 @@ func NewServer(log *zap.SugaredLogger, cfg Config,
 			},
 		}),
 		// SessionMiddlewareWithConfig(as.rdb),
+		SecurityHeadersMiddleware(cfg.Security),
 	)
+	outbound := cfg.Outbound
+	if outbound == nil {
+		outbound = http.DefaultTransport.(*http.Transport)
+	}
 	s := &Server{
 		Config:          cfg,
 		log:             log,
@@ -127,35 +244,62 @@ func NewServer(log *zap.SugaredLogger, cfg Config,
 		accountsService: signUpService,
 		projects:        projects,
 		sws:             sws,
+		mapws:           mapws,
 		limiter:         limiter,
+		events:          events,
 		notifications:   notifications,
+		projectLogs:     projectLogs,
+		usage:           usage,
+		secrets:         secrets,
+		formsQueue:      formsQueue,
+		offlineJobs:     newJobRunner(1, cfg.OfflineJobTimeout),
+		reportJobs:      newJobRunner(2, reportJobTimeout),
+		changes:         changes,
+		stats:           stats,
+		catalogStatus:   catalogStatus,
+		cogJobs:         newCogJobs(),
+		bulkJobs:        newBulkJobs(),
+		uploads:         newActiveUploads(),
+		publishSessions: newPublishSessions(),
+		notices:         newProjectNotifications(),
+		maintenance:     newMaintenanceState(cfg.ProjectsRoot),
+		bandwidth:       newBandwidthLimiters(cfg.Bandwidth),
+		anonymous:       newAnonymousLimiters(cfg.Anonymous),
+		robotsTxt:       &robotsTxtCache{},
+		layersPerms:     newLayersPermissionsCache(),
+		mapserver:       &http.Client{Transport: newSigningTransport(newMapserverTransport(outbound, cfg.MapserverSocket), cfg.MapserverSigningKey)},
+		outbound:        &http.Client{Transport: outbound},
+	}
+	if cfg.AssetsCache.Size > 0 {
+		s.assets = cache.NewFilesLRU(cfg.AssetsCache.Size, cfg.AssetsCache.MaxItemSize)
 	}
+	s.OnShutdown(s.layersPerms.Close)
+	s.subscribeEvents()
+	e.Use(s.apiTokenMiddleware, s.requestsStatsMiddleware, s.maintenanceMiddleware, RequestLimitsMiddleware(cfg.Limits.JSON))
 
 	// e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
 	s.AddRoutes(e)
 	return s
 }
 
-func (s *Server) ListenAndServe(addr string) error {
-	return s.echo.Start(addr)
-}
-
 func (s *Server) OnShutdown(fn func()) {
 	s.shutdownCallbacks = append(s.shutdownCallbacks, fn)
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.projects.Close()
+	s.projectLogs.Close()
 	for _, fn := range s.shutdownCallbacks {
 		fn()
 	}
-	return s.echo.Shutdown(ctx)
-}
-
-func (s *Server) AddExtension(name string) error {
-	extension, registred := extensions[name]
-	if !registred {
-		return fmt.Errorf("unknown server extension: %s", name)
+	s.serversMu.Lock()
+	defer s.serversMu.Unlock()
+	var err error
+	for _, srv := range s.servers {
+		if e := srv.Shutdown(ctx); e != nil && err == nil {
+			err = e
+		}
 	}
-	return extension(s)
+	s.stopExtensions(ctx)
+	return err
 }
@@ -1,8 +1,9 @@
 package server
 
 import (
-	"archive/zip"
+	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -22,6 +23,8 @@ import (
 	"github.com/disintegration/imaging"
 	"github.com/gisquick/gisquick-server/internal/application"
 	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/images"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 	_ "golang.org/x/image/webp"
@@ -34,8 +37,12 @@ var MaxJSONSize int64 = 1 * MB
 var MaxScriptSize int64 = 5 * MB
 
 func (s *Server) handleGetProjectFiles() func(echo.Context) error {
+	type FileEntry struct {
+		domain.ProjectFile
+		Dataset *DatasetInfo `json:"dataset,omitempty"`
+	}
 	type ProjectFiles struct {
-		Files          []domain.ProjectFile `json:"files"`
+		Files          []FileEntry          `json:"files"`
 		TemporaryFiles []domain.ProjectFile `json:"temporary"`
 	}
 	return func(c echo.Context) error {
@@ -47,7 +54,19 @@ func (s *Server) handleGetProjectFiles() func(echo.Context) error {
 			}
 			return fmt.Errorf("handleGetProjectFiles: %w", err)
 		}
-		return c.JSON(http.StatusOK, ProjectFiles{files, tmpFiles})
+		datasets, err := s.loadDatasetsIndex(projectName)
+		if err != nil {
+			s.log.Errorw("loading datasets index", "project", projectName, zap.Error(err))
+		}
+		entries := make([]FileEntry, len(files))
+		for i, f := range files {
+			entries[i].ProjectFile = f
+			// ignore info of replaced files
+			if d, ok := datasets[f.Path]; ok && d.Size == f.Size {
+				entries[i].Dataset = &d
+			}
+		}
+		return c.JSON(http.StatusOK, ProjectFiles{entries, tmpFiles})
 	}
 }
 
@@ -59,6 +78,11 @@ func (s *Server) handleGetProjects() func(echo.Context) error {
 	type QueryParams struct {
 		Projects string `query:"projects"`
 		Filter   string `query:"filter"`
+		Usage    bool   `query:"usage"`
+	}
+	type Payload struct {
+		Projects []domain.ProjectInfo `json:"projects"`
+		Usage    StorageUsage         `json:"usage"`
 	}
 	return func(c echo.Context) error {
 		var user domain.User
@@ -102,7 +126,7 @@ func (s *Server) handleGetProjects() func(echo.Context) error {
 			return c.JSON(http.StatusOK, data)
 		}
 		if strings.EqualFold(queryParams.Filter, "accessible") {
-			data, err := s.projects.AccessibleProjects(user.Username, true)
+			data, err := s.projects.AccessibleProjects(user, true)
 			if err != nil {
 				return fmt.Errorf("getting list of user accessible projects: %w", err)
 			}
@@ -112,6 +136,13 @@ func (s *Server) handleGetProjects() func(echo.Context) error {
 		if err != nil {
 			return err
 		}
+		if queryParams.Usage {
+			usage, err := s.storageUsage(user.Username, data)
+			if err != nil {
+				return err
+			}
+			return c.JSON(http.StatusOK, Payload{Projects: data, Usage: usage})
+		}
 		return c.JSON(http.StatusOK, data)
 	}
 }
@@ -127,7 +158,7 @@ func (s *Server) handleGetUserProjects(c echo.Context) error {
 
 func (s *Server) handleDeleteProject(c echo.Context) error {
 	projectName := c.Get("project").(string)
-	if err := s.projects.Delete(projectName); err != nil {
+	if err := s.deleteProject(c.Request().Context(), projectName); err != nil {
 		if errors.Is(err, domain.ErrProjectNotExists) {
 			return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
 		}
@@ -136,6 +167,28 @@ func (s *Server) handleDeleteProject(c echo.Context) error {
 	return c.NoContent(http.StatusOK)
 }
 
+// Deletes project with all related data (usage, layer changes, secrets and catalog record)
+func (s *Server) deleteProject(ctx context.Context, projectName string) error {
+	if err := s.projects.Delete(projectName); err != nil {
+		return err
+	}
+	if err := s.usage.Remove(ctx, projectName); err != nil {
+		s.log.Errorw("removing project usage", "project", projectName, zap.Error(err))
+	}
+	if err := s.changes.DeleteProject(projectName); err != nil {
+		s.log.Errorw("removing project layer changes", "project", projectName, zap.Error(err))
+	}
+	if err := s.secrets.DeleteAll(projectName); err != nil {
+		s.log.Errorw("removing project secrets", "project", projectName, zap.Error(err))
+	} else if err := s.writePgServiceFile(projectName); err != nil {
+		s.log.Errorw("removing project pg_service file", "project", projectName, zap.Error(err))
+	}
+	if s.Config.Catalog != nil {
+		go s.removeCatalogRecord(projectName)
+	}
+	return nil
+}
+
 // ProgressReader export
 type ProgressReader struct {
 	Reader   io.ReadCloser
@@ -167,13 +220,34 @@ func percProgress(size, total int) int {
 	return int(100 * (float64(size) / float64(total)))
 }
 
-func (s *Server) handleUpload() func(echo.Context) error {
-	type fileUploadProgress struct {
-		Files         map[string]int `json:"files"`
-		TotalProgress int            `json:"total"`
+// Converts error of the files upload into HTTP error
+func uploadFilesError(err error) error {
+	var pathErr *domain.FilePathError
+	if errors.As(err, &pathErr) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid file path %s", pathErr.Error()))
+	}
+	if errors.Is(err, errUploadCanceled) {
+		return echo.NewHTTPError(http.StatusConflict, "Upload was canceled")
 	}
+	if errors.Is(err, errRequestBodyTooLarge) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Request body is too large")
+	}
+	// better check in future release https://github.com/golang/go/issues/30715
+	if errors.Is(err, application.ErrAccountStorageLimit) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached account storage limit")
+	}
+	if errors.Is(err, application.ErrProjectSizeLimit) || err.Error() == "http: request body too large" {
+		// s.log.Warn("uploading files: max limit reached")
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached project size limit.")
+	}
+	return err
+}
+
+func (s *Server) handleUpload() func(echo.Context) error {
 	type uploadInfo struct {
 		Files []domain.ProjectFile `json:"files"`
+		// files from the user's data library linked into the project
+		Library []domain.LibraryLink `json:"library,omitempty"`
 	}
 
 	return func(c echo.Context) error {
@@ -193,8 +267,12 @@ func (s *Server) handleUpload() func(echo.Context) error {
 		if s.Config.MaxProjectSize > 0 {
 			req.Body = http.MaxBytesReader(c.Response(), req.Body, s.Config.MaxProjectSize)
 		}
-		reader := multipart.NewReader(req.Body, boundary)
 		projectName := c.Get("project").(string)
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+		upload := s.uploads.add(projectName, user.Username, cancel)
+		defer s.uploads.remove(upload.ID)
+		reader := multipart.NewReader(&cancelableReader{ctx: ctx, r: req.Body}, boundary)
 
 		// first part should contain upload info
 		var info uploadInfo
@@ -209,58 +287,74 @@ func (s *Server) handleUpload() func(echo.Context) error {
 			return err
 		}
 
-		totalSize := int64(0)
-		uploadSizeMap := make(map[string]int, len(info.Files))
-		for _, f := range info.Files {
-			uploadSizeMap[f.Path] = int(f.Size)
-			totalSize += f.Size
+		for i, f := range info.Files {
+			if info.Files[i].Path, err = project.NormalizePath(f.Path); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid file path: %s", f.Path))
+			}
 		}
-		// Ver. 1
-		uploadedSize := 0
-		uploadProgress := make(map[string]int)
-		lastNotification := time.Now()
+		tracker := newUploadTracker(info.Files)
 		nextFile := func() (string, io.ReadCloser, error) { // or ReadCloser?
 			part, err := reader.NextPart()
 			if err != nil {
 				return "", nil, err
 			}
+			path, err := project.NormalizePath(part.FormName())
+			if err != nil {
+				return "", nil, err
+			}
+			tracker.start(path)
 			var partReader io.ReadCloser = part
 			if strings.HasSuffix(part.FileName(), ".gz") && !strings.HasSuffix(part.FormName(), ".gz") {
 				partReader, _ = gzip.NewReader(part)
 			}
 			pr := &ProgressReader{Reader: partReader, Step: 32 * 1024, Callback: func(uploaded, last int) {
-				uploadProgress[part.FormName()] = percProgress(uploaded, uploadSizeMap[part.FormName()])
-				uploadedSize += last
-				now := time.Now()
-				if now.Sub(lastNotification).Seconds() > 0.5 {
-
-					totalProgress := percProgress(uploadedSize, int(totalSize))
-					s.log.Infow("upload progress", "file", part.FormName(), "uploaded", uploaded, "delta", last, "totalUploaded", uploadedSize, "totalSize", totalSize, "totalProgress", totalProgress)
-					s.sws.AppChannel().Send(user.Username, "UploadProgress", fileUploadProgress{uploadProgress, totalProgress})
-
-					lastNotification = now
-					uploadProgress = make(map[string]int)
+				if tracker.update(path, uploaded, last) {
+					s.sws.AppChannel().Send(user.Username, "UploadProgress", tracker.progress())
 				}
 			}}
-			return part.FormName(), pr, nil
+			return path, pr, nil
 		}
 		changes := domain.FilesChanges{Updates: info.Files}
 		if _, err := s.projects.UpdateFiles(projectName, changes, nextFile); err != nil {
-			// better check in future release https://github.com/golang/go/issues/30715
-			if errors.Is(err, application.ErrAccountStorageLimit) {
-				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached account storage limit")
+			if ctx.Err() != nil && req.Context().Err() == nil {
+				err = errUploadCanceled
 			}
-			if errors.Is(err, application.ErrProjectSizeLimit) || err.Error() == "http: request body too large" {
-				// s.log.Warn("uploading files: max limit reached")
-				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached project size limit.")
+			err = uploadFilesError(err)
+			msg := "Upload failed"
+			if he, ok := err.(*echo.HTTPError); ok {
+				msg = fmt.Sprint(he.Message)
 			}
+			s.sws.AppChannel().Send(user.Username, "UploadSummary", tracker.summary(msg))
 			return err
 		}
 		// finish reading from stream
 		if _, err := reader.NextPart(); err != io.EOF {
 			s.log.Warnf("expected end of stream", "project", projectName)
 		}
-		s.sws.AppChannel().Send(user.Username, "UploadProgress", fileUploadProgress{uploadProgress, 100})
+		if _, err := s.linkLibraryFiles(projectName, info.Library); err != nil {
+			return err
+		}
+		progress := tracker.progress()
+		progress.TotalProgress = 100
+		s.sws.AppChannel().Send(user.Username, "UploadProgress", progress)
+		s.sws.AppChannel().Send(user.Username, "UploadSummary", tracker.summary(""))
+
+		var rasters []domain.ProjectFile
+		for _, f := range info.Files {
+			if isRasterFile(f.Path) {
+				rasters = append(rasters, f)
+			}
+		}
+		go func() {
+			var rastersInfo []RasterInfo
+			if len(rasters) > 0 {
+				rastersInfo = s.indexRasterFiles(projectName, rasters)
+				if s.Config.Cog.Converter != "" {
+					s.offerCogConversion(user.Username, projectName, rasters)
+				}
+			}
+			s.indexDatasets(projectName, info.Files, rastersInfo)
+		}()
 
 		// Ver. 2
 		/*
@@ -342,15 +436,16 @@ func (s *Server) handleProjectOws() func(echo.Context) error {
 		req.URL.Scheme = target.Scheme
 		req.URL.Host = target.Host
 
+		s.scrubProxyHeaders(req.Header, internalProxyHeaders...)
 		if _, ok := req.Header["User-Agent"]; !ok {
 			// explicitly disable User-Agent so it's not set to default value
 			req.Header.Set("User-Agent", "")
 		}
 	}
 	reverseProxy := &httputil.ReverseProxy{Director: director}
-	reverseProxy.ErrorHandler = func(rw http.ResponseWriter, r *http.Request, e error) {
-		s.log.Errorw("mapserver proxy error", zap.Error(e))
-	}
+	reverseProxy.ErrorHandler = s.proxyErrorHandler("project_ows")
+	reverseProxy.Transport = s.mapserver.Transport
+	s.configureProxyStreaming(reverseProxy)
 	// reverseProxy.ErrorLog.SetOutput(os.Stdout)
 	return func(c echo.Context) error {
 		// params := new(RequestParams)
@@ -373,12 +468,12 @@ func (s *Server) handleProjectOws() func(echo.Context) error {
 			}
 			return err
 		}
-		// TODO: hardcoded /publish/ directory!
-		owsProject := filepath.Join("/publish/", projectName, p.QgisFile)
+		owsProject := s.owsProjectPath(projectName, p.QgisFile)
 		s.log.Infow("GetMap", "ows_project", owsProject)
 		query := c.Request().URL.Query()
 		query.Set("MAP", owsProject)
 		c.Request().URL.RawQuery = query.Encode()
+		s.setPgServiceHeader(c.Request(), projectName)
 
 		reverseProxy.ServeHTTP(c.Response(), c.Request())
 		return nil
@@ -389,7 +484,6 @@ func (s *Server) handleCreateProject() func(echo.Context) error {
 	return func(c echo.Context) error {
 		// TODO: check project folder/index file doesn't exists
 		req := c.Request()
-		req.Body = http.MaxBytesReader(c.Response(), req.Body, MaxJSONSize)
 		defer req.Body.Close()
 
 		var data json.RawMessage
@@ -399,6 +493,9 @@ func (s *Server) handleCreateProject() func(echo.Context) error {
 		}
 		username := c.Param("user")
 		name := c.Param("name")
+		if err := s.Config.Names.ValidateProjectName(name); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
 		projName := filepath.Join(username, name)
 		info, err := s.projects.Create(projName, data)
 		if err != nil {
@@ -411,69 +508,145 @@ func (s *Server) handleCreateProject() func(echo.Context) error {
 			return err
 		}
 		s.log.Infow("Created project", "info", info)
+		if err := s.initProjectSettings(projName); err != nil {
+			s.log.Errorw("applying project defaults", "project", projName, zap.Error(err))
+		}
 		return c.JSON(http.StatusOK, info)
 	}
 }
 
-func (s *Server) handleGetProjectFullInfo() func(echo.Context) error {
-	type FullInfo struct {
-		Auth       string          `json:"authentication"`
-		Name       string          `json:"name"`
-		Title      string          `json:"title"`
-		Created    time.Time       `json:"created"`
-		LastUpdate time.Time       `json:"last_update"`
-		State      string          `json:"state"`
-		Size       int64           `json:"size"`
-		Thumbnail  bool            `json:"thumbnail"`
-		Meta       domain.QgisMeta `json:"meta"`
-		// Meta     json.RawMessage         `json:"meta"`
-		Settings *domain.ProjectSettings `json:"settings"`
-		Scripts  domain.Scripts          `json:"scripts"`
+// Maximal number of projects in a single batch request
+const maxBatchProjects = 50
+
+type ProjectFullInfo struct {
+	Auth       string          `json:"authentication"`
+	Name       string          `json:"name"`
+	Title      string          `json:"title"`
+	Created    time.Time       `json:"created"`
+	LastUpdate time.Time       `json:"last_update"`
+	State      string          `json:"state"`
+	Size       int64           `json:"size"`
+	Thumbnail  bool            `json:"thumbnail"`
+	Meta       domain.QgisMeta `json:"meta"`
+	// Meta     json.RawMessage         `json:"meta"`
+	Settings    *domain.ProjectSettings `json:"settings"`
+	Scripts     domain.Scripts          `json:"scripts"`
+	Description string                  `json:"description,omitempty"`
+}
+
+func (s *Server) projectFullInfo(projectName string) (*ProjectFullInfo, error) {
+	info, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		return nil, fmt.Errorf("loading project info: %w", err)
+	}
+	// var meta json.RawMessage
+	var meta domain.QgisMeta
+	if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+		return nil, fmt.Errorf("loading qgis meta: %w", err)
+	}
+	data := &ProjectFullInfo{
+		Auth:       info.Authentication,
+		Name:       projectName,
+		Title:      info.Title,
+		Created:    info.Created,
+		LastUpdate: info.LastUpdate,
+		State:      info.State,
+		Size:       info.Size,
+		Thumbnail:  info.Thumbnail,
+		Meta:       meta,
+	}
+	if info.State != "empty" {
+		settings, err := s.projects.GetStoredSettings(projectName)
+		if err == nil {
+			data.Settings = &settings
+		} else {
+			s.log.Warnw("[handleGetProjectInfo] settings not found", "project", projectName, zap.Error(err))
+		}
+	}
+	scripts, err := s.projects.GetScripts(projectName)
+	if err != nil {
+		s.log.Errorw("[handleGetProjectInfo] loading scripts", "project", projectName)
+	} else {
+		data.Scripts = scripts
+	}
+	description, err := s.projects.GetDescription(projectName)
+	if err != nil {
+		s.log.Errorw("[handleGetProjectInfo] loading description", "project", projectName, zap.Error(err))
+	} else {
+		data.Description = description
 	}
+	return data, nil
+}
+
+func (s *Server) handleGetProjectFullInfo() func(echo.Context) error {
 	return func(c echo.Context) error {
 		projectName := c.Get("project").(string)
-		info, err := s.projects.GetProjectInfo(projectName)
+		data, err := s.projectFullInfo(projectName)
 		if err != nil {
 			if errors.Is(err, domain.ErrProjectNotExists) {
 				return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
 			}
-			return fmt.Errorf("[handleGetProjectInfo] loading project info: %w", err)
+			return fmt.Errorf("[handleGetProjectInfo] %w", err)
 		}
-		// var meta json.RawMessage
-		var meta domain.QgisMeta
-		if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
-			return fmt.Errorf("[handleGetProjectInfo] loading qgis meta: %w", err)
-		}
-		// meta, err := s.projects.GetQgisMetadata(projectName)
-		// if err != nil {
-		// 	return fmt.Errorf("[handleGetProjectInfo] loading qgis meta: %w", err)
-		// }
-		data := FullInfo{
-			Auth:       info.Authentication,
-			Name:       projectName,
-			Title:      info.Title,
-			Created:    info.Created,
-			LastUpdate: info.LastUpdate,
-			State:      info.State,
-			Size:       info.Size,
-			Thumbnail:  info.Thumbnail,
-			Meta:       meta,
-		}
-		if info.State != "empty" {
-			settings, err := s.projects.GetSettings(projectName)
-			if err == nil {
-				data.Settings = &settings
-			} else {
-				s.log.Warnw("[handleGetProjectInfo] settings not found", "project", projectName, zap.Error(err))
+		return c.JSON(http.StatusOK, data)
+	}
+}
+
+// Checks that the name is in the "user/project" format
+func isValidProjectName(name string) bool {
+	parts := strings.Split(name, "/")
+	return len(parts) == 2 && parts[0] != "" && parts[1] != "" && parts[0] != ".." && parts[1] != ".."
+}
+
+// Returns full info of multiple projects, errors are reported per project
+func (s *Server) handleGetProjectsFullInfo() func(echo.Context) error {
+	type Item struct {
+		Name   string           `json:"name"`
+		Status int              `json:"status"`
+		Info   *ProjectFullInfo `json:"info,omitempty"`
+		Error  string           `json:"error,omitempty"`
+	}
+	return func(c echo.Context) error {
+		var names []string
+		for _, name := range strings.Split(c.QueryParam("names"), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
 			}
 		}
-		scripts, err := s.projects.GetScripts(projectName)
+		if len(names) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Missing names parameter")
+		}
+		if len(names) > maxBatchProjects {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Too many projects (max %d)", maxBatchProjects))
+		}
+		user, err := s.auth.GetUser(c)
 		if err != nil {
-			s.log.Errorw("[handleGetProjectInfo] loading scripts", "project", projectName)
-		} else {
-			data.Scripts = scripts
+			return err
 		}
-		return c.JSON(http.StatusOK, data)
+		items := make([]Item, len(names))
+		for i, projectName := range names {
+			item := Item{Name: projectName, Status: http.StatusOK}
+			if !isValidProjectName(projectName) {
+				item.Status, item.Error = http.StatusBadRequest, "Invalid project name"
+			} else if err := checkProjectAdminAccess(s.projects, user, strings.Split(projectName, "/")[0], projectName); err != nil {
+				if errors.Is(err, domain.ErrProjectNotExists) {
+					item.Status, item.Error = http.StatusNotFound, "Project does not exists"
+				} else {
+					item.Status, item.Error = http.StatusForbidden, "Access denied"
+				}
+			} else if info, err := s.projectFullInfo(projectName); err != nil {
+				if errors.Is(err, domain.ErrProjectNotExists) {
+					item.Status, item.Error = http.StatusNotFound, "Project does not exists"
+				} else {
+					s.log.Errorw("getting project full info", "project", projectName, zap.Error(err))
+					item.Status, item.Error = http.StatusInternalServerError, "Failed to load project info"
+				}
+			} else {
+				item.Info = info
+			}
+			items[i] = item
+		}
+		return c.JSON(http.StatusOK, items)
 	}
 }
 
@@ -493,7 +666,6 @@ func (s *Server) handleUpdateProjectMeta() func(echo.Context) error {
 	return func(c echo.Context) error {
 		projectName := c.Get("project").(string)
 		req := c.Request()
-		req.Body = http.MaxBytesReader(c.Response(), req.Body, MaxJSONSize)
 		defer req.Body.Close()
 
 		var data json.RawMessage
@@ -518,14 +690,20 @@ func (s *Server) handleUpdateProjectMeta() func(echo.Context) error {
 func (s *Server) handleSaveProjectSettings(c echo.Context) error {
 	projectName := c.Get("project").(string)
 	req := c.Request()
-	req.Body = http.MaxBytesReader(c.Response(), req.Body, MaxJSONSize)
 	defer req.Body.Close()
 
-	var data json.RawMessage
+	var settings map[string]json.RawMessage
 	d := json.NewDecoder(req.Body)
-	if err := d.Decode(&data); err != nil {
+	if err := d.Decode(&settings); err != nil || settings == nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
 	}
+	if err := s.applyProjectDefaults(settings); err != nil {
+		return err
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
 	return s.projects.UpdateSettings(projectName, data)
 }
 
@@ -540,7 +718,15 @@ func (s *Server) handleUploadThumbnail(c echo.Context) error {
 	defer f.Close()
 	projectName := c.Get("project").(string)
 	s.log.Infow("thumbnail", "project", projectName, "image", h.Filename)
-	if err := s.projects.SaveThumbnail(projectName, f); err != nil {
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("reading thumbnail: %w", err)
+	}
+	data, err = images.SanitizeThumbnail(data, maxImagePixels, thumbnailMaxSize)
+	if err != nil {
+		return imageUploadError(err)
+	}
+	if err := s.projects.SaveThumbnail(projectName, bytes.NewReader(data)); err != nil {
 		return err
 	}
 	return c.NoContent(http.StatusOK)
@@ -550,7 +736,7 @@ func (s *Server) handleGetThumbnail(c echo.Context) error {
 	username := c.Param("user")
 	name := c.Param("name")
 	projectName := filepath.Join(username, name)
-	return c.File(s.projects.GetThumbnailPath(projectName))
+	return s.serveAsset(c, s.projects.GetThumbnailPath(projectName))
 }
 
 func (s *Server) handleScriptUpload() func(echo.Context) error {
@@ -562,7 +748,6 @@ func (s *Server) handleScriptUpload() func(echo.Context) error {
 		projectName := c.Get("project").(string)
 
 		req := c.Request()
-		req.Body = http.MaxBytesReader(c.Response(), req.Body, MaxJSONSize)
 		if err := req.ParseMultipartForm(2 * MB); err != nil {
 			return err
 		}
@@ -669,6 +854,9 @@ func CopyFile(dest io.Writer, path string) error {
 func (s *Server) handleDownloadProjectFiles(c echo.Context) error {
 	projectName := c.Get("project").(string)
 	filePath := c.Param("*")
+	if filePath == "" && c.QueryParam("format") == "qgis" {
+		return s.downloadQgisBundle(c, projectName)
+	}
 	fullPath := filepath.Join(s.Config.ProjectsRoot, projectName, filePath)
 
 	name := filepath.Base(fullPath)
@@ -680,7 +868,7 @@ func (s *Server) handleDownloadProjectFiles(c echo.Context) error {
 	if info.IsDir() {
 		c.Response().Header().Set("Content-Type", "application/octet-stream")
 		c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", name))
-		writer := zip.NewWriter(c.Response())
+		writer := s.newZipWriter(c.Response())
 		defer writer.Close()
 		rootPath := filepath.Dir(fullPath)
 		err := filepath.WalkDir(fullPath, func(path string, entry fs.DirEntry, err error) error {
@@ -690,11 +878,11 @@ func (s *Server) handleDownloadProjectFiles(c echo.Context) error {
 			if !entry.IsDir() {
 				// relPath2 := path[len(rootPath)+1:]
 				relPath, _ := filepath.Rel(rootPath, path)
-				part, err := writer.Create(relPath)
+				info, err := entry.Info()
 				if err != nil {
 					return err
 				}
-				return CopyFile(part, path)
+				return s.addZipFile(writer, path, relPath, info)
 			}
 			return nil
 		})
@@ -714,20 +902,30 @@ func (s *Server) handleInlineProjectFile(c echo.Context) error {
 }
 
 func (s *Server) handleProjectReload(c echo.Context) error {
-	client := &http.Client{}
 	projectName := c.Get("project").(string)
-	p, err := s.projects.GetProjectInfo(projectName)
-	if err != nil {
+	if err := s.reloadProject(c.Request().Context(), projectName); err != nil {
 		if errors.Is(err, domain.ErrProjectNotExists) {
 			return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
 		}
+		if errors.Is(err, context.Canceled) {
+			cancelledRequestsCounter.WithLabelValues("project_reload").Inc()
+			return c.NoContent(StatusClientClosedRequest)
+		}
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// Reloads project on the QGIS server
+func (s *Server) reloadProject(ctx context.Context, projectName string) error {
+	p, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
 		return err
 	}
-	// TODO: hardcoded /publish/ directory!
-	owsProject := filepath.Join("/publish/", projectName, p.QgisFile)
+	owsProject := s.owsProjectPath(projectName, p.QgisFile)
 	params := url.Values{"MAP": {owsProject}}
 
-	req, err := http.NewRequest(http.MethodPost, s.Config.MapserverURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Config.MapserverURL, nil)
 	if err != nil {
 		return fmt.Errorf("[handleProjectReload] building request: %w", err)
 	}
@@ -735,7 +933,7 @@ func (s *Server) handleProjectReload(c echo.Context) error {
 	req.URL.RawQuery = params.Encode()
 	// s.log.Infow("[handleProjectReload]", "project", projectName, "url", req.URL.String())
 
-	resp, err := client.Do(req)
+	resp, err := s.mapserver.Do(req)
 	if err != nil {
 		return fmt.Errorf("mapserver request: %w", err)
 	}
@@ -745,7 +943,7 @@ func (s *Server) handleProjectReload(c echo.Context) error {
 		s.log.Errorw("[handleProjectReload]", "project", projectName, "status", resp.StatusCode, "msg", string(msg))
 		return fmt.Errorf("reloading project on qgis server: %s", string(msg))
 	}
-	return c.NoContent(http.StatusOK)
+	return nil
 }
 
 /*
@@ -860,7 +1058,7 @@ func (s *Server) mediaFileHandler(cacheDir string) func(echo.Context) error {
 		}
 		// maybe when media folders permissions will be implemented
 		// c.Response().Header().Set("Cache-Control", "private, must-revalidate")
-		return c.File(absPath)
+		return s.serveAsset(c, absPath)
 	}
 }
 
@@ -870,7 +1068,7 @@ func (s *Server) appMediaFileHandler(c echo.Context) error {
 	projectName := filepath.Join(username, name)
 	filePath := c.Param("*")
 	absPath := filepath.Join(s.Config.ProjectsRoot, projectName, "web", "app", filePath)
-	return c.File(absPath)
+	return s.serveAsset(c, absPath)
 }
 
 type MediaFile struct {
@@ -900,12 +1098,30 @@ func (s *Server) handleUploadMediaFile(c echo.Context) error {
 	if err != nil {
 		return fmt.Errorf("reading upload file: %w", err)
 	}
+	defer src.Close()
+	var reader io.Reader = src
+	filename, size := file.Filename, file.Size
+	// images are re-encoded to strip metadata and embedded scripts
+	if images.IsImageFile(filename) {
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return fmt.Errorf("reading upload file: %w", err)
+		}
+		if data, filename, err = images.Sanitize(data, filename, maxImagePixels); err != nil {
+			return imageUploadError(err)
+		}
+		reader, size = bytes.NewReader(data), int64(len(data))
+	}
 
-	finfo, err := s.projects.SaveFile(projectName, directory, file.Filename, src, file.Size)
+	finfo, err := s.projects.SaveFile(projectName, directory, filename, reader, size)
 	if err != nil {
 		if errors.Is(err, application.ErrProjectSizeLimit) {
 			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached project size limit.")
 		}
+		var pathErr *domain.FilePathError
+		if errors.As(err, &pathErr) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid file path %s", pathErr.Error()))
+		}
 		return err
 	}
 	return c.JSON(http.StatusOK, MediaFile{finfo, filepath.Base(finfo.Path)})
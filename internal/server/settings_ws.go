@@ -16,15 +16,3 @@ func (s *Server) handleWebAppWS(c echo.Context) error {
 	}
 	return nil
 }
-
-func (s *Server) handlePluginWS(c echo.Context) error {
-	user, err := s.auth.GetUser(c)
-	if err != nil {
-		return err
-	}
-	err = s.sws.PluginHandler(user.Username, c.Response(), c.Request())
-	if err != nil {
-		s.log.Errorw("websocket handler", "channel", "plugin", "user", user.Username, zap.Error(err))
-	}
-	return nil
-}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// First-run setup, enabled only when there are no user accounts. Setup token is generated
+// at startup and printed to the logs, so only the operator of the instance can create
+// the first superuser account.
+type setupState struct {
+	mu    sync.Mutex
+	token string
+}
+
+// PrepareSetup enables first-run setup when the accounts database is empty
+func (s *Server) PrepareSetup() error {
+	accounts, err := s.accountsService.Repository.GetAllAccounts()
+	if err != nil {
+		return fmt.Errorf("checking user accounts: %w", err)
+	}
+	if len(accounts) > 0 {
+		return nil
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	s.setup.mu.Lock()
+	s.setup.token = hex.EncodeToString(b)
+	s.setup.mu.Unlock()
+	s.log.Warnw("no user accounts found, first-run setup is enabled (POST /api/setup)", "token", s.setup.token)
+	return nil
+}
+
+// Sets value of the stored JSON object, other stored values are kept unchanged
+func updateJSONFile(path, key string, value interface{}) error {
+	obj := make(map[string]json.RawMessage)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return err
+		}
+	}
+	if obj[key], err = json.Marshal(value); err != nil {
+		return err
+	}
+	if data, err = json.Marshal(obj); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (s *Server) handleGetSetup(c echo.Context) error {
+	s.setup.mu.Lock()
+	required := s.setup.token != ""
+	s.setup.mu.Unlock()
+	return c.JSON(http.StatusOK, map[string]bool{"required": required})
+}
+
+func (s *Server) handleSetup() func(echo.Context) error {
+	type SetupForm struct {
+		Token        string `json:"token"`
+		Username     string `json:"username"`
+		Email        string `json:"email"`
+		Password     string `json:"password"`
+		FirstName    string `json:"first_name"`
+		LastName     string `json:"last_name"`
+		InstanceName string `json:"instance_name"`
+		ContactEmail string `json:"contact_email"`
+	}
+	return func(c echo.Context) error {
+		form := new(SetupForm)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		if token := c.Request().Header.Get("X-Setup-Token"); token != "" {
+			form.Token = token
+		}
+		s.setup.mu.Lock()
+		defer s.setup.mu.Unlock()
+		if s.setup.token == "" {
+			return echo.ErrNotFound
+		}
+		if subtle.ConstantTimeCompare([]byte(form.Token), []byte(s.setup.token)) != 1 {
+			return echo.NewHTTPError(http.StatusForbidden, "Invalid setup token")
+		}
+		// accounts could be created by other server instance or from command line
+		accounts, err := s.accountsService.Repository.GetAllAccounts()
+		if err != nil {
+			return fmt.Errorf("checking user accounts: %w", err)
+		}
+		if len(accounts) > 0 {
+			s.setup.token = ""
+			return echo.ErrNotFound
+		}
+		username, err := s.Config.Names.NormalizeUsername(form.Username)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if form.Password == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Missing password")
+		}
+		if err := s.Config.Passwords.Validate(form.Password); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		account, err := domain.NewAccount(username, form.Email, form.FirstName, form.LastName, form.Password)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		account.Active = true
+		account.Superuser = true
+		if err := s.accountsService.Repository.Create(account); err != nil {
+			s.log.Errorw("creating superuser account", "username", username, zap.Error(err))
+			return fmt.Errorf("failed to create user account")
+		}
+		s.setup.token = ""
+		s.events.Publish(application.Event{Type: application.EventUserRegistered, User: account.Username})
+		s.log.Infow("first-run setup completed", "username", username)
+
+		if form.InstanceName != "" {
+			if err := updateJSONFile(s.brandingPath(), "instance_name", form.InstanceName); err != nil {
+				s.log.Errorw("saving branding", zap.Error(err))
+			}
+		}
+		if form.ContactEmail != "" {
+			if err := updateJSONFile(s.helpContentPath(), "contact_email", form.ContactEmail); err != nil {
+				s.log.Errorw("saving help content", zap.Error(err))
+			}
+		}
+		return c.JSON(http.StatusOK, map[string]string{"username": account.Username})
+	}
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "branding.json")
+	if err := updateJSONFile(path, "instance_name", "Gisquick"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != `{"instance_name":"Gisquick"}` {
+		t.Errorf("unexpected content: %s", data)
+	}
+	stored := `{"colors":{"primary":"#336699"},"images":{"logo":"logo.png"},"instance_name":"Old"}`
+	if err := os.WriteFile(path, []byte(stored), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateJSONFile(path, "instance_name", "New"); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"colors":{"primary":"#336699"},"images":{"logo":"logo.png"},"instance_name":"New"}`
+	if data, _ := os.ReadFile(path); string(data) != expected {
+		t.Errorf("got %s, expected %s", data, expected)
+	}
+}
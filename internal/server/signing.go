@@ -0,0 +1,131 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Requests to the map server can be signed with shared key, so the map server (Gisquick QGIS
+// Server plugin) can reject requests which didn't pass through the permission checks of this
+// server. Signature is hex encoded HMAC-SHA256 of "<expires>\n<method>\n<canonical query>", where
+// expires is Unix timestamp sent in the X-Gisquick-Expires header. Canonical query contains
+// signed parameters (all parameters or parameters listed in the X-Gisquick-Signed-Params header)
+// with upper case names, sorted by name and encoded as URL query. Signature parameters are never
+// included, so they can be also sent as query parameters.
+const (
+	signatureHeader             = "X-Gisquick-Signature"
+	signatureExpiresHeader      = "X-Gisquick-Expires"
+	signatureSignedParamsHeader = "X-Gisquick-Signed-Params"
+	// validity of the signature of proxied requests (tolerates clock differences)
+	signatureTTL = time.Minute
+)
+
+// Returns canonical form of the query, only given parameters are included when params is not empty
+func canonicalQuery(query url.Values, params []string) string {
+	signed := make(map[string]bool, len(params))
+	for _, p := range params {
+		signed[strings.ToUpper(p)] = true
+	}
+	values := make(map[string][]string, len(query))
+	for name, v := range query {
+		name = strings.ToUpper(name)
+		if strings.EqualFold(name, signatureHeader) || strings.EqualFold(name, signatureExpiresHeader) || strings.EqualFold(name, signatureSignedParamsHeader) {
+			continue
+		}
+		if len(signed) > 0 && !signed[name] {
+			continue
+		}
+		values[name] = append(values[name], v...)
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		v := append([]string(nil), values[name]...)
+		sort.Strings(v)
+		for _, value := range v {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(name) + "=" + url.QueryEscape(value))
+		}
+	}
+	return b.String()
+}
+
+func mapserverSignature(key []byte, expires int64, method string, query url.Values, params []string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(strconv.FormatInt(expires, 10) + "\n" + strings.ToUpper(method) + "\n" + canonicalQuery(query, params)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Returns signature headers of the map server request. Only given parameters are signed when
+// params is not empty (for requests with parameters which are not known in advance).
+func mapserverSignatureHeaders(key []byte, method string, query url.Values, params []string, expires time.Time) http.Header {
+	header := http.Header{}
+	if len(key) == 0 {
+		return header
+	}
+	ts := expires.Unix()
+	header.Set(signatureExpiresHeader, strconv.FormatInt(ts, 10))
+	header.Set(signatureHeader, mapserverSignature(key, ts, method, query, params))
+	if len(params) > 0 {
+		header.Set(signatureSignedParamsHeader, strings.Join(params, ","))
+	}
+	return header
+}
+
+// Verifies signature of the map server request (reference implementation of the check
+// done by the map server plugin)
+func verifyMapserverSignature(key []byte, req *http.Request, now time.Time) bool {
+	expires, err := strconv.ParseInt(req.Header.Get(signatureExpiresHeader), 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+	var params []string
+	if h := req.Header.Get(signatureSignedParamsHeader); h != "" {
+		params = strings.Split(h, ",")
+	}
+	signature, err := hex.DecodeString(req.Header.Get(signatureHeader))
+	if err != nil {
+		return false
+	}
+	expected, _ := hex.DecodeString(mapserverSignature(key, expires, req.Method, req.URL.Query(), params))
+	return hmac.Equal(signature, expected)
+}
+
+// Transport which signs all requests to the map server
+type signingTransport struct {
+	base http.RoundTripper
+	key  []byte
+}
+
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTripper must not modify the original request
+	req = req.Clone(req.Context())
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	for k, v := range mapserverSignatureHeaders(t.key, method, req.URL.Query(), nil, time.Now().Add(signatureTTL)) {
+		req.Header[k] = v
+	}
+	return t.base.RoundTrip(req)
+}
+
+func newSigningTransport(base http.RoundTripper, key string) http.RoundTripper {
+	if key == "" {
+		return base
+	}
+	return &signingTransport{base: base, key: []byte(key)}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCanonicalQuery(t *testing.T) {
+	a, _ := url.ParseQuery("service=WMS&REQUEST=GetMap&LAYERS=b&layers=a&MAP=user/project/project.qgs&X-Gisquick-Signature=abc")
+	b, _ := url.ParseQuery("MAP=user/project/project.qgs&LAYERS=a&LAYERS=b&REQUEST=GetMap&SERVICE=WMS")
+	if canonicalQuery(a, nil) != canonicalQuery(b, nil) {
+		t.Errorf("canonical forms differ:\n %s\n %s", canonicalQuery(a, nil), canonicalQuery(b, nil))
+	}
+	expected := "LAYERS=a&LAYERS=b&MAP=user%2Fproject%2Fproject.qgs&REQUEST=GetMap&SERVICE=WMS"
+	if res := canonicalQuery(a, nil); res != expected {
+		t.Errorf("got %s, expected %s", res, expected)
+	}
+	if res := canonicalQuery(a, []string{"map"}); res != "MAP=user%2Fproject%2Fproject.qgs" {
+		t.Errorf("unexpected canonical query of signed params: %s", res)
+	}
+}
+
+func TestVerifyMapserverSignature(t *testing.T) {
+	key := []byte("secret")
+	now := time.Now()
+	target := "http://mapserver/ows?MAP=user/project/project.qgs&SERVICE=WMS&REQUEST=GetMap&LAYERS=parks"
+	sign := func(req *http.Request, params []string) {
+		for k, v := range mapserverSignatureHeaders(key, req.Method, req.URL.Query(), params, now.Add(signatureTTL)) {
+			req.Header[k] = v
+		}
+	}
+	tests := []struct {
+		name     string
+		method   string
+		params   []string
+		modify   func(req *http.Request)
+		expected bool
+	}{
+		{"valid", http.MethodGet, nil, func(req *http.Request) {}, true},
+		{"changed layers", http.MethodGet, nil, func(req *http.Request) {
+			req.URL.RawQuery = "MAP=user/project/project.qgs&SERVICE=WMS&REQUEST=GetMap&LAYERS=parcels"
+		}, false},
+		{"added parameter", http.MethodGet, nil, func(req *http.Request) { req.URL.RawQuery += "&FILTER=x" }, false},
+		{"changed map", http.MethodGet, nil, func(req *http.Request) {
+			req.URL.RawQuery = "MAP=user/other/project.qgs&SERVICE=WMS&REQUEST=GetMap&LAYERS=parks"
+		}, false},
+		{"changed method", http.MethodGet, nil, func(req *http.Request) { req.Method = http.MethodPost }, false},
+		{"reordered parameters", http.MethodGet, nil, func(req *http.Request) {
+			req.URL.RawQuery = "layers=parks&request=GetMap&service=WMS&map=user/project/project.qgs"
+		}, true},
+		{"signed params", http.MethodGet, []string{"MAP"}, func(req *http.Request) { req.URL.RawQuery += "&BBOX=0,0,1,1" }, true},
+		{"signed params changed map", http.MethodGet, []string{"MAP"}, func(req *http.Request) {
+			req.URL.RawQuery = "MAP=user/other/project.qgs"
+		}, false},
+		{"changed signature", http.MethodGet, nil, func(req *http.Request) { req.Header.Set(signatureHeader, "00") }, false},
+		{"expired", http.MethodGet, nil, func(req *http.Request) {
+			req.Header.Set(signatureExpiresHeader, "1000")
+		}, false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, target, nil)
+		sign(req, tt.params)
+		tt.modify(req)
+		if res := verifyMapserverSignature(key, req, now); res != tt.expected {
+			t.Errorf("%s: got %v, expected %v", tt.name, res, tt.expected)
+		}
+	}
+}
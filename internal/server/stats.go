@@ -0,0 +1,126 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	statsRequests          = "requests"
+	statsMapserverRequests = "mapserver_requests"
+	statsMapserverErrors   = "mapserver_errors"
+	// counters of the projects events
+	statsProjectLoads       = "loads"
+	statsProjectOwsRequests = "ows_requests"
+	statsProjectOwsErrors   = "ows_errors"
+)
+
+func (s *Server) requestsStatsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		s.stats.Incr(statsRequests)
+		return next(c)
+	}
+}
+
+// Counts OWS requests and failed OWS requests of the project (after the response was sent)
+func (s *Server) trackProjectOwsResponse(c echo.Context, projectName string) {
+	s.stats.IncrProject(projectName, statsProjectOwsRequests)
+	if c.Response().Status >= http.StatusBadRequest {
+		s.stats.IncrProject(projectName, statsProjectOwsErrors)
+	}
+}
+
+// Counts map server responses (used as ModifyResponse function of map proxies)
+func (s *Server) trackMapserverResponse(resp *http.Response) {
+	s.stats.Incr(statsMapserverRequests)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		s.stats.Incr(statsMapserverErrors)
+	}
+}
+
+func (s *Server) handleGetStats(c echo.Context) error {
+	type CacheInfo struct {
+		domain.CacheStats
+		HitRate float64 `json:"hit_rate"`
+	}
+	type UsersStats struct {
+		Total  int `json:"total"`
+		Active int `json:"active"`
+	}
+	type ProjectsStats struct {
+		Count int   `json:"count"`
+		Size  int64 `json:"size"`
+	}
+	type MapserverStats struct {
+		Requests  int64   `json:"requests_24h"`
+		Errors    int64   `json:"errors_24h"`
+		ErrorRate float64 `json:"error_rate"`
+	}
+	type Stats struct {
+		Users          UsersStats           `json:"users"`
+		Projects       ProjectsStats        `json:"projects"`
+		ActiveSessions *int                 `json:"active_sessions"`
+		Requests       int64                `json:"requests_24h"`
+		Mapserver      MapserverStats       `json:"mapserver"`
+		Caches         map[string]CacheInfo `json:"caches"`
+	}
+	ctx := c.Request().Context()
+	var stats Stats
+
+	accounts, err := s.accountsService.GetAllAccounts()
+	if err != nil {
+		return fmt.Errorf("getting accounts: %w", err)
+	}
+	stats.Users.Total = len(accounts)
+	for _, a := range accounts {
+		if a.Active {
+			stats.Users.Active++
+		}
+		projects, err := s.projects.GetUserProjects(a.Username)
+		if err != nil {
+			s.log.Errorw("getting user projects", "user", a.Username, zap.Error(err))
+			continue
+		}
+		stats.Projects.Count += len(projects)
+		for _, p := range projects {
+			stats.Projects.Size += p.Size
+		}
+	}
+
+	if count, err := s.auth.ActiveSessions(ctx); err != nil {
+		s.log.Warnw("counting active sessions", zap.Error(err))
+	} else {
+		stats.ActiveSessions = &count
+	}
+
+	if err := s.stats.Flush(ctx); err != nil {
+		s.log.Errorw("saving requests stats", zap.Error(err))
+	}
+	counters, err := s.stats.Sum(ctx, 24)
+	if err != nil {
+		return fmt.Errorf("getting requests stats: %w", err)
+	}
+	stats.Requests = counters[statsRequests]
+	stats.Mapserver.Requests = counters[statsMapserverRequests]
+	stats.Mapserver.Errors = counters[statsMapserverErrors]
+	if stats.Mapserver.Requests > 0 {
+		stats.Mapserver.ErrorRate = float64(stats.Mapserver.Errors) / float64(stats.Mapserver.Requests)
+	}
+
+	stats.Caches = make(map[string]CacheInfo)
+	for name, cs := range s.projects.CacheStats() {
+		stats.Caches[name] = CacheInfo{CacheStats: cs, HitRate: cs.HitRate()}
+	}
+	for name, cs := range s.auth.CacheStats() {
+		stats.Caches[name] = CacheInfo{CacheStats: cs, HitRate: cs.HitRate()}
+	}
+	if s.assets != nil {
+		cs := s.assets.Stats()
+		stats.Caches["assets"] = CacheInfo{CacheStats: cs, HitRate: cs.HitRate()}
+	}
+	return c.JSON(http.StatusOK, stats)
+}
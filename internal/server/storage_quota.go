@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+// Storage usage (in percent) at which the account owner is warned, in descending order
+var storageWarningLevels = []int{90, 80}
+
+type StorageUsage struct {
+	Used  int64 `json:"used"`
+	Limit int64 `json:"limit"` // -1 when storage is not limited
+	// highest crossed warning level (0 when usage is below all levels)
+	WarningLevel int `json:"warning_level"`
+}
+
+func storageWarningLevel(used, limit int64) int {
+	if limit <= 0 {
+		return 0
+	}
+	for _, level := range storageWarningLevels {
+		if used*100 >= limit*int64(level) {
+			return level
+		}
+	}
+	return 0
+}
+
+func (s *Server) storageUsage(username string, projects []domain.ProjectInfo) (StorageUsage, error) {
+	limits, err := s.limiter.GetAccountLimits(username)
+	if err != nil {
+		return StorageUsage{}, fmt.Errorf("getting user account limits: %w", err)
+	}
+	usage := StorageUsage{Limit: int64(limits.StorageLimit)}
+	for _, p := range projects {
+		usage.Used += p.Size
+	}
+	usage.WarningLevel = storageWarningLevel(usage.Used, usage.Limit)
+	return usage, nil
+}
+
+// File with the last warning level user was notified about
+func (s *Server) storageWarningPath(username string) string {
+	return filepath.Join(s.Config.ProjectsRoot, username, "storage_warning.json")
+}
+
+func (s *Server) notifiedStorageLevel(username string) (int, error) {
+	var data struct {
+		Level int `json:"level"`
+	}
+	content, err := os.ReadFile(s.storageWarningPath(username))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return 0, err
+	}
+	return data.Level, nil
+}
+
+func (s *Server) saveNotifiedStorageLevel(username string, level int) error {
+	content, err := json.Marshal(map[string]int{"level": level})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.storageWarningPath(username), content, 0644)
+}
+
+func (s *Server) sendStorageWarningEmail(username string, usage StorageUsage) error {
+	account, err := s.accountsService.Repository.GetByUsername(username)
+	if err != nil {
+		return err
+	}
+	tmpl, err := texttemplate.ParseFiles("./templates/storage_warning_email.txt", "./templates/email_base.txt")
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"Level": usage.WarningLevel,
+		"Used":  formatByteSize(usage.Used),
+		"Limit": formatByteSize(usage.Limit),
+	}
+	subject := fmt.Sprintf("Gisquick storage usage reached %d%%", usage.WarningLevel)
+	return s.accountsService.Email.SendBulkEmail([]domain.Account{account}, subject, nil, tmpl, data)
+}
+
+// Notifies the account owner (by email and websocket message) when storage usage crosses
+// a new warning level. Level is reset when usage drops, so user is notified again next time.
+func (s *Server) checkStorageQuota(username string) {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	projects, err := s.projects.GetUserProjects(username)
+	if err != nil {
+		s.log.Errorw("checking storage quota", "user", username, zap.Error(err))
+		return
+	}
+	usage, err := s.storageUsage(username, projects)
+	if err != nil {
+		s.log.Errorw("checking storage quota", "user", username, zap.Error(err))
+		return
+	}
+	notified, err := s.notifiedStorageLevel(username)
+	if err != nil {
+		s.log.Warnw("reading storage warning file", "user", username, zap.Error(err))
+	}
+	if usage.WarningLevel == notified {
+		return
+	}
+	if usage.WarningLevel > notified {
+		s.sws.AppChannel().Send(username, "StorageQuotaWarning", usage)
+		if err := s.sendStorageWarningEmail(username, usage); err != nil {
+			s.log.Errorw("sending storage warning email", "user", username, zap.Error(err))
+		}
+	}
+	if err := s.saveNotifiedStorageLevel(username, usage.WarningLevel); err != nil {
+		s.log.Errorw("saving storage warning file", "user", username, zap.Error(err))
+	}
+}
+
+func formatByteSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0") + " " + units[i]
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// Maximal size of the uploaded SLD style (in bytes)
+const maxStyleSize = 256 * 1024
+
+var styleNameRegex = regexp.MustCompile(`^[\w][\w .-]{0,63}$`)
+
+// Extracts the first NamedLayer element of the SLD document, with its name replaced by the given layer name.
+// Returns also the root element (raw, with namespace prefixes), so the fragments of multiple documents
+// can be merged into single StyledLayerDescriptor.
+func sldNamedLayer(data []byte, layerName string) (xml.StartElement, []byte, error) {
+	var root xml.StartElement
+	d := xml.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	var layerStart, nameStart, nameEnd int64 = -1, -1, -1
+	var nameEl xml.Name
+	for {
+		offset := d.InputOffset()
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			return root, nil, errors.New("missing NamedLayer element")
+		}
+		if err != nil {
+			return root, nil, err
+		}
+		switch el := tok.(type) {
+		case xml.Directive:
+			// DTD and entities are not allowed
+			return root, nil, errors.New("unsupported XML directive")
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 1:
+				if el.Name.Local != "StyledLayerDescriptor" {
+					return root, nil, fmt.Errorf("expected element type <StyledLayerDescriptor> but have <%s>", el.Name.Local)
+				}
+				root = el.Copy()
+			case depth == 2 && el.Name.Local == "NamedLayer" && layerStart == -1:
+				layerStart = offset
+			case depth == 3 && el.Name.Local == "Name" && layerStart != -1 && nameStart == -1:
+				nameStart = offset
+				nameEl = el.Name
+			}
+		case xml.EndElement:
+			if depth == 3 && nameStart != -1 && nameEnd == -1 {
+				nameEnd = d.InputOffset()
+			}
+			if depth == 2 && layerStart != -1 {
+				if nameStart == -1 {
+					return root, nil, errors.New("missing name of the NamedLayer element")
+				}
+				var b bytes.Buffer
+				b.Write(data[layerStart:nameStart])
+				name := nameEl.Local
+				if nameEl.Space != "" {
+					name = nameEl.Space + ":" + name
+				}
+				fmt.Fprintf(&b, "<%s>%s</%s>", name, html.EscapeString(layerName), name)
+				b.Write(data[nameEnd:d.InputOffset()])
+				return root, b.Bytes(), nil
+			}
+			depth--
+		}
+	}
+}
+
+func rawXMLName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+// Builds SLD_BODY parameter from the styles of the individual layers
+func mergeSldStyles(root xml.StartElement, layers [][]byte) string {
+	var b strings.Builder
+	b.WriteString("<" + rawXMLName(root.Name))
+	for _, a := range root.Attr {
+		fmt.Fprintf(&b, ` %s="%s"`, rawXMLName(a.Name), html.EscapeString(a.Value))
+	}
+	b.WriteString(">")
+	for _, l := range layers {
+		b.Write(l)
+	}
+	b.WriteString("</" + rawXMLName(root.Name) + ">")
+	return b.String()
+}
+
+// Replaces names of the uploaded styles in STYLES parameter of GetMap request by SLD_BODY parameter
+func (s *Server) injectLayerStyles(projectName string, query url.Values) error {
+	stylesParam := owsValue(query, "STYLES")
+	if strings.Trim(stylesParam, ",") == "" {
+		return nil
+	}
+	styles, err := s.projects.GetLayerStyles(projectName)
+	if err != nil {
+		return fmt.Errorf("reading layers styles: %w", err)
+	}
+	if len(styles) == 0 {
+		return nil
+	}
+	layersData, err := s.projects.GetLayersData(projectName)
+	if err != nil {
+		return fmt.Errorf("getting layer data: %w", err)
+	}
+	layers := strings.Split(owsValue(query, "LAYERS"), ",")
+	stylesNames := strings.Split(stylesParam, ",")
+	var root xml.StartElement
+	var fragments [][]byte
+	for i, layer := range layers {
+		if i >= len(stylesNames) || stylesNames[i] == "" {
+			continue
+		}
+		layerID := layersData.LayerNameToID[layer]
+		if !domain.StringArray(styles[layerID]).Has(stylesNames[i]) {
+			// QGIS style of the layer
+			continue
+		}
+		data, err := s.projects.GetLayerStyle(projectName, layerID, stylesNames[i])
+		if err != nil {
+			return fmt.Errorf("reading layer style: %w", err)
+		}
+		sldRoot, fragment, err := sldNamedLayer(data, layer)
+		if err != nil {
+			return fmt.Errorf("parsing layer style: %w", err)
+		}
+		if len(fragments) == 0 {
+			root = sldRoot
+		}
+		fragments = append(fragments, fragment)
+		stylesNames[i] = ""
+	}
+	if len(fragments) > 0 {
+		replaceQueryParam(query, "STYLES", strings.Join(stylesNames, ","))
+		replaceQueryParam(query, "SLD_BODY", mergeSldStyles(root, fragments))
+	}
+	return nil
+}
+
+// Returns ID of the project layer from the URL parameter
+func (s *Server) styleLayerID(c echo.Context) (string, error) {
+	projectName := c.Get("project").(string)
+	layerID := c.Param("layer")
+	layersData, err := s.projects.GetLayersData(projectName)
+	if err != nil {
+		return "", fmt.Errorf("getting layer data: %w", err)
+	}
+	for _, id := range layersData.LayerNameToID {
+		if id == layerID {
+			return layerID, nil
+		}
+	}
+	return "", echo.NewHTTPError(http.StatusBadRequest, "Invalid layer")
+}
+
+func (s *Server) handleGetLayerStyles(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	styles, err := s.projects.GetLayerStyles(projectName)
+	if err != nil {
+		return fmt.Errorf("reading layers styles: %w", err)
+	}
+	return c.JSON(http.StatusOK, styles)
+}
+
+func (s *Server) handleGetLayerStyle(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	data, err := s.projects.GetLayerStyle(projectName, c.Param("layer"), c.Param("style"))
+	if err != nil {
+		if errors.Is(err, domain.ErrStyleNotExists) {
+			return echo.ErrNotFound
+		}
+		return fmt.Errorf("reading layer style: %w", err)
+	}
+	return c.Blob(http.StatusOK, "application/vnd.ogc.sld+xml", data)
+}
+
+func (s *Server) handleUploadLayerStyle(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	layerID, err := s.styleLayerID(c)
+	if err != nil {
+		return err
+	}
+	name := c.Param("style")
+	if !styleNameRegex.MatchString(name) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid style name")
+	}
+	f, _, err := c.Request().FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing style file")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxStyleSize+1))
+	if err != nil {
+		return fmt.Errorf("reading style file: %w", err)
+	}
+	if len(data) > maxStyleSize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Style file is too large")
+	}
+	if _, _, err := sldNamedLayer(data, name); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid SLD style: %s", err))
+	}
+	if err := s.projects.SaveLayerStyle(projectName, layerID, name, data); err != nil {
+		if errors.Is(err, domain.ErrProjectNotExists) {
+			return echo.NewHTTPError(http.StatusConflict, "Project does not exists")
+		}
+		return fmt.Errorf("saving layer style: %w", err)
+	}
+	return s.handleGetLayerStyles(c)
+}
+
+func (s *Server) handleDeleteLayerStyle(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	if err := s.projects.DeleteLayerStyle(projectName, c.Param("layer"), c.Param("style")); err != nil {
+		if errors.Is(err, domain.ErrStyleNotExists) {
+			return echo.ErrNotFound
+		}
+		return fmt.Errorf("deleting layer style: %w", err)
+	}
+	return s.handleGetLayerStyles(c)
+}
@@ -0,0 +1,360 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type SyncFeature struct {
+	ID         string                 `json:"id"`
+	Version    string                 `json:"version"`
+	Properties map[string]interface{} `json:"properties"`
+	Geometry   json.RawMessage        `json:"geometry"`
+}
+
+type SyncChange struct {
+	Layer       string                 `json:"layer"`
+	Action      string                 `json:"action"` // insert, update, delete
+	ID          string                 `json:"id,omitempty"`
+	BaseVersion string                 `json:"base_version,omitempty"`
+	Properties  map[string]interface{} `json:"properties,omitempty"`
+	Geometry    *GeoJSONGeometry       `json:"geometry,omitempty"`
+}
+
+type SyncChangeResult struct {
+	Index   int          `json:"index"`
+	Status  string       `json:"status"` // accepted, conflict, rejected
+	ID      string       `json:"id,omitempty"`
+	Current *SyncFeature `json:"current,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// Editing permissions of the layer for the current user
+type syncLayer struct {
+	typeName   string
+	meta       domain.LayerMeta
+	flags      domain.Flags
+	attrsFlags map[string]domain.Flags // nil when project has no roles
+	limit      domain.WfsLimit
+}
+
+func (l syncLayer) canViewAttribute(name string) bool {
+	return l.attrsFlags == nil || l.attrsFlags[name].Has("view")
+}
+
+func (l syncLayer) canEditAttribute(name string) bool {
+	for _, a := range l.meta.Attributes {
+		if a.Name == name {
+			return !a.Constraints.Has("readonly") && (l.attrsFlags == nil || l.attrsFlags[name].Has("edit"))
+		}
+	}
+	return false
+}
+
+func (l syncLayer) canEditGeometry() bool {
+	if l.attrsFlags == nil {
+		return true
+	}
+	flags, ok := l.attrsFlags["geometry"]
+	return !ok || flags.Has("edit")
+}
+
+// Returns layers editable by the user, indexed by WFS type name
+func (s *Server) syncLayers(projectName string, user domain.User) (map[string]syncLayer, string, error) {
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return nil, "", fmt.Errorf("getting project settings: %w", err)
+	}
+	var meta domain.QgisMeta
+	if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+		return nil, "", fmt.Errorf("parsing qgis meta: %w", err)
+	}
+	userRoles := domain.FilterUserRoles(user, settings.Auth.Roles)
+	limit := userWfsLimit(settings, user)
+	layers := make(map[string]syncLayer)
+	for id, lmeta := range meta.Layers {
+		lset := settings.Layers[id]
+		if lmeta.Type != "VectorLayer" || lset.Flags.Has("excluded") || !lset.Roles.Allows(user, userRoles) {
+			continue
+		}
+		if !lmeta.Flags.Has("query") || !lmeta.Flags.Has("edit") || !lset.Flags.Has("edit") {
+			continue
+		}
+		var wfsFlags domain.Flags
+		json.Unmarshal(lmeta.Options["wfs"], &wfsFlags)
+		flags := wfsFlags
+		var attrsFlags map[string]domain.Flags
+		if len(settings.Auth.Roles) > 0 {
+			flags = flags.Intersection(settings.UserLayerPermissionsFlags(user, id))
+			attrsFlags = settings.UserLayerAttrinutesFlags(user, id)
+		}
+		if !flags.Has("insert") && !flags.Has("update") && !flags.Has("delete") {
+			continue
+		}
+		typeName := strings.ReplaceAll(lmeta.Name, " ", "_")
+		layers[typeName] = syncLayer{typeName: typeName, meta: lmeta, flags: flags, attrsFlags: attrsFlags, limit: limit}
+	}
+	return layers, meta.Projection, nil
+}
+
+func featureVersion(f SyncFeature) string {
+	props, _ := json.Marshal(f.Properties)
+	var geom bytes.Buffer
+	if len(f.Geometry) > 0 {
+		json.Compact(&geom, f.Geometry)
+	}
+	h := sha1.New()
+	h.Write(props)
+	h.Write(geom.Bytes())
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// Fetches features of the layer (or a single feature when featureID is set) from the map server.
+// WFS limits of the user are applied in the same way as in OWS requests.
+func (s *Server) fetchSyncFeatures(ctx context.Context, projectName string, layer syncLayer, featureID string) ([]SyncFeature, error) {
+	pInfo, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Config.MapserverURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("building request: %w", err)
+	}
+	params := url.Values{
+		"MAP":          {s.owsProjectPath(projectName, pInfo.QgisFile)},
+		"SERVICE":      {"WFS"},
+		"VERSION":      {"1.1.0"},
+		"REQUEST":      {"GetFeature"},
+		"TYPENAME":     {layer.typeName},
+		"OUTPUTFORMAT": {"GeoJSON"},
+	}
+	if featureID != "" {
+		params.Set("FEATUREID", featureID)
+	}
+	if layer.limit.MaxFeatures > 0 {
+		limitWfsQueryFeatures(params, layer.limit.MaxFeatures)
+	}
+	req.URL.RawQuery = params.Encode()
+	s.setPgServiceHeader(req, projectName)
+	resp, err := s.mapserver.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("mapserver request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("mapserver response status: %d", resp.StatusCode)
+	}
+	data, err := readLimitedResponse(resp, layer.limit.MaxResponseSize)
+	if errors.Is(err, errResponseTooLarge) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	var collection struct {
+		Features []SyncFeature `json:"features"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("parsing features: %w", err)
+	}
+	for i, f := range collection.Features {
+		for name := range f.Properties {
+			if !layer.canViewAttribute(name) {
+				delete(f.Properties, name)
+			}
+		}
+		collection.Features[i].Version = featureVersion(f)
+	}
+	return collection.Features, nil
+}
+
+func (s *Server) handleGetSyncSnapshot(c echo.Context) error {
+	type LayerData struct {
+		Permissions []string      `json:"permissions"`
+		Features    []SyncFeature `json:"features"`
+	}
+	type Snapshot struct {
+		Created    time.Time            `json:"created"`
+		Projection string               `json:"projection"`
+		Layers     map[string]LayerData `json:"layers"`
+	}
+	projectName := getProjectName(c)
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	layers, projection, err := s.syncLayers(projectName, user)
+	if err != nil {
+		return err
+	}
+	snapshot := Snapshot{Created: time.Now().UTC(), Projection: projection, Layers: make(map[string]LayerData, len(layers))}
+	for name, layer := range layers {
+		features, err := s.fetchSyncFeatures(c.Request().Context(), projectName, layer, "")
+		if errors.Is(err, errResponseTooLarge) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("Data of layer %s exceeds size limit", name))
+		}
+		if err != nil {
+			return fmt.Errorf("fetching features of layer %s: %w", name, err)
+		}
+		snapshot.Layers[name] = LayerData{Permissions: layer.flags, Features: features}
+	}
+	return c.JSON(http.StatusOK, snapshot)
+}
+
+func buildFeatureFilter(fid string) string {
+	return fmt.Sprintf(`<ogc:Filter><ogc:FeatureId fid="%s"/></ogc:Filter>`, xmlEscape(fid))
+}
+
+// Builds WFS-T Update or Delete request
+func buildChangeTransaction(typeName, action, fid string, attrs map[string]string, geometry string) []byte {
+	var b strings.Builder
+	b.WriteString(`<Transaction xmlns="http://www.opengis.net/wfs" xmlns:gml="http://www.opengis.net/gml" xmlns:ogc="http://www.opengis.net/ogc" service="WFS" version="1.0.0">`)
+	if action == "delete" {
+		fmt.Fprintf(&b, `<Delete typeName="%s">%s</Delete>`, typeName, buildFeatureFilter(fid))
+	} else {
+		fmt.Fprintf(&b, `<Update typeName="%s">`, typeName)
+		for name, value := range attrs {
+			fmt.Fprintf(&b, "<Property><Name>%s</Name><Value>%s</Value></Property>", name, xmlEscape(value))
+		}
+		if geometry != "" {
+			fmt.Fprintf(&b, "<Property><Name>geometry</Name><Value>%s</Value></Property>", geometry)
+		}
+		b.WriteString(buildFeatureFilter(fid))
+		b.WriteString("</Update>")
+	}
+	b.WriteString("</Transaction>")
+	return []byte(b.String())
+}
+
+func (s *Server) applySyncChange(ctx context.Context, projectName, projection string, user domain.User, layer syncLayer, change SyncChange) SyncChangeResult {
+	res := SyncChangeResult{ID: change.ID}
+	reject := func(msg string) SyncChangeResult {
+		res.Status = "rejected"
+		res.Error = msg
+		return res
+	}
+	if !layer.flags.Has(change.Action) {
+		return reject("Operation not permitted")
+	}
+	values := make(map[string]string, len(change.Properties))
+	for name, v := range change.Properties {
+		if !layer.canEditAttribute(name) {
+			return reject(fmt.Sprintf("Invalid attribute: %s", name))
+		}
+		if v != nil {
+			values[name] = formatAttributeValue(v)
+		}
+	}
+	var geometry string
+	if change.Geometry != nil {
+		if !layer.canEditGeometry() {
+			return reject("Geometry editing not permitted")
+		}
+		var err error
+		if geometry, err = change.Geometry.GML(projection); err != nil {
+			return reject("Invalid geometry")
+		}
+	}
+
+	var body []byte
+	if change.Action == "insert" {
+		body = buildInsertTransaction(layer.typeName, values, geometry)
+	} else {
+		if change.ID == "" {
+			return reject("Missing feature id")
+		}
+		if !strings.HasPrefix(change.ID, layer.typeName+".") {
+			return reject("Invalid feature id")
+		}
+		features, err := s.fetchSyncFeatures(ctx, projectName, layer, change.ID)
+		if err != nil {
+			s.log.Errorw("sync: fetching current feature", "project", projectName, "feature", change.ID, zap.Error(err))
+			return reject("Failed to read current feature")
+		}
+		if len(features) == 0 || features[0].ID != change.ID {
+			res.Status = "conflict"
+			return res
+		}
+		if features[0].Version != change.BaseVersion {
+			res.Status = "conflict"
+			res.Current = &features[0]
+			return res
+		}
+		body = buildChangeTransaction(layer.typeName, change.Action, change.ID, values, geometry)
+	}
+	fid, err := s.sendWfsTransaction(ctx, projectName, body)
+	if err != nil {
+		if errors.Is(err, ErrMapserverUnavailable) {
+			return reject("Map server is unavailable")
+		}
+		s.log.Warnw("sync: transaction failed", "project", projectName, "layer", layer.typeName, zap.Error(err))
+		return reject("Transaction failed")
+	}
+	if fid != "" {
+		res.ID = fid
+	}
+	res.Status = "accepted"
+	record := domain.LayerChange{
+		Project:   projectName,
+		Layer:     layer.typeName,
+		Action:    change.Action,
+		FeatureID: res.ID,
+		User:      user.Username,
+		Time:      time.Now().UTC(),
+	}
+	for name := range values {
+		record.Attributes = append(record.Attributes, name)
+	}
+	if geometry != "" {
+		record.Attributes = append(record.Attributes, "geometry")
+	}
+	s.recordLayerChanges(record)
+	return res
+}
+
+func (s *Server) handlePushSyncChanges() func(echo.Context) error {
+	type Form struct {
+		Changes []SyncChange `json:"changes"`
+	}
+	return func(c echo.Context) error {
+		projectName := getProjectName(c)
+		form := new(Form)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		layers, projection, err := s.syncLayers(projectName, user)
+		if err != nil {
+			return err
+		}
+		ctx := c.Request().Context()
+		results := make([]SyncChangeResult, len(form.Changes))
+		for i, change := range form.Changes {
+			layer, ok := layers[change.Layer]
+			if !ok {
+				results[i] = SyncChangeResult{Status: "rejected", ID: change.ID, Error: "Invalid layer"}
+			} else if change.Action != "insert" && change.Action != "update" && change.Action != "delete" {
+				results[i] = SyncChangeResult{Status: "rejected", ID: change.ID, Error: "Invalid action"}
+			} else {
+				results[i] = s.applySyncChange(ctx, projectName, projection, user, layer, change)
+			}
+			results[i].Index = i
+		}
+		return c.JSON(http.StatusOK, results)
+	}
+}
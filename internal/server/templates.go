@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxSettingsTemplates = 50
+
+// Project settings which are not bound to the layers of particular project
+var templateSettingsKeys = []string{
+	"auth", "settings_auth", "base_layers", "tools", "use_mapcache", "map_tiling", "search_by_coords",
+	"geocoding", "formatters", "scales", "metadata", "raster_catalog", "wfs_limits", "attribution",
+	"attribution_url", "license", "license_url",
+}
+
+var templateNameRegex = regexp.MustCompile(`^[\w\- ]{1,64}$`)
+
+type SettingsTemplate struct {
+	Name        string                     `json:"name"`
+	Description string                     `json:"description,omitempty"`
+	Settings    map[string]json.RawMessage `json:"settings"`
+	Updated     time.Time                  `json:"updated"`
+}
+
+func (s *Server) settingsTemplatesPath(username string) string {
+	return filepath.Join(s.Config.ProjectsRoot, username, "settings_templates.json")
+}
+
+func (s *Server) loadSettingsTemplates(username string) (map[string]SettingsTemplate, error) {
+	templates := make(map[string]SettingsTemplate)
+	data, err := os.ReadFile(s.settingsTemplatesPath(username))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return templates, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (s *Server) saveSettingsTemplates(username string, templates map[string]SettingsTemplate) error {
+	data, err := json.Marshal(templates)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.settingsTemplatesPath(username)), 0775); err != nil {
+		return err
+	}
+	return os.WriteFile(s.settingsTemplatesPath(username), data, 0644)
+}
+
+// Keeps only project independent settings
+func templateSettings(settings map[string]json.RawMessage) map[string]json.RawMessage {
+	data := make(map[string]json.RawMessage)
+	for _, key := range templateSettingsKeys {
+		if v, ok := settings[key]; ok {
+			data[key] = v
+		}
+	}
+	return data
+}
+
+func (s *Server) handleGetSettingsTemplates(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	templates, err := s.loadSettingsTemplates(user.Username)
+	if err != nil {
+		return fmt.Errorf("loading settings templates: %w", err)
+	}
+	list := make([]SettingsTemplate, 0, len(templates))
+	for _, t := range templates {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return c.JSON(http.StatusOK, list)
+}
+
+func (s *Server) handleSaveSettingsTemplate() func(echo.Context) error {
+	type Form struct {
+		Description string                     `json:"description"`
+		Settings    map[string]json.RawMessage `json:"settings"`
+	}
+	return func(c echo.Context) error {
+		name := c.Param("template")
+		if !templateNameRegex.MatchString(name) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid template name")
+		}
+		form := new(Form)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		settings := templateSettings(form.Settings)
+		if len(settings) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Template doesn't contain any settings")
+		}
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		s.templatesMu.Lock()
+		defer s.templatesMu.Unlock()
+		templates, err := s.loadSettingsTemplates(user.Username)
+		if err != nil {
+			return fmt.Errorf("loading settings templates: %w", err)
+		}
+		if _, exists := templates[name]; !exists && len(templates) >= maxSettingsTemplates {
+			return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("Maximal number of templates (%d) reached", maxSettingsTemplates))
+		}
+		template := SettingsTemplate{Name: name, Description: form.Description, Settings: settings, Updated: time.Now().UTC()}
+		templates[name] = template
+		if err := s.saveSettingsTemplates(user.Username, templates); err != nil {
+			return fmt.Errorf("saving settings templates: %w", err)
+		}
+		return c.JSON(http.StatusOK, template)
+	}
+}
+
+func (s *Server) handleDeleteSettingsTemplate(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	s.templatesMu.Lock()
+	defer s.templatesMu.Unlock()
+	templates, err := s.loadSettingsTemplates(user.Username)
+	if err != nil {
+		return fmt.Errorf("loading settings templates: %w", err)
+	}
+	name := c.Param("template")
+	if _, ok := templates[name]; !ok {
+		return echo.ErrNotFound
+	}
+	delete(templates, name)
+	if err := s.saveSettingsTemplates(user.Username, templates); err != nil {
+		return fmt.Errorf("saving settings templates: %w", err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Returns project settings with applied user's template. Settings are not saved,
+// client can review them and publish the project as usual.
+func (s *Server) handleApplySettingsTemplate(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	templates, err := s.loadSettingsTemplates(user.Username)
+	if err != nil {
+		return fmt.Errorf("loading settings templates: %w", err)
+	}
+	template, ok := templates[c.Param("template")]
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "Template not found")
+	}
+	settings := make(map[string]json.RawMessage)
+	// settings are not available before the first publishing
+	content, err := os.ReadFile(filepath.Join(s.Config.ProjectsRoot, projectName, ".gisquick", "settings.json"))
+	if err == nil {
+		if err := json.Unmarshal(content, &settings); err != nil {
+			return fmt.Errorf("parsing project settings: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading project settings: %w", err)
+	}
+	for key, value := range template.Settings {
+		settings[key] = value
+	}
+	return c.JSON(http.StatusOK, settings)
+}
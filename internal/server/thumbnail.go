@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/images"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	thumbnailWidth      = 600
+	thumbnailHeight     = 400
+	thumbnailRenderSize = 4096 // max width/height of the rendered map image
+	thumbnailTimeout    = 30 * time.Second
+	thumbnailMaxSize    = 1200 // max width/height of the uploaded thumbnail
+	// max number of pixels of uploaded images (protection against decompression bombs)
+	maxImagePixels = 50 * 1000 * 1000
+)
+
+// Converts image sanitization error into HTTP error
+func imageUploadError(err error) error {
+	if errors.Is(err, images.ErrImageTooLarge) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Image dimensions are too large")
+	}
+	if errors.Is(err, images.ErrInvalidImage) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid image file")
+	}
+	return err
+}
+
+// Computes size of the map image covering the extent, which can be cropped to the thumbnail size
+func thumbnailRenderDimensions(extent []float64) (int, int) {
+	ew, eh := extent[2]-extent[0], extent[3]-extent[1]
+	scale := math.Max(thumbnailWidth/ew, thumbnailHeight/eh)
+	width := int(math.Ceil(ew * scale))
+	height := int(math.Ceil(eh * scale))
+	if width > thumbnailRenderSize {
+		width = thumbnailRenderSize
+	}
+	if height > thumbnailRenderSize {
+		height = thumbnailRenderSize
+	}
+	return width, height
+}
+
+// Renders map image of the project by WMS GetMap request
+func (s *Server) renderMapImage(ctx context.Context, projectName string, layers []string, crs string, extent []float64, width, height int) (io.ReadCloser, error) {
+	pInfo, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Config.MapserverURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("building request: %w", err)
+	}
+	params := url.Values{
+		"MAP":         {s.owsProjectPath(projectName, pInfo.QgisFile)},
+		"SERVICE":     {"WMS"},
+		"VERSION":     {"1.1.1"},
+		"REQUEST":     {"GetMap"},
+		"LAYERS":      {strings.Join(layers, ",")},
+		"STYLES":      {""},
+		"SRS":         {crs},
+		"BBOX":        {strings.Join(formatFloats(extent...), ",")},
+		"WIDTH":       {strconv.Itoa(width)},
+		"HEIGHT":      {strconv.Itoa(height)},
+		"FORMAT":      {"image/png"},
+		"TRANSPARENT": {"false"},
+	}
+	req.URL.RawQuery = params.Encode()
+	s.setPgServiceHeader(req, projectName)
+	resp, err := s.mapserver.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("mapserver request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "image/") {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("mapserver response status: %d: %s", resp.StatusCode, string(msg))
+	}
+	return resp.Body, nil
+}
+
+func (s *Server) handleThumbnailFromMap() func(echo.Context) error {
+	type Form struct {
+		Extent []float64 `json:"extent"`
+		Layers []string  `json:"layers"`
+		CRS    string    `json:"crs"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		form := new(Form)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		if len(form.Extent) != 4 || form.Extent[0] >= form.Extent[2] || form.Extent[1] >= form.Extent[3] {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid extent")
+		}
+		if len(form.Layers) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "No layers to render")
+		}
+		if form.CRS == "" {
+			var meta domain.QgisMeta
+			if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+				return fmt.Errorf("parsing qgis meta: %w", err)
+			}
+			form.CRS = meta.Projection
+		}
+		ctx, cancel := context.WithTimeout(c.Request().Context(), thumbnailTimeout)
+		defer cancel()
+		width, height := thumbnailRenderDimensions(form.Extent)
+		body, err := s.renderMapImage(ctx, projectName, form.Layers, form.CRS, form.Extent, width, height)
+		if err != nil {
+			return fmt.Errorf("rendering thumbnail map: %w", err)
+		}
+		defer body.Close()
+		img, err := imaging.Decode(body)
+		if err != nil {
+			return fmt.Errorf("decoding map image: %w", err)
+		}
+		thumbnail := imaging.Fill(img, thumbnailWidth, thumbnailHeight, imaging.Center, imaging.Lanczos)
+		var buf bytes.Buffer
+		if err := imaging.Encode(&buf, thumbnail, imaging.JPEG, imaging.JPEGQuality(85)); err != nil {
+			return fmt.Errorf("encoding thumbnail: %w", err)
+		}
+		if err := s.projects.SaveThumbnail(projectName, &buf); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	}
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// Reads raw project settings, so the individual sections can be updated
+// without loss of the properties unknown to the server
+func (s *Server) readRawSettings(projectName string) (map[string]json.RawMessage, error) {
+	content, err := os.ReadFile(filepath.Join(s.Config.ProjectsRoot, projectName, ".gisquick", "settings.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, echo.NewHTTPError(http.StatusConflict, "Project is not configured")
+		}
+		return nil, fmt.Errorf("reading project settings: %w", err)
+	}
+	settings := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return nil, fmt.Errorf("parsing project settings: %w", err)
+	}
+	return settings, nil
+}
+
+// Replaces single section of the project settings
+func (s *Server) updateSettingsSection(projectName, key string, value interface{}) error {
+	settings, err := s.readRawSettings(projectName)
+	if err != nil {
+		return err
+	}
+	if settings[key], err = json.Marshal(value); err != nil {
+		return err
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return s.projects.UpdateSettings(projectName, data)
+}
+
+func collectGroupNames(nodes []domain.TreeNode, names domain.StringArray) domain.StringArray {
+	for _, n := range nodes {
+		if n.IsGroup() {
+			names = append(names, n.GroupName())
+			names = collectGroupNames(n.Children(), names)
+		}
+	}
+	return names
+}
+
+// Validates topics against current project layers and roles
+func validateTopics(topics []domain.Topic, meta domain.QgisMeta, settings domain.ProjectSettings) error {
+	roles := domain.StringArray{"anonymous", "authenticated"}
+	for _, r := range settings.Auth.Roles {
+		roles = append(roles, r.Name)
+	}
+	ids := make(map[string]bool, len(topics))
+	for _, t := range topics {
+		if t.ID == "" || t.Title == "" {
+			return fmt.Errorf("missing topic id or title")
+		}
+		if ids[t.ID] {
+			return fmt.Errorf("duplicate topic id: %s", t.ID)
+		}
+		ids[t.ID] = true
+		for _, id := range t.Layers {
+			if _, ok := meta.Layers[id]; !ok {
+				return fmt.Errorf("unknown layer in topic %s: %s", t.ID, id)
+			}
+		}
+		for _, r := range t.Roles {
+			if !roles.Has(r) && !strings.HasPrefix(r, domain.GroupRestrictionPrefix) {
+				return fmt.Errorf("unknown role in topic %s: %s", t.ID, r)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) saveTopics(c echo.Context, projectName string, topics []domain.Topic) error {
+	var meta domain.QgisMeta
+	if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+		return fmt.Errorf("reading qgis metadata: %w", err)
+	}
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return fmt.Errorf("getting project settings: %w", err)
+	}
+	if err := validateTopics(topics, meta, settings); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := s.updateSettingsSection(projectName, "topics", topics); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, topics)
+}
+
+func (s *Server) handleGetTopics(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return fmt.Errorf("getting project settings: %w", err)
+	}
+	topics := settings.Topics
+	if topics == nil {
+		topics = []domain.Topic{}
+	}
+	return c.JSON(http.StatusOK, topics)
+}
+
+// Replaces all topics (e.g. when reordered)
+func (s *Server) handleSaveTopics(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	var topics []domain.Topic
+	if err := (&echo.DefaultBinder{}).BindBody(c, &topics); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+	}
+	if topics == nil {
+		topics = []domain.Topic{}
+	}
+	return s.saveTopics(c, projectName, topics)
+}
+
+// Creates new topic (appended at the end) or updates existing topic
+func (s *Server) handleSaveTopic(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	topic := new(domain.Topic)
+	if err := (&echo.DefaultBinder{}).BindBody(c, topic); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+	}
+	topic.ID = c.Param("topic")
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return fmt.Errorf("getting project settings: %w", err)
+	}
+	topics := settings.Topics
+	found := false
+	for i, t := range topics {
+		if t.ID == topic.ID {
+			topics[i] = *topic
+			found = true
+			break
+		}
+	}
+	if !found {
+		topics = append(topics, *topic)
+	}
+	return s.saveTopics(c, projectName, topics)
+}
+
+func (s *Server) handleDeleteTopic(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return fmt.Errorf("getting project settings: %w", err)
+	}
+	topics := make([]domain.Topic, 0, len(settings.Topics))
+	for _, t := range settings.Topics {
+		if t.ID != c.Param("topic") {
+			topics = append(topics, t)
+		}
+	}
+	if len(topics) == len(settings.Topics) {
+		return echo.NewHTTPError(http.StatusNotFound, "Topic not found")
+	}
+	return s.saveTopics(c, projectName, topics)
+}
+
+func (s *Server) handleGetGroupsSettings(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return fmt.Errorf("getting project settings: %w", err)
+	}
+	groups := settings.Groups
+	if groups == nil {
+		groups = map[string]domain.GroupSettings{}
+	}
+	return c.JSON(http.StatusOK, groups)
+}
+
+// Replaces settings of the layer groups (validated against groups in the layers tree)
+func (s *Server) handleSaveGroupsSettings(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	groups := make(map[string]domain.GroupSettings)
+	if err := (&echo.DefaultBinder{}).BindBody(c, &groups); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+	}
+	var meta domain.QgisMeta
+	if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+		return fmt.Errorf("reading qgis metadata: %w", err)
+	}
+	tree, err := domain.CreateTree2(meta.LayersTree)
+	if err != nil {
+		return fmt.Errorf("parsing layers tree: %w", err)
+	}
+	names := collectGroupNames(tree, nil)
+	for name := range groups {
+		if !names.Has(name) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Unknown layers group: %s", name))
+		}
+	}
+	if err := s.updateSettingsSection(projectName, "groups", groups); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, groups)
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+const (
+	uploadFilePending = "pending"
+	uploadFileRunning = "running"
+	uploadFileDone    = "done"
+	uploadFileFailed  = "failed"
+)
+
+// Minimal interval between progress messages
+const uploadProgressInterval = 500 * time.Millisecond
+
+type fileProgress struct {
+	Size     int64   `json:"size"`
+	Uploaded int64   `json:"uploaded"`
+	Progress int     `json:"progress"`
+	ETA      float64 `json:"eta"` // seconds
+}
+
+type fileUploadProgress struct {
+	// progress (percent) of files updated since the last message
+	Files         map[string]int `json:"files"`
+	TotalProgress int            `json:"total"`
+	TotalSize     int64          `json:"total_size"`
+	Uploaded      int64          `json:"uploaded"`
+	Rate          float64        `json:"rate"` // bytes per second
+	ETA           float64        `json:"eta"`  // seconds
+	// detailed progress of files updated since the last message
+	Details map[string]fileProgress `json:"details"`
+}
+
+type fileUploadResult struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Status string `json:"status"`
+}
+
+type fileUploadSummary struct {
+	Files     []fileUploadResult `json:"files"`
+	Success   bool               `json:"success"`
+	Error     string             `json:"error,omitempty"`
+	TotalSize int64              `json:"total_size"`
+	Uploaded  int64              `json:"uploaded"`
+	Duration  float64            `json:"duration"` // seconds
+	Rate      float64            `json:"rate"`     // bytes per second
+}
+
+// Tracks progress of the files upload, data are sent by 'UploadProgress' and 'UploadSummary' messages
+type uploadTracker struct {
+	files     []domain.ProjectFile
+	sizes     map[string]int64
+	uploaded  map[string]int64
+	status    map[string]string
+	changed   map[string]int
+	totalSize int64
+	total     int64
+	current   string
+	started   time.Time
+	notified  time.Time
+}
+
+func newUploadTracker(files []domain.ProjectFile) *uploadTracker {
+	t := &uploadTracker{
+		files:    files,
+		sizes:    make(map[string]int64, len(files)),
+		uploaded: make(map[string]int64, len(files)),
+		status:   make(map[string]string, len(files)),
+		changed:  make(map[string]int),
+		started:  time.Now(),
+	}
+	t.notified = t.started
+	for _, f := range files {
+		t.totalSize += f.Size
+		t.sizes[f.Path] = f.Size
+		t.status[f.Path] = uploadFilePending
+	}
+	return t
+}
+
+// Marks start of the next file, previous file is complete
+func (t *uploadTracker) start(path string) {
+	if t.current != "" {
+		t.status[t.current] = uploadFileDone
+	}
+	t.current = path
+	t.status[path] = uploadFileRunning
+}
+
+// Records uploaded data, returns true when the progress message should be sent
+func (t *uploadTracker) update(path string, uploaded, delta int) bool {
+	t.uploaded[path] = int64(uploaded)
+	t.total += int64(delta)
+	t.changed[path] = percProgress(uploaded, int(t.sizes[path]))
+	now := time.Now()
+	if now.Sub(t.notified) > uploadProgressInterval {
+		t.notified = now
+		return true
+	}
+	return false
+}
+
+func (t *uploadTracker) rate() float64 {
+	elapsed := time.Since(t.started).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(t.total) / elapsed
+}
+
+func eta(remaining int64, rate float64) float64 {
+	if remaining <= 0 {
+		return 0
+	}
+	if rate <= 0 {
+		return -1
+	}
+	return float64(remaining) / rate
+}
+
+// Returns progress message and resets list of updated files
+func (t *uploadTracker) progress() fileUploadProgress {
+	rate := t.rate()
+	details := make(map[string]fileProgress, len(t.changed))
+	for path := range t.changed {
+		size, uploaded := t.sizes[path], t.uploaded[path]
+		details[path] = fileProgress{
+			Size:     size,
+			Uploaded: uploaded,
+			Progress: percProgress(int(uploaded), int(size)),
+			ETA:      eta(size-uploaded, rate),
+		}
+	}
+	msg := fileUploadProgress{
+		Files:         t.changed,
+		TotalProgress: percProgress(int(t.total), int(t.totalSize)),
+		TotalSize:     t.totalSize,
+		Uploaded:      t.total,
+		Rate:          rate,
+		ETA:           eta(t.totalSize-t.total, rate),
+		Details:       details,
+	}
+	t.changed = make(map[string]int)
+	return msg
+}
+
+// Returns final summary of the upload, file which was being processed when the upload failed
+// (errMsg is not empty) is marked as failed
+func (t *uploadTracker) summary(errMsg string) fileUploadSummary {
+	if t.current != "" {
+		if errMsg != "" {
+			t.status[t.current] = uploadFileFailed
+		} else {
+			t.status[t.current] = uploadFileDone
+		}
+	}
+	results := make([]fileUploadResult, len(t.files))
+	for i, f := range t.files {
+		results[i] = fileUploadResult{Path: f.Path, Size: f.Size, Status: t.status[f.Path]}
+	}
+	return fileUploadSummary{
+		Files:     results,
+		Success:   errMsg == "",
+		Error:     errMsg,
+		TotalSize: t.totalSize,
+		Uploaded:  t.total,
+		Duration:  time.Since(t.started).Seconds(),
+		Rate:      t.rate(),
+	}
+}
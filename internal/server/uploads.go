@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+var errUploadCanceled = errors.New("upload canceled")
+
+type activeUpload struct {
+	ID      string    `json:"id"`
+	Project string    `json:"project"`
+	User    string    `json:"user"`
+	Started time.Time `json:"started"`
+	cancel  context.CancelFunc
+}
+
+// Registry of the in-progress files uploads which can be canceled
+type activeUploads struct {
+	mu      sync.Mutex
+	uploads map[string]*activeUpload
+}
+
+func newActiveUploads() *activeUploads {
+	return &activeUploads{uploads: make(map[string]*activeUpload)}
+}
+
+func (u *activeUploads) add(project, user string, cancel context.CancelFunc) *activeUpload {
+	upload := &activeUpload{
+		ID:      uuid.Must(uuid.NewV4()).String(),
+		Project: project,
+		User:    user,
+		Started: time.Now().UTC(),
+		cancel:  cancel,
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.uploads[upload.ID] = upload
+	return upload
+}
+
+func (u *activeUploads) remove(id string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.uploads, id)
+}
+
+// Cancels all uploads of the project and returns them
+func (u *activeUploads) cancel(project string) []*activeUpload {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var canceled []*activeUpload
+	for id, upload := range u.uploads {
+		if upload.Project == project {
+			upload.cancel()
+			canceled = append(canceled, upload)
+			delete(u.uploads, id)
+		}
+	}
+	return canceled
+}
+
+// Reader which stops reading when the context is canceled
+type cancelableReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *cancelableReader) Read(p []byte) (int, error) {
+	if r.ctx.Err() != nil {
+		return 0, errUploadCanceled
+	}
+	return r.r.Read(p)
+}
+
+// Aborts in-progress upload of the project files. Partially written files are removed
+// by the storage, uploader (plugin and web app) is notified by 'UploadCanceled' message.
+func (s *Server) handleCancelUpload(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	canceled := s.uploads.cancel(projectName)
+	if len(canceled) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "No upload in progress")
+	}
+	for _, upload := range canceled {
+		s.sws.PluginChannel().Send(upload.User, "UploadCanceled", upload)
+		s.sws.AppChannel().Send(upload.User, "UploadCanceled", upload)
+	}
+	return c.JSON(http.StatusOK, canceled)
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// Public information about the user, available to all authenticated users (e.g. for sharing of projects)
+type UserInfo struct {
+	Username string `json:"username"`
+	FullName string `json:"full_name"`
+}
+
+func matchesUserQuery(a domain.Account, query string, withEmail bool) bool {
+	if query == "" {
+		return true
+	}
+	if strings.Contains(strings.ToLower(a.Username), query) || strings.Contains(strings.ToLower(a.FullName()), query) {
+		return true
+	}
+	return withEmail && strings.Contains(a.Email, query)
+}
+
+// Directory of users. Regular users get only username and full name of active accounts, superusers
+// get full account details. Supports filtering (q) and pagination (offset, limit), total count
+// of matching users is sent in X-Total-Count header.
+func (s *Server) handleGetUsers(c echo.Context) error {
+	if !s.Config.UserDirectory {
+		return echo.ErrNotFound
+	}
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	query := strings.ToLower(strings.TrimSpace(c.QueryParam("q")))
+	offset := 0
+	if v := c.QueryParam("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid offset")
+		}
+	}
+	limit := -1
+	if v := c.QueryParam("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+		}
+	}
+
+	accounts, err := s.accountsService.GetAllAccounts()
+	if err != nil {
+		return err
+	}
+	matches := make([]domain.Account, 0, len(accounts))
+	for _, a := range accounts {
+		if !user.IsSuperuser && !a.Active {
+			continue
+		}
+		if matchesUserQuery(a, query, user.IsSuperuser) {
+			matches = append(matches, a)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Username < matches[j].Username
+	})
+	c.Response().Header().Set("X-Total-Count", strconv.Itoa(len(matches)))
+	if offset > len(matches) {
+		offset = len(matches)
+	}
+	matches = matches[offset:]
+	if limit >= 0 && limit < len(matches) {
+		matches = matches[:limit]
+	}
+
+	if user.IsSuperuser {
+		data := make([]Account, len(matches))
+		for i, a := range matches {
+			data[i] = toAccountInfo(a)
+		}
+		return c.JSON(http.StatusOK, data)
+	}
+	data := make([]UserInfo, len(matches))
+	for i, a := range matches {
+		data[i] = UserInfo{Username: a.Username, FullName: a.FullName()}
+	}
+	return c.JSON(http.StatusOK, data)
+}
+
+const (
+	permissionCandidatesLimit    = 20
+	permissionCandidatesMaxLimit = 100
+)
+
+// Candidate for the project permissions (user account, group of users or role of the project)
+type PermissionCandidate struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	FullName string `json:"full_name,omitempty"`
+	rank     int
+}
+
+// Search of users, groups and project roles for assignment of project permissions, so the settings
+// application doesn't need the full list of users. Deactivated accounts are excluded.
+func (s *Server) handleSearchPermissionCandidates(c echo.Context) error {
+	projectName := getProjectName(c)
+	query := strings.ToLower(strings.TrimSpace(c.QueryParam("q")))
+	if query == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing query")
+	}
+	limit := permissionCandidatesLimit
+	if v := c.QueryParam("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+		}
+		if l < permissionCandidatesMaxLimit {
+			limit = l
+		} else {
+			limit = permissionCandidatesMaxLimit
+		}
+	}
+	// settings are not available before the first publishing
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("getting project settings: %w", err)
+	}
+	candidates := make([]PermissionCandidate, 0)
+	for _, role := range settings.Auth.Roles {
+		if rank := matchRank(role.Name, query); rank != -1 {
+			candidates = append(candidates, PermissionCandidate{Type: "role", Name: role.Name, rank: rank})
+		}
+	}
+	if s.accountsService.Groups != nil {
+		groups, err := s.accountsService.Groups.List()
+		if err != nil {
+			return fmt.Errorf("listing groups: %w", err)
+		}
+		for _, g := range groups {
+			if rank := matchRank(g.Name, query); rank != -1 {
+				candidates = append(candidates, PermissionCandidate{Type: "group", Name: g.Name, FullName: g.Description, rank: rank})
+			}
+		}
+	}
+	accounts, err := s.accountsService.GetAllAccounts()
+	if err != nil {
+		return err
+	}
+	for _, a := range accounts {
+		if !a.Active {
+			continue
+		}
+		rank := matchRank(a.Username, query)
+		if r := matchRank(a.FullName(), query); r != -1 && (rank == -1 || r < rank) {
+			rank = r
+		}
+		if rank != -1 {
+			candidates = append(candidates, PermissionCandidate{Type: "user", Name: a.Username, FullName: a.FullName(), rank: rank})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].rank != candidates[j].rank {
+			return candidates[i].rank < candidates[j].rank
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return c.JSON(http.StatusOK, candidates)
+}
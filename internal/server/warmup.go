@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+const warmUpConcurrency = 2
+
+type WarmUpResult struct {
+	Project  string `json:"project"`
+	Status   int    `json:"status,omitempty"`
+	Duration int64  `json:"duration"` // milliseconds
+	Error    string `json:"error,omitempty"`
+}
+
+// Loads project into the map server by issuing (cheap) GetProjectSettings request
+func (s *Server) warmUpProject(ctx context.Context, projectName string) WarmUpResult {
+	res := WarmUpResult{Project: projectName}
+	start := time.Now()
+	err := func() error {
+		pInfo, err := s.projects.GetProjectInfo(projectName)
+		if err != nil {
+			return err
+		}
+		if pInfo.State != "published" {
+			return fmt.Errorf("project is not published")
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Config.MapserverURL, nil)
+		if err != nil {
+			return fmt.Errorf("building request: %w", err)
+		}
+		params := url.Values{
+			"MAP":     {s.owsProjectPath(projectName, pInfo.QgisFile)},
+			"SERVICE": {"WMS"},
+			"REQUEST": {"GetProjectSettings"},
+		}
+		req.URL.RawQuery = params.Encode()
+		s.setPgServiceHeader(req, projectName)
+		resp, err := s.mapserver.Do(req)
+		if err != nil {
+			return fmt.Errorf("mapserver request: %w", err)
+		}
+		defer resp.Body.Close()
+		io.Copy(ioutil.Discard, resp.Body)
+		res.Status = resp.StatusCode
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("mapserver response status: %d", resp.StatusCode)
+		}
+		return nil
+	}()
+	res.Duration = time.Since(start).Milliseconds()
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// WarmUp pre-loads given projects into the map server
+func (s *Server) WarmUp(ctx context.Context, projects []string) []WarmUpResult {
+	results := make([]WarmUpResult, len(projects))
+	sem := make(chan struct{}, warmUpConcurrency)
+	var wg sync.WaitGroup
+	for i, p := range projects {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, p string) {
+			defer wg.Done()
+			results[i] = s.warmUpProject(ctx, p)
+			<-sem
+		}(i, p)
+	}
+	wg.Wait()
+	for _, r := range results {
+		if r.Error != "" {
+			s.log.Warnw("project warm-up", "project", r.Project, "duration", r.Duration, "error", r.Error)
+		} else {
+			s.log.Infow("project warm-up", "project", r.Project, "duration", r.Duration)
+		}
+	}
+	return results
+}
+
+// WarmUpMostUsed pre-loads given number of the most used projects into the map server
+func (s *Server) WarmUpMostUsed(ctx context.Context, count int) ([]WarmUpResult, error) {
+	projects, err := s.usage.Top(ctx, count)
+	if err != nil {
+		return nil, err
+	}
+	return s.WarmUp(ctx, projects), nil
+}
+
+func (s *Server) handleWarmUp() func(echo.Context) error {
+	type Form struct {
+		Projects []string `json:"projects"`
+		Count    int      `json:"count"`
+	}
+	return func(c echo.Context) error {
+		form := new(Form)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		ctx := c.Request().Context()
+		if len(form.Projects) > 0 {
+			for _, p := range form.Projects {
+				if _, err := s.projects.GetProjectInfo(p); err != nil {
+					if errors.Is(err, domain.ErrProjectNotExists) {
+						return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Project does not exists: %s", p))
+					}
+					return err
+				}
+			}
+			return c.JSON(http.StatusOK, s.WarmUp(ctx, form.Projects))
+		}
+		if form.Count <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Missing projects or count parameter")
+		}
+		results, err := s.WarmUpMostUsed(ctx, form.Count)
+		if err != nil {
+			return fmt.Errorf("getting most used projects: %w", err)
+		}
+		return c.JSON(http.StatusOK, results)
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Web client (frontend) served by the server, files are embedded in the binary or read
+// from a directory (nil Files disables it)
+type WebAppConfig struct {
+	Files fs.FS
+	// cache max-age of the files without content hash in the name (index.html is always revalidated)
+	MaxAge int
+}
+
+// Paths handled only by the server, they are never served by the web client
+var webAppExcludedPrefixes = []string{"/api/", "/ws/", "/ows/", "/plugins/", "/scim/"}
+
+// Built files with content hash in the name (e.g. app.3f2a9c1b.js or index-3f2a9c1b.css)
+var hashedAssetRegex = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[a-zA-Z0-9]+$`)
+
+type webApp struct {
+	files fs.FS
+	// ETags of the files without modification time (embedded files)
+	etags sync.Map
+}
+
+func (w *webApp) etag(name string, data io.ReadSeeker) (string, error) {
+	if etag, ok := w.etags.Load(name); ok {
+		return etag.(string), nil
+	}
+	h := sha1.New()
+	if _, err := io.Copy(h, data); err != nil {
+		return "", err
+	}
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := fmt.Sprintf(`"%x"`, h.Sum(nil))
+	w.etags.Store(name, etag)
+	return etag, nil
+}
+
+// Opens regular file of the web client
+func (w *webApp) open(name string) (fs.File, fs.FileInfo, error) {
+	f, err := w.files.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, nil, fs.ErrNotExist
+	}
+	return f, info, nil
+}
+
+// Serves files of the web client with fallback to index.html for client side routes
+func (s *Server) handleWebApp() echo.HandlerFunc {
+	app := &webApp{files: s.Config.WebApp.Files}
+	return func(c echo.Context) error {
+		urlPath := c.Request().URL.Path
+		for _, prefix := range webAppExcludedPrefixes {
+			if strings.HasPrefix(urlPath+"/", prefix) {
+				return echo.ErrNotFound
+			}
+		}
+		name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+		if name == "" {
+			name = "index.html"
+		}
+		f, info, err := app.open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			// missing assets are not replaced by the index page
+			if path.Ext(name) != "" {
+				return echo.ErrNotFound
+			}
+			name = "index.html"
+			f, info, err = app.open(name)
+		}
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return echo.ErrNotFound
+			}
+			return fmt.Errorf("opening web client file: %w", err)
+		}
+		defer f.Close()
+		content, ok := f.(io.ReadSeeker)
+		if !ok {
+			return fmt.Errorf("web client file %s is not seekable", name)
+		}
+
+		header := c.Response().Header()
+		if name == "index.html" {
+			header.Set("Cache-Control", "no-cache")
+		} else if hashedAssetRegex.MatchString(name) {
+			header.Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", s.Config.WebApp.MaxAge))
+		}
+		if info.ModTime().IsZero() {
+			etag, err := app.etag(name, content)
+			if err != nil {
+				return fmt.Errorf("reading web client file: %w", err)
+			}
+			header.Set("ETag", etag)
+		}
+		// handles conditional (If-None-Match, If-Modified-Since) and range requests
+		http.ServeContent(c.Response(), c.Request(), info.Name(), info.ModTime(), content)
+		return nil
+	}
+}
+
+// Compresses text files of the web client (images and fonts are already compressed)
+func webAppGzipMiddleware() echo.MiddlewareFunc {
+	return middleware.GzipWithConfig(middleware.GzipConfig{
+		Level: 5,
+		Skipper: func(c echo.Context) bool {
+			switch path.Ext(c.Request().URL.Path) {
+			case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".ico", ".woff", ".woff2", ".gz", ".zip":
+				return true
+			}
+			return false
+		},
+	})
+}
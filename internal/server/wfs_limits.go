@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+var maxFeaturesAttrRegex = regexp.MustCompile(`\s(maxFeatures|count)\s*=\s*["'](\d*)["']`)
+
+// Returns WFS limit of the user, zero limit when the project has no limits
+func userWfsLimit(settings domain.ProjectSettings, user domain.User) domain.WfsLimit {
+	if settings.WfsLimits == nil {
+		return domain.WfsLimit{}
+	}
+	return settings.WfsLimits.UserLimit(user, domain.FilterUserRoles(user, settings.Auth.Roles))
+}
+
+func withinLimit(value string, max int) bool {
+	v, err := strconv.Atoi(value)
+	return err == nil && v > 0 && v <= max
+}
+
+// Limits number of features in GetFeature request parameters. All variants of the
+// features count parameter (MAXFEATURES, COUNT) are limited.
+func limitWfsQueryFeatures(query url.Values, max int) {
+	found := false
+	for param, values := range query {
+		if !strings.EqualFold(param, "MAXFEATURES") && !strings.EqualFold(param, "COUNT") {
+			continue
+		}
+		found = true
+		for i, v := range values {
+			if !withinLimit(v, max) {
+				values[i] = strconv.Itoa(max)
+			}
+		}
+	}
+	if !found {
+		param := "MAXFEATURES"
+		if strings.HasPrefix(owsValue(query, "VERSION"), "2.") {
+			param = "COUNT"
+		}
+		query.Set(param, strconv.Itoa(max))
+	}
+}
+
+func owsValue(query url.Values, name string) string {
+	for param, values := range query {
+		if strings.EqualFold(param, name) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// Limits number of features in the GetFeature XML request (all maxFeatures/count attributes
+// of the root element and Query elements)
+func limitWfsBodyFeatures(body []byte, max int) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	var out bytes.Buffer
+	var pos int64
+	root := true
+	for {
+		start := decoder.InputOffset()
+		t, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing GetFeature request: %w", err)
+		}
+		el, ok := t.(xml.StartElement)
+		if !ok || !(root || el.Name.Local == "Query") {
+			continue
+		}
+		end := decoder.InputOffset()
+		tag := body[start:end]
+		matches := maxFeaturesAttrRegex.FindAllSubmatchIndex(tag, -1)
+		var newTag []byte
+		var tagPos int
+		for _, m := range matches {
+			if withinLimit(string(tag[m[4]:m[5]]), max) {
+				continue
+			}
+			newTag = append(newTag, tag[tagPos:m[4]]...)
+			newTag = append(newTag, strconv.Itoa(max)...)
+			tagPos = m[5]
+		}
+		newTag = append(newTag, tag[tagPos:]...)
+		if root && len(matches) == 0 {
+			closing := bytes.LastIndexByte(newTag, '>')
+			if closing > 0 && newTag[closing-1] == '/' {
+				closing--
+			}
+			withAttr := append([]byte{}, newTag[:closing]...)
+			withAttr = append(withAttr, fmt.Sprintf(` maxFeatures="%d"`, max)...)
+			newTag = append(withAttr, newTag[closing:]...)
+		}
+		root = false
+		out.Write(body[pos:start])
+		out.Write(newTag)
+		pos = end
+	}
+	out.Write(body[pos:])
+	return out.Bytes(), nil
+}
+
+// Reads response of the map server, responses larger than max size (if set) are rejected
+func readLimitedResponse(resp *http.Response, max int64) ([]byte, error) {
+	if max <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+	if resp.ContentLength > max {
+		return nil, errResponseTooLarge
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, errResponseTooLarge
+	}
+	return data, nil
+}
+
+// Applies features count limit to the GetFeature request (query parameters or XML body)
+func limitWfsFeatures(req *http.Request, query url.Values, max int) error {
+	if req.Method != http.MethodPost {
+		limitWfsQueryFeatures(query, max)
+		return nil
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	newBody, err := limitWfsBodyFeatures(body, max)
+	if err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(newBody))
+	req.ContentLength = int64(len(newBody))
+	req.Header.Set("Content-Length", strconv.Itoa(len(newBody)))
+	return nil
+}
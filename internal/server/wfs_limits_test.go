@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestLimitWfsQueryFeatures(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{query: "VERSION=1.1.0", expected: "MAXFEATURES=100&VERSION=1.1.0"},
+		{query: "VERSION=2.0.0", expected: "COUNT=100&VERSION=2.0.0"},
+		{query: "MAXFEATURES=10", expected: "MAXFEATURES=10"},
+		{query: "MAXFEATURES=1000", expected: "MAXFEATURES=100"},
+		{query: "COUNT=5&MAXFEATURES=1000000", expected: "COUNT=5&MAXFEATURES=100"},
+		{query: "count=0&maxfeatures=abc", expected: "count=100&maxfeatures=100"},
+		{query: "MAXFEATURES=10&MAXFEATURES=1000", expected: "MAXFEATURES=10&MAXFEATURES=100"},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		limitWfsQueryFeatures(query, 100)
+		if encoded := query.Encode(); encoded != tt.expected {
+			t.Errorf("%s: got %s, expected %s", tt.query, encoded, tt.expected)
+		}
+	}
+}
+
+func TestLimitWfsBodyFeatures(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{
+			body:     `<GetFeature service="WFS"><Query typeName="parks"/></GetFeature>`,
+			expected: `<GetFeature service="WFS" maxFeatures="100"><Query typeName="parks"/></GetFeature>`,
+		},
+		{
+			body:     `<GetFeature maxFeatures="10" count="1000"><Query typeName="parks"/></GetFeature>`,
+			expected: `<GetFeature maxFeatures="10" count="100"><Query typeName="parks"/></GetFeature>`,
+		},
+		{
+			body:     `<GetFeature maxFeatures="10"><Query typeName="parks" maxFeatures="5000"/><Query typeName="trees" count="50"/></GetFeature>`,
+			expected: `<GetFeature maxFeatures="10"><Query typeName="parks" maxFeatures="100"/><Query typeName="trees" count="50"/></GetFeature>`,
+		},
+	}
+	for _, tt := range tests {
+		data, err := limitWfsBodyFeatures([]byte(tt.body), 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.expected {
+			t.Errorf("got %s, expected %s", data, tt.expected)
+		}
+	}
+}
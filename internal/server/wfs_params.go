@@ -0,0 +1,250 @@
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+// Output format of GeoJSON features supported by QGIS server
+const wfsJSONFormat = "application/json"
+
+// Values of the OUTPUTFORMAT parameter or media types (Accept header) requesting GeoJSON output
+var geoJSONFormats = domain.StringArray{"application/json", "application/geo+json", "application/vnd.geo+json", "geojson", "json"}
+
+// Returns value of the parameter set under any of the names (case-insensitive). Parameter
+// set multiple times with different values is rejected, as the map server may read another
+// variant than the checked one.
+func owsUniqueValue(query url.Values, names ...string) (string, error) {
+	var value string
+	for param, values := range query {
+		for _, name := range names {
+			if !strings.EqualFold(param, name) {
+				continue
+			}
+			for _, v := range values {
+				if value != "" && v != value {
+					return "", fmt.Errorf("conflicting values of %s parameter", strings.Join(names, "/"))
+				}
+				value = v
+			}
+		}
+	}
+	return value, nil
+}
+
+// Returns type names from the WFS 1.x TYPENAME or WFS 2.0 TYPENAMES parameter,
+// joined type names in parentheses are returned as separate items
+func wfsTypeNames(query url.Values) ([]string, error) {
+	value, err := owsUniqueValue(query, "TYPENAME", "TYPENAMES")
+	if err != nil {
+		return nil, err
+	}
+	return splitTypeNames(value), nil
+}
+
+// Splits list of type names (separated by commas or in parentheses)
+func splitTypeNames(value string) []string {
+	value = strings.NewReplacer("(", ",", ")", ",").Replace(value)
+	var typeNames []string
+	for _, t := range strings.Split(value, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			typeNames = append(typeNames, t)
+		}
+	}
+	return typeNames
+}
+
+// Returns layer names from the WFS 1.x FEATUREID or WFS 2.0 RESOURCEID parameter
+func wfsFeatureIdsLayers(query url.Values) ([]string, error) {
+	value, err := owsUniqueValue(query, "FEATUREID", "RESOURCEID")
+	if err != nil {
+		return nil, err
+	}
+	return featureIdsLayers(value), nil
+}
+
+// Returns layer names from the list of feature ids (in format layer.fid)
+func featureIdsLayers(value string) []string {
+	var layers []string
+	for _, id := range strings.Split(value, ",") {
+		if i := strings.LastIndex(id, "."); i > 0 {
+			layers = append(layers, strings.TrimSpace(id[:i]))
+		}
+	}
+	return layers
+}
+
+// Returns layers of the GetFeature request with parameters in the query. Layers of the feature ids
+// must be listed in the type names when both parameters are used.
+func wfsGetFeatureLayers(query url.Values) ([]string, error) {
+	typeNames, err := wfsTypeNames(query)
+	if err != nil {
+		return nil, err
+	}
+	fidLayers, err := wfsFeatureIdsLayers(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(typeNames) == 0 {
+		return fidLayers, nil
+	}
+	for _, name := range fidLayers {
+		if !domain.StringArray(typeNames).Has(name) {
+			return nil, fmt.Errorf("feature id of layer %s not listed in type names", name)
+		}
+	}
+	return typeNames, nil
+}
+
+// Splits PROPERTYNAME parameter into lists of properties of the individual type names,
+// in format "(a,b)(c,d)" when multiple type names are requested
+func wfsPropertyNames(value string, typeNamesCount int) ([][]string, error) {
+	if typeNamesCount <= 1 && !strings.HasPrefix(value, "(") {
+		return [][]string{strings.Split(value, ",")}, nil
+	}
+	var groups [][]string
+	for _, group := range strings.Split(value, ")") {
+		if group == "" {
+			continue
+		}
+		if !strings.HasPrefix(group, "(") {
+			return nil, fmt.Errorf("invalid PROPERTYNAME parameter: %s", value)
+		}
+		groups = append(groups, strings.Split(group[1:], ","))
+	}
+	if len(groups) != typeNamesCount {
+		return nil, fmt.Errorf("PROPERTYNAME parameter doesn't match type names")
+	}
+	return groups, nil
+}
+
+func formatPropertyNames(groups [][]string) string {
+	if len(groups) == 1 {
+		return strings.Join(groups[0], ",")
+	}
+	var b strings.Builder
+	for _, g := range groups {
+		b.WriteString("(" + strings.Join(g, ",") + ")")
+	}
+	return b.String()
+}
+
+// Checks that all properties are viewable and not only the geometry is requested
+func propertiesAllowed(attrsFlags map[string]domain.Flags, properties []string) bool {
+	for _, name := range properties {
+		aFlags, exist := attrsFlags[name]
+		if !exist || !aFlags.Has("view") {
+			return false
+		}
+	}
+	return !(len(properties) == 1 && properties[0] == "geometry")
+}
+
+// Returns all viewable properties (sorted), nil when there are no viewable properties except geometry
+func viewableProperties(attrsFlags map[string]domain.Flags) []string {
+	var properties []string
+	for name, flags := range attrsFlags {
+		if flags.Has("view") {
+			properties = append(properties, name)
+		}
+	}
+	if len(properties) == 0 || (len(properties) == 1 && properties[0] == "geometry") {
+		return nil
+	}
+	sort.Strings(properties)
+	return properties
+}
+
+// Checks whether GeoJSON output is preferred in the Accept header
+func acceptsGeoJSON(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		// only the first (preferred) media type is considered
+		return geoJSONFormats.Has(mediaType)
+	}
+	return false
+}
+
+// Negotiates GeoJSON output of the GetFeature request. Aliases of the JSON format in OUTPUTFORMAT
+// parameter are normalized, when the output format is not set, Accept header is used.
+func negotiateWfsOutputFormat(req *http.Request, query url.Values) error {
+	if req.Method == http.MethodPost {
+		if !acceptsGeoJSON(req.Header.Get("Accept")) {
+			return nil
+		}
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		newBody, err := setWfsBodyOutputFormat(body, wfsJSONFormat)
+		if err != nil {
+			return err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(newBody))
+		req.ContentLength = int64(len(newBody))
+		req.Header.Set("Content-Length", strconv.Itoa(len(newBody)))
+		return nil
+	}
+	format := owsValue(query, "OUTPUTFORMAT")
+	if format == "" {
+		if acceptsGeoJSON(req.Header.Get("Accept")) {
+			replaceQueryParam(query, "OUTPUTFORMAT", wfsJSONFormat)
+		}
+		return nil
+	}
+	if mediaType, _, err := mime.ParseMediaType(format); err == nil {
+		format = mediaType
+	}
+	if geoJSONFormats.Has(strings.ToLower(format)) {
+		replaceQueryParam(query, "OUTPUTFORMAT", wfsJSONFormat)
+	}
+	return nil
+}
+
+// Sets output format of the GetFeature XML request (outputFormat attribute of the root element),
+// when it's not specified by the request
+func setWfsBodyOutputFormat(body []byte, format string) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	var start, end int64
+	var root xml.StartElement
+	for {
+		start = decoder.InputOffset()
+		t, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("parsing GetFeature request: %w", err)
+		}
+		if el, ok := t.(xml.StartElement); ok {
+			root = el
+			end = decoder.InputOffset()
+			break
+		}
+	}
+	if xmlAttr(root, "outputFormat") != "" {
+		return body, nil
+	}
+	tag := body[start:end]
+	closing := bytes.LastIndexByte(tag, '>')
+	if closing > 0 && tag[closing-1] == '/' {
+		closing--
+	}
+	var newBody []byte
+	newBody = append(newBody, body[:start]...)
+	newBody = append(newBody, tag[:closing]...)
+	newBody = append(newBody, fmt.Sprintf(` outputFormat="%s"`, format)...)
+	newBody = append(newBody, tag[closing:]...)
+	newBody = append(newBody, body[end:]...)
+	return newBody, nil
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestWfsGetFeatureLayers(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []string
+		invalid  bool
+	}{
+		{query: "TYPENAME=parks,trees", expected: []string{"parks", "trees"}},
+		{query: "TYPENAMES=(parks)(trees)", expected: []string{"parks", "trees"}},
+		{query: "TYPENAME=parks&TYPENAMES=parks", expected: []string{"parks"}},
+		{query: "FEATUREID=parks.1,trees.2", expected: []string{"parks", "trees"}},
+		{query: "TYPENAME=parks&FEATUREID=parks.1", expected: []string{"parks"}},
+		{query: "TYPENAMES=parks&TYPENAME=land_parcels", invalid: true},
+		{query: "TYPENAME=parks&typename=land_parcels", invalid: true},
+		{query: "RESOURCEID=parks.1&FEATUREID=land_parcels.1", invalid: true},
+		{query: "TYPENAME=parks&FEATUREID=land_parcels.1", invalid: true},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		layers, err := wfsGetFeatureLayers(query)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("%s: expected error, got %v", tt.query, layers)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if strings.Join(layers, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("%s: got %v, expected %v", tt.query, layers, tt.expected)
+		}
+	}
+}
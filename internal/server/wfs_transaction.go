@@ -0,0 +1,239 @@
+package server
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// Actions of WFS transaction operations
+const (
+	wfsInsert  = "insert"
+	wfsUpdate  = "update"
+	wfsDelete  = "delete"
+	wfsReplace = "replace"
+)
+
+// Single operation of WFS transaction, features of Insert operation are listed as separate
+// operations (in the same order as IDs of inserted features in the transaction response)
+type TransactionOperation struct {
+	Action string `json:"action"`
+	// type name as used in the request (can contain namespace prefix)
+	TypeName string `json:"type_name"`
+	Layer    string `json:"layer"`
+	// inserted or modified attributes
+	Attributes []string `json:"attributes,omitempty"`
+	// IDs of the updated/deleted features (when filter contains only feature IDs)
+	FeatureIDs []string `json:"feature_ids,omitempty"`
+	// operation has filter with other conditions, so affected features are unknown
+	Filtered bool `json:"filtered,omitempty"`
+}
+
+// Parsed WFS transaction (WFS 1.0, 1.1 and 2.0), only structure needed for permissions check
+// and changes tracking is collected, values of the properties and geometries are skipped
+type Transaction struct {
+	Version    string                 `json:"version,omitempty"`
+	Operations []TransactionOperation `json:"operations"`
+}
+
+// Returns layer name from type name with namespace prefix (ns:Layer) or in Clark notation ({uri}Layer)
+func layerName(typeName string) string {
+	typeName = strings.TrimSpace(typeName)
+	if i := strings.LastIndex(typeName, "}"); i != -1 {
+		typeName = typeName[i+1:]
+	}
+	parts := strings.Split(typeName, ":")
+	return parts[len(parts)-1]
+}
+
+func xmlAttr(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// Elements identifying features in filters of different WFS/FES versions and their ID attribute
+var featureIdElements = map[string]string{
+	"FeatureId":   "fid", // WFS 1.0
+	"GmlObjectId": "id",  // WFS 1.1
+	"ResourceId":  "rid", // WFS 2.0
+}
+
+// Parses filter element, returns IDs of the features and flag whether the filter
+// contains other conditions than (combination of) feature IDs
+func scanTransactionFilter(d *xml.Decoder) ([]string, bool, error) {
+	var ids []string
+	filtered := false
+	depth := 1
+	for depth > 0 {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, false, err
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			if attr, ok := featureIdElements[el.Name.Local]; ok {
+				ids = append(ids, xmlAttr(el, attr))
+			} else if el.Name.Local != "Or" {
+				// e.g. And, PropertyIsEqualTo, BBOX...
+				filtered = true
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return ids, filtered, nil
+}
+
+// Parses feature element (Insert/Replace), returns names of its properties
+func scanTransactionFeature(d *xml.Decoder) ([]string, error) {
+	var attrs []string
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			attrs = append(attrs, el.Name.Local)
+			if err := d.Skip(); err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			return attrs, nil
+		}
+	}
+}
+
+// Parses Property element of Update operation, returns property name
+func scanTransactionProperty(d *xml.Decoder) (string, error) {
+	var name string
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return "", err
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			// Name (WFS 1.x) or ValueReference (WFS 2.0)
+			if el.Name.Local == "Name" || el.Name.Local == "ValueReference" {
+				if err := d.DecodeElement(&name, &el); err != nil {
+					return "", err
+				}
+				name = layerName(name)
+			} else if err := d.Skip(); err != nil {
+				return "", err
+			}
+		case xml.EndElement:
+			return name, nil
+		}
+	}
+}
+
+// Parses operation element (Insert/Update/Delete/Replace)
+func scanTransactionOperation(d *xml.Decoder, start xml.StartElement) ([]TransactionOperation, error) {
+	action := strings.ToLower(start.Name.Local)
+	op := TransactionOperation{Action: action, TypeName: xmlAttr(start, "typeName")}
+	var features []TransactionOperation
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case el.Name.Local == "Filter":
+				ids, filtered, err := scanTransactionFilter(d)
+				if err != nil {
+					return nil, err
+				}
+				op.FeatureIDs = append(op.FeatureIDs, ids...)
+				op.Filtered = op.Filtered || filtered
+			case action == wfsUpdate && el.Name.Local == "Property":
+				name, err := scanTransactionProperty(d)
+				if err != nil {
+					return nil, err
+				}
+				op.Attributes = append(op.Attributes, name)
+			case action == wfsInsert || action == wfsReplace:
+				// feature element, name of the element is the type name
+				attrs, err := scanTransactionFeature(d)
+				if err != nil {
+					return nil, err
+				}
+				typeName := el.Name.Local
+				if el.Name.Space != "" {
+					typeName = fmt.Sprintf("{%s}%s", el.Name.Space, el.Name.Local)
+				}
+				features = append(features, TransactionOperation{
+					Action:     action,
+					TypeName:   typeName,
+					Layer:      el.Name.Local,
+					Attributes: attrs,
+				})
+			default:
+				if err := d.Skip(); err != nil {
+					return nil, err
+				}
+			}
+		case xml.EndElement:
+			if action == wfsInsert {
+				return features, nil
+			}
+			if action == wfsReplace {
+				// replaced feature with the filter of the operation
+				for i := range features {
+					features[i].FeatureIDs = op.FeatureIDs
+					features[i].Filtered = op.Filtered
+				}
+				return features, nil
+			}
+			op.Layer = layerName(op.TypeName)
+			return []TransactionOperation{op}, nil
+		}
+	}
+}
+
+// Parses WFS transaction document
+func scanWfsTransaction(body []byte) (*Transaction, error) {
+	r, err := parseOwsXmlRequest(body)
+	if err != nil {
+		return nil, err
+	}
+	if r.Transaction == nil {
+		return nil, fmt.Errorf("expected element type <Transaction> but have <%s>", r.Root.Name.Local)
+	}
+	return r.Transaction, nil
+}
+
+func scanTransactionOperations(d *xml.Decoder, t *Transaction) error {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "Insert", "Update", "Delete", "Replace":
+				ops, err := scanTransactionOperation(d, el)
+				if err != nil {
+					return err
+				}
+				t.Operations = append(t.Operations, ops...)
+			default:
+				// e.g. Native or LockId
+				if err := d.Skip(); err != nil {
+					return err
+				}
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
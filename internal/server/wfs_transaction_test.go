@@ -0,0 +1,250 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Transaction generated by QGIS desktop WFS provider (WFS 1.0.0)
+const qgisInsertTransaction = `<Transaction xmlns="http://www.opengis.net/wfs" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.qgis.org/gml http://localhost/api/map/ows/user/project?SERVICE=WFS&amp;REQUEST=DescribeFeatureType&amp;VERSION=1.0.0&amp;TYPENAME=parks" xmlns:gml="http://www.opengis.net/gml" service="WFS" version="1.0.0">
+ <Insert xmlns="http://www.opengis.net/wfs">
+  <parks xmlns="http://www.qgis.org/gml">
+   <geometry xmlns="http://www.qgis.org/gml"><gml:Point srsName="EPSG:4326"><gml:coordinates cs="," ts=" ">14.42,50.08</gml:coordinates></gml:Point></geometry>
+   <name xmlns="http://www.qgis.org/gml">Letna</name>
+   <area xmlns="http://www.qgis.org/gml">12.5</area>
+  </parks>
+  <parks xmlns="http://www.qgis.org/gml">
+   <geometry xmlns="http://www.qgis.org/gml"><gml:Point srsName="EPSG:4326"><gml:coordinates cs="," ts=" ">14.40,50.07</gml:coordinates></gml:Point></geometry>
+   <name xmlns="http://www.qgis.org/gml">Petrin</name>
+  </parks>
+ </Insert>
+</Transaction>`
+
+const qgisUpdateTransaction = `<Transaction xmlns="http://www.opengis.net/wfs" xmlns:gml="http://www.opengis.net/gml" service="WFS" version="1.0.0">
+ <Update xmlns="http://www.opengis.net/wfs" typeName="qgs:parks" xmlns:qgs="http://www.qgis.org/gml">
+  <Property xmlns="http://www.opengis.net/wfs">
+   <Name xmlns="http://www.opengis.net/wfs">name</Name>
+   <Value xmlns="http://www.opengis.net/wfs">Letna park</Value>
+  </Property>
+  <Property xmlns="http://www.opengis.net/wfs">
+   <Name xmlns="http://www.opengis.net/wfs">qgs:area</Name>
+   <Value xmlns="http://www.opengis.net/wfs">13</Value>
+  </Property>
+  <Filter xmlns="http://www.opengis.net/ogc">
+   <FeatureId xmlns="http://www.opengis.net/ogc" fid="parks.4"/>
+  </Filter>
+ </Update>
+</Transaction>`
+
+const qgisDeleteTransaction = `<Transaction xmlns="http://www.opengis.net/wfs" xmlns:gml="http://www.opengis.net/gml" service="WFS" version="1.0.0">
+ <Delete xmlns="http://www.opengis.net/wfs" typeName="qgs:parks" xmlns:qgs="http://www.qgis.org/gml">
+  <Filter xmlns="http://www.opengis.net/ogc">
+   <FeatureId xmlns="http://www.opengis.net/ogc" fid="parks.4"/>
+   <FeatureId xmlns="http://www.opengis.net/ogc" fid="parks.7"/>
+  </Filter>
+ </Delete>
+</Transaction>`
+
+// Transaction of the web client (WFS 1.1.0) with prefixed elements, modifying multiple layers
+const multiLayerTransaction = `<?xml version="1.0" encoding="UTF-8"?>
+<wfs:Transaction xmlns:wfs="http://www.opengis.net/wfs" xmlns:ogc="http://www.opengis.net/ogc" xmlns:gml="http://www.opengis.net/gml" xmlns:feature="http://www.qgis.org/gml" service="WFS" version="1.1.0">
+ <wfs:Insert>
+  <feature:trees>
+   <feature:geometry><gml:Point><gml:pos>14.42 50.08</gml:pos></gml:Point></feature:geometry>
+   <feature:species>Oak</feature:species>
+  </feature:trees>
+ </wfs:Insert>
+ <wfs:Update typeName="feature:land_parcels">
+  <wfs:Property><wfs:Name>owner</wfs:Name><wfs:Value>City</wfs:Value></wfs:Property>
+  <ogc:Filter>
+   <ogc:And>
+    <ogc:GmlObjectId gml:id="land_parcels.1"/>
+    <ogc:PropertyIsEqualTo><ogc:PropertyName>owner</ogc:PropertyName><ogc:Literal>State</ogc:Literal></ogc:PropertyIsEqualTo>
+   </ogc:And>
+  </ogc:Filter>
+ </wfs:Update>
+ <wfs:Delete typeName="{http://www.qgis.org/gml}trees">
+  <ogc:Filter>
+   <ogc:Or>
+    <ogc:GmlObjectId gml:id="trees.3"/>
+    <ogc:GmlObjectId gml:id="trees.5"/>
+   </ogc:Or>
+  </ogc:Filter>
+ </wfs:Delete>
+</wfs:Transaction>`
+
+// WFS 2.0 transaction
+const wfs2Transaction = `<wfs:Transaction xmlns:wfs="http://www.opengis.net/wfs/2.0" xmlns:fes="http://www.opengis.net/fes/2.0" xmlns:qgs="http://www.qgis.org/gml" service="WFS" version="2.0.0">
+ <wfs:Update typeName="qgs:parks">
+  <wfs:Property><wfs:ValueReference>qgs:name</wfs:ValueReference><wfs:Value>Stromovka</wfs:Value></wfs:Property>
+  <fes:Filter><fes:ResourceId rid="parks.9"/></fes:Filter>
+ </wfs:Update>
+ <wfs:Replace>
+  <qgs:parks><qgs:name>Vysehrad</qgs:name><qgs:area>3</qgs:area></qgs:parks>
+  <fes:Filter><fes:ResourceId rid="parks.10"/></fes:Filter>
+ </wfs:Replace>
+</wfs:Transaction>`
+
+func TestScanWfsTransaction(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		version  string
+		expected []TransactionOperation
+	}{
+		{
+			name:    "qgis insert",
+			body:    qgisInsertTransaction,
+			version: "1.0.0",
+			expected: []TransactionOperation{
+				{Action: wfsInsert, TypeName: "{http://www.qgis.org/gml}parks", Layer: "parks", Attributes: []string{"geometry", "name", "area"}},
+				{Action: wfsInsert, TypeName: "{http://www.qgis.org/gml}parks", Layer: "parks", Attributes: []string{"geometry", "name"}},
+			},
+		},
+		{
+			name:    "qgis update",
+			body:    qgisUpdateTransaction,
+			version: "1.0.0",
+			expected: []TransactionOperation{
+				{Action: wfsUpdate, TypeName: "qgs:parks", Layer: "parks", Attributes: []string{"name", "area"}, FeatureIDs: []string{"parks.4"}},
+			},
+		},
+		{
+			name:    "qgis delete",
+			body:    qgisDeleteTransaction,
+			version: "1.0.0",
+			expected: []TransactionOperation{
+				{Action: wfsDelete, TypeName: "qgs:parks", Layer: "parks", FeatureIDs: []string{"parks.4", "parks.7"}},
+			},
+		},
+		{
+			name:    "multiple layers",
+			body:    multiLayerTransaction,
+			version: "1.1.0",
+			expected: []TransactionOperation{
+				{Action: wfsInsert, TypeName: "{http://www.qgis.org/gml}trees", Layer: "trees", Attributes: []string{"geometry", "species"}},
+				{Action: wfsUpdate, TypeName: "feature:land_parcels", Layer: "land_parcels", Attributes: []string{"owner"}, FeatureIDs: []string{"land_parcels.1"}, Filtered: true},
+				{Action: wfsDelete, TypeName: "{http://www.qgis.org/gml}trees", Layer: "trees", FeatureIDs: []string{"trees.3", "trees.5"}},
+			},
+		},
+		{
+			name:    "wfs 2.0",
+			body:    wfs2Transaction,
+			version: "2.0.0",
+			expected: []TransactionOperation{
+				{Action: wfsUpdate, TypeName: "qgs:parks", Layer: "parks", Attributes: []string{"name"}, FeatureIDs: []string{"parks.9"}},
+				{Action: wfsReplace, TypeName: "{http://www.qgis.org/gml}parks", Layer: "parks", Attributes: []string{"name", "area"}, FeatureIDs: []string{"parks.10"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		transaction, err := scanWfsTransaction([]byte(tt.body))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if transaction.Version != tt.version {
+			t.Errorf("%s: version %q, expected %q", tt.name, transaction.Version, tt.version)
+		}
+		if !reflect.DeepEqual(transaction.Operations, tt.expected) {
+			t.Errorf("%s:\n got %+v\n expected %+v", tt.name, transaction.Operations, tt.expected)
+		}
+	}
+}
+
+func TestScanWfsTransactionInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"SERVICE=WFS&REQUEST=Transaction",
+		`<GetFeature service="WFS"><Query typeName="parks"/></GetFeature>`,
+		`<Transaction><Delete typeName="parks">`,
+		`<Transaction></Transaction><Transaction></Transaction>`,
+	}
+	for _, body := range tests {
+		if _, err := scanWfsTransaction([]byte(body)); err == nil {
+			t.Errorf("%q: expected error", body)
+		}
+	}
+}
+
+func TestReadOwsPostRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		body        string
+		contentType string
+		service     string
+		request     string
+		xml         bool
+	}{
+		{
+			name:    "transaction without request parameter",
+			query:   "SERVICE=WFS",
+			body:    qgisDeleteTransaction,
+			service: "WFS",
+			request: "Transaction",
+			xml:     true,
+		},
+		{
+			name:    "request parameter is ignored",
+			query:   "SERVICE=WFS&REQUEST=GetCapabilities",
+			body:    qgisUpdateTransaction,
+			service: "WFS",
+			request: "Transaction",
+			xml:     true,
+		},
+		{
+			name:    "lowercase parameters",
+			query:   "service=wfs&request=GetFeature",
+			body:    multiLayerTransaction,
+			service: "WFS",
+			request: "Transaction",
+			xml:     true,
+		},
+		{
+			name:    "service from root element",
+			query:   "SERVICE=WMS",
+			body:    `<GetFeature xmlns="http://www.opengis.net/wfs" service="WFS" version="1.1.0"><Query typeName="parks"/></GetFeature>`,
+			service: "WFS",
+			request: "GetFeature",
+			xml:     true,
+		},
+		{
+			name:        "form parameters",
+			query:       "SERVICE=WMS&REQUEST=GetCapabilities",
+			body:        "service=WFS&request=Transaction&OPERATION=DELETE&TYPENAME=parks",
+			contentType: "application/x-www-form-urlencoded",
+			service:     "WFS",
+			request:     "Transaction",
+		},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/map/ows/user/project?"+tt.query, strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		query := req.URL.Query()
+		xmlReq, err := readOwsPostRequest(req, query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		params := parseOwsRequestParams(query)
+		if params.Service != tt.service || params.Request != tt.request {
+			t.Errorf("%s: got %s %s, expected %s %s", tt.name, params.Service, params.Request, tt.service, tt.request)
+		}
+		forwarded, _ := ioutil.ReadAll(req.Body)
+		if tt.xml {
+			if xmlReq == nil || !bytes.Equal(xmlReq.Body, []byte(tt.body)) || !bytes.Equal(forwarded, xmlReq.Body) {
+				t.Errorf("%s: request body was not preserved", tt.name)
+			}
+		} else if xmlReq != nil || len(forwarded) > 0 || req.Method != http.MethodGet {
+			t.Errorf("%s: form request was not converted into GET request", tt.name)
+		}
+	}
+}
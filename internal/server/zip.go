@@ -0,0 +1,69 @@
+package server
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Extensions of files which are stored in zip archives without compression by default
+var DefaultZipStoreExtensions = []string{
+	".gpkg", ".mbtiles", ".jpg", ".jpeg", ".png", ".webp", ".gif", ".tif", ".tiff", ".ecw", ".jp2",
+	".zip", ".gz", ".tgz", ".bz2", ".xz", ".7z", ".zst", ".mp3", ".mp4", ".webm",
+}
+
+type ZipConfig struct {
+	// deflate compression level (-1 for default level, 0 for store-only mode)
+	CompressionLevel int
+	StoreExtensions  []string
+}
+
+// Creates zip writer with configured compression level
+func (s *Server) newZipWriter(w io.Writer) *zip.Writer {
+	writer := zip.NewWriter(w)
+	level := s.Config.Zip.CompressionLevel
+	if level != flate.DefaultCompression {
+		writer.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+	}
+	return writer
+}
+
+func (s *Server) zipMethod(name string) uint16 {
+	if s.Config.Zip.CompressionLevel == flate.NoCompression {
+		return zip.Store
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range s.Config.Zip.StoreExtensions {
+		if e == ext {
+			return zip.Store
+		}
+	}
+	return zip.Deflate
+}
+
+// Adds file into zip archive. Zip64 format is used automatically for files larger than 4 GB.
+func (s *Server) addZipFile(w *zip.Writer, path, name string, info fs.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(name)
+	header.Method = s.zipMethod(name)
+	dest, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(dest, file)
+	return err
+}
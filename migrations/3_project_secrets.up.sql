@@ -0,0 +1,8 @@
+CREATE TABLE project_secrets (
+	"project" varchar(255) NOT NULL,
+	"name" varchar(100) NOT NULL,
+	"data" bytea NOT NULL,
+	"created_at" timestamptz NOT NULL,
+	"updated_at" timestamptz NOT NULL,
+	PRIMARY KEY ("project", "name")
+);
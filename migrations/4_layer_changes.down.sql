@@ -0,0 +1 @@
+DROP TABLE IF EXISTS layer_changes;
@@ -0,0 +1,12 @@
+CREATE TABLE layer_changes (
+	"seq" bigserial PRIMARY KEY,
+	"project" varchar(255) NOT NULL,
+	"layer" varchar(255) NOT NULL,
+	"action" varchar(10) NOT NULL,
+	"feature_id" varchar(255) NOT NULL,
+	"username" varchar(30) NOT NULL,
+	"attributes" JSONB,
+	"created_at" timestamptz NOT NULL
+);
+
+CREATE INDEX layer_changes_project_layer_idx ON layer_changes USING btree (project, layer, seq);
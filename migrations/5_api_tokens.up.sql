@@ -0,0 +1,11 @@
+CREATE TABLE api_tokens (
+	"id" varchar(36) PRIMARY KEY,
+	"username" varchar(30) NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	"name" varchar(100) NOT NULL,
+	"token_hash" varchar(64) NOT NULL UNIQUE,
+	"created_at" timestamptz NOT NULL,
+	"expires_at" timestamptz NULL,
+	"last_used_at" timestamptz NULL
+);
+
+CREATE INDEX api_tokens_username_idx ON api_tokens USING btree (username);
@@ -0,0 +1,13 @@
+CREATE TABLE invitations (
+	"id" varchar(36) PRIMARY KEY,
+	"email" varchar(254) NOT NULL,
+	"role" varchar(20) NOT NULL,
+	"token_hash" varchar(64) NOT NULL UNIQUE,
+	"invited_by" varchar(30) NOT NULL,
+	"created_at" timestamptz NOT NULL,
+	"expires_at" timestamptz NOT NULL,
+	"accepted_at" timestamptz NULL,
+	"username" varchar(30) NULL
+);
+
+CREATE INDEX invitations_email_idx ON invitations USING btree (email);
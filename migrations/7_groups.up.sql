@@ -0,0 +1,13 @@
+CREATE TABLE user_groups (
+	"name" varchar(50) PRIMARY KEY,
+	"description" varchar(255) NOT NULL DEFAULT '',
+	"created_at" timestamptz NOT NULL
+);
+
+CREATE TABLE group_members (
+	"group_name" varchar(50) NOT NULL REFERENCES user_groups (name) ON DELETE CASCADE ON UPDATE CASCADE,
+	"username" varchar(30) NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	PRIMARY KEY (group_name, username)
+);
+
+CREATE INDEX group_members_username_idx ON group_members USING btree (username);
@@ -0,0 +1,7 @@
+CREATE TABLE account_deletions (
+	"username" varchar(30) PRIMARY KEY REFERENCES users (username) ON DELETE CASCADE,
+	"requested_at" timestamptz NOT NULL,
+	"scheduled_at" timestamptz NOT NULL
+);
+
+CREATE INDEX account_deletions_scheduled_idx ON account_deletions USING btree (scheduled_at);
@@ -0,0 +1,9 @@
+CREATE TABLE user_identities (
+	"issuer" varchar(255) NOT NULL,
+	"subject" varchar(255) NOT NULL,
+	"username" varchar(30) NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	"created_at" timestamptz NOT NULL,
+	PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX user_identities_username_idx ON user_identities USING btree (username);
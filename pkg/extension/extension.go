@@ -0,0 +1,54 @@
+// Package extension exposes the server extension API for custom builds of the server.
+//
+// Extension packages register themselves from init function and the custom binary
+// just imports them and runs the standard commands:
+//
+//	func init() {
+//		extension.Register("ldap", extension.Func(func(ctx *extension.Context) error {
+//			ctx.Auth.AddBackend(newLdapBackend(ctx.Accounts))
+//			return nil
+//		}))
+//	}
+//
+// Enabled extensions are listed in GISQUICK_EXTENSIONS configuration variable.
+package extension
+
+import (
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
+)
+
+type (
+	Extension = server.Extension
+	Starter   = server.ExtensionStarter
+	Stopper   = server.ExtensionStopper
+	Func      = server.ExtensionFunc
+	Context   = server.ExtensionContext
+
+	AuthBackend = auth.Backend
+	Account     = domain.Account
+	User        = domain.User
+
+	Event        = application.Event
+	EventHandler = application.EventHandler
+)
+
+const (
+	EventProjectPublished = application.EventProjectPublished
+	EventFilesChanged     = application.EventFilesChanged
+	EventUserRegistered   = application.EventUserRegistered
+	EventWfsCommitted     = application.EventWfsCommitted
+	EventAll              = application.EventAll
+)
+
+var (
+	ErrUserNotFound    = auth.ErrUserNotFound
+	ErrInvalidPassword = auth.ErrInvalidPassword
+)
+
+// Register makes extension available by the name (panics when the name is already registered)
+func Register(name string, ext Extension) {
+	server.RegisterExtension(name, ext)
+}
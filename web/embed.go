@@ -0,0 +1,24 @@
+// Package web contains built web client (Gisquick frontend) embedded into the server binary.
+// Files of the built client must be copied into the dist directory before building the server.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// Files returns embedded files of the web client, or false when the client wasn't embedded
+// into the binary (dist directory was empty at build time)
+func Files() (fs.FS, bool) {
+	files, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil, false
+	}
+	if _, err := fs.Stat(files, "index.html"); err != nil {
+		return nil, false
+	}
+	return files, true
+}